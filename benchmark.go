@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"text/tabwriter"
+	"time"
+
+	"github.com/vipnode/vipnode/client"
+	"github.com/vipnode/vipnode/internal/pretty"
+	"github.com/vipnode/vipnode/pool/store"
+)
+
+func runBenchmark(options Options, w io.Writer) error {
+	remoteNode, err := findRPC(options.Benchmark.RPC, dialOptions(options))
+	if err != nil {
+		return err
+	}
+	b := &client.Benchmark{
+		Node:  remoteNode,
+		Probe: client.DialProbe(rpcTimeout),
+	}
+
+	var results []*client.BenchmarkResult
+	var errs []error
+	for _, enode := range options.Benchmark.Args.Hosts {
+		logger.Infof("Benchmarking host: %s", enode)
+		result, err := b.Run(context.Background(), store.Node{URI: enode})
+		if err != nil {
+			logger.Warningf("Failed to benchmark host %q: %s", enode, err)
+		}
+		results = append(results, result)
+		errs = append(errs, err)
+	}
+	if err := writeBenchmark(w, options.Benchmark.Args.Hosts, results, errs); err != nil {
+		return err
+	}
+	for _, result := range results {
+		if result != nil {
+			return nil
+		}
+	}
+	return ErrExplain{errors.New("no hosts could be benchmarked"), "Make sure the local node can reach the hosts. Hosts which are at capacity only accept clients whitelisted by their pool."}
+}
+
+// writeBenchmark prints a table of the results for each host, or why it
+// failed.
+func writeBenchmark(w io.Writer, hosts []string, results []*client.BenchmarkResult, errs []error) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "Host\tHandshake\tLatency\tBlock lag\tScore")
+	for i, enode := range hosts {
+		host := pretty.Abbrev(enode).String()
+		if u, err := url.Parse(enode); err == nil && u.User != nil {
+			host = pretty.Abbrev(u.User.Username()).String()
+		}
+		if results[i] == nil {
+			fmt.Fprintf(tw, "%s\t-\t-\t-\tfailed: %s\n", host, errs[i])
+			continue
+		}
+		r := results[i]
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%.0f\n", host, r.Handshake.Round(time.Millisecond), r.Latency.Round(time.Millisecond), r.BlockLag, r.Score())
+	}
+	return tw.Flush()
+}
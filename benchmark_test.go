@@ -0,0 +1,34 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/vipnode/vipnode/client"
+)
+
+func TestWriteBenchmark(t *testing.T) {
+	hosts := []string{
+		"enode://19b5013d24243a659bda7f1df13933bb05820ab6c3ebf6b5e0854848b97e1f7e308f703466e72486c5bc7fe8ed402eb62f6303418e05d330a5df80738ac974f6@163.172.138.100:30303",
+		"enode://aaaa@127.0.0.1:30303",
+	}
+	results := []*client.BenchmarkResult{
+		{Handshake: 1500 * time.Millisecond, Latency: 42 * time.Millisecond, BlockLag: 2},
+		nil,
+	}
+	errs := []error{nil, errors.New("peer did not complete the handshake")}
+
+	var buf bytes.Buffer
+	if err := writeBenchmark(&buf, hosts, results, errs); err != nil {
+		t.Fatal(err)
+	}
+	want := `Host           Handshake  Latency  Block lag  Score
+19b5013d2424…  1.5s       42ms     2          87
+aaaa           -          -        -          failed: peer did not complete the handshake
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// parseCapabilities parses capability flags of the form name or name=value.
+// A bare name has an empty value, which matches any value when required by a
+// client. It returns nil if there are no flags.
+func parseCapabilities(flags []string) (map[string]string, error) {
+	if len(flags) == 0 {
+		return nil, nil
+	}
+	capabilities := make(map[string]string, len(flags))
+	for _, flag := range flags {
+		parts := strings.SplitN(flag, "=", 2)
+		name := strings.TrimSpace(parts[0])
+		if name == "" {
+			return nil, fmt.Errorf("invalid capability: %q", flag)
+		}
+		value := ""
+		if len(parts) == 2 {
+			value = strings.TrimSpace(parts[1])
+		}
+		capabilities[name] = value
+	}
+	return capabilities, nil
+}
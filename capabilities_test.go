@@ -0,0 +1,22 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCapabilities(t *testing.T) {
+	got, err := parseCapabilities([]string{"archive", "network=ropsten", "trace="})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"archive": "", "network": "ropsten", "trace": ""}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v; want %v", got, want)
+	}
+	if got, err := parseCapabilities(nil); err != nil || got != nil {
+		t.Errorf("expected no capabilities, got: %v, %v", got, err)
+	}
+	if _, err := parseCapabilities([]string{"=true"}); err == nil {
+		t.Error("expected error for a missing name")
+	}
+}
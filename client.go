@@ -6,10 +6,14 @@ import (
 	"net/url"
 	"os"
 	"os/signal"
+	"strings"
 
 	"github.com/ethereum/go-ethereum/p2p/discv5"
 	"github.com/vipnode/vipnode/client"
+	"github.com/vipnode/vipnode/ethnode"
 	"github.com/vipnode/vipnode/jsonrpc2"
+	"github.com/vipnode/vipnode/jsonrpc2/longpoll"
+	"github.com/vipnode/vipnode/jsonrpc2/tcp"
 	"github.com/vipnode/vipnode/pool"
 
 	ws "github.com/vipnode/vipnode/jsonrpc2/ws/gorilla"
@@ -19,12 +23,19 @@ import (
 //var defaultClientNode string = "enode://19b5013d24243a659bda7f1df13933bb05820ab6c3ebf6b5e0854848b97e1f7e308f703466e72486c5bc7fe8ed402eb62f6303418e05d330a5df80738ac974f6@163.172.138.100:30303?discport=30301"
 var defaultClientNode string = "https://pool.vipnode.org/"
 
-func runClient(options Options) error {
+// runClient runs the client agent until it's stopped. It calls connected
+// once it has registered with the pool.
+func runClient(options Options, connected func()) error {
 	// Load input data from cli params
-	remoteNode, err := findRPC(options.Client.RPC)
+	remoteNode, err := findRPC(options.Client.RPC, dialOptions(options))
 	if err != nil {
 		return err
 	}
+	defer remoteNode.Close()
+	capabilities, err := parseCapabilities(options.Client.Require)
+	if err != nil {
+		return ErrExplain{err, "Required capabilities must be a name or name=value, such as \"archive\"."}
+	}
 
 	poolURI := options.Client.Args.VIPNode
 	if poolURI == "" {
@@ -36,10 +47,33 @@ func runClient(options Options) error {
 	}
 
 	errChan := make(chan error)
-	c := client.New(remoteNode)
+	var clientNode ethnode.EthNode = remoteNode
+	var reporter *pool.ErrorReporter
+	if options.Client.ReportErrors {
+		reporter = newErrorReporter(remoteNode)
+		clientNode = ethnode.Traced(remoteNode, reporter)
+	}
+	c := client.New(clientNode)
+	c.ErrorReporter = reporter
+	c.CheckNetwork = true
+	c.Version = Version
+	c.Capabilities = capabilities
+	c.CapabilitiesFallback = options.Client.RequireAny
 	c.PoolMessageCallback = func(msg string) {
 		logger.Alertf("Message from pool: %s", msg)
 	}
+	c.ClockSkewCallback = warnClockSkew
+	if options.Client.HostCache != "" && uri.Scheme != "enode" {
+		// Hosts of a static pool can't be re-validated.
+		c.HostCache = &client.HostCache{Path: options.Client.HostCache, TTL: options.Client.HostCacheTTL}
+	}
+	if options.Client.MaxHostLatency > 0 {
+		c.Quality = &client.QualityMonitor{
+			Probe:      client.DialProbe(rpcTimeout),
+			MaxLatency: options.Client.MaxHostLatency,
+			Sustain:    3,
+		}
+	}
 
 	// If we want, we can connect to a vipnode host directly, bypassing the need for a pool.
 	if uri.Scheme == "enode" {
@@ -51,6 +85,7 @@ func runClient(options Options) error {
 		if err := c.Start(staticPool); err != nil {
 			return err
 		}
+		connected()
 		return c.Wait()
 	}
 
@@ -75,35 +110,80 @@ func runClient(options Options) error {
 	// The pool hosts an RPC API over websocket and HTTP. The host uses websocket by default
 	// for persistent connectivity, but for the client it's probably best to stick with HTTP.
 	// Especially if the client could be a mobile device, it's probably more battery-friendly.
-	var rpcPool jsonrpc2.Service
-	if uri.Scheme == "ws" || uri.Scheme == "wss" {
-		ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
-		poolCodec, err := ws.WebSocketDial(ctx, uri.String())
-		cancel()
+	// connect dials the pool and sends the client handshake.
+	connect := func(poolURI string) error {
+		uri, err := url.Parse(poolURI)
 		if err != nil {
-			return ErrExplain{err, "Failed to connect to the pool RPC API."}
+			return err
+		}
+		var rpcPool jsonrpc2.Service
+		var serveErr chan error
+		var poolCodec jsonrpc2.Codec
+		if uri.Scheme == "ws" || uri.Scheme == "wss" || uri.Scheme == "tcp" || strings.HasPrefix(uri.Scheme, pollScheme) {
+			// The pool can ask the client to migrate between hosts over the
+			// same connection.
+			rpcServer := &jsonrpc2.Server{}
+			if err := rpcServer.RegisterMethod("vipnode_migrate", c, "Migrate"); err != nil {
+				return err
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+			if uri.Scheme == "tcp" {
+				poolCodec, err = tcp.Dial(ctx, uri.Host)
+			} else if strings.HasPrefix(uri.Scheme, pollScheme) {
+				poolCodec, err = longpoll.Dial(ctx, strings.TrimPrefix(uri.String(), pollScheme), nil)
+			} else {
+				poolCodec, err = ws.DialWithOptions(ctx, uri.String(), ws.DialOptions{Compression: options.WSCompression})
+			}
+			cancel()
+			if err != nil {
+				return ErrExplain{err, "Failed to connect to the pool RPC API."}
+			}
+			remote := &jsonrpc2.Remote{
+				Codec:  poolCodec,
+				Server: rpcServer,
+			}
+			serveErr = make(chan error, 1)
+			go func() {
+				serveErr <- remote.Serve()
+			}()
+			rpcPool = remote
+		} else {
+			// Assume HTTP by default
+			rpcPool = &jsonrpc2.HTTPService{
+				Endpoint: uri.String(),
+			}
 		}
-		remote := &jsonrpc2.Remote{
-			Codec: poolCodec,
+
+		p := pool.Remote(rpcPool, privkey)
+
+		// Send the vipnode_client handshake and start sending regular updates.
+		if err := c.Start(p); err != nil {
+			if jsonrpc2.IsErrorCode(err, jsonrpc2.ErrCodeMethodNotFound, jsonrpc2.ErrCodeInvalidParams) {
+				err = ErrExplain{err, fmt.Sprintf(`Missing a required RPC method. Make sure your vipnode client is up to date. (Current version: %s)`, Version)}
+			}
+			if poolCodec != nil {
+				// Drop the connection so we can fail over to another pool.
+				poolCodec.Close()
+			}
+			return err
 		}
-		go func() {
-			errChan <- remote.Serve()
-		}()
-		rpcPool = remote
-	} else {
-		// Assume HTTP by default
-		rpcPool = &jsonrpc2.HTTPService{
-			Endpoint: uri.String(),
+		connected()
+		if serveErr != nil {
+			go func() {
+				errChan <- <-serveErr
+			}()
 		}
+		return nil
 	}
 
-	p := pool.Remote(rpcPool, privkey)
-
-	// Send the vipnode_client handshake and start sending regular updates.
-	if err := c.Start(p); err != nil {
-		if jsonrpc2.IsErrorCode(err, jsonrpc2.ErrCodeMethodNotFound, jsonrpc2.ErrCodeInvalidParams) {
-			err = ErrExplain{err, fmt.Sprintf(`Missing a required RPC method. Make sure your vipnode client is up to date. (Current version: %s)`, Version)}
+	if d := poolDiscovery(poolURI); d != nil {
+		// Fail over between discovered pools until one accepts us.
+		poolURI, err = d.Try(context.Background(), connect)
+		if err != nil {
+			return ErrExplain{err, "Failed to connect to any of the discovered pools."}
 		}
+		logger.Infof("Discovered pool: %s", poolURI)
+	} else if err := connect(poolURI); err != nil {
 		return err
 	}
 	logger.Info("Connected.")
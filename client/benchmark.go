@@ -0,0 +1,125 @@
+package client
+
+import (
+	"context"
+	"time"
+
+	"github.com/vipnode/vipnode/ethnode"
+	"github.com/vipnode/vipnode/pool/store"
+)
+
+// Limits at which each part of a BenchmarkResult scores nothing.
+const (
+	benchHandshakeLimit = 10 * time.Second
+	benchLatencyLimit   = time.Second
+	benchBlockLagLimit  = 10
+)
+
+// BenchmarkResult is the measured quality of a candidate host.
+type BenchmarkResult struct {
+	Host store.Node
+	// Handshake is how long the host took to show up in the local node's
+	// peers after connecting.
+	Handshake time.Duration
+	// Latency is the round trip time measured by the Benchmark's Probe, such
+	// as for fetching a block header from the host.
+	Latency time.Duration
+	// BlockLag is how many blocks the host is behind the local node, or 0 if
+	// it's caught up or its latest block is unknown.
+	BlockLag uint64
+}
+
+// Score rates the result from 0 (unusable) to 100. Handshake time, latency
+// and block lag each make up a third, falling linearly from full marks to
+// none at their limit.
+func (r BenchmarkResult) Score() float64 {
+	part := func(v, limit float64) float64 {
+		if v >= limit {
+			return 0
+		}
+		return 1 - v/limit
+	}
+	score := part(float64(r.Handshake), float64(benchHandshakeLimit)) +
+		part(float64(r.Latency), float64(benchLatencyLimit)) +
+		part(float64(r.BlockLag), benchBlockLagLimit)
+	return score / 3 * 100
+}
+
+// Benchmark measures candidate hosts by connecting to them from the local
+// node, so they can be compared before committing a balance to the pool.
+type Benchmark struct {
+	// Node is the local node which connects to the hosts.
+	Node ethnode.EthNode
+
+	// Probe measures the latency and latest block of a connected host.
+	Probe HostProber
+
+	// Timeout is how long to wait for the host to complete the handshake.
+	// Defaults to 30 seconds.
+	Timeout time.Duration
+	// PollInterval is how often the local node's peers are checked while
+	// waiting for the handshake. Defaults to 1 second.
+	PollInterval time.Duration
+}
+
+// Run connects to host, measures it, and disconnects from it afterwards.
+func (b *Benchmark) Run(ctx context.Context, host store.Node) (*BenchmarkResult, error) {
+	nodeID, err := enodeID(host.URI)
+	if err != nil {
+		return nil, HostMismatchError{host, err.Error()}
+	}
+	timeout, pollInterval := b.Timeout, b.PollInterval
+	if timeout == 0 {
+		timeout = connectTimeout
+	}
+	if pollInterval == 0 {
+		pollInterval = connectPollInterval
+	}
+
+	start := time.Now()
+	if err := b.Node.ConnectPeer(ctx, host.URI); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := b.Node.DisconnectPeer(ctx, host.URI); err != nil {
+			logger.Printf("Failed to disconnect from benchmarked host %q: %s", host.URI, err)
+		}
+	}()
+
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	for {
+		connected, err := hasPeer(waitCtx, b.Node, nodeID)
+		if err != nil {
+			return nil, err
+		}
+		if connected {
+			break
+		}
+		select {
+		case <-time.After(pollInterval):
+		case <-waitCtx.Done():
+			return nil, HostMismatchError{host, "peer did not complete the handshake"}
+		}
+	}
+	result := &BenchmarkResult{Host: host, Handshake: time.Since(start)}
+
+	sample, err := b.Probe(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	result.Latency = sample.Latency
+
+	localBlock, err := b.Node.BlockNumber(ctx)
+	if err != nil {
+		return nil, err
+	}
+	hostBlock := sample.BlockNumber
+	if hostBlock == 0 {
+		hostBlock = host.BlockNumber
+	}
+	if hostBlock > 0 && hostBlock < localBlock {
+		result.BlockLag = localBlock - hostBlock
+	}
+	return result, nil
+}
@@ -0,0 +1,102 @@
+package client
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/vipnode/vipnode/ethnode"
+	"github.com/vipnode/vipnode/internal/fakenode"
+	"github.com/vipnode/vipnode/pool/store"
+)
+
+// slowHandshakeNode only shows connected peers after a number of polls.
+type slowHandshakeNode struct {
+	*fakenode.FakeNode
+	polls int
+}
+
+func (n *slowHandshakeNode) Peers(ctx context.Context) ([]ethnode.PeerInfo, error) {
+	if n.polls > 0 {
+		n.polls--
+		return nil, nil
+	}
+	return n.FakeNode.Peers(ctx)
+}
+
+func TestBenchmark(t *testing.T) {
+	node := &slowHandshakeNode{FakeNode: fakenode.Node("1234"), polls: 2}
+	node.FakeBlockNumber = 42
+	b := &Benchmark{
+		Node: node,
+		Probe: fakeProbe(map[store.NodeID]HostSample{
+			hostA.ID: {Latency: 200 * time.Millisecond, BlockNumber: 37},
+		}),
+		PollInterval: 10 * time.Millisecond,
+	}
+	result, err := b.Run(context.Background(), hostA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Handshake < 20*time.Millisecond {
+		t.Errorf("handshake took %s, expected at least 2 polls", result.Handshake)
+	}
+	if result.Latency != 200*time.Millisecond {
+		t.Errorf("wrong latency: %s", result.Latency)
+	}
+	if result.BlockLag != 5 {
+		t.Errorf("wrong block lag: %d", result.BlockLag)
+	}
+	calls := node.Calls
+	if len(calls) != 2 || calls[0].Method != "ConnectPeer" || calls[1].Method != "DisconnectPeer" {
+		t.Errorf("expected to connect and disconnect, got: %v", calls)
+	}
+
+	// Hosts ahead of the local node, or with an unknown block, don't lag.
+	b.Probe = fakeProbe(map[store.NodeID]HostSample{hostA.ID: {Latency: time.Millisecond}, hostB.ID: {BlockNumber: 50}})
+	for _, host := range []store.Node{hostA, hostB} {
+		result, err := b.Run(context.Background(), host)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.BlockLag != 0 {
+			t.Errorf("%s: unexpected block lag: %d", host.ID, result.BlockLag)
+		}
+	}
+}
+
+func TestBenchmarkTimeout(t *testing.T) {
+	node := &impostorNode{fakenode.Node("1234")}
+	b := &Benchmark{
+		Node:         node,
+		Probe:        fakeProbe(nil),
+		Timeout:      30 * time.Millisecond,
+		PollInterval: 10 * time.Millisecond,
+	}
+	if _, err := b.Run(context.Background(), hostA); err == nil {
+		t.Fatal("expected handshake timeout")
+	} else if _, ok := err.(HostMismatchError); !ok {
+		t.Errorf("expected HostMismatchError, got: %v", err)
+	}
+	if calls := node.Calls; len(calls) != 2 || calls[1].Method != "DisconnectPeer" {
+		t.Errorf("expected to disconnect after failing, got: %v", calls)
+	}
+}
+
+func TestBenchmarkScore(t *testing.T) {
+	testcases := []struct {
+		result BenchmarkResult
+		want   float64
+	}{
+		{BenchmarkResult{}, 100},
+		{BenchmarkResult{Handshake: 5 * time.Second, Latency: 500 * time.Millisecond, BlockLag: 5}, 50},
+		{BenchmarkResult{Latency: time.Second}, 200.0 / 3},
+		{BenchmarkResult{Handshake: time.Minute, Latency: 2 * time.Second, BlockLag: 100}, 0},
+	}
+	for i, tc := range testcases {
+		if got := tc.result.Score(); math.Abs(got-tc.want) > 1e-9 {
+			t.Errorf("[case %d] got score %f; want %f", i, got, tc.want)
+		}
+	}
+}
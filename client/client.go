@@ -5,6 +5,7 @@ import (
 	"errors"
 	"time"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/vipnode/vipnode/ethnode"
 	"github.com/vipnode/vipnode/pool"
 	"github.com/vipnode/vipnode/pool/store"
@@ -15,9 +16,10 @@ var ErrAlreadyConnected = errors.New("client already connected")
 
 func New(node ethnode.EthNode) *Client {
 	return &Client{
-		EthNode: node,
-		stopCh:  make(chan struct{}),
-		waitCh:  make(chan error, 1),
+		EthNode:   node,
+		stopCh:    make(chan struct{}),
+		waitCh:    make(chan error, 1),
+		migrateCh: make(chan migration),
 	}
 }
 
@@ -36,9 +38,58 @@ type Client struct {
 	// displayed to the client.
 	PoolMessageCallback func(string)
 
-	connectedHosts []store.Node
-	stopCh         chan struct{}
-	waitCh         chan error
+	// ClockSkewCallback is called after requesting hosts if the local clock
+	// is more than pool.MaxClockSkew off from the pool's, which gets signed
+	// requests rejected. It should be displayed as a warning. (Optional)
+	ClockSkewCallback func(skew time.Duration)
+
+	// Quality monitors connected hosts on every update, degraded hosts are
+	// replaced with new ones from the pool. (Optional)
+	Quality *QualityMonitor
+
+	// CheckNetwork skips hosts whose network ID advertised by the pool does
+	// not match the local node's network, before dialing them. Hosts or nodes
+	// with an unknown network are not checked.
+	CheckNetwork bool
+
+	// Version is the vipnode agent version reported to the pool when
+	// requesting hosts. (Optional)
+	Version string
+
+	// Capabilities are required of the hosts that the pool returns, such as
+	// {"archive": ""} for any archive host. (Optional)
+	Capabilities map[string]string
+
+	// CapabilitiesFallback accepts hosts without the required Capabilities
+	// when the pool has none that match, rather than failing.
+	CapabilitiesFallback bool
+
+	// ErrorReporter sends the node's errors that it recorded to the pool
+	// after updates, if the client opted into error reports. (Optional)
+	ErrorReporter *pool.ErrorReporter
+
+	// HostCache remembers the host the client connected to, so that it's
+	// tried first after a restart. (Optional)
+	HostCache *HostCache
+
+	// genesis is the local node's genesis hash reported to the pool, if
+	// known.
+	genesis string
+
+	stopCh    chan struct{}
+	waitCh    chan error
+	migrateCh chan migration
+}
+
+// clientRequest returns the request for hosts of the given kind.
+func (c *Client) clientRequest(kind string) pool.ClientRequest {
+	return pool.ClientRequest{
+		Kind:                 kind,
+		VipnodeVersion:       c.Version,
+		Genesis:              c.genesis,
+		Capabilities:         c.Capabilities,
+		CapabilitiesFallback: c.CapabilitiesFallback,
+	}
 }
 
 // Wait blocks until the client is stopped.
@@ -53,29 +104,70 @@ func (c *Client) Start(p pool.Pool) error {
 	logger.Printf("Requesting host candidates...")
 	starCtx := context.Background()
 	kind := c.EthNode.Kind().String()
-	resp, err := p.Client(starCtx, pool.ClientRequest{Kind: kind})
+	if genesis, err := c.EthNode.GenesisHash(starCtx); err != nil {
+		logger.Printf("Failed to get the local node's genesis hash: %s", err)
+	} else if genesis != (common.Hash{}) {
+		c.genesis = genesis.Hex()
+	}
+	req := c.clientRequest(kind)
+	cached := c.dialCachedHost(starCtx)
+	if cached != nil {
+		// The pool re-validates the cached host, it's only kept if it's
+		// returned.
+		req.PreferHosts = []string{string(cached.ID)}
+	}
+	sent := time.Now()
+	resp, err := p.Client(starCtx, req)
 	if err != nil {
+		// Keep the cache for the next attempt, but don't stay connected to a
+		// host that the pool didn't re-validate.
+		if cached != nil {
+			if err := c.EthNode.DisconnectPeer(starCtx, cached.URI); err != nil {
+				logger.Printf("Failed to disconnect from cached host %q: %s", cached.ID, err)
+			}
+		}
 		return err
 	}
+	if skew := pool.ClockSkew(resp.PoolTime, sent, time.Now()); skew > pool.MaxClockSkew || -skew > pool.MaxClockSkew {
+		logger.Printf("Local clock is %s off from the pool's", skew)
+		if c.ClockSkewCallback != nil {
+			c.ClockSkewCallback(skew)
+		}
+	}
 	if resp.Message != "" && c.PoolMessageCallback != nil {
 		c.PoolMessageCallback(resp.Message)
 	}
-	nodes := resp.Hosts
+	nodes := c.revalidateCachedHost(starCtx, cached, resp.Hosts)
 	if len(nodes) == 0 {
 		return pool.NoHostNodesError{}
 	}
 	logger.Printf("Received %d host candidates from pool (version %s), connecting...", len(nodes), resp.PoolVersion)
+	connected := make([]store.Node, 0, len(nodes))
+	var verifyErr error
 	for _, node := range nodes {
-		if err := c.EthNode.ConnectPeer(starCtx, node.URI); err != nil {
+		err := c.connectHost(starCtx, node)
+		switch err.(type) {
+		case nil:
+		case HostMismatchError, NetworkMismatchError:
+			// Skip hosts that fail verification, as long as others pass.
+			logger.Printf("Skipping host: %s", err)
+			verifyErr = err
+			continue
+		default:
 			return err
 		}
+		connected = append(connected, node)
 	}
+	if len(connected) == 0 {
+		return verifyErr
+	}
+	c.saveHost(connected[0])
 	if err := c.updatePeers(context.Background(), p); err != nil {
 		return err
 	}
 
 	go func() {
-		c.waitCh <- c.serveUpdates(p, nodes)
+		c.waitCh <- c.serveUpdates(p, connected)
 	}()
 
 	return nil
@@ -89,6 +181,19 @@ func (c *Client) serveUpdates(p pool.Pool, connectedHosts []store.Node) error {
 			if err := c.updatePeers(context.Background(), p); err != nil {
 				return err
 			}
+			if err := c.ErrorReporter.Flush(context.Background(), p); err != nil {
+				logger.Printf("Failed to report node errors to the pool: %s", err)
+			}
+			if c.Quality != nil {
+				connectedHosts = c.checkHosts(context.Background(), p, connectedHosts)
+			}
+		case m := <-c.migrateCh:
+			var err error
+			connectedHosts, err = c.migrate(m.ctx, connectedHosts, m.req)
+			if err == nil {
+				c.saveHost(m.req.Host)
+			}
+			m.errCh <- err
 		case <-c.stopCh:
 			closeCtx := context.Background()
 			for _, node := range connectedHosts {
@@ -101,9 +206,74 @@ func (c *Client) serveUpdates(p pool.Pool, connectedHosts []store.Node) error {
 	}
 }
 
-func (c *Client) updatePeers(ctx context.Context, p pool.Pool) error {
-	peers, err := c.EthNode.Peers(ctx)
+// checkHosts replaces any degraded hosts with new candidates from the pool,
+// and returns the updated list of connected hosts. Degraded hosts are kept if
+// there are no replacements.
+func (c *Client) checkHosts(ctx context.Context, p pool.Pool, connectedHosts []store.Node) []store.Node {
+	var bestBlock uint64
+	if blockNumber, err := c.EthNode.BlockNumber(ctx); err == nil {
+		bestBlock = blockNumber
+	}
+	degraded := c.Quality.Degraded(ctx, connectedHosts, bestBlock)
+	if len(degraded) == 0 {
+		return connectedHosts
+	}
+
+	logger.Printf("%d connected hosts are degraded, requesting replacements...", len(degraded))
+	resp, err := p.Client(ctx, c.clientRequest(c.EthNode.Kind().String()))
 	if err != nil {
+		logger.Printf("Failed to request replacement hosts: %s", err)
+		return connectedHosts
+	}
+
+	connected := make(map[store.NodeID]struct{}, len(connectedHosts))
+	for _, node := range connectedHosts {
+		connected[node.ID] = struct{}{}
+	}
+	candidates := []store.Node{}
+	for _, node := range resp.Hosts {
+		if _, ok := connected[node.ID]; !ok {
+			candidates = append(candidates, node)
+		}
+	}
+
+	replaced := map[store.NodeID]store.Node{}
+	for _, old := range degraded {
+		for len(candidates) > 0 {
+			candidate := candidates[0]
+			candidates = candidates[1:]
+			// Only disconnect once we're connected to the replacement.
+			if err := c.connectHost(ctx, candidate); err != nil {
+				logger.Printf("Failed to connect to replacement host %q: %s", candidate.ID, err)
+				continue
+			}
+			if err := c.EthNode.DisconnectPeer(ctx, old.URI); err != nil {
+				logger.Printf("Failed to disconnect from degraded host %q: %s", old.ID, err)
+			}
+			logger.Printf("Switched from degraded host %q to %q", old.ID, candidate.ID)
+			replaced[old.ID] = candidate
+			break
+		}
+	}
+	if len(replaced) < len(degraded) {
+		logger.Printf("No replacements available for %d degraded hosts.", len(degraded)-len(replaced))
+	}
+
+	r := make([]store.Node, 0, len(connectedHosts))
+	for _, node := range connectedHosts {
+		if replacement, ok := replaced[node.ID]; ok {
+			node = replacement
+		}
+		r = append(r, node)
+	}
+	return r
+}
+
+func (c *Client) updatePeers(ctx context.Context, p pool.Pool) error {
+	peers, err := c.EthNode.PeersLite(ctx)
+	if ethnode.IsPartialPeers(err) {
+		logger.Printf("Updating pool with partial peers: %s", err)
+	} else if err != nil {
 		return err
 	}
 	peerIDs := make([]string, 0, len(peers))
@@ -119,6 +289,13 @@ func (c *Client) updatePeers(ctx context.Context, p pool.Pool) error {
 		c.BalanceCallback(*update.Balance)
 	}
 
+	if update.Expires != nil {
+		logger.Printf("Balance estimated to run out at the current rate in %s", time.Until(*update.Expires).Truncate(time.Second))
+	}
+	if update.Grace != nil {
+		logger.Printf("Balance is below the pool's minimum, disconnecting once the grace runs out (%s)", update.Grace)
+	}
+
 	if len(update.InvalidPeers) > 0 {
 		// Client doesn't really need to do anything if the pool stopped
 		// tracking their host. That means the client is getting a free ride
@@ -1,7 +1,9 @@
 package client
 
 import (
+	"context"
 	"testing"
+	"time"
 
 	"github.com/vipnode/vipnode/internal/fakenode"
 	"github.com/vipnode/vipnode/pool"
@@ -25,3 +27,35 @@ func TestClient(t *testing.T) {
 		URI: "foo",
 	})
 }
+
+// skewedPool is a pool.Pool whose clock is off by skew.
+type skewedPool struct {
+	pool.StaticPool
+	skew time.Duration
+}
+
+func (p *skewedPool) Client(ctx context.Context, req pool.ClientRequest) (*pool.ClientResponse, error) {
+	return &pool.ClientResponse{PoolTime: time.Now().Add(p.skew)}, nil
+}
+
+func TestClientClockSkew(t *testing.T) {
+	var warnings []time.Duration
+	c := New(&fakenode.FakeNode{NodeID: "foo"})
+	c.ClockSkewCallback = func(skew time.Duration) {
+		warnings = append(warnings, skew)
+	}
+
+	// No hosts, but the skew is checked first.
+	if _, ok := c.Start(&skewedPool{skew: -5 * time.Minute}).(pool.NoHostNodesError); !ok {
+		t.Error("expected no hosts error")
+	}
+	if len(warnings) != 1 || warnings[0] < 4*time.Minute {
+		t.Errorf("expected a warning about the local clock being ahead, got: %v", warnings)
+	}
+
+	warnings = nil
+	c.Start(&skewedPool{skew: time.Second})
+	if len(warnings) != 0 {
+		t.Errorf("unexpected warning for small skew: %v", warnings)
+	}
+}
@@ -0,0 +1,180 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/vipnode/vipnode/pool/store"
+)
+
+// DefaultHostCacheTTL is how long a cached host assignment is tried again
+// after it was saved.
+const DefaultHostCacheTTL = 30 * time.Minute
+
+// cachedHost is the format of the HostCache file.
+type cachedHost struct {
+	Host  store.Node `json:"host"`
+	Saved time.Time  `json:"saved"`
+}
+
+// HostCache remembers the last host that the client was connected to in a
+// file, so that a restarted client can dial it again right away rather than
+// waiting on the pool for a new one. The pool still has to re-validate the
+// cached host (see pool.ClientRequest.PreferHosts), and the client drops it
+// if the pool doesn't return it.
+type HostCache struct {
+	// Path of the cache file.
+	Path string
+	// TTL is how long a saved host is used for. (DefaultHostCacheTTL if 0)
+	TTL time.Duration
+
+	now func() time.Time
+}
+
+func (c *HostCache) clock() time.Time {
+	if c.now != nil {
+		return c.now()
+	}
+	return time.Now()
+}
+
+func (c *HostCache) ttl() time.Duration {
+	if c.TTL > 0 {
+		return c.TTL
+	}
+	return DefaultHostCacheTTL
+}
+
+// Load returns the cached host, or nil if there is none or it expired.
+func (c *HostCache) Load() (*store.Node, error) {
+	data, err := ioutil.ReadFile(c.Path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var cached cachedHost
+	if err := json.Unmarshal(data, &cached); err != nil {
+		return nil, err
+	}
+	if cached.Host.URI == "" || c.clock().Sub(cached.Saved) > c.ttl() {
+		return nil, nil
+	}
+	return &cached.Host, nil
+}
+
+// Save replaces the cached host with host. The file is replaced atomically,
+// so that a client which is starting up never reads a partial file.
+func (c *HostCache) Save(host store.Node) error {
+	data, err := json.Marshal(cachedHost{Host: host, Saved: c.clock()})
+	if err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(c.Path), filepath.Base(c.Path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), c.Path)
+}
+
+// Clear removes the cached host, if any.
+func (c *HostCache) Clear() error {
+	if err := os.Remove(c.Path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// dialCachedHost starts connecting to the cached host, if any, before the
+// pool is asked for hosts. It returns the cached host, or nil if there is
+// none.
+func (c *Client) dialCachedHost(ctx context.Context) *store.Node {
+	if c.HostCache == nil {
+		return nil
+	}
+	host, err := c.HostCache.Load()
+	if err != nil {
+		logger.Printf("Failed to load the cached host: %s", err)
+		return nil
+	}
+	if host == nil {
+		return nil
+	}
+	if nodeID, err := enodeID(host.URI); err != nil || string(host.ID) != nodeID {
+		logger.Printf("Dropping malformed cached host: %q", host.URI)
+		c.clearCachedHost()
+		return nil
+	}
+	logger.Printf("Reconnecting to cached host %q while the pool re-validates it...", host.ID)
+	if err := c.EthNode.ConnectPeer(ctx, host.URI); err != nil {
+		logger.Printf("Failed to connect to cached host %q: %s", host.ID, err)
+		c.clearCachedHost()
+		return nil
+	}
+	return host
+}
+
+// revalidateCachedHost returns the hosts from the pool with the cached host
+// first, if the pool returned it. Otherwise, the pool no longer assigns the
+// cached host to the client, so it's disconnected and dropped from the cache.
+func (c *Client) revalidateCachedHost(ctx context.Context, cached *store.Node, hosts []store.Node) []store.Node {
+	if cached == nil {
+		return hosts
+	}
+	r := make([]store.Node, 0, len(hosts))
+	for _, host := range hosts {
+		if host.ID == cached.ID {
+			r = append([]store.Node{host}, r...)
+		} else {
+			r = append(r, host)
+		}
+	}
+	if len(r) > 0 && r[0].ID == cached.ID {
+		return r
+	}
+	c.dropCachedHost(ctx, cached)
+	return hosts
+}
+
+// dropCachedHost disconnects from the cached host, which the pool didn't
+// re-validate, and clears the cache.
+func (c *Client) dropCachedHost(ctx context.Context, cached *store.Node) {
+	if cached == nil {
+		return
+	}
+	logger.Printf("Pool did not re-validate cached host %q, disconnecting.", cached.ID)
+	if err := c.EthNode.DisconnectPeer(ctx, cached.URI); err != nil {
+		logger.Printf("Failed to disconnect from cached host %q: %s", cached.ID, err)
+	}
+	c.clearCachedHost()
+}
+
+// saveHost caches host to reconnect to it first after a restart. Hosts
+// without an ID, such as from a static pool, are not cached since the pool
+// can't re-validate them.
+func (c *Client) saveHost(host store.Node) {
+	if c.HostCache == nil || host.ID == "" {
+		return
+	}
+	if err := c.HostCache.Save(host); err != nil {
+		logger.Printf("Failed to cache host %q: %s", host.ID, err)
+	}
+}
+
+func (c *Client) clearCachedHost() {
+	if err := c.HostCache.Clear(); err != nil {
+		logger.Printf("Failed to clear the cached host: %s", err)
+	}
+}
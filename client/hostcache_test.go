@@ -0,0 +1,137 @@
+package client
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/vipnode/vipnode/internal/fakenode"
+	"github.com/vipnode/vipnode/pool"
+	"github.com/vipnode/vipnode/pool/store"
+)
+
+// assigningPool is a pool.Pool which assigns hosts, and records the pool
+// requests in the calls of node so they're ordered with the node's calls.
+type assigningPool struct {
+	pool.StaticPool
+	node  *fakenode.FakeNode
+	hosts []store.Node
+	reqs  []pool.ClientRequest
+}
+
+func (p *assigningPool) Client(ctx context.Context, req pool.ClientRequest) (*pool.ClientResponse, error) {
+	p.node.Calls = append(p.node.Calls, fakenode.Call("PoolClient"))
+	p.reqs = append(p.reqs, req)
+	return &pool.ClientResponse{Hosts: p.hosts, PoolTime: time.Now()}, nil
+}
+
+func (p *assigningPool) Update(ctx context.Context, req pool.UpdateRequest) (*pool.UpdateResponse, error) {
+	return &pool.UpdateResponse{Balance: &store.Balance{}}, nil
+}
+
+func TestHostCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vipnode-hostcache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	now := time.Now()
+	cache := &HostCache{Path: filepath.Join(dir, "host.json"), TTL: time.Hour, now: func() time.Time { return now }}
+	if host, err := cache.Load(); err != nil || host != nil {
+		t.Fatalf("expected no host in a missing cache, got: %v, %v", host, err)
+	}
+	if err := cache.Save(hostA); err != nil {
+		t.Fatal(err)
+	}
+	if host, err := cache.Load(); err != nil || host == nil || !reflect.DeepEqual(*host, hostA) {
+		t.Errorf("got cached host %v, err %v; want %v", host, err, hostA)
+	}
+
+	now = now.Add(2 * time.Hour)
+	if host, err := cache.Load(); err != nil || host != nil {
+		t.Errorf("expected expired host to be skipped, got: %v, %v", host, err)
+	}
+
+	if err := cache.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.Clear(); err != nil {
+		t.Errorf("clearing a missing cache failed: %s", err)
+	}
+}
+
+func TestClientCachedHost(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vipnode-hostcache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cache := &HostCache{Path: filepath.Join(dir, "host.json")}
+
+	start := func(hosts ...store.Node) (*fakenode.FakeNode, *assigningPool) {
+		node := fakenode.Node("1234")
+		c := New(node)
+		c.HostCache = cache
+		p := &assigningPool{node: node, hosts: hosts}
+		if err := c.Start(p); err != nil {
+			t.Fatal(err)
+		}
+		c.Stop()
+		if err := c.Wait(); err != nil {
+			t.Fatal(err)
+		}
+		return node, p
+	}
+	cached := func() store.NodeID {
+		host, err := cache.Load()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if host == nil {
+			return ""
+		}
+		return host.ID
+	}
+
+	// Nothing cached yet, the first host from the pool is saved.
+	node, p := start(hostA, hostB)
+	if len(p.reqs[0].PreferHosts) != 0 {
+		t.Errorf("unexpected preferred hosts: %v", p.reqs[0].PreferHosts)
+	}
+	if got := cached(); got != hostA.ID {
+		t.Errorf("got cached host %q; want %q", got, hostA.ID)
+	}
+
+	// The cached host is dialed before asking the pool, which re-validates
+	// it.
+	node, p = start(hostB, hostA)
+	if want := []string{string(hostA.ID)}; !reflect.DeepEqual(p.reqs[0].PreferHosts, want) {
+		t.Errorf("got preferred hosts %v; want %v", p.reqs[0].PreferHosts, want)
+	}
+	if len(node.Calls) < 2 || !reflect.DeepEqual(node.Calls[:2], fakenode.Calls{fakenode.Call("ConnectPeer", hostA.URI), fakenode.Call("PoolClient")}) {
+		t.Errorf("expected the cached host to be dialed before the pool request, got: %v", node.Calls)
+	}
+	if got := cached(); got != hostA.ID {
+		t.Errorf("got cached host %q; want %q", got, hostA.ID)
+	}
+
+	// The pool no longer returns the cached host, so it's dropped.
+	node, p = start(hostB)
+	want := fakenode.Calls{
+		fakenode.Call("ConnectPeer", hostA.URI),
+		fakenode.Call("PoolClient"),
+		fakenode.Call("DisconnectPeer", hostA.URI),
+		fakenode.Call("ConnectPeer", hostB.URI),
+	}
+	if len(node.Calls) < len(want) || !reflect.DeepEqual(node.Calls[:len(want)], want) {
+		t.Errorf("calls: got %v; want %v", node.Calls, want)
+	}
+	if got := cached(); got != hostB.ID {
+		t.Errorf("got cached host %q; want %q", got, hostB.ID)
+	}
+}
@@ -0,0 +1,100 @@
+package client
+
+import (
+	"context"
+	"time"
+
+	"github.com/vipnode/vipnode/pool"
+	"github.com/vipnode/vipnode/pool/store"
+)
+
+// migrateTimeout is how long a migration can take before it's abandoned,
+// which includes waiting for the new host to show up as a peer.
+var migrateTimeout = 20 * time.Second
+
+// migrateConfirmInterval is how often the local node's peers are checked
+// while waiting for the new host to connect.
+var migrateConfirmInterval = 500 * time.Millisecond
+
+type migration struct {
+	ctx   context.Context
+	req   pool.MigrateRequest
+	errCh chan error
+}
+
+// Migrate handles a vipnode_migrate request from the pool to move from one
+// host to another. It connects to the new host and returns once the local
+// node is peered with it, only then disconnecting from the old host, so that
+// the client is never left without a host.
+func (c *Client) Migrate(ctx context.Context, req pool.MigrateRequest) error {
+	logger.Printf("Received migrate request: %q -> %q", req.FromHostID, req.Host.ID)
+	ctx, cancel := context.WithTimeout(ctx, migrateTimeout)
+	defer cancel()
+
+	// Migrations are applied by the update loop, which owns the list of
+	// connected hosts.
+	m := migration{ctx: ctx, req: req, errCh: make(chan error, 1)}
+	select {
+	case c.migrateCh <- m:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return <-m.errCh
+}
+
+// migrate connects to the new host, waits for it to be a peer, then
+// disconnects from the old host. It returns the updated list of connected
+// hosts.
+func (c *Client) migrate(ctx context.Context, connectedHosts []store.Node, req pool.MigrateRequest) ([]store.Node, error) {
+	if err := c.connectHost(ctx, req.Host); err != nil {
+		return connectedHosts, err
+	}
+	if err := c.waitForPeer(ctx, string(req.Host.ID)); err != nil {
+		// Don't leave a dangling connection attempt to the new host, the
+		// pool will revert its whitelist.
+		if err := c.EthNode.DisconnectPeer(ctx, req.Host.URI); err != nil {
+			logger.Printf("Failed to disconnect from new host %q: %s", req.Host.ID, err)
+		}
+		return connectedHosts, err
+	}
+
+	r := make([]store.Node, 0, len(connectedHosts)+1)
+	for _, node := range connectedHosts {
+		if node.ID == req.Host.ID {
+			continue
+		}
+		if node.ID != req.FromHostID {
+			r = append(r, node)
+			continue
+		}
+		if err := c.EthNode.DisconnectPeer(ctx, node.URI); err != nil {
+			logger.Printf("Failed to disconnect from old host %q: %s", node.ID, err)
+		}
+	}
+	r = append(r, req.Host)
+	logger.Printf("Migrated from host %q to %q", req.FromHostID, req.Host.ID)
+	return r, nil
+}
+
+// waitForPeer blocks until the local node is connected to nodeID, or the
+// context is done.
+func (c *Client) waitForPeer(ctx context.Context, nodeID string) error {
+	ticker := time.NewTicker(migrateConfirmInterval)
+	defer ticker.Stop()
+	for {
+		peers, err := c.EthNode.PeersLite(ctx)
+		if err != nil {
+			return err
+		}
+		for _, peer := range peers {
+			if peer.ID == nodeID {
+				return nil
+			}
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package client
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/vipnode/vipnode/pool/store"
+)
+
+// HostSample is a single quality measurement of a connected host.
+type HostSample struct {
+	// Latency is the round trip time to the host.
+	Latency time.Duration
+	// BlockNumber is the latest block of the host, or 0 if unknown.
+	BlockNumber uint64
+}
+
+// HostProber measures the quality of a connected host.
+type HostProber func(ctx context.Context, host store.Node) (HostSample, error)
+
+// DialProbe returns a HostProber which measures latency as the time to open
+// a TCP connection to the host's enode address.
+func DialProbe(timeout time.Duration) HostProber {
+	return func(ctx context.Context, host store.Node) (HostSample, error) {
+		uri, err := url.Parse(host.URI)
+		if err != nil {
+			return HostSample{}, err
+		}
+		dialer := net.Dialer{Timeout: timeout}
+		start := time.Now()
+		conn, err := dialer.DialContext(ctx, "tcp", uri.Host)
+		if err != nil {
+			return HostSample{}, err
+		}
+		latency := time.Since(start)
+		conn.Close()
+		return HostSample{Latency: latency, BlockNumber: host.BlockNumber}, nil
+	}
+}
+
+// QualityMonitor keeps track of connected host quality, to determine when a
+// host should be replaced.
+type QualityMonitor struct {
+	// Probe measures each connected host on every update.
+	Probe HostProber
+
+	// MaxLatency is the highest acceptable host latency. (0 to ignore)
+	MaxLatency time.Duration
+
+	// MaxBlockLag is the number of blocks a host can be behind the best
+	// known block before it's considered stale. (0 to ignore)
+	MaxBlockLag uint64
+
+	// Sustain is the number of consecutive bad samples before a host is
+	// considered degraded. Defaults to 1.
+	Sustain int
+
+	bad map[store.NodeID]int
+}
+
+// isBad returns true if the sample fails the quality thresholds.
+func (m *QualityMonitor) isBad(sample HostSample, bestBlock uint64) bool {
+	if m.MaxLatency > 0 && sample.Latency > m.MaxLatency {
+		return true
+	}
+	if m.MaxBlockLag > 0 && sample.BlockNumber > 0 && sample.BlockNumber+m.MaxBlockLag < bestBlock {
+		return true
+	}
+	return false
+}
+
+// Degraded probes hosts and returns the ones which have been below the
+// quality thresholds for Sustain consecutive checks, including failed probes.
+// bestBlock is the best known block, such as from the local node, which is
+// raised to the highest block reported by a host. It is not goroutine-safe.
+func (m *QualityMonitor) Degraded(ctx context.Context, hosts []store.Node, bestBlock uint64) []store.Node {
+	if m.bad == nil {
+		m.bad = map[store.NodeID]int{}
+	}
+	sustain := m.Sustain
+	if sustain < 1 {
+		sustain = 1
+	}
+
+	samples := make([]HostSample, len(hosts))
+	failed := make([]bool, len(hosts))
+	for i, host := range hosts {
+		sample, err := m.Probe(ctx, host)
+		if err != nil {
+			logger.Printf("Failed to probe host %q: %s", host.ID, err)
+			failed[i] = true
+			continue
+		}
+		samples[i] = sample
+		if sample.BlockNumber > bestBlock {
+			bestBlock = sample.BlockNumber
+		}
+	}
+
+	seen := make(map[store.NodeID]struct{}, len(hosts))
+	degraded := []store.Node{}
+	for i, host := range hosts {
+		seen[host.ID] = struct{}{}
+		if !failed[i] && !m.isBad(samples[i], bestBlock) {
+			delete(m.bad, host.ID)
+			continue
+		}
+		m.bad[host.ID] += 1
+		if m.bad[host.ID] >= sustain {
+			degraded = append(degraded, host)
+		}
+	}
+	// Forget hosts that are no longer connected
+	for nodeID := range m.bad {
+		if _, ok := seen[nodeID]; !ok {
+			delete(m.bad, nodeID)
+		}
+	}
+	return degraded
+}
@@ -0,0 +1,129 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/vipnode/vipnode/internal/fakenode"
+	"github.com/vipnode/vipnode/pool"
+	"github.com/vipnode/vipnode/pool/store"
+)
+
+var (
+	hostA = store.Node{ID: "aaaa", URI: "enode://aaaa@127.0.0.1:30303"}
+	hostB = store.Node{ID: "bbbb", URI: "enode://bbbb@127.0.0.2:30303"}
+)
+
+// fakeProbe returns samples from a map, or an error for missing hosts.
+func fakeProbe(samples map[store.NodeID]HostSample) HostProber {
+	return func(ctx context.Context, host store.Node) (HostSample, error) {
+		sample, ok := samples[host.ID]
+		if !ok {
+			return sample, errors.New("unreachable")
+		}
+		return sample, nil
+	}
+}
+
+func nodeIDs(nodes []store.Node) []store.NodeID {
+	r := []store.NodeID{}
+	for _, n := range nodes {
+		r = append(r, n.ID)
+	}
+	return r
+}
+
+func TestQualityMonitor(t *testing.T) {
+	samples := map[store.NodeID]HostSample{
+		hostA.ID: {Latency: 10 * time.Millisecond, BlockNumber: 100},
+		hostB.ID: {Latency: 10 * time.Millisecond, BlockNumber: 100},
+	}
+	m := QualityMonitor{
+		Probe:       fakeProbe(samples),
+		MaxLatency:  time.Second,
+		MaxBlockLag: 5,
+		Sustain:     2,
+	}
+	hosts := []store.Node{hostA, hostB}
+	check := func(want ...store.NodeID) {
+		t.Helper()
+		if want == nil {
+			want = []store.NodeID{}
+		}
+		if got := nodeIDs(m.Degraded(context.Background(), hosts, 0)); !reflect.DeepEqual(got, want) {
+			t.Errorf("degraded: got %v; want %v", got, want)
+		}
+	}
+
+	check()
+
+	// Slow host must be sustained before it's degraded
+	samples[hostA.ID] = HostSample{Latency: 2 * time.Second, BlockNumber: 100}
+	check()
+	check(hostA.ID)
+
+	// Recovery resets the count
+	samples[hostA.ID] = HostSample{Latency: 10 * time.Millisecond, BlockNumber: 100}
+	check()
+	samples[hostA.ID] = HostSample{Latency: 2 * time.Second, BlockNumber: 100}
+	check()
+
+	// Stale host, behind the other host by more than MaxBlockLag
+	samples[hostA.ID] = HostSample{Latency: 10 * time.Millisecond, BlockNumber: 100}
+	samples[hostB.ID] = HostSample{Latency: 10 * time.Millisecond, BlockNumber: 90}
+	check()
+	check(hostB.ID)
+
+	// Failed probes count as bad samples
+	delete(samples, hostB.ID)
+	check(hostB.ID)
+}
+
+func TestClientSwitchHost(t *testing.T) {
+	node := fakenode.Node("1234")
+	c := New(node)
+	c.Quality = &QualityMonitor{
+		Probe: fakeProbe(map[store.NodeID]HostSample{
+			hostA.ID: {Latency: 2 * time.Second},
+			hostB.ID: {Latency: 10 * time.Millisecond},
+		}),
+		MaxLatency: time.Second,
+	}
+
+	// No replacements available, keep the degraded host
+	p := &pool.StaticPool{Nodes: []store.Node{hostA}}
+	connected := c.checkHosts(context.Background(), p, []store.Node{hostA})
+	if got, want := nodeIDs(connected), nodeIDs([]store.Node{hostA}); !reflect.DeepEqual(got, want) {
+		t.Errorf("connected: got %v; want %v", got, want)
+	}
+	if len(node.Calls) != 0 {
+		t.Errorf("unexpected calls: %v", node.Calls)
+	}
+
+	p.Nodes = []store.Node{hostA, hostB}
+	connected = c.checkHosts(context.Background(), p, []store.Node{hostA})
+	if got, want := nodeIDs(connected), nodeIDs([]store.Node{hostB}); !reflect.DeepEqual(got, want) {
+		t.Errorf("connected: got %v; want %v", got, want)
+	}
+	// The degraded host is only disconnected after connecting to the new one.
+	want := fakenode.Calls{
+		fakenode.Call("ConnectPeer", hostB.URI),
+		fakenode.Call("DisconnectPeer", hostA.URI),
+	}
+	if !reflect.DeepEqual(node.Calls, want) {
+		t.Errorf("calls: got %v; want %v", node.Calls, want)
+	}
+
+	// Healthy hosts are left alone
+	node.Calls = fakenode.Calls{}
+	connected = c.checkHosts(context.Background(), p, connected)
+	if got, want := nodeIDs(connected), nodeIDs([]store.Node{hostB}); !reflect.DeepEqual(got, want) {
+		t.Errorf("connected: got %v; want %v", got, want)
+	}
+	if len(node.Calls) != 0 {
+		t.Errorf("unexpected calls: %v", node.Calls)
+	}
+}
@@ -0,0 +1,137 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/vipnode/vipnode/ethnode"
+	"github.com/vipnode/vipnode/pool/store"
+)
+
+// connectTimeout is how long to wait for a host to show up in our peers
+// after connecting.
+var connectTimeout = 30 * time.Second
+
+// connectPollInterval is how often peers are checked while waiting for a
+// host to connect.
+var connectPollInterval = time.Second
+
+// HostMismatchError is returned when a host we connected to could not be
+// verified to control the node ID advertised by the pool.
+type HostMismatchError struct {
+	Host   store.Node
+	Reason string
+}
+
+func (err HostMismatchError) Error() string {
+	return fmt.Sprintf("host %q failed verification: %s", err.Host.URI, err.Reason)
+}
+
+// NetworkMismatchError is returned when a host advertised by the pool is on a
+// different network than the local node.
+type NetworkMismatchError struct {
+	Host   store.Node
+	Local  ethnode.NetworkID
+	Remote ethnode.NetworkID
+}
+
+func (err NetworkMismatchError) Error() string {
+	return fmt.Sprintf("host %q is on network %d, local node is on network %d", err.Host.URI, err.Remote, err.Local)
+}
+
+// checkNetwork returns a NetworkMismatchError if host is known to be on a
+// different network than the local node.
+func (c *Client) checkNetwork(host store.Node) error {
+	local, remote := c.EthNode.Network(), ethnode.NetworkID(host.Network)
+	if local == 0 || remote == 0 || local == remote {
+		return nil
+	}
+	return NetworkMismatchError{host, local, remote}
+}
+
+// enodeID returns the node ID component of an enode:// URI.
+func enodeID(nodeURI string) (string, error) {
+	uri, err := url.Parse(nodeURI)
+	if err != nil {
+		return "", err
+	}
+	if uri.Scheme != "enode" || uri.User == nil {
+		return "", fmt.Errorf("not an enode URI: %q", nodeURI)
+	}
+	return uri.User.Username(), nil
+}
+
+// connectHost connects to host and verifies that the connected peer is the
+// advertised node, disconnecting if it isn't. Hosts without an advertised ID,
+// such as from a static pool, are verified against their enode URI.
+func (c *Client) connectHost(ctx context.Context, host store.Node) error {
+	nodeID, err := enodeID(host.URI)
+	if err != nil {
+		return HostMismatchError{host, err.Error()}
+	}
+	if host.ID != "" && string(host.ID) != nodeID {
+		return HostMismatchError{host, fmt.Sprintf("enode does not match the advertised node ID %q", host.ID)}
+	}
+	if c.CheckNetwork {
+		if err := c.checkNetwork(host); err != nil {
+			return err
+		}
+	}
+	if err := c.EthNode.ConnectPeer(ctx, host.URI); err != nil {
+		return err
+	}
+
+	if err := c.verifyHost(ctx, host, nodeID); err != nil {
+		if disconnectErr := c.EthNode.DisconnectPeer(ctx, host.URI); disconnectErr != nil {
+			logger.Printf("Failed to disconnect from unverified host %q: %s", host.URI, disconnectErr)
+		}
+		return err
+	}
+	return nil
+}
+
+func (c *Client) hasPeer(ctx context.Context, nodeID string) (bool, error) {
+	return hasPeer(ctx, c.EthNode, nodeID)
+}
+
+// hasPeer returns whether nodeID is connected to node.
+func hasPeer(ctx context.Context, node ethnode.EthNode, nodeID string) (bool, error) {
+	peers, err := node.Peers(ctx)
+	if err != nil {
+		return false, err
+	}
+	for _, peer := range peers {
+		if peer.ID == nodeID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// verifyHost waits until nodeID shows up in our peers, which means it
+// completed the encrypted handshake with the node key. Failing to check our
+// peers is also reported as a HostMismatchError, so that callers can move on
+// to the next host.
+func (c *Client) verifyHost(ctx context.Context, host store.Node, nodeID string) error {
+	waitCtx, cancel := context.WithTimeout(ctx, connectTimeout)
+	defer cancel()
+	for {
+		connected, err := c.hasPeer(waitCtx, nodeID)
+		if err != nil && waitCtx.Err() != nil {
+			return HostMismatchError{host, "peer with the advertised node ID did not connect"}
+		}
+		if err != nil {
+			return HostMismatchError{host, fmt.Sprintf("failed to check peers: %s", err)}
+		}
+		if connected {
+			return nil
+		}
+		select {
+		case <-time.After(connectPollInterval):
+		case <-waitCtx.Done():
+			return HostMismatchError{host, "peer with the advertised node ID did not connect"}
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package client
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p/discv5"
+	"github.com/vipnode/vipnode/ethnode"
+	"github.com/vipnode/vipnode/internal/fakenode"
+	"github.com/vipnode/vipnode/pool"
+	"github.com/vipnode/vipnode/pool/store"
+)
+
+// impostorNode connects to any enode, but the peer that shows up has a
+// different node ID.
+type impostorNode struct {
+	*fakenode.FakeNode
+}
+
+func (n *impostorNode) Peers(ctx context.Context) ([]ethnode.PeerInfo, error) {
+	return []ethnode.PeerInfo{{ID: "impostor"}}, nil
+}
+
+// peersErrNode fails to list its peers, until ctx is done if block is set.
+type peersErrNode struct {
+	*fakenode.FakeNode
+	block bool
+}
+
+func (n *peersErrNode) Peers(ctx context.Context) ([]ethnode.PeerInfo, error) {
+	if n.block {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return nil, errors.New("peers unavailable")
+}
+
+func keyHost(key *ecdsa.PrivateKey) store.Node {
+	nodeID := discv5.PubkeyID(&key.PublicKey).String()
+	return store.Node{ID: store.NodeID(nodeID), URI: fmt.Sprintf("enode://%s@127.0.0.1:30303", nodeID)}
+}
+
+func TestConnectHost(t *testing.T) {
+	node := fakenode.Node("1234")
+	c := New(node)
+	if err := c.connectHost(context.Background(), hostA); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if want := (fakenode.Calls{fakenode.Call("ConnectPeer", hostA.URI)}); !reflect.DeepEqual(node.Calls, want) {
+		t.Errorf("calls: got %v; want %v", node.Calls, want)
+	}
+
+	// Hosts from a StaticPool are only known by URI
+	if err := c.connectHost(context.Background(), store.Node{URI: hostB.URI}); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	// Advertised ID doesn't match the enode, so we don't even connect.
+	node.Calls = fakenode.Calls{}
+	err := c.connectHost(context.Background(), store.Node{ID: hostB.ID, URI: hostA.URI})
+	if _, ok := err.(HostMismatchError); !ok {
+		t.Errorf("expected HostMismatchError, got: %v", err)
+	}
+	if len(node.Calls) != 0 {
+		t.Errorf("unexpected calls: %v", node.Calls)
+	}
+}
+
+func TestConnectHostImpostor(t *testing.T) {
+	defer func(timeout, interval time.Duration) {
+		connectTimeout, connectPollInterval = timeout, interval
+	}(connectTimeout, connectPollInterval)
+	connectTimeout, connectPollInterval = 20*time.Millisecond, time.Millisecond
+
+	node := &impostorNode{fakenode.Node("1234")}
+	c := New(node)
+	err := c.connectHost(context.Background(), hostA)
+	if _, ok := err.(HostMismatchError); !ok {
+		t.Errorf("expected HostMismatchError, got: %v", err)
+	}
+	want := fakenode.Calls{
+		fakenode.Call("ConnectPeer", hostA.URI),
+		fakenode.Call("DisconnectPeer", hostA.URI),
+	}
+	if !reflect.DeepEqual(node.Calls, want) {
+		t.Errorf("calls: got %v; want %v", node.Calls, want)
+	}
+}
+
+func TestConnectHostPeersError(t *testing.T) {
+	defer func(timeout, interval time.Duration) {
+		connectTimeout, connectPollInterval = timeout, interval
+	}(connectTimeout, connectPollInterval)
+	connectTimeout, connectPollInterval = 20*time.Millisecond, time.Millisecond
+
+	for _, block := range []bool{false, true} {
+		node := &peersErrNode{FakeNode: fakenode.Node("1234"), block: block}
+		c := New(node)
+		err := c.connectHost(context.Background(), hostA)
+		if _, ok := err.(HostMismatchError); !ok {
+			t.Errorf("block=%t: expected HostMismatchError, got: %v", block, err)
+		}
+		want := fakenode.Calls{
+			fakenode.Call("ConnectPeer", hostA.URI),
+			fakenode.Call("DisconnectPeer", hostA.URI),
+		}
+		if !reflect.DeepEqual(node.Calls, want) {
+			t.Errorf("block=%t: calls: got %v; want %v", block, node.Calls, want)
+		}
+	}
+}
+
+func TestStartMismatch(t *testing.T) {
+	node := fakenode.Node("1234")
+	c := New(node)
+
+	p := &pool.StaticPool{Nodes: []store.Node{{ID: hostB.ID, URI: hostA.URI}}}
+	if _, ok := c.Start(p).(HostMismatchError); !ok {
+		t.Errorf("expected HostMismatchError when no hosts are verified")
+	}
+	if len(node.Calls) != 0 {
+		t.Errorf("unexpected calls: %v", node.Calls)
+	}
+}
+
+func TestConnectHostNetwork(t *testing.T) {
+	node := fakenode.Node("1234")
+	node.NodeNetwork = ethnode.Rinkeby
+	c := New(node)
+	c.CheckNetwork = true
+
+	// Matching and unknown networks connect
+	for _, network := range []ethnode.NetworkID{ethnode.Rinkeby, 0} {
+		host := hostA
+		host.Network = int(network)
+		if err := c.connectHost(context.Background(), host); err != nil {
+			t.Errorf("network %d: unexpected error: %s", network, err)
+		}
+	}
+
+	// Mismatched network fails before dialing
+	node.Calls = fakenode.Calls{}
+	host := hostA
+	host.Network = int(ethnode.Mainnet)
+	err := c.connectHost(context.Background(), host)
+	if err, ok := err.(NetworkMismatchError); !ok {
+		t.Errorf("expected NetworkMismatchError, got: %v", err)
+	} else if err.Local != ethnode.Rinkeby || err.Remote != ethnode.Mainnet {
+		t.Errorf("wrong networks: %+v", err)
+	}
+	if len(node.Calls) != 0 {
+		t.Errorf("unexpected calls: %v", node.Calls)
+	}
+
+	// Check is optional
+	c.CheckNetwork = false
+	if err := c.connectHost(context.Background(), host); err != nil {
+		t.Errorf("unexpected error with check disabled: %s", err)
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/vipnode/vipnode/ethnode"
+	"github.com/vipnode/vipnode/host"
+	"github.com/vipnode/vipnode/jsonrpc2"
+	"github.com/vipnode/vipnode/jsonrpc2/tcp"
+)
+
+// controlTimeout bounds runtime commands, which can involve several calls
+// to the node and the pool.
+var controlTimeout = 30 * time.Second
+
+// HostControl serves runtime commands to a running host agent. It must be
+// exported to be registered with jsonrpc2.
+type HostControl struct {
+	hosts []*host.Host
+}
+
+// ReduceCapacity reduces the capacity of each of the hosts sharing the node
+// by n slots, returning the drained clients.
+func (c *HostControl) ReduceCapacity(ctx context.Context, n int) ([]string, error) {
+	if n < 0 {
+		return nil, errors.New("capacity can't be reduced by a negative number of slots")
+	}
+	drained := []string{}
+	for _, h := range c.hosts {
+		nodeIDs, err := h.ReduceCapacity(ctx, n)
+		drained = append(drained, nodeIDs...)
+		if err != nil {
+			return drained, err
+		}
+	}
+	return drained, nil
+}
+
+// Status returns the health of the host. Hosts sharing the node see the same
+// peers, so it's taken from the first one.
+func (c *HostControl) Status(ctx context.Context) (host.Status, error) {
+	status := c.hosts[0].Status()
+	uptime, err := c.hosts[0].NodeUptime(ctx)
+	if err != nil && err != ethnode.ErrNotSupported {
+		return status, err
+	}
+	status.NodeUptime = uptime
+	return status, nil
+}
+
+// serveControl accepts runtime commands for the hosts on a unix socket at
+// path, until the returned listener is closed.
+func serveControl(path string, hosts []*host.Host) (io.Closer, error) {
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	rpcServer := &jsonrpc2.Server{}
+	control := &HostControl{hosts}
+	if err := rpcServer.RegisterMethod("vipnode_reduceCapacity", control, "ReduceCapacity"); err != nil {
+		l.Close()
+		return nil, err
+	}
+	if err := rpcServer.RegisterMethod("vipnode_status", control, "Status"); err != nil {
+		l.Close()
+		return nil, err
+	}
+	listener := &tcp.Listener{Listener: l}
+	go func() {
+		for {
+			codec, err := listener.AcceptCodec()
+			if err != nil {
+				return
+			}
+			remote := &jsonrpc2.Remote{
+				Client: &jsonrpc2.Client{},
+				Server: rpcServer,
+				Codec:  codec,
+			}
+			go func() {
+				remote.Serve()
+				remote.Close()
+			}()
+		}
+	}()
+	return listener, nil
+}
+
+// dialControl connects to the --control socket of a running host.
+func dialControl(path string) (*jsonrpc2.Remote, error) {
+	conn, err := net.DialTimeout("unix", path, rpcTimeout)
+	if err != nil {
+		return nil, ErrExplain{err, "Failed to connect to the host agent. Make sure it's running with a matching --control path."}
+	}
+	remote := &jsonrpc2.Remote{
+		Client: &jsonrpc2.Client{},
+		Server: &jsonrpc2.Server{},
+		Codec:  tcp.NewCodec(conn),
+	}
+	go remote.Serve()
+	return remote, nil
+}
+
+func runReduce(options Options, w io.Writer) error {
+	remote, err := dialControl(options.Reduce.Control)
+	if err != nil {
+		return err
+	}
+	defer remote.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), controlTimeout)
+	defer cancel()
+	var drained []string
+	if err := remote.Call(ctx, &drained, "vipnode_reduceCapacity", options.Reduce.Args.Slots); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "Reduced capacity by %d slots, drained %d clients.\n", options.Reduce.Args.Slots, len(drained))
+	for _, nodeID := range drained {
+		fmt.Fprintf(w, "  %s\n", nodeID)
+	}
+	return nil
+}
+
+func runStatus(options Options, w io.Writer) error {
+	remote, err := dialControl(options.Status.Control)
+	if err != nil {
+		return err
+	}
+	defer remote.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+	defer cancel()
+	var status host.Status
+	if err := remote.Call(ctx, &status, "vipnode_status"); err != nil {
+		return err
+	}
+	health := "ok"
+	if status.Healing {
+		health = "not ready, node is healing its state"
+	} else if status.Overloaded {
+		health = "overloaded, transaction pool is above the threshold"
+	} else if status.Degraded {
+		health = "degraded"
+	}
+	fmt.Fprintf(w, "Health: %s\n", health)
+	fmt.Fprintf(w, "Peer churn: %.1f per minute\n", status.ChurnRate)
+	fmt.Fprintf(w, "Agent uptime: %s\n", status.Uptime.Truncate(time.Second))
+	if status.NodeUptime > 0 {
+		fmt.Fprintf(w, "Node uptime: %s\n", status.NodeUptime.Truncate(time.Second))
+	} else {
+		fmt.Fprintf(w, "Node uptime: unknown\n")
+	}
+	return nil
+}
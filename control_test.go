@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vipnode/vipnode/ethnode"
+	"github.com/vipnode/vipnode/host"
+	"github.com/vipnode/vipnode/internal/fakenode"
+	"github.com/vipnode/vipnode/pool"
+	"github.com/vipnode/vipnode/pool/store"
+)
+
+// balancePool is a pool.StaticPool which accepts host updates.
+type balancePool struct {
+	pool.StaticPool
+}
+
+func (p *balancePool) Update(ctx context.Context, req pool.UpdateRequest) (*pool.UpdateResponse, error) {
+	return &pool.UpdateResponse{Balance: &store.Balance{}}, nil
+}
+
+func TestReduceControl(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vipnode-control")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	node := fakenode.Node("host")
+	node.FakePeers = []ethnode.PeerInfo{{ID: "client"}, {ID: "organic"}}
+	h := host.New(node, "")
+	h.MaxPeers = 2
+	if err := h.Start(&balancePool{}); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		h.Stop()
+		h.Wait()
+	}()
+	if err := h.Whitelist(context.Background(), "client"); err != nil {
+		t.Fatal(err)
+	}
+
+	var options Options
+	options.Reduce.Control = filepath.Join(dir, "control.sock")
+	options.Reduce.Args.Slots = 1
+	control, err := serveControl(options.Reduce.Control, []*host.Host{h})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer control.Close()
+
+	var buf bytes.Buffer
+	if err := runReduce(options, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf.String(), "Reduced capacity by 1 slots, drained 1 clients.\n  client\n"; got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	options.Reduce.Args.Slots = -1
+	if err := runReduce(options, &buf); err == nil {
+		t.Error("expected error when reducing by a negative number of slots")
+	}
+}
+
+func TestStatusControl(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vipnode-control")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	node := fakenode.Node("host")
+	node.FakeUptime = 90 * time.Minute
+	h := host.New(node, "")
+	h.Churn.Threshold = 1
+	for i := 0; i < 20; i++ {
+		h.Churn.Add(host.PeerEvent{Type: host.PeerAdded, PeerID: "peer", Time: time.Now()})
+	}
+	var options Options
+	options.Status.Control = filepath.Join(dir, "control.sock")
+	control, err := serveControl(options.Status.Control, []*host.Host{h})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer control.Close()
+
+	var buf bytes.Buffer
+	if err := runStatus(options, &buf); err != nil {
+		t.Fatal(err)
+	}
+	// The agent's uptime depends on how long the tests have been running.
+	got := buf.String()
+	if want := "Health: degraded\nPeer churn: 2.0 per minute\nAgent uptime: "; !strings.HasPrefix(got, want) {
+		t.Errorf("got:\n%s\nwant prefix:\n%s", got, want)
+	}
+	if want := "\nNode uptime: 1h30m0s\n"; !strings.HasSuffix(got, want) {
+		t.Errorf("got:\n%s\nwant suffix:\n%s", got, want)
+	}
+}
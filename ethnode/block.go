@@ -0,0 +1,172 @@
+package ethnode
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// parseBlockHash parses the hash out of a JSON eth_getBlockByNumber result.
+func parseBlockHash(raw json.RawMessage) (common.Hash, error) {
+	var header *struct {
+		Hash *common.Hash `json:"hash"`
+	}
+	if err := json.Unmarshal(raw, &header); err != nil {
+		return common.Hash{}, err
+	}
+	if header == nil {
+		return common.Hash{}, errors.New("block not found")
+	}
+	if header.Hash == nil {
+		return common.Hash{}, errors.New("block is missing its hash")
+	}
+	return *header.Hash, nil
+}
+
+// genesisHash is the GenesisHash implementation shared by node kinds.
+func genesisHash(ctx context.Context, client *rpc.Client) (common.Hash, error) {
+	var raw json.RawMessage
+	if err := call(ctx, client, &raw, "eth_getBlockByNumber", "0x0", false); err != nil {
+		return common.Hash{}, err
+	}
+	return parseBlockHash(raw)
+}
+
+// blockHeader is the subset of an eth_getBlockByNumber result that we use.
+type blockHeader struct {
+	Number    string `json:"number"`
+	Timestamp string `json:"timestamp"`
+}
+
+// parseBlockHeader parses the number and timestamp out of a JSON
+// eth_getBlockByNumber result.
+func parseBlockHeader(raw json.RawMessage) (number uint64, timestamp time.Time, err error) {
+	var header *blockHeader
+	if err := json.Unmarshal(raw, &header); err != nil {
+		return 0, time.Time{}, err
+	}
+	if header == nil {
+		return 0, time.Time{}, errors.New("block not found")
+	}
+	if number, err = strconv.ParseUint(header.Number, 0, 64); err != nil {
+		return 0, time.Time{}, err
+	}
+	seconds, err := strconv.ParseInt(header.Timestamp, 0, 64)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	return number, time.Unix(seconds, 0), nil
+}
+
+// latestBlock is the LatestBlock implementation shared by node kinds, since
+// eth_getBlockByNumber is standard.
+func latestBlock(ctx context.Context, client *rpc.Client) (uint64, time.Time, error) {
+	var raw json.RawMessage
+	if err := call(ctx, client, &raw, "eth_getBlockByNumber", "latest", false); err != nil {
+		return 0, time.Time{}, err
+	}
+	return parseBlockHeader(raw)
+}
+
+// HeadInfo describes the head block of a node's chain.
+type HeadInfo struct {
+	Number    uint64
+	Hash      common.Hash
+	Timestamp time.Time
+	// TotalDifficulty is the chain's total difficulty up to and including
+	// the head block. It's nil if the node omits it, as post-merge nodes may
+	// since difficulty no longer determines the canonical chain.
+	TotalDifficulty *big.Int
+}
+
+// parseHeadInfo parses a HeadInfo out of a JSON eth_getBlockByNumber result.
+func parseHeadInfo(raw json.RawMessage) (*HeadInfo, error) {
+	number, timestamp, err := parseBlockHeader(raw)
+	if err != nil {
+		return nil, err
+	}
+	hash, err := parseBlockHash(raw)
+	if err != nil {
+		return nil, err
+	}
+	var header struct {
+		TotalDifficulty *hexutil.Big `json:"totalDifficulty"`
+	}
+	if err := json.Unmarshal(raw, &header); err != nil {
+		return nil, err
+	}
+	return &HeadInfo{
+		Number:          number,
+		Hash:            hash,
+		Timestamp:       timestamp,
+		TotalDifficulty: (*big.Int)(header.TotalDifficulty),
+	}, nil
+}
+
+// chainHead is the ChainHead implementation shared by node kinds.
+func chainHead(ctx context.Context, client *rpc.Client) (*HeadInfo, error) {
+	var raw json.RawMessage
+	if err := call(ctx, client, &raw, "eth_getBlockByNumber", "latest", false); err != nil {
+		return nil, err
+	}
+	return parseHeadInfo(raw)
+}
+
+// gasLimitCacheDuration is how long a block gas limit is reused for. Miners
+// only move the limit by a small fraction each block.
+var gasLimitCacheDuration = 30 * time.Second
+
+// parseGasLimit parses the gas limit out of a JSON eth_getBlockByNumber
+// result.
+func parseGasLimit(raw json.RawMessage) (uint64, error) {
+	var header *struct {
+		GasLimit *string `json:"gasLimit"`
+	}
+	if err := json.Unmarshal(raw, &header); err != nil {
+		return 0, err
+	}
+	if header == nil {
+		return 0, errors.New("block not found")
+	}
+	if header.GasLimit == nil {
+		return 0, errors.New("block is missing its gas limit")
+	}
+	return strconv.ParseUint(*header.GasLimit, 0, 64)
+}
+
+// gasLimitCache remembers the latest block gas limit for
+// gasLimitCacheDuration.
+type gasLimitCache struct {
+	mu      sync.Mutex
+	limit   uint64
+	expires time.Time
+}
+
+// get returns the cached gas limit, or reads it from the latest block once
+// the cache expires. Failed reads are not cached.
+func (c *gasLimitCache) get(ctx context.Context, client *rpc.Client) (uint64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if time.Now().Before(c.expires) {
+		return c.limit, nil
+	}
+	var raw json.RawMessage
+	if err := call(ctx, client, &raw, "eth_getBlockByNumber", "latest", false); err != nil {
+		return 0, err
+	}
+	limit, err := parseGasLimit(raw)
+	if err != nil {
+		return 0, err
+	}
+	c.limit = limit
+	c.expires = time.Now().Add(gasLimitCacheDuration)
+	return limit, nil
+}
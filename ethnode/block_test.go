@@ -0,0 +1,236 @@
+package ethnode
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestParseBlockHeader(t *testing.T) {
+	raw := json.RawMessage(`{
+		"difficulty": "0x7a1200",
+		"hash": "0x1b4c2a2ba2d9d7b0a1f5c9e5a0e8b3cb0e3d3e0b6a6c2d9b6e2b4a6c1d1e3f01",
+		"number": "0x6acfc0",
+		"parentHash": "0x9f3a1e1c1a5e0b2a8b7c6d5e4f3a2b1c0d9e8f7a6b5c4d3e2f1a0b9c8d7e6f50",
+		"timestamp": "0x5c4b0e4e",
+		"transactions": []
+	}`)
+	number, timestamp, err := parseBlockHeader(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if number != 7000000 {
+		t.Errorf("wrong number: %d", number)
+	}
+	if want := time.Unix(1548422734, 0); !timestamp.Equal(want) {
+		t.Errorf("wrong timestamp: %s; want %s", timestamp, want)
+	}
+
+	if _, _, err := parseBlockHeader(json.RawMessage(`null`)); err == nil {
+		t.Error("expected error for missing block")
+	}
+	if _, _, err := parseBlockHeader(json.RawMessage(`{"number": "0x1", "timestamp": "soon"}`)); err == nil {
+		t.Error("expected error for invalid timestamp")
+	}
+}
+
+// MockGenesisEth serves a block zero with the Rinkeby genesis hash.
+type MockGenesisEth struct{ MockEth }
+
+func (s *MockGenesisEth) GetBlockByNumber(number string, full bool) map[string]string {
+	if number != "0x0" {
+		return nil
+	}
+	return map[string]string{"number": "0x0", "hash": rinkebyGenesis, "timestamp": "0x58ee40ba"}
+}
+
+func TestParseBlockHash(t *testing.T) {
+	raw := json.RawMessage(`{
+		"difficulty": "0x1",
+		"extraData": "0x52657370656374206d7920617574686f7269746168207e452e436172746d616e",
+		"hash": "0x6341fd3daf94b748c72ced5a5b26028f2474f5f00d824504e4fa37a75767e177",
+		"number": "0x0",
+		"parentHash": "0x0000000000000000000000000000000000000000000000000000000000000000",
+		"timestamp": "0x58ee40ba",
+		"transactions": []
+	}`)
+	hash, err := parseBlockHash(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash != common.HexToHash(rinkebyGenesis) {
+		t.Errorf("wrong hash: %s", hash.Hex())
+	}
+
+	if _, err := parseBlockHash(json.RawMessage(`null`)); err == nil {
+		t.Error("expected error for missing block")
+	}
+	if _, err := parseBlockHash(json.RawMessage(`{"number": "0x0"}`)); err == nil {
+		t.Error("expected error for missing hash")
+	}
+	if _, err := parseBlockHash(json.RawMessage(`{"hash": "0x1234"}`)); err == nil {
+		t.Error("expected error for invalid hash")
+	}
+}
+
+func TestGenesisHash(t *testing.T) {
+	client := serveMocks(t, map[string]interface{}{"eth": &MockGenesisEth{}})
+	defer client.Close()
+	for _, node := range []EthNode{&gethNode{client: client}, &parityNode{client: client}} {
+		hash, err := node.GenesisHash(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hash != common.HexToHash(rinkebyGenesis) {
+			t.Errorf("%s: wrong genesis hash: %s", node.Kind(), hash.Hex())
+		}
+	}
+}
+
+func TestParseGasLimit(t *testing.T) {
+	raw := json.RawMessage(`{
+		"gasLimit": "0x7a121d",
+		"gasUsed": "0x79f26b",
+		"hash": "0x1b4c2a2ba2d9d7b0a1f5c9e5a0e8b3cb0e3d3e0b6a6c2d9b6e2b4a6c1d1e3f01",
+		"number": "0x6acfc0",
+		"timestamp": "0x5c4b0e4e",
+		"transactions": []
+	}`)
+	limit, err := parseGasLimit(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if limit != 8000029 {
+		t.Errorf("wrong gas limit: %d", limit)
+	}
+
+	if _, err := parseGasLimit(json.RawMessage(`null`)); err == nil {
+		t.Error("expected error for missing block")
+	}
+	if _, err := parseGasLimit(json.RawMessage(`{"number": "0x1"}`)); err == nil {
+		t.Error("expected error for missing gas limit")
+	}
+	if _, err := parseGasLimit(json.RawMessage(`{"gasLimit": "lots"}`)); err == nil {
+		t.Error("expected error for invalid gas limit")
+	}
+}
+
+// MockGasLimitEth serves latest blocks with a gas limit, counting the calls.
+type MockGasLimitEth struct {
+	MockEth
+	calls int
+}
+
+func (s *MockGasLimitEth) GetBlockByNumber(number string, full bool) map[string]string {
+	s.calls++
+	return map[string]string{"number": "0x6acfc0", "timestamp": "0x5c4b0e4e", "gasLimit": fmt.Sprintf("0x%x", 8000000+s.calls)}
+}
+
+func TestBlockGasLimit(t *testing.T) {
+	defer func(d time.Duration) { gasLimitCacheDuration = d }(gasLimitCacheDuration)
+	gasLimitCacheDuration = time.Hour
+
+	for _, kind := range []NodeKind{Geth, Parity} {
+		eth := &MockGasLimitEth{}
+		client := serveMocks(t, map[string]interface{}{"eth": eth})
+		var node EthNode = &gethNode{client: client}
+		if kind == Parity {
+			node = &parityNode{client: client}
+		}
+		for i := 0; i < 3; i++ {
+			limit, err := node.BlockGasLimit(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if limit != 8000001 {
+				t.Errorf("%s: wrong gas limit: %d", kind, limit)
+			}
+		}
+		if eth.calls != 1 {
+			t.Errorf("%s: expected the gas limit to be cached, got %d calls", kind, eth.calls)
+		}
+		client.Close()
+	}
+}
+
+func TestParseHeadInfo(t *testing.T) {
+	preMerge := json.RawMessage(`{
+		"difficulty": "0x7a1200",
+		"hash": "0x1b4c2a2ba2d9d7b0a1f5c9e5a0e8b3cb0e3d3e0b6a6c2d9b6e2b4a6c1d1e3f01",
+		"number": "0x6acfc0",
+		"timestamp": "0x5c4b0e4e",
+		"totalDifficulty": "0x1a2b3c4d5e6f7a8b9c",
+		"transactions": []
+	}`)
+	head, err := parseHeadInfo(preMerge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if head.Number != 7000000 {
+		t.Errorf("wrong number: %d", head.Number)
+	}
+	if want := common.HexToHash("0x1b4c2a2ba2d9d7b0a1f5c9e5a0e8b3cb0e3d3e0b6a6c2d9b6e2b4a6c1d1e3f01"); head.Hash != want {
+		t.Errorf("wrong hash: %s", head.Hash.Hex())
+	}
+	if want := time.Unix(1548422734, 0); !head.Timestamp.Equal(want) {
+		t.Errorf("wrong timestamp: %s; want %s", head.Timestamp, want)
+	}
+	if head.TotalDifficulty == nil || fmt.Sprintf("%x", head.TotalDifficulty) != "1a2b3c4d5e6f7a8b9c" {
+		t.Errorf("wrong total difficulty: %v", head.TotalDifficulty)
+	}
+
+	postMerge := json.RawMessage(`{
+		"baseFeePerGas": "0x3b9aca00",
+		"difficulty": "0x0",
+		"hash": "0x6341fd3daf94b748c72ced5a5b26028f2474f5f00d824504e4fa37a75767e177",
+		"mixHash": "0x9f3a1e1c1a5e0b2a8b7c6d5e4f3a2b1c0d9e8f7a6b5c4d3e2f1a0b9c8d7e6f50",
+		"number": "0x112a880",
+		"timestamp": "0x64b6a8f3",
+		"transactions": []
+	}`)
+	head, err = parseHeadInfo(postMerge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if head.Number != 18000000 {
+		t.Errorf("wrong number: %d", head.Number)
+	}
+	if head.TotalDifficulty != nil {
+		t.Errorf("expected no total difficulty, got: %d", head.TotalDifficulty)
+	}
+
+	if _, err := parseHeadInfo(json.RawMessage(`null`)); err == nil {
+		t.Error("expected error for missing block")
+	}
+	if _, err := parseHeadInfo(json.RawMessage(`{"number": "0x1", "timestamp": "0x1"}`)); err == nil {
+		t.Error("expected error for missing hash")
+	}
+	if _, err := parseHeadInfo(json.RawMessage(`{"number": "0x1", "timestamp": "0x1", "hash": "0x6341fd3daf94b748c72ced5a5b26028f2474f5f00d824504e4fa37a75767e177", "totalDifficulty": "lots"}`)); err == nil {
+		t.Error("expected error for invalid total difficulty")
+	}
+}
+
+// MockHeadEth serves a post-merge latest block, without a total difficulty.
+type MockHeadEth struct{ MockEth }
+
+func (s *MockHeadEth) GetBlockByNumber(number string, full bool) map[string]string {
+	return map[string]string{"number": "0x112a880", "timestamp": "0x64b6a8f3", "hash": rinkebyGenesis}
+}
+
+func TestChainHead(t *testing.T) {
+	client := serveMocks(t, map[string]interface{}{"eth": &MockHeadEth{}})
+	defer client.Close()
+	for _, node := range []EthNode{&gethNode{client: client}, &parityNode{client: client}} {
+		head, err := node.ChainHead(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if head.Number != 18000000 || head.Hash != common.HexToHash(rinkebyGenesis) || head.TotalDifficulty != nil {
+			t.Errorf("%s: wrong head: %+v", node.Kind(), head)
+		}
+	}
+}
@@ -0,0 +1,376 @@
+package ethnode
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// ErrCircuitOpen is returned by a CircuitBreaker while it's failing fast.
+var ErrCircuitOpen = errors.New("node is failing, circuit breaker is open")
+
+// BreakerState is the state of a CircuitBreaker.
+type BreakerState int
+
+const (
+	// BreakerClosed passes calls through to the node.
+	BreakerClosed BreakerState = iota
+	// BreakerOpen fails calls fast until the cooldown is over.
+	BreakerOpen
+	// BreakerHalfOpen lets a single probe call through to check if the node
+	// has recovered.
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// BreakerStatus is a snapshot of a CircuitBreaker, such as for a health check.
+type BreakerStatus struct {
+	State    BreakerState `json:"state"`
+	Failures int          `json:"failures"` // Consecutive failures
+	RetryAt  time.Time    `json:"retry_at"` // When an open breaker will allow a probe
+}
+
+// Breaker wraps node with a CircuitBreaker using default settings.
+func Breaker(node EthNode) *CircuitBreaker {
+	return &CircuitBreaker{
+		EthNode:     node,
+		Threshold:   5,
+		Cooldown:    5 * time.Second,
+		MaxCooldown: 5 * time.Minute,
+	}
+}
+
+// CircuitBreaker is an EthNode which stops calling the node after Threshold
+// consecutive failures. Calls fail fast with ErrCircuitOpen for the cooldown,
+// after which one probe call is let through: if it succeeds the breaker
+// closes again, otherwise it reopens with double the cooldown, up to
+// MaxCooldown.
+//
+// Only failures to reach the node count; RPC error responses mean the node is
+// up.
+type CircuitBreaker struct {
+	EthNode
+
+	Threshold   int
+	Cooldown    time.Duration
+	MaxCooldown time.Duration
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	cooldown time.Duration
+	retryAt  time.Time
+	probing  bool
+	now      func() time.Time
+}
+
+func (b *CircuitBreaker) timeNow() time.Time {
+	if b.now != nil {
+		return b.now()
+	}
+	return time.Now()
+}
+
+// Status returns the current state of the breaker.
+func (b *CircuitBreaker) Status() BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	status := BreakerStatus{
+		State:    b.state,
+		Failures: b.failures,
+	}
+	if b.state == BreakerOpen {
+		status.RetryAt = b.retryAt
+	}
+	return status
+}
+
+// allow returns ErrCircuitOpen if a call should fail fast.
+func (b *CircuitBreaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case BreakerOpen:
+		if b.timeNow().Before(b.retryAt) {
+			return ErrCircuitOpen
+		}
+		b.state = BreakerHalfOpen
+		b.probing = true
+	case BreakerHalfOpen:
+		if b.probing {
+			return ErrCircuitOpen
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+// done records the result of a call that was allowed.
+func (b *CircuitBreaker) done(err error) {
+	if _, ok := err.(codedError); ok {
+		// The node responded, so it's up.
+		err = nil
+	} else if _, ok := err.(TxRejectedError); ok {
+		err = nil
+	} else if IsPartialPeers(err) {
+		err = nil
+	} else if err == ErrSelfConnection || err == ErrForkIDUnavailable || err == ErrNotSupported {
+		// The node is up, it just can't do what was asked.
+		err = nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+	if err == nil {
+		if b.state != BreakerClosed {
+			logger.Printf("Node recovered, circuit breaker closed.")
+		}
+		b.state = BreakerClosed
+		b.failures = 0
+		b.cooldown = 0
+		return
+	}
+
+	b.failures++
+	switch {
+	case b.state == BreakerHalfOpen:
+		b.cooldown *= 2
+		if b.MaxCooldown > 0 && b.cooldown > b.MaxCooldown {
+			b.cooldown = b.MaxCooldown
+		}
+	case b.failures >= b.Threshold:
+		b.cooldown = b.Cooldown
+		logger.Printf("Node failed %d consecutive calls, circuit breaker open: %s", b.failures, err)
+	default:
+		return
+	}
+	b.state = BreakerOpen
+	b.retryAt = b.timeNow().Add(b.cooldown)
+}
+
+func (b *CircuitBreaker) call(fn func() error) error {
+	if err := b.allow(); err != nil {
+		return err
+	}
+	err := fn()
+	b.done(err)
+	return err
+}
+
+func (b *CircuitBreaker) Enode(ctx context.Context) (enode string, err error) {
+	err = b.call(func() error {
+		enode, err = b.EthNode.Enode(ctx)
+		return err
+	})
+	return enode, err
+}
+
+func (b *CircuitBreaker) AddTrustedPeer(ctx context.Context, nodeID string) error {
+	return b.call(func() error { return b.EthNode.AddTrustedPeer(ctx, nodeID) })
+}
+
+func (b *CircuitBreaker) RemoveTrustedPeer(ctx context.Context, nodeID string) error {
+	return b.call(func() error { return b.EthNode.RemoveTrustedPeer(ctx, nodeID) })
+}
+
+func (b *CircuitBreaker) ConnectPeer(ctx context.Context, nodeURI string) error {
+	return b.call(func() error { return b.EthNode.ConnectPeer(ctx, nodeURI) })
+}
+
+func (b *CircuitBreaker) DisconnectPeer(ctx context.Context, nodeID string) error {
+	return b.call(func() error { return b.EthNode.DisconnectPeer(ctx, nodeID) })
+}
+
+func (b *CircuitBreaker) Peers(ctx context.Context) (peers []PeerInfo, err error) {
+	err = b.call(func() error {
+		peers, err = b.EthNode.Peers(ctx)
+		return err
+	})
+	return peers, err
+}
+
+func (b *CircuitBreaker) PeersLite(ctx context.Context) (peers []PeerInfo, err error) {
+	err = b.call(func() error {
+		peers, err = b.EthNode.PeersLite(ctx)
+		return err
+	})
+	return peers, err
+}
+
+func (b *CircuitBreaker) PeersByKind(ctx context.Context) (kinds map[NodeKind]int, err error) {
+	err = b.call(func() error {
+		kinds, err = b.EthNode.PeersByKind(ctx)
+		return err
+	})
+	return kinds, err
+}
+
+func (b *CircuitBreaker) PeerSlots(ctx context.Context) (max, used, reserved int, err error) {
+	err = b.call(func() error {
+		max, used, reserved, err = b.EthNode.PeerSlots(ctx)
+		return err
+	})
+	return max, used, reserved, err
+}
+
+func (b *CircuitBreaker) BlockNumber(ctx context.Context) (blockNumber uint64, err error) {
+	err = b.call(func() error {
+		blockNumber, err = b.EthNode.BlockNumber(ctx)
+		return err
+	})
+	return blockNumber, err
+}
+
+func (b *CircuitBreaker) LatestBlock(ctx context.Context) (number uint64, timestamp time.Time, err error) {
+	err = b.call(func() error {
+		number, timestamp, err = b.EthNode.LatestBlock(ctx)
+		return err
+	})
+	return number, timestamp, err
+}
+
+func (b *CircuitBreaker) ForkID(ctx context.Context) (hash [4]byte, next uint64, err error) {
+	err = b.call(func() error {
+		hash, next, err = b.EthNode.ForkID(ctx)
+		return err
+	})
+	return hash, next, err
+}
+
+func (b *CircuitBreaker) FeeHistory(ctx context.Context, blocks int, rewardPercentiles []float64) (history *FeeHistory, err error) {
+	err = b.call(func() error {
+		history, err = b.EthNode.FeeHistory(ctx, blocks, rewardPercentiles)
+		return err
+	})
+	return history, err
+}
+
+func (b *CircuitBreaker) AvailableNamespaces(ctx context.Context) (namespaces map[string]bool, err error) {
+	err = b.call(func() error {
+		namespaces, err = b.EthNode.AvailableNamespaces(ctx)
+		return err
+	})
+	return namespaces, err
+}
+
+func (b *CircuitBreaker) NonceAt(ctx context.Context, address common.Address, block *big.Int) (nonce uint64, err error) {
+	err = b.call(func() error {
+		nonce, err = b.EthNode.NonceAt(ctx, address, block)
+		return err
+	})
+	return nonce, err
+}
+
+func (b *CircuitBreaker) SendRawTransaction(ctx context.Context, signedTx []byte) (hash common.Hash, err error) {
+	err = b.call(func() error {
+		hash, err = b.EthNode.SendRawTransaction(ctx, signedTx)
+		return err
+	})
+	return hash, err
+}
+
+func (b *CircuitBreaker) DataDir(ctx context.Context) (path string, err error) {
+	err = b.call(func() error {
+		path, err = b.EthNode.DataDir(ctx)
+		return err
+	})
+	return path, err
+}
+
+func (b *CircuitBreaker) GenesisHash(ctx context.Context) (hash common.Hash, err error) {
+	err = b.call(func() error {
+		hash, err = b.EthNode.GenesisHash(ctx)
+		return err
+	})
+	return hash, err
+}
+
+func (b *CircuitBreaker) IsMining(ctx context.Context) (mining bool, err error) {
+	err = b.call(func() error {
+		mining, err = b.EthNode.IsMining(ctx)
+		return err
+	})
+	return mining, err
+}
+
+func (b *CircuitBreaker) IsHealing(ctx context.Context) (healing bool, err error) {
+	err = b.call(func() error {
+		healing, err = b.EthNode.IsHealing(ctx)
+		return err
+	})
+	return healing, err
+}
+
+func (b *CircuitBreaker) SyncProgress(ctx context.Context) (progress *SyncProgress, err error) {
+	err = b.call(func() error {
+		progress, err = b.EthNode.SyncProgress(ctx)
+		return err
+	})
+	return progress, err
+}
+
+func (b *CircuitBreaker) ChainConfig(ctx context.Context) (config *params.ChainConfig, err error) {
+	err = b.call(func() error {
+		config, err = b.EthNode.ChainConfig(ctx)
+		return err
+	})
+	return config, err
+}
+
+func (b *CircuitBreaker) BlockGasLimit(ctx context.Context) (limit uint64, err error) {
+	err = b.call(func() error {
+		limit, err = b.EthNode.BlockGasLimit(ctx)
+		return err
+	})
+	return limit, err
+}
+
+func (b *CircuitBreaker) ClientVersion(ctx context.Context) (version string, err error) {
+	err = b.call(func() error {
+		version, err = b.EthNode.ClientVersion(ctx)
+		return err
+	})
+	return version, err
+}
+
+func (b *CircuitBreaker) TxPoolStatus(ctx context.Context) (pending, queued uint64, err error) {
+	err = b.call(func() error {
+		pending, queued, err = b.EthNode.TxPoolStatus(ctx)
+		return err
+	})
+	return pending, queued, err
+}
+
+func (b *CircuitBreaker) NodeUptime(ctx context.Context) (uptime time.Duration, err error) {
+	err = b.call(func() error {
+		uptime, err = b.EthNode.NodeUptime(ctx)
+		return err
+	})
+	return uptime, err
+}
+
+func (b *CircuitBreaker) ChainHead(ctx context.Context) (head *HeadInfo, err error) {
+	err = b.call(func() error {
+		head, err = b.EthNode.ChainHead(ctx)
+		return err
+	})
+	return head, err
+}
@@ -0,0 +1,114 @@
+package ethnode
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type rpcError struct{}
+
+func (rpcError) Error() string  { return "method not found" }
+func (rpcError) ErrorCode() int { return errCodeMethodNotFound }
+
+// failingNode is a fake EthNode whose BlockNumber returns err.
+type failingNode struct {
+	EthNode
+	err   error
+	calls int
+}
+
+func (n *failingNode) BlockNumber(ctx context.Context) (uint64, error) {
+	n.calls++
+	return 42, n.err
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	node := &failingNode{err: errors.New("connection refused")}
+	b := Breaker(node)
+	b.Threshold = 3
+	b.Cooldown = time.Second
+	b.MaxCooldown = 3 * time.Second
+	b.now = func() time.Time { return now }
+
+	checkState := func(want BreakerState) {
+		t.Helper()
+		if got := b.Status().State; got != want {
+			t.Errorf("state: got %s; want %s", got, want)
+		}
+	}
+
+	// Failures below the threshold pass through
+	for i := 0; i < 3; i++ {
+		checkState(BreakerClosed)
+		if _, err := b.BlockNumber(ctx); err != node.err {
+			t.Errorf("expected node error, got: %v", err)
+		}
+	}
+	checkState(BreakerOpen)
+	if status := b.Status(); status.Failures != 3 || !status.RetryAt.Equal(now.Add(time.Second)) {
+		t.Errorf("wrong status: %+v", status)
+	}
+
+	// Open breaker fails fast without calling the node
+	if _, err := b.BlockNumber(ctx); err != ErrCircuitOpen {
+		t.Errorf("expected ErrCircuitOpen, got: %v", err)
+	}
+	if node.calls != 3 {
+		t.Errorf("expected 3 node calls, got %d", node.calls)
+	}
+
+	// After the cooldown, a failed probe reopens with a doubled cooldown
+	now = now.Add(time.Second)
+	if _, err := b.BlockNumber(ctx); err != node.err {
+		t.Errorf("expected probe to reach the node, got: %v", err)
+	}
+	checkState(BreakerOpen)
+	if status := b.Status(); !status.RetryAt.Equal(now.Add(2 * time.Second)) {
+		t.Errorf("expected doubled cooldown, got: %+v", status)
+	}
+
+	// Cooldown is capped
+	now = now.Add(2 * time.Second)
+	b.BlockNumber(ctx)
+	if status := b.Status(); !status.RetryAt.Equal(now.Add(3 * time.Second)) {
+		t.Errorf("expected capped cooldown, got: %+v", status)
+	}
+
+	// Half-open while the probe is in flight
+	now = now.Add(3 * time.Second)
+	node.err = nil
+	if err := b.allow(); err != nil {
+		t.Fatalf("expected probe to be allowed, got: %v", err)
+	}
+	checkState(BreakerHalfOpen)
+	if _, err := b.BlockNumber(ctx); err != ErrCircuitOpen {
+		t.Errorf("expected calls during the probe to fail fast, got: %v", err)
+	}
+	b.done(nil)
+	checkState(BreakerClosed)
+
+	if n, err := b.BlockNumber(ctx); err != nil || n != 42 {
+		t.Errorf("expected closed breaker to pass through, got: %d, %v", n, err)
+	}
+	if status := b.Status(); status.Failures != 0 {
+		t.Errorf("expected failures to reset: %+v", status)
+	}
+}
+
+func TestCircuitBreakerRPCError(t *testing.T) {
+	node := &failingNode{err: rpcError{}}
+	b := Breaker(node)
+	b.Threshold = 1
+	for i := 0; i < 3; i++ {
+		if _, err := b.BlockNumber(context.Background()); err != node.err {
+			t.Errorf("expected node error, got: %v", err)
+		}
+	}
+	if status := b.Status(); status.State != BreakerClosed || status.Failures != 0 {
+		t.Errorf("RPC errors should not open the breaker: %+v", status)
+	}
+}
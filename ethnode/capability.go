@@ -0,0 +1,74 @@
+package ethnode
+
+import (
+	"context"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// capability is an RPC method that vipnode uses, with arguments that are
+// safe to call it with: mutating methods get an invalid node ID, so that they
+// fail to parse it instead of changing the node.
+type capability struct {
+	method string
+	args   []interface{}
+}
+
+var gethCapabilities = []capability{
+	{"admin_nodeInfo", nil},
+	{"admin_peers", nil},
+	{"admin_addPeer", []interface{}{""}},
+	{"admin_removePeer", []interface{}{""}},
+	{"admin_addTrustedPeer", []interface{}{""}},
+	{"admin_removeTrustedPeer", []interface{}{""}},
+	{"eth_blockNumber", nil},
+	{"eth_getBlockByNumber", []interface{}{"latest", false}},
+}
+
+var parityCapabilities = []capability{
+	{"parity_enode", nil},
+	{"parity_netPeers", nil},
+	{"parity_addReservedPeer", []interface{}{""}},
+	{"parity_removeReservedPeer", []interface{}{""}},
+	{"eth_blockNumber", nil},
+	{"eth_getBlockByNumber", []interface{}{"latest", false}},
+}
+
+// CapabilityReport lists which of the RPC methods that vipnode needs are
+// available on a node.
+type CapabilityReport struct {
+	Kind      NodeKind // Kind of node the methods were checked for
+	Available []string // Methods that the node responded to
+	Missing   []string // Methods that the node doesn't have or exposes
+}
+
+// Supported returns whether all of the required methods are available.
+func (r *CapabilityReport) Supported() bool {
+	return len(r.Missing) == 0
+}
+
+// ProbeCapabilities checks which of the RPC methods required for a node of
+// the given kind are available, without constructing an EthNode. Unknown
+// kinds are checked like Geth, which is what RemoteNode treats them as. It
+// only returns an error if the node can't be reached.
+func ProbeCapabilities(ctx context.Context, client *rpc.Client, kind NodeKind) (*CapabilityReport, error) {
+	capabilities := gethCapabilities
+	if kind == Parity {
+		capabilities = parityCapabilities
+	}
+	report := &CapabilityReport{Kind: kind}
+	for _, c := range capabilities {
+		var result interface{}
+		err := call(ctx, client, &result, c.method, c.args...)
+		if err, ok := err.(TransportError); ok {
+			return nil, err
+		}
+		if err, ok := err.(RPCError); ok && err.Code == errCodeMethodNotFound {
+			report.Missing = append(report.Missing, c.method)
+			continue
+		}
+		// Other errors, like invalid params, mean the method exists.
+		report.Available = append(report.Available, c.method)
+	}
+	return report, nil
+}
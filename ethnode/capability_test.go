@@ -0,0 +1,83 @@
+package ethnode
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// serveMocks returns a client for a mock node with only the given services.
+func serveMocks(t *testing.T, services map[string]interface{}) *rpc.Client {
+	server := rpc.NewServer()
+	for name, service := range services {
+		if err := server.RegisterName(name, service); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return rpc.DialInProc(server)
+}
+
+func TestProbeCapabilities(t *testing.T) {
+	testcases := []struct {
+		name        string
+		kind        NodeKind
+		services    map[string]interface{}
+		wantMissing []string
+	}{
+		{
+			name:     "geth",
+			kind:     Geth,
+			services: map[string]interface{}{"eth": &MockEth{}, "admin": &MockAdmin{}},
+		},
+		{
+			name:     "geth without admin",
+			kind:     Geth,
+			services: map[string]interface{}{"eth": &MockEth{}},
+			wantMissing: []string{
+				"admin_nodeInfo", "admin_peers", "admin_addPeer", "admin_removePeer",
+				"admin_addTrustedPeer", "admin_removeTrustedPeer",
+			},
+		},
+		{
+			name:        "unknown kind is checked as geth",
+			kind:        Unknown,
+			services:    map[string]interface{}{"admin": &MockAdmin{}},
+			wantMissing: []string{"eth_blockNumber", "eth_getBlockByNumber"},
+		},
+		{
+			name:        "parity with only netPeers",
+			kind:        Parity,
+			services:    map[string]interface{}{"eth": &MockEth{}, "parity": &MockParity{}},
+			wantMissing: []string{"parity_enode", "parity_addReservedPeer", "parity_removeReservedPeer"},
+		},
+	}
+
+	for _, tc := range testcases {
+		client := serveMocks(t, tc.services)
+		report, err := ProbeCapabilities(context.Background(), client, tc.kind)
+		client.Close()
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tc.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(report.Missing, tc.wantMissing) {
+			t.Errorf("%s: missing: got %q; want %q", tc.name, report.Missing, tc.wantMissing)
+		}
+		if report.Supported() != (len(tc.wantMissing) == 0) {
+			t.Errorf("%s: wrong support: %+v", tc.name, report)
+		}
+		if len(report.Available)+len(report.Missing) == 0 {
+			t.Errorf("%s: no methods were checked", tc.name)
+		}
+	}
+}
+
+func TestProbeCapabilitiesUnreachable(t *testing.T) {
+	client := serveMocks(t, map[string]interface{}{"eth": &MockEth{}})
+	client.Close()
+	if _, err := ProbeCapabilities(context.Background(), client, Geth); err == nil {
+		t.Error("expected error for an unreachable node")
+	}
+}
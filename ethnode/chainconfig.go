@@ -0,0 +1,59 @@
+package ethnode
+
+import (
+	"context"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// knownChainConfigs are the chain configs built into go-ethereum, by the
+// network ID and genesis hash they apply to. The genesis tells apart networks
+// which share a network ID, like Classic and Mainnet.
+var knownChainConfigs = []struct {
+	network NetworkID
+	genesis common.Hash
+	config  *params.ChainConfig
+}{
+	{Mainnet, params.MainnetGenesisHash, params.MainnetChainConfig},
+	{Ropsten, params.TestnetGenesisHash, params.TestnetChainConfig},
+	{Rinkeby, params.RinkebyGenesisHash, params.RinkebyChainConfig},
+}
+
+// chainConfig is the ChainConfig implementation shared by node kinds. It
+// prefers the node's own config from debug_chainConfig, which newer versions
+// of Geth provide, and falls back to the built-in config of the node's
+// network.
+func chainConfig(ctx context.Context, client *rpc.Client, network NetworkID) (*params.ChainConfig, error) {
+	var config params.ChainConfig
+	err := call(ctx, client, &config, "debug_chainConfig")
+	if err == nil {
+		return &config, nil
+	}
+	if err, ok := err.(RPCError); !ok || err.Code != errCodeMethodNotFound {
+		return nil, err
+	}
+	return knownChainConfig(ctx, client, network)
+}
+
+// knownChainConfig returns a copy of the built-in chain config of network,
+// or ErrNotSupported if go-ethereum doesn't have one or the node's genesis
+// doesn't match it.
+func knownChainConfig(ctx context.Context, client *rpc.Client, network NetworkID) (*params.ChainConfig, error) {
+	for _, known := range knownChainConfigs {
+		if known.network != network {
+			continue
+		}
+		genesis, err := genesisHash(ctx, client)
+		if err != nil {
+			return nil, err
+		}
+		if genesis != known.genesis {
+			break
+		}
+		config := *known.config
+		return &config, nil
+	}
+	return nil, ErrNotSupported
+}
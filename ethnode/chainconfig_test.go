@@ -0,0 +1,81 @@
+package ethnode
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// MockChainEth serves a block zero with the given genesis hash.
+type MockChainEth struct {
+	MockEth
+	genesis string
+}
+
+func (s *MockChainEth) GetBlockByNumber(number string, full bool) map[string]string {
+	return map[string]string{"number": "0x0", "hash": s.genesis, "timestamp": "0x0"}
+}
+
+// MockDebugChainConfig serves debug_chainConfig like newer versions of Geth.
+type MockDebugChainConfig struct{}
+
+func (s *MockDebugChainConfig) ChainConfig() map[string]interface{} {
+	return map[string]interface{}{"chainId": 1337, "homesteadBlock": 0, "byzantiumBlock": 10, "constantinopleBlock": 20, "londonBlock": 30}
+}
+
+func TestChainConfig(t *testing.T) {
+	ctx := context.Background()
+	client := serveMocks(t, map[string]interface{}{"eth": &MockChainEth{genesis: params.MainnetGenesisHash.Hex()}})
+	defer client.Close()
+	for _, node := range []EthNode{&gethNode{client: client, network: Mainnet}, &parityNode{client: client, network: Mainnet}} {
+		config, err := node.ChainConfig(ctx)
+		if err != nil {
+			t.Fatalf("%s: %s", node.Kind(), err)
+		}
+		forks := []struct {
+			name  string
+			block int64
+			got   uint64
+		}{
+			{"homestead", 1150000, config.HomesteadBlock.Uint64()},
+			{"dao", 1920000, config.DAOForkBlock.Uint64()},
+			{"eip150", 2463000, config.EIP150Block.Uint64()},
+			{"eip155", 2675000, config.EIP155Block.Uint64()},
+			{"eip158", 2675000, config.EIP158Block.Uint64()},
+			{"byzantium", 4370000, config.ByzantiumBlock.Uint64()},
+		}
+		for _, fork := range forks {
+			if fork.got != uint64(fork.block) {
+				t.Errorf("%s: wrong %s fork block: %d; want %d", node.Kind(), fork.name, fork.got, fork.block)
+			}
+		}
+		if !config.DAOForkSupport || config.ChainID.Int64() != 1 {
+			t.Errorf("%s: wrong mainnet config: %s", node.Kind(), config)
+		}
+		if config == params.MainnetChainConfig {
+			t.Errorf("%s: returned the built-in config rather than a copy", node.Kind())
+		}
+	}
+
+	// Classic shares the network ID of Mainnet, but not its genesis.
+	classic := serveMocks(t, map[string]interface{}{"eth": &MockGenesisEth{}})
+	defer classic.Close()
+	if _, err := (&gethNode{client: classic, network: Mainnet}).ChainConfig(ctx); err != ErrNotSupported {
+		t.Errorf("expected ErrNotSupported for a mismatched genesis, got: %v", err)
+	}
+	if _, err := (&gethNode{client: classic, network: Goerli}).ChainConfig(ctx); err != ErrNotSupported {
+		t.Errorf("expected ErrNotSupported for a network without a built-in config, got: %v", err)
+	}
+
+	// The node's own config is preferred.
+	debug := serveMocks(t, map[string]interface{}{"eth": &MockGenesisEth{}, "debug": &MockDebugChainConfig{}})
+	defer debug.Close()
+	config, err := (&gethNode{client: debug, network: Mainnet}).ChainConfig(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.ChainID.Int64() != 1337 || config.ByzantiumBlock.Int64() != 10 || config.ConstantinopleBlock.Int64() != 20 {
+		t.Errorf("wrong config from debug_chainConfig: %s", config)
+	}
+}
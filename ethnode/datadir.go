@@ -0,0 +1,50 @@
+package ethnode
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// adminDataDir returns the node's data directory from admin_datadir, or
+// ErrNotSupported if the admin API is disabled.
+func adminDataDir(ctx context.Context, client *rpc.Client) (string, error) {
+	var path string
+	err := call(ctx, client, &path, "admin_datadir")
+	if err, ok := err.(RPCError); ok && err.Code == errCodeMethodNotFound {
+		return "", ErrNotSupported
+	}
+	if err != nil {
+		return "", err
+	}
+	if path == "" {
+		// Nodes running with an ephemeral in-memory datadir.
+		return "", ErrNotSupported
+	}
+	return path, nil
+}
+
+// DiskUsage returns the total size in bytes of the files under path, such as
+// the DataDir of a node running on the same host. Files which disappear while
+// walking, like the node's temporary files, are skipped.
+func DiskUsage(path string) (int64, error) {
+	var total int64
+	err := filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+		if os.IsNotExist(err) && p != path {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			total += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return total, nil
+}
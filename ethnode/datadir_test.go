@@ -0,0 +1,84 @@
+package ethnode
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// MockDatadirAdmin is an admin namespace which only has admin_datadir.
+type MockDatadirAdmin struct{ path string }
+
+func (s *MockDatadirAdmin) Datadir() string { return s.path }
+
+func TestDataDir(t *testing.T) {
+	client := serveMocks(t, map[string]interface{}{"admin": &MockDatadirAdmin{"/home/geth/.ethereum"}})
+	defer client.Close()
+	path, err := (&gethNode{client: client}).DataDir(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != "/home/geth/.ethereum" {
+		t.Errorf("wrong data dir: %q", path)
+	}
+
+	// Ephemeral nodes don't have one.
+	ephemeral := serveMocks(t, map[string]interface{}{"admin": &MockDatadirAdmin{""}})
+	defer ephemeral.Close()
+	if _, err := (&gethNode{client: ephemeral}).DataDir(context.Background()); err != ErrNotSupported {
+		t.Errorf("expected ErrNotSupported for an empty data dir, got: %v", err)
+	}
+}
+
+func TestDataDirUnavailable(t *testing.T) {
+	client := serveMocks(t, map[string]interface{}{"eth": &MockEth{}})
+	defer client.Close()
+	if _, err := (&gethNode{client: client}).DataDir(context.Background()); err != ErrNotSupported {
+		t.Errorf("expected ErrNotSupported without the admin API, got: %v", err)
+	}
+	if _, err := (&parityNode{client: client}).DataDir(context.Background()); err != ErrNotSupported {
+		t.Errorf("expected ErrNotSupported for parity, got: %v", err)
+	}
+
+	// Unreachable nodes are not reported as unsupported.
+	client.Close()
+	if _, err := (&gethNode{client: client}).DataDir(context.Background()); err == ErrNotSupported || err == nil {
+		t.Errorf("expected a transport error, got: %v", err)
+	}
+}
+
+func TestDiskUsage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vipnode-datadir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := os.MkdirAll(filepath.Join(dir, "geth", "chaindata"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]int{
+		"geth/chaindata/000001.ldb": 1000,
+		"geth/chaindata/000002.ldb": 2000,
+		"geth/nodekey":              64,
+	}
+	for name, size := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	usage, err := DiskUsage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage != 3064 {
+		t.Errorf("got %d bytes; want 3064", usage)
+	}
+
+	if _, err := DiskUsage(filepath.Join(dir, "missing")); err == nil {
+		t.Error("expected error for missing path")
+	}
+}
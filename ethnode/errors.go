@@ -0,0 +1,149 @@
+package ethnode
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// RPCError is returned by EthNode methods when the node responded with a
+// JSON-RPC error, such as when an API is disabled. The node is reachable, so
+// reconnecting won't help.
+type RPCError struct {
+	Method  string
+	Code    int
+	Message string
+}
+
+func (err RPCError) Error() string {
+	return fmt.Sprintf("%s failed: %s (code %d)", err.Method, err.Message, err.Code)
+}
+
+// ErrorCode returns the JSON-RPC error code.
+func (err RPCError) ErrorCode() int {
+	return err.Code
+}
+
+// TransportError is returned by EthNode methods when the node could not be
+// reached or its response could not be read, such as when the connection is
+// dropped. The caller may want to reconnect.
+type TransportError struct {
+	Method string
+	Err    error
+}
+
+func (err TransportError) Error() string {
+	return fmt.Sprintf("%s failed to reach the node: %s", err.Method, err.Err)
+}
+
+// PartialPeersError is returned by Peers and PeersLite along with the peers
+// which parsed, when some entries of the node's peer list didn't, such as
+// garbled entries from a very busy node. It's a warning rather than a
+// failure: the returned peers are usable, only the skipped ones are missing.
+type PartialPeersError struct {
+	Method  string
+	Skipped int
+	Total   int
+	// Err is the first parse error.
+	Err error
+}
+
+func (err PartialPeersError) Error() string {
+	return fmt.Sprintf("%s: skipped %d of %d peers which failed to parse: %s", err.Method, err.Skipped, err.Total, err.Err)
+}
+
+// TrustedPeersError is returned by ManagedNode.SetTrustedPeers when one of
+// the changes failed. The changes applied before it were rolled back, except
+// for the ones in Stuck, which the node and the managed peers still have.
+type TrustedPeersError struct {
+	Failed TrustedPeerChange
+	Err    error
+	// RolledBack are the applied changes which were undone, latest first.
+	RolledBack []TrustedPeerChange
+	// Stuck are the applied changes which failed to be undone, with their
+	// errors.
+	Stuck map[TrustedPeerChange]error
+}
+
+func (err TrustedPeersError) Error() string {
+	msg := fmt.Sprintf("failed to %s as a trusted peer: %s", err.Failed, err.Err)
+	if len(err.Stuck) > 0 {
+		msg += fmt.Sprintf(" (%d earlier changes could not be rolled back)", len(err.Stuck))
+	}
+	return msg
+}
+
+// IsPartialPeers returns whether err is a PartialPeersError, which comes with
+// usable peers.
+func IsPartialPeers(err error) bool {
+	_, ok := err.(PartialPeersError)
+	return ok
+}
+
+// classifyError wraps a non-nil err from calling method as an RPCError if the
+// node responded with an error, or a TransportError otherwise.
+func classifyError(method string, err error) error {
+	switch err := err.(type) {
+	case nil:
+		return nil
+	case RPCError, TransportError:
+		return err
+	case codedError:
+		return RPCError{Method: method, Code: err.ErrorCode(), Message: err.Error()}
+	default:
+		return TransportError{Method: method, Err: err}
+	}
+}
+
+// call is client.CallContext with classified errors.
+func call(ctx context.Context, client *rpc.Client, result interface{}, method string, args ...interface{}) error {
+	return classifyError(method, client.CallContext(ctx, result, method, args...))
+}
+
+// ErrorClass returns a short name for the kind of err, such as "timeout" or
+// "rpc_-32601", so that errors can be counted without their messages, which
+// may include addresses or peer IDs. It returns "" for a nil err, and "other"
+// for errors it doesn't recognize.
+func ErrorClass(err error) string {
+	switch err {
+	case nil:
+		return ""
+	case ErrNotSupported, ErrForkIDUnavailable:
+		return "not_supported"
+	case ErrCircuitOpen:
+		return "circuit_open"
+	case ErrClosed:
+		return "closed"
+	case ErrSelfConnection:
+		return "self_connection"
+	}
+	class := "other"
+	switch e := err.(type) {
+	case RPCError:
+		return fmt.Sprintf("rpc_%d", e.Code)
+	case codedError:
+		return fmt.Sprintf("rpc_%d", e.ErrorCode())
+	case TxRejectedError:
+		return "tx_rejected"
+	case MissingNamespacesError:
+		return "missing_namespaces"
+	case PartialPeersError:
+		return "partial_peers"
+	case TransportError:
+		class = "transport"
+		err = e.Err
+	}
+	if errors.Is(err, context.Canceled) {
+		return "canceled"
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return "timeout"
+	}
+	if err, ok := err.(net.Error); ok && err.Timeout() {
+		return "timeout"
+	}
+	return class
+}
@@ -0,0 +1,90 @@
+package ethnode
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+func TestErrorClassification(t *testing.T) {
+	ctx := context.Background()
+
+	// Error responses from a reachable node
+	client := mockNode(t, &MockEth{}, &MockAdmin{disabled: true})
+	defer client.Close()
+	node := &gethNode{client: client}
+	_, err := node.Enode(ctx)
+	if err, ok := err.(RPCError); !ok {
+		t.Errorf("expected RPCError for an error response, got: %T %v", err, err)
+	} else if err.Method != "admin_nodeInfo" || err.Message != "admin disabled" {
+		t.Errorf("wrong RPCError: %+v", err)
+	}
+	err = (&parityNode{client: client}).AddTrustedPeer(ctx, "bar")
+	if err, ok := err.(RPCError); !ok || err.Code != errCodeMethodNotFound {
+		t.Errorf("expected method not found RPCError, got: %v", err)
+	}
+
+	// Unreachable node
+	unreachable, err := rpc.DialHTTP("http://127.0.0.1:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unreachable.Close()
+	_, err = (&gethNode{client: unreachable}).BlockNumber(ctx)
+	if err, ok := err.(TransportError); !ok {
+		t.Errorf("expected TransportError for an unreachable node, got: %T %v", err, err)
+	} else if err.Method != "eth_blockNumber" {
+		t.Errorf("wrong TransportError: %+v", err)
+	}
+
+	// Closed connection
+	closed := mockNode(t, &MockEth{}, &MockAdmin{})
+	closed.Close()
+	if _, err := (&parityNode{client: closed}).Peers(ctx); err != nil {
+		if _, ok := err.(TransportError); !ok {
+			t.Errorf("expected TransportError for a closed client, got: %T %v", err, err)
+		}
+	} else {
+		t.Error("expected error for a closed client")
+	}
+}
+
+func TestCircuitBreakerClassified(t *testing.T) {
+	node := &failingNode{err: classifyError("eth_blockNumber", rpcError{})}
+	b := Breaker(node)
+	b.Threshold = 1
+	b.BlockNumber(context.Background())
+	if status := b.Status(); status.State != BreakerClosed {
+		t.Errorf("RPCError should not open the breaker: %+v", status)
+	}
+
+	node.err = classifyError("eth_blockNumber", context.DeadlineExceeded)
+	b.BlockNumber(context.Background())
+	if status := b.Status(); status.State != BreakerOpen {
+		t.Errorf("TransportError should open the breaker: %+v", status)
+	}
+}
+
+func TestErrorClass(t *testing.T) {
+	testcases := []struct {
+		err  error
+		want string
+	}{
+		{nil, ""},
+		{ErrNotSupported, "not_supported"},
+		{ErrCircuitOpen, "circuit_open"},
+		{RPCError{Method: "admin_peers", Code: -32601, Message: "the method admin_peers does not exist"}, "rpc_-32601"},
+		{TransportError{Method: "eth_blockNumber", Err: errors.New("connection refused")}, "transport"},
+		{TransportError{Method: "eth_blockNumber", Err: context.DeadlineExceeded}, "timeout"},
+		{TransportError{Method: "eth_blockNumber", Err: context.Canceled}, "canceled"},
+		{TxRejectedError{Reason: TxNonceTooLow, Message: "nonce too low"}, "tx_rejected"},
+		{errors.New("something else"), "other"},
+	}
+	for _, tc := range testcases {
+		if got := ErrorClass(tc.err); got != tc.want {
+			t.Errorf("%v: got class %q; want %q", tc.err, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package ethnode
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Host capabilities reported to the pool for the node features detected by
+// DetectCapabilities, so that clients can require them.
+const (
+	// CapabilityArchive is set when the node keeps the state of old blocks.
+	CapabilityArchive = "archive"
+	// CapabilityTrace is set when the node serves the trace_* RPC API.
+	CapabilityTrace = "trace"
+	// CapabilityLES is set when the node serves the light client protocol.
+	CapabilityLES = "les"
+)
+
+// archiveProbeDepth is how far behind the head a block needs to be for its
+// state to be pruned by a non-archive node. Geth keeps the state of the last
+// 128 blocks in memory.
+const archiveProbeDepth = 128
+
+// DetectCapabilities returns the features that the node offers beyond serving
+// peers, as free-form capabilities for the pool. Detected capabilities are
+// set to "true", undetected ones are omitted. Archive data is only detected
+// once the node is far enough past block 1 for it to have been pruned.
+func DetectCapabilities(ctx context.Context, node EthNode) (map[string]string, error) {
+	namespaces, err := node.AvailableNamespaces(ctx)
+	if err != nil {
+		return nil, err
+	}
+	capabilities := map[string]string{}
+	if namespaces["trace"] {
+		capabilities[CapabilityTrace] = "true"
+	}
+	if namespaces["les"] {
+		capabilities[CapabilityLES] = "true"
+	}
+
+	head, err := node.BlockNumber(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if head > archiveProbeDepth+1 {
+		// Pruned nodes fail to load the state of old blocks.
+		if _, err := node.NonceAt(ctx, common.Address{}, big.NewInt(1)); err == nil {
+			capabilities[CapabilityArchive] = "true"
+		} else if _, ok := err.(TransportError); ok {
+			return nil, err
+		}
+	}
+	return capabilities, nil
+}
@@ -0,0 +1,77 @@
+package ethnode
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// MockStateEth serves the state of blocks from oldest onwards, like a node
+// which pruned the rest.
+type MockStateEth struct {
+	MockEth
+	head   string
+	oldest uint64
+}
+
+func (s *MockStateEth) BlockNumber() string { return s.head }
+
+func (s *MockStateEth) GetTransactionCount(address common.Address, block string) (string, error) {
+	if n, err := strconv.ParseUint(block, 0, 64); err != nil || n < s.oldest {
+		return "", errors.New("missing trie node")
+	}
+	return "0x0", nil
+}
+
+type MockTrace struct{}
+
+func (s *MockTrace) Block(number string) []interface{} { return nil }
+
+func TestDetectCapabilities(t *testing.T) {
+	testcases := []struct {
+		name     string
+		services map[string]interface{}
+		want     map[string]string
+	}{
+		{
+			name:     "pruned",
+			services: map[string]interface{}{"eth": &MockStateEth{head: "0x1000", oldest: 0xf00}},
+			want:     map[string]string{},
+		},
+		{
+			name:     "archive",
+			services: map[string]interface{}{"eth": &MockStateEth{head: "0x1000"}},
+			want:     map[string]string{"archive": "true"},
+		},
+		{
+			name:     "too early to tell",
+			services: map[string]interface{}{"eth": &MockStateEth{head: "0x10"}},
+			want:     map[string]string{},
+		},
+		{
+			name: "trace and les",
+			services: map[string]interface{}{
+				"eth":   &MockStateEth{head: "0x1000", oldest: 0xf00},
+				"trace": &MockTrace{},
+				"les":   &MockLes{},
+			},
+			want: map[string]string{"trace": "true", "les": "true"},
+		},
+	}
+
+	for _, tc := range testcases {
+		node := &gethNode{client: serveMocks(t, tc.services)}
+		got, err := DetectCapabilities(context.Background(), node)
+		if err != nil {
+			t.Errorf("%s: %s", tc.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: got %v; want %v", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package ethnode
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// ErrNotSupported is returned when the node doesn't support a method, such as
+// FeeHistory on nodes from before EIP-1559.
+var ErrNotSupported = errors.New("method is not supported by this node")
+
+// FeeHistory is the result of eth_feeHistory, for suggesting EIP-1559 base
+// and priority fees.
+type FeeHistory struct {
+	// OldestBlock is the number of the first block in the history.
+	OldestBlock uint64
+	// BaseFee is the base fee per gas of each block, including the next block
+	// after the newest, so it has one more entry than the number of blocks.
+	BaseFee []*big.Int
+	// GasUsedRatio is the ratio of gas used to the gas limit of each block.
+	GasUsedRatio []float64
+	// Reward is the priority fee per gas of each block at each of the
+	// requested percentiles.
+	Reward [][]*big.Int
+}
+
+// feeHistory is the FeeHistory implementation shared by node kinds, since
+// eth_feeHistory is standard.
+func feeHistory(ctx context.Context, client *rpc.Client, blocks int, rewardPercentiles []float64) (*FeeHistory, error) {
+	if rewardPercentiles == nil {
+		rewardPercentiles = []float64{}
+	}
+	var raw json.RawMessage
+	err := call(ctx, client, &raw, "eth_feeHistory", hexutil.Uint64(blocks), "latest", rewardPercentiles)
+	if err, ok := err.(RPCError); ok && err.Code == errCodeMethodNotFound {
+		return nil, ErrNotSupported
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseFeeHistory(raw)
+}
+
+// parseFeeHistory parses a JSON eth_feeHistory result. Blocks before EIP-1559
+// have no base fee, so a history without any is ErrNotSupported.
+func parseFeeHistory(raw json.RawMessage) (*FeeHistory, error) {
+	var result struct {
+		OldestBlock   string           `json:"oldestBlock"`
+		BaseFeePerGas []*hexutil.Big   `json:"baseFeePerGas"`
+		GasUsedRatio  []float64        `json:"gasUsedRatio"`
+		Reward        [][]*hexutil.Big `json:"reward"`
+	}
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return nil, err
+	}
+	oldest, err := strconv.ParseUint(result.OldestBlock, 0, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	history := &FeeHistory{
+		OldestBlock:  oldest,
+		BaseFee:      make([]*big.Int, 0, len(result.BaseFeePerGas)),
+		GasUsedRatio: result.GasUsedRatio,
+		Reward:       make([][]*big.Int, 0, len(result.Reward)),
+	}
+	hasBaseFee := false
+	for _, fee := range result.BaseFeePerGas {
+		n := new(big.Int)
+		if fee != nil {
+			n.Set(fee.ToInt())
+		}
+		if n.Sign() > 0 {
+			hasBaseFee = true
+		}
+		history.BaseFee = append(history.BaseFee, n)
+	}
+	if !hasBaseFee {
+		return nil, ErrNotSupported
+	}
+	for _, rewards := range result.Reward {
+		r := make([]*big.Int, 0, len(rewards))
+		for _, reward := range rewards {
+			n := new(big.Int)
+			if reward != nil {
+				n.Set(reward.ToInt())
+			}
+			r = append(r, n)
+		}
+		history.Reward = append(history.Reward, r)
+	}
+	return history, nil
+}
@@ -0,0 +1,88 @@
+package ethnode
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// feeHistoryPayload is an eth_feeHistory response for 4 blocks at the 25th
+// and 75th percentiles, from mainnet.
+const feeHistoryPayload = `{
+	"oldestBlock": "0xd4f6f3",
+	"baseFeePerGas": ["0x1a4d2a9c0e", "0x19c3d6eb7f", "0x1b1f8b8c3a", "0x1a73b9e3d1", "0x19e1b79bfe"],
+	"gasUsedRatio": [0.4005, 0.9987, 0.3404, 0.4126],
+	"reward": [
+		["0x3b9aca00", "0x77359400"],
+		["0x3b9aca00", "0x59682f00"],
+		["0x2faf0800", "0x3b9aca00"],
+		["0x3b9aca00", "0xb2d05e00"]
+	]
+}`
+
+// preLondonPayload is the response for blocks before EIP-1559.
+const preLondonPayload = `{
+	"oldestBlock": "0x29",
+	"baseFeePerGas": ["0x0", "0x0", "0x0"],
+	"gasUsedRatio": [0.2, 0.3],
+	"reward": [["0x0"], ["0x0"]]
+}`
+
+type MockFeeEth struct {
+	MockEth
+	payload     string
+	blocks      hexutil.Uint64
+	percentiles []float64
+}
+
+func (s *MockFeeEth) FeeHistory(blocks hexutil.Uint64, newest string, percentiles []float64) json.RawMessage {
+	s.blocks, s.percentiles = blocks, percentiles
+	return json.RawMessage(s.payload)
+}
+
+func TestFeeHistory(t *testing.T) {
+	eth := &MockFeeEth{payload: feeHistoryPayload}
+	server := rpc.NewServer()
+	if err := server.RegisterName("eth", eth); err != nil {
+		t.Fatal(err)
+	}
+	feeClient := rpc.DialInProc(server)
+	defer feeClient.Close()
+
+	history, err := (&gethNode{client: feeClient}).FeeHistory(context.Background(), 4, []float64{25, 75})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if eth.blocks != 4 || !reflect.DeepEqual(eth.percentiles, []float64{25, 75}) {
+		t.Errorf("wrong request: %d blocks, %v percentiles", eth.blocks, eth.percentiles)
+	}
+	if history.OldestBlock != 0xd4f6f3 {
+		t.Errorf("wrong oldest block: %d", history.OldestBlock)
+	}
+	if len(history.BaseFee) != 5 || history.BaseFee[0].Int64() != 0x1a4d2a9c0e || history.BaseFee[4].Int64() != 0x19e1b79bfe {
+		t.Errorf("wrong base fees: %v", history.BaseFee)
+	}
+	if len(history.GasUsedRatio) != 4 || history.GasUsedRatio[1] != 0.9987 {
+		t.Errorf("wrong gas used ratios: %v", history.GasUsedRatio)
+	}
+	if len(history.Reward) != 4 || len(history.Reward[3]) != 2 || history.Reward[3][1].Int64() != 3000000000 {
+		t.Errorf("wrong rewards: %v", history.Reward)
+	}
+
+	// Pre-EIP-1559 blocks
+	eth.payload = preLondonPayload
+	if _, err := (&parityNode{client: feeClient}).FeeHistory(context.Background(), 2, nil); err != ErrNotSupported {
+		t.Errorf("expected ErrNotSupported for pre-1559 blocks, got: %v", err)
+	}
+
+	// Nodes without eth_feeHistory
+	client := mockNode(t, &MockEth{}, &MockAdmin{})
+	defer client.Close()
+	if _, err := (&gethNode{client: client}).FeeHistory(context.Background(), 2, nil); err != ErrNotSupported {
+		t.Errorf("expected ErrNotSupported without eth_feeHistory, got: %v", err)
+	}
+}
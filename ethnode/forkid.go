@@ -0,0 +1,65 @@
+package ethnode
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"hash/crc32"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrForkIDUnavailable is returned by ForkID when the node doesn't expose
+// enough of its chain configuration to compute its fork ID.
+var ErrForkIDUnavailable = errors.New("fork ID is not available from this node")
+
+// chainInfo is the subset of the eth (or les) protocol info in admin_nodeInfo
+// that identifies the chain.
+type chainInfo struct {
+	Genesis string                     `json:"genesis"`
+	Config  map[string]json.RawMessage `json:"config"`
+}
+
+// gatherForks returns the sorted, deduplicated block numbers of the forks in
+// a chain config, like Geth does: every "...Block" field which is set, except
+// for forks at genesis.
+func gatherForks(config map[string]json.RawMessage) []uint64 {
+	seen := map[uint64]struct{}{}
+	forks := []uint64{}
+	for name, raw := range config {
+		if !strings.HasSuffix(name, "Block") {
+			continue
+		}
+		block, err := strconv.ParseUint(string(raw), 10, 64)
+		if err != nil || block == 0 {
+			// Unset (null) or not a block number
+			continue
+		}
+		if _, ok := seen[block]; ok {
+			continue
+		}
+		seen[block] = struct{}{}
+		forks = append(forks, block)
+	}
+	sort.Slice(forks, func(i, j int) bool { return forks[i] < forks[j] })
+	return forks
+}
+
+// computeForkID returns the EIP-2124 fork ID at block head: the CRC32
+// checksum of the genesis hash and the past fork block numbers, and the block
+// number of the next fork, or 0 if none is scheduled.
+func computeForkID(genesis []byte, forks []uint64, head uint64) (hash [4]byte, next uint64) {
+	checksum := crc32.ChecksumIEEE(genesis)
+	var buf [8]byte
+	for _, fork := range forks {
+		if fork > head {
+			next = fork
+			break
+		}
+		binary.BigEndian.PutUint64(buf[:], fork)
+		checksum = crc32.Update(checksum, crc32.IEEETable, buf[:])
+	}
+	binary.BigEndian.PutUint32(hash[:], checksum)
+	return hash, next
+}
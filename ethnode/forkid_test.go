@@ -0,0 +1,80 @@
+package ethnode
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+const (
+	mainnetGenesis = "0xd4e56740f876aef8c010b86a40d5f56745a118d0906a34e69aec8c0db1cb8fa3"
+	rinkebyGenesis = "0x6341fd3daf94b748c72ced5a5b26028f2474f5f00d824504e4fa37a75767e177"
+)
+
+// Chain configs as reported by Geth's admin_nodeInfo.
+const (
+	mainnetConfig = `{"chainId":1,"homesteadBlock":1150000,"daoForkBlock":1920000,"daoForkSupport":true,"eip150Block":2463000,"eip150Hash":"0x2086799aeebeae135c246c65021c82b4e15a2c451340993aacfd2751886514f0","eip155Block":2675000,"eip158Block":2675000,"byzantiumBlock":4370000,"constantinopleBlock":7280000,"petersburgBlock":7280000,"istanbulBlock":9069000,"muirGlacierBlock":9200000,"ethash":{}}`
+	rinkebyConfig = `{"chainId":4,"homesteadBlock":1,"daoForkBlock":null,"daoForkSupport":false,"eip150Block":2,"eip150Hash":"0x9b095b36c15eaf13044373aef8ee0bd3a382a5abb92e402afa44b8249c3a90e9","eip155Block":3,"eip158Block":3,"byzantiumBlock":1035301,"constantinopleBlock":3660663,"petersburgBlock":4321234,"istanbulBlock":5435345,"clique":{"period":15,"epoch":30000}}`
+)
+
+func forkHash(checksum uint32) (hash [4]byte) {
+	binary.BigEndian.PutUint32(hash[:], checksum)
+	return hash
+}
+
+func TestComputeForkID(t *testing.T) {
+	// Test vectors from EIP-2124
+	testcases := []struct {
+		name     string
+		genesis  string
+		config   string
+		head     uint64
+		wantHash uint32
+		wantNext uint64
+	}{
+		{"mainnet unsynced", mainnetGenesis, mainnetConfig, 0, 0xfc64ec04, 1150000},
+		{"mainnet homestead", mainnetGenesis, mainnetConfig, 1150000, 0x97c2c34c, 1920000},
+		{"mainnet dao", mainnetGenesis, mainnetConfig, 1920000, 0x91d1f948, 2463000},
+		{"mainnet byzantium", mainnetGenesis, mainnetConfig, 7279999, 0xa00bc324, 7280000},
+		{"mainnet petersburg", mainnetGenesis, mainnetConfig, 7280000, 0x668db0af, 9069000},
+		{"mainnet muir glacier", mainnetGenesis, mainnetConfig, 10000000, 0xe029e991, 0},
+		{"rinkeby unsynced", rinkebyGenesis, rinkebyConfig, 0, 0x3b8e0691, 1},
+		{"rinkeby spurious", rinkebyGenesis, rinkebyConfig, 3, 0xcb3a64bb, 1035301},
+		{"rinkeby istanbul", rinkebyGenesis, rinkebyConfig, 5435345, 0xcbdb8838, 0},
+	}
+	for _, tc := range testcases {
+		var config map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(tc.config), &config); err != nil {
+			t.Fatal(err)
+		}
+		genesis, err := hexutil.Decode(tc.genesis)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hash, next := computeForkID(genesis, gatherForks(config), tc.head)
+		if hash != forkHash(tc.wantHash) || next != tc.wantNext {
+			t.Errorf("%s: got %x, %d; want %08x, %d", tc.name, hash, next, tc.wantHash, tc.wantNext)
+		}
+	}
+}
+
+func TestGethForkID(t *testing.T) {
+	client := mockNode(t, &MockEth{}, &MockAdmin{})
+	defer client.Close()
+
+	// MockEth is at block 42
+	hash, next, err := (&gethNode{client: client}).ForkID(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash != forkHash(0xcb3a64bb) || next != 1035301 {
+		t.Errorf("got %x, %d; want cb3a64bb, 1035301", hash, next)
+	}
+
+	if _, _, err := (&parityNode{client: client}).ForkID(context.Background()); err != ErrForkIDUnavailable {
+		t.Errorf("expected ErrForkIDUnavailable, got: %v", err)
+	}
+}
@@ -2,11 +2,16 @@ package ethnode
 
 import (
 	"context"
-	"errors"
+	"encoding/json"
+	"math/big"
 	"strconv"
+	"time"
 
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/params"
 	"github.com/ethereum/go-ethereum/rpc"
 )
 
@@ -20,7 +25,18 @@ type codedError interface {
 var _ EthNode = &gethNode{}
 
 type gethNode struct {
-	client *rpc.Client
+	client  *rpc.Client
+	network NetworkID
+	pos     bool // Past the merge, see UserAgent.IsPoS
+	self    selfGuard
+	heads   *headCache // nil if subscriptions are unavailable
+	subs    *subscriptions
+	// borrowed is set when the client is owned by the caller, so Close
+	// leaves it open.
+	borrowed bool
+
+	namespaces namespaceCache
+	gasLimit   gasLimitCache
 }
 
 func (n *gethNode) ContractBackend() bind.ContractBackend {
@@ -31,55 +47,93 @@ func (n *gethNode) Kind() NodeKind {
 	return Geth
 }
 
-func (n *gethNode) CheckCompatible(ctx context.Context) error {
-	// TODO: Make sure we have the necessary APIs available, maybe version check?
-	var result interface{}
-	err := n.client.CallContext(ctx, &result, "admin_addTrustedPeer", "")
-	if err == nil {
-		return errors.New("failed to detect compatibility")
-	}
-	if err, ok := err.(codedError); ok && err.ErrorCode() == errCodeMethodNotFound {
-		return err
-	}
-	return nil
+func (n *gethNode) Network() NetworkID {
+	return n.network
 }
 
 func (n *gethNode) ConnectPeer(ctx context.Context, nodeURI string) error {
+	if err := n.self.check(ctx, n.Enode, nodeURI); err != nil {
+		return err
+	}
 	var result interface{}
-	return n.client.CallContext(ctx, &result, "admin_addPeer", nodeURI)
+	return call(ctx, n.client, &result, "admin_addPeer", nodeURI)
 }
 
 func (n *gethNode) DisconnectPeer(ctx context.Context, nodeID string) error {
+	// admin_removePeer drops the connection and removes the node from the
+	// static set so that it isn't redialed, which undoes ConnectPeer. The
+	// trusted set is separate, so trusted peers can still reconnect. Bare node
+	// IDs are accepted as well as enode URIs.
 	var result interface{}
-	return n.client.CallContext(ctx, &result, "admin_removePeer", nodeID)
+	return call(ctx, n.client, &result, "admin_removePeer", nodeID)
 }
 
 func (n *gethNode) AddTrustedPeer(ctx context.Context, nodeID string) error {
+	if err := n.self.check(ctx, n.Enode, nodeID); err != nil {
+		return err
+	}
 	// Result is always true, not worth checking
 	var result interface{}
-	return n.client.CallContext(ctx, &result, "admin_addTrustedPeer", nodeID)
+	return call(ctx, n.client, &result, "admin_addTrustedPeer", nodeID)
 }
 
 func (n *gethNode) RemoveTrustedPeer(ctx context.Context, nodeID string) error {
 	// Result is always true, not worth checking
 	var result interface{}
-	return n.client.CallContext(ctx, &result, "admin_removeTrustedPeer", nodeID)
+	return call(ctx, n.client, &result, "admin_removeTrustedPeer", nodeID)
 }
 
 func (n *gethNode) Peers(ctx context.Context) ([]PeerInfo, error) {
-	var peers []PeerInfo
-	err := n.client.CallContext(ctx, &peers, "admin_peers")
+	var raw []json.RawMessage
+	err := call(ctx, n.client, &raw, "admin_peers")
 	if err != nil {
 		return nil, err
 	}
-	return peers, nil
+	return parsePeers("admin_peers", raw, false)
+}
+
+func (n *gethNode) PeersLite(ctx context.Context) ([]PeerInfo, error) {
+	// There is no lighter admin API for peers, so we only save on decoding.
+	var raw []json.RawMessage
+	err := call(ctx, n.client, &raw, "admin_peers")
+	if err != nil {
+		return nil, err
+	}
+	return parsePeers("admin_peers", raw, true)
+}
+
+func (n *gethNode) PeersByKind(ctx context.Context) (map[NodeKind]int, error) {
+	peers, err := n.PeersLite(ctx)
+	if err != nil && !IsPartialPeers(err) {
+		return nil, err
+	}
+	return CountPeersByKind(peers), err
+}
+
+func (n *gethNode) PeerSlots(ctx context.Context) (max, used, reserved int, err error) {
+	var peers []struct {
+		Network struct {
+			Trusted bool `json:"trusted"`
+			Static  bool `json:"static"`
+		} `json:"network"`
+	}
+	if err := call(ctx, n.client, &peers, "admin_peers"); err != nil {
+		return 0, 0, 0, err
+	}
+	for _, peer := range peers {
+		if peer.Network.Trusted || peer.Network.Static {
+			reserved++
+		}
+	}
+	// Geth doesn't expose its MaxPeers setting over RPC.
+	return 0, len(peers), reserved, nil
 }
 
 func (n *gethNode) Enode(ctx context.Context) (string, error) {
 	var info struct {
 		Enode string `json:"enode"` // Enode URL for adding this peer from remote peers
 	}
-	err := n.client.CallContext(ctx, &info, "admin_nodeInfo")
+	err := call(ctx, n.client, &info, "admin_nodeInfo")
 	if err != nil {
 		return "", err
 	}
@@ -87,9 +141,121 @@ func (n *gethNode) Enode(ctx context.Context) (string, error) {
 }
 
 func (n *gethNode) BlockNumber(ctx context.Context) (uint64, error) {
+	if number, _, ok := n.heads.Latest(); ok {
+		return number, nil
+	}
 	var result string
-	if err := n.client.CallContext(ctx, &result, "eth_blockNumber"); err != nil {
+	if err := call(ctx, n.client, &result, "eth_blockNumber"); err != nil {
 		return 0, err
 	}
 	return strconv.ParseUint(result, 0, 64)
 }
+
+func (n *gethNode) LatestBlock(ctx context.Context) (uint64, time.Time, error) {
+	if number, timestamp, ok := n.heads.Latest(); ok {
+		return number, timestamp, nil
+	}
+	return latestBlock(ctx, n.client)
+}
+
+func (n *gethNode) FeeHistory(ctx context.Context, blocks int, rewardPercentiles []float64) (*FeeHistory, error) {
+	return feeHistory(ctx, n.client, blocks, rewardPercentiles)
+}
+
+func (n *gethNode) AvailableNamespaces(ctx context.Context) (map[string]bool, error) {
+	return n.namespaces.get(ctx, n.client)
+}
+
+func (n *gethNode) NonceAt(ctx context.Context, address common.Address, block *big.Int) (uint64, error) {
+	return nonceAt(ctx, n.client, address, block)
+}
+
+func (n *gethNode) SendRawTransaction(ctx context.Context, signedTx []byte) (common.Hash, error) {
+	return sendRawTransaction(ctx, n.client, signedTx)
+}
+
+func (n *gethNode) DataDir(ctx context.Context) (string, error) {
+	return adminDataDir(ctx, n.client)
+}
+
+func (n *gethNode) GenesisHash(ctx context.Context) (common.Hash, error) {
+	return genesisHash(ctx, n.client)
+}
+
+func (n *gethNode) IsMining(ctx context.Context) (bool, error) {
+	if n.pos {
+		// eth_mining is always false once the consensus client takes
+		// over block production.
+		return false, ErrNotSupported
+	}
+	return ethMining(ctx, n.client)
+}
+
+func (n *gethNode) IsHealing(ctx context.Context) (bool, error) {
+	return ethHealing(ctx, n.client)
+}
+
+func (n *gethNode) SyncProgress(ctx context.Context) (*SyncProgress, error) {
+	return syncProgress(ctx, n.client)
+}
+
+func (n *gethNode) ChainConfig(ctx context.Context) (*params.ChainConfig, error) {
+	return chainConfig(ctx, n.client, n.network)
+}
+
+func (n *gethNode) BlockGasLimit(ctx context.Context) (uint64, error) {
+	return n.gasLimit.get(ctx, n.client)
+}
+
+func (n *gethNode) ClientVersion(ctx context.Context) (string, error) {
+	return clientVersion(ctx, n.client)
+}
+
+func (n *gethNode) TxPoolStatus(ctx context.Context) (pending, queued uint64, err error) {
+	return txPoolStatus(ctx, n.client)
+}
+
+func (n *gethNode) NodeUptime(ctx context.Context) (time.Duration, error) {
+	return gethUptime(ctx, n.client, time.Now())
+}
+
+func (n *gethNode) ChainHead(ctx context.Context) (*HeadInfo, error) {
+	return chainHead(ctx, n.client)
+}
+
+func (n *gethNode) Close() error {
+	n.subs.Close()
+	if !n.borrowed {
+		n.client.Close()
+	}
+	return nil
+}
+
+func (n *gethNode) ForkID(ctx context.Context) ([4]byte, uint64, error) {
+	var info struct {
+		Protocols map[string]json.RawMessage `json:"protocols"`
+	}
+	if err := call(ctx, n.client, &info, "admin_nodeInfo"); err != nil {
+		return [4]byte{}, 0, err
+	}
+	// Light clients only run les, which reports the same chain info.
+	raw, ok := info.Protocols["eth"]
+	if !ok {
+		raw, ok = info.Protocols["les"]
+	}
+	var chain chainInfo
+	if ok {
+		// Unavailable protocols are reported as a string instead.
+		json.Unmarshal(raw, &chain)
+	}
+	genesis, err := hexutil.Decode(chain.Genesis)
+	if err != nil || chain.Config == nil {
+		return [4]byte{}, 0, ErrForkIDUnavailable
+	}
+	head, err := n.BlockNumber(ctx)
+	if err != nil {
+		return [4]byte{}, 0, err
+	}
+	hash, next := computeForkID(genesis, gatherForks(chain.Config), head)
+	return hash, next, nil
+}
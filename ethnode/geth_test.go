@@ -0,0 +1,60 @@
+package ethnode
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestGethDisconnectPeer(t *testing.T) {
+	admin := &MockAdmin{}
+	client := mockNode(t, &MockEth{}, admin)
+	defer client.Close()
+	node := &gethNode{client: client}
+	ctx := context.Background()
+
+	if err := node.AddTrustedPeer(ctx, "aaaa"); err != nil {
+		t.Fatal(err)
+	}
+	if err := node.ConnectPeer(ctx, "enode://bbbb@10.0.0.2:30303"); err != nil {
+		t.Fatal(err)
+	}
+	for _, nodeID := range []string{"aaaa", "bbbb"} {
+		if err := node.DisconnectPeer(ctx, nodeID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Disconnecting leaves the trusted set alone, but stops redialing.
+	if want := map[string]bool{"aaaa": true}; !reflect.DeepEqual(admin.trusted, want) {
+		t.Errorf("trusted: got %v; want %v", admin.trusted, want)
+	}
+	if len(admin.static) != 0 {
+		t.Errorf("static: got %v; want empty", admin.static)
+	}
+
+	if err := node.RemoveTrustedPeer(ctx, "aaaa"); err != nil {
+		t.Fatal(err)
+	}
+	if len(admin.trusted) != 0 {
+		t.Errorf("trusted: got %v; want empty", admin.trusted)
+	}
+}
+
+func TestManagedDisconnectPeer(t *testing.T) {
+	admin := &MockAdmin{}
+	client := mockNode(t, &MockEth{}, admin)
+	defer client.Close()
+	node := Managed(&gethNode{client: client})
+	ctx := context.Background()
+
+	if err := node.AddTrustedPeer(ctx, "aaaa"); err != nil {
+		t.Fatal(err)
+	}
+	if err := node.DisconnectPeer(ctx, "aaaa"); err != nil {
+		t.Fatal(err)
+	}
+	if !node.IsManagedPeer("aaaa") || !admin.trusted["aaaa"] {
+		t.Errorf("disconnected peer should still be trusted and managed")
+	}
+}
@@ -0,0 +1,71 @@
+package ethnode
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// headCache keeps the latest block from an eth_subscribe newHeads
+// subscription, so that frequent BlockNumber and LatestBlock polling doesn't
+// need an RPC call each time. A nil headCache is valid and never has a block.
+type headCache struct {
+	mu        sync.Mutex
+	ok        bool
+	number    uint64
+	timestamp time.Time
+}
+
+// subscribeHeads subscribes to the node's new block headers. It fails if the
+// transport doesn't support subscriptions (such as HTTP) or the node doesn't
+// support newHeads. The subscription ends when subs or the client is closed.
+func subscribeHeads(ctx context.Context, client *rpc.Client, subs *subscriptions) (*headCache, error) {
+	headCh := make(chan json.RawMessage, 1)
+	c := &headCache{}
+	serve := func(sub *rpc.ClientSubscription) {
+		c.serve(sub, headCh)
+	}
+	if err := subs.subscribe(ctx, context.Background(), client, headCh, serve, "newHeads"); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *headCache) serve(sub *rpc.ClientSubscription, headCh <-chan json.RawMessage) {
+	for {
+		select {
+		case raw := <-headCh:
+			number, timestamp, err := parseBlockHeader(raw)
+			if err != nil {
+				logger.Printf("Failed to parse newHeads header: %s", err)
+				continue
+			}
+			c.mu.Lock()
+			c.ok, c.number, c.timestamp = true, number, timestamp
+			c.mu.Unlock()
+		case err := <-sub.Err():
+			// Fall back to polling.
+			c.mu.Lock()
+			c.ok = false
+			c.mu.Unlock()
+			if err != nil {
+				logger.Printf("Lost newHeads subscription, polling for blocks instead: %s", err)
+			}
+			return
+		}
+	}
+}
+
+// Latest returns the latest block received, if the subscription is active and
+// has received one.
+func (c *headCache) Latest() (number uint64, timestamp time.Time, ok bool) {
+	if c == nil {
+		return 0, time.Time{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.number, c.timestamp, c.ok
+}
@@ -0,0 +1,143 @@
+package ethnode
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// MockHeadsEth is an eth service which supports newHeads subscriptions and
+// counts eth_blockNumber calls.
+type MockHeadsEth struct {
+	MockEth
+	blockNumberCalls int32
+	heads            []map[string]string
+}
+
+func (s *MockHeadsEth) BlockNumber() string {
+	atomic.AddInt32(&s.blockNumberCalls, 1)
+	return "0x2a"
+}
+
+func (s *MockHeadsEth) NewHeads(ctx context.Context) (*rpc.Subscription, error) {
+	notifier, ok := rpc.NotifierFromContext(ctx)
+	if !ok {
+		return nil, rpc.ErrNotificationsUnsupported
+	}
+	sub := notifier.CreateSubscription()
+	for _, head := range s.heads {
+		notifier.Notify(sub.ID, head)
+	}
+	return sub, nil
+}
+
+func mockHeadsNode(t *testing.T, eth *MockHeadsEth) *rpc.Client {
+	server := rpc.NewServer()
+	if err := server.RegisterName("eth", eth); err != nil {
+		t.Fatal(err)
+	}
+	return rpc.DialInProc(server)
+}
+
+func TestBlockNumberSubscribed(t *testing.T) {
+	eth := &MockHeadsEth{heads: []map[string]string{
+		{"number": "0x63", "timestamp": "0x5c3a8f4e"},
+		{"number": "0x64", "timestamp": "0x5c3a8f5d"},
+	}}
+	client := mockHeadsNode(t, eth)
+	defer client.Close()
+
+	heads, err := subscribeHeads(context.Background(), client, &subscriptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	node := &gethNode{client: client, heads: heads}
+
+	// Wait for the subscription to deliver the latest header.
+	deadline := time.Now().Add(time.Second)
+	for {
+		if number, _, ok := heads.Latest(); ok && number == 100 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for newHeads")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	number, err := node.BlockNumber(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if number != 100 {
+		t.Errorf("wrong block number: %d", number)
+	}
+	number, timestamp, err := node.LatestBlock(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if number != 100 || timestamp.Unix() != 0x5c3a8f5d {
+		t.Errorf("wrong latest block: %d at %s", number, timestamp)
+	}
+	if calls := atomic.LoadInt32(&eth.blockNumberCalls); calls != 0 {
+		t.Errorf("expected no eth_blockNumber calls while subscribed, got %d", calls)
+	}
+}
+
+func TestBlockNumberPolling(t *testing.T) {
+	// mockNode has no newHeads subscription.
+	client := mockNode(t, &MockEth{}, &MockAdmin{})
+	defer client.Close()
+
+	heads, err := subscribeHeads(context.Background(), client, &subscriptions{})
+	if err == nil {
+		t.Fatal("expected subscription to fail")
+	}
+	node := &gethNode{client: client, heads: heads}
+	number, err := node.BlockNumber(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if number != 42 {
+		t.Errorf("wrong block number: %d", number)
+	}
+}
+
+func BenchmarkBlockNumber(b *testing.B) {
+	eth := &MockHeadsEth{heads: []map[string]string{{"number": "0x64", "timestamp": "0x5c3a8f5d"}}}
+	server := rpc.NewServer()
+	if err := server.RegisterName("eth", eth); err != nil {
+		b.Fatal(err)
+	}
+	client := rpc.DialInProc(server)
+	defer client.Close()
+
+	b.Run("Polling", func(b *testing.B) {
+		node := &gethNode{client: client}
+		for i := 0; i < b.N; i++ {
+			if _, err := node.BlockNumber(context.Background()); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("Subscribed", func(b *testing.B) {
+		heads, err := subscribeHeads(context.Background(), client, &subscriptions{})
+		if err != nil {
+			b.Fatal(err)
+		}
+		for _, _, ok := heads.Latest(); !ok; _, _, ok = heads.Latest() {
+			time.Sleep(time.Millisecond)
+		}
+		node := &gethNode{client: client, heads: heads}
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if _, err := node.BlockNumber(context.Background()); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
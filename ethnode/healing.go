@@ -0,0 +1,32 @@
+package ethnode
+
+import (
+	"context"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// healingFields are the eth_syncing fields that Geth reports during snap
+// sync, which count the trie nodes and bytecodes still pending healing.
+var healingFields = []string{"healingTrienodes", "healingBytecode"}
+
+// ethHealing is the IsHealing implementation shared by node kinds. Nodes
+// which don't snap sync never report the healing fields, so they're never
+// healing.
+func ethHealing(ctx context.Context, client *rpc.Client) (bool, error) {
+	// eth_syncing returns false when sync'd, or a sync status object.
+	var syncing interface{}
+	if err := call(ctx, client, &syncing, "eth_syncing"); err != nil {
+		return false, err
+	}
+	status, ok := syncing.(map[string]interface{})
+	if !ok {
+		return false, nil
+	}
+	for _, field := range healingFields {
+		if parseQuantity(status[field]) > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
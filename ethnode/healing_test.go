@@ -0,0 +1,74 @@
+package ethnode
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+// snapSyncHealing is an eth_syncing response from Geth while it heals the
+// state after downloading it with snap sync.
+const snapSyncHealing = `{
+	"currentBlock": "0xe3b3d0",
+	"highestBlock": "0xe3b3d5",
+	"startingBlock": "0xe3a1a5",
+	"syncedAccounts": "0x9a4ce54",
+	"syncedAccountBytes": "0x4f3b4e6b5f",
+	"syncedBytecodes": "0x7a6d3",
+	"syncedBytecodeBytes": "0x3ab9a1b2c",
+	"syncedStorage": "0x1d8ad1a3e",
+	"syncedStorageBytes": "0x1bc8e3c2a41",
+	"healedTrienodes": "0x51a3d",
+	"healedTrienodeBytes": "0x1b0ac3a",
+	"healedBytecodes": "0x1f6",
+	"healedBytecodeBytes": "0x2b7a34",
+	"healingTrienodes": "0x1c4",
+	"healingBytecode": "0x0"
+}`
+
+// snapSyncDownloading is an eth_syncing response from Geth while it's still
+// downloading the state, before healing.
+const snapSyncDownloading = `{
+	"currentBlock": "0xe3b3d0",
+	"highestBlock": "0xe3b3d5",
+	"startingBlock": "0xe3a1a5",
+	"syncedAccounts": "0x9a4ce54",
+	"healedTrienodes": "0x0",
+	"healingTrienodes": "0x0",
+	"healingBytecode": "0x0"
+}`
+
+func TestIsHealing(t *testing.T) {
+	parse := func(payload string) interface{} {
+		var status map[string]interface{}
+		if err := json.Unmarshal([]byte(payload), &status); err != nil {
+			t.Fatal(err)
+		}
+		return status
+	}
+
+	testcases := []struct {
+		name    string
+		syncing interface{}
+		want    bool
+	}{
+		{"synced", false, false},
+		{"healing trie nodes", parse(snapSyncHealing), true},
+		{"healing bytecode", map[string]interface{}{"currentBlock": "0x1", "healingTrienodes": "0x0", "healingBytecode": "0x3"}, true},
+		{"downloading state", parse(snapSyncDownloading), false},
+		{"full sync", map[string]interface{}{"currentBlock": "0x1", "highestBlock": "0x2a"}, false},
+	}
+	for _, tc := range testcases {
+		client := serveMocks(t, map[string]interface{}{"eth": &MockEth{syncing: tc.syncing}})
+		for _, node := range []EthNode{&gethNode{client: client}, &parityNode{client: client}} {
+			healing, err := node.IsHealing(context.Background())
+			if err != nil {
+				t.Fatalf("%s: %s", tc.name, err)
+			}
+			if healing != tc.want {
+				t.Errorf("%s: %s got healing %t; want %t", tc.name, node.Kind(), healing, tc.want)
+			}
+		}
+		client.Close()
+	}
+}
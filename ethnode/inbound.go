@@ -0,0 +1,40 @@
+package ethnode
+
+import (
+	"context"
+	"net"
+)
+
+// InboundPeers returns the connected peers of node which dialed it, such as
+// for spotting connection floods.
+func InboundPeers(ctx context.Context, node EthNode) ([]PeerInfo, error) {
+	peers, err := node.Peers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	inbound := make([]PeerInfo, 0, len(peers))
+	for _, peer := range peers {
+		if peer.Inbound {
+			inbound = append(inbound, peer)
+		}
+	}
+	return inbound, nil
+}
+
+// CountByIP returns the number of peers for each remote IP, to detect a single
+// source opening many connections. Peers without a remote address are skipped.
+func CountByIP(peers []PeerInfo) map[string]int {
+	count := map[string]int{}
+	for _, peer := range peers {
+		if peer.RemoteAddress == "" {
+			continue
+		}
+		ip, _, err := net.SplitHostPort(peer.RemoteAddress)
+		if err != nil {
+			// Not a host:port, count the address as is.
+			ip = peer.RemoteAddress
+		}
+		count[ip]++
+	}
+	return count
+}
@@ -0,0 +1,60 @@
+package ethnode
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// staticPeersNode is a fake EthNode which returns a fixed set of peers.
+type staticPeersNode struct {
+	EthNode
+	peers []PeerInfo
+}
+
+func (n *staticPeersNode) Peers(ctx context.Context) ([]PeerInfo, error) {
+	return n.peers, nil
+}
+
+func TestPeerInfoNetwork(t *testing.T) {
+	var peers []PeerInfo
+	if err := json.Unmarshal(adminPeersPayload(2), &peers); err != nil {
+		t.Fatal(err)
+	}
+	if !peers[0].Inbound || peers[1].Inbound {
+		t.Errorf("wrong inbound flags: %+v", peers)
+	}
+	if peers[1].RemoteAddress != "10.0.0.1:30303" {
+		t.Errorf("wrong remote address: %q", peers[1].RemoteAddress)
+	}
+	if len(peers[0].Caps) != 4 || peers[0].Name == "" {
+		t.Errorf("peer fields were not decoded: %+v", peers[0])
+	}
+}
+
+func TestInboundPeers(t *testing.T) {
+	node := &staticPeersNode{peers: []PeerInfo{
+		{ID: "a", Inbound: true, RemoteAddress: "10.0.0.1:41000"},
+		{ID: "b", Inbound: false, RemoteAddress: "10.0.0.2:30303"},
+		{ID: "c", Inbound: true, RemoteAddress: "10.0.0.1:41001"},
+		{ID: "d", Inbound: true, RemoteAddress: "[2001:db8::1]:41000"},
+		{ID: "e", Inbound: true},
+	}}
+	peers, err := InboundPeers(context.Background(), node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, peer := range peers {
+		ids = append(ids, peer.ID)
+	}
+	if want := []string{"a", "c", "d", "e"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("got %q; want %q", ids, want)
+	}
+
+	want := map[string]int{"10.0.0.1": 2, "2001:db8::1": 1}
+	if got := CountByIP(peers); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v; want %v", got, want)
+	}
+}
@@ -0,0 +1,60 @@
+package ethnode
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// IPCNotFoundError is returned by FindIPC when none of the paths accept a
+// connection.
+type IPCNotFoundError struct {
+	Paths []string
+}
+
+func (err IPCNotFoundError) Error() string {
+	return fmt.Sprintf("no reachable IPC endpoint, tried: %s", strings.Join(err.Paths, ", "))
+}
+
+// IPCPaths returns the standard Geth and Parity IPC endpoints for the given OS
+// (such as runtime.GOOS) and home directory, in the order they should be
+// tried.
+func IPCPaths(home string, goos string) []string {
+	if goos == "windows" {
+		// Named pipes don't live in the datadir.
+		return []string{`\\.\pipe\geth.ipc`, `\\.\pipe\jsonrpc.ipc`}
+	}
+
+	var gethDir, parityDir string
+	switch goos {
+	case "darwin":
+		gethDir = filepath.Join(home, "Library", "Ethereum")
+		parityDir = filepath.Join(home, "Library", "Application Support", "io.parity.ethereum")
+	default:
+		gethDir = filepath.Join(home, ".ethereum")
+		parityDir = filepath.Join(home, ".local", "share", "io.parity.ethereum")
+	}
+	return []string{
+		filepath.Join(gethDir, "geth.ipc"),
+		filepath.Join(gethDir, "testnet", "geth.ipc"),
+		filepath.Join(gethDir, "rinkeby", "geth.ipc"),
+		filepath.Join(parityDir, "jsonrpc.ipc"),
+	}
+}
+
+// FindIPC returns the first of paths that accepts an IPC connection, or an
+// IPCNotFoundError if none do.
+func FindIPC(ctx context.Context, paths []string) (string, error) {
+	for _, path := range paths {
+		client, err := rpc.DialIPC(ctx, path)
+		if err != nil {
+			continue
+		}
+		client.Close()
+		return path, nil
+	}
+	return "", IPCNotFoundError{Paths: paths}
+}
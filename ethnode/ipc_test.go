@@ -0,0 +1,56 @@
+package ethnode
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFindIPC(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vipnodetest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	missing := filepath.Join(dir, "missing.ipc")
+	path := filepath.Join(dir, "geth.ipc")
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Skipf("unix sockets not supported: %s", err)
+	}
+	defer listener.Close()
+
+	ctx := context.Background()
+	got, err := FindIPC(ctx, []string{missing, path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != path {
+		t.Errorf("got %q; want %q", got, path)
+	}
+
+	_, err = FindIPC(ctx, []string{missing})
+	if err, ok := err.(IPCNotFoundError); !ok {
+		t.Errorf("expected IPCNotFoundError, got: %v", err)
+	} else if !reflect.DeepEqual(err.Paths, []string{missing}) {
+		t.Errorf("wrong probed paths: %q", err.Paths)
+	}
+}
+
+func TestIPCPaths(t *testing.T) {
+	paths := IPCPaths("/home/foo", "linux")
+	if paths[0] != "/home/foo/.ethereum/geth.ipc" {
+		t.Errorf("geth IPC should be tried first: %q", paths)
+	}
+	if last := paths[len(paths)-1]; last != "/home/foo/.local/share/io.parity.ethereum/jsonrpc.ipc" {
+		t.Errorf("wrong parity IPC path: %q", last)
+	}
+	if paths := IPCPaths("/home/foo", "windows"); paths[0] != `\\.\pipe\geth.ipc` {
+		t.Errorf("wrong windows IPC path: %q", paths)
+	}
+}
@@ -0,0 +1,296 @@
+package ethnode
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultRefreshInterval is how long Refresh waits before re-adding the same
+// managed peer again, unless RefreshInterval is set.
+const DefaultRefreshInterval = 10 * time.Minute
+
+// Managed wraps an EthNode to keep track of the peers that were added as
+// trusted peers through it, such as by vipnode, as opposed to peers that
+// connected organically.
+func Managed(node EthNode) *ManagedNode {
+	return &ManagedNode{
+		EthNode:   node,
+		managed:   map[string]struct{}{},
+		refreshed: map[string]time.Time{},
+	}
+}
+
+// ManagedNode is an EthNode which tracks its trusted peers. Peers returned by
+// Peers and PeersLite have the Managed field set.
+type ManagedNode struct {
+	EthNode
+
+	// PeersFile is the path of a Geth trusted-nodes.json file to keep in sync
+	// with the managed peers, so that the node still trusts them after it
+	// restarts. Any other entries in the file are treated as managed peers by
+	// Reconcile. (Optional)
+	PeersFile string
+
+	// RefreshLimit is the most peers that a single Refresh re-adds, to avoid
+	// a storm of calls after the node drops many of them. (Unlimited if 0)
+	RefreshLimit int
+	// RefreshInterval overrides DefaultRefreshInterval. (Optional)
+	RefreshInterval time.Duration
+
+	mu        sync.Mutex
+	managed   map[string]struct{}
+	refreshed map[string]time.Time
+	fileMu    sync.Mutex
+	// setMu serializes SetTrustedPeers.
+	setMu sync.Mutex
+}
+
+// AddTrustedPeer adds nodeID as a trusted peer and tracks it as managed.
+func (n *ManagedNode) AddTrustedPeer(ctx context.Context, nodeID string) error {
+	if err := n.EthNode.AddTrustedPeer(ctx, nodeID); err != nil {
+		return err
+	}
+	n.mu.Lock()
+	n.managed[nodeID] = struct{}{}
+	n.mu.Unlock()
+	n.persist()
+	return nil
+}
+
+// RemoveTrustedPeer removes nodeID from the trusted peers and stops tracking
+// it as managed.
+func (n *ManagedNode) RemoveTrustedPeer(ctx context.Context, nodeID string) error {
+	if err := n.EthNode.RemoveTrustedPeer(ctx, nodeID); err != nil {
+		return err
+	}
+	n.mu.Lock()
+	delete(n.managed, nodeID)
+	delete(n.refreshed, nodeID)
+	n.mu.Unlock()
+	n.persist()
+	return nil
+}
+
+// TrustedPeerChange is a change to the trusted peers made by SetTrustedPeers.
+type TrustedPeerChange struct {
+	NodeID string
+	Remove bool
+}
+
+func (c TrustedPeerChange) String() string {
+	if c.Remove {
+		return fmt.Sprintf("remove %q", c.NodeID)
+	}
+	return fmt.Sprintf("add %q", c.NodeID)
+}
+
+// apply makes the change on node, or reverts it if undo is set.
+func (c TrustedPeerChange) apply(ctx context.Context, node EthNode, undo bool) error {
+	if c.Remove == undo {
+		return node.AddTrustedPeer(ctx, c.NodeID)
+	}
+	return node.RemoveTrustedPeer(ctx, c.NodeID)
+}
+
+// SetTrustedPeers replaces the managed peers with nodeIDs, adding the missing
+// ones and removing the others. Peers are added before any are removed, so
+// that the node is never short of the peers it's meant to keep. If a change
+// fails, the ones applied before it are rolled back and a TrustedPeersError
+// reports which change failed and any which couldn't be rolled back. The
+// managed peers always match the changes that the node has.
+func (n *ManagedNode) SetTrustedPeers(ctx context.Context, nodeIDs []string) error {
+	n.setMu.Lock()
+	defer n.setMu.Unlock()
+
+	want := make(map[string]struct{}, len(nodeIDs))
+	for _, nodeID := range nodeIDs {
+		want[nodeID] = struct{}{}
+	}
+	var adds, removes []TrustedPeerChange
+	n.mu.Lock()
+	for nodeID := range want {
+		if _, ok := n.managed[nodeID]; !ok {
+			adds = append(adds, TrustedPeerChange{NodeID: nodeID})
+		}
+	}
+	for nodeID := range n.managed {
+		if _, ok := want[nodeID]; !ok {
+			removes = append(removes, TrustedPeerChange{NodeID: nodeID, Remove: true})
+		}
+	}
+	n.mu.Unlock()
+	if len(adds) == 0 && len(removes) == 0 {
+		return nil
+	}
+	byID := func(changes []TrustedPeerChange) {
+		sort.Slice(changes, func(i, j int) bool { return changes[i].NodeID < changes[j].NodeID })
+	}
+	byID(adds)
+	byID(removes)
+	changes := append(adds, removes...)
+
+	defer n.persist()
+	for i, change := range changes {
+		err := change.apply(ctx, n.EthNode, false)
+		if err == nil {
+			n.track(change)
+			continue
+		}
+		setErr := TrustedPeersError{Failed: change, Err: err}
+		// Undo the applied changes, latest first.
+		for j := i - 1; j >= 0; j-- {
+			applied := changes[j]
+			if err := applied.apply(ctx, n.EthNode, true); err != nil {
+				if setErr.Stuck == nil {
+					setErr.Stuck = map[TrustedPeerChange]error{}
+				}
+				setErr.Stuck[applied] = err
+				continue
+			}
+			n.track(TrustedPeerChange{NodeID: applied.NodeID, Remove: !applied.Remove})
+			setErr.RolledBack = append(setErr.RolledBack, applied)
+		}
+		return setErr
+	}
+	return nil
+}
+
+// track updates the managed peers after change was made on the node.
+func (n *ManagedNode) track(change TrustedPeerChange) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if change.Remove {
+		delete(n.managed, change.NodeID)
+		delete(n.refreshed, change.NodeID)
+	} else {
+		n.managed[change.NodeID] = struct{}{}
+	}
+}
+
+// IsManagedPeer returns whether nodeID was added as a trusted peer through
+// this node, and not removed since.
+func (n *ManagedNode) IsManagedPeer(nodeID string) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	_, ok := n.managed[nodeID]
+	return ok
+}
+
+// ManagedPeers returns the sorted node IDs of the managed peers, whether or
+// not they are connected.
+func (n *ManagedNode) ManagedPeers() []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	r := make([]string, 0, len(n.managed))
+	for nodeID := range n.managed {
+		r = append(r, nodeID)
+	}
+	sort.Strings(r)
+	return r
+}
+
+// Refresh re-adds the managed peers which aren't connected as trusted peers,
+// in case the node forgot them, such as after it restarted. Geth doesn't list
+// its trusted peers over RPC, so any disconnected peer could be a forgotten
+// one. Each peer is re-added at most once per RefreshInterval, and at most
+// RefreshLimit peers per call. It returns the re-added node IDs.
+func (n *ManagedNode) Refresh(ctx context.Context) ([]string, error) {
+	peers, err := n.EthNode.PeersLite(ctx)
+	if err != nil {
+		return nil, err
+	}
+	connected := make(map[string]struct{}, len(peers))
+	for _, peer := range peers {
+		connected[peer.ID] = struct{}{}
+	}
+	interval := n.RefreshInterval
+	if interval == 0 {
+		interval = DefaultRefreshInterval
+	}
+
+	now := time.Now()
+	var stale []string
+	lastRefreshed := map[string]time.Time{}
+	n.mu.Lock()
+	for nodeID := range n.managed {
+		if _, ok := connected[nodeID]; ok {
+			continue
+		}
+		if now.Sub(n.refreshed[nodeID]) < interval {
+			continue
+		}
+		stale = append(stale, nodeID)
+		lastRefreshed[nodeID] = n.refreshed[nodeID]
+	}
+	n.mu.Unlock()
+	// Peers which were refreshed longest ago go first, so that the limit
+	// doesn't starve any of them.
+	sort.Slice(stale, func(i, j int) bool {
+		ti, tj := lastRefreshed[stale[i]], lastRefreshed[stale[j]]
+		if !ti.Equal(tj) {
+			return ti.Before(tj)
+		}
+		return stale[i] < stale[j]
+	})
+	if n.RefreshLimit > 0 && len(stale) > n.RefreshLimit {
+		stale = stale[:n.RefreshLimit]
+	}
+
+	readded := make([]string, 0, len(stale))
+	for _, nodeID := range stale {
+		if err := n.EthNode.AddTrustedPeer(ctx, nodeID); err != nil {
+			return readded, err
+		}
+		n.mu.Lock()
+		n.refreshed[nodeID] = now
+		n.mu.Unlock()
+		readded = append(readded, nodeID)
+	}
+	return readded, nil
+}
+
+func (n *ManagedNode) tag(peers []PeerInfo) []PeerInfo {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for i := range peers {
+		_, peers[i].Managed = n.managed[peers[i].ID]
+	}
+	return peers
+}
+
+// Peers returns the connected peers, tagged with whether they're managed.
+func (n *ManagedNode) Peers(ctx context.Context) ([]PeerInfo, error) {
+	peers, err := n.EthNode.Peers(ctx)
+	if err != nil && !IsPartialPeers(err) {
+		return nil, err
+	}
+	return n.tag(peers), err
+}
+
+// PeerSlots returns the node's peer slots, counting at least the managed peers
+// as reserved.
+func (n *ManagedNode) PeerSlots(ctx context.Context) (max, used, reserved int, err error) {
+	max, used, reserved, err = n.EthNode.PeerSlots(ctx)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	n.mu.Lock()
+	if len(n.managed) > reserved {
+		reserved = len(n.managed)
+	}
+	n.mu.Unlock()
+	return max, used, reserved, nil
+}
+
+// PeersLite returns the connected peers with only the ID, Name and Managed
+// fields set.
+func (n *ManagedNode) PeersLite(ctx context.Context) ([]PeerInfo, error) {
+	peers, err := n.EthNode.PeersLite(ctx)
+	if err != nil && !IsPartialPeers(err) {
+		return nil, err
+	}
+	return n.tag(peers), err
+}
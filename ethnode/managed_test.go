@@ -0,0 +1,320 @@
+package ethnode
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// peersNode is a fake EthNode where every peer is connected.
+type peersNode struct {
+	EthNode
+	peers   []PeerInfo
+	failAdd bool
+	added   []string
+}
+
+func (n *peersNode) AddTrustedPeer(ctx context.Context, nodeID string) error {
+	if n.failAdd {
+		return errors.New("add failed")
+	}
+	n.added = append(n.added, nodeID)
+	return nil
+}
+
+func (n *peersNode) RemoveTrustedPeer(ctx context.Context, nodeID string) error {
+	return nil
+}
+
+func (n *peersNode) Peers(ctx context.Context) ([]PeerInfo, error) {
+	return append([]PeerInfo{}, n.peers...), nil
+}
+
+func (n *peersNode) PeerSlots(ctx context.Context) (max, used, reserved int, err error) {
+	return 25, len(n.peers), 1, nil
+}
+
+func (n *peersNode) PeersLite(ctx context.Context) ([]PeerInfo, error) {
+	return n.Peers(ctx)
+}
+
+func TestManagedNode(t *testing.T) {
+	ctx := context.Background()
+	fake := &peersNode{peers: []PeerInfo{{ID: "client1"}, {ID: "organic"}, {ID: "client2"}}}
+	node := Managed(fake)
+
+	managed := func(getPeers func(context.Context) ([]PeerInfo, error)) []string {
+		t.Helper()
+		peers, err := getPeers(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := []string{}
+		for _, peer := range peers {
+			if peer.Managed != node.IsManagedPeer(peer.ID) {
+				t.Errorf("inconsistent managed tag for %q", peer.ID)
+			}
+			if peer.Managed {
+				r = append(r, peer.ID)
+			}
+		}
+		return r
+	}
+
+	if got := managed(node.Peers); len(got) != 0 {
+		t.Errorf("expected no managed peers, got: %v", got)
+	}
+
+	for _, nodeID := range []string{"client1", "client2"} {
+		if err := node.AddTrustedPeer(ctx, nodeID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, want := managed(node.Peers), []string{"client1", "client2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("managed peers: got %v; want %v", got, want)
+	}
+	if node.IsManagedPeer("organic") {
+		t.Error("organic peer is managed")
+	}
+
+	if err := node.RemoveTrustedPeer(ctx, "client1"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := managed(node.PeersLite), []string{"client2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("managed peers after remove: got %v; want %v", got, want)
+	}
+
+	// Re-adding a removed peer makes it managed again, but failed adds don't
+	if err := node.AddTrustedPeer(ctx, "client1"); err != nil {
+		t.Fatal(err)
+	}
+	fake.failAdd = true
+	if err := node.AddTrustedPeer(ctx, "organic"); err == nil {
+		t.Fatal("expected error")
+	}
+	if got, want := node.ManagedPeers(), []string{"client1", "client2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("managed peers: got %v; want %v", got, want)
+	}
+}
+
+func TestManagedPeerSlots(t *testing.T) {
+	ctx := context.Background()
+	node := Managed(&peersNode{peers: []PeerInfo{{ID: "client1"}, {ID: "client2"}, {ID: "organic"}}})
+
+	// Reserved slots reported by the node are kept until we manage more
+	check := func(wantReserved int) {
+		t.Helper()
+		max, used, reserved, err := node.PeerSlots(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if max != 25 || used != 3 || reserved != wantReserved {
+			t.Errorf("got max=%d used=%d reserved=%d; want reserved=%d", max, used, reserved, wantReserved)
+		}
+	}
+	check(1)
+	node.AddTrustedPeer(ctx, "client1")
+	check(1)
+	node.AddTrustedPeer(ctx, "client2")
+	check(2)
+	node.RemoveTrustedPeer(ctx, "client2")
+	check(1)
+}
+
+func TestManagedNodeRefresh(t *testing.T) {
+	ctx := context.Background()
+	fake := &peersNode{}
+	node := Managed(fake)
+	node.RefreshLimit = 2
+	for _, nodeID := range []string{"a", "b", "c", "d"} {
+		if err := node.AddTrustedPeer(ctx, nodeID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The node restarted and dropped its trusted peers, and only b and an
+	// organic peer reconnected.
+	fake.peers = []PeerInfo{{ID: "b"}, {ID: "organic"}}
+	fake.added = nil
+
+	readded, err := node.Refresh(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a", "c"}; !reflect.DeepEqual(readded, want) {
+		t.Errorf("first refresh: got %v; want %v", readded, want)
+	}
+	// Limited to 2 per call, the rest are re-added next time, and the ones
+	// just re-added wait for the interval.
+	readded, err = node.Refresh(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"d"}; !reflect.DeepEqual(readded, want) {
+		t.Errorf("second refresh: got %v; want %v", readded, want)
+	}
+	readded, err = node.Refresh(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(readded) != 0 {
+		t.Errorf("expected no re-adds within the interval, got %v", readded)
+	}
+	if want := []string{"a", "c", "d"}; !reflect.DeepEqual(fake.added, want) {
+		t.Errorf("trusted peers added to the node: got %v; want %v", fake.added, want)
+	}
+
+	// Once the interval passes, the oldest refreshed peers go first.
+	node.mu.Lock()
+	for nodeID := range node.refreshed {
+		node.refreshed[nodeID] = node.refreshed[nodeID].Add(-DefaultRefreshInterval)
+	}
+	node.refreshed["d"] = node.refreshed["d"].Add(-time.Minute)
+	node.mu.Unlock()
+	readded, err = node.Refresh(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"d", "a"}; !reflect.DeepEqual(readded, want) {
+		t.Errorf("refresh after the interval: got %v; want %v", readded, want)
+	}
+
+	// Removed peers are no longer refreshed.
+	if err := node.RemoveTrustedPeer(ctx, "c"); err != nil {
+		t.Fatal(err)
+	}
+	node.RefreshInterval = time.Nanosecond
+	readded, err = node.Refresh(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a", "d"}; !reflect.DeepEqual(readded, want) {
+		t.Errorf("refresh after removing a peer: got %v; want %v", readded, want)
+	}
+}
+
+// trustNode is a fake EthNode which keeps a set of trusted peers, and fails
+// to add or remove the given ones.
+type trustNode struct {
+	EthNode
+	trusted    map[string]bool
+	failAdd    map[string]bool
+	failRemove map[string]bool
+	calls      []string
+}
+
+func (n *trustNode) AddTrustedPeer(ctx context.Context, nodeID string) error {
+	n.calls = append(n.calls, "add "+nodeID)
+	if n.failAdd[nodeID] {
+		return errors.New("add failed")
+	}
+	n.trusted[nodeID] = true
+	return nil
+}
+
+func (n *trustNode) RemoveTrustedPeer(ctx context.Context, nodeID string) error {
+	n.calls = append(n.calls, "remove "+nodeID)
+	if n.failRemove[nodeID] {
+		return errors.New("remove failed")
+	}
+	delete(n.trusted, nodeID)
+	return nil
+}
+
+func TestSetTrustedPeers(t *testing.T) {
+	ctx := context.Background()
+	fake := &trustNode{trusted: map[string]bool{}, failAdd: map[string]bool{}, failRemove: map[string]bool{}}
+	node := Managed(fake)
+
+	// Adding to an empty set.
+	if err := node.SetTrustedPeers(ctx, []string{"b", "a", "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := node.ManagedPeers(), []string{"a", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("managed peers: got %v; want %v", got, want)
+	}
+	if want := []string{"add a", "add b"}; !reflect.DeepEqual(fake.calls, want) {
+		t.Errorf("calls: got %v; want %v", fake.calls, want)
+	}
+
+	// Only the difference is applied, adds before removes.
+	fake.calls = nil
+	if err := node.SetTrustedPeers(ctx, []string{"b", "c"}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := node.ManagedPeers(), []string{"b", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("managed peers: got %v; want %v", got, want)
+	}
+	if want := []string{"add c", "remove a"}; !reflect.DeepEqual(fake.calls, want) {
+		t.Errorf("calls: got %v; want %v", fake.calls, want)
+	}
+
+	// Removing everything.
+	fake.calls = nil
+	if err := node.SetTrustedPeers(ctx, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := node.ManagedPeers(); len(got) != 0 {
+		t.Errorf("expected no managed peers, got %v", got)
+	}
+	if len(fake.trusted) != 0 {
+		t.Errorf("expected no trusted peers on the node, got %v", fake.trusted)
+	}
+	if err := node.SetTrustedPeers(ctx, nil); err != nil || len(fake.calls) != 2 {
+		t.Errorf("expected no changes for the same set, got %v, %v", fake.calls, err)
+	}
+}
+
+func TestSetTrustedPeersRollback(t *testing.T) {
+	ctx := context.Background()
+	fake := &trustNode{trusted: map[string]bool{}, failAdd: map[string]bool{}, failRemove: map[string]bool{}}
+	node := Managed(fake)
+	if err := node.SetTrustedPeers(ctx, []string{"a", "b"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Removing "a" fails after "c" and "d" were added, so they're rolled
+	// back.
+	fake.calls = nil
+	fake.failRemove["a"] = true
+	err := node.SetTrustedPeers(ctx, []string{"b", "c", "d"})
+	setErr, ok := err.(TrustedPeersError)
+	if !ok {
+		t.Fatalf("expected TrustedPeersError, got: %v", err)
+	}
+	if want := (TrustedPeerChange{NodeID: "a", Remove: true}); setErr.Failed != want {
+		t.Errorf("got failed change %s; want %s", setErr.Failed, want)
+	}
+	if want := []TrustedPeerChange{{NodeID: "d"}, {NodeID: "c"}}; !reflect.DeepEqual(setErr.RolledBack, want) || len(setErr.Stuck) != 0 {
+		t.Errorf("got rolled back %v, stuck %v; want rolled back %v", setErr.RolledBack, setErr.Stuck, want)
+	}
+	if want := []string{"add c", "add d", "remove a", "remove d", "remove c"}; !reflect.DeepEqual(fake.calls, want) {
+		t.Errorf("calls: got %v; want %v", fake.calls, want)
+	}
+	if got, want := node.ManagedPeers(), []string{"a", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("managed peers: got %v; want %v", got, want)
+	}
+
+	// If the rollback fails too, the managed peers still match the node.
+	fake.failRemove["c"] = true
+	err = node.SetTrustedPeers(ctx, []string{"b", "c", "d"})
+	setErr, ok = err.(TrustedPeersError)
+	if !ok {
+		t.Fatalf("expected TrustedPeersError, got: %v", err)
+	}
+	if want := map[TrustedPeerChange]error{{NodeID: "c"}: errors.New("remove failed")}; !reflect.DeepEqual(setErr.Stuck, want) {
+		t.Errorf("got stuck changes %v; want %v", setErr.Stuck, want)
+	}
+	if got, want := node.ManagedPeers(), []string{"a", "b", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("managed peers: got %v; want %v", got, want)
+	}
+	for _, nodeID := range node.ManagedPeers() {
+		if !fake.trusted[nodeID] {
+			t.Errorf("managed peer %q is not trusted by the node", nodeID)
+		}
+	}
+	if len(fake.trusted) != 3 {
+		t.Errorf("node trusts other peers than the managed ones: %v", fake.trusted)
+	}
+}
@@ -0,0 +1,46 @@
+package ethnode
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// parseIsPoS parses whether a JSON eth_getBlockByNumber result is a
+// proof-of-stake block. Post-merge blocks have a difficulty of zero, and
+// newer nodes stop reporting the total difficulty once it's frozen, so a
+// block with neither is undetermined.
+func parseIsPoS(raw json.RawMessage) (bool, error) {
+	var header *struct {
+		Difficulty      *hexutil.Big `json:"difficulty"`
+		TotalDifficulty *hexutil.Big `json:"totalDifficulty"`
+	}
+	if err := json.Unmarshal(raw, &header); err != nil {
+		return false, err
+	}
+	if header == nil {
+		return false, errors.New("block not found")
+	}
+	if header.Difficulty != nil {
+		return (*big.Int)(header.Difficulty).Sign() == 0, nil
+	}
+	if header.TotalDifficulty != nil {
+		return false, nil
+	}
+	return false, errors.New("block is missing its difficulty")
+}
+
+// detectPoS returns whether the node's latest block is a proof-of-stake
+// block, in which case the node follows a consensus client rather than
+// producing blocks itself.
+func detectPoS(ctx context.Context, client *rpc.Client) (bool, error) {
+	var raw json.RawMessage
+	if err := call(ctx, client, &raw, "eth_getBlockByNumber", "latest", false); err != nil {
+		return false, err
+	}
+	return parseIsPoS(raw)
+}
@@ -0,0 +1,83 @@
+package ethnode
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestParseIsPoS(t *testing.T) {
+	testcases := []struct {
+		name string
+		raw  string
+		want bool
+		err  bool
+	}{
+		{"pre-merge", `{"difficulty": "0x2ac4d3c7b4b5e", "number": "0xed14f1", "totalDifficulty": "0xc70d815d562d3cfa955"}`, false, false},
+		{"post-merge", `{"difficulty": "0x0", "number": "0xed14f2", "totalDifficulty": "0xc70d815d562d3cfa955"}`, true, false},
+		{"post-merge without total difficulty", `{"difficulty": "0x0", "number": "0x112a880"}`, true, false},
+		{"clique", `{"difficulty": "0x2", "number": "0x3a2c1f"}`, false, false},
+		{"total difficulty only", `{"number": "0x2a", "totalDifficulty": "0x2a"}`, false, false},
+		{"no difficulty", `{"number": "0x2a"}`, false, true},
+		{"missing block", `null`, false, true},
+	}
+	for _, tc := range testcases {
+		got, err := parseIsPoS(json.RawMessage(tc.raw))
+		if tc.err {
+			if err == nil {
+				t.Errorf("%s: expected error", tc.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", tc.name, err)
+		} else if got != tc.want {
+			t.Errorf("%s: got %t; want %t", tc.name, got, tc.want)
+		}
+	}
+}
+
+// MockPoSEth serves a post-merge latest block, and a stale eth_mining like
+// Geth's after the merge.
+type MockPoSEth struct{ MockEth }
+
+func (s *MockPoSEth) GetBlockByNumber(number string, full bool) map[string]string {
+	return map[string]string{"number": "0x112a880", "timestamp": "0x64b6a8f3", "difficulty": "0x0"}
+}
+
+func (s *MockPoSEth) Mining() bool { return false }
+
+func TestDetectPoS(t *testing.T) {
+	// MockEth blocks have no difficulty, so they're undetermined.
+	for _, tc := range []struct {
+		eth  interface{}
+		want bool
+	}{
+		{&MockPoSEth{}, true},
+		{&MockEth{}, false},
+	} {
+		client := serveMocks(t, map[string]interface{}{
+			"eth":  tc.eth,
+			"web3": &MockWeb3{"Geth/v1.13.5-stable/linux-amd64/go1.21.4"},
+			"net":  &MockNet{},
+		})
+		agent, err := detectClient(context.Background(), client)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if agent.IsPoS != tc.want {
+			t.Errorf("%T: got IsPoS %t; want %t", tc.eth, agent.IsPoS, tc.want)
+		}
+		client.Close()
+	}
+}
+
+func TestIsMiningPoS(t *testing.T) {
+	client := serveMocks(t, map[string]interface{}{"eth": &MockPoSEth{}})
+	defer client.Close()
+	for _, node := range []EthNode{&gethNode{client: client, pos: true}, &parityNode{client: client, pos: true}} {
+		if _, err := node.IsMining(context.Background()); err != ErrNotSupported {
+			t.Errorf("%s: expected ErrNotSupported past the merge, got: %v", node.Kind(), err)
+		}
+	}
+}
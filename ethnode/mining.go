@@ -0,0 +1,21 @@
+package ethnode
+
+import (
+	"context"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// ethMining returns whether the node is producing blocks from eth_mining, or
+// ErrNotSupported if the node doesn't provide the method.
+func ethMining(ctx context.Context, client *rpc.Client) (bool, error) {
+	var mining bool
+	err := call(ctx, client, &mining, "eth_mining")
+	if err, ok := err.(RPCError); ok && err.Code == errCodeMethodNotFound {
+		return false, ErrNotSupported
+	}
+	if err != nil {
+		return false, err
+	}
+	return mining, nil
+}
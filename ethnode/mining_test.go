@@ -0,0 +1,35 @@
+package ethnode
+
+import (
+	"context"
+	"testing"
+)
+
+// MockMiningEth is an eth namespace which only has eth_mining.
+type MockMiningEth struct{ mining bool }
+
+func (s *MockMiningEth) Mining() bool { return s.mining }
+
+func TestIsMining(t *testing.T) {
+	for _, want := range []bool{true, false} {
+		client := serveMocks(t, map[string]interface{}{"eth": &MockMiningEth{want}})
+		for _, node := range []EthNode{&gethNode{client: client}, &parityNode{client: client}} {
+			mining, err := node.IsMining(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if mining != want {
+				t.Errorf("%s: got mining %t; want %t", node.Kind(), mining, want)
+			}
+		}
+		client.Close()
+	}
+}
+
+func TestIsMiningUnsupported(t *testing.T) {
+	client := serveMocks(t, map[string]interface{}{"eth": &MockEth{}})
+	defer client.Close()
+	if _, err := (&gethNode{client: client}).IsMining(context.Background()); err != ErrNotSupported {
+		t.Errorf("expected ErrNotSupported without eth_mining, got: %v", err)
+	}
+}
@@ -0,0 +1,152 @@
+package ethnode
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// namespaceProbes are representative read-only methods for each RPC
+// namespace, which are only available if the namespace is enabled (such as
+// with Geth's --http.api flag).
+var namespaceProbes = []struct {
+	namespace string
+	capability
+}{
+	{"eth", capability{"eth_blockNumber", nil}},
+	{"net", capability{"net_version", nil}},
+	{"web3", capability{"web3_clientVersion", nil}},
+	{"admin", capability{"admin_nodeInfo", nil}},
+	{"les", capability{"les_serverInfo", nil}},
+	{"txpool", capability{"txpool_status", nil}},
+	{"parity", capability{"parity_netPeers", nil}},
+	{"trace", capability{"trace_block", []interface{}{"latest"}}},
+}
+
+// kindNamespaces are the RPC namespaces that vipnode needs for each kind of
+// node, and the flag which enables them for that client.
+var kindNamespaces = map[NodeKind]struct {
+	required []string
+	flag     string
+}{
+	Geth:   {[]string{"eth", "net", "admin"}, "--http.api"},
+	Parity: {[]string{"eth", "net", "parity"}, "--jsonrpc-apis"},
+}
+
+// RequiredNamespaces returns the RPC namespaces that vipnode needs for a node
+// of the given kind. Unknown kinds are treated like Geth.
+func RequiredNamespaces(kind NodeKind) []string {
+	if ns, ok := kindNamespaces[kind]; ok {
+		return ns.required
+	}
+	return kindNamespaces[Geth].required
+}
+
+// NamespaceFlag returns the command line flag which enables RPC namespaces
+// for a node of the given kind. Unknown kinds are treated like Geth.
+func NamespaceFlag(kind NodeKind) string {
+	if ns, ok := kindNamespaces[kind]; ok {
+		return ns.flag
+	}
+	return kindNamespaces[Geth].flag
+}
+
+// MissingNamespaces returns the required namespaces for kind which are not
+// enabled in namespaces, as returned by AvailableNamespaces.
+func MissingNamespaces(kind NodeKind, namespaces map[string]bool) []string {
+	var missing []string
+	for _, namespace := range RequiredNamespaces(kind) {
+		if !namespaces[namespace] {
+			missing = append(missing, namespace)
+		}
+	}
+	return missing
+}
+
+// MissingNamespacesError is returned when connecting to a node which doesn't
+// have all of the RPC namespaces required for its kind enabled.
+type MissingNamespacesError struct {
+	Kind    NodeKind
+	Missing []string
+	// Namespaces is whether each known namespace is enabled, as returned by
+	// AvailableNamespaces.
+	Namespaces map[string]bool
+}
+
+func (err MissingNamespacesError) Error() string {
+	noun := "namespace"
+	if len(err.Missing) > 1 {
+		noun = "namespaces"
+	}
+	return fmt.Sprintf("%s node is missing required RPC %s: %s (enable with %s)", err.Kind, noun, strings.Join(err.Missing, ", "), NamespaceFlag(err.Kind))
+}
+
+// CheckNamespaces returns a MissingNamespacesError if any of the namespaces
+// required for kind are not enabled in namespaces.
+func CheckNamespaces(kind NodeKind, namespaces map[string]bool) error {
+	missing := MissingNamespaces(kind, namespaces)
+	if len(missing) == 0 {
+		return nil
+	}
+	return MissingNamespacesError{Kind: kind, Missing: missing, Namespaces: namespaces}
+}
+
+// ProbeNamespaces calls a representative method of each RPC namespace that
+// vipnode knows about, and returns whether each is enabled. It only returns
+// an error if the node can't be reached.
+func ProbeNamespaces(ctx context.Context, client *rpc.Client) (map[string]bool, error) {
+	namespaces := make(map[string]bool, len(namespaceProbes))
+	for _, probe := range namespaceProbes {
+		var result interface{}
+		err := call(ctx, client, &result, probe.method, probe.args...)
+		if err, ok := err.(TransportError); ok {
+			return nil, err
+		}
+		// Other errors, like invalid params, mean the namespace is enabled.
+		rpcErr, ok := err.(RPCError)
+		namespaces[probe.namespace] = !ok || rpcErr.Code != errCodeMethodNotFound
+	}
+	return namespaces, nil
+}
+
+// EnabledNamespaces returns the sorted names of the enabled namespaces.
+func EnabledNamespaces(namespaces map[string]bool) []string {
+	r := make([]string, 0, len(namespaces))
+	for namespace, ok := range namespaces {
+		if ok {
+			r = append(r, namespace)
+		}
+	}
+	sort.Strings(r)
+	return r
+}
+
+// namespaceCache remembers the result of ProbeNamespaces, since the enabled
+// namespaces only change when the node is restarted.
+type namespaceCache struct {
+	mu         sync.Mutex
+	namespaces map[string]bool
+}
+
+// get returns a copy of the cached namespaces, probing them on the first
+// call. Failed probes are not cached.
+func (c *namespaceCache) get(ctx context.Context, client *rpc.Client) (map[string]bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.namespaces == nil {
+		namespaces, err := ProbeNamespaces(ctx, client)
+		if err != nil {
+			return nil, err
+		}
+		c.namespaces = namespaces
+	}
+	r := make(map[string]bool, len(c.namespaces))
+	for namespace, ok := range c.namespaces {
+		r[namespace] = ok
+	}
+	return r, nil
+}
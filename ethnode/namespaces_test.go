@@ -0,0 +1,195 @@
+package ethnode
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type MockLes struct{}
+
+func (s *MockLes) ServerInfo() map[string]interface{} { return map[string]interface{}{} }
+
+// MockTxpool counts txpool_status calls.
+type MockTxpool struct{ calls int }
+
+func (s *MockTxpool) Status() map[string]string {
+	s.calls++
+	return map[string]string{"pending": "0x0", "queued": "0x0"}
+}
+
+func TestAvailableNamespaces(t *testing.T) {
+	testcases := []struct {
+		name        string
+		kind        NodeKind
+		services    map[string]interface{}
+		wantEnabled []string
+		wantMissing []string
+	}{
+		{
+			name:        "geth with defaults",
+			kind:        Geth,
+			services:    map[string]interface{}{"eth": &MockEth{}, "net": &MockNet{}, "web3": &MockWeb3{}},
+			wantEnabled: []string{"eth", "net", "web3"},
+			wantMissing: []string{"admin"},
+		},
+		{
+			name: "geth with admin and txpool",
+			kind: Geth,
+			services: map[string]interface{}{
+				"eth": &MockEth{}, "net": &MockNet{}, "admin": &MockAdmin{}, "txpool": &MockTxpool{},
+			},
+			wantEnabled: []string{"admin", "eth", "net", "txpool"},
+		},
+		{
+			name:        "light client",
+			kind:        Geth,
+			services:    map[string]interface{}{"eth": &MockEth{}, "net": &MockNet{}, "admin": &MockAdmin{}, "les": &MockLes{}},
+			wantEnabled: []string{"admin", "eth", "les", "net"},
+		},
+		{
+			name:        "admin only",
+			kind:        Geth,
+			services:    map[string]interface{}{"admin": &MockAdmin{}},
+			wantEnabled: []string{"admin"},
+			wantMissing: []string{"eth", "net"},
+		},
+		{
+			name:        "parity",
+			kind:        Parity,
+			services:    map[string]interface{}{"eth": &MockEth{}, "net": &MockNet{}, "parity": &MockParity{}},
+			wantEnabled: []string{"eth", "net", "parity"},
+		},
+		{
+			name:        "nothing",
+			kind:        Parity,
+			services:    map[string]interface{}{},
+			wantEnabled: []string{},
+			wantMissing: []string{"eth", "net", "parity"},
+		},
+	}
+
+	for _, tc := range testcases {
+		client := serveMocks(t, tc.services)
+		namespaces, err := (&gethNode{client: client}).AvailableNamespaces(context.Background())
+		client.Close()
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tc.name, err)
+			continue
+		}
+		if got := EnabledNamespaces(namespaces); !reflect.DeepEqual(got, tc.wantEnabled) {
+			t.Errorf("%s: enabled: got %q; want %q", tc.name, got, tc.wantEnabled)
+		}
+		if got := MissingNamespaces(tc.kind, namespaces); !reflect.DeepEqual(got, tc.wantMissing) {
+			t.Errorf("%s: missing: got %q; want %q", tc.name, got, tc.wantMissing)
+		}
+		if len(namespaces) != len(namespaceProbes) {
+			t.Errorf("%s: expected all %d namespaces to be reported, got %v", tc.name, len(namespaceProbes), namespaces)
+		}
+	}
+}
+
+func TestAvailableNamespacesCached(t *testing.T) {
+	txpool := &MockTxpool{}
+	client := serveMocks(t, map[string]interface{}{"txpool": txpool})
+	defer client.Close()
+
+	node := &parityNode{client: client}
+	for i := 0; i < 3; i++ {
+		namespaces, err := node.AvailableNamespaces(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !namespaces["txpool"] {
+			t.Errorf("txpool should be enabled: %v", namespaces)
+		}
+		// Callers can't change the cached result.
+		namespaces["txpool"] = false
+	}
+	if txpool.calls != 1 {
+		t.Errorf("expected namespaces to be probed once, got %d", txpool.calls)
+	}
+
+	// Failures are not cached.
+	unreachable := serveMocks(t, map[string]interface{}{})
+	unreachable.Close()
+	node = &parityNode{client: unreachable}
+	if _, err := node.AvailableNamespaces(context.Background()); err == nil {
+		t.Error("expected error for unreachable node")
+	}
+	if node.namespaces.namespaces != nil {
+		t.Error("failed probe was cached")
+	}
+}
+
+func TestRemoteNodeNamespaces(t *testing.T) {
+	const (
+		gethVersion   = "Geth/v1.8.21-stable/linux-amd64/go1.11.4"
+		parityVersion = "Parity-Ethereum//v2.0.5-stable/x86_64-linux-gnu/rustc1.29.0"
+	)
+	testcases := []struct {
+		name        string
+		services    map[string]interface{}
+		wantKind    NodeKind
+		wantMissing []string
+		wantFlag    string
+	}{
+		{
+			name:     "geth",
+			services: map[string]interface{}{"web3": &MockWeb3{gethVersion}, "eth": &MockEth{}, "net": &MockNet{}, "admin": &MockAdmin{}},
+			wantKind: Geth,
+		},
+		{
+			name:        "geth without admin",
+			services:    map[string]interface{}{"web3": &MockWeb3{gethVersion}, "eth": &MockEth{}, "net": &MockNet{}},
+			wantKind:    Geth,
+			wantMissing: []string{"admin"},
+			wantFlag:    "--http.api",
+		},
+		{
+			name:     "parity",
+			services: map[string]interface{}{"web3": &MockWeb3{parityVersion}, "eth": &MockEth{}, "net": &MockNet{}, "parity": &MockParity{}},
+			wantKind: Parity,
+		},
+		{
+			name:        "parity without parity",
+			services:    map[string]interface{}{"web3": &MockWeb3{parityVersion}, "eth": &MockEth{}, "net": &MockNet{}, "admin": &MockAdmin{}},
+			wantKind:    Parity,
+			wantMissing: []string{"parity"},
+			wantFlag:    "--jsonrpc-apis",
+		},
+		{
+			name:        "unknown without admin",
+			services:    map[string]interface{}{"web3": &MockWeb3{"Foo/v1.0.0"}, "eth": &MockEth{}, "net": &MockNet{}},
+			wantKind:    Geth,
+			wantMissing: []string{"admin"},
+			wantFlag:    "--http.api",
+		},
+	}
+
+	for _, tc := range testcases {
+		client := serveMocks(t, tc.services)
+		node, err := remoteNode(context.Background(), client)
+		client.Close()
+		if tc.wantMissing == nil {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %s", tc.name, err)
+			} else if node.Kind() != tc.wantKind {
+				t.Errorf("%s: wrong kind: %s", tc.name, node.Kind())
+			}
+			continue
+		}
+		nsErr, ok := err.(MissingNamespacesError)
+		if !ok {
+			t.Errorf("%s: expected MissingNamespacesError, got: %v", tc.name, err)
+			continue
+		}
+		if nsErr.Kind != tc.wantKind || !reflect.DeepEqual(nsErr.Missing, tc.wantMissing) {
+			t.Errorf("%s: got %s missing %q; want %s missing %q", tc.name, nsErr.Kind, nsErr.Missing, tc.wantKind, tc.wantMissing)
+		}
+		if msg := nsErr.Error(); !strings.Contains(msg, tc.wantMissing[0]) || !strings.Contains(msg, tc.wantFlag) {
+			t.Errorf("%s: error should name the namespace and %s: %s", tc.name, tc.wantFlag, msg)
+		}
+	}
+}
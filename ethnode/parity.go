@@ -2,21 +2,37 @@ package ethnode
 
 import (
 	"context"
+	"encoding/json"
+	"math/big"
 	"strconv"
+	"time"
 
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/params"
 	"github.com/ethereum/go-ethereum/rpc"
 )
 
 var _ EthNode = &parityNode{}
 
 type parityPeers struct {
-	Peers []PeerInfo `json:"peers"`
+	Peers []json.RawMessage `json:"peers"` // Decoded by parsePeers
 }
 
 type parityNode struct {
-	client *rpc.Client
+	client  *rpc.Client
+	network NetworkID
+	pos     bool // Past the merge, see UserAgent.IsPoS
+	self    selfGuard
+	heads   *headCache // nil if subscriptions are unavailable
+	subs    *subscriptions
+	// borrowed is set when the client is owned by the caller, so Close
+	// leaves it open.
+	borrowed bool
+
+	namespaces namespaceCache
+	gasLimit   gasLimitCache
 }
 
 func (n *parityNode) ContractBackend() bind.ContractBackend {
@@ -27,6 +43,10 @@ func (n *parityNode) Kind() NodeKind {
 	return Parity
 }
 
+func (n *parityNode) Network() NetworkID {
+	return n.network
+}
+
 func (n *parityNode) ConnectPeer(ctx context.Context, nodeURI string) error {
 	// Parity doesn't have a way to just add peers, so we overload
 	// addReservedPeer for this.
@@ -35,41 +55,166 @@ func (n *parityNode) ConnectPeer(ctx context.Context, nodeURI string) error {
 
 func (n *parityNode) DisconnectPeer(ctx context.Context, nodeID string) error {
 	// Parity doesn't have a way to drop a specific peer, so we overload
-	// removeReservedPeer for this.
+	// removeReservedPeer for this. Unlike on Geth, this also undoes
+	// AddTrustedPeer, since both are backed by the reserved set.
 	return n.RemoveTrustedPeer(ctx, nodeID)
 }
 
 func (n *parityNode) AddTrustedPeer(ctx context.Context, nodeID string) error {
+	// Also guards ConnectPeer, which is overloaded onto this.
+	if err := n.self.check(ctx, n.Enode, nodeID); err != nil {
+		return err
+	}
 	var result interface{}
-	return n.client.CallContext(ctx, &result, "parity_addReservedPeer", nodeID)
+	return call(ctx, n.client, &result, "parity_addReservedPeer", nodeID)
 }
 
 func (n *parityNode) RemoveTrustedPeer(ctx context.Context, nodeID string) error {
 	var result interface{}
-	return n.client.CallContext(ctx, &result, "parity_removeReservedPeer", nodeID)
+	return call(ctx, n.client, &result, "parity_removeReservedPeer", nodeID)
 }
 
 func (n *parityNode) Peers(ctx context.Context) ([]PeerInfo, error) {
 	var result parityPeers
-	err := n.client.CallContext(ctx, &result, "parity_netPeers")
+	err := call(ctx, n.client, &result, "parity_netPeers")
 	if err != nil {
 		return nil, err
 	}
-	return result.Peers, nil
+	return parsePeers("parity_netPeers", result.Peers, false)
+}
+
+func (n *parityNode) PeersLite(ctx context.Context) ([]PeerInfo, error) {
+	var result parityPeers
+	err := call(ctx, n.client, &result, "parity_netPeers")
+	if err != nil {
+		return nil, err
+	}
+	return parsePeers("parity_netPeers", result.Peers, true)
+}
+
+func (n *parityNode) PeersByKind(ctx context.Context) (map[NodeKind]int, error) {
+	peers, err := n.PeersLite(ctx)
+	if err != nil && !IsPartialPeers(err) {
+		return nil, err
+	}
+	return CountPeersByKind(peers), err
+}
+
+func (n *parityNode) PeerSlots(ctx context.Context) (max, used, reserved int, err error) {
+	// Parity doesn't mark reserved peers in parity_netPeers, so reserved is
+	// only known through ManagedNode.
+	var result struct {
+		Connected int `json:"connected"`
+		Max       int `json:"max"`
+	}
+	if err := call(ctx, n.client, &result, "parity_netPeers"); err != nil {
+		return 0, 0, 0, err
+	}
+	return result.Max, result.Connected, 0, nil
 }
 
 func (n *parityNode) Enode(ctx context.Context) (string, error) {
 	var result string
-	if err := n.client.CallContext(ctx, &result, "parity_enode"); err != nil {
+	if err := call(ctx, n.client, &result, "parity_enode"); err != nil {
 		return "", err
 	}
 	return result, nil
 }
 
 func (n *parityNode) BlockNumber(ctx context.Context) (uint64, error) {
+	if number, _, ok := n.heads.Latest(); ok {
+		return number, nil
+	}
 	var result string
-	if err := n.client.CallContext(ctx, &result, "eth_blockNumber"); err != nil {
+	if err := call(ctx, n.client, &result, "eth_blockNumber"); err != nil {
 		return 0, err
 	}
 	return strconv.ParseUint(result, 0, 64)
 }
+
+func (n *parityNode) LatestBlock(ctx context.Context) (uint64, time.Time, error) {
+	if number, timestamp, ok := n.heads.Latest(); ok {
+		return number, timestamp, nil
+	}
+	return latestBlock(ctx, n.client)
+}
+
+func (n *parityNode) FeeHistory(ctx context.Context, blocks int, rewardPercentiles []float64) (*FeeHistory, error) {
+	return feeHistory(ctx, n.client, blocks, rewardPercentiles)
+}
+
+func (n *parityNode) AvailableNamespaces(ctx context.Context) (map[string]bool, error) {
+	return n.namespaces.get(ctx, n.client)
+}
+
+func (n *parityNode) NonceAt(ctx context.Context, address common.Address, block *big.Int) (uint64, error) {
+	return nonceAt(ctx, n.client, address, block)
+}
+
+func (n *parityNode) SendRawTransaction(ctx context.Context, signedTx []byte) (common.Hash, error) {
+	return sendRawTransaction(ctx, n.client, signedTx)
+}
+
+func (n *parityNode) DataDir(ctx context.Context) (string, error) {
+	// Parity doesn't expose its base path over RPC.
+	return "", ErrNotSupported
+}
+
+func (n *parityNode) GenesisHash(ctx context.Context) (common.Hash, error) {
+	return genesisHash(ctx, n.client)
+}
+
+func (n *parityNode) IsMining(ctx context.Context) (bool, error) {
+	if n.pos {
+		// eth_mining is always false once the consensus client takes
+		// over block production.
+		return false, ErrNotSupported
+	}
+	return ethMining(ctx, n.client)
+}
+
+func (n *parityNode) IsHealing(ctx context.Context) (bool, error) {
+	return ethHealing(ctx, n.client)
+}
+
+func (n *parityNode) SyncProgress(ctx context.Context) (*SyncProgress, error) {
+	return syncProgress(ctx, n.client)
+}
+
+func (n *parityNode) ChainConfig(ctx context.Context) (*params.ChainConfig, error) {
+	return chainConfig(ctx, n.client, n.network)
+}
+
+func (n *parityNode) BlockGasLimit(ctx context.Context) (uint64, error) {
+	return n.gasLimit.get(ctx, n.client)
+}
+
+func (n *parityNode) ClientVersion(ctx context.Context) (string, error) {
+	return clientVersion(ctx, n.client)
+}
+
+func (n *parityNode) TxPoolStatus(ctx context.Context) (pending, queued uint64, err error) {
+	return txPoolStatus(ctx, n.client)
+}
+
+func (n *parityNode) NodeUptime(ctx context.Context) (time.Duration, error) {
+	// Parity doesn't expose its base path, where its IPC endpoint is.
+	return 0, ErrNotSupported
+}
+
+func (n *parityNode) ChainHead(ctx context.Context) (*HeadInfo, error) {
+	return chainHead(ctx, n.client)
+}
+
+func (n *parityNode) Close() error {
+	n.subs.Close()
+	if !n.borrowed {
+		n.client.Close()
+	}
+	return nil
+}
+
+func (n *parityNode) ForkID(ctx context.Context) ([4]byte, uint64, error) {
+	// Parity doesn't expose its genesis hash and fork schedule together.
+	return [4]byte{}, 0, ErrForkIDUnavailable
+}
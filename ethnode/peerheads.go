@@ -0,0 +1,136 @@
+package ethnode
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// PeerHead is the head block that a peer advertised to the node, from the
+// eth or les protocol info of admin_peers or parity_netPeers.
+type PeerHead struct {
+	Hash common.Hash
+	// Number is the head block number, or 0 if the protocol doesn't
+	// advertise it, which is the case for eth.
+	Number uint64
+	// TotalDifficulty is the total difficulty of the head, or nil if the
+	// peer didn't advertise it. It stops growing past the merge.
+	TotalDifficulty *big.Int
+}
+
+// parsePeerHead returns the head from a peer's protocols field, preferring
+// eth over les, or nil if neither has one. Protocols which are still in their
+// handshake are reported as a string rather than an object, and are skipped.
+func parsePeerHead(protocols map[string]json.RawMessage) *PeerHead {
+	for _, name := range []string{"eth", "les"} {
+		var info struct {
+			Head       common.Hash     `json:"head"`
+			HeadNumber *uint64         `json:"headNumber"`
+			Difficulty json.RawMessage `json:"difficulty"`
+		}
+		if err := json.Unmarshal(protocols[name], &info); err != nil || info.Head == (common.Hash{}) {
+			continue
+		}
+		head := &PeerHead{Hash: info.Head, TotalDifficulty: parseDifficulty(info.Difficulty)}
+		if info.HeadNumber != nil {
+			head.Number = *info.HeadNumber
+		}
+		return head
+	}
+	return nil
+}
+
+// parseDifficulty decodes a total difficulty, which Geth encodes as a JSON
+// number and Parity as a hex string. It returns nil if it's missing or
+// malformed.
+func parseDifficulty(raw json.RawMessage) *big.Int {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil
+	}
+	if raw[0] == '"' {
+		var td hexutil.Big
+		if err := json.Unmarshal(raw, &td); err != nil {
+			return nil
+		}
+		return td.ToInt()
+	}
+	td := new(big.Int)
+	if err := td.UnmarshalJSON(raw); err != nil {
+		return nil
+	}
+	return td
+}
+
+// HeadConsensus is what a node's peers agree its head should be, as the
+// medians of their advertised heads. For an even number of values, the lower
+// of the two middle ones is used.
+type HeadConsensus struct {
+	// Peers is the number of peers which advertised a head.
+	Peers int
+	// Number is the median head block number of the peers which advertised
+	// one, or 0 if none did.
+	Number uint64
+	// TotalDifficulty is the median total difficulty of the peers which
+	// advertised one, or nil if none did.
+	TotalDifficulty *big.Int
+}
+
+// Lagging returns whether head is behind the consensus by more than
+// tolerance blocks. Peers advertise their head number over les only, so
+// otherwise head is lagging if its total difficulty is below the consensus,
+// without any tolerance. Past the merge, when total difficulties stop
+// growing, that only catches nodes which are stuck before it.
+func (c *HeadConsensus) Lagging(head *HeadInfo, tolerance uint64) bool {
+	if c.Number > 0 {
+		return head.Number+tolerance < c.Number
+	}
+	if c.TotalDifficulty != nil && head.TotalDifficulty != nil {
+		return head.TotalDifficulty.Cmp(c.TotalDifficulty) < 0
+	}
+	return false
+}
+
+// PeerHeadConsensus returns the median of the heads advertised by peers.
+// Peers which didn't advertise a head are skipped.
+func PeerHeadConsensus(peers []PeerInfo) *HeadConsensus {
+	c := &HeadConsensus{}
+	var numbers []uint64
+	var difficulties []*big.Int
+	for _, peer := range peers {
+		if peer.Head == nil {
+			continue
+		}
+		c.Peers++
+		if peer.Head.Number > 0 {
+			numbers = append(numbers, peer.Head.Number)
+		}
+		if peer.Head.TotalDifficulty != nil {
+			difficulties = append(difficulties, peer.Head.TotalDifficulty)
+		}
+	}
+	if len(numbers) > 0 {
+		sort.Slice(numbers, func(i, j int) bool { return numbers[i] < numbers[j] })
+		c.Number = numbers[(len(numbers)-1)/2]
+	}
+	if len(difficulties) > 0 {
+		sort.Slice(difficulties, func(i, j int) bool { return difficulties[i].Cmp(difficulties[j]) < 0 })
+		c.TotalDifficulty = new(big.Int).Set(difficulties[(len(difficulties)-1)/2])
+	}
+	return c
+}
+
+// PeersHeadConsensus returns the median head advertised by the connected
+// peers of node, to verify that a node which claims to be synced isn't
+// lagging behind its peers (see HeadConsensus.Lagging).
+func PeersHeadConsensus(ctx context.Context, node EthNode) (*HeadConsensus, error) {
+	peers, err := node.Peers(ctx)
+	if err != nil && !IsPartialPeers(err) {
+		return nil, err
+	}
+	// The median holds up without a few of the peers.
+	return PeerHeadConsensus(peers), nil
+}
@@ -0,0 +1,121 @@
+package ethnode
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestParsePeerHead(t *testing.T) {
+	hash := "0x" + common.Bytes2Hex(common.LeftPadBytes([]byte{0x2a}, 32))
+	testcases := []struct {
+		name      string
+		protocols string
+		want      *PeerHead
+	}{
+		{"geth", `{"eth": {"version": 63, "difficulty": 9000000000000000000, "head": "` + hash + `"}}`, &PeerHead{Hash: common.HexToHash(hash), TotalDifficulty: big.NewInt(9000000000000000000)}},
+		{"parity", `{"eth": {"version": 63, "difficulty": "0x7ce66c50e2840000", "head": "` + hash + `"}}`, &PeerHead{Hash: common.HexToHash(hash), TotalDifficulty: big.NewInt(9000000000000000000)}},
+		{"geth past the merge", `{"eth": {"version": 68, "head": "` + hash + `"}}`, &PeerHead{Hash: common.HexToHash(hash)}},
+		{"les", `{"les": {"version": 2, "difficulty": 42, "head": "` + hash + `", "headNumber": 100}}`, &PeerHead{Hash: common.HexToHash(hash), Number: 100, TotalDifficulty: big.NewInt(42)}},
+		{"handshake", `{"eth": "handshake"}`, nil},
+		{"no protocols", `{}`, nil},
+	}
+	for _, tc := range testcases {
+		var protocols map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(tc.protocols), &protocols); err != nil {
+			t.Fatal(err)
+		}
+		got := parsePeerHead(protocols)
+		if (got == nil) != (tc.want == nil) {
+			t.Errorf("%s: got %+v; want %+v", tc.name, got, tc.want)
+			continue
+		}
+		if got == nil {
+			continue
+		}
+		if got.Hash != tc.want.Hash || got.Number != tc.want.Number {
+			t.Errorf("%s: got %+v; want %+v", tc.name, got, tc.want)
+		}
+		if (got.TotalDifficulty == nil) != (tc.want.TotalDifficulty == nil) || (got.TotalDifficulty != nil && got.TotalDifficulty.Cmp(tc.want.TotalDifficulty) != 0) {
+			t.Errorf("%s: got total difficulty %v; want %v", tc.name, got.TotalDifficulty, tc.want.TotalDifficulty)
+		}
+	}
+}
+
+func TestPeerHeadConsensus(t *testing.T) {
+	peer := func(number, td int64) PeerInfo {
+		head := &PeerHead{Number: uint64(number)}
+		if td > 0 {
+			head.TotalDifficulty = big.NewInt(td)
+		}
+		return PeerInfo{Head: head}
+	}
+	testcases := []struct {
+		name    string
+		peers   []PeerInfo
+		peerNum int
+		number  uint64
+		td      int64
+	}{
+		{"odd", []PeerInfo{peer(105, 50), peer(100, 10), peer(103, 30)}, 3, 103, 30},
+		{"even uses the lower middle", []PeerInfo{peer(100, 10), peer(104, 40), peer(102, 20), peer(110, 90)}, 4, 102, 20},
+		{"skips peers without a head", []PeerInfo{peer(100, 10), {}, peer(100, 10)}, 2, 100, 10},
+		{"difficulty only", []PeerInfo{peer(0, 7), peer(0, 9)}, 2, 0, 7},
+		{"no heads", []PeerInfo{{}, {}}, 0, 0, 0},
+	}
+	for _, tc := range testcases {
+		c := PeerHeadConsensus(tc.peers)
+		if c.Peers != tc.peerNum || c.Number != tc.number {
+			t.Errorf("%s: got %d peers with median %d; want %d peers with median %d", tc.name, c.Peers, c.Number, tc.peerNum, tc.number)
+		}
+		if tc.td == 0 {
+			if c.TotalDifficulty != nil {
+				t.Errorf("%s: got median total difficulty %s; want none", tc.name, c.TotalDifficulty)
+			}
+		} else if c.TotalDifficulty == nil || c.TotalDifficulty.Int64() != tc.td {
+			t.Errorf("%s: got median total difficulty %v; want %d", tc.name, c.TotalDifficulty, tc.td)
+		}
+	}
+}
+
+func TestHeadConsensusLagging(t *testing.T) {
+	byNumber := &HeadConsensus{Peers: 3, Number: 100, TotalDifficulty: big.NewInt(1000)}
+	byDifficulty := &HeadConsensus{Peers: 3, TotalDifficulty: big.NewInt(1000)}
+	testcases := []struct {
+		name      string
+		consensus *HeadConsensus
+		head      HeadInfo
+		tolerance uint64
+		want      bool
+	}{
+		{"in sync", byNumber, HeadInfo{Number: 100}, 0, false},
+		{"ahead", byNumber, HeadInfo{Number: 101}, 0, false},
+		{"within tolerance", byNumber, HeadInfo{Number: 98}, 2, false},
+		{"behind", byNumber, HeadInfo{Number: 97}, 2, true},
+		{"difficulty behind", byDifficulty, HeadInfo{Number: 100, TotalDifficulty: big.NewInt(999)}, 5, true},
+		{"difficulty in sync", byDifficulty, HeadInfo{Number: 100, TotalDifficulty: big.NewInt(1000)}, 0, false},
+		{"unknown difficulty", byDifficulty, HeadInfo{Number: 100}, 0, false},
+		{"no consensus", &HeadConsensus{}, HeadInfo{Number: 1}, 0, false},
+	}
+	for _, tc := range testcases {
+		if got := tc.consensus.Lagging(&tc.head, tc.tolerance); got != tc.want {
+			t.Errorf("%s: got lagging %t; want %t", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestPeersHeadConsensus(t *testing.T) {
+	client := serveMocks(t, map[string]interface{}{"admin": &MockAdmin{}})
+	defer client.Close()
+	c, err := PeersHeadConsensus(context.Background(), &gethNode{client: client})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The first mock peer advertises a zero hash, which isn't a head.
+	if c.Peers != 2 || c.Number != 0 || c.TotalDifficulty == nil || c.TotalDifficulty.Uint64() != 9000000000000000000 {
+		t.Errorf("wrong consensus: %+v", c)
+	}
+}
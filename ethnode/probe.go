@@ -0,0 +1,102 @@
+package ethnode
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// NodeInfo is the metadata detected about a running node, for diagnostics.
+type NodeInfo struct {
+	UserAgent
+
+	Syncing      bool   // Is the node still syncing?
+	CurrentBlock uint64 // Current sync'd block number
+	HighestBlock uint64 // Highest known block number, if syncing
+	NumPeers     int    // Result of net_peerCount
+
+	// Enode is set if the peer management API (admin for Geth, parity for
+	// Parity) is available, which vipnode requires.
+	Enode    string
+	AdminErr error // Why the peer management API is unavailable, if it is.
+
+	// Capabilities lists the required RPC methods which are available.
+	Capabilities *CapabilityReport
+	// Namespaces is whether each known RPC namespace is enabled.
+	Namespaces map[string]bool
+
+	// DataDir is the node's data directory, if the node exposes it.
+	DataDir string
+	// DiskUsage is the size of DataDir in bytes, if it was measured with
+	// DiskUsage.
+	DiskUsage int64
+}
+
+// AdminAPI returns whether the node's peer management API is available.
+func (info *NodeInfo) AdminAPI() bool {
+	return info.AdminErr == nil
+}
+
+// Probe detects the client and queries the RPC API for the node's chain, sync
+// and peer status. Unlike Dial, it does not fail if the peer management API is
+// unavailable, so that it can be reported.
+func Probe(ctx context.Context, client *rpc.Client) (*NodeInfo, error) {
+	agent, err := detectClient(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	info := &NodeInfo{UserAgent: *agent}
+
+	// eth_syncing returns false when sync'd, or a sync status object.
+	var syncing interface{}
+	if err := client.CallContext(ctx, &syncing, "eth_syncing"); err != nil {
+		return nil, err
+	}
+	if status, ok := syncing.(map[string]interface{}); ok {
+		info.Syncing = true
+		info.CurrentBlock = parseQuantity(status["currentBlock"])
+		info.HighestBlock = parseQuantity(status["highestBlock"])
+	} else {
+		var blockNumber string
+		if err := client.CallContext(ctx, &blockNumber, "eth_blockNumber"); err != nil {
+			return nil, err
+		}
+		info.CurrentBlock = parseQuantity(blockNumber)
+	}
+
+	var peerCount string
+	if err := client.CallContext(ctx, &peerCount, "net_peerCount"); err != nil {
+		return nil, err
+	}
+	info.NumPeers = int(parseQuantity(peerCount))
+
+	var node EthNode = &gethNode{client: client}
+	if agent.Kind == Parity {
+		node = &parityNode{client: client}
+	}
+	info.Enode, info.AdminErr = node.Enode(ctx)
+	if info.DataDir, err = node.DataDir(ctx); err == ErrNotSupported {
+		info.DataDir = ""
+	} else if _, ok := err.(TransportError); ok {
+		return nil, err
+	}
+
+	if info.Capabilities, err = ProbeCapabilities(ctx, client, agent.Kind); err != nil {
+		return nil, err
+	}
+	if info.Namespaces, err = ProbeNamespaces(ctx, client); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// parseQuantity parses a hex-encoded quantity, returning 0 if it's invalid.
+func parseQuantity(v interface{}) uint64 {
+	s, ok := v.(string)
+	if !ok {
+		return 0
+	}
+	n, _ := strconv.ParseUint(s, 0, 64)
+	return n
+}
@@ -0,0 +1,213 @@
+package ethnode
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// Mock services must be exported to be registered with go-ethereum's rpc.Server.
+type MockWeb3 struct{ version string }
+
+func (s *MockWeb3) ClientVersion() string { return s.version }
+
+type MockEth struct {
+	syncing interface{}
+	chainID string // Defaults to Rinkeby
+}
+
+func (s *MockEth) ProtocolVersion() string { return "0x3f" }
+func (s *MockEth) ChainId() string {
+	if s.chainID == "" {
+		return "0x4"
+	}
+	return s.chainID
+}
+func (s *MockEth) Syncing() interface{} { return s.syncing }
+func (s *MockEth) BlockNumber() string  { return "0x2a" }
+func (s *MockEth) GetBlockByNumber(number string, full bool) map[string]string {
+	return map[string]string{"number": "0x2a", "timestamp": "0x5c3a8f4e"}
+}
+
+type MockNet struct{}
+
+func (s *MockNet) Version() string   { return "4" }
+func (s *MockNet) PeerCount() string { return "0x19" }
+
+type MockAdmin struct {
+	disabled      bool
+	nodeInfoCalls int
+	added         []string
+	trusted       map[string]bool
+	static        map[string]bool
+}
+
+func (s *MockAdmin) NodeInfo() (map[string]interface{}, error) {
+	s.nodeInfoCalls++
+	if s.disabled {
+		return nil, errors.New("admin disabled")
+	}
+	return map[string]interface{}{
+		"enode": "enode://foo@127.0.0.1:30303",
+		"protocols": map[string]interface{}{
+			"eth": map[string]interface{}{
+				"network": 4,
+				"genesis": rinkebyGenesis,
+				"config":  json.RawMessage(rinkebyConfig),
+			},
+		},
+	}, nil
+}
+
+// AddPeer, RemovePeer, AddTrustedPeer and RemoveTrustedPeer follow Geth's
+// semantics: the static set (redialed peers) and trusted set (always allowed
+// to connect) are separate, and admin_removePeer only touches the static set.
+func (s *MockAdmin) AddPeer(nodeURI string) bool {
+	s.added = append(s.added, nodeURI)
+	s.setPeer(&s.static, nodeURI, true)
+	return true
+}
+
+func (s *MockAdmin) RemovePeer(nodeURI string) bool {
+	s.setPeer(&s.static, nodeURI, false)
+	return true
+}
+
+func (s *MockAdmin) AddTrustedPeer(nodeID string) bool {
+	s.added = append(s.added, nodeID)
+	s.setPeer(&s.trusted, nodeID, true)
+	return true
+}
+
+func (s *MockAdmin) RemoveTrustedPeer(nodeID string) bool {
+	s.setPeer(&s.trusted, nodeID, false)
+	return true
+}
+
+func (s *MockAdmin) setPeer(set *map[string]bool, nodeURI string, add bool) {
+	if *set == nil {
+		*set = map[string]bool{}
+	}
+	if add {
+		(*set)[enodeNodeID(nodeURI)] = true
+	} else {
+		delete(*set, enodeNodeID(nodeURI))
+	}
+}
+
+func (s *MockAdmin) Peers() json.RawMessage {
+	return adminPeersPayload(3)
+}
+
+type MockParity struct{}
+
+func (s *MockParity) NetPeers() map[string]interface{} {
+	return map[string]interface{}{"active": 3, "connected": 4, "max": 50, "peers": []interface{}{}}
+}
+
+func mockNode(t *testing.T, eth *MockEth, admin *MockAdmin) *rpc.Client {
+	server := rpc.NewServer()
+	services := map[string]interface{}{
+		"web3":   &MockWeb3{"Geth/v1.8.21-stable/linux-amd64/go1.11.4"},
+		"eth":    eth,
+		"net":    &MockNet{},
+		"admin":  admin,
+		"parity": &MockParity{},
+	}
+	for name, service := range services {
+		if err := server.RegisterName(name, service); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return rpc.DialInProc(server)
+}
+
+func TestProbe(t *testing.T) {
+	client := mockNode(t, &MockEth{syncing: false}, &MockAdmin{})
+	defer client.Close()
+
+	info, err := Probe(context.Background(), client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Kind != Geth || info.Network != Rinkeby || !info.IsFullNode {
+		t.Errorf("wrong agent values: %+v", info.UserAgent)
+	}
+	if info.ChainID != 4 || info.Syncing || info.CurrentBlock != 42 || info.NumPeers != 25 {
+		t.Errorf("wrong node info: %+v", info)
+	}
+	if !info.AdminAPI() || info.Enode != "enode://foo@127.0.0.1:30303" {
+		t.Errorf("wrong admin info: %+v", info)
+	}
+	if !info.Capabilities.Supported() {
+		t.Errorf("expected all capabilities: %+v", info.Capabilities)
+	}
+}
+
+func TestProbeSyncing(t *testing.T) {
+	syncing := map[string]string{"currentBlock": "0x64", "highestBlock": "0xc8"}
+	client := mockNode(t, &MockEth{syncing: syncing}, &MockAdmin{disabled: true})
+	defer client.Close()
+
+	info, err := Probe(context.Background(), client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.Syncing || info.CurrentBlock != 100 || info.HighestBlock != 200 {
+		t.Errorf("wrong sync status: %+v", info)
+	}
+	if info.AdminAPI() {
+		t.Errorf("expected admin API to be unavailable: %+v", info)
+	}
+}
+
+func TestPeersLite(t *testing.T) {
+	client := mockNode(t, &MockEth{syncing: false}, &MockAdmin{})
+	defer client.Close()
+	node := &gethNode{client: client}
+
+	full, err := node.Peers(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	lite, err := node.PeersLite(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(full) != 3 || len(lite) != 3 {
+		t.Fatalf("wrong number of peers: %d full, %d lite", len(full), len(lite))
+	}
+	for i := range full {
+		if full[i].ID != lite[i].ID || full[i].Name != lite[i].Name {
+			t.Errorf("peer %d: %+v does not match %+v", i, lite[i], full[i])
+		}
+		if len(full[i].Caps) == 0 || lite[i].Caps != nil {
+			t.Errorf("peer %d: caps should only be set on full peers", i)
+		}
+	}
+}
+
+func TestPeerSlots(t *testing.T) {
+	client := mockNode(t, &MockEth{syncing: false}, &MockAdmin{})
+	defer client.Close()
+
+	// 3 peers: one trusted and one static
+	max, used, reserved, err := (&gethNode{client: client}).PeerSlots(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if max != 0 || used != 3 || reserved != 2 {
+		t.Errorf("geth slots: got max=%d used=%d reserved=%d", max, used, reserved)
+	}
+
+	max, used, reserved, err = (&parityNode{client: client}).PeerSlots(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if max != 50 || used != 4 || reserved != 0 {
+		t.Errorf("parity slots: got max=%d used=%d reserved=%d", max, used, reserved)
+	}
+}
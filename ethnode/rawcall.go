@@ -0,0 +1,63 @@
+package ethnode
+
+import (
+	"context"
+	"errors"
+	"path"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// ErrMethodNotAllowed is returned by RawCall for methods which don't match
+// the caller's allowlist.
+var ErrMethodNotAllowed = errors.New("method is not allowed")
+
+// MethodAllowlist is a list of RPC method name patterns, such as "eth_*" or
+// "net_version", in the syntax of path.Match. An empty list allows all
+// methods.
+type MethodAllowlist []string
+
+// Allows returns whether method matches one of the patterns, or the list is
+// empty. Malformed patterns never match.
+func (l MethodAllowlist) Allows(method string) bool {
+	if len(l) == 0 {
+		return true
+	}
+	for _, pattern := range l {
+		if ok, err := path.Match(pattern, method); err == nil && ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate returns an error for the first malformed pattern.
+func (l MethodAllowlist) Validate() error {
+	for _, pattern := range l {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RawCaller makes RPC calls to a node which EthNode doesn't wrap.
+type RawCaller struct {
+	Client *rpc.Client
+
+	// Allow restricts which methods RawCall permits. It's empty by default,
+	// which allows every method. Callers which pass along method names from
+	// elsewhere should set it to harden the node, so that methods like
+	// personal_* and admin_* can't be reached through them.
+	Allow MethodAllowlist
+}
+
+// RawCall calls method with args and decodes its result into result, as
+// rpc.Client.CallContext does. It returns ErrMethodNotAllowed without calling
+// the node if the method doesn't match Allow.
+func (c *RawCaller) RawCall(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	if !c.Allow.Allows(method) {
+		return ErrMethodNotAllowed
+	}
+	return call(ctx, c.Client, result, method, args...)
+}
@@ -0,0 +1,62 @@
+package ethnode
+
+import (
+	"context"
+	"testing"
+)
+
+func TestMethodAllowlist(t *testing.T) {
+	allow := MethodAllowlist{"eth_*", "net_version", "web3_clientVersion"}
+	for method, want := range map[string]bool{
+		"eth_blockNumber":        true,
+		"eth_getBlockByNumber":   true,
+		"net_version":            true,
+		"net_peerCount":          false,
+		"web3_clientVersion":     true,
+		"personal_unlockAccount": false,
+		"admin_addPeer":          false,
+		"":                       false,
+	} {
+		if got := allow.Allows(method); got != want {
+			t.Errorf("%q: got allowed %t; want %t", method, got, want)
+		}
+	}
+
+	if !(MethodAllowlist{}).Allows("personal_unlockAccount") {
+		t.Error("expected an empty allowlist to allow all methods")
+	}
+	if err := (MethodAllowlist{"eth_[*"}).Validate(); err == nil {
+		t.Error("expected a malformed pattern to fail validation")
+	}
+	if (MethodAllowlist{"eth_[*"}).Allows("eth_blockNumber") {
+		t.Error("expected a malformed pattern not to match")
+	}
+}
+
+func TestRawCall(t *testing.T) {
+	client := serveMocks(t, map[string]interface{}{"eth": &MockEth{}, "admin": &MockAdmin{}})
+	defer client.Close()
+	ctx := context.Background()
+
+	// All methods are allowed by default.
+	caller := &RawCaller{Client: client}
+	var enode interface{}
+	if err := caller.RawCall(ctx, &enode, "admin_nodeInfo"); err != nil {
+		t.Fatal(err)
+	}
+
+	caller.Allow = MethodAllowlist{"eth_*"}
+	var number string
+	if err := caller.RawCall(ctx, &number, "eth_blockNumber"); err != nil {
+		t.Fatal(err)
+	}
+	if number != "0x2a" {
+		t.Errorf("wrong block number: %s", number)
+	}
+	if err := caller.RawCall(ctx, &enode, "admin_nodeInfo"); err != ErrMethodNotAllowed {
+		t.Errorf("expected ErrMethodNotAllowed, got: %v", err)
+	}
+	if err := caller.RawCall(ctx, nil, "personal_unlockAccount", "0x0", "hunter2", 0); err != ErrMethodNotAllowed {
+		t.Errorf("expected ErrMethodNotAllowed, got: %v", err)
+	}
+}
@@ -0,0 +1,601 @@
+package ethnode
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// recordingHeader is the first line of a recording, with the results of the
+// EthNode methods which can't fail.
+type recordingHeader struct {
+	Kind    NodeKind  `json:"kind"`
+	Network NetworkID `json:"network"`
+}
+
+// RecordedCall is a single EthNode method call in a recording.
+type RecordedCall struct {
+	Method string          `json:"method"`
+	Args   json.RawMessage `json:"args"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  *RecordedError  `json:"error,omitempty"`
+}
+
+// RecordedError is an error returned by a recorded call. Errors of this
+// package are replayed as the same type, others only keep their message.
+type RecordedError struct {
+	Type    string `json:"type,omitempty"`
+	Message string `json:"message"`
+	Method  string `json:"method,omitempty"`
+	Code    int    `json:"code,omitempty"`
+	Reason  int    `json:"reason,omitempty"`
+}
+
+// recordedSentinels are the error values which are replayed as themselves.
+var recordedSentinels = []error{
+	ErrNotSupported,
+	ErrForkIDUnavailable,
+	ErrCircuitOpen,
+	ErrSelfConnection,
+}
+
+func encodeError(err error) *RecordedError {
+	if err == nil {
+		return nil
+	}
+	for _, sentinel := range recordedSentinels {
+		if err == sentinel {
+			return &RecordedError{Type: "sentinel", Message: err.Error()}
+		}
+	}
+	switch err := err.(type) {
+	case RPCError:
+		return &RecordedError{Type: "rpc", Message: err.Message, Method: err.Method, Code: err.Code}
+	case TransportError:
+		return &RecordedError{Type: "transport", Message: err.Err.Error(), Method: err.Method}
+	case TxRejectedError:
+		return &RecordedError{Type: "txrejected", Message: err.Message, Reason: int(err.Reason)}
+	}
+	return &RecordedError{Message: err.Error()}
+}
+
+func (e *RecordedError) decode() error {
+	if e == nil {
+		return nil
+	}
+	switch e.Type {
+	case "sentinel":
+		for _, sentinel := range recordedSentinels {
+			if sentinel.Error() == e.Message {
+				return sentinel
+			}
+		}
+	case "rpc":
+		return RPCError{Method: e.Method, Code: e.Code, Message: e.Message}
+	case "transport":
+		return TransportError{Method: e.Method, Err: errors.New(e.Message)}
+	case "txrejected":
+		return TxRejectedError{Reason: TxRejection(e.Reason), Message: e.Message}
+	}
+	return errors.New(e.Message)
+}
+
+// Results of methods with several return values.
+type (
+	peerSlotsResult struct {
+		Max, Used, Reserved int
+	}
+	latestBlockResult struct {
+		Number    uint64
+		Timestamp time.Time
+	}
+	forkIDResult struct {
+		Hash [4]byte
+		Next uint64
+	}
+	txPoolResult struct {
+		Pending, Queued uint64
+	}
+)
+
+// recordedPeer is PeerInfo with all of its fields serialized, since some are
+// left out of its JSON encoding.
+type recordedPeer struct {
+	ID            string
+	Name          string
+	Caps          []string
+	Inbound       bool
+	RemoteAddress string
+	Static        bool
+	Trusted       bool
+	Head          *PeerHead
+	Managed       bool
+}
+
+func encodePeers(peers []PeerInfo) []recordedPeer {
+	if peers == nil {
+		return nil
+	}
+	r := make([]recordedPeer, 0, len(peers))
+	for _, p := range peers {
+		r = append(r, recordedPeer(p))
+	}
+	return r
+}
+
+func decodePeers(peers []recordedPeer) []PeerInfo {
+	if peers == nil {
+		return nil
+	}
+	r := make([]PeerInfo, 0, len(peers))
+	for _, p := range peers {
+		r = append(r, PeerInfo(p))
+	}
+	return r
+}
+
+// Record wraps an EthNode so that each of its method calls, with their
+// arguments and results, is written to w for replaying with Replay. Calls
+// are written as one JSON object per line.
+func Record(node EthNode, w io.Writer) (*RecordingNode, error) {
+	n := &RecordingNode{EthNode: node, enc: json.NewEncoder(w)}
+	if err := n.enc.Encode(recordingHeader{Kind: node.Kind(), Network: node.Network()}); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// RecordingNode is an EthNode which records its calls, returned by Record.
+type RecordingNode struct {
+	EthNode
+
+	mu  sync.Mutex
+	enc *json.Encoder
+	err error
+}
+
+// Err returns the first error from writing the recording, if any. Calls are
+// still passed through to the node after the recording fails.
+func (n *RecordingNode) Err() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.err
+}
+
+func (n *RecordingNode) record(method string, args []interface{}, result interface{}, callErr error) {
+	call := RecordedCall{Method: method, Error: encodeError(callErr)}
+	var err error
+	if call.Args, err = marshalArgs(args); err == nil {
+		call.Result, err = json.Marshal(result)
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.err != nil {
+		return
+	}
+	if err == nil {
+		err = n.enc.Encode(call)
+	}
+	n.err = err
+}
+
+func marshalArgs(args []interface{}) (json.RawMessage, error) {
+	if args == nil {
+		args = []interface{}{}
+	}
+	return json.Marshal(args)
+}
+
+func (n *RecordingNode) Enode(ctx context.Context) (enode string, err error) {
+	enode, err = n.EthNode.Enode(ctx)
+	n.record("Enode", nil, enode, err)
+	return enode, err
+}
+
+func (n *RecordingNode) AddTrustedPeer(ctx context.Context, nodeID string) error {
+	err := n.EthNode.AddTrustedPeer(ctx, nodeID)
+	n.record("AddTrustedPeer", []interface{}{nodeID}, nil, err)
+	return err
+}
+
+func (n *RecordingNode) RemoveTrustedPeer(ctx context.Context, nodeID string) error {
+	err := n.EthNode.RemoveTrustedPeer(ctx, nodeID)
+	n.record("RemoveTrustedPeer", []interface{}{nodeID}, nil, err)
+	return err
+}
+
+func (n *RecordingNode) ConnectPeer(ctx context.Context, nodeURI string) error {
+	err := n.EthNode.ConnectPeer(ctx, nodeURI)
+	n.record("ConnectPeer", []interface{}{nodeURI}, nil, err)
+	return err
+}
+
+func (n *RecordingNode) DisconnectPeer(ctx context.Context, nodeID string) error {
+	err := n.EthNode.DisconnectPeer(ctx, nodeID)
+	n.record("DisconnectPeer", []interface{}{nodeID}, nil, err)
+	return err
+}
+
+func (n *RecordingNode) Peers(ctx context.Context) ([]PeerInfo, error) {
+	peers, err := n.EthNode.Peers(ctx)
+	n.record("Peers", nil, encodePeers(peers), err)
+	return peers, err
+}
+
+func (n *RecordingNode) PeersLite(ctx context.Context) ([]PeerInfo, error) {
+	peers, err := n.EthNode.PeersLite(ctx)
+	n.record("PeersLite", nil, encodePeers(peers), err)
+	return peers, err
+}
+
+func (n *RecordingNode) PeersByKind(ctx context.Context) (map[NodeKind]int, error) {
+	kinds, err := n.EthNode.PeersByKind(ctx)
+	n.record("PeersByKind", nil, kinds, err)
+	return kinds, err
+}
+
+func (n *RecordingNode) PeerSlots(ctx context.Context) (max, used, reserved int, err error) {
+	max, used, reserved, err = n.EthNode.PeerSlots(ctx)
+	n.record("PeerSlots", nil, peerSlotsResult{max, used, reserved}, err)
+	return max, used, reserved, err
+}
+
+func (n *RecordingNode) BlockNumber(ctx context.Context) (uint64, error) {
+	number, err := n.EthNode.BlockNumber(ctx)
+	n.record("BlockNumber", nil, number, err)
+	return number, err
+}
+
+func (n *RecordingNode) LatestBlock(ctx context.Context) (uint64, time.Time, error) {
+	number, timestamp, err := n.EthNode.LatestBlock(ctx)
+	n.record("LatestBlock", nil, latestBlockResult{number, timestamp}, err)
+	return number, timestamp, err
+}
+
+func (n *RecordingNode) ForkID(ctx context.Context) ([4]byte, uint64, error) {
+	hash, next, err := n.EthNode.ForkID(ctx)
+	n.record("ForkID", nil, forkIDResult{hash, next}, err)
+	return hash, next, err
+}
+
+func (n *RecordingNode) FeeHistory(ctx context.Context, blocks int, rewardPercentiles []float64) (*FeeHistory, error) {
+	history, err := n.EthNode.FeeHistory(ctx, blocks, rewardPercentiles)
+	n.record("FeeHistory", []interface{}{blocks, rewardPercentiles}, history, err)
+	return history, err
+}
+
+func (n *RecordingNode) AvailableNamespaces(ctx context.Context) (map[string]bool, error) {
+	namespaces, err := n.EthNode.AvailableNamespaces(ctx)
+	n.record("AvailableNamespaces", nil, namespaces, err)
+	return namespaces, err
+}
+
+func (n *RecordingNode) NonceAt(ctx context.Context, address common.Address, block *big.Int) (uint64, error) {
+	nonce, err := n.EthNode.NonceAt(ctx, address, block)
+	n.record("NonceAt", []interface{}{address, block}, nonce, err)
+	return nonce, err
+}
+
+func (n *RecordingNode) SendRawTransaction(ctx context.Context, signedTx []byte) (common.Hash, error) {
+	hash, err := n.EthNode.SendRawTransaction(ctx, signedTx)
+	n.record("SendRawTransaction", []interface{}{signedTx}, hash, err)
+	return hash, err
+}
+
+func (n *RecordingNode) DataDir(ctx context.Context) (string, error) {
+	path, err := n.EthNode.DataDir(ctx)
+	n.record("DataDir", nil, path, err)
+	return path, err
+}
+
+func (n *RecordingNode) GenesisHash(ctx context.Context) (common.Hash, error) {
+	hash, err := n.EthNode.GenesisHash(ctx)
+	n.record("GenesisHash", nil, hash, err)
+	return hash, err
+}
+
+func (n *RecordingNode) IsMining(ctx context.Context) (bool, error) {
+	mining, err := n.EthNode.IsMining(ctx)
+	n.record("IsMining", nil, mining, err)
+	return mining, err
+}
+
+func (n *RecordingNode) IsHealing(ctx context.Context) (bool, error) {
+	healing, err := n.EthNode.IsHealing(ctx)
+	n.record("IsHealing", nil, healing, err)
+	return healing, err
+}
+
+func (n *RecordingNode) SyncProgress(ctx context.Context) (*SyncProgress, error) {
+	progress, err := n.EthNode.SyncProgress(ctx)
+	n.record("SyncProgress", nil, progress, err)
+	return progress, err
+}
+
+func (n *RecordingNode) ChainConfig(ctx context.Context) (*params.ChainConfig, error) {
+	config, err := n.EthNode.ChainConfig(ctx)
+	n.record("ChainConfig", nil, config, err)
+	return config, err
+}
+
+func (n *RecordingNode) BlockGasLimit(ctx context.Context) (uint64, error) {
+	limit, err := n.EthNode.BlockGasLimit(ctx)
+	n.record("BlockGasLimit", nil, limit, err)
+	return limit, err
+}
+
+func (n *RecordingNode) ClientVersion(ctx context.Context) (string, error) {
+	version, err := n.EthNode.ClientVersion(ctx)
+	n.record("ClientVersion", nil, version, err)
+	return version, err
+}
+
+func (n *RecordingNode) TxPoolStatus(ctx context.Context) (pending, queued uint64, err error) {
+	pending, queued, err = n.EthNode.TxPoolStatus(ctx)
+	n.record("TxPoolStatus", nil, txPoolResult{pending, queued}, err)
+	return pending, queued, err
+}
+
+func (n *RecordingNode) NodeUptime(ctx context.Context) (time.Duration, error) {
+	uptime, err := n.EthNode.NodeUptime(ctx)
+	n.record("NodeUptime", nil, uptime, err)
+	return uptime, err
+}
+
+func (n *RecordingNode) ChainHead(ctx context.Context) (*HeadInfo, error) {
+	head, err := n.EthNode.ChainHead(ctx)
+	n.record("ChainHead", nil, head, err)
+	return head, err
+}
+
+// UnexpectedCallError is returned by a ReplayNode when a call doesn't match
+// the next call in the recording.
+type UnexpectedCallError struct {
+	Method string
+	Args   json.RawMessage
+	// Want is the next recorded call, or nil if the recording is exhausted.
+	Want *RecordedCall
+}
+
+func (err UnexpectedCallError) Error() string {
+	if err.Want == nil {
+		return fmt.Sprintf("unexpected call to %s%s after the end of the recording", err.Method, err.Args)
+	}
+	return fmt.Sprintf("unexpected call to %s%s, recording has %s%s", err.Method, err.Args, err.Want.Method, err.Want.Args)
+}
+
+// Replay returns an EthNode which serves the calls of a recording made by
+// Record, in the same order. Calls which don't match the recording fail with
+// UnexpectedCallError.
+func Replay(r io.Reader) (*ReplayNode, error) {
+	scanner := bufio.NewScanner(r)
+	// Lines can be large, such as Peers of a busy node.
+	scanner.Buffer(nil, 64<<20)
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, io.ErrUnexpectedEOF
+	}
+	var header recordingHeader
+	if err := json.Unmarshal(scanner.Bytes(), &header); err != nil {
+		return nil, err
+	}
+	n := &ReplayNode{kind: header.Kind, network: header.Network}
+	for scanner.Scan() {
+		var call RecordedCall
+		if err := json.Unmarshal(scanner.Bytes(), &call); err != nil {
+			return nil, err
+		}
+		n.calls = append(n.calls, call)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+var _ EthNode = &ReplayNode{}
+
+// ReplayNode is an EthNode which serves a recording, returned by Replay.
+type ReplayNode struct {
+	kind    NodeKind
+	network NetworkID
+
+	mu    sync.Mutex
+	calls []RecordedCall
+}
+
+// Remaining returns the number of recorded calls which were not replayed.
+func (n *ReplayNode) Remaining() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return len(n.calls)
+}
+
+// replay checks the call against the next one in the recording, and decodes
+// its result into result.
+func (n *ReplayNode) replay(method string, args []interface{}, result interface{}) error {
+	rawArgs, err := marshalArgs(args)
+	if err != nil {
+		return err
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if len(n.calls) == 0 {
+		return UnexpectedCallError{Method: method, Args: rawArgs}
+	}
+	call := n.calls[0]
+	if call.Method != method || !bytes.Equal(call.Args, rawArgs) {
+		return UnexpectedCallError{Method: method, Args: rawArgs, Want: &call}
+	}
+	n.calls = n.calls[1:]
+
+	if result != nil && len(call.Result) > 0 {
+		if err := json.Unmarshal(call.Result, result); err != nil {
+			return err
+		}
+	}
+	return call.Error.decode()
+}
+
+// ContractBackend returns nil, contract calls are not recorded.
+func (n *ReplayNode) ContractBackend() bind.ContractBackend { return nil }
+
+func (n *ReplayNode) Kind() NodeKind     { return n.kind }
+func (n *ReplayNode) Network() NetworkID { return n.network }
+
+func (n *ReplayNode) Enode(ctx context.Context) (enode string, err error) {
+	err = n.replay("Enode", nil, &enode)
+	return enode, err
+}
+
+func (n *ReplayNode) AddTrustedPeer(ctx context.Context, nodeID string) error {
+	return n.replay("AddTrustedPeer", []interface{}{nodeID}, nil)
+}
+
+func (n *ReplayNode) RemoveTrustedPeer(ctx context.Context, nodeID string) error {
+	return n.replay("RemoveTrustedPeer", []interface{}{nodeID}, nil)
+}
+
+func (n *ReplayNode) ConnectPeer(ctx context.Context, nodeURI string) error {
+	return n.replay("ConnectPeer", []interface{}{nodeURI}, nil)
+}
+
+func (n *ReplayNode) DisconnectPeer(ctx context.Context, nodeID string) error {
+	return n.replay("DisconnectPeer", []interface{}{nodeID}, nil)
+}
+
+func (n *ReplayNode) Peers(ctx context.Context) ([]PeerInfo, error) {
+	var peers []recordedPeer
+	err := n.replay("Peers", nil, &peers)
+	return decodePeers(peers), err
+}
+
+func (n *ReplayNode) PeersLite(ctx context.Context) ([]PeerInfo, error) {
+	var peers []recordedPeer
+	err := n.replay("PeersLite", nil, &peers)
+	return decodePeers(peers), err
+}
+
+func (n *ReplayNode) PeersByKind(ctx context.Context) (kinds map[NodeKind]int, err error) {
+	err = n.replay("PeersByKind", nil, &kinds)
+	return kinds, err
+}
+
+func (n *ReplayNode) PeerSlots(ctx context.Context) (max, used, reserved int, err error) {
+	var r peerSlotsResult
+	err = n.replay("PeerSlots", nil, &r)
+	return r.Max, r.Used, r.Reserved, err
+}
+
+func (n *ReplayNode) BlockNumber(ctx context.Context) (number uint64, err error) {
+	err = n.replay("BlockNumber", nil, &number)
+	return number, err
+}
+
+func (n *ReplayNode) LatestBlock(ctx context.Context) (uint64, time.Time, error) {
+	var r latestBlockResult
+	err := n.replay("LatestBlock", nil, &r)
+	return r.Number, r.Timestamp, err
+}
+
+func (n *ReplayNode) ForkID(ctx context.Context) ([4]byte, uint64, error) {
+	var r forkIDResult
+	err := n.replay("ForkID", nil, &r)
+	return r.Hash, r.Next, err
+}
+
+func (n *ReplayNode) FeeHistory(ctx context.Context, blocks int, rewardPercentiles []float64) (history *FeeHistory, err error) {
+	err = n.replay("FeeHistory", []interface{}{blocks, rewardPercentiles}, &history)
+	return history, err
+}
+
+func (n *ReplayNode) AvailableNamespaces(ctx context.Context) (namespaces map[string]bool, err error) {
+	err = n.replay("AvailableNamespaces", nil, &namespaces)
+	return namespaces, err
+}
+
+func (n *ReplayNode) NonceAt(ctx context.Context, address common.Address, block *big.Int) (nonce uint64, err error) {
+	err = n.replay("NonceAt", []interface{}{address, block}, &nonce)
+	return nonce, err
+}
+
+func (n *ReplayNode) SendRawTransaction(ctx context.Context, signedTx []byte) (hash common.Hash, err error) {
+	err = n.replay("SendRawTransaction", []interface{}{signedTx}, &hash)
+	return hash, err
+}
+
+func (n *ReplayNode) DataDir(ctx context.Context) (path string, err error) {
+	err = n.replay("DataDir", nil, &path)
+	return path, err
+}
+
+func (n *ReplayNode) GenesisHash(ctx context.Context) (hash common.Hash, err error) {
+	err = n.replay("GenesisHash", nil, &hash)
+	return hash, err
+}
+
+func (n *ReplayNode) IsMining(ctx context.Context) (mining bool, err error) {
+	err = n.replay("IsMining", nil, &mining)
+	return mining, err
+}
+
+func (n *ReplayNode) IsHealing(ctx context.Context) (healing bool, err error) {
+	err = n.replay("IsHealing", nil, &healing)
+	return healing, err
+}
+
+func (n *ReplayNode) SyncProgress(ctx context.Context) (progress *SyncProgress, err error) {
+	err = n.replay("SyncProgress", nil, &progress)
+	return progress, err
+}
+
+func (n *ReplayNode) ChainConfig(ctx context.Context) (config *params.ChainConfig, err error) {
+	err = n.replay("ChainConfig", nil, &config)
+	return config, err
+}
+
+func (n *ReplayNode) BlockGasLimit(ctx context.Context) (limit uint64, err error) {
+	err = n.replay("BlockGasLimit", nil, &limit)
+	return limit, err
+}
+
+func (n *ReplayNode) ClientVersion(ctx context.Context) (version string, err error) {
+	err = n.replay("ClientVersion", nil, &version)
+	return version, err
+}
+
+func (n *ReplayNode) TxPoolStatus(ctx context.Context) (pending, queued uint64, err error) {
+	var r txPoolResult
+	err = n.replay("TxPoolStatus", nil, &r)
+	return r.Pending, r.Queued, err
+}
+
+func (n *ReplayNode) NodeUptime(ctx context.Context) (uptime time.Duration, err error) {
+	err = n.replay("NodeUptime", nil, &uptime)
+	return uptime, err
+}
+
+func (n *ReplayNode) ChainHead(ctx context.Context) (head *HeadInfo, err error) {
+	err = n.replay("ChainHead", nil, &head)
+	return head, err
+}
+
+// Close is a noop, since a ReplayNode has no connection.
+func (n *ReplayNode) Close() error {
+	return nil
+}
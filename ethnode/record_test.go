@@ -0,0 +1,131 @@
+package ethnode
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// exerciseNode calls a representative set of EthNode methods and returns
+// their results for comparing.
+func exerciseNode(t *testing.T, node EthNode) []interface{} {
+	ctx := context.Background()
+	var results []interface{}
+	add := func(vals ...interface{}) {
+		for i, v := range vals {
+			if err, ok := v.(error); ok {
+				vals[i] = err.Error()
+			} else if ts, ok := v.(time.Time); ok {
+				vals[i] = ts.UTC()
+			}
+		}
+		results = append(results, vals)
+	}
+
+	enode, err := node.Enode(ctx)
+	add(enode, err)
+	block, err := node.BlockNumber(ctx)
+	add(block, err)
+	number, timestamp, err := node.LatestBlock(ctx)
+	add(number, timestamp, err)
+	peers, err := node.Peers(ctx)
+	add(peers, err)
+	kinds, err := node.PeersByKind(ctx)
+	add(kinds, err)
+	add(node.ConnectPeer(ctx, "enode://bar@127.0.0.1:30303"))
+	namespaces, err := node.AvailableNamespaces(ctx)
+	add(namespaces, err)
+	dataDir, err := node.DataDir(ctx)
+	add(dataDir, err)
+	return results
+}
+
+func TestRecordReplay(t *testing.T) {
+	client := serveMocks(t, map[string]interface{}{
+		"eth":   &MockEth{},
+		"net":   &MockNet{},
+		"admin": &MockAdmin{},
+	})
+	defer client.Close()
+	node := &gethNode{client: client, network: Rinkeby}
+
+	var buf bytes.Buffer
+	recorder, err := Record(node, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := exerciseNode(t, recorder)
+	if err := recorder.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if got := exerciseNode(t, node); !reflect.DeepEqual(got, want) {
+		t.Fatalf("recording changed the results:\n%v\n%v", got, want)
+	}
+
+	replay, err := Replay(strings.NewReader(buf.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replay.Kind() != Geth || replay.Network() != Rinkeby {
+		t.Errorf("wrong replayed node: %s on %s", replay.Kind(), replay.Network())
+	}
+	got := exerciseNode(t, replay)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("replay does not match recording:\ngot:  %v\nwant: %v", got, want)
+	}
+	if n := replay.Remaining(); n != 0 {
+		t.Errorf("%d calls were not replayed", n)
+	}
+
+	// Calls after the end of the recording fail.
+	replay, err = Replay(strings.NewReader(buf.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	exerciseNode(t, replay)
+	if _, err := replay.BlockNumber(context.Background()); err == nil {
+		t.Error("expected error after the end of the recording")
+	} else if err, ok := err.(UnexpectedCallError); !ok || err.Want != nil {
+		t.Errorf("expected UnexpectedCallError, got: %v", err)
+	}
+}
+
+func TestReplayUnexpectedCall(t *testing.T) {
+	client := serveMocks(t, map[string]interface{}{"admin": &MockAdmin{}})
+	defer client.Close()
+
+	var buf bytes.Buffer
+	recorder, err := Record(&gethNode{client: client}, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := recorder.ConnectPeer(context.Background(), "enode://bar@127.0.0.1:30303"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := recorder.DataDir(context.Background()); err != ErrNotSupported {
+		t.Fatalf("expected ErrNotSupported, got: %v", err)
+	}
+
+	replay, err := Replay(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Different arguments
+	err = replay.ConnectPeer(context.Background(), "enode://baz@127.0.0.1:30303")
+	if err, ok := err.(UnexpectedCallError); !ok || err.Want == nil || err.Want.Method != "ConnectPeer" {
+		t.Errorf("expected UnexpectedCallError for different arguments, got: %v", err)
+	}
+	if err := replay.ConnectPeer(context.Background(), "enode://bar@127.0.0.1:30303"); err != nil {
+		t.Errorf("expected matching call to succeed: %s", err)
+	}
+	// Different method
+	if _, err := replay.Enode(context.Background()); err == nil {
+		t.Error("expected UnexpectedCallError for a different method")
+	}
+	if _, err := replay.DataDir(context.Background()); err != ErrNotSupported {
+		t.Errorf("expected replayed ErrNotSupported, got: %v", err)
+	}
+}
@@ -0,0 +1,343 @@
+package ethnode
+
+import (
+	"context"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// DefaultRedetectInterval is how often Redetect re-runs client detection.
+const DefaultRedetectInterval = 10 * time.Minute
+
+// Redetect wraps a node returned by RemoteNode, FromRPCClient or the Dial
+// functions with a RedetectNode, which re-detects the node's client every
+// DefaultRedetectInterval.
+func Redetect(node EthNode) *RedetectNode {
+	return &RedetectNode{
+		Interval: DefaultRedetectInterval,
+		node:     node,
+		checked:  time.Now(),
+	}
+}
+
+// RedetectNode is an EthNode which re-runs DetectClient on its connection
+// from time to time, and switches to the implementation for the new kind of
+// node if it changed, such as when an operator upgrades a node from Parity
+// to Geth in place. Without it, a long-running agent keeps talking to the
+// new client as if it was the old one until it's restarted.
+//
+// Detection runs at the start of the first call after every Interval, and
+// after a call failed to reach the node, since the node may have been
+// restarted as a different client. The newHeads subscriptions carry over to
+// the new implementation. Wrappers around the RedetectNode, like a
+// ManagedNode, keep their state too.
+//
+// Only the concrete nodes created by this package can be re-detected, others
+// are used as is.
+type RedetectNode struct {
+	// Interval is the least time between detections, not counting the ones
+	// after unreachable calls. (Only after unreachable calls if 0)
+	Interval time.Duration
+
+	mu       sync.Mutex
+	node     EthNode
+	checked  time.Time
+	stale    bool // set when a call fails to reach the node
+	checking bool
+}
+
+// Check re-runs client detection right away, and switches to the
+// implementation for the new kind of node if it changed. It returns whether
+// the implementation changed. The current implementation is kept if the
+// detection fails, or if the new kind of node is missing required RPC
+// namespaces.
+func (n *RedetectNode) Check(ctx context.Context) (changed bool, err error) {
+	n.mu.Lock()
+	node := n.node
+	n.mu.Unlock()
+
+	replacement, err := redetect(ctx, node)
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.checked = time.Now()
+	if err != nil {
+		return false, err
+	}
+	n.stale = false
+	if replacement == nil {
+		return false, nil
+	}
+	logger.Printf("Node client changed from %s to %s, switching implementations", node.Kind(), replacement.Kind())
+	n.node = replacement
+	return true, nil
+}
+
+// current returns the node to make a call on, re-detecting its client first
+// if it's due. Concurrent calls use the current node while one of them runs
+// the detection.
+func (n *RedetectNode) current(ctx context.Context) EthNode {
+	n.mu.Lock()
+	due := !n.checking && (n.stale || (n.Interval > 0 && time.Since(n.checked) >= n.Interval))
+	if !due {
+		node := n.node
+		n.mu.Unlock()
+		return node
+	}
+	n.checking = true
+	n.mu.Unlock()
+
+	if _, err := n.Check(ctx); err != nil {
+		logger.Printf("Failed to re-detect the node's client: %s", err)
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.checking = false
+	return n.node
+}
+
+// observe marks the node for detection on the next call if err means that
+// the node was unreachable.
+func (n *RedetectNode) observe(err error) {
+	if _, ok := err.(TransportError); !ok {
+		return
+	}
+	n.mu.Lock()
+	n.stale = true
+	n.mu.Unlock()
+}
+
+// redetect re-runs client detection on the connection of node, and returns
+// the implementation for its new kind, or nil if the kind didn't change or
+// node can't be re-detected.
+func redetect(ctx context.Context, node EthNode) (EthNode, error) {
+	var client *rpc.Client
+	var heads *headCache
+	var subs *subscriptions
+	var borrowed bool
+	switch n := node.(type) {
+	case *gethNode:
+		client, heads, subs, borrowed = n.client, n.heads, n.subs, n.borrowed
+	case *parityNode:
+		client, heads, subs, borrowed = n.client, n.heads, n.subs, n.borrowed
+	default:
+		return nil, nil
+	}
+	version, err := detectClient(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	replacement := newRemoteNode(version, client, heads, subs)
+	if replacement.Kind() == node.Kind() {
+		return nil, nil
+	}
+	namespaces, err := replacement.AvailableNamespaces(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := CheckNamespaces(replacement.Kind(), namespaces); err != nil {
+		return nil, err
+	}
+	switch n := replacement.(type) {
+	case *gethNode:
+		n.borrowed = borrowed
+	case *parityNode:
+		n.borrowed = borrowed
+	}
+	return replacement, nil
+}
+
+func (n *RedetectNode) ContractBackend() bind.ContractBackend {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.node.ContractBackend()
+}
+
+func (n *RedetectNode) Kind() NodeKind {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.node.Kind()
+}
+
+func (n *RedetectNode) Network() NetworkID {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.node.Network()
+}
+
+func (n *RedetectNode) ClientVersion(ctx context.Context) (version string, err error) {
+	version, err = n.current(ctx).ClientVersion(ctx)
+	n.observe(err)
+	return version, err
+}
+
+func (n *RedetectNode) Enode(ctx context.Context) (enode string, err error) {
+	enode, err = n.current(ctx).Enode(ctx)
+	n.observe(err)
+	return enode, err
+}
+
+func (n *RedetectNode) AddTrustedPeer(ctx context.Context, nodeID string) (err error) {
+	err = n.current(ctx).AddTrustedPeer(ctx, nodeID)
+	n.observe(err)
+	return err
+}
+
+func (n *RedetectNode) RemoveTrustedPeer(ctx context.Context, nodeID string) (err error) {
+	err = n.current(ctx).RemoveTrustedPeer(ctx, nodeID)
+	n.observe(err)
+	return err
+}
+
+func (n *RedetectNode) ConnectPeer(ctx context.Context, nodeURI string) (err error) {
+	err = n.current(ctx).ConnectPeer(ctx, nodeURI)
+	n.observe(err)
+	return err
+}
+
+func (n *RedetectNode) DisconnectPeer(ctx context.Context, nodeID string) (err error) {
+	err = n.current(ctx).DisconnectPeer(ctx, nodeID)
+	n.observe(err)
+	return err
+}
+
+func (n *RedetectNode) Peers(ctx context.Context) (peers []PeerInfo, err error) {
+	peers, err = n.current(ctx).Peers(ctx)
+	n.observe(err)
+	return peers, err
+}
+
+func (n *RedetectNode) PeersLite(ctx context.Context) (peers []PeerInfo, err error) {
+	peers, err = n.current(ctx).PeersLite(ctx)
+	n.observe(err)
+	return peers, err
+}
+
+func (n *RedetectNode) PeersByKind(ctx context.Context) (kinds map[NodeKind]int, err error) {
+	kinds, err = n.current(ctx).PeersByKind(ctx)
+	n.observe(err)
+	return kinds, err
+}
+
+func (n *RedetectNode) PeerSlots(ctx context.Context) (max, used, reserved int, err error) {
+	max, used, reserved, err = n.current(ctx).PeerSlots(ctx)
+	n.observe(err)
+	return max, used, reserved, err
+}
+
+func (n *RedetectNode) BlockNumber(ctx context.Context) (blockNumber uint64, err error) {
+	blockNumber, err = n.current(ctx).BlockNumber(ctx)
+	n.observe(err)
+	return blockNumber, err
+}
+
+func (n *RedetectNode) LatestBlock(ctx context.Context) (number uint64, timestamp time.Time, err error) {
+	number, timestamp, err = n.current(ctx).LatestBlock(ctx)
+	n.observe(err)
+	return number, timestamp, err
+}
+
+func (n *RedetectNode) ChainHead(ctx context.Context) (head *HeadInfo, err error) {
+	head, err = n.current(ctx).ChainHead(ctx)
+	n.observe(err)
+	return head, err
+}
+
+func (n *RedetectNode) ForkID(ctx context.Context) (hash [4]byte, next uint64, err error) {
+	hash, next, err = n.current(ctx).ForkID(ctx)
+	n.observe(err)
+	return hash, next, err
+}
+
+func (n *RedetectNode) FeeHistory(ctx context.Context, blocks int, rewardPercentiles []float64) (history *FeeHistory, err error) {
+	history, err = n.current(ctx).FeeHistory(ctx, blocks, rewardPercentiles)
+	n.observe(err)
+	return history, err
+}
+
+func (n *RedetectNode) AvailableNamespaces(ctx context.Context) (namespaces map[string]bool, err error) {
+	namespaces, err = n.current(ctx).AvailableNamespaces(ctx)
+	n.observe(err)
+	return namespaces, err
+}
+
+func (n *RedetectNode) NonceAt(ctx context.Context, address common.Address, block *big.Int) (nonce uint64, err error) {
+	nonce, err = n.current(ctx).NonceAt(ctx, address, block)
+	n.observe(err)
+	return nonce, err
+}
+
+func (n *RedetectNode) SendRawTransaction(ctx context.Context, signedTx []byte) (hash common.Hash, err error) {
+	hash, err = n.current(ctx).SendRawTransaction(ctx, signedTx)
+	n.observe(err)
+	return hash, err
+}
+
+func (n *RedetectNode) DataDir(ctx context.Context) (path string, err error) {
+	path, err = n.current(ctx).DataDir(ctx)
+	n.observe(err)
+	return path, err
+}
+
+func (n *RedetectNode) GenesisHash(ctx context.Context) (hash common.Hash, err error) {
+	hash, err = n.current(ctx).GenesisHash(ctx)
+	n.observe(err)
+	return hash, err
+}
+
+func (n *RedetectNode) IsMining(ctx context.Context) (mining bool, err error) {
+	mining, err = n.current(ctx).IsMining(ctx)
+	n.observe(err)
+	return mining, err
+}
+
+func (n *RedetectNode) IsHealing(ctx context.Context) (healing bool, err error) {
+	healing, err = n.current(ctx).IsHealing(ctx)
+	n.observe(err)
+	return healing, err
+}
+
+func (n *RedetectNode) SyncProgress(ctx context.Context) (progress *SyncProgress, err error) {
+	progress, err = n.current(ctx).SyncProgress(ctx)
+	n.observe(err)
+	return progress, err
+}
+
+func (n *RedetectNode) ChainConfig(ctx context.Context) (config *params.ChainConfig, err error) {
+	config, err = n.current(ctx).ChainConfig(ctx)
+	n.observe(err)
+	return config, err
+}
+
+func (n *RedetectNode) BlockGasLimit(ctx context.Context) (limit uint64, err error) {
+	limit, err = n.current(ctx).BlockGasLimit(ctx)
+	n.observe(err)
+	return limit, err
+}
+
+func (n *RedetectNode) TxPoolStatus(ctx context.Context) (pending, queued uint64, err error) {
+	pending, queued, err = n.current(ctx).TxPoolStatus(ctx)
+	n.observe(err)
+	return pending, queued, err
+}
+
+func (n *RedetectNode) NodeUptime(ctx context.Context) (uptime time.Duration, err error) {
+	uptime, err = n.current(ctx).NodeUptime(ctx)
+	n.observe(err)
+	return uptime, err
+}
+
+// Close closes the current implementation, which owns the subscriptions and
+// connection of the ones before it.
+func (n *RedetectNode) Close() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.node.Close()
+}
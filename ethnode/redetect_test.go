@@ -0,0 +1,110 @@
+package ethnode
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRedetect(t *testing.T) {
+	ctx := context.Background()
+	web3 := &MockWeb3{"Geth/v1.8.21-stable/linux-amd64/go1.11.4"}
+	client := serveMocks(t, map[string]interface{}{
+		"web3":   web3,
+		"eth":    &MockHeadsEth{heads: []map[string]string{{"number": "0x63", "timestamp": "0x5c3a8f4e"}}},
+		"net":    &MockNet{},
+		"admin":  &MockAdmin{},
+		"parity": &MockParity{},
+	})
+	remote, err := remoteNode(ctx, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := remote.(*gethNode)
+	redetect := Redetect(remote)
+	node := Managed(redetect)
+	defer node.Close()
+
+	if err := node.AddTrustedPeer(ctx, "bar"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := node.BlockNumber(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := node.Kind(); got != Geth {
+		t.Fatalf("got kind %s; want geth", got)
+	}
+
+	// The node is upgraded in place, which goes unnoticed until the interval
+	// passes.
+	web3.version = "Parity-Ethereum//v2.0.5-stable/x86_64-linux-gnu/rustc1.29.0"
+	if _, err := node.BlockNumber(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := node.Kind(); got != Geth {
+		t.Errorf("got kind %s before the interval; want geth", got)
+	}
+	redetect.checked = time.Now().Add(-redetect.Interval)
+	if _, err := node.BlockNumber(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := node.Kind(); got != Parity {
+		t.Fatalf("got kind %s after the interval; want parity", got)
+	}
+	after, ok := redetect.node.(*parityNode)
+	if !ok {
+		t.Fatalf("got implementation %T; want *parityNode", redetect.node)
+	}
+	if after.subs != before.subs || after.heads != before.heads || after.client != before.client {
+		t.Error("expected the subscriptions and connection to carry over")
+	}
+	if after.subs.Len() == 0 {
+		t.Error("expected the newHeads subscription to stay active")
+	}
+	if !node.IsManagedPeer("bar") {
+		t.Error("expected managed peers to carry over")
+	}
+
+	// Unreachable calls trigger a detection on the next call.
+	web3.version = "Geth/v1.8.22-stable/linux-amd64/go1.11.4"
+	redetect.observe(TransportError{Method: "eth_blockNumber", Err: errors.New("connection refused")})
+	if _, err := node.Peers(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := node.Kind(); got != Geth {
+		t.Errorf("got kind %s after reconnecting; want geth", got)
+	}
+
+	if changed, err := redetect.Check(ctx); err != nil || changed {
+		t.Errorf("Check: got changed %t, err %v; want unchanged", changed, err)
+	}
+}
+
+func TestRedetectMissingNamespaces(t *testing.T) {
+	ctx := context.Background()
+	web3 := &MockWeb3{"Geth/v1.8.21-stable/linux-amd64/go1.11.4"}
+	client := serveMocks(t, map[string]interface{}{
+		"web3":  web3,
+		"eth":   &MockEth{},
+		"net":   &MockNet{},
+		"admin": &MockAdmin{},
+	})
+	remote, err := remoteNode(ctx, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	redetect := Redetect(remote)
+	defer redetect.Close()
+
+	// Parity without the parity namespace can't be used, so the current
+	// implementation is kept.
+	web3.version = "Parity-Ethereum//v2.0.5-stable/x86_64-linux-gnu/rustc1.29.0"
+	changed, err := redetect.Check(ctx)
+	if _, ok := err.(MissingNamespacesError); !ok {
+		t.Errorf("expected MissingNamespacesError, got: %v", err)
+	}
+	if changed || redetect.Kind() != Geth {
+		t.Errorf("expected to keep the geth implementation, got %s", redetect.Kind())
+	}
+}
@@ -0,0 +1,296 @@
+package ethnode
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// retryable returns whether err is a transient failure to reach the node,
+// such as a reset connection or a timeout, so the same call is likely to
+// succeed if it's retried. RPC error responses are permanent, since the node
+// answered.
+func retryable(err error) bool {
+	switch e := err.(type) {
+	case nil, RPCError, codedError:
+		return false
+	case TransportError:
+		err = e.Err
+	}
+	switch err {
+	case io.EOF, io.ErrUnexpectedEOF:
+		return true
+	case context.Canceled, context.DeadlineExceeded:
+		// The caller gave up, retrying won't help.
+		return false
+	}
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+	if err, ok := err.(net.Error); ok && err.Timeout() {
+		return true
+	}
+	return false
+}
+
+// Retry wraps node with a RetryNode using default settings.
+func Retry(node EthNode) *RetryNode {
+	return &RetryNode{
+		EthNode:  node,
+		Attempts: 3,
+		Backoff:  100 * time.Millisecond,
+	}
+}
+
+// RetryNode is an EthNode which retries calls that fail with a transient
+// error, up to Attempts times in total, waiting Backoff between attempts and
+// doubling it each time. Permanent errors are returned right away.
+//
+// Calls that change the node's peers (ConnectPeer, DisconnectPeer,
+// AddTrustedPeer and RemoveTrustedPeer) may have been applied even if the
+// response was lost, so they are only retried if RetryMutations is set.
+type RetryNode struct {
+	EthNode
+
+	Attempts       int
+	Backoff        time.Duration
+	RetryMutations bool
+}
+
+// retry calls fn until it succeeds, fails with a permanent error, runs out of
+// attempts, or ctx is done.
+func (n *RetryNode) retry(ctx context.Context, mutation bool, fn func() error) error {
+	backoff := n.Backoff
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if attempt >= n.Attempts || !retryable(err) || (mutation && !n.RetryMutations) || ctx.Err() != nil {
+			return err
+		}
+		logger.Printf("Retrying transient node error (attempt %d of %d): %s", attempt+1, n.Attempts, err)
+		t := time.NewTimer(backoff)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		}
+		backoff *= 2
+	}
+}
+
+func (n *RetryNode) Enode(ctx context.Context) (enode string, err error) {
+	err = n.retry(ctx, false, func() error {
+		enode, err = n.EthNode.Enode(ctx)
+		return err
+	})
+	return enode, err
+}
+
+func (n *RetryNode) AddTrustedPeer(ctx context.Context, nodeID string) error {
+	return n.retry(ctx, true, func() error {
+		return n.EthNode.AddTrustedPeer(ctx, nodeID)
+	})
+}
+
+func (n *RetryNode) RemoveTrustedPeer(ctx context.Context, nodeID string) error {
+	return n.retry(ctx, true, func() error {
+		return n.EthNode.RemoveTrustedPeer(ctx, nodeID)
+	})
+}
+
+func (n *RetryNode) ConnectPeer(ctx context.Context, nodeURI string) error {
+	return n.retry(ctx, true, func() error {
+		return n.EthNode.ConnectPeer(ctx, nodeURI)
+	})
+}
+
+func (n *RetryNode) DisconnectPeer(ctx context.Context, nodeID string) error {
+	return n.retry(ctx, true, func() error {
+		return n.EthNode.DisconnectPeer(ctx, nodeID)
+	})
+}
+
+func (n *RetryNode) Peers(ctx context.Context) (peers []PeerInfo, err error) {
+	err = n.retry(ctx, false, func() error {
+		peers, err = n.EthNode.Peers(ctx)
+		return err
+	})
+	return peers, err
+}
+
+func (n *RetryNode) PeersLite(ctx context.Context) (peers []PeerInfo, err error) {
+	err = n.retry(ctx, false, func() error {
+		peers, err = n.EthNode.PeersLite(ctx)
+		return err
+	})
+	return peers, err
+}
+
+func (n *RetryNode) PeersByKind(ctx context.Context) (kinds map[NodeKind]int, err error) {
+	err = n.retry(ctx, false, func() error {
+		kinds, err = n.EthNode.PeersByKind(ctx)
+		return err
+	})
+	return kinds, err
+}
+
+func (n *RetryNode) PeerSlots(ctx context.Context) (max, used, reserved int, err error) {
+	err = n.retry(ctx, false, func() error {
+		max, used, reserved, err = n.EthNode.PeerSlots(ctx)
+		return err
+	})
+	return max, used, reserved, err
+}
+
+func (n *RetryNode) BlockNumber(ctx context.Context) (blockNumber uint64, err error) {
+	err = n.retry(ctx, false, func() error {
+		blockNumber, err = n.EthNode.BlockNumber(ctx)
+		return err
+	})
+	return blockNumber, err
+}
+
+func (n *RetryNode) LatestBlock(ctx context.Context) (number uint64, timestamp time.Time, err error) {
+	err = n.retry(ctx, false, func() error {
+		number, timestamp, err = n.EthNode.LatestBlock(ctx)
+		return err
+	})
+	return number, timestamp, err
+}
+
+func (n *RetryNode) ForkID(ctx context.Context) (hash [4]byte, next uint64, err error) {
+	err = n.retry(ctx, false, func() error {
+		hash, next, err = n.EthNode.ForkID(ctx)
+		return err
+	})
+	return hash, next, err
+}
+
+func (n *RetryNode) FeeHistory(ctx context.Context, blocks int, rewardPercentiles []float64) (history *FeeHistory, err error) {
+	err = n.retry(ctx, false, func() error {
+		history, err = n.EthNode.FeeHistory(ctx, blocks, rewardPercentiles)
+		return err
+	})
+	return history, err
+}
+
+func (n *RetryNode) AvailableNamespaces(ctx context.Context) (namespaces map[string]bool, err error) {
+	err = n.retry(ctx, false, func() error {
+		namespaces, err = n.EthNode.AvailableNamespaces(ctx)
+		return err
+	})
+	return namespaces, err
+}
+
+func (n *RetryNode) NonceAt(ctx context.Context, address common.Address, block *big.Int) (nonce uint64, err error) {
+	err = n.retry(ctx, false, func() error {
+		nonce, err = n.EthNode.NonceAt(ctx, address, block)
+		return err
+	})
+	return nonce, err
+}
+
+func (n *RetryNode) SendRawTransaction(ctx context.Context, signedTx []byte) (hash common.Hash, err error) {
+	// Resending the same signed transaction is safe, a duplicate is rejected
+	// as TxAlreadyKnown along with its hash.
+	err = n.retry(ctx, false, func() error {
+		hash, err = n.EthNode.SendRawTransaction(ctx, signedTx)
+		return err
+	})
+	return hash, err
+}
+
+func (n *RetryNode) DataDir(ctx context.Context) (path string, err error) {
+	err = n.retry(ctx, false, func() error {
+		path, err = n.EthNode.DataDir(ctx)
+		return err
+	})
+	return path, err
+}
+
+func (n *RetryNode) GenesisHash(ctx context.Context) (hash common.Hash, err error) {
+	err = n.retry(ctx, false, func() error {
+		hash, err = n.EthNode.GenesisHash(ctx)
+		return err
+	})
+	return hash, err
+}
+
+func (n *RetryNode) IsMining(ctx context.Context) (mining bool, err error) {
+	err = n.retry(ctx, false, func() error {
+		mining, err = n.EthNode.IsMining(ctx)
+		return err
+	})
+	return mining, err
+}
+
+func (n *RetryNode) IsHealing(ctx context.Context) (healing bool, err error) {
+	err = n.retry(ctx, false, func() error {
+		healing, err = n.EthNode.IsHealing(ctx)
+		return err
+	})
+	return healing, err
+}
+
+func (n *RetryNode) SyncProgress(ctx context.Context) (progress *SyncProgress, err error) {
+	err = n.retry(ctx, false, func() error {
+		progress, err = n.EthNode.SyncProgress(ctx)
+		return err
+	})
+	return progress, err
+}
+
+func (n *RetryNode) ChainConfig(ctx context.Context) (config *params.ChainConfig, err error) {
+	err = n.retry(ctx, false, func() error {
+		config, err = n.EthNode.ChainConfig(ctx)
+		return err
+	})
+	return config, err
+}
+
+func (n *RetryNode) BlockGasLimit(ctx context.Context) (limit uint64, err error) {
+	err = n.retry(ctx, false, func() error {
+		limit, err = n.EthNode.BlockGasLimit(ctx)
+		return err
+	})
+	return limit, err
+}
+
+func (n *RetryNode) ClientVersion(ctx context.Context) (version string, err error) {
+	err = n.retry(ctx, false, func() error {
+		version, err = n.EthNode.ClientVersion(ctx)
+		return err
+	})
+	return version, err
+}
+
+func (n *RetryNode) TxPoolStatus(ctx context.Context) (pending, queued uint64, err error) {
+	err = n.retry(ctx, false, func() error {
+		pending, queued, err = n.EthNode.TxPoolStatus(ctx)
+		return err
+	})
+	return pending, queued, err
+}
+
+func (n *RetryNode) NodeUptime(ctx context.Context) (uptime time.Duration, err error) {
+	err = n.retry(ctx, false, func() error {
+		uptime, err = n.EthNode.NodeUptime(ctx)
+		return err
+	})
+	return uptime, err
+}
+
+func (n *RetryNode) ChainHead(ctx context.Context) (head *HeadInfo, err error) {
+	err = n.retry(ctx, false, func() error {
+		head, err = n.EthNode.ChainHead(ctx)
+		return err
+	})
+	return head, err
+}
@@ -0,0 +1,137 @@
+package ethnode
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+// flakyNode is a fake EthNode whose calls fail with the queued errors before
+// succeeding.
+type flakyNode struct {
+	EthNode
+	errs  []error
+	calls int
+}
+
+func (n *flakyNode) next() error {
+	n.calls++
+	if len(n.errs) == 0 {
+		return nil
+	}
+	err := n.errs[0]
+	n.errs = n.errs[1:]
+	return err
+}
+
+func (n *flakyNode) BlockNumber(ctx context.Context) (uint64, error) {
+	return 42, n.next()
+}
+
+func (n *flakyNode) ConnectPeer(ctx context.Context, nodeURI string) error {
+	return n.next()
+}
+
+func TestRetryable(t *testing.T) {
+	reset := &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}
+	testcases := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{io.EOF, true},
+		{TransportError{"eth_blockNumber", io.ErrUnexpectedEOF}, true},
+		{TransportError{"eth_blockNumber", reset}, true},
+		{TransportError{"eth_blockNumber", timeoutError{}}, true},
+		{TransportError{"eth_blockNumber", context.DeadlineExceeded}, false},
+		{TransportError{"eth_blockNumber", errors.New("client is closed")}, false},
+		{RPCError{"eth_blockNumber", errCodeMethodNotFound, "method not found"}, false},
+		{rpcError{}, false},
+		{ErrCircuitOpen, false},
+	}
+	for _, tc := range testcases {
+		if got := retryable(tc.err); got != tc.want {
+			t.Errorf("retryable(%v): got %t; want %t", tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestRetryNode(t *testing.T) {
+	ctx := context.Background()
+	transient := TransportError{"eth_blockNumber", io.EOF}
+	permanent := RPCError{"eth_blockNumber", -32000, "header not found"}
+
+	node := &flakyNode{errs: []error{transient, transient}}
+	r := Retry(node)
+	r.Backoff = 0
+	if n, err := r.BlockNumber(ctx); err != nil || n != 42 {
+		t.Errorf("expected transient errors to be retried, got: %d, %v", n, err)
+	}
+	if node.calls != 3 {
+		t.Errorf("expected 3 calls, got %d", node.calls)
+	}
+
+	// Attempts are bounded
+	node = &flakyNode{errs: []error{transient, transient, transient, transient}}
+	r = Retry(node)
+	r.Backoff = 0
+	if _, err := r.BlockNumber(ctx); err != transient {
+		t.Errorf("expected transient error after running out of attempts, got: %v", err)
+	}
+	if node.calls != 3 {
+		t.Errorf("expected 3 calls, got %d", node.calls)
+	}
+
+	// Permanent errors are not retried
+	node = &flakyNode{errs: []error{permanent}}
+	r = Retry(node)
+	r.Backoff = 0
+	if _, err := r.BlockNumber(ctx); err != permanent {
+		t.Errorf("expected permanent error, got: %v", err)
+	}
+	if node.calls != 1 {
+		t.Errorf("expected 1 call, got %d", node.calls)
+	}
+
+	// Mutations are only retried if allowed
+	node = &flakyNode{errs: []error{transient}}
+	r = Retry(node)
+	r.Backoff = 0
+	if err := r.ConnectPeer(ctx, "enode://foo@127.0.0.1:30303"); err != transient {
+		t.Errorf("expected mutation not to be retried, got: %v", err)
+	}
+	if node.calls != 1 {
+		t.Errorf("expected 1 call, got %d", node.calls)
+	}
+	r.RetryMutations = true
+	node.errs = []error{transient}
+	if err := r.ConnectPeer(ctx, "enode://foo@127.0.0.1:30303"); err != nil {
+		t.Errorf("expected allowed mutation to be retried, got: %v", err)
+	}
+	if node.calls != 3 {
+		t.Errorf("expected 3 calls, got %d", node.calls)
+	}
+}
+
+func TestRetryNodeCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	transient := TransportError{"eth_blockNumber", io.EOF}
+	node := &flakyNode{errs: []error{transient, transient}}
+	if _, err := Retry(node).BlockNumber(ctx); err != transient {
+		t.Errorf("expected transient error, got: %v", err)
+	}
+	if node.calls != 1 {
+		t.Errorf("expected no retries after the context is done, got %d calls", node.calls)
+	}
+}
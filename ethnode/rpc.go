@@ -2,10 +2,16 @@ package ethnode
 
 import (
 	"context"
+	"encoding/json"
+	"math/big"
+	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/params"
 	"github.com/ethereum/go-ethereum/rpc"
 )
 
@@ -18,6 +24,8 @@ const (
 	Parity
 )
 
+// NetworkID identifies an Ethereum network, by either its net_version
+// network ID or its eth_chainId chain ID (see UserAgent.SetChainID).
 type NetworkID int
 
 const (
@@ -25,21 +33,45 @@ const (
 	Morden  NetworkID = 2
 	Ropsten NetworkID = 3
 	Rinkeby NetworkID = 4
+	Goerli  NetworkID = 5
 	Kovan   NetworkID = 42
+	Classic NetworkID = 61 // Chain ID, its network ID is the same as Mainnet
+	Holesky NetworkID = 17000
+	Sepolia NetworkID = 11155111
 )
 
+// knownNetworks are the canonical names of networks by their network ID and
+// chain ID. Most networks use the same value for both.
+var knownNetworks = []struct {
+	name      string
+	networkID NetworkID
+	chainID   NetworkID
+}{
+	{"mainnet", Mainnet, Mainnet},
+	{"morden", Morden, Morden},
+	{"ropsten", Ropsten, Ropsten},
+	{"rinkeby", Rinkeby, Rinkeby},
+	{"goerli", Goerli, Goerli},
+	{"kovan", Kovan, Kovan},
+	{"holesky", Holesky, Holesky},
+	{"sepolia", Sepolia, Sepolia},
+	{"classic", Mainnet, Classic},
+	{"mordor", 7, 63},
+}
+
+// String returns the canonical name of the network, whether the ID is a chain
+// ID or a network ID. Chain IDs take precedence, since network IDs can be
+// shared by forks.
 func (id NetworkID) String() string {
-	switch id {
-	case Mainnet:
-		return "mainnet"
-	case Morden:
-		return "morden"
-	case Ropsten:
-		return "ropsten"
-	case Rinkeby:
-		return "rinkeby"
-	case Kovan:
-		return "kovan"
+	for _, network := range knownNetworks {
+		if network.chainID == id {
+			return network.name
+		}
+	}
+	for _, network := range knownNetworks {
+		if network.networkID == id {
+			return network.name
+		}
 	}
 	return "unknown"
 }
@@ -62,34 +94,49 @@ func (n NodeKind) String() string {
 
 // UserAgent is the metadata about node client.
 type UserAgent struct {
-	Version     string // Result of web3_clientVersion
-	EthProtocol string // Result of eth_protocolVersion
+	Version     string    // Result of web3_clientVersion
+	EthProtocol string    // Result of eth_protocolVersion
+	NetVersion  NetworkID // Result of net_version
+	ChainID     uint64    // Result of eth_chainId, or 0 if unsupported
 
 	// Parsed/derived values
 	Kind       NodeKind  // Node implementation
-	Network    NetworkID // Network ID
+	Network    NetworkID // Network identity, by chain ID if known (see SetChainID)
 	IsFullNode bool      // Is this a full node? (or a light client?)
+	IsPoS      bool      // Is the chain past the merge? (see detectPoS)
+}
+
+// SetChainID sets the chain ID from eth_chainId, which then identifies the
+// network instead of the net_version network ID. Forks like Ethereum Classic
+// keep the network ID of the chain they forked from, but have their own chain
+// ID, so net_version alone would pair incompatible nodes. It returns false if
+// the chain ID and network ID disagree.
+func (agent *UserAgent) SetChainID(chainID uint64) bool {
+	agent.ChainID = chainID
+	if chainID == 0 {
+		agent.Network = agent.NetVersion
+		return true
+	}
+	agent.Network = NetworkID(chainID)
+	return agent.Network == agent.NetVersion
 }
 
 // ParseUserAgent takes string values as output from the web3 RPC for
 // web3_clientVersion, eth_protocolVersion, and net_version. It returns a
 // parsed user agent metadata.
 func ParseUserAgent(clientVersion, protocolVersion, netVersion string) (*UserAgent, error) {
-	networkID, err := strconv.Atoi(netVersion)
+	networkID, err := parseNetworkID(netVersion)
 	if err != nil {
 		return nil, err
 	}
 	agent := &UserAgent{
 		Version:     clientVersion,
 		EthProtocol: protocolVersion,
-		Network:     NetworkID(networkID),
+		NetVersion:  networkID,
+		Network:     networkID,
 		IsFullNode:  true,
 	}
-	if strings.HasPrefix(agent.Version, "Geth/") {
-		agent.Kind = Geth
-	} else if strings.HasPrefix(agent.Version, "Parity-Ethereum/") || strings.HasPrefix(agent.Version, "Parity/") {
-		agent.Kind = Parity
-	}
+	agent.Kind = parseClientKind(agent.Version)
 
 	protocol, err := strconv.ParseInt(protocolVersion, 0, 32)
 	if err != nil {
@@ -105,37 +152,220 @@ func ParseUserAgent(clientVersion, protocolVersion, netVersion string) (*UserAge
 	return agent, nil
 }
 
-// Dial is a wrapper around go-ethereum/rpc.Dial with client detection.
+// parseClientKind detects the node implementation from a client version
+// string, such as "Geth/v1.8.21-stable/linux-amd64/go1.11.4", which is both
+// the web3_clientVersion of a node and the name it advertises to its peers.
+func parseClientKind(version string) NodeKind {
+	if strings.HasPrefix(version, "Geth/") {
+		return Geth
+	} else if strings.HasPrefix(version, "Parity-Ethereum/") || strings.HasPrefix(version, "Parity/") {
+		return Parity
+	}
+	return Unknown
+}
+
+// parseNetworkID parses a net_version result, which is normally decimal but
+// some RPC proxies return as a hex quantity.
+func parseNetworkID(netVersion string) (NetworkID, error) {
+	var id uint64
+	var err error
+	if strings.HasPrefix(netVersion, "0x") || strings.HasPrefix(netVersion, "0X") {
+		id, err = strconv.ParseUint(netVersion[2:], 16, 32)
+	} else {
+		id, err = strconv.ParseUint(netVersion, 10, 32)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return NetworkID(id), nil
+}
+
+// Dial is a wrapper around go-ethereum/rpc.Dial with client detection. The
+// ctx bounds both connecting and detecting the client.
 func Dial(ctx context.Context, uri string) (EthNode, error) {
 	client, err := rpc.DialContext(ctx, uri)
 	if err != nil {
 		return nil, err
 	}
 
-	return RemoteNode(client)
+	return remoteNode(ctx, client)
+}
+
+// DialHTTPClient is Dial with a custom http.Client for http:// and https://
+// URIs, so that nodes can share connections and keep-alive, idle connection
+// and timeout settings. Other URIs, or a nil httpClient, are dialed like Dial.
+func DialHTTPClient(ctx context.Context, uri string, httpClient *http.Client) (EthNode, error) {
+	if httpClient == nil || !(strings.HasPrefix(uri, "http://") || strings.HasPrefix(uri, "https://")) {
+		return Dial(ctx, uri)
+	}
+	client, err := rpc.DialHTTPWithClient(uri, httpClient)
+	if err != nil {
+		return nil, err
+	}
+
+	return remoteNode(ctx, client)
 }
 
 // DetectClient queries the RPC API to determine which kind of node is running.
 func DetectClient(client *rpc.Client) (*UserAgent, error) {
+	return detectClient(context.Background(), client)
+}
+
+func detectClient(ctx context.Context, client *rpc.Client) (*UserAgent, error) {
 	var clientVersion string
-	if err := client.Call(&clientVersion, "web3_clientVersion"); err != nil {
+	if err := client.CallContext(ctx, &clientVersion, "web3_clientVersion"); err != nil {
 		return nil, err
 	}
 	var protocolVersion string
-	if err := client.Call(&protocolVersion, "eth_protocolVersion"); err != nil {
+	if err := client.CallContext(ctx, &protocolVersion, "eth_protocolVersion"); err != nil {
 		return nil, err
 	}
 	var netVersion string
-	if err := client.Call(&netVersion, "net_version"); err != nil {
+	if err := client.CallContext(ctx, &netVersion, "net_version"); err != nil {
 		return nil, err
 	}
-	return ParseUserAgent(clientVersion, protocolVersion, netVersion)
+	agent, err := ParseUserAgent(clientVersion, protocolVersion, netVersion)
+	if err != nil {
+		return nil, err
+	}
+	// eth_chainId (EIP-695) is not supported by older nodes, so ignore errors.
+	var chainID string
+	if err := client.CallContext(ctx, &chainID, "eth_chainId"); err == nil {
+		id, err := strconv.ParseUint(chainID, 0, 64)
+		if err == nil && !agent.SetChainID(id) {
+			logger.Printf("Node's chain ID %d disagrees with its network ID %d, using the chain ID to identify the network.", agent.ChainID, agent.NetVersion)
+		}
+	}
+	// A node which hasn't synced any blocks yet can't tell, so ignore errors.
+	if pos, err := detectPoS(ctx, client); err == nil {
+		agent.IsPoS = pos
+	}
+	return agent, nil
+}
+
+// clientVersion is the ClientVersion implementation shared by node kinds.
+func clientVersion(ctx context.Context, client *rpc.Client) (string, error) {
+	var version string
+	if err := call(ctx, client, &version, "web3_clientVersion"); err != nil {
+		return "", err
+	}
+	return version, nil
 }
 
 // PeerInfo stores the node ID and client metadata about a peer.
 type PeerInfo struct {
-	ID   string `json:"id"`   // Unique node identifier (also the encryption pubkey)
-	Name string `json:"name"` // Name of the node, including client type, version, OS, custom data
+	ID   string   `json:"id"`   // Unique node identifier (also the encryption pubkey)
+	Name string   `json:"name"` // Name of the node, including client type, version, OS, custom data
+	Caps []string `json:"caps"` // Protocols advertised by the peer, such as "les/2"
+
+	// Inbound is set if the peer dialed us. Only Geth reports the direction
+	// of connections, so it's always false for Parity peers.
+	Inbound bool `json:"-"`
+	// RemoteAddress is the IP and port of the peer's end of the connection.
+	RemoteAddress string `json:"-"`
+	// Static and Trusted are set for peers which Geth keeps connected because
+	// they're configured as static or trusted nodes, rather than found by
+	// discovery. Parity doesn't flag them (see IsStatic).
+	Static  bool `json:"-"`
+	Trusted bool `json:"-"`
+	// Head is the head block that the peer advertised, or nil if it didn't
+	// (see PeerHead).
+	Head *PeerHead `json:"-"`
+
+	// Managed is set by ManagedNode if the peer was added as a trusted peer.
+	Managed bool `json:"-"`
+}
+
+// Kind returns the peer's node implementation, parsed from its client name.
+func (p PeerInfo) Kind() NodeKind {
+	return parseClientKind(p.Name)
+}
+
+// CountPeersByKind returns the number of peers of each node kind.
+func CountPeersByKind(peers []PeerInfo) map[NodeKind]int {
+	kinds := map[NodeKind]int{}
+	for _, peer := range peers {
+		kinds[peer.Kind()]++
+	}
+	return kinds
+}
+
+// UnmarshalJSON decodes a peer, including the connection details nested in
+// its network field and the head block from its protocols.
+func (p *PeerInfo) UnmarshalJSON(data []byte) error {
+	type peerInfo PeerInfo
+	var peer struct {
+		peerInfo
+		Network struct {
+			RemoteAddress string `json:"remoteAddress"`
+			Inbound       bool   `json:"inbound"`
+			Static        bool   `json:"static"`
+			Trusted       bool   `json:"trusted"`
+		} `json:"network"`
+		Protocols map[string]json.RawMessage `json:"protocols"`
+	}
+	if err := json.Unmarshal(data, &peer); err != nil {
+		return err
+	}
+	*p = PeerInfo(peer.peerInfo)
+	p.Inbound = peer.Network.Inbound
+	p.RemoteAddress = peer.Network.RemoteAddress
+	p.Static = peer.Network.Static
+	p.Trusted = peer.Network.Trusted
+	p.Head = parsePeerHead(peer.Protocols)
+	return nil
+}
+
+// parsePeers decodes each entry of a raw peer list from method on its own, so
+// that a malformed entry only loses that peer rather than the whole list. If
+// lite is set, only the fields of litePeer are decoded. Along with the peers
+// which parsed, it returns a PartialPeersError if any entries were skipped.
+func parsePeers(method string, raw []json.RawMessage, lite bool) ([]PeerInfo, error) {
+	peers := make([]PeerInfo, 0, len(raw))
+	var partial *PartialPeersError
+	for _, entry := range raw {
+		var peer PeerInfo
+		var err error
+		if lite {
+			var p litePeer
+			err = json.Unmarshal(entry, &p)
+			peer = PeerInfo{ID: p.ID, Name: p.Name}
+		} else {
+			err = json.Unmarshal(entry, &peer)
+		}
+		if err != nil {
+			if partial == nil {
+				partial = &PartialPeersError{Method: method, Total: len(raw), Err: err}
+			}
+			partial.Skipped++
+			continue
+		}
+		peers = append(peers, peer)
+	}
+	if partial != nil {
+		logger.Printf("Warning: %s", partial)
+		return peers, *partial
+	}
+	return peers, nil
+}
+
+// litePeer is the subset of peer fields decoded by PeersLite. Skipping the
+// remaining fields (caps, protocols, network) avoids most of the decoding
+// allocations on nodes with many peers.
+type litePeer struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// HasProtocol returns whether the peer has a capability for the protocol
+// name, such as "les", at any version.
+func (p PeerInfo) HasProtocol(name string) bool {
+	for _, cap := range p.Caps {
+		if cap == name || strings.HasPrefix(cap, name+"/") {
+			return true
+		}
+	}
+	return false
 }
 
 // EthNode is the normalized interface between different kinds of nodes.
@@ -144,6 +374,12 @@ type EthNode interface {
 
 	// Kind returns the kind of node this is.
 	Kind() NodeKind
+	// ClientVersion returns the node's web3_clientVersion, such as
+	// "Geth/v1.8.21-stable/linux-amd64/go1.11.4".
+	ClientVersion(ctx context.Context) (string, error)
+	// Network returns the network ID detected when connecting to the node, or
+	// 0 if unknown.
+	Network() NetworkID
 	// Enode returns this node's enode://...
 	Enode(ctx context.Context) (string, error)
 	// AddTrustedPeer adds a nodeID to a set of nodes that can always connect, even
@@ -153,32 +389,152 @@ type EthNode interface {
 	RemoveTrustedPeer(ctx context.Context, nodeID string) error
 	// ConnectPeer prompts a connection to the given nodeURI.
 	ConnectPeer(ctx context.Context, nodeURI string) error
-	// DisconnectPeer disconnects from the given nodeID, if connected.
+	// DisconnectPeer drops the live connection to the given nodeID, if
+	// connected. Unlike RemoveTrustedPeer, it leaves the trusted set alone, so
+	// a trusted peer is still allowed to reconnect.
 	DisconnectPeer(ctx context.Context, nodeID string) error
 	// Peers returns the list of connected peers
 	Peers(ctx context.Context) ([]PeerInfo, error)
+	// PeersLite returns the list of connected peers with only the ID and
+	// Name fields set, which is cheaper for frequent polling.
+	PeersLite(ctx context.Context) ([]PeerInfo, error)
+	// PeersByKind returns the number of connected peers of each node kind,
+	// parsed from their client names. Unrecognized clients are Unknown.
+	PeersByKind(ctx context.Context) (map[NodeKind]int, error)
+	// PeerSlots returns the maximum number of peers, how many are connected,
+	// and how many of those are reserved (trusted or static). Max is 0 if the
+	// node doesn't expose its limit.
+	PeerSlots(ctx context.Context) (max, used, reserved int, err error)
 	// BlockNumber returns the current sync'd block number.
 	BlockNumber(ctx context.Context) (uint64, error)
+	// LatestBlock returns the current sync'd block number and its timestamp.
+	LatestBlock(ctx context.Context) (number uint64, timestamp time.Time, err error)
+	// ChainHead returns the number, hash and timestamp of the node's latest
+	// block, along with the chain's total difficulty where the node provides
+	// it.
+	ChainHead(ctx context.Context) (*HeadInfo, error)
+	// ForkID returns the node's current EIP-2124 fork ID: the fork hash and
+	// the block number of the next scheduled fork, or 0 if none.
+	ForkID(ctx context.Context) (hash [4]byte, next uint64, err error)
+	// FeeHistory returns the EIP-1559 base fees and priority fee rewards at
+	// the given percentiles for the latest number of blocks. It returns
+	// ErrNotSupported if the node or its chain doesn't support EIP-1559.
+	FeeHistory(ctx context.Context, blocks int, rewardPercentiles []float64) (*FeeHistory, error)
+	// AvailableNamespaces returns whether each RPC namespace that vipnode
+	// knows about, like "eth" or "admin", is enabled on the node. The result
+	// is cached after the first successful call.
+	AvailableNamespaces(ctx context.Context) (map[string]bool, error)
+	// NonceAt returns the number of transactions sent from address as of the
+	// given block, which is the nonce of its next transaction. A nil block
+	// includes pending transactions.
+	NonceAt(ctx context.Context, address common.Address, block *big.Int) (uint64, error)
+	// SendRawTransaction submits a signed, RLP-encoded transaction and
+	// returns its hash. A TxRejectedError is returned if the node doesn't
+	// accept it.
+	SendRawTransaction(ctx context.Context, signedTx []byte) (common.Hash, error)
+	// DataDir returns the path of the node's data directory on the node's
+	// host. It returns ErrNotSupported if the node doesn't expose it, such as
+	// when the admin API is disabled.
+	DataDir(ctx context.Context) (string, error)
+	// GenesisHash returns the hash of the node's block zero, which uniquely
+	// identifies its chain even when network and chain IDs collide.
+	GenesisHash(ctx context.Context) (common.Hash, error)
+	// IsMining returns whether the node is producing blocks, as a miner or
+	// validator. It returns ErrNotSupported if the node doesn't expose it, or
+	// if the node is past the merge, since its consensus client produces the
+	// blocks.
+	IsMining(ctx context.Context) (bool, error)
+	// IsHealing returns whether the node is healing its state after a snap
+	// sync, during which it may serve stale state.
+	IsHealing(ctx context.Context) (bool, error)
+	// SyncProgress returns the node's sync progress from eth_syncing, or nil
+	// if it's not syncing.
+	SyncProgress(ctx context.Context) (*SyncProgress, error)
+	// ChainConfig returns the node's chain config, with the blocks where
+	// each fork activates. It comes from debug_chainConfig where the node
+	// provides it, or the built-in go-ethereum config of known networks.
+	// Otherwise it returns ErrNotSupported.
+	ChainConfig(ctx context.Context) (*params.ChainConfig, error)
+	// BlockGasLimit returns the gas limit of the latest block. It's cached
+	// briefly, since it only drifts slowly between blocks.
+	BlockGasLimit(ctx context.Context) (uint64, error)
+	// TxPoolStatus returns the number of pending and queued transactions in
+	// the node's transaction pool, from txpool_status. It returns
+	// ErrNotSupported if the txpool API is disabled.
+	TxPoolStatus(ctx context.Context) (pending, queued uint64, err error)
+	// NodeUptime returns how long the node's process has been running. A
+	// freshly restarted node may still be finding peers and catching up. It
+	// returns ErrNotSupported if the node doesn't reveal when it started.
+	NodeUptime(ctx context.Context) (time.Duration, error)
+	// Close tears down the node's subscriptions, waiting for the goroutines
+	// serving them, and disconnects its RPC client.
+	Close() error
 }
 
 // RemoteNode autodetects the node kind and returns the appropriate EthNode
 // implementation.
 func RemoteNode(client *rpc.Client) (EthNode, error) {
-	version, err := DetectClient(client)
+	return remoteNode(context.TODO(), client)
+}
+
+// FromRPCClient wraps an existing RPC client as an EthNode, detecting the
+// node kind on it like Dial does, so that apps embedding vipnode don't need a
+// second connection to their node. The client stays owned by the caller:
+// closing the node tears down its subscriptions but leaves the client open.
+//
+// To share the connection of an *ethclient.Client, pass the *rpc.Client it
+// was made from with ethclient.NewClient, since ethclient doesn't expose it.
+// The node's ContractBackend uses the same connection.
+func FromRPCClient(ctx context.Context, client *rpc.Client) (EthNode, error) {
+	node, err := remoteNode(ctx, client)
 	if err != nil {
 		return nil, err
 	}
+	switch n := node.(type) {
+	case *gethNode:
+		n.borrowed = true
+	case *parityNode:
+		n.borrowed = true
+	}
+	return node, nil
+}
+
+// newRemoteNode returns the EthNode implementation for the detected kind of
+// node, served over client.
+func newRemoteNode(version *UserAgent, client *rpc.Client, heads *headCache, subs *subscriptions) EthNode {
 	switch version.Kind {
 	case Parity:
-		return &parityNode{client: client}, nil
+		return &parityNode{client: client, network: version.Network, pos: version.IsPoS, heads: heads, subs: subs}
 	default:
 		// Treat everything else as Geth
 		// FIXME: Is this a bad idea?
-		node := &gethNode{client: client}
-		ctx := context.TODO()
-		if err := node.CheckCompatible(ctx); err != nil {
-			return nil, err
-		}
-		return node, nil
+		return &gethNode{client: client, network: version.Network, pos: version.IsPoS, heads: heads, subs: subs}
+	}
+}
+
+func remoteNode(ctx context.Context, client *rpc.Client) (EthNode, error) {
+	version, err := detectClient(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	// Serve block numbers from a newHeads subscription when possible, instead
+	// of polling.
+	subs := &subscriptions{}
+	heads, err := subscribeHeads(ctx, client, subs)
+	if err != nil {
+		logger.Printf("Block subscriptions unavailable, polling instead: %s", err)
+	}
+	node := newRemoteNode(version, client, heads, subs)
+	// The probed namespaces are cached by the node, so this is free for
+	// later AvailableNamespaces calls.
+	namespaces, err := node.AvailableNamespaces(ctx)
+	if err != nil {
+		subs.Close()
+		return nil, err
+	}
+	if err := CheckNamespaces(node.Kind(), namespaces); err != nil {
+		subs.Close()
+		return nil, err
 	}
+	return node, nil
 }
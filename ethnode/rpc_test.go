@@ -1,6 +1,18 @@
 package ethnode
 
-import "testing"
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
 
 func TestParseUserAgent(t *testing.T) {
 	testcases := []struct {
@@ -28,3 +40,375 @@ func TestParseUserAgent(t *testing.T) {
 		}
 	}
 }
+
+func TestUserAgentChainID(t *testing.T) {
+	testcases := []struct {
+		name        string
+		netVersion  string
+		chainID     uint64
+		wantNetwork NetworkID
+		wantAgree   bool
+	}{
+		{"ETH", "1", 1, Mainnet, true},
+		{"ETC", "1", 61, NetworkID(61), false},
+		{"no eth_chainId", "1", 0, Mainnet, true},
+	}
+	for _, tc := range testcases {
+		agent, err := ParseUserAgent("Geth/v1.8.21-stable/linux-amd64/go1.11.4", "0x3f", tc.netVersion)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if agree := agent.SetChainID(tc.chainID); agree != tc.wantAgree {
+			t.Errorf("%s: agree: got %t; want %t", tc.name, agree, tc.wantAgree)
+		}
+		if agent.Network != tc.wantNetwork || agent.NetVersion != Mainnet || agent.ChainID != tc.chainID {
+			t.Errorf("%s: wrong agent values: %+v", tc.name, agent)
+		}
+	}
+}
+
+func TestNetworkIs(t *testing.T) {
+	testcases := []struct {
+		name       string
+		netVersion string
+		chainID    uint64
+		// byNetVersion is whether the network can be named from net_version
+		// alone, which isn't the case for forks sharing a network ID.
+		byNetVersion bool
+	}{
+		{"mainnet", "1", 1, true},
+		{"ropsten", "3", 3, true},
+		{"rinkeby", "4", 4, true},
+		{"goerli", "5", 5, true},
+		{"kovan", "42", 42, true},
+		{"sepolia", "11155111", 11155111, true},
+		{"classic", "1", 61, false},
+		{"mordor", "7", 63, true},
+	}
+	for _, tc := range testcases {
+		agent, err := ParseUserAgent("Geth/v1.8.21-stable/linux-amd64/go1.11.4", "0x3f", tc.netVersion)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := agent.Network.Is(tc.name); got != tc.byNetVersion {
+			t.Errorf("%s: from net_version %s: got Is() %t; want %t", tc.name, tc.netVersion, got, tc.byNetVersion)
+		}
+		agent.SetChainID(tc.chainID)
+		if !agent.Network.Is(tc.name) || !agent.Network.Is(strings.ToUpper(tc.name)) {
+			t.Errorf("%s: from chain ID %d: got %q", tc.name, tc.chainID, agent.Network)
+		}
+		if tc.byNetVersion && agent.Network.String() != agent.NetVersion.String() {
+			t.Errorf("%s: chain ID and net_version resolved differently: %q != %q", tc.name, agent.Network, agent.NetVersion)
+		}
+	}
+
+	if NetworkID(12345).Is("mainnet") {
+		t.Error("unknown network matched mainnet")
+	}
+}
+
+func TestDetectClientChainID(t *testing.T) {
+	// Rinkeby network ID with a different chain ID
+	client := mockNode(t, &MockEth{chainID: "0x3d"}, &MockAdmin{})
+	defer client.Close()
+	agent, err := DetectClient(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if agent.Network != NetworkID(61) || agent.NetVersion != Rinkeby || agent.ChainID != 61 {
+		t.Errorf("wrong agent values: %+v", agent)
+	}
+}
+
+func TestPeerHasProtocol(t *testing.T) {
+	les := PeerInfo{ID: "a", Caps: []string{"les/1", "les/2"}}
+	eth := PeerInfo{ID: "b", Caps: []string{"eth/62", "eth/63"}}
+	if !les.HasProtocol("les") || les.HasProtocol("eth") {
+		t.Errorf("wrong protocols for les peer: %v", les.Caps)
+	}
+	if eth.HasProtocol("les") || !eth.HasProtocol("eth") {
+		t.Errorf("wrong protocols for eth peer: %v", eth.Caps)
+	}
+	if (PeerInfo{Caps: []string{"lesx/1"}}).HasProtocol("les") {
+		t.Error("matched protocol by prefix")
+	}
+}
+
+// MockMixedAdmin reports peers running a mix of clients.
+type MockMixedAdmin struct{ MockAdmin }
+
+func (s *MockMixedAdmin) Peers() json.RawMessage {
+	return json.RawMessage(`[
+		{"id": "a", "name": "Geth/v1.8.21-stable/linux-amd64/go1.11.4", "caps": ["eth/63"]},
+		{"id": "b", "name": "Geth/mynode/v1.9.0-stable/linux-amd64/go1.12", "caps": ["eth/63"]},
+		{"id": "c", "name": "Parity-Ethereum/v2.2.7-stable-b00a21f-20190115/x86_64-linux-gnu/rustc1.31.1", "caps": ["eth/63"]},
+		{"id": "d", "name": "Parity/v1.11.11-stable-cb03f38-20180910/x86_64-linux-gnu/rustc1.28.0", "caps": ["eth/63"]},
+		{"id": "e", "name": "Nethermind/v1.4.3/linux-x64/dotnet3.1.2", "caps": ["eth/63"]},
+		{"id": "f", "name": "", "caps": ["eth/63"]}
+	]`)
+}
+
+func TestPeersByKind(t *testing.T) {
+	server := rpc.NewServer()
+	if err := server.RegisterName("admin", &MockMixedAdmin{}); err != nil {
+		t.Fatal(err)
+	}
+	client := rpc.DialInProc(server)
+	defer client.Close()
+
+	kinds, err := (&gethNode{client: client}).PeersByKind(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[NodeKind]int{Geth: 2, Parity: 2, Unknown: 2}
+	if !reflect.DeepEqual(kinds, want) {
+		t.Errorf("got %v; want %v", kinds, want)
+	}
+
+	if kinds := CountPeersByKind(nil); len(kinds) != 0 {
+		t.Errorf("expected no kinds without peers, got %v", kinds)
+	}
+}
+
+// MockPartialAdmin returns a peer list with one malformed entry among three.
+type MockPartialAdmin struct{}
+
+func (*MockPartialAdmin) Peers() json.RawMessage {
+	var peers []json.RawMessage
+	if err := json.Unmarshal(adminPeersPayload(3), &peers); err != nil {
+		panic(err)
+	}
+	peers[1] = json.RawMessage(`{"id": 42, "name": "Geth/v1.8.21-stable-9dc5d1a9/linux-amd64/go1.11.4", "caps": "eth/63"}`)
+	out, err := json.Marshal(peers)
+	if err != nil {
+		panic(err)
+	}
+	return out
+}
+
+func TestPartialPeers(t *testing.T) {
+	client := serveMocks(t, map[string]interface{}{"admin": &MockPartialAdmin{}})
+	defer client.Close()
+	node := &gethNode{client: client}
+
+	for name, peersFn := range map[string]func(context.Context) ([]PeerInfo, error){"Peers": node.Peers, "PeersLite": node.PeersLite} {
+		peers, err := peersFn(context.Background())
+		partial, ok := err.(PartialPeersError)
+		if !ok {
+			t.Fatalf("%s: expected PartialPeersError, got: %v", name, err)
+		}
+		if partial.Skipped != 1 || partial.Total != 3 {
+			t.Errorf("%s: got %d of %d skipped; want 1 of 3", name, partial.Skipped, partial.Total)
+		}
+		if len(peers) != 2 || peers[0].ID != fmt.Sprintf("%0128x", 0) || peers[1].ID != fmt.Sprintf("%0128x", 2) {
+			t.Errorf("%s: wrong peers: %+v", name, peers)
+		}
+		if ErrorClass(err) != "partial_peers" {
+			t.Errorf("%s: got error class %q", name, ErrorClass(err))
+		}
+	}
+
+	// The counts come with the warning.
+	kinds, err := node.PeersByKind(context.Background())
+	if !IsPartialPeers(err) {
+		t.Fatalf("expected PartialPeersError, got: %v", err)
+	}
+	if kinds[Geth] != 2 {
+		t.Errorf("got %v; want 2 geth peers", kinds)
+	}
+}
+
+func TestParseNetworkID(t *testing.T) {
+	testcases := []struct {
+		netVersion string
+		want       NetworkID
+	}{
+		{"1", Mainnet},
+		{"0x1", Mainnet},
+		{"0x2a", Kovan},
+		{"42", Kovan},
+		{"0X4", Rinkeby},
+	}
+	for _, tc := range testcases {
+		got, err := parseNetworkID(tc.netVersion)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %s", tc.netVersion, err)
+		} else if got != tc.want {
+			t.Errorf("%q: got %d; want %d", tc.netVersion, got, tc.want)
+		}
+	}
+
+	for _, netVersion := range []string{"", "0x", "mainnet", "-1"} {
+		if _, err := parseNetworkID(netVersion); err == nil {
+			t.Errorf("%q: expected error", netVersion)
+		}
+	}
+
+	// Hex net_version also works through ParseUserAgent
+	agent, err := ParseUserAgent("Geth/v1.8.21-stable/linux-amd64/go1.11.4", "0x3f", "0x2a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if agent.Network != Kovan {
+		t.Errorf("wrong network: %s", agent.Network)
+	}
+}
+
+// countingTransport is an http.RoundTripper which counts requests.
+type countingTransport struct {
+	requests int
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.requests++
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestDialHTTPClient(t *testing.T) {
+	server := rpc.NewServer()
+	services := map[string]interface{}{
+		"web3":   &MockWeb3{"Parity-Ethereum//v2.0.5-stable/x86_64-linux-gnu/rustc1.29.0"},
+		"eth":    &MockEth{},
+		"net":    &MockNet{},
+		"parity": &MockParity{},
+	}
+	for name, service := range services {
+		if err := server.RegisterName(name, service); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	transport := &countingTransport{}
+	httpClient := &http.Client{Transport: transport}
+	node, err := DialHTTPClient(context.Background(), ts.URL, httpClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if node.Kind() != Parity {
+		t.Errorf("wrong kind: %s", node.Kind())
+	}
+	detected := transport.requests
+	if detected == 0 {
+		t.Fatal("provided http.Client was not used for detection")
+	}
+	if _, err := node.BlockNumber(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if transport.requests != detected+1 {
+		t.Errorf("provided http.Client was not used for calls: %d requests", transport.requests)
+	}
+}
+
+// adminPeersPayload returns a JSON admin_peers result similar to Geth's, for
+// numPeers peers.
+func adminPeersPayload(numPeers int) []byte {
+	peers := make([]map[string]interface{}, 0, numPeers)
+	for i := 0; i < numPeers; i++ {
+		peers = append(peers, map[string]interface{}{
+			"enode": fmt.Sprintf("enode://%0128x@10.0.0.%d:30303", i, i%256),
+			"id":    fmt.Sprintf("%0128x", i),
+			"name":  "Geth/v1.8.21-stable-9dc5d1a9/linux-amd64/go1.11.4",
+			"caps":  []string{"eth/62", "eth/63", "les/1", "les/2"},
+			"network": map[string]interface{}{
+				"localAddress":  "10.0.0.1:30303",
+				"remoteAddress": fmt.Sprintf("10.0.0.%d:30303", i%256),
+				"inbound":       i%2 == 0,
+				"trusted":       i%3 == 0,
+				"static":        i%3 == 1,
+			},
+			"protocols": map[string]interface{}{
+				"eth": map[string]interface{}{
+					"version":    63,
+					"difficulty": 9000000000000000000,
+					"head":       fmt.Sprintf("0x%064x", i),
+				},
+			},
+		})
+	}
+	out, err := json.Marshal(peers)
+	if err != nil {
+		panic(err)
+	}
+	return out
+}
+
+func BenchmarkPeersDecode(b *testing.B) {
+	payload := adminPeersPayload(100)
+
+	b.Run("Peers", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(payload)))
+		var size int
+		for i := 0; i < b.N; i++ {
+			var raw []json.RawMessage
+			if err := json.Unmarshal(payload, &raw); err != nil {
+				b.Fatal(err)
+			}
+			peers, err := parsePeers("admin_peers", raw, false)
+			if err != nil {
+				b.Fatal(err)
+			}
+			out, _ := json.Marshal(peers)
+			size = len(out)
+		}
+		b.ReportMetric(float64(size), "result-bytes")
+	})
+
+	b.Run("PeersLite", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(payload)))
+		var size int
+		for i := 0; i < b.N; i++ {
+			var raw []json.RawMessage
+			if err := json.Unmarshal(payload, &raw); err != nil {
+				b.Fatal(err)
+			}
+			peers, err := parsePeers("admin_peers", raw, true)
+			if err != nil {
+				b.Fatal(err)
+			}
+			out, _ := json.Marshal(peers)
+			size = len(out)
+		}
+		b.ReportMetric(float64(size), "result-bytes")
+	})
+}
+
+func TestFromRPCClient(t *testing.T) {
+	const gethVersion = "Geth/v1.8.21-stable/linux-amd64/go1.11.4"
+	client := serveMocks(t, map[string]interface{}{"web3": &MockWeb3{gethVersion}, "eth": &MockEth{}, "net": &MockNet{}, "admin": &MockAdmin{}})
+	defer client.Close()
+	// An app's own ethclient, sharing the connection with the node.
+	appClient := ethclient.NewClient(client)
+
+	node, err := FromRPCClient(context.Background(), client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if node.Kind() != Geth {
+		t.Errorf("wrong kind: %s", node.Kind())
+	}
+	if !node.Network().Is("rinkeby") {
+		t.Errorf("wrong network: %s", node.Network())
+	}
+	if enode, err := node.Enode(context.Background()); err != nil || !strings.HasPrefix(enode, "enode://") {
+		t.Errorf("unexpected enode: %q, %v", enode, err)
+	}
+
+	// Closing the node leaves the caller's client open.
+	if err := node.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := appClient.NetworkID(context.Background()); err != nil {
+		t.Errorf("client was closed with the node: %s", err)
+	}
+
+	// Detection still fails on clients without the required namespaces.
+	bare := serveMocks(t, map[string]interface{}{"web3": &MockWeb3{gethVersion}, "eth": &MockEth{}, "net": &MockNet{}})
+	defer bare.Close()
+	if _, err := FromRPCClient(context.Background(), bare); err == nil {
+		t.Error("expected missing namespaces error")
+	}
+}
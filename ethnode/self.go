@@ -0,0 +1,46 @@
+package ethnode
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+)
+
+// ErrSelfConnection is returned when asked to connect to or trust the node's
+// own ID, which the node would reject with a confusing error.
+var ErrSelfConnection = errors.New("cannot connect node to itself")
+
+// enodeNodeID returns the node ID of an enode:// URI or bare node ID.
+func enodeNodeID(nodeURI string) string {
+	id := strings.TrimPrefix(nodeURI, "enode://")
+	if i := strings.IndexByte(id, '@'); i >= 0 {
+		id = id[:i]
+	}
+	return strings.ToLower(id)
+}
+
+// selfGuard caches the local node ID to reject connections to itself.
+type selfGuard struct {
+	mu sync.Mutex
+	id string
+}
+
+// check returns ErrSelfConnection if target is the node ID or enode URI of the
+// local node, which is looked up with enode once. If the lookup fails, the
+// target is let through and the lookup is retried on the next check.
+func (g *selfGuard) check(ctx context.Context, enode func(context.Context) (string, error), target string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.id == "" {
+		uri, err := enode(ctx)
+		if err != nil {
+			return nil
+		}
+		g.id = enodeNodeID(uri)
+	}
+	if g.id != "" && enodeNodeID(target) == g.id {
+		return ErrSelfConnection
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package ethnode
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestSelfConnection(t *testing.T) {
+	admin := &MockAdmin{}
+	client := mockNode(t, &MockEth{}, admin)
+	defer client.Close()
+	node := &gethNode{client: client}
+	ctx := context.Background()
+
+	// MockAdmin's own enode is enode://foo@127.0.0.1:30303
+	if err := node.ConnectPeer(ctx, "enode://foo@10.0.0.1:30303"); err != ErrSelfConnection {
+		t.Errorf("ConnectPeer: expected ErrSelfConnection, got: %v", err)
+	}
+	if err := node.AddTrustedPeer(ctx, "FOO"); err != ErrSelfConnection {
+		t.Errorf("AddTrustedPeer: expected ErrSelfConnection, got: %v", err)
+	}
+	if err := node.ConnectPeer(ctx, "enode://bar@10.0.0.1:30303"); err != nil {
+		t.Errorf("ConnectPeer: unexpected error: %s", err)
+	}
+	if err := node.AddTrustedPeer(ctx, "bar"); err != nil {
+		t.Errorf("AddTrustedPeer: unexpected error: %s", err)
+	}
+
+	if want := []string{"enode://bar@10.0.0.1:30303", "bar"}; !reflect.DeepEqual(admin.added, want) {
+		t.Errorf("added: got %q; want %q", admin.added, want)
+	}
+	if admin.nodeInfoCalls != 1 {
+		t.Errorf("expected the local node ID to be cached, got %d lookups", admin.nodeInfoCalls)
+	}
+}
+
+func TestSelfConnectionUnknown(t *testing.T) {
+	// If the local enode can't be looked up, don't block connections.
+	admin := &MockAdmin{disabled: true}
+	client := mockNode(t, &MockEth{}, admin)
+	defer client.Close()
+	node := &gethNode{client: client}
+
+	if err := node.AddTrustedPeer(context.Background(), "foo"); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if len(admin.added) != 1 {
+		t.Errorf("expected peer to be added: %q", admin.added)
+	}
+}
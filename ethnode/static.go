@@ -0,0 +1,50 @@
+package ethnode
+
+import "context"
+
+// IsStatic returns whether the peer is kept connected by configuration
+// rather than found by discovery: a static or trusted peer on Geth, or a peer
+// added through a ManagedNode. Parity doesn't report which of its peers are
+// reserved, so only its Managed peers are static.
+func (p PeerInfo) IsStatic() bool {
+	return p.Static || p.Trusted || p.Managed
+}
+
+// PartitionPeers splits peers into the static ones (see PeerInfo.IsStatic)
+// and the dynamic ones, keeping their order.
+func PartitionPeers(peers []PeerInfo) (static, dynamic []PeerInfo) {
+	static = make([]PeerInfo, 0)
+	dynamic = make([]PeerInfo, 0, len(peers))
+	for _, peer := range peers {
+		if peer.IsStatic() {
+			static = append(static, peer)
+		} else {
+			dynamic = append(dynamic, peer)
+		}
+	}
+	return static, dynamic
+}
+
+// StaticPeers returns the connected peers of node which are configured as
+// static or trusted, for telling them apart from discovered peers when
+// estimating its capacity.
+func StaticPeers(ctx context.Context, node EthNode) ([]PeerInfo, error) {
+	peers, err := node.Peers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	static, _ := PartitionPeers(peers)
+	return static, nil
+}
+
+// DynamicPeers returns the connected peers of node which it found through
+// discovery or which dialed it, rather than ones configured as static or
+// trusted.
+func DynamicPeers(ctx context.Context, node EthNode) ([]PeerInfo, error) {
+	peers, err := node.Peers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	_, dynamic := PartitionPeers(peers)
+	return dynamic, nil
+}
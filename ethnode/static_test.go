@@ -0,0 +1,72 @@
+package ethnode
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+func peerIDs(peers []PeerInfo) []string {
+	ids := make([]string, 0, len(peers))
+	for _, peer := range peers {
+		ids = append(ids, peer.ID)
+	}
+	return ids
+}
+
+func TestStaticPeers(t *testing.T) {
+	ctx := context.Background()
+	// Peers 0 and 3 are trusted, 1 and 4 are static, 2 and 5 are dynamic.
+	client := serveMocks(t, map[string]interface{}{"admin": &MockAdminPeers{numPeers: 6}})
+	defer client.Close()
+	node := &gethNode{client: client}
+
+	static, err := StaticPeers(ctx, node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dynamic, err := DynamicPeers(ctx, node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := func(i int) string { return fmt.Sprintf("%0128x", i) }
+	if got, want := fmt.Sprint(peerIDs(static)), fmt.Sprint([]string{id(0), id(1), id(3), id(4)}); got != want {
+		t.Errorf("wrong static peers:\n got: %s\nwant: %s", got, want)
+	}
+	if got, want := fmt.Sprint(peerIDs(dynamic)), fmt.Sprint([]string{id(2), id(5)}); got != want {
+		t.Errorf("wrong dynamic peers:\n got: %s\nwant: %s", got, want)
+	}
+}
+
+// MockAdminPeers serves admin_peers with numPeers peers from
+// adminPeersPayload.
+type MockAdminPeers struct{ numPeers int }
+
+func (s *MockAdminPeers) Peers() json.RawMessage {
+	return adminPeersPayload(s.numPeers)
+}
+
+func TestPartitionPeers(t *testing.T) {
+	// Parity doesn't flag its reserved peers, so only the ones added through
+	// a ManagedNode are static.
+	peers := []PeerInfo{
+		{ID: "a"},
+		{ID: "b", Managed: true},
+		{ID: "c", Static: true},
+		{ID: "d"},
+		{ID: "e", Trusted: true, Static: true},
+	}
+	static, dynamic := PartitionPeers(peers)
+	if got := fmt.Sprint(peerIDs(static)); got != "[b c e]" {
+		t.Errorf("wrong static peers: %s", got)
+	}
+	if got := fmt.Sprint(peerIDs(dynamic)); got != "[a d]" {
+		t.Errorf("wrong dynamic peers: %s", got)
+	}
+
+	static, dynamic = PartitionPeers(nil)
+	if static == nil || dynamic == nil || len(static)+len(dynamic) != 0 {
+		t.Errorf("expected empty partitions, got: %v %v", static, dynamic)
+	}
+}
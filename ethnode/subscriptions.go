@@ -0,0 +1,96 @@
+package ethnode
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// ErrClosed is returned when subscribing on a node which was closed.
+var ErrClosed = errors.New("ethnode: node is closed")
+
+// subscriptions tracks a node's active subscriptions along with the
+// goroutines serving them, so that Close can tear them all down. Without it,
+// each subscription leaks a goroutine when its node is discarded, which adds
+// up in long-running agents that reconnect to their node.
+type subscriptions struct {
+	mu     sync.Mutex
+	closed bool
+	nextID int
+	active map[int]*rpc.ClientSubscription
+	wg     sync.WaitGroup
+}
+
+// subscribe calls eth_subscribe with args, delivering notifications to
+// channel, and runs serve in a tracked goroutine. callCtx bounds the
+// subscribe call, while ctx bounds the subscription itself. serve must return
+// once sub.Err() is closed or sends an error, which happens when the
+// subscription fails, when ctx is done, or when the subscriptions are closed.
+func (s *subscriptions) subscribe(callCtx context.Context, ctx context.Context, client *rpc.Client, channel interface{}, serve func(sub *rpc.ClientSubscription), args ...interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrClosed
+	}
+	sub, err := client.EthSubscribe(callCtx, channel, args...)
+	if err != nil {
+		return err
+	}
+	if s.active == nil {
+		s.active = map[int]*rpc.ClientSubscription{}
+	}
+	id := s.nextID
+	s.nextID++
+	s.active[id] = sub
+
+	stop := make(chan struct{})
+	s.wg.Add(2)
+	go func() {
+		defer s.wg.Done()
+		select {
+		case <-ctx.Done():
+			sub.Unsubscribe()
+		case <-stop:
+		}
+	}()
+	go func() {
+		defer s.wg.Done()
+		serve(sub)
+		close(stop)
+		sub.Unsubscribe()
+		s.mu.Lock()
+		delete(s.active, id)
+		s.mu.Unlock()
+	}()
+	return nil
+}
+
+// Len returns the number of active subscriptions.
+func (s *subscriptions) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.active)
+}
+
+// Close unsubscribes the active subscriptions and waits for their goroutines
+// to return. Later subscribe calls fail with ErrClosed. A nil subscriptions
+// has nothing to close.
+func (s *subscriptions) Close() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.closed = true
+	active := make([]*rpc.ClientSubscription, 0, len(s.active))
+	for _, sub := range s.active {
+		active = append(active, sub)
+	}
+	s.mu.Unlock()
+
+	for _, sub := range active {
+		sub.Unsubscribe()
+	}
+	s.wg.Wait()
+}
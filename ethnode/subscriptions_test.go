@@ -0,0 +1,80 @@
+package ethnode
+
+import (
+	"context"
+	"encoding/json"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// waitGoroutines waits for the number of goroutines to drop to want, since
+// the rpc client's goroutines exit shortly after their subscriptions.
+func waitGoroutines(t *testing.T, want int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for runtime.NumGoroutine() > want {
+		if time.Now().After(deadline) {
+			buf := make([]byte, 1<<16)
+			t.Fatalf("leaked goroutines: %d running; want %d\n%s", runtime.NumGoroutine(), want, buf[:runtime.Stack(buf, true)])
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSubscriptionsClose(t *testing.T) {
+	before := runtime.NumGoroutine()
+
+	eth := &MockHeadsEth{heads: []map[string]string{
+		{"number": "0x63", "timestamp": "0x5c3a8f4e"},
+	}}
+	client := mockHeadsNode(t, eth)
+	subs := &subscriptions{}
+	node := &gethNode{client: client, subs: subs}
+
+	for i := 0; i < 10; i++ {
+		if _, err := subscribeHeads(context.Background(), client, subs); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Subscriptions also end with their context.
+	ctx, cancel := context.WithCancel(context.Background())
+	headCh := make(chan json.RawMessage, 1)
+	serve := func(sub *rpc.ClientSubscription) {
+		for {
+			select {
+			case <-headCh:
+			case <-sub.Err():
+				return
+			}
+		}
+	}
+	if err := subs.subscribe(context.Background(), ctx, client, headCh, serve, "newHeads"); err != nil {
+		t.Fatal(err)
+	}
+	if got := subs.Len(); got != 11 {
+		t.Errorf("got %d active subscriptions; want 11", got)
+	}
+	cancel()
+	deadline := time.Now().Add(time.Second)
+	for subs.Len() != 10 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := subs.Len(); got != 10 {
+		t.Errorf("got %d active subscriptions after cancel; want 10", got)
+	}
+
+	if err := node.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := subs.Len(); got != 0 {
+		t.Errorf("got %d active subscriptions after close; want 0", got)
+	}
+	if _, err := subscribeHeads(context.Background(), client, subs); err != ErrClosed {
+		t.Errorf("expected ErrClosed after close, got: %v", err)
+	}
+	waitGoroutines(t, before)
+}
@@ -0,0 +1,130 @@
+package ethnode
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// ErrNotSyncing is returned by EstimateSyncETA when the node is not syncing.
+var ErrNotSyncing = errors.New("node is not syncing")
+
+// ErrInsufficientSamples is returned by EstimateSyncETA when it couldn't
+// sample the sync progress at least twice within the window.
+var ErrInsufficientSamples = errors.New("not enough sync progress samples to estimate")
+
+// ErrSyncStalled is returned by EstimateSyncETA when the node imported no
+// blocks within the window.
+var ErrSyncStalled = errors.New("sync made no progress")
+
+// syncSamples is how many times EstimateSyncETA samples the sync progress
+// over its window, after the first sample.
+const syncSamples = 4
+
+// SyncProgress is the progress of a syncing node, from eth_syncing.
+type SyncProgress struct {
+	StartingBlock uint64 // Block number where the sync started
+	CurrentBlock  uint64 // Current sync'd block number
+	HighestBlock  uint64 // Highest known block number
+}
+
+// Remaining returns the number of blocks left to sync.
+func (p SyncProgress) Remaining() uint64 {
+	if p.HighestBlock < p.CurrentBlock {
+		return 0
+	}
+	return p.HighestBlock - p.CurrentBlock
+}
+
+// syncProgress is the SyncProgress implementation shared by node kinds. It
+// returns nil if the node is not syncing.
+func syncProgress(ctx context.Context, client *rpc.Client) (*SyncProgress, error) {
+	// eth_syncing returns false when sync'd, or a sync status object.
+	var syncing interface{}
+	if err := call(ctx, client, &syncing, "eth_syncing"); err != nil {
+		return nil, err
+	}
+	status, ok := syncing.(map[string]interface{})
+	if !ok {
+		return nil, nil
+	}
+	return &SyncProgress{
+		StartingBlock: parseQuantity(status["startingBlock"]),
+		CurrentBlock:  parseQuantity(status["currentBlock"]),
+		HighestBlock:  parseQuantity(status["highestBlock"]),
+	}, nil
+}
+
+// syncSample is the sync progress at a point in time.
+type syncSample struct {
+	At       time.Time
+	Progress SyncProgress
+}
+
+// estimateSyncETA projects the time left to sync the remaining blocks of the
+// last sample, at the average import rate between the first and last ones.
+func estimateSyncETA(samples []syncSample) (time.Duration, error) {
+	if len(samples) < 2 {
+		return 0, ErrInsufficientSamples
+	}
+	first, last := samples[0], samples[len(samples)-1]
+	elapsed := last.At.Sub(first.At)
+	if elapsed <= 0 {
+		return 0, ErrInsufficientSamples
+	}
+	remaining := last.Progress.Remaining()
+	if remaining == 0 {
+		return 0, nil
+	}
+	if last.Progress.CurrentBlock <= first.Progress.CurrentBlock {
+		return 0, ErrSyncStalled
+	}
+	imported := last.Progress.CurrentBlock - first.Progress.CurrentBlock
+	blocksPerSecond := float64(imported) / elapsed.Seconds()
+	return time.Duration(float64(remaining) / blocksPerSecond * float64(time.Second)), nil
+}
+
+// EstimateSyncETA samples the sync progress of node over sampleWindow, and
+// returns how long the node will take to finish syncing at the rate it
+// imported blocks meanwhile. It returns ErrNotSyncing if the node isn't
+// syncing to begin with, and 0 if it finishes within the window. If ctx is
+// done before the window ends, the estimate uses the samples so far.
+func EstimateSyncETA(ctx context.Context, node EthNode, sampleWindow time.Duration) (time.Duration, error) {
+	interval := sampleWindow / syncSamples
+	if interval <= 0 {
+		return 0, ErrInsufficientSamples
+	}
+	progress, err := node.SyncProgress(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if progress == nil {
+		return 0, ErrNotSyncing
+	}
+	samples := []syncSample{{At: time.Now(), Progress: *progress}}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for len(samples) <= syncSamples {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return estimateSyncETA(samples)
+		}
+		progress, err := node.SyncProgress(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return estimateSyncETA(samples)
+			}
+			return 0, err
+		}
+		if progress == nil {
+			// Done syncing.
+			return 0, nil
+		}
+		samples = append(samples, syncSample{At: time.Now(), Progress: *progress})
+	}
+	return estimateSyncETA(samples)
+}
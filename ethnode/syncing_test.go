@@ -0,0 +1,117 @@
+package ethnode
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSyncProgress(t *testing.T) {
+	syncing := map[string]string{"startingBlock": "0x0", "currentBlock": "0x64", "highestBlock": "0x3e8"}
+	for _, tc := range []struct {
+		eth  *MockEth
+		want *SyncProgress
+	}{
+		{&MockEth{syncing: syncing}, &SyncProgress{StartingBlock: 0, CurrentBlock: 100, HighestBlock: 1000}},
+		{&MockEth{syncing: false}, nil},
+	} {
+		client := serveMocks(t, map[string]interface{}{"eth": tc.eth})
+		progress, err := (&gethNode{client: client}).SyncProgress(context.Background())
+		client.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (progress == nil) != (tc.want == nil) || (progress != nil && *progress != *tc.want) {
+			t.Errorf("got progress %+v; want %+v", progress, tc.want)
+		}
+	}
+}
+
+func TestEstimateSyncETAFromSamples(t *testing.T) {
+	start := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	sample := func(offset time.Duration, current, highest uint64) syncSample {
+		return syncSample{At: start.Add(offset), Progress: SyncProgress{CurrentBlock: current, HighestBlock: highest}}
+	}
+	testcases := []struct {
+		name    string
+		samples []syncSample
+		want    time.Duration
+		err     error
+	}{
+		{"steady", []syncSample{sample(0, 1000, 10000), sample(10*time.Second, 1500, 10000), sample(20*time.Second, 2000, 10000)}, 160 * time.Second, nil},
+		// The rate is averaged across the window, and the highest block can
+		// move meanwhile.
+		{"uneven", []syncSample{sample(0, 1000, 10000), sample(5*time.Second, 1100, 10050), sample(10*time.Second, 2000, 10100)}, 81 * time.Second, nil},
+		{"done", []syncSample{sample(0, 9000, 10000), sample(10*time.Second, 10000, 10000)}, 0, nil},
+		{"stalled", []syncSample{sample(0, 1000, 10000), sample(10*time.Second, 1000, 10000)}, 0, ErrSyncStalled},
+		{"one sample", []syncSample{sample(0, 1000, 10000)}, 0, ErrInsufficientSamples},
+		{"no time elapsed", []syncSample{sample(0, 1000, 10000), sample(0, 1100, 10000)}, 0, ErrInsufficientSamples},
+	}
+	for _, tc := range testcases {
+		got, err := estimateSyncETA(tc.samples)
+		if err != tc.err {
+			t.Errorf("%s: got error %v; want %v", tc.name, err, tc.err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("%s: got ETA %s; want %s", tc.name, got, tc.want)
+		}
+	}
+}
+
+// progressNode is an EthNode which syncs at a steady rate of blocks per
+// second from when it's created.
+type progressNode struct {
+	EthNode
+	mu      sync.Mutex
+	started time.Time
+	rate    float64
+	highest uint64
+	synced  bool
+}
+
+func (n *progressNode) SyncProgress(ctx context.Context) (*SyncProgress, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.synced {
+		return nil, nil
+	}
+	current := uint64(time.Since(n.started).Seconds() * n.rate)
+	if current >= n.highest {
+		return nil, nil
+	}
+	return &SyncProgress{CurrentBlock: current, HighestBlock: n.highest}, nil
+}
+
+func TestEstimateSyncETA(t *testing.T) {
+	ctx := context.Background()
+	// 10000 blocks per second with a million to go is about 100 seconds.
+	node := &progressNode{started: time.Now(), rate: 10000, highest: 1000000}
+	eta, err := EstimateSyncETA(ctx, node, 40*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if eta < 90*time.Second || eta > 110*time.Second {
+		t.Errorf("got ETA %s; want about 100s", eta)
+	}
+
+	// A node which catches up within the window.
+	node = &progressNode{started: time.Now(), rate: 10000, highest: 100}
+	if eta, err := EstimateSyncETA(ctx, node, 40*time.Millisecond); err != nil || eta != 0 {
+		t.Errorf("got ETA %s, err %v; want 0 after catching up", eta, err)
+	}
+
+	node = &progressNode{synced: true}
+	if _, err := EstimateSyncETA(ctx, node, 40*time.Millisecond); err != ErrNotSyncing {
+		t.Errorf("expected ErrNotSyncing, got: %v", err)
+	}
+
+	// Canceled before the second sample.
+	node = &progressNode{started: time.Now(), rate: 10000, highest: 1000000}
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := EstimateSyncETA(canceled, node, time.Minute); err != ErrInsufficientSamples {
+		t.Errorf("expected ErrInsufficientSamples, got: %v", err)
+	}
+}
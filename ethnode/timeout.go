@@ -0,0 +1,235 @@
+package ethnode
+
+import (
+	"context"
+	"math/big"
+	"net/http"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// DialOptions configures DialWithOptions.
+type DialOptions struct {
+	// DialTimeout bounds connecting to the node and detecting its client,
+	// including any TLS handshake. (No limit if 0)
+	DialTimeout time.Duration
+	// CallTimeout bounds each EthNode call made without a context deadline
+	// once connected. (No limit if 0)
+	CallTimeout time.Duration
+	// HTTPClient is used for http:// and https:// URIs, see DialHTTPClient.
+	HTTPClient *http.Client
+	// RedetectInterval wraps the node with a RedetectNode which re-detects
+	// its client this often, to follow in-place client upgrades. (Disabled
+	// if 0)
+	RedetectInterval time.Duration
+}
+
+// DialWithOptions is DialHTTPClient with separate timeouts for connecting and
+// for each call after, so a slow initial handshake doesn't use up the budget
+// of later calls. An existing deadline on ctx still applies to the dial.
+func DialWithOptions(ctx context.Context, uri string, opts DialOptions) (EthNode, error) {
+	if opts.DialTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.DialTimeout)
+		defer cancel()
+	}
+	node, err := DialHTTPClient(ctx, uri, opts.HTTPClient)
+	if err != nil {
+		return nil, err
+	}
+	if opts.RedetectInterval > 0 {
+		redetect := Redetect(node)
+		redetect.Interval = opts.RedetectInterval
+		node = redetect
+	}
+	if opts.CallTimeout > 0 {
+		node = CallTimeout(node, opts.CallTimeout)
+	}
+	return node, nil
+}
+
+// CallTimeout wraps node with a TimeoutNode.
+func CallTimeout(node EthNode, timeout time.Duration) *TimeoutNode {
+	return &TimeoutNode{EthNode: node, Timeout: timeout}
+}
+
+// TimeoutNode is an EthNode which gives up on calls after Timeout, unless the
+// caller's context already has a deadline. Callers that need more or less
+// time for a call can still set their own.
+type TimeoutNode struct {
+	EthNode
+
+	Timeout time.Duration
+}
+
+// context returns ctx with the default timeout if it has no deadline.
+func (n *TimeoutNode) context(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok || n.Timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, n.Timeout)
+}
+
+func (n *TimeoutNode) Enode(ctx context.Context) (string, error) {
+	ctx, cancel := n.context(ctx)
+	defer cancel()
+	return n.EthNode.Enode(ctx)
+}
+
+func (n *TimeoutNode) AddTrustedPeer(ctx context.Context, nodeID string) error {
+	ctx, cancel := n.context(ctx)
+	defer cancel()
+	return n.EthNode.AddTrustedPeer(ctx, nodeID)
+}
+
+func (n *TimeoutNode) RemoveTrustedPeer(ctx context.Context, nodeID string) error {
+	ctx, cancel := n.context(ctx)
+	defer cancel()
+	return n.EthNode.RemoveTrustedPeer(ctx, nodeID)
+}
+
+func (n *TimeoutNode) ConnectPeer(ctx context.Context, nodeURI string) error {
+	ctx, cancel := n.context(ctx)
+	defer cancel()
+	return n.EthNode.ConnectPeer(ctx, nodeURI)
+}
+
+func (n *TimeoutNode) DisconnectPeer(ctx context.Context, nodeID string) error {
+	ctx, cancel := n.context(ctx)
+	defer cancel()
+	return n.EthNode.DisconnectPeer(ctx, nodeID)
+}
+
+func (n *TimeoutNode) Peers(ctx context.Context) ([]PeerInfo, error) {
+	ctx, cancel := n.context(ctx)
+	defer cancel()
+	return n.EthNode.Peers(ctx)
+}
+
+func (n *TimeoutNode) PeersLite(ctx context.Context) ([]PeerInfo, error) {
+	ctx, cancel := n.context(ctx)
+	defer cancel()
+	return n.EthNode.PeersLite(ctx)
+}
+
+func (n *TimeoutNode) PeersByKind(ctx context.Context) (map[NodeKind]int, error) {
+	ctx, cancel := n.context(ctx)
+	defer cancel()
+	return n.EthNode.PeersByKind(ctx)
+}
+
+func (n *TimeoutNode) PeerSlots(ctx context.Context) (max, used, reserved int, err error) {
+	ctx, cancel := n.context(ctx)
+	defer cancel()
+	return n.EthNode.PeerSlots(ctx)
+}
+
+func (n *TimeoutNode) BlockNumber(ctx context.Context) (uint64, error) {
+	ctx, cancel := n.context(ctx)
+	defer cancel()
+	return n.EthNode.BlockNumber(ctx)
+}
+
+func (n *TimeoutNode) LatestBlock(ctx context.Context) (number uint64, timestamp time.Time, err error) {
+	ctx, cancel := n.context(ctx)
+	defer cancel()
+	return n.EthNode.LatestBlock(ctx)
+}
+
+func (n *TimeoutNode) ForkID(ctx context.Context) (hash [4]byte, next uint64, err error) {
+	ctx, cancel := n.context(ctx)
+	defer cancel()
+	return n.EthNode.ForkID(ctx)
+}
+
+func (n *TimeoutNode) FeeHistory(ctx context.Context, blocks int, rewardPercentiles []float64) (*FeeHistory, error) {
+	ctx, cancel := n.context(ctx)
+	defer cancel()
+	return n.EthNode.FeeHistory(ctx, blocks, rewardPercentiles)
+}
+
+func (n *TimeoutNode) AvailableNamespaces(ctx context.Context) (map[string]bool, error) {
+	ctx, cancel := n.context(ctx)
+	defer cancel()
+	return n.EthNode.AvailableNamespaces(ctx)
+}
+
+func (n *TimeoutNode) NonceAt(ctx context.Context, address common.Address, block *big.Int) (uint64, error) {
+	ctx, cancel := n.context(ctx)
+	defer cancel()
+	return n.EthNode.NonceAt(ctx, address, block)
+}
+
+func (n *TimeoutNode) SendRawTransaction(ctx context.Context, signedTx []byte) (common.Hash, error) {
+	ctx, cancel := n.context(ctx)
+	defer cancel()
+	return n.EthNode.SendRawTransaction(ctx, signedTx)
+}
+
+func (n *TimeoutNode) DataDir(ctx context.Context) (string, error) {
+	ctx, cancel := n.context(ctx)
+	defer cancel()
+	return n.EthNode.DataDir(ctx)
+}
+
+func (n *TimeoutNode) GenesisHash(ctx context.Context) (common.Hash, error) {
+	ctx, cancel := n.context(ctx)
+	defer cancel()
+	return n.EthNode.GenesisHash(ctx)
+}
+
+func (n *TimeoutNode) IsMining(ctx context.Context) (bool, error) {
+	ctx, cancel := n.context(ctx)
+	defer cancel()
+	return n.EthNode.IsMining(ctx)
+}
+
+func (n *TimeoutNode) IsHealing(ctx context.Context) (bool, error) {
+	ctx, cancel := n.context(ctx)
+	defer cancel()
+	return n.EthNode.IsHealing(ctx)
+}
+
+func (n *TimeoutNode) SyncProgress(ctx context.Context) (*SyncProgress, error) {
+	ctx, cancel := n.context(ctx)
+	defer cancel()
+	return n.EthNode.SyncProgress(ctx)
+}
+
+func (n *TimeoutNode) ChainConfig(ctx context.Context) (*params.ChainConfig, error) {
+	ctx, cancel := n.context(ctx)
+	defer cancel()
+	return n.EthNode.ChainConfig(ctx)
+}
+
+func (n *TimeoutNode) BlockGasLimit(ctx context.Context) (uint64, error) {
+	ctx, cancel := n.context(ctx)
+	defer cancel()
+	return n.EthNode.BlockGasLimit(ctx)
+}
+
+func (n *TimeoutNode) ClientVersion(ctx context.Context) (string, error) {
+	ctx, cancel := n.context(ctx)
+	defer cancel()
+	return n.EthNode.ClientVersion(ctx)
+}
+
+func (n *TimeoutNode) TxPoolStatus(ctx context.Context) (pending, queued uint64, err error) {
+	ctx, cancel := n.context(ctx)
+	defer cancel()
+	return n.EthNode.TxPoolStatus(ctx)
+}
+
+func (n *TimeoutNode) NodeUptime(ctx context.Context) (time.Duration, error) {
+	ctx, cancel := n.context(ctx)
+	defer cancel()
+	return n.EthNode.NodeUptime(ctx)
+}
+
+func (n *TimeoutNode) ChainHead(ctx context.Context) (*HeadInfo, error) {
+	ctx, cancel := n.context(ctx)
+	defer cancel()
+	return n.EthNode.ChainHead(ctx)
+}
@@ -0,0 +1,105 @@
+package ethnode
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// slowServer is an HTTP RPC server of a Parity node which delays each
+// response.
+type slowServer struct {
+	handler http.Handler
+
+	mu    sync.Mutex
+	delay time.Duration
+}
+
+func (s *slowServer) setDelay(delay time.Duration) {
+	s.mu.Lock()
+	s.delay = delay
+	s.mu.Unlock()
+}
+
+func (s *slowServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	delay := s.delay
+	s.mu.Unlock()
+	select {
+	case <-time.After(delay):
+	case <-r.Context().Done():
+		return
+	}
+	s.handler.ServeHTTP(w, r)
+}
+
+func newSlowServer(t *testing.T, delay time.Duration) (*slowServer, *httptest.Server) {
+	server := rpc.NewServer()
+	services := map[string]interface{}{
+		"web3":   &MockWeb3{"Parity-Ethereum//v2.0.5-stable/x86_64-linux-gnu/rustc1.29.0"},
+		"eth":    &MockEth{},
+		"net":    &MockNet{},
+		"parity": &MockParity{},
+	}
+	for name, service := range services {
+		if err := server.RegisterName(name, service); err != nil {
+			t.Fatal(err)
+		}
+	}
+	slow := &slowServer{handler: server, delay: delay}
+	return slow, httptest.NewServer(slow)
+}
+
+func TestDialTimeout(t *testing.T) {
+	_, ts := newSlowServer(t, 2*time.Second)
+	defer ts.Close()
+
+	// A generous call timeout doesn't extend the dial.
+	opts := DialOptions{DialTimeout: 50 * time.Millisecond, CallTimeout: 5 * time.Second}
+	start := time.Now()
+	if _, err := DialWithOptions(context.Background(), ts.URL, opts); err == nil {
+		t.Fatal("expected dial to time out")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("dial took %s, expected it to give up after the dial timeout", elapsed)
+	}
+}
+
+func TestCallTimeout(t *testing.T) {
+	slow, ts := newSlowServer(t, 100*time.Millisecond)
+	defer ts.Close()
+
+	// A slow dial doesn't use up the call timeout.
+	opts := DialOptions{DialTimeout: 5 * time.Second, CallTimeout: 50 * time.Millisecond}
+	node, err := DialWithOptions(context.Background(), ts.URL, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	slow.setDelay(0)
+	if _, err := node.BlockNumber(context.Background()); err != nil {
+		t.Errorf("unexpected error for fast call: %s", err)
+	}
+
+	slow.setDelay(2 * time.Second)
+	start := time.Now()
+	if _, err := node.BlockNumber(context.Background()); err == nil {
+		t.Error("expected call to time out")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("call took %s, expected it to give up after the call timeout", elapsed)
+	}
+
+	// The caller's deadline takes precedence.
+	slow.setDelay(100 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := node.BlockNumber(ctx); err != nil {
+		t.Errorf("expected caller's deadline to override the call timeout, got: %s", err)
+	}
+}
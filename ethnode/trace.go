@@ -0,0 +1,184 @@
+package ethnode
+
+import (
+	"context"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/vipnode/vipnode/jsonrpc2"
+)
+
+// Traced wraps an EthNode so that each of its RPC operations is recorded as
+// a span by tracer.
+func Traced(node EthNode, tracer jsonrpc2.Tracer) EthNode {
+	return &tracedNode{EthNode: node, tracer: tracer}
+}
+
+type tracedNode struct {
+	EthNode
+	tracer jsonrpc2.Tracer
+}
+
+func (n *tracedNode) Enode(ctx context.Context) (enode string, err error) {
+	ctx, span := n.tracer.StartSpan(ctx, "ethnode.Enode")
+	defer func() { span.End(err) }()
+	return n.EthNode.Enode(ctx)
+}
+
+func (n *tracedNode) AddTrustedPeer(ctx context.Context, nodeID string) (err error) {
+	ctx, span := n.tracer.StartSpan(ctx, "ethnode.AddTrustedPeer")
+	defer func() { span.End(err) }()
+	return n.EthNode.AddTrustedPeer(ctx, nodeID)
+}
+
+func (n *tracedNode) RemoveTrustedPeer(ctx context.Context, nodeID string) (err error) {
+	ctx, span := n.tracer.StartSpan(ctx, "ethnode.RemoveTrustedPeer")
+	defer func() { span.End(err) }()
+	return n.EthNode.RemoveTrustedPeer(ctx, nodeID)
+}
+
+func (n *tracedNode) ConnectPeer(ctx context.Context, nodeURI string) (err error) {
+	ctx, span := n.tracer.StartSpan(ctx, "ethnode.ConnectPeer")
+	defer func() { span.End(err) }()
+	return n.EthNode.ConnectPeer(ctx, nodeURI)
+}
+
+func (n *tracedNode) DisconnectPeer(ctx context.Context, nodeID string) (err error) {
+	ctx, span := n.tracer.StartSpan(ctx, "ethnode.DisconnectPeer")
+	defer func() { span.End(err) }()
+	return n.EthNode.DisconnectPeer(ctx, nodeID)
+}
+
+func (n *tracedNode) Peers(ctx context.Context) (peers []PeerInfo, err error) {
+	ctx, span := n.tracer.StartSpan(ctx, "ethnode.Peers")
+	defer func() { span.End(err) }()
+	return n.EthNode.Peers(ctx)
+}
+
+func (n *tracedNode) PeersLite(ctx context.Context) (peers []PeerInfo, err error) {
+	ctx, span := n.tracer.StartSpan(ctx, "ethnode.PeersLite")
+	defer func() { span.End(err) }()
+	return n.EthNode.PeersLite(ctx)
+}
+
+func (n *tracedNode) PeersByKind(ctx context.Context) (kinds map[NodeKind]int, err error) {
+	ctx, span := n.tracer.StartSpan(ctx, "ethnode.PeersByKind")
+	defer func() { span.End(err) }()
+	return n.EthNode.PeersByKind(ctx)
+}
+
+func (n *tracedNode) PeerSlots(ctx context.Context) (max, used, reserved int, err error) {
+	ctx, span := n.tracer.StartSpan(ctx, "ethnode.PeerSlots")
+	defer func() { span.End(err) }()
+	return n.EthNode.PeerSlots(ctx)
+}
+
+func (n *tracedNode) BlockNumber(ctx context.Context) (blockNumber uint64, err error) {
+	ctx, span := n.tracer.StartSpan(ctx, "ethnode.BlockNumber")
+	defer func() { span.End(err) }()
+	return n.EthNode.BlockNumber(ctx)
+}
+
+func (n *tracedNode) LatestBlock(ctx context.Context) (number uint64, timestamp time.Time, err error) {
+	ctx, span := n.tracer.StartSpan(ctx, "ethnode.LatestBlock")
+	defer func() { span.End(err) }()
+	return n.EthNode.LatestBlock(ctx)
+}
+
+func (n *tracedNode) ForkID(ctx context.Context) (hash [4]byte, next uint64, err error) {
+	ctx, span := n.tracer.StartSpan(ctx, "ethnode.ForkID")
+	defer func() { span.End(err) }()
+	return n.EthNode.ForkID(ctx)
+}
+
+func (n *tracedNode) FeeHistory(ctx context.Context, blocks int, rewardPercentiles []float64) (history *FeeHistory, err error) {
+	ctx, span := n.tracer.StartSpan(ctx, "ethnode.FeeHistory")
+	defer func() { span.End(err) }()
+	return n.EthNode.FeeHistory(ctx, blocks, rewardPercentiles)
+}
+
+func (n *tracedNode) AvailableNamespaces(ctx context.Context) (namespaces map[string]bool, err error) {
+	ctx, span := n.tracer.StartSpan(ctx, "ethnode.AvailableNamespaces")
+	defer func() { span.End(err) }()
+	return n.EthNode.AvailableNamespaces(ctx)
+}
+
+func (n *tracedNode) NonceAt(ctx context.Context, address common.Address, block *big.Int) (nonce uint64, err error) {
+	ctx, span := n.tracer.StartSpan(ctx, "ethnode.NonceAt")
+	defer func() { span.End(err) }()
+	return n.EthNode.NonceAt(ctx, address, block)
+}
+
+func (n *tracedNode) SendRawTransaction(ctx context.Context, signedTx []byte) (hash common.Hash, err error) {
+	ctx, span := n.tracer.StartSpan(ctx, "ethnode.SendRawTransaction")
+	defer func() { span.End(err) }()
+	return n.EthNode.SendRawTransaction(ctx, signedTx)
+}
+
+func (n *tracedNode) DataDir(ctx context.Context) (path string, err error) {
+	ctx, span := n.tracer.StartSpan(ctx, "ethnode.DataDir")
+	defer func() { span.End(err) }()
+	return n.EthNode.DataDir(ctx)
+}
+
+func (n *tracedNode) GenesisHash(ctx context.Context) (hash common.Hash, err error) {
+	ctx, span := n.tracer.StartSpan(ctx, "ethnode.GenesisHash")
+	defer func() { span.End(err) }()
+	return n.EthNode.GenesisHash(ctx)
+}
+
+func (n *tracedNode) IsMining(ctx context.Context) (mining bool, err error) {
+	ctx, span := n.tracer.StartSpan(ctx, "ethnode.IsMining")
+	defer func() { span.End(err) }()
+	return n.EthNode.IsMining(ctx)
+}
+
+func (n *tracedNode) IsHealing(ctx context.Context) (healing bool, err error) {
+	ctx, span := n.tracer.StartSpan(ctx, "ethnode.IsHealing")
+	defer func() { span.End(err) }()
+	return n.EthNode.IsHealing(ctx)
+}
+
+func (n *tracedNode) SyncProgress(ctx context.Context) (progress *SyncProgress, err error) {
+	ctx, span := n.tracer.StartSpan(ctx, "ethnode.SyncProgress")
+	defer func() { span.End(err) }()
+	return n.EthNode.SyncProgress(ctx)
+}
+
+func (n *tracedNode) ChainConfig(ctx context.Context) (config *params.ChainConfig, err error) {
+	ctx, span := n.tracer.StartSpan(ctx, "ethnode.ChainConfig")
+	defer func() { span.End(err) }()
+	return n.EthNode.ChainConfig(ctx)
+}
+
+func (n *tracedNode) BlockGasLimit(ctx context.Context) (limit uint64, err error) {
+	ctx, span := n.tracer.StartSpan(ctx, "ethnode.BlockGasLimit")
+	defer func() { span.End(err) }()
+	return n.EthNode.BlockGasLimit(ctx)
+}
+
+func (n *tracedNode) ClientVersion(ctx context.Context) (version string, err error) {
+	ctx, span := n.tracer.StartSpan(ctx, "ethnode.ClientVersion")
+	defer func() { span.End(err) }()
+	return n.EthNode.ClientVersion(ctx)
+}
+
+func (n *tracedNode) TxPoolStatus(ctx context.Context) (pending, queued uint64, err error) {
+	ctx, span := n.tracer.StartSpan(ctx, "ethnode.TxPoolStatus")
+	defer func() { span.End(err) }()
+	return n.EthNode.TxPoolStatus(ctx)
+}
+
+func (n *tracedNode) NodeUptime(ctx context.Context) (uptime time.Duration, err error) {
+	ctx, span := n.tracer.StartSpan(ctx, "ethnode.NodeUptime")
+	defer func() { span.End(err) }()
+	return n.EthNode.NodeUptime(ctx)
+}
+
+func (n *tracedNode) ChainHead(ctx context.Context) (head *HeadInfo, err error) {
+	ctx, span := n.tracer.StartSpan(ctx, "ethnode.ChainHead")
+	defer func() { span.End(err) }()
+	return n.EthNode.ChainHead(ctx)
+}
@@ -0,0 +1,75 @@
+package ethnode
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/vipnode/vipnode/jsonrpc2"
+)
+
+type fakeNode struct {
+	EthNode
+	gotCtx context.Context
+}
+
+func (n *fakeNode) Peers(ctx context.Context) ([]PeerInfo, error) {
+	n.gotCtx = ctx
+	return []PeerInfo{{ID: "foo"}}, nil
+}
+
+func (n *fakeNode) ConnectPeer(ctx context.Context, nodeURI string) error {
+	n.gotCtx = ctx
+	return errors.New("connect failed")
+}
+
+type spanKey struct{}
+
+type recordedSpan struct {
+	name string
+	err  error
+}
+
+func (s *recordedSpan) End(err error) { s.err = err }
+
+type recordingTracer struct {
+	spans []*recordedSpan
+}
+
+func (t *recordingTracer) StartSpan(ctx context.Context, name string) (context.Context, jsonrpc2.Span) {
+	span := &recordedSpan{name: name}
+	t.spans = append(t.spans, span)
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+func (t *recordingTracer) Inject(ctx context.Context) map[string]string { return nil }
+func (t *recordingTracer) Extract(ctx context.Context, carrier map[string]string) context.Context {
+	return ctx
+}
+
+func TestTraced(t *testing.T) {
+	tracer := &recordingTracer{}
+	fake := &fakeNode{}
+	node := Traced(fake, tracer)
+
+	peers, err := node.Peers(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(peers) != 1 {
+		t.Errorf("unexpected peers: %v", peers)
+	}
+	if len(tracer.spans) != 1 || tracer.spans[0].name != "ethnode.Peers" || tracer.spans[0].err != nil {
+		t.Errorf("unexpected spans: %+v", tracer.spans)
+	}
+	if fake.gotCtx.Value(spanKey{}) != tracer.spans[0] {
+		t.Errorf("span context was not passed to the node")
+	}
+
+	if err := node.ConnectPeer(context.Background(), "enode://foo"); err == nil {
+		t.Fatal("expected error")
+	}
+	if len(tracer.spans) != 2 || tracer.spans[1].name != "ethnode.ConnectPeer" || tracer.spans[1].err == nil {
+		t.Errorf("error was not recorded: %+v", tracer.spans)
+	}
+}
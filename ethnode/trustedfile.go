@@ -0,0 +1,91 @@
+package ethnode
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// ReadTrustedNodes returns the node IDs in a Geth trusted-nodes.json (or
+// static-nodes.json) file, which is a JSON list of enode URIs. A missing file
+// has no nodes.
+func ReadTrustedNodes(path string) ([]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var uris []string
+	if err := json.Unmarshal(data, &uris); err != nil {
+		return nil, err
+	}
+	nodeIDs := make([]string, 0, len(uris))
+	for _, uri := range uris {
+		nodeIDs = append(nodeIDs, enodeNodeID(uri))
+	}
+	return nodeIDs, nil
+}
+
+// WriteTrustedNodes replaces the file at path with the node IDs in the format
+// that Geth reads trusted-nodes.json in. Node IDs without an address are
+// enough for Geth to trust them. The file is replaced atomically, so that a
+// node which is starting up never reads a partial file.
+func WriteTrustedNodes(path string, nodeIDs []string) error {
+	uris := make([]string, 0, len(nodeIDs))
+	for _, nodeID := range nodeIDs {
+		uris = append(uris, "enode://"+enodeNodeID(nodeID))
+	}
+	data, err := json.MarshalIndent(uris, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// persist writes the managed peers to PeersFile, if set. Failures are logged
+// rather than failing the peer change, since the node itself was updated.
+func (n *ManagedNode) persist() {
+	if n.PeersFile == "" {
+		return
+	}
+	n.fileMu.Lock()
+	defer n.fileMu.Unlock()
+	if err := WriteTrustedNodes(n.PeersFile, n.ManagedPeers()); err != nil {
+		logger.Printf("Failed to write managed peers to %q: %s", n.PeersFile, err)
+	}
+}
+
+// Reconcile adds the peers in PeersFile as managed trusted peers, such as
+// after vipnode restarts, so that they are tracked and eventually removed
+// again. It's a noop if PeersFile is not set.
+func (n *ManagedNode) Reconcile(ctx context.Context) error {
+	if n.PeersFile == "" {
+		return nil
+	}
+	nodeIDs, err := ReadTrustedNodes(n.PeersFile)
+	if err != nil {
+		return err
+	}
+	for _, nodeID := range nodeIDs {
+		if err := n.AddTrustedPeer(ctx, nodeID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
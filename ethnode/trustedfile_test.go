@@ -0,0 +1,97 @@
+package ethnode
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+func tempPeersFile(t *testing.T) (path string, cleanup func()) {
+	dir, err := ioutil.TempDir("", "vipnodetest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filepath.Join(dir, "trusted-nodes.json"), func() { os.RemoveAll(dir) }
+}
+
+// testNodeID returns a new valid node ID.
+func testNodeID(t *testing.T) string {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fmt.Sprintf("%x", crypto.FromECDSAPub(&key.PublicKey)[1:])
+}
+
+func TestTrustedNodesFile(t *testing.T) {
+	path, cleanup := tempPeersFile(t)
+	defer cleanup()
+
+	if nodeIDs, err := ReadTrustedNodes(path); err != nil || len(nodeIDs) != 0 {
+		t.Errorf("missing file: got %q, %v", nodeIDs, err)
+	}
+
+	want := []string{testNodeID(t), testNodeID(t)}
+	if err := WriteTrustedNodes(path, want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadTrustedNodes(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q; want %q", got, want)
+	}
+
+	// Geth must be able to parse every entry
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var uris []string
+	if err := json.Unmarshal(data, &uris); err != nil {
+		t.Fatal(err)
+	}
+	for i, uri := range uris {
+		if _, err := enode.ParseV4(uri); err != nil {
+			t.Errorf("geth failed to parse %q: %s", uri, err)
+		}
+		if uri != "enode://"+want[i] {
+			t.Errorf("wrong entry: %q", uri)
+		}
+	}
+}
+
+func TestManagedNodePeersFile(t *testing.T) {
+	path, cleanup := tempPeersFile(t)
+	defer cleanup()
+	ctx := context.Background()
+	a, b := testNodeID(t), testNodeID(t)
+
+	node := Managed(&peersNode{})
+	node.PeersFile = path
+	node.AddTrustedPeer(ctx, a)
+	node.AddTrustedPeer(ctx, b)
+	node.RemoveTrustedPeer(ctx, a)
+	if got, _ := ReadTrustedNodes(path); !reflect.DeepEqual(got, []string{b}) {
+		t.Errorf("persisted peers: got %q; want %q", got, []string{b})
+	}
+
+	// Reconcile after a restart
+	restarted := Managed(&peersNode{})
+	restarted.PeersFile = path
+	if err := restarted.Reconcile(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := restarted.ManagedPeers(); !reflect.DeepEqual(got, []string{b}) {
+		t.Errorf("reconciled peers: got %q; want %q", got, []string{b})
+	}
+}
@@ -0,0 +1,129 @@
+package ethnode
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// TxRejection is the reason a node rejected a transaction.
+type TxRejection int
+
+const (
+	// TxRejectedOther is any reason that isn't recognized, see the message.
+	TxRejectedOther TxRejection = iota
+	// TxAlreadyKnown means the node already has the transaction, so it was
+	// sent before and doesn't need to be sent again.
+	TxAlreadyKnown
+	// TxUnderpriced means the gas price is too low to be accepted, or to
+	// replace a pending transaction with the same nonce.
+	TxUnderpriced
+	// TxNonceTooLow means a transaction with the same nonce was already mined.
+	TxNonceTooLow
+	// TxInsufficientFunds means the sender can't pay for the gas and value.
+	TxInsufficientFunds
+	// TxReverted means the transaction failed when it was executed.
+	TxReverted
+)
+
+func (r TxRejection) String() string {
+	switch r {
+	case TxAlreadyKnown:
+		return "already known"
+	case TxUnderpriced:
+		return "underpriced"
+	case TxNonceTooLow:
+		return "nonce too low"
+	case TxInsufficientFunds:
+		return "insufficient funds"
+	case TxReverted:
+		return "reverted"
+	default:
+		return "rejected"
+	}
+}
+
+// txRejectionMessages match the error messages of Geth and Parity to a
+// rejection reason. They're checked in order, with lowercase messages.
+var txRejectionMessages = []struct {
+	substr string
+	reason TxRejection
+}{
+	{"already known", TxAlreadyKnown},
+	{"known transaction", TxAlreadyKnown},
+	{"already imported", TxAlreadyKnown},
+	{"underpriced", TxUnderpriced},
+	{"gas price is too low", TxUnderpriced},
+	{"fee too low", TxUnderpriced},
+	{"nonce too low", TxNonceTooLow},
+	{"nonce is too low", TxNonceTooLow},
+	{"insufficient funds", TxInsufficientFunds},
+	{"reverted", TxReverted},
+}
+
+// TxRejectedError is returned by SendRawTransaction when the node responded
+// with an error, so the transaction was not accepted.
+type TxRejectedError struct {
+	Reason  TxRejection
+	Message string // Error message from the node
+}
+
+func (err TxRejectedError) Error() string {
+	return fmt.Sprintf("transaction %s: %s", err.Reason, err.Message)
+}
+
+// txRejected returns the TxRejectedError for the error message of a node.
+func txRejected(message string) TxRejectedError {
+	lower := strings.ToLower(message)
+	for _, m := range txRejectionMessages {
+		if strings.Contains(lower, m.substr) {
+			return TxRejectedError{Reason: m.reason, Message: message}
+		}
+	}
+	return TxRejectedError{Reason: TxRejectedOther, Message: message}
+}
+
+// blockArg formats a block number argument, a nil block is the pending
+// state.
+func blockArg(block *big.Int) string {
+	if block == nil {
+		return "pending"
+	}
+	return hexutil.EncodeBig(block)
+}
+
+// nonceAt is the NonceAt implementation shared by node kinds, since
+// eth_getTransactionCount is standard.
+func nonceAt(ctx context.Context, client *rpc.Client, address common.Address, block *big.Int) (uint64, error) {
+	var result string
+	if err := call(ctx, client, &result, "eth_getTransactionCount", address, blockArg(block)); err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(result, 0, 64)
+}
+
+// sendRawTransaction is the SendRawTransaction implementation shared by node
+// kinds, since eth_sendRawTransaction is standard. The hash is returned along
+// with TxAlreadyKnown errors, since the transaction was sent.
+func sendRawTransaction(ctx context.Context, client *rpc.Client, signedTx []byte) (common.Hash, error) {
+	var hash common.Hash
+	err := call(ctx, client, &hash, "eth_sendRawTransaction", hexutil.Bytes(signedTx))
+	if err, ok := err.(RPCError); ok && err.Code != errCodeMethodNotFound {
+		rejected := txRejected(err.Message)
+		if rejected.Reason == TxAlreadyKnown {
+			return crypto.Keccak256Hash(signedTx), rejected
+		}
+		return common.Hash{}, rejected
+	}
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return hash, nil
+}
@@ -0,0 +1,146 @@
+package ethnode
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// MockTxEth serves eth_getTransactionCount, with the pending state being 5
+// transactions ahead of block 0x64.
+type MockTxEth struct {
+	MockEth
+	address common.Address
+}
+
+func (s *MockTxEth) GetTransactionCount(address common.Address, block string) (string, error) {
+	s.address = address
+	switch block {
+	case "pending":
+		return "0x1f", nil
+	case "0x64":
+		return "0x1a", nil
+	}
+	return "0x0", nil
+}
+
+func mockTxNode(t *testing.T, eth interface{}) *rpc.Client {
+	server := rpc.NewServer()
+	if err := server.RegisterName("eth", eth); err != nil {
+		t.Fatal(err)
+	}
+	return rpc.DialInProc(server)
+}
+
+func TestNonceAt(t *testing.T) {
+	eth := &MockTxEth{}
+	client := mockTxNode(t, eth)
+	defer client.Close()
+
+	address := common.HexToAddress("0x961aa96febee5465149a0787b03bfa14d8e9033f")
+	testcases := []struct {
+		node  EthNode
+		block *big.Int
+		want  uint64
+	}{
+		{&gethNode{client: client}, nil, 31},
+		{&gethNode{client: client}, big.NewInt(100), 26},
+		{&parityNode{client: client}, nil, 31},
+	}
+	for _, tc := range testcases {
+		nonce, err := tc.node.NonceAt(context.Background(), address, tc.block)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if nonce != tc.want {
+			t.Errorf("%s at block %v: got nonce %d; want %d", tc.node.Kind(), tc.block, nonce, tc.want)
+		}
+		if eth.address != address {
+			t.Errorf("wrong address: %s", eth.address.Hex())
+		}
+	}
+
+	// Nodes without eth_getTransactionCount
+	noTx := mockTxNode(t, &MockEth{})
+	defer noTx.Close()
+	if _, err := (&gethNode{client: noTx}).NonceAt(context.Background(), address, nil); err == nil {
+		t.Error("expected error")
+	} else if err, ok := err.(RPCError); !ok || err.Code != errCodeMethodNotFound {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+// MockSendEth serves eth_sendRawTransaction, responding with err if set.
+type MockSendEth struct {
+	MockEth
+	sent []hexutil.Bytes
+	err  error
+}
+
+func (s *MockSendEth) SendRawTransaction(data hexutil.Bytes) (common.Hash, error) {
+	if s.err != nil {
+		return common.Hash{}, s.err
+	}
+	s.sent = append(s.sent, data)
+	return crypto.Keccak256Hash(data), nil
+}
+
+func TestSendRawTransaction(t *testing.T) {
+	eth := &MockSendEth{}
+	client := mockTxNode(t, eth)
+	defer client.Close()
+
+	signedTx := []byte{0xf8, 0x6b, 0x80, 0x84, 0x3b, 0x9a, 0xca, 0x00}
+	wantHash := crypto.Keccak256Hash(signedTx)
+	node := &gethNode{client: client}
+
+	hash, err := node.SendRawTransaction(context.Background(), signedTx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash != wantHash {
+		t.Errorf("got hash %s; want %s", hash.Hex(), wantHash.Hex())
+	}
+	if len(eth.sent) != 1 || !bytes.Equal(eth.sent[0], signedTx) {
+		t.Errorf("wrong transaction sent: %x", eth.sent)
+	}
+
+	testcases := []struct {
+		message  string
+		reason   TxRejection
+		wantHash bool
+	}{
+		{"already known", TxAlreadyKnown, true},
+		{"known transaction: " + wantHash.Hex()[2:], TxAlreadyKnown, true},
+		{"Transaction with the same hash was already imported.", TxAlreadyKnown, true},
+		{"transaction underpriced", TxUnderpriced, false},
+		{"replacement transaction underpriced", TxUnderpriced, false},
+		{"Transaction gas price is too low. There is another transaction with same nonce in the queue.", TxUnderpriced, false},
+		{"nonce too low", TxNonceTooLow, false},
+		{"insufficient funds for gas * price + value", TxInsufficientFunds, false},
+		{"execution reverted", TxReverted, false},
+		{"invalid sender", TxRejectedOther, false},
+	}
+	for _, tc := range testcases {
+		eth.err = errors.New(tc.message)
+		hash, err := (&parityNode{client: client}).SendRawTransaction(context.Background(), signedTx)
+		rejected, ok := err.(TxRejectedError)
+		if !ok {
+			t.Errorf("%q: expected TxRejectedError, got: %v", tc.message, err)
+			continue
+		}
+		if rejected.Reason != tc.reason || rejected.Message != tc.message {
+			t.Errorf("%q: got %s (%q); want %s", tc.message, rejected.Reason, rejected.Message, tc.reason)
+		}
+		if gotHash := hash == wantHash; gotHash != tc.wantHash {
+			t.Errorf("%q: got hash %s", tc.message, hash.Hex())
+		}
+	}
+}
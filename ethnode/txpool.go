@@ -0,0 +1,22 @@
+package ethnode
+
+import (
+	"context"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// txPoolStatus is the TxPoolStatus implementation shared by node kinds,
+// from txpool_status. It returns ErrNotSupported if the node doesn't provide
+// the method or the txpool API is disabled.
+func txPoolStatus(ctx context.Context, client *rpc.Client) (pending, queued uint64, err error) {
+	var status map[string]interface{}
+	err = call(ctx, client, &status, "txpool_status")
+	if err, ok := err.(RPCError); ok && err.Code == errCodeMethodNotFound {
+		return 0, 0, ErrNotSupported
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	return parseQuantity(status["pending"]), parseQuantity(status["queued"]), nil
+}
@@ -0,0 +1,36 @@
+package ethnode
+
+import (
+	"context"
+	"testing"
+)
+
+// MockTxPool serves txpool_status with a fixed pool size.
+type MockTxPool struct {
+	pending, queued string
+}
+
+func (s *MockTxPool) Status() map[string]string {
+	return map[string]string{"pending": s.pending, "queued": s.queued}
+}
+
+func TestTxPoolStatus(t *testing.T) {
+	client := serveMocks(t, map[string]interface{}{"txpool": &MockTxPool{"0x1f4", "0x2a"}})
+	defer client.Close()
+	for _, node := range []EthNode{&gethNode{client: client}, &parityNode{client: client}} {
+		pending, queued, err := node.TxPoolStatus(context.Background())
+		if err != nil {
+			t.Fatalf("%s: %s", node.Kind(), err)
+		}
+		if pending != 500 || queued != 42 {
+			t.Errorf("%s: got %d pending and %d queued; want 500 and 42", node.Kind(), pending, queued)
+		}
+	}
+
+	// Nodes with the txpool API disabled.
+	disabled := serveMocks(t, map[string]interface{}{"eth": &MockEth{}})
+	defer disabled.Close()
+	if _, _, err := (&gethNode{client: disabled}).TxPoolStatus(context.Background()); err != ErrNotSupported {
+		t.Errorf("expected ErrNotSupported without the txpool API, got: %v", err)
+	}
+}
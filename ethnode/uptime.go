@@ -0,0 +1,37 @@
+package ethnode
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// gethIPCName is the name of the IPC endpoint that Geth creates in its data
+// directory by default.
+const gethIPCName = "geth.ipc"
+
+// gethUptime is the NodeUptime implementation of Geth. Neither admin_nodeInfo
+// nor any other RPC method reports when the node started, but Geth recreates
+// its IPC endpoint on startup, so its modification time is the start time of
+// the process. It returns ErrNotSupported if the node doesn't expose its data
+// directory, or if the endpoint can't be found, such as when the node runs on
+// another machine, or with a custom --ipcpath or --ipcdisable.
+func gethUptime(ctx context.Context, client *rpc.Client, now time.Time) (time.Duration, error) {
+	dataDir, err := adminDataDir(ctx, client)
+	if err != nil {
+		return 0, err
+	}
+	info, err := os.Stat(filepath.Join(dataDir, gethIPCName))
+	if err != nil {
+		return 0, ErrNotSupported
+	}
+	uptime := now.Sub(info.ModTime())
+	if uptime < 0 {
+		// Clock skew between the node and the agent.
+		return 0, nil
+	}
+	return uptime, nil
+}
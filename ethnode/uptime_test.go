@@ -0,0 +1,73 @@
+package ethnode
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNodeUptime(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vipnode-uptime")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// A regular file stands in for the socket, only its mtime matters.
+	ipc := filepath.Join(dir, gethIPCName)
+	if err := ioutil.WriteFile(ipc, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	started := time.Now().Add(-2 * time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(ipc, started, started); err != nil {
+		t.Fatal(err)
+	}
+
+	client := serveMocks(t, map[string]interface{}{"admin": &MockDatadirAdmin{dir}})
+	defer client.Close()
+	now := started.Add(2 * time.Hour)
+	uptime, err := gethUptime(context.Background(), client, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uptime != 2*time.Hour {
+		t.Errorf("got uptime %s; want 2h", uptime)
+	}
+
+	// The node's clock is ahead of ours.
+	if uptime, err := gethUptime(context.Background(), client, started.Add(-time.Minute)); err != nil || uptime != 0 {
+		t.Errorf("got uptime %s, err %v; want 0", uptime, err)
+	}
+}
+
+func TestNodeUptimeUnsupported(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vipnode-uptime")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	testcases := []struct {
+		name     string
+		services map[string]interface{}
+	}{
+		{"no admin API", map[string]interface{}{"eth": &MockEth{}}},
+		{"ephemeral datadir", map[string]interface{}{"admin": &MockDatadirAdmin{""}}},
+		// Running on another machine, or with --ipcdisable.
+		{"no IPC endpoint", map[string]interface{}{"admin": &MockDatadirAdmin{dir}}},
+	}
+	for _, tc := range testcases {
+		client := serveMocks(t, tc.services)
+		_, err := (&gethNode{client: client}).NodeUptime(context.Background())
+		client.Close()
+		if err != ErrNotSupported {
+			t.Errorf("%s: expected ErrNotSupported, got: %v", tc.name, err)
+		}
+	}
+
+	if _, err := (&parityNode{}).NodeUptime(context.Background()); err != ErrNotSupported {
+		t.Errorf("parity: expected ErrNotSupported, got: %v", err)
+	}
+}
@@ -2,29 +2,53 @@ package main
 
 import (
 	"context"
+	"crypto/ecdsa"
 	"fmt"
 	"os"
 	"os/signal"
+	"strings"
+	"time"
 
 	"github.com/ethereum/go-ethereum/p2p/discv5"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/vipnode/vipnode/ethnode"
 	"github.com/vipnode/vipnode/host"
 	"github.com/vipnode/vipnode/jsonrpc2"
+	"github.com/vipnode/vipnode/jsonrpc2/longpoll"
+	"github.com/vipnode/vipnode/jsonrpc2/tcp"
 	ws "github.com/vipnode/vipnode/jsonrpc2/ws/gorilla"
 	"github.com/vipnode/vipnode/pool"
 	"github.com/vipnode/vipnode/pool/store/memory"
 )
 
-func runHost(options Options) error {
-	remoteNode, err := findRPC(options.Host.RPC)
+// trustedRefreshInterval is how often disconnected whitelisted peers are
+// re-added, and trustedRefreshLimit is the most re-added each time.
+var trustedRefreshInterval = time.Minute
+var trustedRefreshLimit = 10
+
+// runHost runs the host agent until it's stopped. It calls connected
+// once it has registered with the pool.
+func runHost(options Options, connected func()) error {
+	remoteNode, err := findRPC(options.Host.RPC, dialOptions(options))
 	if err != nil {
 		return err
 	}
+	defer remoteNode.Close()
+	capabilities, err := parseCapabilities(options.Host.Capability)
+	if err != nil {
+		return ErrExplain{err, "Capabilities must be a name or name=value, such as \"archive\"."}
+	}
 	privkey, err := findNodeKey(options.Host.NodeKey)
 	if err != nil {
 		return ErrExplain{err, "Failed to find node private key. Use --nodekey to specify the correct path."}
 	}
 	// Confirm that nodeID matches the private key
 	nodeID := discv5.PubkeyID(&privkey.PublicKey).String()
+	if namespaces, err := remoteNode.AvailableNamespaces(context.Background()); err == nil {
+		if missing := ethnode.MissingNamespaces(remoteNode.Kind(), namespaces); len(missing) > 0 {
+			logger.Warningf("Node is missing required RPC APIs: %s. Run `vipnode probe` for how to enable them.", strings.Join(missing, ", "))
+		}
+	}
 	remoteEnode, err := remoteNode.Enode(context.Background())
 	if err != nil {
 		return err
@@ -37,16 +61,101 @@ func runHost(options Options) error {
 		logger.Warning("No --payout address provided, will not receive pool payments.")
 	}
 
-	h := host.New(remoteNode, options.Host.Payout)
-	if options.Host.NodeURI != "" {
-		if err := matchEnode(options.Host.NodeURI, nodeID); err != nil {
+	var hostNode ethnode.EthNode = remoteNode
+	var reporter *pool.ErrorReporter
+	if options.Host.ReportErrors {
+		reporter = newErrorReporter(remoteNode)
+		hostNode = ethnode.Traced(remoteNode, reporter)
+	}
+	var proxy *host.RPCProxy
+	if options.Host.Proxy {
+		var proxyClient *rpc.Client
+		proxy, proxyClient, err = dialRPCProxy(options)
+		if err != nil {
 			return err
 		}
-		h.NodeURI = options.Host.NodeURI
-	} else {
-		// This will populate all the fields except the host, which is fine
-		// because the pool will use the connection's ip as the host.
-		h.NodeURI = remoteEnode
+		defer proxyClient.Close()
+		if capabilities == nil {
+			capabilities = map[string]string{}
+		}
+		capabilities[host.ProxyCapability] = ""
+	}
+	if len(options.Host.Backend) > 0 {
+		nodes := []ethnode.EthNode{hostNode}
+		for _, rpcPath := range options.Host.Backend {
+			node, err := findRPC(rpcPath, dialOptions(options))
+			if err != nil {
+				return err
+			}
+			defer node.Close()
+			nodes = append(nodes, node)
+		}
+		logger.Infof("Balancing clients across %d nodes.", len(nodes))
+		balancer := host.NewBalancer(nodes...)
+		if len(options.Host.BackendWeight) > 0 {
+			if err := balancer.SetWeights(options.Host.BackendWeight...); err != nil {
+				return ErrExplain{err, "There must be a --backend-weight for --rpc and for each --backend-rpc, in the same order."}
+			}
+		}
+		hostNode = balancer
+	}
+
+	// Keep track of which peers we whitelisted, as opposed to organic peers.
+	managedNode := ethnode.Managed(hostNode)
+	if options.Host.TrustedNodes != "" {
+		managedNode.PeersFile = options.Host.TrustedNodes
+		ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+		err := managedNode.Reconcile(ctx)
+		cancel()
+		if err != nil {
+			return ErrExplain{err, fmt.Sprintf(`Failed to restore the whitelisted peers from "%s". Make sure it's a valid trusted-nodes.json file.`, options.Host.TrustedNodes)}
+		}
+		logger.Infof("Restored %d whitelisted peers from: %s", len(managedNode.ManagedPeers()), options.Host.TrustedNodes)
+	}
+	hostNode = managedNode
+	managedNode.RefreshLimit = trustedRefreshLimit
+	stopRefresh := make(chan struct{})
+	defer close(stopRefresh)
+	go refreshTrusted(managedNode, stopRefresh)
+
+	newHost := func() (*host.Host, error) {
+		h := host.New(hostNode, options.Host.Payout)
+		h.ReportBlockTime = options.Host.BlockTime
+		h.Protocol = options.Host.Protocol
+		h.Version = Version
+		h.Capabilities = capabilities
+		h.MaxPeers = options.Host.MaxPeers
+		h.ReserveMargin = options.Host.ReserveMargin
+		h.MiningMargin = options.Host.MiningMargin
+		h.DrainTrials = options.Host.DrainTrials
+		h.FullThreshold = options.Host.FullAt
+		h.AvailableThreshold = options.Host.AvailableAt
+		h.TxPoolThreshold = options.Host.TxPoolLimit
+		h.Churn.Threshold = options.Host.ChurnLimit
+		h.ClockSkewCallback = warnClockSkew
+		h.ErrorReporter = reporter
+		h.RPCProxy = proxy
+		if options.Host.NodeURI != "" {
+			if err := matchEnode(options.Host.NodeURI, nodeID); err != nil {
+				return nil, err
+			}
+			h.NodeURI = options.Host.NodeURI
+		} else {
+			// This will populate all the fields except the host, which is fine
+			// because the pool will use the connection's ip as the host.
+			h.NodeURI = remoteEnode
+		}
+		if options.Host.InternalURI != "" {
+			if err := matchEnode(options.Host.InternalURI, nodeID); err != nil {
+				return nil, err
+			}
+			h.InternalNodeURI = options.Host.InternalURI
+		}
+		return h, nil
+	}
+	h, err := newHost()
+	if err != nil {
+		return err
 	}
 
 	if options.Host.Pool == ":memory:" {
@@ -61,52 +170,184 @@ func runHost(options Options) error {
 		if err := h.Start(remotePool); err != nil {
 			return err
 		}
+		connected()
 		return h.Wait()
 	}
 
+	// Each additional pool gets its own host, sharing the node's capacity.
+	hosts := []*host.Host{h}
+	poolURIs := []string{options.Host.Pool}
+	if len(options.Host.ExtraPool) > 0 {
+		partition := host.NewPartition()
+		partition.Join(h)
+		for _, poolURI := range options.Host.ExtraPool {
+			extra, err := newHost()
+			if err != nil {
+				return err
+			}
+			partition.Join(extra)
+			hosts = append(hosts, extra)
+			poolURIs = append(poolURIs, poolURI)
+		}
+		logger.Infof("Splitting the node between %d pools.", len(hosts))
+	}
+
+	errChan := make(chan error, 2*len(hosts))
+	var remotes []*jsonrpc2.Remote
+	defer func() {
+		for _, remote := range remotes {
+			remote.Close()
+		}
+	}()
+	for i, h := range hosts {
+		remote, err := startHost(h, poolURIs[i], privkey, ws.DialOptions{Compression: options.WSCompression}, errChan)
+		if err != nil {
+			for _, started := range hosts[:i] {
+				started.Stop()
+			}
+			return err
+		}
+		remotes = append(remotes, remote)
+	}
+	connected()
+
+	if options.Host.Control != "" {
+		control, err := serveControl(options.Host.Control, hosts)
+		if err != nil {
+			return ErrExplain{err, fmt.Sprintf(`Failed to listen for runtime commands on "%s". Make sure no other vipnode agent is using --control with the same path.`, options.Host.Control)}
+		}
+		defer control.Close()
+		logger.Infof("Accepting runtime commands on: %s", options.Host.Control)
+	}
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt)
+	go func() {
+		for _ = range sigCh {
+			logger.Info("Shutting down...")
+			for _, h := range hosts {
+				h.Stop()
+			}
+		}
+	}()
+
+	// Closing the remaining pool connections on the way out stops the other
+	// hosts too, rather than leaving them served by a half-stopped agent.
+	return <-errChan
+}
+
+// refreshTrusted periodically re-adds whitelisted peers which the node may
+// have dropped from its trusted peers, until stop is closed.
+func refreshTrusted(node *ethnode.ManagedNode, stop <-chan struct{}) {
+	ticker := time.NewTicker(trustedRefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+			readded, err := node.Refresh(ctx)
+			cancel()
+			if err != nil {
+				logger.Warningf("Failed to refresh whitelisted peers: %s", err)
+			} else if len(readded) > 0 {
+				logger.Infof("Re-added %d whitelisted peers which are disconnected, in case the node dropped them.", len(readded))
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// startHost connects to the pool at poolURI and starts h on it. Errors from
+// serving the pool connection and from h stopping are sent to errChan.
+func startHost(h *host.Host, poolURI string, privkey *ecdsa.PrivateKey, wsOpts ws.DialOptions, errChan chan<- error) (*jsonrpc2.Remote, error) {
 	// Dial host to pool
-	ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
-	poolCodec, err := ws.WebSocketDial(ctx, options.Host.Pool)
-	cancel()
+	var poolCodec jsonrpc2.Codec
+	dial := func(poolURI string) (err error) {
+		ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+		defer cancel()
+		if strings.HasPrefix(poolURI, "tcp://") {
+			poolCodec, err = tcp.Dial(ctx, strings.TrimPrefix(poolURI, "tcp://"))
+		} else if strings.HasPrefix(poolURI, pollScheme) {
+			poolCodec, err = longpoll.Dial(ctx, strings.TrimPrefix(poolURI, pollScheme), nil)
+		} else {
+			poolCodec, err = ws.DialWithOptions(ctx, poolURI, wsOpts)
+		}
+		return err
+	}
+	var err error
+	if d := poolDiscovery(poolURI); d != nil {
+		// Try each discovered pool in order
+		poolURI, err = d.Try(context.Background(), dial)
+	} else {
+		err = dial(poolURI)
+	}
 	if err != nil {
-		return ErrExplainRetry{ErrExplain{err, "Failed to connect to the pool RPC API."}}
+		return nil, ErrExplainRetry{ErrExplain{err, "Failed to connect to the pool RPC API."}}
 	}
-	logger.Infof("Connected to vipnode pool: %s", options.Host.Pool)
+	logger.Infof("Connected to vipnode pool: %s", poolURI)
 
 	rpcServer := &jsonrpc2.Server{}
 	if err := rpcServer.RegisterMethod("vipnode_whitelist", h, "Whitelist"); err != nil {
-		return err
+		return nil, err
+	}
+	if err := rpcServer.RegisterMethod("vipnode_disconnect", h, "Disconnect"); err != nil {
+		return nil, err
+	}
+	if h.RPCProxy != nil {
+		if err := rpcServer.RegisterMethod("vipnode_proxy", h, "Proxy"); err != nil {
+			return nil, err
+		}
 	}
-	rpcPool := jsonrpc2.Remote{
+	rpcPool := &jsonrpc2.Remote{
 		Client: &jsonrpc2.Client{},
 		Server: rpcServer,
 		Codec:  poolCodec,
 	}
 
-	errChan := make(chan error)
 	go func() {
 		errChan <- rpcPool.Serve()
 	}()
-	remotePool := pool.Remote(&rpcPool, privkey)
+	remotePool := pool.Remote(rpcPool, privkey)
 	if err := h.Start(remotePool); err != nil {
+		rpcPool.Close()
 		if jsonrpc2.IsErrorCode(err, jsonrpc2.ErrCodeMethodNotFound, jsonrpc2.ErrCodeInvalidParams) {
 			err = ErrExplain{err, fmt.Sprintf(`Missing a required RPC method. Make sure your vipnode binary is up to date. (Current version: %s)`, Version)}
 		}
-		return err
+		return nil, err
 	}
 	go func() {
 		errChan <- h.Wait()
 	}()
+	return rpcPool, nil
+}
 
-	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, os.Interrupt)
-	go func() {
-		for _ = range sigCh {
-			logger.Info("Shutting down...")
-			h.Stop()
-		}
-	}()
-
-	return <-errChan
-
+// dialRPCProxy returns the RPCProxy for --rpc-proxy, with its own connection
+// to the host node for the proxied calls, which EthNode doesn't wrap.
+func dialRPCProxy(options Options) (*host.RPCProxy, *rpc.Client, error) {
+	allow := ethnode.MethodAllowlist(options.Host.ProxyAllow)
+	if err := allow.Validate(); err != nil {
+		return nil, nil, ErrExplain{err, "Proxied methods must be method names or patterns, such as \"eth_get*\"."}
+	}
+	rpcPath, err := defaultRPCPath(options.Host.RPC)
+	if err != nil {
+		return nil, nil, err
+	}
+	ctx := context.Background()
+	if options.RPCDialTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, options.RPCDialTimeout)
+		defer cancel()
+	}
+	client, err := rpc.DialContext(ctx, rpcPath)
+	if err != nil {
+		return nil, nil, ErrExplain{err, fmt.Sprintf(`Failed to connect to the node for --rpc-proxy on "%s".`, rpcPath)}
+	}
+	proxy := &host.RPCProxy{
+		Caller: &ethnode.RawCaller{Client: client},
+		Allow:  allow,
+		Rate:   options.Host.ProxyRate,
+		Burst:  options.Host.ProxyBurst,
+	}
+	return proxy, client, nil
 }
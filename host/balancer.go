@@ -0,0 +1,457 @@
+package host
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/vipnode/vipnode/ethnode"
+)
+
+// ErrNoBackends is returned when every backend node of a Balancer has failed.
+var ErrNoBackends = errors.New("no healthy backend nodes")
+
+// InvalidWeightsError is returned by SetWeights when the weights don't match
+// the backends.
+type InvalidWeightsError struct {
+	Backends int
+	Weights  []int
+}
+
+func (err InvalidWeightsError) Error() string {
+	return fmt.Sprintf("invalid backend weights %v: need a positive weight for each of the %d backends", err.Weights, err.Backends)
+}
+
+var _ ethnode.EthNode = &Balancer{}
+
+type backend struct {
+	node ethnode.EthNode
+	err  error // Last failure, nil if healthy
+	// clients assigned to this backend
+	clients map[string]struct{}
+	// weight is the share of clients this backend gets relative to the
+	// others, 1 unless set with SetWeights.
+	weight int
+}
+
+// Balancer is an ethnode.EthNode that distributes whitelisted clients across
+// several backend nodes, so that one agent can host on all of them. Each
+// client is trusted on the backend with the fewest clients for its weight,
+// and peers and block numbers are aggregated across backends.
+//
+// Backends have a weight of 1 unless set with SetWeights, so that beefier
+// nodes can take proportionally more clients. New clients go round-robin
+// between the backends in the ratio of their weights, while making up for
+// the clients that left or were reassigned.
+//
+// When a backend fails, its clients are reassigned to the remaining healthy
+// backends. Failed backends are retried on every update and receive new
+// clients again once they recover.
+//
+// The first node is the primary: its enode is the one advertised to the pool,
+// so clients reach the other backends through it, such as by sharing its
+// public address and node key.
+type Balancer struct {
+	mu       sync.Mutex
+	backends []*backend
+	assigned map[string]*backend
+}
+
+// NewBalancer returns a Balancer across nodes, with nodes[0] as the primary.
+func NewBalancer(nodes ...ethnode.EthNode) *Balancer {
+	b := &Balancer{
+		assigned: map[string]*backend{},
+	}
+	for _, node := range nodes {
+		b.backends = append(b.backends, &backend{node: node, clients: map[string]struct{}{}, weight: 1})
+	}
+	return b
+}
+
+// SetWeights sets the weight of each backend, in the order they were passed
+// to NewBalancer. A backend with twice the weight of another is assigned
+// twice as many clients. It returns an InvalidWeightsError unless there is a
+// positive weight for every backend. Clients which are already assigned stay
+// where they are.
+func (b *Balancer) SetWeights(weights ...int) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(weights) != len(b.backends) {
+		return InvalidWeightsError{Backends: len(b.backends), Weights: weights}
+	}
+	for _, weight := range weights {
+		if weight <= 0 {
+			return InvalidWeightsError{Backends: len(b.backends), Weights: weights}
+		}
+	}
+	for i, weight := range weights {
+		b.backends[i].weight = weight
+	}
+	return nil
+}
+
+// Backends returns the number of backends and how many clients are assigned
+// to each, or -1 for failed backends.
+func (b *Balancer) Backends() []int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	r := make([]int, 0, len(b.backends))
+	for _, be := range b.backends {
+		if be.err != nil {
+			r = append(r, -1)
+			continue
+		}
+		r = append(r, len(be.clients))
+	}
+	return r
+}
+
+// leastLoaded returns the healthy backend which would have the fewest clients
+// for its weight with one more client, excluding skip. Ties go to the earlier
+// backend. Must be called with the lock held.
+func (b *Balancer) leastLoaded(skip *backend) *backend {
+	var best *backend
+	for _, be := range b.backends {
+		if be.err != nil || be == skip {
+			continue
+		}
+		// Compares (clients+1)/weight without dividing.
+		if best == nil || (len(be.clients)+1)*best.weight < (len(best.clients)+1)*be.weight {
+			best = be
+		}
+	}
+	return best
+}
+
+// fail marks be as failed and reassigns its clients to the remaining healthy
+// backends. Must be called with the lock held.
+func (b *Balancer) fail(ctx context.Context, be *backend, err error) {
+	if be.err == nil {
+		logger.Printf("Backend node failed, reassigning %d clients: %s", len(be.clients), err)
+	}
+	be.err = err
+	for nodeID := range be.clients {
+		delete(be.clients, nodeID)
+		delete(b.assigned, nodeID)
+		if err := b.assign(ctx, nodeID, be); err != nil {
+			logger.Printf("Failed to reassign client %q: %s", nodeID, err)
+		}
+	}
+}
+
+// assign trusts nodeID on the least loaded healthy backend other than skip.
+// Must be called with the lock held.
+func (b *Balancer) assign(ctx context.Context, nodeID string, skip *backend) error {
+	for {
+		be := b.leastLoaded(skip)
+		if be == nil {
+			return ErrNoBackends
+		}
+		if err := be.node.AddTrustedPeer(ctx, nodeID); err != nil {
+			b.fail(ctx, be, err)
+			continue
+		}
+		be.clients[nodeID] = struct{}{}
+		b.assigned[nodeID] = be
+		return nil
+	}
+}
+
+// healthy calls fn on each backend, including failed ones to check if they
+// recovered, and marks backends as failed if fn errors. It returns
+// ErrNoBackends if fn failed on every backend. Must be called with the lock
+// held.
+func (b *Balancer) healthy(ctx context.Context, fn func(be *backend) error) error {
+	ok := false
+	for _, be := range b.backends {
+		if err := fn(be); err != nil {
+			b.fail(ctx, be, err)
+			continue
+		}
+		if be.err != nil {
+			logger.Printf("Backend node recovered.")
+			be.err = nil
+		}
+		ok = true
+	}
+	if !ok {
+		return ErrNoBackends
+	}
+	return nil
+}
+
+func (b *Balancer) primary() ethnode.EthNode {
+	return b.backends[0].node
+}
+
+// ContractBackend returns the primary node's contract backend.
+func (b *Balancer) ContractBackend() bind.ContractBackend {
+	return b.primary().ContractBackend()
+}
+
+// Kind returns the primary node's kind.
+func (b *Balancer) Kind() ethnode.NodeKind {
+	return b.primary().Kind()
+}
+
+// Network returns the primary node's network ID.
+func (b *Balancer) Network() ethnode.NetworkID {
+	return b.primary().Network()
+}
+
+// Enode returns the primary node's enode.
+func (b *Balancer) Enode(ctx context.Context) (string, error) {
+	return b.primary().Enode(ctx)
+}
+
+// AddTrustedPeer assigns nodeID to the least loaded healthy backend, for its
+// weight.
+func (b *Balancer) AddTrustedPeer(ctx context.Context, nodeID string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.assigned[nodeID]; ok {
+		return nil
+	}
+	return b.assign(ctx, nodeID, nil)
+}
+
+// RemoveTrustedPeer removes nodeID from the backend it's assigned to.
+func (b *Balancer) RemoveTrustedPeer(ctx context.Context, nodeID string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	be, ok := b.assigned[nodeID]
+	if !ok {
+		return nil
+	}
+	delete(be.clients, nodeID)
+	delete(b.assigned, nodeID)
+	return be.node.RemoveTrustedPeer(ctx, nodeID)
+}
+
+// ConnectPeer connects the primary node to nodeURI.
+func (b *Balancer) ConnectPeer(ctx context.Context, nodeURI string) error {
+	return b.primary().ConnectPeer(ctx, nodeURI)
+}
+
+// DisconnectPeer disconnects nodeID from every healthy backend, since it
+// could have connected to any of them.
+func (b *Balancer) DisconnectPeer(ctx context.Context, nodeID string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var lastErr error
+	for _, be := range b.backends {
+		if be.err != nil {
+			continue
+		}
+		if err := be.node.DisconnectPeer(ctx, nodeID); err != nil {
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+// Peers returns the peers of all healthy backends.
+func (b *Balancer) Peers(ctx context.Context) ([]ethnode.PeerInfo, error) {
+	return b.peers(ctx, ethnode.EthNode.Peers)
+}
+
+// PeersLite returns the peers of all healthy backends, with only the ID and
+// Name fields set.
+func (b *Balancer) PeersLite(ctx context.Context) ([]ethnode.PeerInfo, error) {
+	return b.peers(ctx, ethnode.EthNode.PeersLite)
+}
+
+// PeersByKind returns the number of peers of each kind across all healthy
+// backends.
+func (b *Balancer) PeersByKind(ctx context.Context) (map[ethnode.NodeKind]int, error) {
+	peers, err := b.PeersLite(ctx)
+	if err != nil && !ethnode.IsPartialPeers(err) {
+		return nil, err
+	}
+	return ethnode.CountPeersByKind(peers), err
+}
+
+func (b *Balancer) peers(ctx context.Context, getPeers func(ethnode.EthNode, context.Context) ([]ethnode.PeerInfo, error)) ([]ethnode.PeerInfo, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var peers []ethnode.PeerInfo
+	var partial error
+	seen := map[string]struct{}{}
+	err := b.healthy(ctx, func(be *backend) error {
+		r, err := getPeers(be.node, ctx)
+		if ethnode.IsPartialPeers(err) {
+			// The backend is up, some of its peers are just missing.
+			partial = err
+		} else if err != nil {
+			return err
+		}
+		for _, peer := range r {
+			if _, ok := seen[peer.ID]; ok {
+				continue
+			}
+			seen[peer.ID] = struct{}{}
+			peers = append(peers, peer)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return peers, partial
+}
+
+// PeerSlots returns the sum of the peer slots of the healthy backends.
+func (b *Balancer) PeerSlots(ctx context.Context) (max, used, reserved int, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	err = b.healthy(ctx, func(be *backend) error {
+		m, u, r, err := be.node.PeerSlots(ctx)
+		if err != nil {
+			return err
+		}
+		max, used, reserved = max+m, used+u, reserved+r
+		return nil
+	})
+	return max, used, reserved, err
+}
+
+// BlockNumber returns the highest block number of the healthy backends.
+func (b *Balancer) BlockNumber(ctx context.Context) (uint64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var block uint64
+	err := b.healthy(ctx, func(be *backend) error {
+		n, err := be.node.BlockNumber(ctx)
+		if err != nil {
+			return err
+		}
+		if n > block {
+			block = n
+		}
+		return nil
+	})
+	return block, err
+}
+
+// ForkID returns the primary node's fork ID. Backends are expected to follow
+// the same chain.
+func (b *Balancer) ForkID(ctx context.Context) ([4]byte, uint64, error) {
+	return b.primary().ForkID(ctx)
+}
+
+// FeeHistory returns the primary node's fee history.
+func (b *Balancer) FeeHistory(ctx context.Context, blocks int, rewardPercentiles []float64) (*ethnode.FeeHistory, error) {
+	return b.primary().FeeHistory(ctx, blocks, rewardPercentiles)
+}
+
+// AvailableNamespaces returns the primary node's namespaces. Backends are
+// expected to be configured the same way.
+func (b *Balancer) AvailableNamespaces(ctx context.Context) (map[string]bool, error) {
+	return b.primary().AvailableNamespaces(ctx)
+}
+
+// NonceAt returns the nonce from the primary node.
+func (b *Balancer) NonceAt(ctx context.Context, address common.Address, block *big.Int) (uint64, error) {
+	return b.primary().NonceAt(ctx, address, block)
+}
+
+// SendRawTransaction sends the transaction through the primary node.
+func (b *Balancer) SendRawTransaction(ctx context.Context, signedTx []byte) (common.Hash, error) {
+	return b.primary().SendRawTransaction(ctx, signedTx)
+}
+
+// DataDir returns the primary node's data directory.
+func (b *Balancer) DataDir(ctx context.Context) (string, error) {
+	return b.primary().DataDir(ctx)
+}
+
+// GenesisHash returns the primary node's genesis hash. Backends are expected
+// to be on the same chain.
+func (b *Balancer) GenesisHash(ctx context.Context) (common.Hash, error) {
+	return b.primary().GenesisHash(ctx)
+}
+
+// IsMining returns whether the primary node is mining.
+func (b *Balancer) IsMining(ctx context.Context) (bool, error) {
+	return b.primary().IsMining(ctx)
+}
+
+// IsHealing returns whether the primary node is healing its state.
+func (b *Balancer) IsHealing(ctx context.Context) (bool, error) {
+	return b.primary().IsHealing(ctx)
+}
+
+// SyncProgress returns the sync progress of the primary node.
+func (b *Balancer) SyncProgress(ctx context.Context) (*ethnode.SyncProgress, error) {
+	return b.primary().SyncProgress(ctx)
+}
+
+// ChainConfig returns the chain config of the primary node.
+func (b *Balancer) ChainConfig(ctx context.Context) (*params.ChainConfig, error) {
+	return b.primary().ChainConfig(ctx)
+}
+
+// BlockGasLimit returns the block gas limit of the primary node.
+func (b *Balancer) BlockGasLimit(ctx context.Context) (uint64, error) {
+	return b.primary().BlockGasLimit(ctx)
+}
+
+// ClientVersion returns the client version of the primary node.
+func (b *Balancer) ClientVersion(ctx context.Context) (string, error) {
+	return b.primary().ClientVersion(ctx)
+}
+
+// TxPoolStatus returns the transaction pool size of the primary node.
+func (b *Balancer) TxPoolStatus(ctx context.Context) (pending, queued uint64, err error) {
+	return b.primary().TxPoolStatus(ctx)
+}
+
+// NodeUptime returns the uptime of the primary node.
+func (b *Balancer) NodeUptime(ctx context.Context) (time.Duration, error) {
+	return b.primary().NodeUptime(ctx)
+}
+
+// ChainHead returns the chain head of the primary node.
+func (b *Balancer) ChainHead(ctx context.Context) (*ethnode.HeadInfo, error) {
+	return b.primary().ChainHead(ctx)
+}
+
+// Close closes each of the backend nodes, returning the first error.
+func (b *Balancer) Close() error {
+	b.mu.Lock()
+	backends := b.backends
+	b.mu.Unlock()
+	var r error
+	for _, backend := range backends {
+		if err := backend.node.Close(); err != nil && r == nil {
+			r = err
+		}
+	}
+	return r
+}
+
+// LatestBlock returns the latest block of the healthy backend that is
+// furthest ahead.
+func (b *Balancer) LatestBlock(ctx context.Context) (uint64, time.Time, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var block uint64
+	var timestamp time.Time
+	err := b.healthy(ctx, func(be *backend) error {
+		n, t, err := be.node.LatestBlock(ctx)
+		if err != nil {
+			return err
+		}
+		if n > block || timestamp.IsZero() {
+			block, timestamp = n, t
+		}
+		return nil
+	})
+	return block, timestamp, err
+}
@@ -0,0 +1,207 @@
+package host
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/vipnode/vipnode/ethnode"
+	"github.com/vipnode/vipnode/internal/fakenode"
+)
+
+// flakyNode is a FakeNode that fails every call while err is set.
+type flakyNode struct {
+	*fakenode.FakeNode
+	err error
+}
+
+func (n *flakyNode) AddTrustedPeer(ctx context.Context, nodeID string) error {
+	if n.err != nil {
+		return n.err
+	}
+	return n.FakeNode.AddTrustedPeer(ctx, nodeID)
+}
+
+func (n *flakyNode) Peers(ctx context.Context) ([]ethnode.PeerInfo, error) {
+	if n.err != nil {
+		return nil, n.err
+	}
+	return n.FakeNode.Peers(ctx)
+}
+
+func (n *flakyNode) PeersLite(ctx context.Context) ([]ethnode.PeerInfo, error) {
+	if n.err != nil {
+		return nil, n.err
+	}
+	return n.FakeNode.PeersLite(ctx)
+}
+
+func (n *flakyNode) BlockNumber(ctx context.Context) (uint64, error) {
+	if n.err != nil {
+		return 0, n.err
+	}
+	return n.FakeNode.BlockNumber(ctx)
+}
+
+// trusted returns the nodes that are currently trusted on n.
+func trusted(n *fakenode.FakeNode) map[string]bool {
+	r := map[string]bool{}
+	for _, call := range n.Calls {
+		nodeID := call.Args[0].(string)
+		switch call.Method {
+		case "AddTrustedPeer":
+			r[nodeID] = true
+		case "RemoveTrustedPeer":
+			delete(r, nodeID)
+		}
+	}
+	return r
+}
+
+func TestBalancerSpread(t *testing.T) {
+	ctx := context.Background()
+	nodes := []*fakenode.FakeNode{fakenode.Node("a"), fakenode.Node("b"), fakenode.Node("c")}
+	b := NewBalancer(nodes[0], nodes[1], nodes[2])
+
+	for i := 0; i < 6; i++ {
+		if err := b.AddTrustedPeer(ctx, fmt.Sprintf("client%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, want := b.Backends(), []int{2, 2, 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("backends: got %v; want %v", got, want)
+	}
+
+	// Re-whitelisting is a no-op
+	if err := b.AddTrustedPeer(ctx, "client0"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.RemoveTrustedPeer(ctx, "client1"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := b.Backends(), []int{2, 1, 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("backends: got %v; want %v", got, want)
+	}
+	if trusted(nodes[1])["client1"] || trusted(nodes[2])["client1"] || trusted(nodes[0])["client1"] {
+		t.Errorf("client1 is still trusted")
+	}
+
+	// Peers and block numbers are aggregated
+	nodes[0].FakePeers = fakenode.FakePeers(2)
+	nodes[1].FakePeers = fakenode.FakePeers(3)
+	nodes[2].FakeBlockNumber = 42
+	peers, err := b.Peers(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(peers) != 3 {
+		t.Errorf("expected 3 unique peers, got %d", len(peers))
+	}
+	if block, err := b.BlockNumber(ctx); err != nil {
+		t.Fatal(err)
+	} else if block != 42 {
+		t.Errorf("wrong block number: %d", block)
+	}
+}
+
+func TestBalancerWeights(t *testing.T) {
+	ctx := context.Background()
+	nodes := []*fakenode.FakeNode{fakenode.Node("a"), fakenode.Node("b"), fakenode.Node("c")}
+	b := NewBalancer(nodes[0], nodes[1], nodes[2])
+	if err := b.SetWeights(3, 1); err == nil {
+		t.Error("expected an error for missing weights")
+	}
+	if err := b.SetWeights(3, 0, 2); err == nil {
+		t.Error("expected an error for a zero weight")
+	}
+	if err := b.SetWeights(3, 1, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 6; i++ {
+		if err := b.AddTrustedPeer(ctx, fmt.Sprintf("client%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, want := b.Backends(), []int{3, 1, 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("backends: got %v; want %v", got, want)
+	}
+
+	// Clients come and go at random, the distribution still converges to
+	// the weights.
+	rnd := rand.New(rand.NewSource(42))
+	connected := []string{"client0", "client1", "client2", "client3", "client4", "client5"}
+	for i := 6; i < 5000; i++ {
+		if len(connected) > 0 && rnd.Intn(3) == 0 {
+			j := rnd.Intn(len(connected))
+			if err := b.RemoveTrustedPeer(ctx, connected[j]); err != nil {
+				t.Fatal(err)
+			}
+			connected = append(connected[:j], connected[j+1:]...)
+			continue
+		}
+		nodeID := fmt.Sprintf("client%d", i)
+		if err := b.AddTrustedPeer(ctx, nodeID); err != nil {
+			t.Fatal(err)
+		}
+		connected = append(connected, nodeID)
+	}
+	weights := []float64{3, 1, 2}
+	for i, n := range b.Backends() {
+		share := float64(n) / float64(len(connected))
+		if want := weights[i] / 6; math.Abs(share-want) > 0.02 {
+			t.Errorf("backend %d: got %.3f of %d clients; want %.3f", i, share, len(connected), want)
+		}
+	}
+}
+
+func TestBalancerFailover(t *testing.T) {
+	ctx := context.Background()
+	nodes := []*flakyNode{{FakeNode: fakenode.Node("a")}, {FakeNode: fakenode.Node("b")}}
+	b := NewBalancer(nodes[0], nodes[1])
+
+	for i := 0; i < 4; i++ {
+		if err := b.AddTrustedPeer(ctx, fmt.Sprintf("client%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	nodes[1].err = errors.New("connection refused")
+	if _, err := b.Peers(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := b.Backends(), []int{4, -1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("backends: got %v; want %v", got, want)
+	}
+	if got := trusted(nodes[0].FakeNode); len(got) != 4 {
+		t.Errorf("expected all clients to be reassigned, got: %v", got)
+	}
+
+	// New clients avoid the failed node; a failed whitelist also fails over.
+	if err := b.AddTrustedPeer(ctx, "client4"); err != nil {
+		t.Fatal(err)
+	}
+	nodes[0].err = errors.New("connection refused")
+	if _, err := b.BlockNumber(ctx); err != ErrNoBackends {
+		t.Errorf("expected ErrNoBackends, got: %v", err)
+	}
+	if err := b.AddTrustedPeer(ctx, "client5"); err != ErrNoBackends {
+		t.Errorf("expected ErrNoBackends, got: %v", err)
+	}
+
+	// Recovered nodes receive new clients again
+	nodes[1].err = nil
+	if _, err := b.Peers(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.AddTrustedPeer(ctx, "client5"); err != nil {
+		t.Fatal(err)
+	}
+	if !trusted(nodes[1].FakeNode)["client5"] {
+		t.Errorf("expected client5 on the recovered node")
+	}
+}
@@ -0,0 +1,189 @@
+package host
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/p2p/discv5"
+	"github.com/vipnode/vipnode/internal/fakenode"
+	"github.com/vipnode/vipnode/internal/keygen"
+	"github.com/vipnode/vipnode/jsonrpc2"
+	"github.com/vipnode/vipnode/pool"
+	"github.com/vipnode/vipnode/pool/store/memory"
+)
+
+// capacityPool is a real pool with a single host registered to it, to check
+// which capacity the host reports leads to clients being assigned to it.
+type capacityPool struct {
+	t      *testing.T
+	host   *Host
+	remote pool.Pool
+	client pool.Pool
+}
+
+// startCapacityPool registers the host of node with a new pool, configured
+// by setup, and sends its first update.
+func startCapacityPool(t *testing.T, node *fakenode.FakeNode, setup func(h *Host)) *capacityPool {
+	t.Helper()
+	p := pool.New(memory.New(), nil)
+	hostKey := keygen.HardcodedKeyIdx(t, 0)
+	hostID := discv5.PubkeyID(&hostKey.PublicKey).String()
+	node.NodeID = hostID
+	h := New(node, "")
+	h.NodeURI = fmt.Sprintf("enode://%s@127.0.0.1:30303", hostID)
+	setup(h)
+
+	pool2Host, host2Pool := jsonrpc2.ServePipe()
+	t.Cleanup(func() {
+		pool2Host.Close()
+		host2Pool.Close()
+	})
+	if err := pool2Host.Server.Register("vipnode_", p); err != nil {
+		t.Fatal(err)
+	}
+	if err := host2Pool.Server.RegisterMethod("vipnode_whitelist", h, "Whitelist"); err != nil {
+		t.Fatal(err)
+	}
+	remote := pool.Remote(host2Pool, hostKey)
+	if err := h.Start(remote); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(h.Stop)
+
+	pool2Client, client2Pool := jsonrpc2.ServePipe()
+	t.Cleanup(func() {
+		pool2Client.Close()
+		client2Pool.Close()
+	})
+	if err := pool2Client.Server.Register("vipnode_", p); err != nil {
+		t.Fatal(err)
+	}
+	return &capacityPool{
+		t:      t,
+		host:   h,
+		remote: remote,
+		client: pool.Remote(client2Pool, keygen.HardcodedKeyIdx(t, 1)),
+	}
+}
+
+// update sends another update from the host.
+func (p *capacityPool) update() {
+	p.t.Helper()
+	if err := p.host.updatePeers(context.Background(), p.remote); err != nil {
+		p.t.Fatal(err)
+	}
+}
+
+// matched returns whether the pool assigns the host to a client.
+func (p *capacityPool) matched() bool {
+	p.t.Helper()
+	resp, err := p.client.Client(context.Background(), pool.ClientRequest{Kind: "geth"})
+	if err != nil && err.Error() == (pool.NoHostNodesError{}).Error() {
+		return false
+	} else if err != nil {
+		p.t.Fatal(err)
+	}
+	return len(resp.Hosts) > 0
+}
+
+func TestReserveMarginFullHost(t *testing.T) {
+	node := fakenode.Node("")
+	node.FakePeers = fakenode.FakePeers(8)
+	// 10 slots with 8 used leaves none after the margin.
+	p := startCapacityPool(t, node, func(h *Host) {
+		h.MaxPeers = 10
+		h.ReserveMargin = 2
+	})
+	if p.matched() {
+		t.Error("expected the pool not to assign a host with its free slots reserved")
+	}
+
+	node.FakePeers = fakenode.FakePeers(7)
+	p.update()
+	if !p.matched() {
+		t.Error("expected the pool to assign a host with a slot beyond its margin")
+	}
+}
+
+func TestMiningMarginFullHost(t *testing.T) {
+	node := fakenode.Node("")
+	node.FakePeers = fakenode.FakePeers(6)
+	node.FakeMining = true
+	// 10 slots with 6 used leaves none after the margin while mining.
+	p := startCapacityPool(t, node, func(h *Host) {
+		h.MaxPeers = 10
+		h.ReserveMargin = 1
+		h.MiningMargin = 3
+	})
+	if p.matched() {
+		t.Error("expected the pool not to assign a mining host within its mining margin")
+	}
+
+	node.FakeMining = false
+	p.update()
+	if !p.matched() {
+		t.Error("expected the pool to assign the host once it stopped mining")
+	}
+}
+
+func TestHysteresisFullHost(t *testing.T) {
+	node := fakenode.Node("")
+	node.FakePeers = fakenode.FakePeers(9)
+	p := startCapacityPool(t, node, func(h *Host) {
+		h.MaxPeers = 10
+		h.FullThreshold = 1
+		h.AvailableThreshold = 4
+	})
+	if p.matched() {
+		t.Error("expected the pool not to assign a host at its full threshold")
+	}
+
+	// Still full until it's back at the available threshold.
+	node.FakePeers = fakenode.FakePeers(8)
+	p.update()
+	if p.matched() {
+		t.Error("expected the pool not to assign a host below its available threshold")
+	}
+
+	node.FakePeers = fakenode.FakePeers(6)
+	p.update()
+	if !p.matched() {
+		t.Error("expected the pool to assign the host at its available threshold")
+	}
+}
+
+func TestTxPoolOverloadFullHost(t *testing.T) {
+	node := fakenode.Node("")
+	node.FakeTxPending = 5000
+	// Overloaded hosts are full even without a known peer limit.
+	p := startCapacityPool(t, node, func(h *Host) {
+		h.TxPoolThreshold = 1000
+	})
+	if p.matched() {
+		t.Error("expected the pool not to assign a host with an overloaded transaction pool")
+	}
+
+	node.FakeTxPending = 10
+	p.update()
+	if !p.matched() {
+		t.Error("expected the pool to assign the host once the load subsided")
+	}
+}
+
+func TestHealingFullHost(t *testing.T) {
+	node := fakenode.Node("")
+	node.FakeHealing = true
+	p := startCapacityPool(t, node, func(h *Host) {
+		h.MaxPeers = 10
+	})
+	if p.matched() {
+		t.Error("expected the pool not to assign a host which is healing its state")
+	}
+
+	node.FakeHealing = false
+	p.update()
+	if !p.matched() {
+		t.Error("expected the pool to assign the host once it's done healing")
+	}
+}
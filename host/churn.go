@@ -0,0 +1,111 @@
+package host
+
+import (
+	"sync"
+	"time"
+
+	"github.com/vipnode/vipnode/ethnode"
+)
+
+// DefaultChurnWindow is how far back a ChurnMeter counts peer events, unless
+// its Window is set.
+const DefaultChurnWindow = 10 * time.Minute
+
+// PeerEventType is whether a peer connected or disconnected.
+type PeerEventType int
+
+const (
+	PeerAdded PeerEventType = iota
+	PeerDropped
+)
+
+func (t PeerEventType) String() string {
+	if t == PeerAdded {
+		return "add"
+	}
+	return "drop"
+}
+
+// PeerEvent is a peer connecting to or disconnecting from the node.
+type PeerEvent struct {
+	Type   PeerEventType
+	PeerID string
+	Time   time.Time
+}
+
+// PeerEvents returns the events that turned the before peers into the after
+// peers, timestamped with now.
+func PeerEvents(before, after []ethnode.PeerInfo, now time.Time) []PeerEvent {
+	was := make(map[string]struct{}, len(before))
+	for _, peer := range before {
+		was[peer.ID] = struct{}{}
+	}
+	is := make(map[string]struct{}, len(after))
+	var events []PeerEvent
+	for _, peer := range after {
+		is[peer.ID] = struct{}{}
+		if _, ok := was[peer.ID]; !ok {
+			events = append(events, PeerEvent{PeerAdded, peer.ID, now})
+		}
+	}
+	for _, peer := range before {
+		if _, ok := is[peer.ID]; !ok {
+			events = append(events, PeerEvent{PeerDropped, peer.ID, now})
+		}
+	}
+	return events
+}
+
+// ChurnMeter computes a rolling rate of peer connects and disconnects. A
+// high churn rate points to flaky connectivity or a misconfigured node.
+type ChurnMeter struct {
+	// Window is how far back events are counted. Defaults to
+	// DefaultChurnWindow.
+	Window time.Duration
+	// Threshold is the rate, in events per minute, above which the meter is
+	// degraded. (Disabled if 0)
+	Threshold float64
+
+	mu     sync.Mutex
+	events []time.Time
+}
+
+func (m *ChurnMeter) window() time.Duration {
+	if m.Window > 0 {
+		return m.Window
+	}
+	return DefaultChurnWindow
+}
+
+// expire drops events outside of the window, must hold the m.mu lock.
+func (m *ChurnMeter) expire(now time.Time) {
+	cutoff := now.Add(-m.window())
+	i := 0
+	for i < len(m.events) && !m.events[i].After(cutoff) {
+		i++
+	}
+	m.events = m.events[i:]
+}
+
+// Add records events, which are expected in chronological order.
+func (m *ChurnMeter) Add(events ...PeerEvent) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, event := range events {
+		m.events = append(m.events, event.Time)
+	}
+}
+
+// Rate returns the number of events per minute within the window ending at
+// now.
+func (m *ChurnMeter) Rate(now time.Time) float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.expire(now)
+	return float64(len(m.events)) / m.window().Minutes()
+}
+
+// Degraded returns whether the rate at now exceeds the Threshold.
+func (m *ChurnMeter) Degraded(now time.Time) bool {
+	return m.Threshold > 0 && m.Rate(now) > m.Threshold
+}
@@ -0,0 +1,87 @@
+package host
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/vipnode/vipnode/ethnode"
+	"github.com/vipnode/vipnode/internal/fakenode"
+)
+
+func TestPeerEvents(t *testing.T) {
+	now := time.Now()
+	before := []ethnode.PeerInfo{{ID: "a"}, {ID: "b"}, {ID: "c"}}
+	after := []ethnode.PeerInfo{{ID: "b"}, {ID: "d"}}
+	want := []PeerEvent{
+		{PeerAdded, "d", now},
+		{PeerDropped, "a", now},
+		{PeerDropped, "c", now},
+	}
+	if got := PeerEvents(before, after, now); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v; want %v", got, want)
+	}
+}
+
+func TestChurnMeter(t *testing.T) {
+	start := time.Now()
+	m := &ChurnMeter{Window: 10 * time.Minute, Threshold: 2}
+
+	if rate := m.Rate(start); rate != 0 {
+		t.Errorf("expected no churn without events, got %f", rate)
+	}
+	// 30 events in the first 5 minutes: 3 per minute over the window.
+	for i := 0; i < 15; i++ {
+		at := start.Add(time.Duration(i) * 20 * time.Second)
+		m.Add(PeerEvent{PeerAdded, "a", at}, PeerEvent{PeerDropped, "a", at})
+	}
+	now := start.Add(5 * time.Minute)
+	if rate := m.Rate(now); rate != 3 {
+		t.Errorf("rate after 30 events: got %f; want 3", rate)
+	}
+	if !m.Degraded(now) {
+		t.Error("expected degraded above the threshold")
+	}
+
+	// Events age out of the window, leaving the 16 from after 2 minutes.
+	later := start.Add(12 * time.Minute)
+	if rate := m.Rate(later); rate != 1.6 {
+		t.Errorf("rate once older events expired: got %f; want 1.6", rate)
+	}
+	if m.Degraded(later) {
+		t.Error("expected recovery below the threshold")
+	}
+
+	// No threshold, never degraded.
+	m.Threshold = 0
+	m.Add(PeerEvent{PeerAdded, "b", later})
+	if m.Degraded(later) {
+		t.Error("expected no degraded flag without a threshold")
+	}
+}
+
+func TestUpdatePeersChurn(t *testing.T) {
+	node := fakenode.Node("host")
+	h := New(node, "")
+	h.Churn.Threshold = 0.5
+	p := &updatePool{}
+
+	// The first update is the baseline, then every update swaps 4 peers.
+	for i := 0; i < 3; i++ {
+		node.FakePeers = fakenode.FakePeers(2)
+		if i%2 == 1 {
+			node.FakePeers = []ethnode.PeerInfo{{ID: "x"}, {ID: "y"}}
+		}
+		if err := h.updatePeers(context.Background(), p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	status := h.Status()
+	if status.ChurnRate != 0.8 {
+		t.Errorf("expected 8 events over 10 minutes, got rate %f", status.ChurnRate)
+	}
+	if !status.Degraded {
+		t.Error("expected degraded status")
+	}
+}
@@ -0,0 +1,177 @@
+package host
+
+import (
+	"context"
+	"errors"
+	"sort"
+
+	"github.com/vipnode/vipnode/ethnode"
+	"github.com/vipnode/vipnode/pool"
+)
+
+// ErrNotStarted is returned by ReduceCapacity before the host is registered
+// with a pool.
+var ErrNotStarted = errors.New("host is not started")
+
+// ErrUnknownPeerLimit is returned by ReduceCapacity if the node doesn't
+// report its peer limit and Host.MaxPeers is not set.
+var ErrUnknownPeerLimit = errors.New("peer limit of the node is unknown")
+
+// reducedLimit returns maxPeers less the slots taken off by ReduceCapacity,
+// clamped at zero.
+func (h *Host) reducedLimit(maxPeers int) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if maxPeers < h.reduced {
+		return 0
+	}
+	return maxPeers - h.reduced
+}
+
+// ReduceCapacity shrinks the peer limit used for reporting capacity to the
+// pool by n, without restarting the host. If the node has more peers than
+// the new limit, the least recently active clients are drained: the ones
+// whose pool whitelisted them longest ago go first, and the node's organic
+// peers are left alone. The pool is sent an update before the drained
+// clients are disconnected, so that they're billed up to that point, and
+// another after, so that it stops tracking them. It returns the node IDs of
+// the drained clients.
+func (h *Host) ReduceCapacity(ctx context.Context, n int) ([]string, error) {
+	h.updateMu.Lock()
+	defer h.updateMu.Unlock()
+	if h.pool == nil {
+		return nil, ErrNotStarted
+	}
+
+	maxPeers, _, _, err := h.node.PeerSlots(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if h.MaxPeers > 0 {
+		maxPeers = h.MaxPeers
+	}
+	if maxPeers <= 0 {
+		return nil, ErrUnknownPeerLimit
+	}
+	h.mu.Lock()
+	h.reduced += n
+	h.mu.Unlock()
+	limit := h.reducedLimit(maxPeers)
+
+	// Caps are only needed to filter by protocol.
+	getPeers := h.node.PeersLite
+	if h.Protocol != "" {
+		getPeers = h.node.Peers
+	}
+	peers, err := getPeers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	connected := len(peers)
+	h.mu.Lock()
+	for _, peer := range peers {
+		if _, ok := h.drained[peer.ID]; ok {
+			connected--
+		}
+	}
+	h.mu.Unlock()
+	drain := h.drainOrder(peers)
+	if excess := connected - limit; excess < len(drain) {
+		if excess < 0 {
+			excess = 0
+		}
+		drain = drain[:excess]
+	}
+	logger.Printf("Reduced capacity by %d to %d peers, draining %d clients", n, limit, len(drain))
+
+	if len(drain) > 0 {
+		// Settle with the pool while the drained clients are still connected.
+		if err := h.updatePeers(ctx, h.pool); err != nil {
+			return nil, err
+		}
+	}
+	drained, err := h.drainClients(ctx, drain)
+	if err != nil {
+		return drained, err
+	}
+	// Report the drained clients as gone, along with the reduced capacity.
+	if err := h.updatePeers(ctx, h.pool); err != nil {
+		return drained, err
+	}
+	return drained, nil
+}
+
+// drainClients disconnects clients which are already settled with the pool,
+// excluding them from updates until the node stops listing them. It returns
+// the clients that were drained.
+func (h *Host) drainClients(ctx context.Context, nodeIDs []string) ([]string, error) {
+	drained := make([]string, 0, len(nodeIDs))
+	for _, nodeID := range nodeIDs {
+		if err := h.node.RemoveTrustedPeer(ctx, nodeID); err != nil {
+			return drained, err
+		}
+		h.forget(nodeID)
+		if err := h.node.DisconnectPeer(ctx, nodeID); err != nil {
+			return drained, err
+		}
+		h.mu.Lock()
+		h.drained[nodeID] = struct{}{}
+		h.mu.Unlock()
+		drained = append(drained, nodeID)
+	}
+	return drained, nil
+}
+
+// lowTierClients returns up to n clients to drain to make room for higher
+// tiers, in drain order. Clients of the top tier are never included.
+func (h *Host) lowTierClients(peers []ethnode.PeerInfo, n int) []string {
+	clients := h.drainOrder(peers)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	r := make([]string, 0, n)
+	for _, nodeID := range clients {
+		if len(r) >= n {
+			break
+		}
+		if h.tiers[nodeID].Rank() < pool.TierPaying.Rank() {
+			r = append(r, nodeID)
+		}
+	}
+	if len(r) > 0 {
+		logger.Printf("Over capacity by %d peers, draining %d lower tier clients", n, len(r))
+	}
+	return r
+}
+
+// drainOrder returns the node IDs of the connected clients of this host in
+// the order that they should be drained: lower tiers first, then least
+// recently active first. Managed peers that weren't whitelisted since the
+// host started, such as ones restored from a trusted-nodes.json, count as
+// the least active.
+func (h *Host) drainOrder(peers []ethnode.PeerInfo) []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var clients []string
+	for _, peer := range peers {
+		if h.Protocol != "" && !peer.HasProtocol(h.Protocol) {
+			continue
+		}
+		if h.partition != nil {
+			if owner := h.partition.Owner(peer.ID); owner != nil && owner != h {
+				continue
+			}
+		}
+		if _, ok := h.active[peer.ID]; !ok && !peer.Managed {
+			continue
+		}
+		clients = append(clients, peer.ID)
+	}
+	sort.SliceStable(clients, func(i, j int) bool {
+		ri, rj := h.tiers[clients[i]].Rank(), h.tiers[clients[j]].Rank()
+		if ri != rj {
+			return ri < rj
+		}
+		return h.active[clients[i]].Before(h.active[clients[j]])
+	})
+	return clients
+}
@@ -0,0 +1,192 @@
+package host
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/vipnode/vipnode/ethnode"
+	"github.com/vipnode/vipnode/internal/fakenode"
+	"github.com/vipnode/vipnode/pool"
+	"github.com/vipnode/vipnode/pool/store"
+)
+
+func TestReduceCapacity(t *testing.T) {
+	ctx := context.Background()
+	node := fakenode.Node("host")
+	node.FakePeers = []ethnode.PeerInfo{
+		{ID: "newest"}, {ID: "organic1"}, {ID: "oldest"}, {ID: "middle"}, {ID: "organic2"}, {ID: "older"},
+	}
+	h := New(node, "")
+	h.MaxPeers = 10
+
+	if _, err := h.ReduceCapacity(ctx, 1); err != ErrNotStarted {
+		t.Errorf("expected ErrNotStarted, got: %v", err)
+	}
+
+	p := &updatePool{}
+	if err := h.Start(p); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		h.Stop()
+		h.Wait()
+	}()
+
+	base := time.Now()
+	for i, nodeID := range []string{"oldest", "older", "middle", "newest"} {
+		if err := h.Whitelist(ctx, nodeID); err != nil {
+			t.Fatal(err)
+		}
+		h.active[nodeID] = base.Add(time.Duration(i) * time.Minute)
+	}
+
+	// 6 peers within a limit of 5: drain the least recently active client.
+	drained, err := h.ReduceCapacity(ctx, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"oldest"}; !reflect.DeepEqual(drained, want) {
+		t.Errorf("drained: got %v; want %v", drained, want)
+	}
+	if len(p.updates) != 3 {
+		t.Fatalf("expected start update, then updates before and after draining; got %d", len(p.updates))
+	}
+	// Billed up to the disconnect, then no longer reported.
+	if got, want := p.updates[1].Peers, []string{"newest", "organic1", "oldest", "middle", "organic2", "older"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("peers before draining: got %v; want %v", got, want)
+	}
+	if got, want := p.updates[2].Peers, []string{"newest", "organic1", "middle", "organic2", "older"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("peers after draining: got %v; want %v", got, want)
+	}
+	if slots := p.updates[2].AvailableSlots; slots == nil || *slots != 0 {
+		t.Errorf("expected no slots after reducing capacity, got %v", slots)
+	}
+
+	// The drained client lingers in the node's peers, but isn't counted: 5
+	// peers within a limit of 3.
+	drained, err = h.ReduceCapacity(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"older", "middle"}; !reflect.DeepEqual(drained, want) {
+		t.Errorf("drained: got %v; want %v", drained, want)
+	}
+
+	// Already within the limit, nothing to drain.
+	drained, err = h.ReduceCapacity(ctx, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(drained) != 0 {
+		t.Errorf("expected nothing drained, got %v", drained)
+	}
+
+	var disconnected []string
+	for _, call := range node.Calls {
+		if call.Method == "DisconnectPeer" {
+			disconnected = append(disconnected, call.Args[0].(string))
+		}
+	}
+	if want := []string{"oldest", "older", "middle"}; !reflect.DeepEqual(disconnected, want) {
+		t.Errorf("disconnected: got %v; want %v", disconnected, want)
+	}
+}
+
+func TestReduceCapacityUnknownLimit(t *testing.T) {
+	h := New(fakenode.Node("host"), "")
+	if err := h.Start(&updatePool{}); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		h.Stop()
+		h.Wait()
+	}()
+	if _, err := h.ReduceCapacity(context.Background(), 1); err != ErrUnknownPeerLimit {
+		t.Errorf("expected ErrUnknownPeerLimit, got: %v", err)
+	}
+}
+
+// tierPool is an updatePool which reports client tiers.
+type tierPool struct {
+	updatePool
+	tiers map[string]pool.Tier
+}
+
+func (p *tierPool) Update(ctx context.Context, req pool.UpdateRequest) (*pool.UpdateResponse, error) {
+	p.updates = append(p.updates, req)
+	return &pool.UpdateResponse{Balance: &store.Balance{}, ClientTiers: p.tiers}, nil
+}
+
+func TestDrainTrials(t *testing.T) {
+	ctx := context.Background()
+	node := fakenode.Node("host")
+	node.FakePeers = []ethnode.PeerInfo{
+		{ID: "paying1"}, {ID: "trial1"}, {ID: "organic"}, {ID: "trial2"}, {ID: "paying2"}, {ID: "trial3"},
+	}
+	h := New(node, "")
+	h.MaxPeers = 6
+	h.DrainTrials = true
+	p := &tierPool{tiers: map[string]pool.Tier{
+		"paying1": pool.TierPaying,
+		"paying2": pool.TierPaying,
+		"trial1":  pool.TierTrial,
+		"trial2":  pool.TierTrial,
+		"trial3":  pool.TierTrial,
+	}}
+
+	// The paying clients are the least recently active, but still outrank
+	// the trial clients.
+	base := time.Now()
+	for i, nodeID := range []string{"paying1", "paying2", "trial2", "trial1", "trial3"} {
+		if err := h.Whitelist(ctx, nodeID); err != nil {
+			t.Fatal(err)
+		}
+		h.active[nodeID] = base.Add(time.Duration(i) * time.Minute)
+	}
+	disconnected := func() []string {
+		var r []string
+		for _, call := range node.Calls {
+			if call.Method == "DisconnectPeer" {
+				r = append(r, call.Args[0].(string))
+			}
+		}
+		return r
+	}
+
+	// Within capacity
+	if err := h.updatePeers(ctx, p); err != nil {
+		t.Fatal(err)
+	}
+	if got := disconnected(); len(got) != 0 {
+		t.Errorf("expected no clients drained within capacity, got %v", got)
+	}
+
+	// Over capacity by 1
+	h.MaxPeers = 5
+	if err := h.updatePeers(ctx, p); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := disconnected(), []string{"trial2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("over by 1: got %v drained; want %v", got, want)
+	}
+
+	// Over capacity by 4 with only 2 trial clients left: the paying clients
+	// stay.
+	h.MaxPeers = 1
+	if err := h.updatePeers(ctx, p); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := disconnected(), []string{"trial2", "trial1", "trial3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("over by 4: got %v drained; want %v", got, want)
+	}
+	// The drained clients were billed up to their disconnect, and no longer
+	// reported after.
+	if got, want := p.updates[1].Peers, []string{"paying1", "trial1", "organic", "trial2", "paying2", "trial3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("peers before draining: got %v; want %v", got, want)
+	}
+	if got, want := p.updates[2].Peers, []string{"paying1", "trial1", "organic", "paying2", "trial3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("peers after draining: got %v; want %v", got, want)
+	}
+}
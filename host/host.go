@@ -2,8 +2,10 @@ package host
 
 import (
 	"context"
+	"sync"
 	"time"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/vipnode/vipnode/ethnode"
 	"github.com/vipnode/vipnode/pool"
 	"github.com/vipnode/vipnode/pool/store"
@@ -12,6 +14,10 @@ import (
 var startTimeout = 10 * time.Second
 var updateTimeout = 10 * time.Second
 
+// processStart is when the agent's process started, or close enough to it,
+// for its uptime in Status.
+var processStart = time.Now()
+
 type nodeID string
 
 type client struct {
@@ -25,6 +31,11 @@ func New(node ethnode.EthNode, payout string) *Host {
 		payout: payout,
 		stopCh: make(chan struct{}),
 		waitCh: make(chan error, 1),
+
+		active:  map[string]time.Time{},
+		drained: map[string]struct{}{},
+
+		Churn: &ChurnMeter{},
 	}
 }
 
@@ -41,68 +52,478 @@ type Host struct {
 	// node runs on a different IP from the vipnode agent.
 	NodeURI string
 
-	node   ethnode.EthNode
-	payout string
-	stopCh chan struct{}
-	waitCh chan error
+	// InternalNodeURI is the enode:// connection string for clients on the
+	// host's private network, if it serves clients there too. The pool hands
+	// it out instead of NodeURI to clients on the same network. (Optional)
+	InternalNodeURI string
+
+	// ReportBlockTime includes the latest block's timestamp in updates, so
+	// that the pool can tell if the host is stale.
+	ReportBlockTime bool
+
+	// Protocol is the capability that peers need to have to be counted as
+	// clients, such as "les" for light clients. Other peers, like incidental
+	// full node connections, are not reported to the pool. All peers are
+	// counted if empty.
+	Protocol string
+
+	// Version is the vipnode agent version reported to the pool when
+	// registering. (Optional)
+	Version string
+
+	// Capabilities are advertised to the pool along with the ones detected
+	// from the node, such as "archive" or "trace", so that clients can
+	// filter on them. They override detected values. (Optional)
+	Capabilities map[string]string
+
+	// MaxPeers overrides the node's peer limit when estimating how many
+	// pool clients the host has room for. Geth doesn't expose its limit over
+	// RPC, so the capacity is only reported if this is set or the node
+	// provides it.
+	MaxPeers int
+
+	// ReserveMargin is the number of peer slots to keep free for the node's
+	// own peers, on top of the ones already connected.
+	ReserveMargin int
+
+	// MiningMargin is the number of additional peer slots to keep free while
+	// the node is mining or validating, so that serving clients doesn't get
+	// in the way of producing blocks. (Optional)
+	MiningMargin int
+
+	// DrainTrials disconnects trial clients when the node has more peers than
+	// its limit and ReserveMargin allow, to make room for paying clients. The
+	// tiers of clients come from the pool's updates.
+	DrainTrials bool
+
+	// FullThreshold and AvailableThreshold add hysteresis to the capacity
+	// reported to the pool, so that a host hovering near its peer limit
+	// doesn't flap between available and full. The host is reported as full
+	// once its available slots drop to FullThreshold or below, and as
+	// available again only once they reach AvailableThreshold. There is no
+	// hysteresis unless AvailableThreshold is above FullThreshold.
+	FullThreshold      int
+	AvailableThreshold int
+
+	// TxPoolThreshold sheds load when the node's transaction pool has more
+	// pending transactions than this, as reported by txpool_status. The host
+	// is reported as full while it's overloaded, and as available again once
+	// the pool is back at or below the threshold and the available slots
+	// reach AvailableThreshold. Disabled if 0. (Optional)
+	TxPoolThreshold int
+
+	// ClockSkewCallback is called after registering if the local clock is
+	// more than pool.MaxClockSkew off from the pool's, which gets signed
+	// requests rejected. It should be displayed as a warning. (Optional)
+	ClockSkewCallback func(skew time.Duration)
+
+	// Churn measures how often peers connect and disconnect, from the
+	// changes between updates. Set its Threshold to flag the host as
+	// degraded when churn is high.
+	Churn *ChurnMeter
+
+	// ErrorReporter sends the node's errors that it recorded to the pool
+	// after updates, if the host opted into error reports. (Optional)
+	ErrorReporter *pool.ErrorReporter
+
+	// RPCProxy serves read-only RPC calls to the node for the host's
+	// clients, relayed by the pool. (Optional)
+	RPCProxy *RPCProxy
+
+	node     ethnode.EthNode
+	payout   string
+	stopCh   chan struct{}
+	stopOnce sync.Once
+	waitCh   chan error
+
+	// full is whether the host was last reported as full.
+	full bool
+
+	// lastPeers is the node's peers as of the previous update, or nil before
+	// the first one.
+	lastPeers []ethnode.PeerInfo
+	// degraded is whether the churn was last above the threshold.
+	degraded bool
+	// healing is whether the node was last healing its state, guarded by mu.
+	healing bool
+	// overloaded is whether the node's transaction pool was last above
+	// TxPoolThreshold, guarded by mu.
+	overloaded bool
+
+	// partition is set when the node is shared with members of other pools.
+	partition *Partition
+
+	// pool is set once the host is started.
+	pool pool.Pool
+	// updateMu serializes updates to the pool.
+	updateMu sync.Mutex
+
+	mu sync.Mutex
+	// reduced is how many slots ReduceCapacity took off the peer limit.
+	reduced int
+	// active is when each client was last whitelisted.
+	active map[string]time.Time
+	// tiers is the tier of each client as of the pool's last update.
+	tiers map[string]pool.Tier
+	// drained are clients disconnected by ReduceCapacity which the node may
+	// still list as peers for a moment.
+	drained map[string]struct{}
 }
 
 // Whitelist a client for this host.
 func (h *Host) Whitelist(ctx context.Context, nodeID string) error {
 	logger.Printf("Received whitelist request: %s", nodeID)
-	return h.node.AddTrustedPeer(ctx, nodeID)
+	if h.partition != nil {
+		if err := h.partition.claim(nodeID, h); err != nil {
+			return err
+		}
+	}
+	if err := h.node.AddTrustedPeer(ctx, nodeID); err != nil {
+		if h.partition != nil {
+			h.partition.release(nodeID, h)
+		}
+		return err
+	}
+	h.mu.Lock()
+	h.active[nodeID] = time.Now()
+	delete(h.drained, nodeID)
+	h.mu.Unlock()
+	return nil
 }
 
 // Disconnect a client from this host and remove from whitelist.
 func (h *Host) Disconnect(ctx context.Context, nodeID string) error {
 	logger.Printf("Received disconnect request: %s", nodeID)
+	if h.partition != nil {
+		if owner := h.partition.Owner(nodeID); owner != nil && owner != h {
+			return ErrClaimedClient
+		}
+	}
 	if err := h.node.RemoveTrustedPeer(ctx, nodeID); err != nil {
 		return err
 	}
+	h.forget(nodeID)
 	return h.node.DisconnectPeer(ctx, nodeID)
 }
 
 func (h *Host) updatePeers(ctx context.Context, p pool.Pool) error {
-	block, err := h.node.BlockNumber(ctx)
-	if err != nil {
-		return err
+	var block uint64
+	var blockTime int64
+	if h.ReportBlockTime {
+		number, timestamp, err := h.node.LatestBlock(ctx)
+		if err != nil {
+			return err
+		}
+		block, blockTime = number, timestamp.Unix()
+	} else {
+		number, err := h.node.BlockNumber(ctx)
+		if err != nil {
+			return err
+		}
+		block = number
 	}
 
-	peers, err := h.node.Peers(ctx)
-	if err != nil {
+	// Caps are only needed to filter by protocol.
+	getPeers := h.node.PeersLite
+	if h.Protocol != "" {
+		getPeers = h.node.Peers
+	}
+	peers, err := getPeers(ctx)
+	if ethnode.IsPartialPeers(err) {
+		// Better to report the peers which parsed than to miss the update,
+		// but the skipped ones would count as churn.
+		logger.Printf("Updating pool with partial peers: %s", err)
+	} else if err != nil {
 		return err
+	} else {
+		h.trackChurn(peers, time.Now())
 	}
 	peerUpdate := make([]string, 0, len(peers))
+	numManaged := 0
+	// Drained clients can linger in the node's peers for a moment after
+	// they're disconnected, but they're already settled with the pool.
+	h.mu.Lock()
+	drained := h.drained
+	h.drained = map[string]struct{}{}
+	for _, peer := range peers {
+		if _, ok := drained[peer.ID]; ok {
+			h.drained[peer.ID] = struct{}{}
+		}
+	}
+	lingering := len(h.drained)
+	h.mu.Unlock()
 	for _, peer := range peers {
+		if _, ok := drained[peer.ID]; ok {
+			continue
+		}
+		if h.Protocol != "" && !peer.HasProtocol(h.Protocol) {
+			continue
+		}
+		if h.partition != nil {
+			// Clients of the other pools sharing the node are theirs to
+			// account for.
+			if owner := h.partition.Owner(peer.ID); owner != nil && owner != h {
+				continue
+			}
+		}
+		if peer.Managed {
+			numManaged++
+		}
 		peerUpdate = append(peerUpdate, peer.ID)
 	}
+	usedPeers := len(peers)
+	maxPeers := h.MaxPeers
+	if maxPeers == 0 && h.node.Kind() != ethnode.Geth {
+		// Geth doesn't expose its peer limit, so it's only asked of other
+		// nodes. Without it the slots are unknown, which shouldn't hold up
+		// the update and its balance.
+		if max, _, _, err := h.node.PeerSlots(ctx); err != nil {
+			logger.Printf("Failed to get the node's peer limit, reporting slots as unknown: %s", err)
+		} else {
+			maxPeers = max
+		}
+	}
+	var slots *int
+	var margin int
+	if maxPeers > 0 {
+		margin = h.reserveMargin(ctx)
+		n := availableSlots(h.reducedLimit(maxPeers), usedPeers, margin)
+		if h.partition != nil {
+			n = h.partition.share(h, n)
+		}
+		if h.checkTxPool(ctx) {
+			// Going through reportSlots keeps the host full until it
+			// has AvailableThreshold slots again after the load subsides.
+			n = 0
+		}
+		n = h.reportSlots(n)
+		slots = &n
+	} else if h.checkTxPool(ctx) {
+		n := 0
+		slots = &n
+	}
+	if h.checkHealing(ctx) {
+		// The node may serve stale state until it's done healing, so no new
+		// clients should be assigned.
+		n := 0
+		slots = &n
+	}
+
 	update, err := p.Update(ctx, pool.UpdateRequest{
-		Peers:       peerUpdate,
-		BlockNumber: block,
+		Peers:          peerUpdate,
+		BlockNumber:    block,
+		BlockTime:      blockTime,
+		AvailableSlots: slots,
 	})
 	if err != nil {
 		return err
 	}
+	if update.ClientTiers != nil {
+		h.mu.Lock()
+		h.tiers = update.ClientTiers
+		h.mu.Unlock()
+	}
 	if len(update.InvalidPeers) == 0 {
-		logger.Printf("Sent update: %d peers. Pool response: %s", len(peerUpdate), update.Balance.String())
-		return nil
+		logger.Printf("Sent update: %d peers (%d managed). Pool response: %s", len(peerUpdate), numManaged, update.Balance.String())
+	} else {
+		logger.Printf("Sent update: %d peers (%d managed). Pool response: Disconnect from %d invalid peers, %s", len(peerUpdate), numManaged, len(update.InvalidPeers), update.Balance.String())
 	}
-	logger.Printf("Sent update: %d peers. Pool response: Disconnect from %d invalid peers, %s", len(peerUpdate), len(update.InvalidPeers), update.Balance.String())
 	for _, peerID := range update.InvalidPeers {
 		// FIXME: Are there recoverable errors here?
 		if err := h.node.RemoveTrustedPeer(ctx, peerID); err != nil {
 			return err
 		}
+		h.forget(peerID)
 		if err := h.node.DisconnectPeer(ctx, peerID); err != nil {
 			return err
 		}
 	}
+
+	if h.DrainTrials && maxPeers > 0 {
+		// The update billed the clients up to now, so any drained
+		// trial clients are settled.
+		excess := usedPeers - len(update.InvalidPeers) - lingering + margin - h.reducedLimit(maxPeers)
+		if excess > 0 {
+			if _, err := h.drainClients(ctx, h.lowTierClients(peers, excess)); err != nil {
+				return err
+			}
+		}
+	}
 	return nil
 }
 
+// trackChurn feeds the changes since the previous peers into h.Churn, and
+// logs when the host becomes degraded or recovers.
+func (h *Host) trackChurn(peers []ethnode.PeerInfo, now time.Time) {
+	if h.Churn == nil {
+		return
+	}
+	if h.lastPeers != nil {
+		h.Churn.Add(PeerEvents(h.lastPeers, peers, now)...)
+	}
+	h.lastPeers = append([]ethnode.PeerInfo{}, peers...)
+
+	degraded := h.Churn.Degraded(now)
+	if degraded && !h.degraded {
+		logger.Printf("Degraded: peer churn of %.1f connects and disconnects per minute is above the threshold of %.1f", h.Churn.Rate(now), h.Churn.Threshold)
+	} else if !degraded && h.degraded {
+		logger.Printf("No longer degraded: peer churn is down to %.1f per minute", h.Churn.Rate(now))
+	}
+	h.degraded = degraded
+}
+
+// checkHealing returns whether the node is healing its state after a snap
+// sync, and logs when it starts or finishes.
+func (h *Host) checkHealing(ctx context.Context) bool {
+	healing, err := h.node.IsHealing(ctx)
+	if err != nil {
+		logger.Printf("Failed to check if the node is healing: %s", err)
+		return false
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if healing && !h.healing {
+		logger.Printf("Not ready: node is healing its state after a snap sync, reporting as full")
+	} else if !healing && h.healing {
+		logger.Printf("Ready: node finished healing its state")
+	}
+	h.healing = healing
+	return healing
+}
+
+// checkTxPool returns whether the node's transaction pool has more pending
+// transactions than TxPoolThreshold, and logs when the node becomes
+// overloaded or recovers. It's always false if TxPoolThreshold is unset or
+// the node doesn't expose its transaction pool.
+func (h *Host) checkTxPool(ctx context.Context) bool {
+	if h.TxPoolThreshold <= 0 {
+		return false
+	}
+	pending, _, err := h.node.TxPoolStatus(ctx)
+	if err != nil {
+		if err != ethnode.ErrNotSupported {
+			logger.Printf("Failed to check the node's transaction pool: %s", err)
+		}
+		return false
+	}
+	overloaded := pending > uint64(h.TxPoolThreshold)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if overloaded && !h.overloaded {
+		logger.Printf("Overloaded: %d pending transactions is above the threshold of %d, reporting as full", pending, h.TxPoolThreshold)
+	} else if !overloaded && h.overloaded {
+		logger.Printf("No longer overloaded: %d pending transactions", pending)
+	}
+	h.overloaded = overloaded
+	return overloaded
+}
+
+// Status is a snapshot of the host's health.
+type Status struct {
+	// ChurnRate is the number of peer connects and disconnects per minute.
+	ChurnRate float64 `json:"churn_rate"`
+	// Degraded is set when the ChurnRate is above the Churn threshold.
+	Degraded bool `json:"degraded"`
+	// Healing is set while the node heals its state after a snap sync,
+	// during which it's not ready for clients and is reported as full.
+	Healing bool `json:"healing"`
+	// Overloaded is set while the node's transaction pool is above the
+	// TxPoolThreshold, during which the host is reported as full.
+	Overloaded bool `json:"overloaded"`
+	// Uptime is how long the agent's process has been running.
+	Uptime time.Duration `json:"uptime"`
+	// NodeUptime is how long the node has been running, or 0 if it doesn't
+	// reveal when it started. It's only set by callers of NodeUptime, since
+	// it takes a call to the node.
+	NodeUptime time.Duration `json:"node_uptime,omitempty"`
+}
+
+// Status returns the current health of the host.
+func (h *Host) Status() Status {
+	h.mu.Lock()
+	status := Status{Healing: h.healing, Overloaded: h.overloaded}
+	h.mu.Unlock()
+	status.Uptime = time.Since(processStart)
+	if h.Churn == nil {
+		return status
+	}
+	now := time.Now()
+	status.ChurnRate = h.Churn.Rate(now)
+	status.Degraded = h.Churn.Degraded(now)
+	return status
+}
+
+// NodeUptime returns how long the host's node has been running, or
+// ethnode.ErrNotSupported if it doesn't reveal when it started.
+func (h *Host) NodeUptime(ctx context.Context) (time.Duration, error) {
+	return h.node.NodeUptime(ctx)
+}
+
+// reserveMargin returns the number of peer slots to keep free, including the
+// MiningMargin if the node is mining.
+func (h *Host) reserveMargin(ctx context.Context) int {
+	if h.MiningMargin == 0 {
+		return h.ReserveMargin
+	}
+	mining, err := h.node.IsMining(ctx)
+	if err != nil {
+		if err != ethnode.ErrNotSupported {
+			logger.Printf("Failed to check if the node is mining: %s", err)
+		}
+		return h.ReserveMargin
+	}
+	if mining {
+		return h.ReserveMargin + h.MiningMargin
+	}
+	return h.ReserveMargin
+}
+
+// forget stops tracking nodeID as a client of this host.
+func (h *Host) forget(nodeID string) {
+	if h.partition != nil {
+		h.partition.release(nodeID, h)
+	}
+	h.mu.Lock()
+	delete(h.active, nodeID)
+	delete(h.tiers, nodeID)
+	h.mu.Unlock()
+	if h.RPCProxy != nil {
+		h.RPCProxy.forget(nodeID)
+	}
+}
+
+// availableSlots returns how many more pool clients fit within maxPeers,
+// keeping reserveMargin slots free, clamped at zero.
+func availableSlots(maxPeers, currentPeers, reserveMargin int) int {
+	slots := maxPeers - currentPeers - reserveMargin
+	if slots < 0 {
+		return 0
+	}
+	return slots
+}
+
+// reportSlots applies the FullThreshold and AvailableThreshold hysteresis to
+// the available slots, returning 0 while the host is considered full.
+func (h *Host) reportSlots(slots int) int {
+	if h.full {
+		if slots <= h.FullThreshold || slots < h.AvailableThreshold {
+			return 0
+		}
+		h.full = false
+		logger.Printf("Capacity available again: %d slots", slots)
+	} else if slots <= h.FullThreshold {
+		h.full = true
+		logger.Printf("At capacity with %d slots available, reporting as full", slots)
+		return 0
+	}
+	return slots
+}
+
 // Stop will terminate the update peers loop, which will cause Start to return.
+// It doesn't block, and it's safe to call more than once or after the loop
+// already stopped.
 func (h *Host) Stop() {
-	h.stopCh <- struct{}{}
+	h.stopOnce.Do(func() { close(h.stopCh) })
 }
 
 // Wait blocks until the host is stopped. It returns any errors that occur
@@ -125,20 +546,50 @@ func (h *Host) Start(p pool.Pool) error {
 	logger.Printf("Connected to local node: %s", enode)
 
 	hostReq := pool.HostRequest{
-		Kind:    h.node.Kind().String(),
-		Payout:  h.payout,
-		NodeURI: h.NodeURI,
+		Kind:            h.node.Kind().String(),
+		Payout:          h.payout,
+		NodeURI:         h.NodeURI,
+		InternalNodeURI: h.InternalNodeURI,
+		Network:         int(h.node.Network()),
+		VipnodeVersion:  h.Version,
+	}
+	if genesis, err := h.node.GenesisHash(startCtx); err != nil {
+		logger.Printf("Failed to get the local node's genesis hash: %s", err)
+	} else if genesis != (common.Hash{}) {
+		hostReq.Genesis = genesis.Hex()
+	}
+	hostReq.Capabilities, err = ethnode.DetectCapabilities(startCtx, h.node)
+	if err != nil {
+		logger.Printf("Failed to detect the local node's capabilities: %s", err)
+		hostReq.Capabilities = map[string]string{}
+	}
+	for name, value := range h.Capabilities {
+		hostReq.Capabilities[name] = value
 	}
+	if len(hostReq.Capabilities) > 0 {
+		logger.Printf("Advertising node capabilities: %v", hostReq.Capabilities)
+	}
+	sent := time.Now()
 	resp, err := p.Host(startCtx, hostReq)
 	if err != nil {
 		return err
 	}
 	logger.Printf("Registered on pool: Version %s", resp.PoolVersion)
+	if skew := pool.ClockSkew(resp.PoolTime, sent, time.Now()); skew > pool.MaxClockSkew || -skew > pool.MaxClockSkew {
+		logger.Printf("Local clock is %s off from the pool's", skew)
+		if h.ClockSkewCallback != nil {
+			h.ClockSkewCallback(skew)
+		}
+	}
 
 	// TODO: Resume tracking peers that we care about (in case of interrupted
 	// shutdown)?
 
-	if err := h.updatePeers(startCtx, p); err != nil {
+	h.updateMu.Lock()
+	h.pool = p
+	err = h.updatePeers(startCtx, p)
+	h.updateMu.Unlock()
+	if err != nil {
 		return err
 	}
 
@@ -154,7 +605,14 @@ func (h *Host) serveUpdates(p pool.Pool) error {
 		select {
 		case <-ticker:
 			ctx, cancel := context.WithTimeout(context.Background(), updateTimeout)
+			h.updateMu.Lock()
 			err := h.updatePeers(ctx, p)
+			h.updateMu.Unlock()
+			if err == nil {
+				if err := h.ErrorReporter.Flush(ctx, p); err != nil {
+					logger.Printf("Failed to report node errors to the pool: %s", err)
+				}
+			}
 			cancel()
 			if err != nil {
 				return err
@@ -0,0 +1,409 @@
+package host
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/vipnode/vipnode/ethnode"
+	"github.com/vipnode/vipnode/internal/fakenode"
+	"github.com/vipnode/vipnode/pool"
+	"github.com/vipnode/vipnode/pool/store"
+)
+
+// updatePool is a pool.Pool that records host and update requests.
+type updatePool struct {
+	pool.StaticPool
+	hosts    []pool.HostRequest
+	updates  []pool.UpdateRequest
+	poolTime time.Time
+}
+
+func (p *updatePool) Host(ctx context.Context, req pool.HostRequest) (*pool.HostResponse, error) {
+	p.hosts = append(p.hosts, req)
+	return &pool.HostResponse{PoolVersion: "test", PoolTime: p.poolTime}, nil
+}
+
+func (p *updatePool) Update(ctx context.Context, req pool.UpdateRequest) (*pool.UpdateResponse, error) {
+	p.updates = append(p.updates, req)
+	return &pool.UpdateResponse{Balance: &store.Balance{}}, nil
+}
+
+func TestUpdatePeersProtocol(t *testing.T) {
+	node := fakenode.Node("host")
+	node.FakePeers = []ethnode.PeerInfo{
+		{ID: "light", Caps: []string{"les/2"}},
+		{ID: "full", Caps: []string{"eth/62", "eth/63"}},
+	}
+	h := New(node, "")
+	p := &updatePool{}
+
+	if err := h.updatePeers(context.Background(), p); err != nil {
+		t.Fatal(err)
+	}
+	h.Protocol = "les"
+	if err := h.updatePeers(context.Background(), p); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(p.updates) != 2 {
+		t.Fatalf("expected 2 updates, got %d", len(p.updates))
+	}
+	if got, want := p.updates[0].Peers, []string{"light", "full"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("unfiltered peers: got %v; want %v", got, want)
+	}
+	if got, want := p.updates[1].Peers, []string{"light"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("les peers: got %v; want %v", got, want)
+	}
+}
+
+func TestStartVersion(t *testing.T) {
+	h := New(fakenode.Node("host"), "")
+	h.Version = "v2.1.0"
+	p := &updatePool{}
+	if err := h.Start(p); err != nil {
+		t.Fatal(err)
+	}
+	h.Stop()
+	if err := h.Wait(); err != nil {
+		t.Error(err)
+	}
+
+	if len(p.hosts) != 1 {
+		t.Fatalf("expected 1 host request, got %d", len(p.hosts))
+	}
+	if got := p.hosts[0].VipnodeVersion; got != "v2.1.0" {
+		t.Errorf("version: got %q; want %q", got, "v2.1.0")
+	}
+	if got := p.hosts[0].Genesis; got != "" {
+		t.Errorf("expected no genesis for an unknown genesis hash, got %q", got)
+	}
+}
+
+func TestStopStopped(t *testing.T) {
+	h := New(fakenode.Node("host"), "")
+	if err := h.Start(&updatePool{}); err != nil {
+		t.Fatal(err)
+	}
+	h.Stop()
+	if err := h.Wait(); err != nil {
+		t.Error(err)
+	}
+
+	// Nothing is left to receive the stop, such as when shutting down after
+	// the host already stopped.
+	stopped := make(chan struct{})
+	go func() {
+		h.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("Stop blocked on a stopped host")
+	}
+}
+
+func TestStartGenesis(t *testing.T) {
+	node := fakenode.Node("host")
+	node.FakeGenesis = common.HexToHash("0x6341fd3daf94b748c72ced5a5b26028f2474f5f00d824504e4fa37a75767e177")
+	h := New(node, "")
+	p := &updatePool{}
+	if err := h.Start(p); err != nil {
+		t.Fatal(err)
+	}
+	h.Stop()
+	if err := h.Wait(); err != nil {
+		t.Error(err)
+	}
+	if got, want := p.hosts[0].Genesis, node.FakeGenesis.Hex(); got != want {
+		t.Errorf("genesis: got %q; want %q", got, want)
+	}
+}
+
+func TestStartClockSkew(t *testing.T) {
+	testcases := []struct {
+		name     string
+		poolTime time.Time
+		warn     bool
+	}{
+		{"in sync", time.Now(), false},
+		{"unreported", time.Time{}, false},
+		{"pool ahead", time.Now().Add(10 * time.Minute), true},
+		{"pool behind", time.Now().Add(-10 * time.Minute), true},
+	}
+	for _, tc := range testcases {
+		var warnings []time.Duration
+		h := New(fakenode.Node("host"), "")
+		h.ClockSkewCallback = func(skew time.Duration) {
+			warnings = append(warnings, skew)
+		}
+		if err := h.Start(&updatePool{poolTime: tc.poolTime}); err != nil {
+			t.Fatal(err)
+		}
+		h.Stop()
+		if err := h.Wait(); err != nil {
+			t.Error(err)
+		}
+		if got := len(warnings) > 0; got != tc.warn {
+			t.Errorf("%s: warned %t; want %t (%v)", tc.name, got, tc.warn, warnings)
+		} else if tc.warn && (warnings[0] < 9*time.Minute && warnings[0] > -9*time.Minute) {
+			t.Errorf("%s: wrong skew: %s", tc.name, warnings[0])
+		}
+	}
+}
+
+func TestAvailableSlots(t *testing.T) {
+	testcases := []struct {
+		maxPeers, current, margin int
+		want                      int
+	}{
+		{25, 0, 0, 25},
+		{25, 10, 5, 10},
+		{25, 20, 5, 0},
+		{25, 24, 5, 0},
+		{50, 60, 0, 0},
+		{100, 42, 8, 50},
+	}
+	for _, tc := range testcases {
+		if got := availableSlots(tc.maxPeers, tc.current, tc.margin); got != tc.want {
+			t.Errorf("availableSlots(%d, %d, %d): got %d; want %d", tc.maxPeers, tc.current, tc.margin, got, tc.want)
+		}
+	}
+}
+
+func TestUpdatePeersCapacity(t *testing.T) {
+	node := fakenode.Node("host")
+	node.FakePeers = fakenode.FakePeers(3)
+	h := New(node, "")
+	h.ReserveMargin = 2
+	p := &updatePool{}
+
+	// Unknown peer limit
+	if err := h.updatePeers(context.Background(), p); err != nil {
+		t.Fatal(err)
+	}
+	// Limit reported by the node, which Geth doesn't do
+	node.NodeKind = ethnode.Parity
+	node.FakeMaxPeers = 25
+	if err := h.updatePeers(context.Background(), p); err != nil {
+		t.Fatal(err)
+	}
+	// Limit overridden by the host
+	h.MaxPeers = 4
+	if err := h.updatePeers(context.Background(), p); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(p.updates) != 3 {
+		t.Fatalf("expected 3 updates, got %d", len(p.updates))
+	}
+	if slots := p.updates[0].AvailableSlots; slots != nil {
+		t.Errorf("expected no capacity without a peer limit, got %d", *slots)
+	}
+	for i, want := range map[int]int{1: 20, 2: 0} {
+		slots := p.updates[i].AvailableSlots
+		if slots == nil {
+			t.Errorf("update %d: missing capacity", i)
+		} else if *slots != want {
+			t.Errorf("update %d: got %d slots; want %d", i, *slots, want)
+		}
+	}
+}
+
+// slotsErrNode is a node which fails to report its peer slots.
+type slotsErrNode struct {
+	*fakenode.FakeNode
+}
+
+func (n slotsErrNode) PeerSlots(ctx context.Context) (max, used, reserved int, err error) {
+	return 0, 0, 0, errors.New("peer slots unavailable")
+}
+
+func TestUpdatePeersSlotsUnknown(t *testing.T) {
+	node := fakenode.Node("host")
+	node.NodeKind = ethnode.Parity
+	node.FakePeers = fakenode.FakePeers(3)
+	h := New(slotsErrNode{node}, "")
+	p := &updatePool{}
+
+	// The update still goes through, without the slots.
+	if err := h.updatePeers(context.Background(), p); err != nil {
+		t.Fatal(err)
+	}
+	if len(p.updates) != 1 {
+		t.Fatalf("expected 1 update, got %d", len(p.updates))
+	}
+	if slots := p.updates[0].AvailableSlots; slots != nil {
+		t.Errorf("expected unknown slots, got %d", *slots)
+	}
+
+	// The peer limit overridden by the host doesn't need the node, and the
+	// used slots come from the peers.
+	h.MaxPeers = 10
+	if err := h.updatePeers(context.Background(), p); err != nil {
+		t.Fatal(err)
+	}
+	if slots := p.updates[1].AvailableSlots; slots == nil || *slots != 7 {
+		t.Errorf("expected 7 slots, got %v", slots)
+	}
+}
+
+func TestUpdatePeersCapacityHysteresis(t *testing.T) {
+	node := fakenode.Node("host")
+	h := New(node, "")
+	h.MaxPeers = 10
+	h.FullThreshold = 1
+	h.AvailableThreshold = 4
+	p := &updatePool{}
+
+	// Peer counts hovering near the limit, and the slots that should be
+	// reported for each.
+	steps := []struct {
+		peers, want int
+	}{
+		{5, 5},
+		{8, 2},
+		{9, 0}, // 1 slot left, full
+		{8, 0}, // 2 slots, still full
+		{9, 0},
+		{8, 0},
+		{7, 0}, // 3 slots, still full
+		{6, 4}, // 4 slots, available again
+		{7, 3},
+		{8, 2},
+		{7, 3},
+		{9, 0},
+	}
+	for i, step := range steps {
+		node.FakePeers = fakenode.FakePeers(step.peers)
+		if err := h.updatePeers(context.Background(), p); err != nil {
+			t.Fatal(err)
+		}
+		if slots := p.updates[i].AvailableSlots; slots == nil || *slots != step.want {
+			t.Errorf("step %d with %d peers: got %v slots; want %d", i, step.peers, slots, step.want)
+		}
+	}
+
+	// Without hysteresis, the reported capacity follows the peer count.
+	h = New(node, "")
+	h.MaxPeers = 10
+	p = &updatePool{}
+	for i, peers := range []int{9, 10, 9, 10} {
+		node.FakePeers = fakenode.FakePeers(peers)
+		if err := h.updatePeers(context.Background(), p); err != nil {
+			t.Fatal(err)
+		}
+		if slots := p.updates[i].AvailableSlots; slots == nil || *slots != 10-peers {
+			t.Errorf("step %d with %d peers: got %v slots; want %d", i, peers, slots, 10-peers)
+		}
+	}
+}
+
+func TestUpdatePeersMiningMargin(t *testing.T) {
+	node := fakenode.Node("host")
+	node.FakePeers = fakenode.FakePeers(3)
+	h := New(node, "")
+	h.MaxPeers = 10
+	h.ReserveMargin = 1
+	h.MiningMargin = 4
+	p := &updatePool{}
+
+	for _, mining := range []bool{false, true, false} {
+		node.FakeMining = mining
+		if err := h.updatePeers(context.Background(), p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, want := range []int{6, 2, 6} {
+		if slots := p.updates[i].AvailableSlots; slots == nil || *slots != want {
+			t.Errorf("update %d: got %v slots; want %d", i, slots, want)
+		}
+	}
+}
+
+func TestUpdatePeersHealing(t *testing.T) {
+	node := fakenode.Node("host")
+	node.FakePeers = fakenode.FakePeers(3)
+	h := New(node, "")
+	p := &updatePool{}
+
+	// Without a known peer limit, capacity is only reported while healing.
+	for _, healing := range []bool{false, true, false} {
+		node.FakeHealing = healing
+		if err := h.updatePeers(context.Background(), p); err != nil {
+			t.Fatal(err)
+		}
+		if got := h.Status().Healing; got != healing {
+			t.Errorf("got status healing %t; want %t", got, healing)
+		}
+	}
+	if slots := p.updates[0].AvailableSlots; slots != nil {
+		t.Errorf("update 0: got %d slots; want unknown", *slots)
+	}
+	if slots := p.updates[1].AvailableSlots; slots == nil || *slots != 0 {
+		t.Errorf("update 1: got %v slots while healing; want 0", slots)
+	}
+	if slots := p.updates[2].AvailableSlots; slots != nil {
+		t.Errorf("update 2: got %d slots; want unknown", *slots)
+	}
+
+	h.MaxPeers = 10
+	node.FakeHealing = true
+	if err := h.updatePeers(context.Background(), p); err != nil {
+		t.Fatal(err)
+	}
+	if slots := p.updates[3].AvailableSlots; slots == nil || *slots != 0 {
+		t.Errorf("update 3: got %v slots while healing; want 0", slots)
+	}
+}
+
+func TestUpdatePeersTxPool(t *testing.T) {
+	node := fakenode.Node("host")
+	node.FakePeers = fakenode.FakePeers(3)
+	h := New(node, "")
+	h.MaxPeers = 10
+	h.TxPoolThreshold = 1000
+	h.AvailableThreshold = 6
+	p := &updatePool{}
+
+	testcases := []struct {
+		pending    uint64
+		maxPeers   int
+		overloaded bool
+		slots      int
+	}{
+		{pending: 1000, maxPeers: 10, slots: 7},
+		{pending: 1001, maxPeers: 10, overloaded: true, slots: 0},
+		// Back below the threshold, but AvailableThreshold keeps the host
+		// full until it has enough slots again.
+		{pending: 10, maxPeers: 8, slots: 0},
+		{pending: 10, maxPeers: 10, slots: 7},
+	}
+	for i, tc := range testcases {
+		node.FakeTxPending = tc.pending
+		h.MaxPeers = tc.maxPeers
+		if err := h.updatePeers(context.Background(), p); err != nil {
+			t.Fatal(err)
+		}
+		if got := h.Status().Overloaded; got != tc.overloaded {
+			t.Errorf("update %d: got status overloaded %t; want %t", i, got, tc.overloaded)
+		}
+		if slots := p.updates[i].AvailableSlots; slots == nil || *slots != tc.slots {
+			t.Errorf("update %d: got %v slots with %d pending; want %d", i, slots, tc.pending, tc.slots)
+		}
+	}
+
+	// Without a known peer limit, capacity is only reported while overloaded.
+	h.MaxPeers = 0
+	node.FakeTxPending = 5000
+	if err := h.updatePeers(context.Background(), p); err != nil {
+		t.Fatal(err)
+	}
+	if slots := p.updates[4].AvailableSlots; slots == nil || *slots != 0 {
+		t.Errorf("update 4: got %v slots while overloaded; want 0", slots)
+	}
+}
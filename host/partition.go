@@ -0,0 +1,84 @@
+package host
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrClaimedClient is returned when whitelisting a client which is already
+// attributed to another pool of the same Partition.
+var ErrClaimedClient = errors.New("client is already whitelisted by another pool")
+
+// NewPartition returns an empty Partition. Hosts are added to it with Join.
+func NewPartition() *Partition {
+	return &Partition{
+		owners: map[string]*Host{},
+	}
+}
+
+// Partition shares one node between several Hosts, each a member of a
+// different pool. The node's available slots are split evenly between the
+// members, and each client is attributed to the member whose pool
+// whitelisted it, so that every pool is only sent updates about its own
+// clients.
+type Partition struct {
+	mu      sync.Mutex
+	members []*Host
+	owners  map[string]*Host
+}
+
+// Join adds h as a member of the partition. It must be called before h is
+// started.
+func (p *Partition) Join(h *Host) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	h.partition = p
+	p.members = append(p.members, h)
+}
+
+// Owner returns the member which whitelisted nodeID, or nil if none did,
+// such as for the node's organic peers.
+func (p *Partition) Owner(nodeID string) *Host {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.owners[nodeID]
+}
+
+// claim attributes nodeID to h, unless another member already has it.
+func (p *Partition) claim(nodeID string, h *Host) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if owner, ok := p.owners[nodeID]; ok && owner != h {
+		return ErrClaimedClient
+	}
+	p.owners[nodeID] = h
+	return nil
+}
+
+// release removes the attribution of nodeID if it belongs to h.
+func (p *Partition) release(nodeID string, h *Host) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.owners[nodeID] == h {
+		delete(p.owners, nodeID)
+	}
+}
+
+// share returns h's part of the node's available slots. The remainder of an
+// uneven split goes to the members that joined first.
+func (p *Partition) share(h *Host, slots int) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	n := len(p.members)
+	for i, member := range p.members {
+		if member != h {
+			continue
+		}
+		part := slots / n
+		if i < slots%n {
+			part++
+		}
+		return part
+	}
+	return slots
+}
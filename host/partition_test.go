@@ -0,0 +1,105 @@
+package host
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/vipnode/vipnode/ethnode"
+	"github.com/vipnode/vipnode/internal/fakenode"
+)
+
+func TestPartitionCapacity(t *testing.T) {
+	node := fakenode.Node("host")
+	node.FakePeers = fakenode.FakePeers(2)
+	// Unlike Geth, Parity reports its peer limit.
+	node.NodeKind = ethnode.Parity
+	node.FakeMaxPeers = 13
+
+	partition := NewPartition()
+	hosts := []*Host{New(node, ""), New(node, ""), New(node, "")}
+	pools := []*updatePool{{}, {}, {}}
+	for _, h := range hosts {
+		partition.Join(h)
+	}
+
+	// 11 slots split between 3 pools, with the remainder going to the first
+	// members.
+	for i, h := range hosts {
+		if err := h.updatePeers(context.Background(), pools[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, want := range []int{4, 4, 3} {
+		if slots := pools[i].updates[0].AvailableSlots; slots == nil || *slots != want {
+			t.Errorf("pool %d: got %v slots; want %d", i, slots, want)
+		}
+	}
+
+	// A host which isn't shared gets all of the slots.
+	p := &updatePool{}
+	if err := New(node, "").updatePeers(context.Background(), p); err != nil {
+		t.Fatal(err)
+	}
+	if slots := p.updates[0].AvailableSlots; slots == nil || *slots != 11 {
+		t.Errorf("unshared host: got %v slots; want 11", slots)
+	}
+}
+
+func TestPartitionAttribution(t *testing.T) {
+	ctx := context.Background()
+	node := fakenode.Node("host")
+	node.FakePeers = []ethnode.PeerInfo{
+		{ID: "a1"}, {ID: "b1"}, {ID: "organic"}, {ID: "a2"},
+	}
+
+	partition := NewPartition()
+	a, b := New(node, ""), New(node, "")
+	partition.Join(a)
+	partition.Join(b)
+
+	for _, nodeID := range []string{"a1", "a2"} {
+		if err := a.Whitelist(ctx, nodeID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := b.Whitelist(ctx, "b1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// A client can't be claimed by a second pool, or disconnected by it.
+	if err := b.Whitelist(ctx, "a1"); err != ErrClaimedClient {
+		t.Errorf("expected ErrClaimedClient when whitelisting another pool's client, got: %v", err)
+	}
+	if err := b.Disconnect(ctx, "a2"); err != ErrClaimedClient {
+		t.Errorf("expected ErrClaimedClient when disconnecting another pool's client, got: %v", err)
+	}
+	if owner := partition.Owner("a1"); owner != a {
+		t.Errorf("a1 attributed to the wrong host: %p", owner)
+	}
+
+	poolA, poolB := &updatePool{}, &updatePool{}
+	if err := a.updatePeers(ctx, poolA); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.updatePeers(ctx, poolB); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := poolA.updates[0].Peers, []string{"a1", "organic", "a2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("pool A peers: got %v; want %v", got, want)
+	}
+	if got, want := poolB.updates[0].Peers, []string{"b1", "organic"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("pool B peers: got %v; want %v", got, want)
+	}
+
+	// Once disconnected by its pool, the client can be claimed by another.
+	if err := a.Disconnect(ctx, "a1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Whitelist(ctx, "a1"); err != nil {
+		t.Errorf("expected released client to be claimable, got: %v", err)
+	}
+	if owner := partition.Owner("a1"); owner != b {
+		t.Errorf("a1 attributed to the wrong host: %p", owner)
+	}
+}
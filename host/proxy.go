@@ -0,0 +1,173 @@
+package host
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/vipnode/vipnode/ethnode"
+)
+
+// ErrProxyDisabled is returned by Host.Proxy when the host doesn't have an
+// RPCProxy.
+var ErrProxyDisabled = errors.New("host does not proxy RPC calls")
+
+// ErrNotClient is returned by Host.Proxy for nodes which aren't whitelisted
+// clients of the host.
+var ErrNotClient = errors.New("node is not a client of this host")
+
+// ErrProxyRateLimited is returned by RPCProxy.Call when the client made more
+// calls than its rate limit allows.
+var ErrProxyRateLimited = errors.New("proxy rate limit exceeded")
+
+// ProxyCapability is advertised to the pool by hosts which serve an RPCProxy,
+// so that clients can require it.
+const ProxyCapability = "rpc-proxy"
+
+// ProxyMethods are the read-only methods that an RPCProxy can serve. Methods
+// which sign or send transactions, reveal the node's accounts, or hold state
+// on the node like filters and subscriptions are left out.
+var ProxyMethods = ethnode.MethodAllowlist{
+	"eth_blockNumber",
+	"eth_chainId",
+	"eth_gasPrice",
+	"eth_syncing",
+	"eth_getBalance",
+	"eth_getCode",
+	"eth_getStorageAt",
+	"eth_getTransactionCount",
+	"eth_call",
+	"eth_estimateGas",
+	"eth_getBlockByHash",
+	"eth_getBlockByNumber",
+	"eth_getBlockTransactionCountByHash",
+	"eth_getBlockTransactionCountByNumber",
+	"eth_getTransactionByHash",
+	"eth_getTransactionByBlockHashAndIndex",
+	"eth_getTransactionByBlockNumberAndIndex",
+	"eth_getTransactionReceipt",
+	"eth_getLogs",
+}
+
+// RawCaller makes RPC calls to a node which EthNode doesn't wrap, such as an
+// ethnode.RawCaller.
+type RawCaller interface {
+	RawCall(ctx context.Context, result interface{}, method string, args ...interface{}) error
+}
+
+// RPCProxy serves read-only RPC calls to the node on behalf of the host's
+// clients, relayed to the host by the pool (see Host.Proxy).
+type RPCProxy struct {
+	Caller RawCaller
+
+	// Allow narrows down ProxyMethods, such as to "eth_getBalance" and
+	// "eth_call". Methods outside of ProxyMethods are never proxied. (All of
+	// ProxyMethods if empty)
+	Allow ethnode.MethodAllowlist
+
+	// Rate is how many calls per second each client can make, with bursts of
+	// up to Burst calls. (Unlimited if 0)
+	Rate  float64
+	Burst int
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	now     func() time.Time
+}
+
+// tokenBucket is the rate limit state of a client.
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+func (p *RPCProxy) clock() time.Time {
+	if p.now != nil {
+		return p.now()
+	}
+	return time.Now()
+}
+
+// Allows returns whether the proxy serves method.
+func (p *RPCProxy) Allows(method string) bool {
+	return ProxyMethods.Allows(method) && p.Allow.Allows(method)
+}
+
+// Call calls method with params on the node for clientID, and returns the raw
+// result. It returns ethnode.ErrMethodNotAllowed without calling the node if
+// the proxy doesn't serve the method, or ErrProxyRateLimited if the client is
+// over its rate limit.
+func (p *RPCProxy) Call(ctx context.Context, clientID string, method string, params []json.RawMessage) (json.RawMessage, error) {
+	if !p.Allows(method) {
+		return nil, ethnode.ErrMethodNotAllowed
+	}
+	if !p.take(clientID) {
+		return nil, ErrProxyRateLimited
+	}
+	args := make([]interface{}, 0, len(params))
+	for _, param := range params {
+		args = append(args, param)
+	}
+	var result json.RawMessage
+	if err := p.Caller.RawCall(ctx, &result, method, args...); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// take uses up one call of the client's rate limit, and returns false if
+// there is none left.
+func (p *RPCProxy) take(clientID string) bool {
+	if p.Rate <= 0 {
+		return true
+	}
+	burst := float64(p.Burst)
+	if burst < 1 {
+		burst = 1
+	}
+	now := p.clock()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.buckets == nil {
+		p.buckets = map[string]*tokenBucket{}
+	}
+	b, ok := p.buckets[clientID]
+	if !ok {
+		b = &tokenBucket{tokens: burst, updated: now}
+		p.buckets[clientID] = b
+	}
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.updated).Seconds()*p.Rate)
+	b.updated = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// forget drops the rate limit state of clientID.
+func (p *RPCProxy) forget(clientID string) {
+	p.mu.Lock()
+	delete(p.buckets, clientID)
+	p.mu.Unlock()
+}
+
+// Proxy makes a read-only RPC call to the node on behalf of a whitelisted
+// client of the host, as relayed by the pool, and returns the raw result.
+// It's served as vipnode_proxy if RPCProxy is set.
+func (h *Host) Proxy(ctx context.Context, clientID string, method string, params []json.RawMessage) (json.RawMessage, error) {
+	if h.RPCProxy == nil {
+		return nil, ErrProxyDisabled
+	}
+	h.mu.Lock()
+	_, ok := h.active[clientID]
+	h.mu.Unlock()
+	if !ok {
+		return nil, ErrNotClient
+	}
+	return h.RPCProxy.Call(ctx, clientID, method, params)
+}
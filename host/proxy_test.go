@@ -0,0 +1,115 @@
+package host
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/vipnode/vipnode/ethnode"
+	"github.com/vipnode/vipnode/internal/fakenode"
+)
+
+// recordingCaller is a RawCaller which records the methods it's called with
+// and returns "0x2a" for each.
+type recordingCaller struct {
+	methods []string
+}
+
+func (c *recordingCaller) RawCall(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	c.methods = append(c.methods, method)
+	return json.Unmarshal([]byte(`"0x2a"`), result)
+}
+
+func TestProxyAllowlist(t *testing.T) {
+	ctx := context.Background()
+	caller := &recordingCaller{}
+	h := New(fakenode.Node("host"), "")
+	if _, err := h.Proxy(ctx, "client", "eth_blockNumber", nil); err != ErrProxyDisabled {
+		t.Errorf("expected ErrProxyDisabled, got: %v", err)
+	}
+
+	h.RPCProxy = &RPCProxy{Caller: caller}
+	if _, err := h.Proxy(ctx, "client", "eth_blockNumber", nil); err != ErrNotClient {
+		t.Errorf("expected ErrNotClient, got: %v", err)
+	}
+	if err := h.Whitelist(ctx, "client"); err != nil {
+		t.Fatal(err)
+	}
+
+	params := []json.RawMessage{json.RawMessage(`"0x0000000000000000000000000000000000000000"`), json.RawMessage(`"latest"`)}
+	result, err := h.Proxy(ctx, "client", "eth_getBalance", params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(result) != `"0x2a"` {
+		t.Errorf("wrong result: %s", result)
+	}
+
+	for _, method := range []string{"eth_sendRawTransaction", "eth_sendTransaction", "eth_sign", "eth_accounts", "eth_newFilter", "eth_subscribe", "personal_unlockAccount", "admin_peers", "debug_traceTransaction"} {
+		if _, err := h.Proxy(ctx, "client", method, nil); err != ethnode.ErrMethodNotAllowed {
+			t.Errorf("%s: expected ErrMethodNotAllowed, got: %v", method, err)
+		}
+	}
+
+	// Allow narrows down the read-only methods, but can't add to them.
+	h.RPCProxy.Allow = ethnode.MethodAllowlist{"eth_get*", "eth_sendRawTransaction"}
+	for method, want := range map[string]error{
+		"eth_getBlockByNumber":   nil,
+		"eth_blockNumber":        ethnode.ErrMethodNotAllowed,
+		"eth_sendRawTransaction": ethnode.ErrMethodNotAllowed,
+	} {
+		if _, err := h.Proxy(ctx, "client", method, nil); err != want {
+			t.Errorf("%s: got error %v; want %v", method, err, want)
+		}
+	}
+
+	if want := []string{"eth_getBalance", "eth_getBlockByNumber"}; !reflect.DeepEqual(caller.methods, want) {
+		t.Errorf("proxied methods: got %v; want %v", caller.methods, want)
+	}
+
+	// Disconnected clients can't use the proxy anymore.
+	if err := h.Disconnect(ctx, "client"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.Proxy(ctx, "client", "eth_getBalance", params); err != ErrNotClient {
+		t.Errorf("expected ErrNotClient, got: %v", err)
+	}
+}
+
+func TestProxyRateLimit(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	proxy := &RPCProxy{Caller: &recordingCaller{}, Rate: 2, Burst: 3, now: func() time.Time { return now }}
+
+	for i := 0; i < 3; i++ {
+		if _, err := proxy.Call(ctx, "a", "eth_blockNumber", nil); err != nil {
+			t.Fatalf("call %d within the burst failed: %s", i, err)
+		}
+	}
+	if _, err := proxy.Call(ctx, "a", "eth_blockNumber", nil); err != ErrProxyRateLimited {
+		t.Errorf("expected ErrProxyRateLimited, got: %v", err)
+	}
+	// Other clients have their own limit.
+	if _, err := proxy.Call(ctx, "b", "eth_blockNumber", nil); err != nil {
+		t.Errorf("unexpected error for another client: %s", err)
+	}
+
+	// One call is refilled every half second.
+	now = now.Add(500 * time.Millisecond)
+	if _, err := proxy.Call(ctx, "a", "eth_blockNumber", nil); err != nil {
+		t.Errorf("unexpected error after refill: %s", err)
+	}
+	if _, err := proxy.Call(ctx, "a", "eth_blockNumber", nil); err != ErrProxyRateLimited {
+		t.Errorf("expected ErrProxyRateLimited, got: %v", err)
+	}
+	// Disallowed methods don't use up the limit.
+	now = now.Add(500 * time.Millisecond)
+	if _, err := proxy.Call(ctx, "a", "admin_peers", nil); err != ethnode.ErrMethodNotAllowed {
+		t.Errorf("expected ErrMethodNotAllowed, got: %v", err)
+	}
+	if _, err := proxy.Call(ctx, "a", "eth_blockNumber", nil); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
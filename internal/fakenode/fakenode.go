@@ -3,10 +3,15 @@ package fakenode
 import (
 	"context"
 	"fmt"
+	"math/big"
 	"net/url"
+	"time"
 
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/params"
 	"github.com/vipnode/vipnode/ethnode"
 )
 
@@ -32,10 +37,26 @@ func Node(nodeID string) *FakeNode {
 // FakeNode is an implementation of ethnode.EthNode that no-ops for everything.
 type FakeNode struct {
 	NodeKind        ethnode.NodeKind
+	NodeNetwork     ethnode.NetworkID
 	NodeID          string
 	Calls           Calls
 	FakePeers       []ethnode.PeerInfo
+	FakeMaxPeers    int
 	FakeBlockNumber uint64
+	FakeBlockTime   time.Time
+	FakeForkHash    [4]byte
+	FakeForkNext    uint64
+	FakeNonces      map[common.Address]uint64
+	FakeGenesis     common.Hash
+	FakeMining      bool
+	FakeHealing     bool
+	FakeGasLimit    uint64
+	FakeHead        *ethnode.HeadInfo
+	FakeTxPending   uint64
+	FakeTxQueued    uint64
+	FakeSync        *ethnode.SyncProgress
+	FakeChainConfig *params.ChainConfig
+	FakeUptime      time.Duration
 }
 
 func (n *FakeNode) ContractBackend() bind.ContractBackend {
@@ -43,6 +64,7 @@ func (n *FakeNode) ContractBackend() bind.ContractBackend {
 }
 
 func (n *FakeNode) Kind() ethnode.NodeKind                    { return n.NodeKind }
+func (n *FakeNode) Network() ethnode.NetworkID                { return n.NodeNetwork }
 func (n *FakeNode) Enode(ctx context.Context) (string, error) { return n.NodeID, nil }
 func (n *FakeNode) AddTrustedPeer(ctx context.Context, nodeID string) error {
 	n.Calls = append(n.Calls, Call("AddTrustedPeer", nodeID))
@@ -70,9 +92,96 @@ func (n *FakeNode) DisconnectPeer(ctx context.Context, nodeID string) error {
 func (n *FakeNode) Peers(ctx context.Context) ([]ethnode.PeerInfo, error) {
 	return n.FakePeers, nil
 }
+func (n *FakeNode) PeersLite(ctx context.Context) ([]ethnode.PeerInfo, error) {
+	peers := make([]ethnode.PeerInfo, 0, len(n.FakePeers))
+	for _, peer := range n.FakePeers {
+		peers = append(peers, ethnode.PeerInfo{ID: peer.ID, Name: peer.Name})
+	}
+	return peers, nil
+}
+func (n *FakeNode) PeersByKind(ctx context.Context) (map[ethnode.NodeKind]int, error) {
+	peers, _ := n.PeersLite(ctx)
+	return ethnode.CountPeersByKind(peers), nil
+}
+func (n *FakeNode) PeerSlots(ctx context.Context) (max, used, reserved int, err error) {
+	trusted := map[string]struct{}{}
+	for _, call := range n.Calls {
+		switch call.Method {
+		case "AddTrustedPeer":
+			trusted[call.Args[0].(string)] = struct{}{}
+		case "RemoveTrustedPeer":
+			delete(trusted, call.Args[0].(string))
+		}
+	}
+	return n.FakeMaxPeers, len(n.FakePeers), len(trusted), nil
+}
 func (n *FakeNode) BlockNumber(ctx context.Context) (uint64, error) {
 	return n.FakeBlockNumber, nil
 }
+func (n *FakeNode) LatestBlock(ctx context.Context) (uint64, time.Time, error) {
+	return n.FakeBlockNumber, n.FakeBlockTime, nil
+}
+func (n *FakeNode) ForkID(ctx context.Context) ([4]byte, uint64, error) {
+	return n.FakeForkHash, n.FakeForkNext, nil
+}
+func (n *FakeNode) FeeHistory(ctx context.Context, blocks int, rewardPercentiles []float64) (*ethnode.FeeHistory, error) {
+	return nil, ethnode.ErrNotSupported
+}
+func (n *FakeNode) NonceAt(ctx context.Context, address common.Address, block *big.Int) (uint64, error) {
+	return n.FakeNonces[address], nil
+}
+func (n *FakeNode) SendRawTransaction(ctx context.Context, signedTx []byte) (common.Hash, error) {
+	n.Calls = append(n.Calls, Call("SendRawTransaction", signedTx))
+	return crypto.Keccak256Hash(signedTx), nil
+}
+func (n *FakeNode) AvailableNamespaces(ctx context.Context) (map[string]bool, error) {
+	return map[string]bool{"eth": true, "net": true, "web3": true, "admin": true}, nil
+}
+func (n *FakeNode) DataDir(ctx context.Context) (string, error) {
+	return "", ethnode.ErrNotSupported
+}
+func (n *FakeNode) GenesisHash(ctx context.Context) (common.Hash, error) {
+	return n.FakeGenesis, nil
+}
+func (n *FakeNode) IsMining(ctx context.Context) (bool, error) {
+	return n.FakeMining, nil
+}
+func (n *FakeNode) IsHealing(ctx context.Context) (bool, error) {
+	return n.FakeHealing, nil
+}
+func (n *FakeNode) SyncProgress(ctx context.Context) (*ethnode.SyncProgress, error) {
+	return n.FakeSync, nil
+}
+func (n *FakeNode) ChainConfig(ctx context.Context) (*params.ChainConfig, error) {
+	if n.FakeChainConfig == nil {
+		return nil, ethnode.ErrNotSupported
+	}
+	return n.FakeChainConfig, nil
+}
+func (n *FakeNode) BlockGasLimit(ctx context.Context) (uint64, error) {
+	return n.FakeGasLimit, nil
+}
+func (n *FakeNode) ClientVersion(ctx context.Context) (string, error) {
+	return "fakenode", nil
+}
+func (n *FakeNode) TxPoolStatus(ctx context.Context) (pending, queued uint64, err error) {
+	return n.FakeTxPending, n.FakeTxQueued, nil
+}
+func (n *FakeNode) NodeUptime(ctx context.Context) (time.Duration, error) {
+	if n.FakeUptime == 0 {
+		return 0, ethnode.ErrNotSupported
+	}
+	return n.FakeUptime, nil
+}
+func (n *FakeNode) ChainHead(ctx context.Context) (*ethnode.HeadInfo, error) {
+	if n.FakeHead == nil {
+		return &ethnode.HeadInfo{Number: n.FakeBlockNumber, Timestamp: n.FakeBlockTime}, nil
+	}
+	return n.FakeHead, nil
+}
+func (n *FakeNode) Close() error {
+	return nil
+}
 
 func FakePeers(num int) []ethnode.PeerInfo {
 	peers := make([]ethnode.PeerInfo, 0, num)
@@ -21,3 +21,21 @@ func TestFakeNode(t *testing.T) {
 		t.Errorf("got: %s; want: %s", n.Calls, expected)
 	}
 }
+
+func TestFakeNodePeerSlots(t *testing.T) {
+	ctx := context.Background()
+	n := Node("foo")
+	n.FakeMaxPeers = 25
+	n.FakePeers = FakePeers(3)
+	n.AddTrustedPeer(ctx, "a")
+	n.AddTrustedPeer(ctx, "b")
+	n.RemoveTrustedPeer(ctx, "a")
+
+	max, used, reserved, err := n.PeerSlots(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if max != 25 || used != 3 || reserved != 1 {
+		t.Errorf("got max=%d used=%d reserved=%d", max, used, reserved)
+	}
+}
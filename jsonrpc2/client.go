@@ -3,6 +3,8 @@ package jsonrpc2
 import (
 	"encoding/json"
 	"sync/atomic"
+
+	"github.com/google/uuid"
 )
 
 type Requester interface {
@@ -12,8 +14,28 @@ type Requester interface {
 
 var _ Requester = &Client{}
 
+// IDGenerator returns the ID of the next request. It must be safe for
+// concurrent use, and IDs must be unique among the pending requests of a
+// connection.
+type IDGenerator func() (interface{}, error)
+
+// UUIDs is an IDGenerator of random UUID strings. Unlike the default
+// incrementing integers, they're unpredictable and don't collide when the
+// requests of several clients share a connection, such as through a proxy.
+func UUIDs() (interface{}, error) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return nil, err
+	}
+	return id.String(), nil
+}
+
 // Client is responsible for making request messages.
 type Client struct {
+	// IDs generates the request IDs, which are incrementing integers from
+	// NextID if nil.
+	IDs IDGenerator
+
 	id int32
 }
 
@@ -28,8 +50,16 @@ func (c *Client) Request(method string, params ...interface{}) (*Message, error)
 		},
 		Version: Version,
 	}
+	var id interface{}
 	var err error
-	if msg.ID, err = json.Marshal(c.NextID()); err != nil {
+	if c.IDs != nil {
+		if id, err = c.IDs(); err != nil {
+			return nil, err
+		}
+	} else {
+		id = c.NextID()
+	}
+	if msg.ID, err = json.Marshal(id); err != nil {
 		return nil, err
 	}
 	if msg.Request.Params, err = json.Marshal(params); err != nil {
@@ -0,0 +1,91 @@
+package jsonrpc2
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"testing"
+
+	"golang.org/x/sync/errgroup"
+)
+
+type Adder struct{}
+
+func (a *Adder) Add(x int, y int) int {
+	return x + y
+}
+
+func TestClientIDs(t *testing.T) {
+	uuidPattern := regexp.MustCompile(`^"[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}"$`)
+
+	c := &Client{}
+	for i := 1; i <= 3; i++ {
+		msg, err := c.Request("add")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := string(msg.ID), fmt.Sprint(i); got != want {
+			t.Errorf("monotonic ID: got %s; want %s", got, want)
+		}
+	}
+
+	c = &Client{IDs: UUIDs}
+	seen := map[string]bool{}
+	for i := 0; i < 3; i++ {
+		msg, err := c.Request("add")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !uuidPattern.Match(msg.ID) {
+			t.Errorf("not a UUID string: %s", msg.ID)
+		}
+		if seen[string(msg.ID)] {
+			t.Errorf("duplicate ID: %s", msg.ID)
+		}
+		seen[string(msg.ID)] = true
+	}
+}
+
+func TestRemoteIDStrategies(t *testing.T) {
+	for name, ids := range map[string]IDGenerator{"monotonic": nil, "uuid": UUIDs} {
+		server, client := ServePipe()
+		client.Client = &Client{IDs: ids}
+		if err := server.Server.Register("", &Adder{}); err != nil {
+			t.Fatal(err)
+		}
+
+		// Concurrent calls, whose responses can arrive in any order.
+		var g errgroup.Group
+		for i := 0; i < 20; i++ {
+			i := i
+			g.Go(func() error {
+				var got int
+				if err := client.Call(context.Background(), &got, "add", i, 1000); err != nil {
+					return err
+				}
+				if got != i+1000 {
+					return fmt.Errorf("call %d got mismatched response: %d", i, got)
+				}
+				return nil
+			})
+		}
+		if err := g.Wait(); err != nil {
+			t.Errorf("%s: %s", name, err)
+		}
+		client.Close()
+		server.Close()
+	}
+}
+
+func TestPendingKey(t *testing.T) {
+	for _, ids := range [][2]string{
+		{`1`, `1`},
+		{`"f47ac10b-58cc-4372-a567-0e02b2c3d479"`, `"f47ac10b-58cc-4372-a567-0e02b2c3d479"`},
+		{` "a b" `, `"a b"`},
+	} {
+		if got, want := pendingKey(json.RawMessage(ids[0])), ids[1]; got != want {
+			t.Errorf("pendingKey(%s): got %s; want %s", ids[0], got, want)
+		}
+	}
+}
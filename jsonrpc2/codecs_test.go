@@ -35,6 +35,6 @@ func TestCodec(t *testing.T) {
 	}
 
 	if !reflect.DeepEqual(msg, msg2) {
-		t.Errorf("got: %q; want %q", msg2, msg)
+		t.Errorf("got: %v; want %v", msg2, msg)
 	}
 }
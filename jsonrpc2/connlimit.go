@@ -0,0 +1,124 @@
+package jsonrpc2
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ConnLimitError is returned by IPLimiter for connections over the limit of
+// their source IP.
+type ConnLimitError struct {
+	IP     string
+	Limit  int
+	Window time.Duration
+}
+
+func (err ConnLimitError) Error() string {
+	return fmt.Sprintf("too many connections from %s, the limit is %d per %s", err.IP, err.Limit, err.Window)
+}
+
+// IPLimiter caps how many connections each source IP can open within a
+// sliding window, so that a single source can't flood the server with
+// registrations. It's goroutine-safe.
+type IPLimiter struct {
+	// Limit is how many connections an IP can open per Window.
+	// (Disabled if 0)
+	Limit  int
+	Window time.Duration
+	// Exempt are the networks which aren't limited, such as a trusted proxy.
+	// (Optional)
+	Exempt []*net.IPNet
+
+	mu     sync.Mutex
+	opened map[string][]time.Time
+	swept  time.Time
+	now    func() time.Time // Overridden in tests
+}
+
+// Allow counts a new connection from remoteAddr, which is an IP with an
+// optional port, and returns a ConnLimitError if its IP is over the limit.
+// Rejected connections count towards the limit too, so a source which keeps
+// retrying stays rejected until it backs off.
+func (l *IPLimiter) Allow(remoteAddr string) error {
+	if l.Limit <= 0 {
+		return nil
+	}
+	host := remoteAddr
+	if h, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		host = h
+	}
+	ip := net.ParseIP(host)
+	for _, network := range l.Exempt {
+		if ip != nil && network.Contains(ip) {
+			return nil
+		}
+	}
+	if ip != nil {
+		host = ip.String()
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if l.now != nil {
+		now = l.now()
+	}
+	if l.opened == nil {
+		l.opened = map[string][]time.Time{}
+	}
+	deadline := now.Add(-l.Window)
+	if l.swept.Before(deadline) {
+		// Forget the IPs which haven't connected within the window.
+		for addr, opened := range l.opened {
+			if opened[len(opened)-1].Before(deadline) {
+				delete(l.opened, addr)
+			}
+		}
+		l.swept = now
+	}
+
+	opened := l.opened[host]
+	recent := 0
+	for recent < len(opened) && opened[recent].Before(deadline) {
+		recent++
+	}
+	opened = append(opened[recent:], now)
+	if len(opened) > l.Limit {
+		// Only the most recent attempts matter.
+		opened = opened[len(opened)-l.Limit-1:]
+	}
+	l.opened[host] = opened
+	if len(opened) > l.Limit {
+		return ConnLimitError{IP: host, Limit: l.Limit, Window: l.Window}
+	}
+	return nil
+}
+
+// ParseIPNets parses networks in CIDR notation, like "10.0.0.0/8", or single
+// IPs, for IPLimiter.Exempt.
+func ParseIPNets(networks ...string) ([]*net.IPNet, error) {
+	r := make([]*net.IPNet, 0, len(networks))
+	for _, s := range networks {
+		if !strings.Contains(s, "/") {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP: %q", s)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			r = append(r, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, err
+		}
+		r = append(r, network)
+	}
+	return r, nil
+}
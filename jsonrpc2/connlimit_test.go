@@ -0,0 +1,62 @@
+package jsonrpc2
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIPLimiter(t *testing.T) {
+	now := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	exempt, err := ParseIPNets("10.0.0.0/8", "192.168.1.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := &IPLimiter{Limit: 3, Window: time.Minute, Exempt: exempt, now: func() time.Time { return now }}
+
+	for i := 0; i < 3; i++ {
+		if err := l.Allow("1.2.3.4:1000"); err != nil {
+			t.Fatalf("connection %d was rejected: %s", i, err)
+		}
+	}
+	// Ports don't matter, and the excess is rejected.
+	if err := l.Allow("1.2.3.4:2000"); err == nil {
+		t.Error("connection over the limit was allowed")
+	} else if _, ok := err.(ConnLimitError); !ok {
+		t.Errorf("unexpected error: %s (%T)", err, err)
+	}
+	// Other IPs have their own limit.
+	if err := l.Allow("[::1]:1000"); err != nil {
+		t.Errorf("connection from another IP was rejected: %s", err)
+	}
+	for i := 0; i < 10; i++ {
+		if err := l.Allow("10.1.2.3:1000"); err != nil {
+			t.Fatalf("connection from an exempt network was rejected: %s", err)
+		}
+		if err := l.Allow("192.168.1.1:1000"); err != nil {
+			t.Fatalf("connection from an exempt IP was rejected: %s", err)
+		}
+	}
+	if err := l.Allow("192.168.1.2:1000"); err != nil {
+		t.Fatalf("connection next to an exempt IP was rejected: %s", err)
+	}
+
+	// Retrying within the window stays rejected.
+	now = now.Add(50 * time.Second)
+	if err := l.Allow("1.2.3.4:1000"); err == nil {
+		t.Error("retried connection within the window was allowed")
+	}
+	now = now.Add(2 * time.Minute)
+	if err := l.Allow("1.2.3.4:1000"); err != nil {
+		t.Errorf("connection after the window was rejected: %s", err)
+	}
+	if len(l.opened) != 1 {
+		t.Errorf("IPs outside of the window were not forgotten: %v", l.opened)
+	}
+
+	if err := (&IPLimiter{}).Allow("1.2.3.4:1000"); err != nil {
+		t.Errorf("disabled limiter rejected a connection: %s", err)
+	}
+	if _, err := ParseIPNets("not an ip"); err == nil {
+		t.Error("invalid IP was parsed")
+	}
+}
@@ -19,6 +19,9 @@ type HTTPServer struct {
 
 	// MaxContentLength is the request size limit (optional)
 	MaxContentLength int64
+
+	// Tracer creates spans for handled requests. (Optional)
+	Tracer Tracer
 }
 
 func (h *HTTPServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -60,7 +63,7 @@ func (h *HTTPServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.Header().Set("content-type", httpContentType)
-	resp := h.Server.Handle(r.Context(), msg)
+	resp := handleTraced(r.Context(), h.Tracer, &h.Server, msg)
 	err = codec.WriteMessage(resp)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -78,13 +81,19 @@ type HTTPService struct {
 	Endpoint string
 	// MaxContentLength is the response size limit (optional)
 	MaxContentLength int64
+
+	// Tracer creates spans for outgoing calls. (Optional)
+	Tracer Tracer
 }
 
-func (service *HTTPService) Call(ctx context.Context, result interface{}, method string, params ...interface{}) error {
+func (service *HTTPService) Call(ctx context.Context, result interface{}, method string, params ...interface{}) (err error) {
 	msg, err := service.Client.Request(method, params...)
 	if err != nil {
 		return err
 	}
+	ctx, span := startCall(ctx, service.Tracer, msg)
+	defer func() { span.End(err) }()
+
 	body, err := json.Marshal(msg)
 	if err != nil {
 		return err
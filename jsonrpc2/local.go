@@ -11,14 +11,20 @@ var _ Service = &Local{}
 type Local struct {
 	Client
 	Server
+
+	// Tracer creates spans for calls and their handling. (Optional)
+	Tracer Tracer
 }
 
-func (loc *Local) Call(ctx context.Context, result interface{}, method string, params ...interface{}) error {
+func (loc *Local) Call(ctx context.Context, result interface{}, method string, params ...interface{}) (err error) {
 	req, err := loc.Client.Request(method, params...)
 	if err != nil {
 		return err
 	}
+	ctx, span := startCall(ctx, loc.Tracer, req)
+	defer func() { span.End(err) }()
+
 	ctx = context.WithValue(ctx, ctxService, loc)
-	resp := loc.Server.Handle(ctx, req)
+	resp := handleTraced(ctx, loc.Tracer, &loc.Server, req)
 	return resp.UnmarshalResult(result)
 }
@@ -0,0 +1,218 @@
+package longpoll
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/vipnode/vipnode/jsonrpc2"
+)
+
+// closeTimeout is how long Close waits for the server to acknowledge the end
+// of the session.
+const closeTimeout = 5 * time.Second
+
+// StatusError is returned for long-polling requests which the server didn't
+// accept, such as when the session expired.
+type StatusError struct {
+	StatusCode int
+	Reason     string
+}
+
+func (err StatusError) Error() string {
+	return fmt.Sprintf("long-polling request failed with status %d: %s", err.StatusCode, err.Reason)
+}
+
+// Dial opens a long-polling session on a pool's poll URL, like
+// "https://pool.vipnode.org/poll", and returns a Codec for it, which polls for
+// messages from the pool until it's closed. The ctx bounds opening the
+// session, not the session. If client is nil, http.DefaultClient is used.
+func Dial(ctx context.Context, endpoint string, client *http.Client) (jsonrpc2.Codec, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := http.NewRequest(http.MethodPost, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if err := checkStatus(resp); err != nil {
+		return nil, err
+	}
+	var opened sessionResponse
+	if err := json.NewDecoder(resp.Body).Decode(&opened); err != nil {
+		return nil, err
+	}
+
+	sessionURL, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	query := sessionURL.Query()
+	query.Set("session", opened.Session)
+	sessionURL.RawQuery = query.Encode()
+
+	pollCtx, cancel := context.WithCancel(context.Background())
+	codec := &Codec{
+		client:   client,
+		endpoint: endpoint,
+		url:      sessionURL.String(),
+		incoming: make(chan *jsonrpc2.Message),
+		closed:   make(chan struct{}),
+		cancel:   cancel,
+	}
+	go codec.pollLoop(pollCtx)
+	return codec, nil
+}
+
+var _ jsonrpc2.Codec = &Codec{}
+
+// Codec is the client side of a long-polling session. Messages are sent with
+// a request each, and received by polling in the background.
+type Codec struct {
+	client   *http.Client
+	endpoint string
+	url      string // endpoint with the session
+	incoming chan *jsonrpc2.Message
+	cancel   context.CancelFunc
+
+	mu        sync.Mutex
+	err       error // why polling stopped
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// pollLoop polls for messages until the session fails or is closed.
+func (codec *Codec) pollLoop(ctx context.Context) {
+	for {
+		msgs, err := codec.poll(ctx)
+		if err != nil {
+			codec.stop(err)
+			return
+		}
+		for _, msg := range msgs {
+			select {
+			case codec.incoming <- msg:
+			case <-codec.closed:
+				return
+			}
+		}
+	}
+}
+
+func (codec *Codec) poll(ctx context.Context) ([]*jsonrpc2.Message, error) {
+	req, err := http.NewRequest(http.MethodGet, codec.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := codec.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if err := checkStatus(resp); err != nil {
+		return nil, err
+	}
+	var msgs []*jsonrpc2.Message
+	if err := json.NewDecoder(resp.Body).Decode(&msgs); err != nil {
+		return nil, err
+	}
+	return msgs, nil
+}
+
+// stop ends the session with err as the reason for readers.
+func (codec *Codec) stop(err error) {
+	codec.closeOnce.Do(func() {
+		codec.mu.Lock()
+		codec.err = err
+		codec.mu.Unlock()
+		codec.cancel()
+		close(codec.closed)
+	})
+}
+
+func (codec *Codec) RemoteAddr() string {
+	return codec.endpoint
+}
+
+func (codec *Codec) ReadMessage() (*jsonrpc2.Message, error) {
+	select {
+	case msg := <-codec.incoming:
+		return msg, nil
+	case <-codec.closed:
+		codec.mu.Lock()
+		defer codec.mu.Unlock()
+		return nil, codec.err
+	}
+}
+
+func (codec *Codec) WriteMessage(msg *jsonrpc2.Message) error {
+	select {
+	case <-codec.closed:
+		return ErrSessionClosed
+	default:
+	}
+	body, err := json.Marshal([]*jsonrpc2.Message{msg})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, codec.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := codec.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return checkStatus(resp)
+}
+
+// Close ends the session on the server, and stops polling.
+func (codec *Codec) Close() error {
+	select {
+	case <-codec.closed:
+		return nil
+	default:
+	}
+	codec.stop(io.EOF)
+
+	ctx, cancel := context.WithTimeout(context.Background(), closeTimeout)
+	defer cancel()
+	req, err := http.NewRequest(http.MethodDelete, codec.url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := codec.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		// Already expired
+		return nil
+	}
+	return checkStatus(resp)
+}
+
+// checkStatus returns a StatusError if resp is not a success.
+func checkStatus(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	reason, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	return StatusError{StatusCode: resp.StatusCode, Reason: string(bytes.TrimSpace(reason))}
+}
@@ -0,0 +1,165 @@
+package longpoll
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vipnode/vipnode/jsonrpc2"
+)
+
+type EchoService struct{}
+
+func (s *EchoService) Echo(msg string) string {
+	return msg
+}
+
+// NotifyService records the notifications sent by the server.
+type NotifyService struct {
+	mu   sync.Mutex
+	msgs []string
+}
+
+func (s *NotifyService) Notify(msg string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.msgs = append(s.msgs, msg)
+	return true
+}
+
+func TestLongPoll(t *testing.T) {
+	remotes := make(chan *jsonrpc2.Remote, 1)
+	served := make(chan error, 1)
+	handler := &Handler{
+		PollTimeout: 50 * time.Millisecond,
+		Serve: func(codec jsonrpc2.Codec) {
+			remote := &jsonrpc2.Remote{Codec: codec, Server: &jsonrpc2.Server{}, Client: &jsonrpc2.Client{}}
+			if err := remote.Server.Register("", &EchoService{}); err != nil {
+				served <- err
+				return
+			}
+			remotes <- remote
+			served <- remote.Serve()
+		},
+	}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	ctx := context.Background()
+	codec, err := Dial(ctx, server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	notify := &NotifyService{}
+	client := &jsonrpc2.Remote{Codec: codec, Server: &jsonrpc2.Server{}, Client: &jsonrpc2.Client{}}
+	if err := client.Server.Register("", notify); err != nil {
+		t.Fatal(err)
+	}
+	go client.Serve()
+
+	// Round trip requests, which outlast a poll timeout.
+	payload := strings.Repeat("vipnode", 10000)
+	for _, want := range []string{"hello", payload} {
+		var got string
+		if err := client.Call(ctx, &got, "echo", want); err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("wrong response of %d bytes, want %d bytes", len(got), len(want))
+		}
+		time.Sleep(2 * handler.PollTimeout)
+	}
+
+	// The server's notification is delivered through the poll.
+	remote := <-remotes
+	var ok bool
+	if err := remote.Call(ctx, &ok, "notify", "whitelist"); err != nil {
+		t.Fatal(err)
+	}
+	notify.mu.Lock()
+	msgs := notify.msgs
+	notify.mu.Unlock()
+	if !ok || len(msgs) != 1 || msgs[0] != "whitelist" {
+		t.Errorf("wrong notifications: %v", msgs)
+	}
+
+	// Closing the client ends the session on the server.
+	if err := codec.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-served:
+		if err != io.EOF {
+			t.Errorf("expected EOF on the server after closing, got: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("server kept serving the closed session")
+	}
+	if err := codec.WriteMessage(&jsonrpc2.Message{}); err != ErrSessionClosed {
+		t.Errorf("expected ErrSessionClosed, got: %v", err)
+	}
+}
+
+func TestLongPollExpired(t *testing.T) {
+	served := make(chan error, 1)
+	handler := &Handler{
+		PollTimeout:    10 * time.Millisecond,
+		SessionTimeout: 20 * time.Millisecond,
+		Serve: func(codec jsonrpc2.Codec) {
+			_, err := codec.ReadMessage()
+			served <- err
+		},
+	}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	// Open a session without polling it.
+	resp, err := http.Post(server.URL, "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	select {
+	case err := <-served:
+		if err != io.EOF {
+			t.Errorf("expected EOF after the session expired, got: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("session did not expire")
+	}
+
+	resp, err = http.Get(server.URL + "?session=unknown")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("wrong status for an unknown session: %d", resp.StatusCode)
+	}
+}
+
+func TestLongPollLimiter(t *testing.T) {
+	handler := &Handler{
+		Serve:   func(codec jsonrpc2.Codec) {},
+		Limiter: &jsonrpc2.IPLimiter{Limit: 1, Window: time.Minute},
+	}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	ctx := context.Background()
+	codec, err := Dial(ctx, server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer codec.Close()
+	if _, err := Dial(ctx, server.URL, nil); err == nil {
+		t.Error("session over the limit was opened")
+	} else if err, ok := err.(StatusError); !ok || err.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,301 @@
+// Package longpoll implements a jsonrpc2 transport over HTTP long-polling, for
+// reaching the pool from behind proxies which break both WebSocket and plain
+// TCP. Each connection is a session on the server:
+//
+//	POST url                 opens a session, responding with its ID.
+//	POST url?session=ID      sends a JSON array of messages to the server.
+//	GET url?session=ID       waits for messages from the server, including
+//	                         the ones it initiates, and responds with them as
+//	                         a JSON array, which is empty if none arrived
+//	                         within the poll timeout.
+//	DELETE url?session=ID    closes the session.
+package longpoll
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/vipnode/vipnode/jsonrpc2"
+)
+
+// DefaultPollTimeout is how long a poll waits for messages from the server,
+// unless the Handler sets another timeout. It's below the idle timeout of
+// most proxies.
+const DefaultPollTimeout = 25 * time.Second
+
+// DefaultSessionTimeout is how long a session lasts without being polled,
+// unless the Handler sets another timeout.
+const DefaultSessionTimeout = time.Minute
+
+// DefaultMaxMessageSize is the size limit of the body of a send request,
+// unless the Handler sets another limit.
+const DefaultMaxMessageSize = 1 << 20
+
+// maxPending is how many messages from the server a session queues before
+// writing more fails, such as when the client stopped polling.
+const maxPending = 1000
+
+// ErrSessionClosed is returned when writing to a closed session.
+var ErrSessionClosed = errors.New("long-polling session is closed")
+
+// ErrTooManyPending is returned when writing to a session which has too many
+// messages queued, such as when its client stopped polling.
+var ErrTooManyPending = errors.New("too many messages pending on long-polling session")
+
+// sessionResponse is the response body of a request opening a session.
+type sessionResponse struct {
+	Session string `json:"session"`
+}
+
+var _ http.Handler = &Handler{}
+
+// Handler serves long-polling sessions over HTTP, and passes the Codec of each
+// new session to Serve.
+type Handler struct {
+	// Serve is called in a new goroutine with the Codec of each session,
+	// which stops reading when the session is closed or expires. It must not
+	// be nil.
+	Serve func(jsonrpc2.Codec)
+
+	// PollTimeout overrides DefaultPollTimeout. (Optional)
+	PollTimeout time.Duration
+	// SessionTimeout overrides DefaultSessionTimeout. It should be longer
+	// than the PollTimeout. (Optional)
+	SessionTimeout time.Duration
+	// MaxMessageSize overrides DefaultMaxMessageSize. (Optional)
+	MaxMessageSize int64
+	// Limiter caps the sessions per source IP. Sessions over the limit are
+	// rejected with status 429. (Optional)
+	Limiter *jsonrpc2.IPLimiter
+
+	mu       sync.Mutex
+	sessions map[string]*session
+}
+
+func (h *Handler) pollTimeout() time.Duration {
+	if h.PollTimeout > 0 {
+		return h.PollTimeout
+	}
+	return DefaultPollTimeout
+}
+
+func (h *Handler) sessionTimeout() time.Duration {
+	if h.SessionTimeout > 0 {
+		return h.SessionTimeout
+	}
+	return DefaultSessionTimeout
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("session")
+	if id == "" {
+		if r.Method != http.MethodPost {
+			http.Error(w, "missing session", http.StatusBadRequest)
+			return
+		}
+		h.open(w, r)
+		return
+	}
+
+	h.mu.Lock()
+	s, ok := h.sessions[id]
+	h.mu.Unlock()
+	if !ok {
+		http.Error(w, "unknown session", http.StatusNotFound)
+		return
+	}
+	s.touch()
+	defer s.touch()
+
+	switch r.Method {
+	case http.MethodGet:
+		h.poll(w, r, s)
+	case http.MethodPost:
+		h.send(w, r, s)
+	case http.MethodDelete:
+		s.Close()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// open starts a new session and responds with its ID.
+func (h *Handler) open(w http.ResponseWriter, r *http.Request) {
+	if h.Limiter != nil {
+		if err := h.Limiter.Allow(r.RemoteAddr); err != nil {
+			http.Error(w, err.Error(), http.StatusTooManyRequests)
+			return
+		}
+	}
+	var buf [16]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s := &session{
+		id:         hex.EncodeToString(buf[:]),
+		handler:    h,
+		remoteAddr: r.RemoteAddr,
+		inbox:      make(chan *jsonrpc2.Message),
+		notify:     make(chan struct{}, 1),
+		closed:     make(chan struct{}),
+	}
+	s.mu.Lock()
+	s.expire = time.AfterFunc(h.sessionTimeout(), func() { s.Close() })
+	s.mu.Unlock()
+
+	h.mu.Lock()
+	if h.sessions == nil {
+		h.sessions = map[string]*session{}
+	}
+	h.sessions[s.id] = s
+	h.mu.Unlock()
+
+	go h.Serve(s)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sessionResponse{Session: s.id})
+}
+
+// poll responds with the messages queued by the server, waiting for some up
+// to the poll timeout.
+func (h *Handler) poll(w http.ResponseWriter, r *http.Request, s *session) {
+	timer := time.NewTimer(h.pollTimeout())
+	defer timer.Stop()
+	msgs := s.drain()
+	for msgs == nil {
+		select {
+		case <-s.notify:
+			msgs = s.drain()
+		case <-timer.C:
+			msgs = []*jsonrpc2.Message{}
+		case <-s.closed:
+			http.Error(w, "session closed", http.StatusNotFound)
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(msgs)
+}
+
+// send passes the messages in the request body to the session's reader.
+func (h *Handler) send(w http.ResponseWriter, r *http.Request, s *session) {
+	limit := h.MaxMessageSize
+	if limit <= 0 {
+		limit = DefaultMaxMessageSize
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, limit+1))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if int64(len(body)) > limit {
+		http.Error(w, "request too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	var msgs []*jsonrpc2.Message
+	if err := json.Unmarshal(body, &msgs); err != nil {
+		http.Error(w, "failed to parse messages: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	for _, msg := range msgs {
+		select {
+		case s.inbox <- msg:
+		case <-s.closed:
+			http.Error(w, "session closed", http.StatusNotFound)
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+var _ jsonrpc2.Codec = &session{}
+
+// session is the server side Codec of a long-polling connection.
+type session struct {
+	id         string
+	handler    *Handler
+	remoteAddr string
+
+	inbox  chan *jsonrpc2.Message
+	notify chan struct{} // signaled when messages are queued
+
+	mu        sync.Mutex
+	expire    *time.Timer
+	pending   []*jsonrpc2.Message
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// touch pushes back the expiry of the session.
+func (s *session) touch() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expire.Reset(s.handler.sessionTimeout())
+}
+
+// drain returns the queued messages, or nil if there are none.
+func (s *session) drain() []*jsonrpc2.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	msgs := s.pending
+	s.pending = nil
+	return msgs
+}
+
+func (s *session) RemoteAddr() string {
+	return s.remoteAddr
+}
+
+func (s *session) ReadMessage() (*jsonrpc2.Message, error) {
+	select {
+	case msg := <-s.inbox:
+		return msg, nil
+	case <-s.closed:
+		return nil, io.EOF
+	}
+}
+
+func (s *session) WriteMessage(msg *jsonrpc2.Message) error {
+	select {
+	case <-s.closed:
+		return ErrSessionClosed
+	default:
+	}
+	s.mu.Lock()
+	if len(s.pending) >= maxPending {
+		s.mu.Unlock()
+		return ErrTooManyPending
+	}
+	s.pending = append(s.pending, msg)
+	s.mu.Unlock()
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (s *session) Close() error {
+	s.closeOnce.Do(func() {
+		s.mu.Lock()
+		s.expire.Stop()
+		s.mu.Unlock()
+		close(s.closed)
+		s.handler.mu.Lock()
+		delete(s.handler.sessions, s.id)
+		s.handler.mu.Unlock()
+	})
+	return nil
+}
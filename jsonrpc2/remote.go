@@ -1,6 +1,7 @@
 package jsonrpc2
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -75,6 +76,9 @@ type Remote struct {
 	// PendingDiscard is the number of oldest messages that get discarded when PendingLimit is reached.
 	PendingDiscard int
 
+	// Tracer creates spans for outgoing calls and handled requests. (Optional)
+	Tracer Tracer
+
 	mu      sync.Mutex
 	pending map[string]pendingMsg
 }
@@ -110,7 +114,7 @@ func (r *Remote) getPendingChan(key string) chan Message {
 
 func (r *Remote) handleRequest(msg *Message) error {
 	ctx := context.WithValue(context.Background(), ctxService, r)
-	resp := r.Server.Handle(ctx, msg)
+	resp := handleTraced(ctx, r.Tracer, r.Server, msg)
 	return r.Codec.WriteMessage(resp)
 }
 
@@ -124,17 +128,28 @@ func (r *Remote) Serve() error {
 			// FIXME: Anything we can do with error handling here?
 			go r.handleRequest(msg)
 		} else if len(msg.ID) > 0 {
-			r.getPendingChan(string(msg.ID)) <- *msg
+			r.getPendingChan(pendingKey(msg.ID)) <- *msg
 		} else {
-			logger.Printf("Remote.Serve(): Dropping invalid message: %s", msg)
+			logger.Printf("Remote.Serve(): Dropping invalid message: %v", msg)
 		}
 	}
 }
 
+// pendingKey returns the key of a message ID in the pending map. The ID's JSON
+// is compacted, so that a response matches its request even if the other end
+// reformats it.
+func pendingKey(ID json.RawMessage) string {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, ID); err != nil {
+		return string(ID)
+	}
+	return buf.String()
+}
+
 // receive blocks until the given message ID is received. Use Call for an
 // end-to-end solution.
 func (r *Remote) receive(ctx context.Context, ID json.RawMessage) (*Message, error) {
-	key := string(ID)
+	key := pendingKey(ID)
 	select {
 	case msg := <-r.getPendingChan(key):
 		r.mu.Lock()
@@ -147,7 +162,7 @@ func (r *Remote) receive(ctx context.Context, ID json.RawMessage) (*Message, err
 }
 
 // Call handles sending an RPC and receiving the corresponding response synchronously.
-func (r *Remote) Call(ctx context.Context, result interface{}, method string, params ...interface{}) error {
+func (r *Remote) Call(ctx context.Context, result interface{}, method string, params ...interface{}) (err error) {
 	if r.Client == nil {
 		r.Client = &Client{}
 	}
@@ -155,6 +170,9 @@ func (r *Remote) Call(ctx context.Context, result interface{}, method string, pa
 	if err != nil {
 		return err
 	}
+	ctx, span := startCall(ctx, r.Tracer, req)
+	defer func() { span.End(err) }()
+
 	if err = r.Codec.WriteMessage(req); err != nil {
 		return err
 	}
@@ -35,7 +35,7 @@ func TestRemoteManual(t *testing.T) {
 		t.Error(err)
 	}
 	if !reflect.DeepEqual(req, req2) {
-		t.Errorf("message does not match:\n  got: %s\n  want: %s", req2, req)
+		t.Errorf("message does not match:\n  got: %v\n  want: %v", req2, req)
 	}
 	if err := g.Wait(); err != nil {
 		t.Error(err)
@@ -119,8 +119,14 @@ func (s *Server) Handle(ctx context.Context, req *Message) *Message {
 	}
 	res, err := m.Call(ctx, args)
 	if err != nil {
+		// Errors which carry their own code keep it, so that callers can
+		// tell them apart without matching on the message.
+		code := ErrCodeInternal
+		if coded, ok := err.(interface{ ErrorCode() int }); ok {
+			code = coded.ErrorCode()
+		}
 		r.Error = &ErrResponse{
-			Code:    ErrCodeInternal,
+			Code:    code,
 			Message: err.Error(),
 		}
 		return r
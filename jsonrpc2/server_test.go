@@ -3,6 +3,7 @@ package jsonrpc2
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"testing"
 )
 
@@ -21,7 +22,7 @@ func TestServer(t *testing.T) {
 		},
 	})
 	if resp.Error != nil {
-		t.Errorf("unexpected error: %q", resp)
+		t.Errorf("unexpected error: %v", resp)
 	}
 
 	if string(resp.Result) != `"Apple"` {
@@ -36,10 +37,44 @@ func TestServer(t *testing.T) {
 		},
 	})
 	if resp.Error != nil {
-		t.Errorf("unexpected error: %q", resp)
+		t.Errorf("unexpected error: %v", resp)
 	}
 
 	if string(resp.Response.Result) != "null" {
 		t.Errorf("unexpected result: %q", resp.Result)
 	}
 }
+
+type CodedService struct{}
+
+func (CodedService) Fail() error {
+	return &ErrResponse{Code: -32010, Message: "coded failure"}
+}
+
+func (CodedService) Plain() error {
+	return errors.New("plain failure")
+}
+
+func TestServerErrorCode(t *testing.T) {
+	s := Server{}
+	if err := s.Register("foo_", CodedService{}); err != nil {
+		t.Fatal(err)
+	}
+	testcases := []struct {
+		method string
+		code   int
+	}{
+		{"foo_fail", -32010},
+		{"foo_plain", ErrCodeInternal},
+	}
+	for _, tc := range testcases {
+		resp := s.Handle(context.Background(), &Message{
+			ID:      json.RawMessage([]byte("1")),
+			Version: Version,
+			Request: &Request{Method: tc.method},
+		})
+		if resp.Error == nil || resp.Error.Code != tc.code {
+			t.Errorf("%s: got error %v; want code %d", tc.method, resp.Error, tc.code)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+// Package tcp implements a jsonrpc2 transport over plain TCP, for reaching
+// the pool from environments which block WebSocket. Each message is encoded
+// as JSON and prefixed with its length as a 4-byte big-endian integer.
+package tcp
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/vipnode/vipnode/jsonrpc2"
+)
+
+// DefaultMaxMessageSize is the message size limit used unless one is set.
+const DefaultMaxMessageSize = 1 << 20
+
+// headerSize is the length of the length prefix of each message.
+const headerSize = 4
+
+// ErrMessageTooLarge is returned when a message exceeds the size limit. The
+// connection can't be used after reading a message that's too large.
+type ErrMessageTooLarge struct {
+	Size  int64
+	Limit int64
+}
+
+func (err ErrMessageTooLarge) Error() string {
+	return fmt.Sprintf("message of %d bytes exceeds limit of %d bytes", err.Size, err.Limit)
+}
+
+// Dial connects to a pool's TCP address, like "pool.vipnode.org:8081", and
+// returns a Codec for it. The ctx bounds connecting, not the connection.
+func Dial(ctx context.Context, addr string) (jsonrpc2.Codec, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return NewCodec(conn), nil
+}
+
+// Listener accepts TCP connections and wraps them in a Codec.
+type Listener struct {
+	net.Listener
+
+	// MaxMessageSize overrides DefaultMaxMessageSize for accepted
+	// connections. (Optional)
+	MaxMessageSize int64
+	// WriteTimeout is how long writing a message can take before the
+	// connection is considered dead. (Optional)
+	WriteTimeout time.Duration
+	// Limiter caps the connections per source IP. Connections over the limit
+	// are sent the error and closed, rather than returned. (Optional)
+	Limiter *jsonrpc2.IPLimiter
+}
+
+// AcceptCodec waits for the next connection and returns its Codec.
+func (l *Listener) AcceptCodec() (jsonrpc2.Codec, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		codec := NewCodec(conn)
+		if l.MaxMessageSize > 0 {
+			codec.MaxMessageSize = l.MaxMessageSize
+		}
+		codec.WriteTimeout = l.WriteTimeout
+		if l.Limiter != nil {
+			if err := l.Limiter.Allow(codec.RemoteAddr()); err != nil {
+				go reject(codec, err)
+				continue
+			}
+		}
+		return codec, nil
+	}
+}
+
+// rejectTimeout is how long a rejected connection has to receive its error.
+const rejectTimeout = 5 * time.Second
+
+// reject sends err to the other end of codec as a response without an ID,
+// since there's no request yet, and closes it.
+func reject(codec *Codec, err error) {
+	defer codec.Close()
+	codec.conn.SetWriteDeadline(time.Now().Add(rejectTimeout))
+	codec.WriteMessage(&jsonrpc2.Message{
+		Version: jsonrpc2.Version,
+		Response: &jsonrpc2.Response{
+			Error: &jsonrpc2.ErrResponse{Code: jsonrpc2.ErrCodeServer, Message: err.Error()},
+		},
+	})
+}
+
+var _ jsonrpc2.Codec = &Codec{}
+
+// NewCodec returns a Codec for both the client and server sides of conn.
+func NewCodec(conn net.Conn) *Codec {
+	return &Codec{
+		conn:           conn,
+		MaxMessageSize: DefaultMaxMessageSize,
+	}
+}
+
+// Codec reads and writes length-prefixed JSON messages over a connection.
+type Codec struct {
+	// MaxMessageSize is the size limit of messages in either direction.
+	MaxMessageSize int64
+	// WriteTimeout is how long writing a message can take. (Disabled if 0)
+	WriteTimeout time.Duration
+
+	muWrite sync.Mutex
+	muRead  sync.Mutex
+	conn    net.Conn
+}
+
+func (codec *Codec) RemoteAddr() string {
+	return codec.conn.RemoteAddr().String()
+}
+
+func (codec *Codec) ReadMessage() (*jsonrpc2.Message, error) {
+	codec.muRead.Lock()
+	defer codec.muRead.Unlock()
+
+	var header [headerSize]byte
+	if _, err := io.ReadFull(codec.conn, header[:]); err != nil {
+		return nil, err
+	}
+	size := int64(binary.BigEndian.Uint32(header[:]))
+	if codec.MaxMessageSize > 0 && size > codec.MaxMessageSize {
+		return nil, ErrMessageTooLarge{size, codec.MaxMessageSize}
+	}
+	buf := make([]byte, size)
+	if _, err := io.ReadFull(codec.conn, buf); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	var msg jsonrpc2.Message
+	if err := json.Unmarshal(buf, &msg); err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+func (codec *Codec) WriteMessage(msg *jsonrpc2.Message) error {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	size := int64(len(payload))
+	if (codec.MaxMessageSize > 0 && size > codec.MaxMessageSize) || size > 1<<32-1 {
+		return ErrMessageTooLarge{size, codec.MaxMessageSize}
+	}
+	buf := make([]byte, headerSize+len(payload))
+	binary.BigEndian.PutUint32(buf, uint32(size))
+	copy(buf[headerSize:], payload)
+
+	codec.muWrite.Lock()
+	defer codec.muWrite.Unlock()
+	if codec.WriteTimeout > 0 {
+		if err := codec.conn.SetWriteDeadline(time.Now().Add(codec.WriteTimeout)); err != nil {
+			return err
+		}
+	}
+	_, err = codec.conn.Write(buf)
+	return err
+}
+
+func (codec *Codec) Close() error {
+	return codec.conn.Close()
+}
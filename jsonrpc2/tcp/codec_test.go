@@ -0,0 +1,204 @@
+package tcp
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vipnode/vipnode/jsonrpc2"
+)
+
+type EchoService struct{}
+
+func (s *EchoService) Echo(msg string) string {
+	return msg
+}
+
+func TestCodec(t *testing.T) {
+	c1, c2 := net.Pipe()
+	clientCodec, serverCodec := NewCodec(c1), NewCodec(c2)
+	defer clientCodec.Close()
+
+	go clientCodec.WriteMessage(&jsonrpc2.Message{Version: "foo"})
+	msg, err := serverCodec.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Version != "foo" {
+		t.Errorf("wrong message: %v", msg)
+	}
+
+	go serverCodec.WriteMessage(&jsonrpc2.Message{Version: "bar"})
+	msg, err = clientCodec.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Version != "bar" {
+		t.Errorf("wrong message: %v", msg)
+	}
+
+	serverCodec.Close()
+	if _, err := clientCodec.ReadMessage(); err != io.EOF {
+		t.Errorf("expected EOF after close, got: %v", err)
+	}
+}
+
+func TestCodecRemote(t *testing.T) {
+	c1, c2 := net.Pipe()
+	server := &jsonrpc2.Remote{Codec: NewCodec(c2), Server: &jsonrpc2.Server{}, Client: &jsonrpc2.Client{}}
+	client := &jsonrpc2.Remote{Codec: NewCodec(c1), Server: &jsonrpc2.Server{}, Client: &jsonrpc2.Client{}}
+	if err := server.Server.Register("", &EchoService{}); err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve()
+	go client.Serve()
+	defer client.Close()
+
+	// Messages beyond the default buffer sizes of a single read
+	payload := strings.Repeat("vipnode", 10000)
+	for _, want := range []string{"hello", payload} {
+		var got string
+		if err := client.Call(context.Background(), &got, "echo", want); err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("wrong response of %d bytes, want %d bytes", len(got), len(want))
+		}
+	}
+}
+
+func TestCodecMaxMessageSize(t *testing.T) {
+	c1, c2 := net.Pipe()
+	clientCodec, serverCodec := NewCodec(c1), NewCodec(c2)
+	defer clientCodec.Close()
+	defer serverCodec.Close()
+	clientCodec.MaxMessageSize = 32
+	serverCodec.MaxMessageSize = 32
+
+	big := &jsonrpc2.Message{Version: strings.Repeat("x", 64)}
+	if err, ok := clientCodec.WriteMessage(big).(ErrMessageTooLarge); !ok || err.Limit != 32 {
+		t.Errorf("expected ErrMessageTooLarge when writing, got: %v", err)
+	}
+
+	// A large frame is rejected from its header, before it's buffered.
+	go func() {
+		var header [headerSize]byte
+		binary.BigEndian.PutUint32(header[:], 1<<30)
+		c1.Write(header[:])
+	}()
+	if _, err := serverCodec.ReadMessage(); err == nil {
+		t.Error("expected ErrMessageTooLarge when reading")
+	} else if _, ok := err.(ErrMessageTooLarge); !ok {
+		t.Errorf("expected ErrMessageTooLarge when reading, got: %v", err)
+	}
+}
+
+func TestCodecWriteTimeout(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+	codec := NewCodec(c1)
+	defer codec.Close()
+	codec.WriteTimeout = 50 * time.Millisecond
+
+	// Nobody reads from the other end.
+	err := codec.WriteMessage(&jsonrpc2.Message{Version: "2.0"})
+	if err, ok := err.(net.Error); !ok || !err.Timeout() {
+		t.Errorf("expected write timeout, got: %v", err)
+	}
+}
+
+func TestDialListener(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener := &Listener{Listener: l, MaxMessageSize: 1024}
+	defer listener.Close()
+
+	go func() {
+		codec, err := listener.AcceptCodec()
+		if err != nil {
+			return
+		}
+		remote := &jsonrpc2.Remote{Codec: codec, Server: &jsonrpc2.Server{}, Client: &jsonrpc2.Client{}}
+		remote.Server.Register("", &EchoService{})
+		remote.Serve()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	codec, err := Dial(ctx, l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &jsonrpc2.Remote{Codec: codec, Server: &jsonrpc2.Server{}, Client: &jsonrpc2.Client{}}
+	go client.Serve()
+	defer client.Close()
+
+	var got string
+	if err := client.Call(ctx, &got, "echo", "hello"); err != nil {
+		t.Fatal(err)
+	}
+	if got != "hello" {
+		t.Errorf("got %q; want %q", got, "hello")
+	}
+}
+
+func TestListenerLimiter(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener := &Listener{Listener: l, Limiter: &jsonrpc2.IPLimiter{Limit: 3, Window: time.Minute}}
+	defer listener.Close()
+
+	accepted := make(chan jsonrpc2.Codec, 10)
+	go func() {
+		for {
+			codec, err := listener.AcceptCodec()
+			if err != nil {
+				close(accepted)
+				return
+			}
+			accepted <- codec
+		}
+	}()
+
+	ctx := context.Background()
+	var rejected int
+	for i := 0; i < 5; i++ {
+		client, err := Dial(ctx, l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer client.Close()
+		if i < 3 {
+			codec := <-accepted
+			defer codec.Close()
+			continue
+		}
+		msg, err := client.ReadMessage()
+		if err != nil {
+			t.Fatalf("connection %d: expected a rejection, got: %s", i, err)
+		}
+		if msg.Response == nil || msg.Response.Error == nil || !strings.Contains(msg.Response.Error.Message, "too many connections from 127.0.0.1") {
+			t.Errorf("connection %d: wrong rejection: %+v", i, msg)
+		}
+		if _, err := client.ReadMessage(); err != io.EOF {
+			t.Errorf("connection %d: expected EOF after the rejection, got: %v", i, err)
+		}
+		rejected++
+	}
+	if rejected != 2 {
+		t.Errorf("rejected %d connections, want 2", rejected)
+	}
+	select {
+	case codec := <-accepted:
+		t.Errorf("connection over the limit was accepted: %s", codec.RemoteAddr())
+	default:
+	}
+}
@@ -0,0 +1,55 @@
+package jsonrpc2
+
+import "context"
+
+// Tracer creates spans for RPC calls, and propagates their trace context in
+// the request envelope so that the remote end can continue the trace. It can
+// be implemented by adapting an OpenTelemetry tracer and propagator, without
+// this package depending on one.
+type Tracer interface {
+	// StartSpan starts a span named name, as a child of any span in ctx.
+	StartSpan(ctx context.Context, name string) (context.Context, Span)
+	// Inject returns the trace context of the span in ctx, to be sent along
+	// with a request.
+	Inject(ctx context.Context) map[string]string
+	// Extract returns ctx with the trace context received with a request.
+	Extract(ctx context.Context, carrier map[string]string) context.Context
+}
+
+// Span is an in-progress operation started by a Tracer.
+type Span interface {
+	// End completes the span, err is nil if the operation succeeded.
+	End(err error)
+}
+
+type noSpan struct{}
+
+func (noSpan) End(error) {}
+
+// startCall starts a span for an outgoing request and injects its trace
+// context into the request. It's a noop if tracer is nil.
+func startCall(ctx context.Context, tracer Tracer, req *Message) (context.Context, Span) {
+	if tracer == nil || req.Request == nil {
+		return ctx, noSpan{}
+	}
+	ctx, span := tracer.StartSpan(ctx, "jsonrpc2.call "+req.Method)
+	req.Request.Trace = tracer.Inject(ctx)
+	return ctx, span
+}
+
+// handleTraced executes a request against handler within a span which
+// continues the trace from the request, if tracer is set.
+func handleTraced(ctx context.Context, tracer Tracer, handler Handler, req *Message) *Message {
+	if tracer == nil || req.Request == nil {
+		return handler.Handle(ctx, req)
+	}
+	ctx = tracer.Extract(ctx, req.Request.Trace)
+	ctx, span := tracer.StartSpan(ctx, "jsonrpc2.handle "+req.Method)
+	resp := handler.Handle(ctx, req)
+	if resp.Response != nil && resp.Response.Error != nil {
+		span.End(resp.Response.Error)
+	} else {
+		span.End(nil)
+	}
+	return resp
+}
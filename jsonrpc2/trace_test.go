@@ -0,0 +1,153 @@
+package jsonrpc2
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+type fakeSpanKey struct{}
+
+type fakeSpan struct {
+	tracer  *fakeTracer
+	Name    string
+	TraceID string
+	ID      string
+	Parent  string
+	Err     error
+}
+
+func (s *fakeSpan) End(err error) {
+	s.Err = err
+	s.tracer.mu.Lock()
+	s.tracer.ended = append(s.tracer.ended, s)
+	s.tracer.mu.Unlock()
+}
+
+// fakeTracer propagates "trace" and "span" IDs, and records ended spans.
+type fakeTracer struct {
+	mu    sync.Mutex
+	next  int
+	ended []*fakeSpan
+}
+
+func (t *fakeTracer) StartSpan(ctx context.Context, name string) (context.Context, Span) {
+	t.mu.Lock()
+	t.next++
+	span := &fakeSpan{tracer: t, Name: name, ID: fmt.Sprintf("span%d", t.next)}
+	t.mu.Unlock()
+
+	if parent, ok := ctx.Value(fakeSpanKey{}).(*fakeSpan); ok {
+		span.TraceID = parent.TraceID
+		span.Parent = parent.ID
+	} else {
+		span.TraceID = "trace-" + span.ID
+	}
+	return context.WithValue(ctx, fakeSpanKey{}, span), span
+}
+
+func (t *fakeTracer) Inject(ctx context.Context) map[string]string {
+	span, ok := ctx.Value(fakeSpanKey{}).(*fakeSpan)
+	if !ok {
+		return nil
+	}
+	return map[string]string{"trace": span.TraceID, "span": span.ID}
+}
+
+func (t *fakeTracer) Extract(ctx context.Context, carrier map[string]string) context.Context {
+	if carrier == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, fakeSpanKey{}, &fakeSpan{TraceID: carrier["trace"], ID: carrier["span"]})
+}
+
+func (t *fakeTracer) span(name string) *fakeSpan {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, span := range t.ended {
+		if span.Name == name {
+			return span
+		}
+	}
+	return nil
+}
+
+// assertPropagated checks that the handler span continued the call span's
+// trace.
+func assertPropagated(t *testing.T, callTracer, handleTracer *fakeTracer, method string, wantErr bool) {
+	t.Helper()
+	call := callTracer.span("jsonrpc2.call " + method)
+	handle := handleTracer.span("jsonrpc2.handle " + method)
+	if call == nil || handle == nil {
+		t.Fatalf("missing spans for %q: call=%v handle=%v", method, call, handle)
+	}
+	if handle.TraceID != call.TraceID || handle.Parent != call.ID {
+		t.Errorf("trace context was not propagated: call=%+v handle=%+v", call, handle)
+	}
+	if (call.Err != nil) != wantErr || (handle.Err != nil) != wantErr {
+		t.Errorf("wrong span errors for %q: call=%v handle=%v", method, call.Err, handle.Err)
+	}
+}
+
+func TestTraceRemote(t *testing.T) {
+	server, client := ServePipe()
+	serverTracer, clientTracer := &fakeTracer{}, &fakeTracer{}
+	server.Tracer = serverTracer
+	client.Tracer = clientTracer
+	if err := server.Server.Register("", &FruitService{}); err != nil {
+		t.Fatal(err)
+	}
+
+	var got string
+	if err := client.Call(context.Background(), &got, "cherry"); err != nil {
+		t.Fatal(err)
+	}
+	assertPropagated(t, clientTracer, serverTracer, "cherry", false)
+
+	if err := client.Call(context.Background(), nil, "durian"); err == nil {
+		t.Fatal("expected error")
+	}
+	assertPropagated(t, clientTracer, serverTracer, "durian", true)
+}
+
+func TestTraceHTTP(t *testing.T) {
+	serverTracer, clientTracer := &fakeTracer{}, &fakeTracer{}
+	rpcServer := &HTTPServer{Tracer: serverTracer}
+	if err := rpcServer.Register("", &FruitService{}); err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(rpcServer)
+	defer ts.Close()
+
+	service := &HTTPService{Endpoint: ts.URL, Tracer: clientTracer}
+	var got string
+	if err := service.Call(context.Background(), &got, "cherry"); err != nil {
+		t.Fatal(err)
+	}
+	assertPropagated(t, clientTracer, serverTracer, "cherry", false)
+}
+
+func TestTraceLocal(t *testing.T) {
+	tracer := &fakeTracer{}
+	loc := &Local{Tracer: tracer}
+	if err := loc.Register("", &FruitService{}); err != nil {
+		t.Fatal(err)
+	}
+	var got string
+	if err := loc.Call(context.Background(), &got, "cherry"); err != nil {
+		t.Fatal(err)
+	}
+	assertPropagated(t, tracer, tracer, "cherry", false)
+
+	// Without a tracer, no trace context is sent
+	req, err := loc.Client.Request("cherry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	startCall(context.Background(), nil, req)
+	if req.Trace != nil {
+		t.Errorf("unexpected trace context without a tracer: %v", req.Trace)
+	}
+}
@@ -27,6 +27,10 @@ type Message struct {
 type Request struct {
 	Method string          `json:"method"`
 	Params json.RawMessage `json:"params,omitempty"`
+
+	// Trace is the propagated trace context of the caller, if any. It's an
+	// extension to the JSONRPC2 spec, and only set when a Tracer is used.
+	Trace map[string]string `json:"trace,omitempty"`
 }
 
 type Response struct {
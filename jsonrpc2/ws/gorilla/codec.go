@@ -22,6 +22,25 @@ func WebSocketDial(ctx context.Context, url string) (jsonrpc2.Codec, error) {
 	return &wsCodec{conn: conn}, nil
 }
 
+// DialOptions configures the WebSocket connection made by DialWithOptions.
+type DialOptions struct {
+	// Compression requests permessage-deflate compression of messages, for
+	// metered or slow links. It's only used if the server also supports it.
+	Compression bool
+}
+
+// DialWithOptions is WebSocketDial with the given options.
+func DialWithOptions(ctx context.Context, url string, opts DialOptions) (jsonrpc2.Codec, error) {
+	dialer := *websocket.DefaultDialer
+	dialer.EnableCompression = opts.Compression
+	conn, _, err := dialer.DialContext(ctx, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &wsCodec{conn: conn}, nil
+}
+
 var _ jsonrpc2.Codec = &wsCodec{}
 
 func overrideEOF(err error) error {
@@ -65,7 +84,8 @@ func (codec *wsCodec) Close() error {
 }
 
 // Upgrader upgrades an HTTP request to a WebSocket request and returns the
-// appropriate jsonrpc2 codec.
+// appropriate jsonrpc2 codec. Set EnableCompression to accept clients which
+// request permessage-deflate compression.
 type Upgrader struct {
 	websocket.Upgrader
 }
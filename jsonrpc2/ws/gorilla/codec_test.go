@@ -0,0 +1,103 @@
+package gorilla
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/vipnode/vipnode/jsonrpc2"
+)
+
+type Echo struct{}
+
+func (e *Echo) Echo(s string) string {
+	return s
+}
+
+func serveEcho(t *testing.T, compression bool) *httptest.Server {
+	rpcServer := &jsonrpc2.Server{}
+	if err := rpcServer.Register("", &Echo{}); err != nil {
+		t.Fatal(err)
+	}
+	upgrader := &Upgrader{Upgrader: websocket.Upgrader{EnableCompression: compression}}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		codec, err := upgrader.Upgrade(r, w, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		remote := &jsonrpc2.Remote{
+			Client: &jsonrpc2.Client{},
+			Server: rpcServer,
+			Codec:  codec,
+		}
+		remote.Serve()
+		remote.Close()
+	}))
+}
+
+func TestCompressionNegotiated(t *testing.T) {
+	for _, tc := range []struct {
+		server, client bool
+	}{
+		{true, true}, {true, false}, {false, true}, {false, false},
+	} {
+		server := serveEcho(t, tc.server)
+		dialer := *websocket.DefaultDialer
+		dialer.EnableCompression = tc.client
+		conn, resp, err := dialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		negotiated := strings.Contains(resp.Header.Get("Sec-Websocket-Extensions"), "permessage-deflate")
+		if want := tc.server && tc.client; negotiated != want {
+			t.Errorf("server=%t client=%t: got negotiated %t; want %t", tc.server, tc.client, negotiated, want)
+		}
+		conn.Close()
+		server.Close()
+	}
+}
+
+func TestCompressionRoundTrip(t *testing.T) {
+	// Repetitive payloads compress well, and are over the size where the
+	// compressor flushes in several blocks.
+	var large strings.Builder
+	for i := 0; large.Len() < 1<<20; i++ {
+		fmt.Fprintf(&large, "peer %d: enode://%064x@127.0.0.1:30303\n", i, i)
+	}
+	payloads := []string{"", "small", large.String()}
+
+	for _, tc := range []struct {
+		server, client bool
+	}{
+		{true, true}, {true, false}, {false, true},
+	} {
+		server := serveEcho(t, tc.server)
+		codec, err := DialWithOptions(context.Background(), "ws"+strings.TrimPrefix(server.URL, "http"), DialOptions{Compression: tc.client})
+		if err != nil {
+			t.Fatal(err)
+		}
+		remote := &jsonrpc2.Remote{
+			Client: &jsonrpc2.Client{},
+			Server: &jsonrpc2.Server{},
+			Codec:  codec,
+		}
+		go remote.Serve()
+
+		for _, payload := range payloads {
+			var got string
+			if err := remote.Call(context.Background(), &got, "echo", payload); err != nil {
+				t.Fatalf("server=%t client=%t: %s", tc.server, tc.client, err)
+			}
+			if got != payload {
+				t.Errorf("server=%t client=%t: echo of %d bytes returned %d mismatched bytes", tc.server, tc.client, len(payload), len(got))
+			}
+		}
+		remote.Close()
+		server.Close()
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/alexcesaro/log"
+	"github.com/alexcesaro/log/golog"
+)
+
+// levelNames are indexed by log.Level.
+var levelNames = []string{"emergency", "alert", "critical", "error", "warning", "notice", "info", "debug"}
+
+var logLevelNames = map[string]log.Level{
+	"error":   log.Error,
+	"warning": log.Warning,
+	"info":    log.Info,
+	"debug":   log.Debug,
+}
+
+// parseLogLevel returns the log level for a name like "info" or "debug".
+func parseLogLevel(name string) (log.Level, error) {
+	level, ok := logLevelNames[strings.ToLower(name)]
+	if !ok {
+		return 0, fmt.Errorf("unknown log level: %q", name)
+	}
+	return level, nil
+}
+
+// logOutput is the destination for the agent's logs and the subpackage
+// loggers. Its level can be changed while running, and it can encode each
+// line as a JSON object for log aggregators.
+type logOutput struct {
+	out  io.Writer
+	json bool
+
+	level   int32 // log.Level, accessed atomically
+	writeMu sync.Mutex
+}
+
+// newLogOutput returns a logOutput for the given format, either "text" or
+// "json".
+func newLogOutput(out io.Writer, level log.Level, format string) (*logOutput, error) {
+	o := &logOutput{out: out, level: int32(level)}
+	switch format {
+	case "", "text":
+	case "json":
+		o.json = true
+	default:
+		return nil, fmt.Errorf("unknown log format: %q", format)
+	}
+	return o, nil
+}
+
+// Level returns the current log level.
+func (o *logOutput) Level() log.Level {
+	return log.Level(atomic.LoadInt32(&o.level))
+}
+
+// SetLevel changes the log level of all loggers using this output.
+func (o *logOutput) SetLevel(level log.Level) {
+	atomic.StoreInt32(&o.level, int32(level))
+}
+
+// Logger returns a leveled logger for the main package.
+func (o *logOutput) Logger() *golog.Logger {
+	// The level is checked when writing rather than by golog, so that it can
+	// change.
+	l := golog.New(o.out, log.Debug)
+	l.Writer = func(out io.Writer, line []byte, level log.Level) {
+		if level > o.Level() {
+			return
+		}
+		o.write(line)
+	}
+	if o.json {
+		l.Formatter = func(buf *bytes.Buffer, level log.Level, args ...interface{}) {
+			msg := strings.TrimSuffix(fmt.Sprintln(args...), "\n")
+			o.encode(buf, level, "", msg)
+		}
+	}
+	return l
+}
+
+// Writer returns an io.Writer for the subpackage loggers, which only log at
+// the debug level. Lines prefixed with the package, like "[host] ...", have
+// it split out into the module field in JSON.
+func (o *logOutput) Writer() io.Writer {
+	return debugWriter{o}
+}
+
+func (o *logOutput) write(line []byte) {
+	o.writeMu.Lock()
+	o.out.Write(line)
+	o.writeMu.Unlock()
+}
+
+// encode writes a single JSON log line to buf.
+func (o *logOutput) encode(buf *bytes.Buffer, level log.Level, module string, msg string) {
+	line := struct {
+		Time   string `json:"time"`
+		Level  string `json:"level"`
+		Module string `json:"module,omitempty"`
+		Msg    string `json:"msg"`
+	}{
+		Time:   time.Now().UTC().Format(time.RFC3339Nano),
+		Level:  levelNames[level],
+		Module: module,
+		Msg:    msg,
+	}
+	// Encoder appends a newline.
+	json.NewEncoder(buf).Encode(line)
+}
+
+type debugWriter struct {
+	*logOutput
+}
+
+func (w debugWriter) Write(p []byte) (int, error) {
+	if w.Level() < log.Debug {
+		return len(p), nil
+	}
+	if !w.json {
+		w.write(p)
+		return len(p), nil
+	}
+
+	msg := strings.TrimSuffix(string(p), "\n")
+	var module string
+	if strings.HasPrefix(msg, "[") {
+		if end := strings.Index(msg, "] "); end > 0 {
+			module, msg = msg[1:end], msg[end+2:]
+		}
+	}
+	var buf bytes.Buffer
+	w.encode(&buf, log.Debug, module, msg)
+	w.write(buf.Bytes())
+	return len(p), nil
+}
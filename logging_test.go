@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	stdlog "log"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/alexcesaro/log"
+	"github.com/vipnode/vipnode/jsonrpc2"
+)
+
+type jsonLogLine struct {
+	Time   string `json:"time"`
+	Level  string `json:"level"`
+	Module string `json:"module"`
+	Msg    string `json:"msg"`
+}
+
+func decodeLogLines(t *testing.T, buf *bytes.Buffer) []jsonLogLine {
+	var lines []jsonLogLine
+	for _, raw := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if raw == "" {
+			continue
+		}
+		var line jsonLogLine
+		if err := json.Unmarshal([]byte(raw), &line); err != nil {
+			t.Fatalf("invalid JSON log line %q: %s", raw, err)
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func TestLogOutputJSON(t *testing.T) {
+	var buf bytes.Buffer
+	out, err := newLogOutput(&buf, log.Info, "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := out.Logger()
+	l.Infof("Connected to %s", "pool")
+	l.Debug("hidden")
+	stdlog.New(out.Writer(), "[host] ", 0).Printf("hidden too")
+
+	lines := decodeLogLines(t, &buf)
+	if len(lines) != 1 {
+		t.Fatalf("expected 1 line, got %d: %q", len(lines), buf.String())
+	}
+	if got := lines[0]; got.Level != "info" || got.Msg != "Connected to pool" || got.Module != "" || got.Time == "" {
+		t.Errorf("wrong log line: %+v", got)
+	}
+
+	buf.Reset()
+	out.SetLevel(log.Debug)
+	l.Debug("shown")
+	stdlog.New(out.Writer(), "[host] ", 0).Printf("shown too")
+	lines = decodeLogLines(t, &buf)
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %d: %q", len(lines), buf.String())
+	}
+	if got := lines[1]; got.Level != "debug" || got.Module != "host" || got.Msg != "shown too" {
+		t.Errorf("wrong subpackage log line: %+v", got)
+	}
+
+	if _, err := newLogOutput(&buf, log.Info, "xml"); err == nil {
+		t.Error("expected error for unknown format")
+	}
+}
+
+func TestLogOutputDebugRPC(t *testing.T) {
+	var buf bytes.Buffer
+	out, err := newLogOutput(&buf, log.Info, "text")
+	if err != nil {
+		t.Fatal(err)
+	}
+	jsonrpc2.SetLogger(out.Writer())
+	defer jsonrpc2.SetLogger(ioutil.Discard)
+
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+	codec := jsonrpc2.DebugCodec("test", jsonrpc2.IOCodec(c1))
+	sender := jsonrpc2.IOCodec(c2)
+	readMessage := func() {
+		go sender.WriteMessage(&jsonrpc2.Message{Request: &jsonrpc2.Request{Method: "vipnode_ping"}})
+		if _, err := codec.ReadMessage(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	readMessage()
+	if buf.Len() != 0 {
+		t.Errorf("unexpected RPC logs at info level: %q", buf.String())
+	}
+
+	out.SetLevel(log.Debug)
+	readMessage()
+	if got := buf.String(); !strings.Contains(got, "[jsonrpc2] ") || !strings.Contains(got, "vipnode_ping") {
+		t.Errorf("missing RPC logs at debug level: %q", got)
+	}
+}
+
+func TestParseLogLevel(t *testing.T) {
+	for name, want := range map[string]log.Level{"error": log.Error, "INFO": log.Info, "debug": log.Debug} {
+		if got, err := parseLogLevel(name); err != nil || got != want {
+			t.Errorf("%q: got %d, %v; want %d", name, got, err, want)
+		}
+	}
+	if _, err := parseLogLevel("loud"); err == nil {
+		t.Error("expected error for unknown level")
+	}
+}
@@ -0,0 +1,33 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/alexcesaro/log"
+)
+
+// watchLogLevel toggles debug logging on SIGUSR1, and switches back to the
+// original level on the next one.
+func watchLogLevel(o *logOutput) {
+	original := o.Level()
+	if original == log.Debug {
+		original = log.Info
+	}
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGUSR1)
+	go func() {
+		for range sigCh {
+			if o.Level() == log.Debug {
+				o.SetLevel(original)
+			} else {
+				o.SetLevel(log.Debug)
+			}
+			logger.Warningf("Changed log level to %s", levelNames[o.Level()])
+		}
+	}()
+}
@@ -0,0 +1,4 @@
+package main
+
+// watchLogLevel is a noop on Windows, which has no SIGUSR1.
+func watchLogLevel(o *logOutput) {}
@@ -0,0 +1,184 @@
+// Package accounting exports the sessions billed by the pool, so that
+// operators can reconcile host earnings and client charges with their own
+// records.
+package accounting
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/vipnode/vipnode/pool/store"
+)
+
+// Store is the subset of store.Store needed for exports.
+type Store interface {
+	store.SessionStore
+	GetNodeBalance(nodeID store.NodeID) (store.Balance, error)
+}
+
+// Row is a single billed session in an export, along with the client's
+// current balance.
+type Row struct {
+	ClientID store.NodeID `json:"client_id"`
+	HostID   store.NodeID `json:"host_id"`
+	Start    time.Time    `json:"start"`
+	End      time.Time    `json:"end"`
+	Duration float64      `json:"duration"` // Seconds
+	Amount   *big.Int     `json:"amount"`
+	Balance  *big.Int     `json:"balance"` // Nil if the client is no longer registered
+}
+
+// Export calls fn with a Row for each session which ended within
+// [since, until), ordered by the end time. Rows are produced as the sessions
+// are read from the store, so the export is not buffered.
+func Export(s Store, since, until time.Time, fn func(Row) error) error {
+	// Each client's balance is only loaded once per export.
+	balances := map[store.NodeID]*big.Int{}
+	return s.Sessions(since, until, func(session store.Session) error {
+		balance, ok := balances[session.ClientID]
+		if !ok {
+			b, err := s.GetNodeBalance(session.ClientID)
+			if err == nil {
+				balance = new(big.Int).Add(&b.Credit, &b.Deposit)
+			} else if err != store.ErrUnregisteredNode {
+				return err
+			}
+			balances[session.ClientID] = balance
+		}
+		return fn(Row{
+			ClientID: session.ClientID,
+			HostID:   session.HostID,
+			Start:    session.Start,
+			End:      session.End,
+			Duration: session.Duration().Seconds(),
+			Amount:   new(big.Int).Set(&session.Amount),
+			Balance:  balance,
+		})
+	})
+}
+
+var csvHeader = []string{"client_id", "host_id", "start", "end", "duration", "amount", "balance"}
+
+// WriteCSV writes the export to w as CSV with a header row. Timestamps are
+// RFC3339 and amounts are in wei.
+func WriteCSV(w io.Writer, s Store, since, until time.Time) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+	err := Export(s, since, until, func(row Row) error {
+		balance := ""
+		if row.Balance != nil {
+			balance = row.Balance.String()
+		}
+		return cw.Write([]string{
+			string(row.ClientID),
+			string(row.HostID),
+			row.Start.UTC().Format(time.RFC3339Nano),
+			row.End.UTC().Format(time.RFC3339Nano),
+			strconv.FormatFloat(row.Duration, 'f', -1, 64),
+			row.Amount.String(),
+			balance,
+		})
+	})
+	cw.Flush()
+	if err != nil {
+		return err
+	}
+	return cw.Error()
+}
+
+// WriteJSON writes the export to w as a JSON array of rows, encoding each row
+// as it is read.
+func WriteJSON(w io.Writer, s Store, since, until time.Time) error {
+	if _, err := io.WriteString(w, "["); err != nil {
+		return err
+	}
+	sep := ""
+	err := Export(s, since, until, func(row Row) error {
+		b, err := json.Marshal(row)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, sep); err != nil {
+			return err
+		}
+		sep = ","
+		_, err = w.Write(b)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "]\n")
+	return err
+}
+
+// Handler serves exports over HTTP, it's usually mounted on /export. The
+// query parameters are:
+//
+//	format: "csv" (default) or "json"
+//	since:  RFC3339 timestamp, defaults to the unix epoch
+//	until:  RFC3339 timestamp, defaults to now
+//
+// Exports include private accounting details, so Handler should only be
+// served to the operator.
+type Handler struct {
+	Store Store
+
+	// now is used for testing to override time-based behaviour
+	now func() time.Time
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "unsupported method", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.now == nil {
+		h.now = time.Now
+	}
+
+	query := r.URL.Query()
+	since, err := parseTime(query.Get("since"), time.Unix(0, 0))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid since: %s", err), http.StatusBadRequest)
+		return
+	}
+	until, err := parseTime(query.Get("until"), h.now())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid until: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	var write func(io.Writer, Store, time.Time, time.Time) error
+	switch format := query.Get("format"); format {
+	case "", "csv":
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		write = WriteCSV
+	case "json":
+		w.Header().Set("Content-Type", "application/json")
+		write = WriteJSON
+	default:
+		http.Error(w, fmt.Sprintf("unsupported format: %q", format), http.StatusBadRequest)
+		return
+	}
+
+	if err := write(w, h.Store, since, until); err != nil {
+		// Rows may have been written already, so the status can't change.
+		logger.Printf("Export failed: %s", err)
+	}
+}
+
+func parseTime(s string, fallback time.Time) (time.Time, error) {
+	if s == "" {
+		return fallback, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
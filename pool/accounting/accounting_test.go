@@ -0,0 +1,142 @@
+package accounting
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vipnode/vipnode/pool/store"
+	"github.com/vipnode/vipnode/pool/store/memory"
+)
+
+var epoch = time.Date(2019, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func fixture(t *testing.T) Store {
+	s := memory.New()
+	for _, id := range []store.NodeID{"client1", "host1", "host2"} {
+		if err := s.SetNode(store.Node{ID: id, IsHost: strings.HasPrefix(string(id), "host")}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.AddNodeBalance("client1", big.NewInt(-1500)); err != nil {
+		t.Fatal(err)
+	}
+
+	sessions := []struct {
+		client, host store.NodeID
+		start, end   time.Duration
+		amount       int64
+	}{
+		{"client1", "host1", 0, time.Minute, 1000},
+		{"client1", "host2", 0, time.Minute, 1000},
+		{"client2", "host1", 30 * time.Second, time.Minute, 500},
+		{"client1", "host1", time.Minute, time.Hour, 59000},
+	}
+	for _, tc := range sessions {
+		session := store.Session{
+			ClientID: tc.client,
+			HostID:   tc.host,
+			Start:    epoch.Add(tc.start),
+			End:      epoch.Add(tc.end),
+		}
+		session.Amount.SetInt64(tc.amount)
+		if err := s.AddSession(session); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return s
+}
+
+func TestWriteCSV(t *testing.T) {
+	s := fixture(t)
+
+	var buf bytes.Buffer
+	if err := WriteCSV(&buf, s, epoch, epoch.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	// client2 was never registered, so it has no balance. The last session
+	// ends at until, so it's excluded.
+	want := `client_id,host_id,start,end,duration,amount,balance
+client1,host1,2019-03-01T12:00:00Z,2019-03-01T12:01:00Z,60,1000,-1500
+client1,host2,2019-03-01T12:00:00Z,2019-03-01T12:01:00Z,60,1000,-1500
+client2,host1,2019-03-01T12:00:30Z,2019-03-01T12:01:00Z,30,500,
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	s := fixture(t)
+
+	var buf bytes.Buffer
+	if err := WriteJSON(&buf, s, epoch.Add(time.Minute), epoch.Add(2*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	var rows []Row
+	if err := json.Unmarshal(buf.Bytes(), &rows); err != nil {
+		t.Fatalf("invalid JSON %q: %s", buf.String(), err)
+	}
+	if len(rows) != 4 {
+		t.Fatalf("expected 4 rows, got %d", len(rows))
+	}
+	last := rows[3]
+	if last.ClientID != "client1" || last.HostID != "host1" || last.Duration != 3540 || last.Amount.Int64() != 59000 || last.Balance.Int64() != -1500 {
+		t.Errorf("wrong row: %+v", last)
+	}
+	if rows[2].Balance != nil {
+		t.Errorf("expected no balance for unregistered client: %+v", rows[2])
+	}
+
+	buf.Reset()
+	if err := WriteJSON(&buf, s, epoch.Add(2*time.Hour), epoch.Add(3*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != "[]\n" {
+		t.Errorf("expected an empty array, got: %q", got)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	h := &Handler{
+		Store: fixture(t),
+		now:   func() time.Time { return epoch.Add(2 * time.Hour) },
+	}
+
+	testcases := []struct {
+		query    string
+		code     int
+		contains string
+		rows     int
+	}{
+		{"", http.StatusOK, "client_id,host_id", 5},
+		{"?since=2019-03-01T12:30:00Z", http.StatusOK, "59000", 2},
+		{"?until=2019-03-01T12:00:00Z", http.StatusOK, "client_id,host_id", 1},
+		{"?format=json&until=2019-03-01T13:00:00Z", http.StatusOK, `"client_id":"client2"`, 1},
+		{"?format=xml", http.StatusBadRequest, "unsupported format", 1},
+		{"?since=yesterday", http.StatusBadRequest, "invalid since", 1},
+	}
+	for _, tc := range testcases {
+		req := httptest.NewRequest("GET", "/export"+tc.query, nil)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		body := rec.Body.String()
+		if rec.Code != tc.code {
+			t.Errorf("%q: got status %d; want %d: %s", tc.query, rec.Code, tc.code, body)
+			continue
+		}
+		if !strings.Contains(body, tc.contains) {
+			t.Errorf("%q: missing %q in: %s", tc.query, tc.contains, body)
+		}
+		if got := strings.Count(strings.TrimSpace(body), "\n") + 1; got != tc.rows {
+			t.Errorf("%q: got %d lines; want %d", tc.query, got, tc.rows)
+		}
+	}
+}
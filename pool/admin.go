@@ -0,0 +1,66 @@
+package pool
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/vipnode/vipnode/internal/pretty"
+	"github.com/vipnode/vipnode/pool/store"
+)
+
+// verifyAdmin is verify for admin methods, which must also be signed by one
+// of the pool's Admins.
+func (p *VipnodePool) verifyAdmin(sig string, method string, nodeID string, nonce int64, args ...interface{}) error {
+	if err := p.verify(sig, method, nodeID, nonce, args...); err != nil {
+		return err
+	}
+	if _, ok := p.Admins[store.NodeID(nodeID)]; !ok {
+		logger.Printf("Rejected %s from non-admin node: %q", method, pretty.Abbrev(nodeID))
+		return UnauthorizedError{Cause: ErrNotAdmin, Method: method}
+	}
+	return nil
+}
+
+// DisconnectClient is an admin method which force-disconnects a client from
+// the hosts that it's peered with, such as to drop an abusive client without
+// waiting for its balance to run out. The hosts are instructed to disconnect
+// it, and it stops being reachable for migrations until it requests hosts
+// again. Barring the client from coming back is up to the Authorizer.
+func (p *VipnodePool) DisconnectClient(ctx context.Context, sig string, nodeID string, nonce int64, clientID string) (err error) {
+	defer p.countError("vipnode_disconnectClient", &err)
+	if err := p.verifyAdmin(sig, "vipnode_disconnectClient", nodeID, nonce, clientID); err != nil {
+		return err
+	}
+
+	client, err := p.Store.GetNode(store.NodeID(clientID))
+	if err != nil {
+		return err
+	}
+	if client.IsHost {
+		return fmt.Errorf("node is not a client: %q", clientID)
+	}
+	peers, err := p.Store.NodePeers(client.ID)
+	if err != nil {
+		return err
+	}
+	hosts := []store.Node{}
+	for _, peer := range peers {
+		if peer.IsHost {
+			hosts = append(hosts, peer)
+		}
+	}
+	if len(hosts) == 0 {
+		return ErrNotConnected
+	}
+	if err := p.disconnectPeers(ctx, clientID, hosts); err != nil {
+		logger.Printf("Admin disconnect of client %q failed: %s", pretty.Abbrev(clientID), err)
+		return err
+	}
+
+	p.mu.Lock()
+	delete(p.remoteClients, client.ID)
+	p.mu.Unlock()
+	p.audit(AuditDisconnect, store.NodeID(nodeID), client.ID, fmt.Sprintf("by admin, %d hosts", len(hosts)))
+	logger.Printf("Admin %q disconnected client %q from %d hosts", pretty.Abbrev(nodeID), pretty.Abbrev(clientID), len(hosts))
+	return nil
+}
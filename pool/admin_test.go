@@ -0,0 +1,95 @@
+package pool
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/p2p/discv5"
+	"github.com/vipnode/vipnode/internal/keygen"
+	"github.com/vipnode/vipnode/jsonrpc2"
+	"github.com/vipnode/vipnode/pool/store"
+	"github.com/vipnode/vipnode/pool/store/memory"
+)
+
+// RecordingHost records the vipnode_disconnect instructions sent to a host.
+// It must be exported to be registered as an RPC receiver.
+type RecordingHost struct {
+	mu           sync.Mutex
+	disconnected []string
+}
+
+func (h *RecordingHost) Disconnect(ctx context.Context, nodeID string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.disconnected = append(h.disconnected, nodeID)
+	return nil
+}
+
+func TestDisconnectClient(t *testing.T) {
+	ctx := context.Background()
+	p := New(memory.New(), nil)
+	p.skipWhitelist = true
+
+	host := &RecordingHost{}
+	server, hostConn := jsonrpc2.ServePipe()
+	server.Server.Register("vipnode_", p)
+	if err := hostConn.Server.RegisterMethod("vipnode_disconnect", host, "Disconnect"); err != nil {
+		t.Fatal(err)
+	}
+	hostKey := keygen.HardcodedKeyIdx(t, 0)
+	hostID := discv5.PubkeyID(&hostKey.PublicKey).String()
+	if _, err := Remote(hostConn, hostKey).Host(ctx, HostRequest{Kind: "geth", NodeURI: "enode://" + hostID + "@127.0.0.1:30303"}); err != nil {
+		t.Fatal(err)
+	}
+
+	server2, clientConn := jsonrpc2.ServePipe()
+	server2.Server.Register("vipnode_", p)
+	clientKey := keygen.HardcodedKeyIdx(t, 1)
+	clientID := discv5.PubkeyID(&clientKey.PublicKey).String()
+	client := Remote(clientConn, clientKey)
+	if _, err := client.Client(ctx, ClientRequest{Kind: "geth"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Update(ctx, UpdateRequest{Peers: []string{hostID}}); err != nil {
+		t.Fatal(err)
+	}
+
+	server3, adminConn := jsonrpc2.ServePipe()
+	server3.Server.Register("vipnode_", p)
+	adminKey := keygen.HardcodedKeyIdx(t, 2)
+	admin := Remote(adminConn, adminKey)
+
+	// Only admins may disconnect clients.
+	if err := admin.DisconnectClient(ctx, clientID); err == nil {
+		t.Fatal("disconnect from a non-admin was accepted")
+	}
+	if err := client.DisconnectClient(ctx, clientID); err == nil {
+		t.Fatal("disconnect from the client itself was accepted")
+	}
+	if len(host.disconnected) != 0 {
+		t.Fatalf("host was instructed to disconnect without authorization: %v", host.disconnected)
+	}
+
+	p.Admins = NewAllowList(store.NodeID(discv5.PubkeyID(&adminKey.PublicKey).String()))
+	if err := admin.DisconnectClient(ctx, clientID); err != nil {
+		t.Fatal(err)
+	}
+	host.mu.Lock()
+	disconnected := host.disconnected
+	host.mu.Unlock()
+	if len(disconnected) != 1 || disconnected[0] != clientID {
+		t.Errorf("host got wrong disconnect instructions: %v", disconnected)
+	}
+	p.mu.Lock()
+	_, ok := p.remoteClients[store.NodeID(clientID)]
+	p.mu.Unlock()
+	if ok {
+		t.Error("disconnected client is still reachable for migrations")
+	}
+
+	// Hosts can't be disconnected as clients.
+	if err := admin.DisconnectClient(ctx, hostID); err == nil {
+		t.Error("disconnecting a host was accepted")
+	}
+}
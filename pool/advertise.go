@@ -0,0 +1,98 @@
+package pool
+
+import (
+	"net"
+	"net/url"
+
+	"github.com/vipnode/vipnode/jsonrpc2"
+	"github.com/vipnode/vipnode/pool/store"
+)
+
+// privateNetworks are the address ranges of private networks. A host and a
+// client that both connect to the pool from the same range share a private
+// network with the pool.
+var privateNetworks = parseCIDRs(
+	"10.0.0.0/8",
+	"172.16.0.0/12",
+	"192.168.0.0/16",
+	"100.64.0.0/10", // Carrier-grade NAT
+	"127.0.0.0/8",
+	"169.254.0.0/16",
+	"::1/128",
+	"fc00::/7",
+	"fe80::/10",
+)
+
+func parseCIDRs(cidrs ...string) []*net.IPNet {
+	r := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		r = append(r, network)
+	}
+	return r
+}
+
+// samePrivateNetwork returns whether a and b are in the same private network
+// range.
+func samePrivateNetwork(a, b net.IP) bool {
+	for _, network := range privateNetworks {
+		if network.Contains(a) && network.Contains(b) {
+			return true
+		}
+	}
+	return false
+}
+
+// remoteHostname returns the IP address of the service's end of the
+// connection, or an empty string if it's unknown.
+func remoteHostname(service jsonrpc2.Service) string {
+	withAddr, ok := service.(interface{ RemoteAddr() string })
+	if !ok {
+		return ""
+	}
+	return (&url.URL{Host: withAddr.RemoteAddr()}).Hostname()
+}
+
+// onHostNetwork returns whether a client connecting to the pool from
+// clientIP is on the private network of a host connecting from hostIP. That's
+// the case when both are observed from the same public address, such as from
+// behind the same NAT, or from the same private network range.
+func onHostNetwork(hostIP, clientIP string) bool {
+	host, client := net.ParseIP(hostIP), net.ParseIP(clientIP)
+	if host == nil || client == nil {
+		return false
+	}
+	return host.Equal(client) || samePrivateNetwork(host, client)
+}
+
+// advertiseHost returns the host connecting from hostIP as it's handed out to
+// a client connecting from clientIP: with its internal enode as the URI if the
+// client is on the host's network. The internal enode is left out otherwise,
+// so that private addresses aren't leaked to clients elsewhere.
+func advertiseHost(host store.Node, hostIP, clientIP string) store.Node {
+	if host.InternalURI != "" && onHostNetwork(hostIP, clientIP) {
+		host.URI = host.InternalURI
+	}
+	host.InternalURI = ""
+	return host
+}
+
+// advertiseHosts is advertiseHost for each of the hosts, using the addresses
+// they're connected to the pool from. Hosts without a connection to this pool
+// are advertised without their internal enode.
+func (p *VipnodePool) advertiseHosts(hosts []store.Node, clientIP string) []store.Node {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	r := make([]store.Node, 0, len(hosts))
+	for _, host := range hosts {
+		hostIP := ""
+		if service, ok := p.remoteHosts[host.ID]; ok {
+			hostIP = remoteHostname(service)
+		}
+		r = append(r, advertiseHost(host, hostIP, clientIP))
+	}
+	return r
+}
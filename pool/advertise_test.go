@@ -0,0 +1,127 @@
+package pool
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/p2p/discv5"
+	"github.com/vipnode/vipnode/internal/keygen"
+	"github.com/vipnode/vipnode/jsonrpc2"
+	"github.com/vipnode/vipnode/pool/store"
+	"github.com/vipnode/vipnode/pool/store/memory"
+)
+
+// addrCodec overrides the remote address of a codec, to simulate agents
+// connecting from different networks.
+type addrCodec struct {
+	jsonrpc2.Codec
+	addr string
+}
+
+func (c addrCodec) RemoteAddr() string { return c.addr }
+
+// servePipeFrom is jsonrpc2.ServePipe with the client connecting from addr.
+func servePipeFrom(addr string) (*jsonrpc2.Remote, *jsonrpc2.Remote) {
+	c1, c2 := net.Pipe()
+	client := &jsonrpc2.Remote{
+		Codec:  jsonrpc2.IOCodec(c1),
+		Client: &jsonrpc2.Client{},
+		Server: &jsonrpc2.Server{},
+	}
+	server := &jsonrpc2.Remote{
+		Codec:  addrCodec{jsonrpc2.IOCodec(c2), addr},
+		Client: &jsonrpc2.Client{},
+		Server: &jsonrpc2.Server{},
+	}
+	go server.Serve()
+	go client.Serve()
+	return server, client
+}
+
+func TestAdvertiseHost(t *testing.T) {
+	host := store.Node{
+		ID:          "abc",
+		URI:         "enode://abc@203.0.113.5:30303",
+		InternalURI: "enode://abc@192.168.1.10:30303",
+	}
+	testcases := []struct {
+		hostIP   string
+		clientIP string
+		want     string
+	}{
+		{"203.0.113.5", "203.0.113.5", host.InternalURI}, // Behind the host's NAT
+		{"192.168.1.10", "192.168.1.20", host.InternalURI},
+		{"10.0.0.5", "10.1.2.3", host.InternalURI},
+		{"127.0.0.1", "127.0.0.1", host.InternalURI},
+		{"fd00::5", "fd00::1", host.InternalURI},
+		{"203.0.113.5", "192.168.1.20", host.URI}, // On the pool's network, not the host's
+		{"192.168.1.10", "10.1.2.3", host.URI},
+		{"192.168.1.10", "203.0.113.5", host.URI},
+		{"203.0.113.5", "198.51.100.7", host.URI},
+		{"203.0.113.5", "2001:db8::1", host.URI},
+		{"", "192.168.1.20", host.URI}, // Host isn't connected to this pool
+		{"203.0.113.5", "", host.URI},
+	}
+	for _, tc := range testcases {
+		got := advertiseHost(host, tc.hostIP, tc.clientIP)
+		if got.URI != tc.want {
+			t.Errorf("host %q, client %q: got %q; want %q", tc.hostIP, tc.clientIP, got.URI, tc.want)
+		}
+		if got.InternalURI != "" {
+			t.Errorf("host %q, client %q: internal URI was handed out: %q", tc.hostIP, tc.clientIP, got.InternalURI)
+		}
+	}
+
+	// Hosts without an internal enode are always advertised as is.
+	public := store.Node{ID: "def", URI: "enode://def@198.51.100.8:30303"}
+	if got := advertiseHost(public, "192.168.1.10", "192.168.1.20"); got.URI != public.URI {
+		t.Errorf("got %q; want %q", got.URI, public.URI)
+	}
+}
+
+func TestClientInternalEnode(t *testing.T) {
+	pool := New(memory.New(), nil)
+	pool.skipWhitelist = true
+
+	server, host := servePipeFrom("203.0.113.5:41000")
+	server.Server.Register("vipnode_", pool)
+	hostKey := keygen.HardcodedKeyIdx(t, 0)
+	hostID := discv5.PubkeyID(&hostKey.PublicKey).String()
+	external := "enode://" + hostID + "@203.0.113.5:30303"
+	internal := "enode://" + hostID + "@192.168.1.10:30303"
+	req := HostRequest{Kind: "geth", InternalNodeURI: internal}
+	if _, err := Remote(host, hostKey).Host(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+
+	testcases := []struct {
+		name string
+		addr string
+		want string
+	}{
+		{"nat", "203.0.113.5:52000", internal},
+		{"lan", "192.168.1.20:52000", external},
+		{"wan", "198.51.100.7:52000", external},
+	}
+	for i, tc := range testcases {
+		server, client := servePipeFrom(tc.addr)
+		server.Server.Register("vipnode_", pool)
+		resp, err := Remote(client, keygen.HardcodedKeyIdx(t, 1+i%2)).Client(context.Background(), ClientRequest{Kind: "geth"})
+		if err != nil {
+			t.Fatalf("%s: %s", tc.name, err)
+		}
+		if len(resp.Hosts) != 1 {
+			t.Fatalf("%s: got %d hosts; want 1", tc.name, len(resp.Hosts))
+		}
+		if got := resp.Hosts[0]; got.URI != tc.want || got.InternalURI != "" {
+			t.Errorf("%s client: got host %q (internal %q); want %q", tc.name, got.URI, got.InternalURI, tc.want)
+		}
+	}
+
+	// The internal enode must have an address.
+	req.InternalNodeURI = "enode://" + hostID + "@[::]:30303"
+	if _, err := Remote(host, hostKey).Host(context.Background(), req); err == nil {
+		t.Error("expected error for an internal enode without an address")
+	}
+}
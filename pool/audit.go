@@ -0,0 +1,120 @@
+package pool
+
+import (
+	"math/big"
+	"time"
+
+	"github.com/vipnode/vipnode/internal/pretty"
+	"github.com/vipnode/vipnode/pool/store"
+)
+
+// AuditAction is the kind of pool state mutation recorded in an AuditEntry.
+type AuditAction string
+
+const (
+	// AuditRegister is a host or client registering, with its kind as the
+	// detail.
+	AuditRegister AuditAction = "register"
+	// AuditReject is a node being refused by the Authorizer, such as when
+	// it's banned.
+	AuditReject AuditAction = "reject"
+	// AuditAssign is a host being assigned to a client.
+	AuditAssign AuditAction = "assign"
+	// AuditBalance is a node's balance changing after an update.
+	AuditBalance AuditAction = "balance"
+	// AuditDisconnect is a node's peers being disconnected by the pool, such
+	// as for a low balance or by an admin.
+	AuditDisconnect AuditAction = "disconnect"
+	// AuditMigrate is a client being moved from one host to another.
+	AuditMigrate AuditAction = "migrate"
+)
+
+// AuditEntry is a record of a mutation of the pool's state.
+type AuditEntry struct {
+	// Seq is the position of the entry in the log, assigned when it's
+	// appended.
+	Seq    uint64      `json:"seq"`
+	Time   time.Time   `json:"time"`
+	Action AuditAction `json:"action"`
+	// Actor is the node whose request caused the mutation.
+	Actor store.NodeID `json:"actor"`
+	// NodeID is the other node affected by the mutation, if any, such as the
+	// host assigned to the client.
+	NodeID store.NodeID `json:"node_id,omitempty"`
+	Detail string       `json:"detail,omitempty"`
+}
+
+// AuditQuery selects entries from an AuditLog. Zero fields match everything.
+type AuditQuery struct {
+	// Since and Until bound the entry times, inclusively.
+	Since time.Time
+	Until time.Time
+	// NodeID matches entries where the node is the actor or affected node.
+	NodeID store.NodeID
+}
+
+// Match returns whether the entry is selected by the query.
+func (q AuditQuery) Match(entry AuditEntry) bool {
+	if !q.Since.IsZero() && entry.Time.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && entry.Time.After(q.Until) {
+		return false
+	}
+	if q.NodeID != "" && entry.Actor != q.NodeID && entry.NodeID != q.NodeID {
+		return false
+	}
+	return true
+}
+
+// AuditLog is an append-only record of pool state mutations, for resolving
+// disputes and debugging. Entries must be stored durably and in the order
+// they're appended. It should be goroutine-safe.
+type AuditLog interface {
+	// Append assigns the entry the next Seq and stores it.
+	Append(entry AuditEntry) error
+	// Query returns the entries selected by q, in order.
+	Query(q AuditQuery) ([]AuditEntry, error)
+}
+
+type noAuditLog struct{}
+
+func (noAuditLog) Append(AuditEntry) error                { return nil }
+func (noAuditLog) Query(AuditQuery) ([]AuditEntry, error) { return nil, nil }
+
+// auditing returns whether the pool has an AuditLog, so that lookups which
+// are only needed for its entries can be skipped.
+func (p *VipnodePool) auditing() bool {
+	_, ok := p.AuditLog.(noAuditLog)
+	return !ok
+}
+
+// audit appends an entry for a mutation that already happened, so failing to
+// record it is logged rather than failing the request.
+func (p *VipnodePool) audit(action AuditAction, actor store.NodeID, nodeID store.NodeID, detail string) {
+	entry := AuditEntry{
+		Time:   time.Now(),
+		Action: action,
+		Actor:  actor,
+		NodeID: nodeID,
+		Detail: detail,
+	}
+	if err := p.AuditLog.Append(entry); err != nil {
+		logger.Printf("Failed to append %s of %q to the audit log: %s", action, pretty.Abbrev(string(actor)), err)
+	}
+}
+
+// auditAssigned records each of the hosts assigned to the client.
+func (p *VipnodePool) auditAssigned(client store.Node, hosts []store.Node) {
+	for _, host := range hosts {
+		p.audit(AuditAssign, client.ID, host.ID, "")
+	}
+}
+
+// balanceChange returns the difference in the total of credit and deposit
+// from before to after.
+func balanceChange(before, after store.Balance) *big.Int {
+	change := new(big.Int).Add(&after.Credit, &after.Deposit)
+	change.Sub(change, &before.Credit)
+	return change.Sub(change, &before.Deposit)
+}
@@ -0,0 +1,100 @@
+// Package audit implements a file-backed pool.AuditLog, storing one JSON
+// entry per line so that the log can be replayed with standard tools.
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/vipnode/vipnode/pool"
+)
+
+var _ pool.AuditLog = &FileLog{}
+
+// Open opens the audit log at path for appending, creating it if necessary.
+// Sequence numbers continue from the last entry in an existing log.
+func Open(path string) (*FileLog, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	l := &FileLog{f: f}
+	if err := l.scan(func(entry pool.AuditEntry) {
+		l.seq = entry.Seq
+	}); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// FileLog is an append-only pool.AuditLog stored in a file. Each entry is
+// synced to disk before Append returns.
+type FileLog struct {
+	mu  sync.Mutex
+	f   *os.File
+	seq uint64
+}
+
+// Append assigns the entry the next sequence number and writes it to the
+// log.
+func (l *FileLog) Append(entry pool.AuditEntry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry.Seq = l.seq + 1
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if _, err := l.f.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	if err := l.f.Sync(); err != nil {
+		return err
+	}
+	l.seq = entry.Seq
+	return nil
+}
+
+// Query reads the entries selected by q from the log, in order.
+func (l *FileLog) Query(q pool.AuditQuery) ([]pool.AuditEntry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var r []pool.AuditEntry
+	err := l.scan(func(entry pool.AuditEntry) {
+		if q.Match(entry) {
+			r = append(r, entry)
+		}
+	})
+	return r, err
+}
+
+// Close closes the log file.
+func (l *FileLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.f.Close()
+}
+
+// scan calls fn with each entry of the log, must hold the l.mu lock once
+// opened.
+func (l *FileLog) scan(fn func(entry pool.AuditEntry)) error {
+	if _, err := l.f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	scanner := bufio.NewScanner(l.f)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		var entry pool.AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return fmt.Errorf("audit log line %d: %s", lineNum, err)
+		}
+		fn(entry)
+	}
+	return scanner.Err()
+}
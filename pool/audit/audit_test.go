@@ -0,0 +1,136 @@
+package audit
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vipnode/vipnode/pool"
+	"github.com/vipnode/vipnode/pool/store"
+)
+
+func TestFileLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vipnode-audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.log")
+
+	l, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	entries := []pool.AuditEntry{
+		{Time: base, Action: pool.AuditRegister, Actor: "host", Detail: "host"},
+		{Time: base.Add(time.Minute), Action: pool.AuditRegister, Actor: "client", Detail: "client"},
+		{Time: base.Add(2 * time.Minute), Action: pool.AuditAssign, Actor: "client", NodeID: "host"},
+	}
+	for _, entry := range entries {
+		if err := l.Append(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reopened logs keep their entries and continue the sequence.
+	l, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if err := l.Append(pool.AuditEntry{Time: base.Add(3 * time.Minute), Action: pool.AuditBalance, Actor: "client"}); err != nil {
+		t.Fatal(err)
+	}
+
+	all, err := l.Query(pool.AuditQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 4 {
+		t.Fatalf("got %d entries; want 4", len(all))
+	}
+	for i, entry := range all {
+		if entry.Seq != uint64(i+1) {
+			t.Errorf("entry %d: got seq %d", i, entry.Seq)
+		}
+	}
+	if !all[2].Time.Equal(entries[2].Time) || all[2].Action != pool.AuditAssign || all[2].NodeID != "host" {
+		t.Errorf("entry was not preserved: %v", all[2])
+	}
+
+	for _, tc := range []struct {
+		query pool.AuditQuery
+		want  []uint64
+	}{
+		{pool.AuditQuery{NodeID: "host"}, []uint64{1, 3}},
+		{pool.AuditQuery{NodeID: "client"}, []uint64{2, 3, 4}},
+		{pool.AuditQuery{Since: base.Add(time.Minute), Until: base.Add(2 * time.Minute)}, []uint64{2, 3}},
+		{pool.AuditQuery{Since: base.Add(2 * time.Minute), NodeID: "client"}, []uint64{3, 4}},
+		{pool.AuditQuery{NodeID: store.NodeID("other")}, nil},
+	} {
+		got, err := l.Query(tc.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var seqs []uint64
+		for _, entry := range got {
+			seqs = append(seqs, entry.Seq)
+		}
+		if len(seqs) != len(tc.want) {
+			t.Errorf("%+v: got %v; want %v", tc.query, seqs, tc.want)
+			continue
+		}
+		for i := range seqs {
+			if seqs[i] != tc.want[i] {
+				t.Errorf("%+v: got %v; want %v", tc.query, seqs, tc.want)
+				break
+			}
+		}
+	}
+}
+
+func TestFileLogConcurrent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vipnode-audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	l, err := Open(filepath.Join(dir, "audit.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := l.Append(pool.AuditEntry{Time: time.Now(), Action: pool.AuditBalance, Actor: "client"}); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	all, err := l.Query(pool.AuditQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 20 {
+		t.Fatalf("got %d entries; want 20", len(all))
+	}
+	for i, entry := range all {
+		if entry.Seq != uint64(i+1) {
+			t.Errorf("entry %d: got seq %d, entries are out of order", i, entry.Seq)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/p2p/discv5"
+	"github.com/vipnode/vipnode/internal/keygen"
+	"github.com/vipnode/vipnode/jsonrpc2"
+	"github.com/vipnode/vipnode/pool/store"
+	"github.com/vipnode/vipnode/pool/store/memory"
+)
+
+type memAuditLog struct {
+	mu      sync.Mutex
+	entries []AuditEntry
+}
+
+func (l *memAuditLog) Append(entry AuditEntry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	entry.Seq = uint64(len(l.entries) + 1)
+	l.entries = append(l.entries, entry)
+	return nil
+}
+
+func (l *memAuditLog) Query(q AuditQuery) ([]AuditEntry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var r []AuditEntry
+	for _, entry := range l.entries {
+		if q.Match(entry) {
+			r = append(r, entry)
+		}
+	}
+	return r, nil
+}
+
+// creditManager credits nodes on every update.
+type creditManager struct {
+	store store.BalanceStore
+}
+
+func (m creditManager) OnClient(node store.Node) error { return nil }
+
+func (m creditManager) OnUpdate(node store.Node, peers []store.Node) (store.Balance, error) {
+	if err := m.store.AddNodeBalance(node.ID, big.NewInt(1000)); err != nil {
+		return store.Balance{}, err
+	}
+	return m.store.GetNodeBalance(node.ID)
+}
+
+func TestPoolAudit(t *testing.T) {
+	ctx := context.Background()
+	db := memory.New()
+	auditLog := &memAuditLog{}
+	pool := New(db, creditManager{db})
+	pool.AuditLog = auditLog
+	pool.skipWhitelist = true
+
+	hostKey := keygen.HardcodedKeyIdx(t, 0)
+	clientKey := keygen.HardcodedKeyIdx(t, 1)
+	bannedKey := keygen.HardcodedKeyIdx(t, 2)
+	hostID := store.NodeID(discv5.PubkeyID(&hostKey.PublicKey).String())
+	clientID := store.NodeID(discv5.PubkeyID(&clientKey.PublicKey).String())
+	bannedID := store.NodeID(discv5.PubkeyID(&bannedKey.PublicKey).String())
+	pool.Authorizer = AuthorizerFunc(func(node store.Node) error {
+		if node.ID == bannedID {
+			return errors.New("banned")
+		}
+		return nil
+	})
+
+	remote := func(key int) *RemotePool {
+		server, client := jsonrpc2.ServePipe()
+		server.Server.Register("vipnode_", pool)
+		return Remote(client, keygen.HardcodedKeyIdx(t, key))
+	}
+	remoteHost, remoteClient, remoteBanned := remote(0), remote(1), remote(2)
+
+	if _, err := remoteHost.Host(ctx, HostRequest{Kind: "geth", NodeURI: "enode://" + string(hostID) + "@127.0.0.1:30303"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := remoteClient.Client(ctx, ClientRequest{Kind: "geth"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := remoteClient.Update(ctx, UpdateRequest{Peers: []string{string(hostID)}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := remoteBanned.Client(ctx, ClientRequest{Kind: "geth"}); err == nil {
+		t.Fatal("expected banned client to be rejected")
+	}
+
+	entries, err := auditLog.Query(AuditQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		action AuditAction
+		actor  store.NodeID
+		nodeID store.NodeID
+	}{
+		{AuditRegister, hostID, ""},
+		{AuditRegister, clientID, ""},
+		{AuditAssign, clientID, hostID},
+		{AuditBalance, clientID, ""},
+		{AuditReject, bannedID, ""},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("got %d entries; want %d: %v", len(entries), len(want), entries)
+	}
+	for i, entry := range entries {
+		if entry.Seq != uint64(i+1) {
+			t.Errorf("entry %d: got seq %d", i, entry.Seq)
+		}
+		if i > 0 && entry.Time.Before(entries[i-1].Time) {
+			t.Errorf("entry %d: time %s is before the previous entry", i, entry.Time)
+		}
+		if entry.Action != want[i].action || entry.Actor != want[i].actor || entry.NodeID != want[i].nodeID {
+			t.Errorf("entry %d: got %s by %q on %q; want %s by %q on %q", i, entry.Action, entry.Actor, entry.NodeID, want[i].action, want[i].actor, want[i].nodeID)
+		}
+	}
+
+	// The host is the actor or affected node of its registration and the
+	// assignment.
+	hostEntries, err := auditLog.Query(AuditQuery{NodeID: hostID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hostEntries) != 2 || hostEntries[0].Seq != 1 || hostEntries[1].Seq != 3 {
+		t.Errorf("unexpected host entries: %v", hostEntries)
+	}
+
+	since := entries[3].Time
+	recent, err := auditLog.Query(AuditQuery{Since: since, NodeID: clientID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range recent {
+		if entry.Time.Before(since) || entry.Seq < 3 {
+			t.Errorf("unexpected entry since %s: %v", since, entry)
+		}
+	}
+	if len(recent) == 0 || recent[len(recent)-1].Action != AuditBalance {
+		t.Errorf("expected the balance change since %s, got: %v", since, recent)
+	}
+}
+
+// balanceReadCounter counts the balance reads from its store.
+type balanceReadCounter struct {
+	store.Store
+	mu    sync.Mutex
+	reads int
+}
+
+func (s *balanceReadCounter) GetNodeBalance(nodeID store.NodeID) (store.Balance, error) {
+	s.mu.Lock()
+	s.reads++
+	s.mu.Unlock()
+	return s.Store.GetNodeBalance(nodeID)
+}
+
+func TestUpdateWithoutAuditLog(t *testing.T) {
+	ctx := context.Background()
+	db := &balanceReadCounter{Store: memory.New()}
+	pool := New(db, creditManager{db.Store})
+	pool.skipWhitelist = true
+
+	remote := func(key int) *RemotePool {
+		server, client := jsonrpc2.ServePipe()
+		server.Server.Register("vipnode_", pool)
+		return Remote(client, keygen.HardcodedKeyIdx(t, key))
+	}
+	remoteHost, remoteClient := remote(0), remote(1)
+	hostKey := keygen.HardcodedKeyIdx(t, 0)
+	hostID := discv5.PubkeyID(&hostKey.PublicKey).String()
+	if _, err := remoteHost.Host(ctx, HostRequest{Kind: "geth", NodeURI: "enode://" + hostID + "@127.0.0.1:30303"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := remoteClient.Client(ctx, ClientRequest{Kind: "geth"}); err != nil {
+		t.Fatal(err)
+	}
+
+	db.mu.Lock()
+	db.reads = 0
+	db.mu.Unlock()
+	if _, err := remoteClient.Update(ctx, UpdateRequest{Peers: []string{hostID}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := remoteHost.Update(ctx, UpdateRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.reads != 0 {
+		t.Errorf("got %d balance reads from the pool store without an audit log; want 0", db.reads)
+	}
+}
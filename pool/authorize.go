@@ -0,0 +1,41 @@
+package pool
+
+import "github.com/vipnode/vipnode/pool/store"
+
+// Authorizer decides whether a node may register with the pool, such as for
+// running an invite-only pool. It should be goroutine-safe.
+type Authorizer interface {
+	// Authorize is called before a host or client is registered, with the
+	// node it would be registered as. A non-nil error rejects the node, and
+	// its message is returned to the node as the reason.
+	Authorize(node store.Node) error
+}
+
+// AllowAll is an Authorizer which accepts every node.
+type AllowAll struct{}
+
+func (AllowAll) Authorize(store.Node) error { return nil }
+
+// AuthorizerFunc adapts a function to an Authorizer.
+type AuthorizerFunc func(node store.Node) error
+
+func (fn AuthorizerFunc) Authorize(node store.Node) error { return fn(node) }
+
+// AllowList is an Authorizer which only accepts nodes with the given IDs.
+type AllowList map[store.NodeID]struct{}
+
+// NewAllowList returns an AllowList of the given node IDs.
+func NewAllowList(nodeIDs ...store.NodeID) AllowList {
+	l := make(AllowList, len(nodeIDs))
+	for _, id := range nodeIDs {
+		l[id] = struct{}{}
+	}
+	return l
+}
+
+func (l AllowList) Authorize(node store.Node) error {
+	if _, ok := l[node.ID]; !ok {
+		return ErrNotAllowed
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/p2p/discv5"
+	"github.com/vipnode/vipnode/internal/keygen"
+	"github.com/vipnode/vipnode/jsonrpc2"
+	"github.com/vipnode/vipnode/pool/store"
+	"github.com/vipnode/vipnode/pool/store/memory"
+)
+
+func TestAuthorizer(t *testing.T) {
+	hostKey := keygen.HardcodedKeyIdx(t, 0)
+	hostID := discv5.PubkeyID(&hostKey.PublicKey).String()
+	allowedKey := keygen.HardcodedKeyIdx(t, 1)
+	allowedID := discv5.PubkeyID(&allowedKey.PublicKey).String()
+	rejectedKey := keygen.HardcodedKeyIdx(t, 2)
+	rejectedID := discv5.PubkeyID(&rejectedKey.PublicKey).String()
+
+	pool := New(memory.New(), nil)
+	pool.skipWhitelist = true
+	pool.Authorizer = NewAllowList(store.NodeID(hostID), store.NodeID(allowedID))
+
+	connect := func(key int) *RemotePool {
+		server, client := jsonrpc2.ServePipe()
+		server.Server.Register("vipnode_", pool)
+		return Remote(client, keygen.HardcodedKeyIdx(t, key))
+	}
+
+	if _, err := connect(0).Host(context.Background(), HostRequest{Kind: "geth", NodeURI: "enode://" + hostID + "@127.0.0.1:30303"}); err != nil {
+		t.Fatalf("expected allowed host to register: %s", err)
+	}
+	if _, err := connect(1).Client(context.Background(), ClientRequest{Kind: "geth"}); err != nil {
+		t.Errorf("expected allowed client to register: %s", err)
+	}
+
+	_, err := connect(2).Client(context.Background(), ClientRequest{Kind: "geth"})
+	if err == nil || !strings.Contains(err.Error(), ErrNotAllowed.Error()) {
+		t.Errorf("expected rejected client to get the reason, got: %v", err)
+	}
+	if _, err := pool.Store.GetNode(store.NodeID(rejectedID)); err != store.ErrUnregisteredNode {
+		t.Errorf("rejected client should not be registered: %v", err)
+	}
+
+	_, err = connect(2).Host(context.Background(), HostRequest{Kind: "geth", NodeURI: "enode://" + rejectedID + "@127.0.0.1:30303"})
+	if err == nil || !strings.Contains(err.Error(), ErrNotAllowed.Error()) {
+		t.Errorf("expected rejected host to get the reason, got: %v", err)
+	}
+}
+
+func TestAuthorizerFunc(t *testing.T) {
+	pool := New(memory.New(), nil)
+	reason := errors.New("hosting requires a paid plan")
+	pool.Authorizer = AuthorizerFunc(func(node store.Node) error {
+		if node.IsHost {
+			return reason
+		}
+		return nil
+	})
+
+	err := pool.authorize("vipnode_host", store.Node{ID: "abc", IsHost: true})
+	if err, ok := err.(UnauthorizedError); !ok || err.Cause != reason {
+		t.Errorf("expected UnauthorizedError, got: %v", err)
+	}
+	if err := pool.authorize("vipnode_client", store.Node{ID: "abc"}); err != nil {
+		t.Errorf("expected client to be authorized: %s", err)
+	}
+}
@@ -0,0 +1,88 @@
+package balance
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/vipnode/ether"
+	"github.com/vipnode/vipnode/pool/store"
+)
+
+// Grace is how long, and how far below the minimum balance, a client keeps
+// its peers after its balance runs out, before it's disconnected for
+// nonpayment. The grace is exhausted when either limit is reached. The zero
+// value has no grace, so clients are disconnected as soon as their balance
+// falls below the minimum.
+type Grace struct {
+	// Period is how long a client keeps its peers after its balance fell
+	// below the minimum. (No time limit if 0, as long as Allowance is set)
+	Period time.Duration
+	// Allowance is how far below the minimum the client's balance can go.
+	// (No limit if nil, as long as Period is set)
+	Allowance *big.Int
+}
+
+// Enabled returns whether clients get any grace.
+func (g Grace) Enabled() bool {
+	return g.Period > 0 || (g.Allowance != nil && g.Allowance.Sign() > 0)
+}
+
+// Remaining returns the grace left for a client whose balance is deficit
+// below the minimum since it fell below it at since. It's false if the grace
+// is exhausted.
+func (g Grace) Remaining(deficit *big.Int, since time.Time, now time.Time) (GraceRemaining, bool) {
+	if !g.Enabled() {
+		return GraceRemaining{}, false
+	}
+	var r GraceRemaining
+	if g.Period > 0 {
+		until := since.Add(g.Period)
+		if !now.Before(until) {
+			return GraceRemaining{}, false
+		}
+		r.Until = &until
+	}
+	if g.Allowance != nil && g.Allowance.Sign() > 0 {
+		allowance := new(big.Int).Sub(g.Allowance, deficit)
+		if allowance.Sign() < 0 {
+			return GraceRemaining{}, false
+		}
+		r.Allowance = allowance
+	}
+	return r, true
+}
+
+// GraceRemaining is what's left of a client's grace while its balance is
+// below the minimum.
+type GraceRemaining struct {
+	// Until is when the grace period ends, or nil if it's not limited by
+	// time.
+	Until *time.Time `json:"until,omitempty"`
+	// Allowance is how much further the balance can drop, or nil if it's not
+	// limited.
+	Allowance *big.Int `json:"allowance,omitempty"`
+}
+
+func (r GraceRemaining) String() string {
+	var parts []string
+	if r.Until != nil {
+		parts = append(parts, fmt.Sprintf("until %s", r.Until.Format(time.RFC3339)))
+	}
+	if r.Allowance != nil {
+		parts = append(parts, fmt.Sprintf("%s more", ether.Print(r.Allowance)))
+	}
+	if len(parts) == 0 {
+		return "unlimited"
+	}
+	return strings.Join(parts, " or ")
+}
+
+// GraceReporter is implemented by Managers with a Grace policy, to tell
+// clients how much grace they have left.
+type GraceReporter interface {
+	// GraceRemaining returns the grace left for a node with balance, or nil
+	// if it's not in its grace.
+	GraceRemaining(node store.Node, balance store.Balance) *GraceRemaining
+}
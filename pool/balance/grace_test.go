@@ -0,0 +1,182 @@
+package balance
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/vipnode/vipnode/pool/store"
+	"github.com/vipnode/vipnode/pool/store/memory"
+)
+
+func TestGraceRemaining(t *testing.T) {
+	since := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	testcases := []struct {
+		name          string
+		grace         Grace
+		deficit       int64
+		elapsed       time.Duration
+		ok            bool
+		wantUntil     bool
+		wantAllowance int64
+	}{
+		{"none", Grace{}, 0, 0, false, false, 0},
+		{"within period", Grace{Period: time.Minute}, 1000, 30 * time.Second, true, true, 0},
+		{"period over", Grace{Period: time.Minute}, 1000, time.Minute, false, false, 0},
+		{"within allowance", Grace{Allowance: big.NewInt(1500)}, 1000, time.Hour, true, false, 500},
+		{"allowance used up", Grace{Allowance: big.NewInt(1500)}, 1500, 0, true, false, 0},
+		{"allowance exceeded", Grace{Allowance: big.NewInt(1500)}, 1501, 0, false, false, 0},
+		{"both", Grace{Period: time.Minute, Allowance: big.NewInt(1500)}, 1000, 30 * time.Second, true, true, 500},
+		{"both, period over", Grace{Period: time.Minute, Allowance: big.NewInt(1500)}, 1000, 2 * time.Minute, false, false, 0},
+	}
+	for _, tc := range testcases {
+		r, ok := tc.grace.Remaining(big.NewInt(tc.deficit), since, since.Add(tc.elapsed))
+		if ok != tc.ok {
+			t.Errorf("%s: got ok %t; want %t", tc.name, ok, tc.ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if (r.Until != nil) != tc.wantUntil || (r.Until != nil && !r.Until.Equal(since.Add(tc.grace.Period))) {
+			t.Errorf("%s: wrong until: %v", tc.name, r.Until)
+		}
+		if tc.grace.Allowance != nil && (r.Allowance == nil || r.Allowance.Int64() != tc.wantAllowance) {
+			t.Errorf("%s: got allowance %v; want %d", tc.name, r.Allowance, tc.wantAllowance)
+		}
+	}
+}
+
+func TestPerIntervalGrace(t *testing.T) {
+	start := time.Now()
+	now := start
+	host := store.Node{ID: "host", IsHost: true}
+	client := store.Node{ID: "client", LastSeen: now}
+
+	setup := func(grace Grace) *payPerInterval {
+		t.Helper()
+		storeDriver := memory.New()
+		for _, node := range []store.Node{host, client} {
+			if err := storeDriver.SetNode(node); err != nil {
+				t.Fatal(err)
+			}
+		}
+		// Enough for 3 minutes with one host.
+		if err := storeDriver.AddNodeBalance(client.ID, big.NewInt(3000)); err != nil {
+			t.Fatal(err)
+		}
+		return &payPerInterval{
+			Store:             storeDriver,
+			Interval:          time.Minute,
+			CreditPerInterval: *big.NewInt(1000),
+			MinBalance:        new(big.Int),
+			Grace:             grace,
+			now:               func() time.Time { return now },
+		}
+	}
+	// update bills the client for the minute since its last update.
+	update := func(b *payPerInterval) (store.Balance, error) {
+		client.LastSeen = now
+		now = now.Add(time.Minute)
+		return b.OnUpdate(client, []store.Node{host})
+	}
+
+	// Without grace, the client is disconnected once its balance falls
+	// below the minimum, but not when it hits it.
+	b := setup(Grace{})
+	for i := 0; i < 3; i++ {
+		if _, err := update(b); err != nil {
+			t.Fatalf("minute %d: %s", i+1, err)
+		}
+	}
+	if _, err := update(b); err == nil {
+		t.Error("expected a low balance error below the minimum without grace")
+	} else if _, ok := err.(LowBalanceError); !ok {
+		t.Errorf("expected LowBalanceError, got: %v", err)
+	}
+
+	// With a grace period, the client keeps its peers until it runs out.
+	now = start
+	client.LastSeen = now
+	b = setup(Grace{Period: 2 * time.Minute})
+	for i := 0; i < 3; i++ {
+		balance, err := update(b)
+		if err != nil {
+			t.Fatalf("minute %d: %s", i+1, err)
+		}
+		if grace := b.GraceRemaining(client, balance); grace != nil {
+			t.Errorf("minute %d: unexpected grace before running out: %s", i+1, grace)
+		}
+	}
+	below := now.Add(time.Minute)
+	for i := 0; i < 2; i++ {
+		balance, err := update(b)
+		if err != nil {
+			t.Fatalf("grace minute %d: %s", i+1, err)
+		}
+		grace := b.GraceRemaining(client, balance)
+		if grace == nil || grace.Until == nil || !grace.Until.Equal(below.Add(2*time.Minute)) {
+			t.Errorf("grace minute %d: wrong grace remaining: %v", i+1, grace)
+		}
+		// Reconnecting doesn't start the grace over.
+		if err := b.OnClient(client); err != nil {
+			t.Errorf("grace minute %d: client rejected while in its grace: %s", i+1, err)
+		}
+	}
+	if _, err := update(b); err == nil {
+		t.Error("expected a low balance error after the grace period")
+	}
+	if err := b.OnClient(client); err == nil {
+		t.Error("expected the client to be rejected after the grace period")
+	}
+
+	// Topping up ends the grace, and a new one starts next time.
+	if err := b.Store.AddNodeBalance(client.ID, big.NewInt(10000)); err != nil {
+		t.Fatal(err)
+	}
+	balance, err := update(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if grace := b.GraceRemaining(client, balance); grace != nil {
+		t.Errorf("unexpected grace after topping up: %s", grace)
+	}
+	if err := b.OnClient(client); err != nil {
+		t.Errorf("client rejected after topping up: %s", err)
+	}
+
+	// With an allowance, the client keeps its peers until its balance falls
+	// further than that below the minimum.
+	now = start
+	client.LastSeen = now
+	b = setup(Grace{Allowance: big.NewInt(1500)})
+	for i := 0; i < 4; i++ {
+		if _, err := update(b); err != nil {
+			t.Fatalf("minute %d: %s", i+1, err)
+		}
+	}
+	balance, err = b.Store.GetNodeBalance(client.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if grace := b.GraceRemaining(client, balance); grace == nil || grace.Until != nil || grace.Allowance.Int64() != 500 {
+		t.Errorf("wrong grace remaining: %v", grace)
+	}
+	if _, err := update(b); err == nil {
+		t.Error("expected a low balance error past the grace allowance")
+	}
+
+	// Clients which connect with a low balance don't get a grace.
+	other := store.Node{ID: "other"}
+	if err := b.Store.(store.Store).SetNode(other); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Store.AddNodeBalance(other.ID, big.NewInt(-1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.OnClient(other); err == nil {
+		t.Error("expected a client connecting below the minimum to be rejected")
+	} else if _, ok := err.(LowBalanceError); !ok {
+		t.Errorf("expected LowBalanceError, got: %v", err)
+	}
+}
@@ -3,12 +3,15 @@ package balance
 import (
 	"fmt"
 	"math/big"
+	"sync"
 	"time"
 
 	"github.com/vipnode/vipnode/pool/store"
 )
 
-// PayPerInterval creates a balance Manager which implements a pay-per-interval scheme.
+// PayPerInterval creates a balance Manager which implements a pay-per-interval
+// scheme. If storeDriver is also a store.SessionStore, then each billed
+// interval is recorded as a session for accounting.
 func PayPerInterval(storeDriver store.BalanceStore, interval time.Duration, creditPerInterval *big.Int) *payPerInterval {
 	return &payPerInterval{
 		Store:             storeDriver,
@@ -27,23 +30,99 @@ type payPerInterval struct {
 	CreditPerInterval big.Int
 	// MinBalance, if set, is the minimum balance a node must have before it gets errored out.
 	MinBalance *big.Int
+	// Grace lets clients keep their peers for a while after their balance
+	// falls below MinBalance, before they're errored out.
+	Grace Grace
 
 	// now is used for testing to override time-based behaviour
 	now func() time.Time
+
+	mu sync.Mutex
+	// below is when each client's balance fell below MinBalance, for its
+	// grace. It's kept in memory, so a restarted pool starts the grace over.
+	below map[store.NodeID]time.Time
 }
 
-func (b *payPerInterval) intervalCredit(lastSeen time.Time) *big.Int {
-	if b.now == nil {
-		b.now = time.Now
+func (b *payPerInterval) clock() time.Time {
+	if b.now != nil {
+		return b.now()
+	}
+	return time.Now()
+}
+
+// checkBalance returns a LowBalanceError if the node's total balance is below
+// MinBalance and its grace is exhausted. The grace starts when the balance
+// first falls below MinBalance if start is set, otherwise only nodes which
+// are already in their grace get it.
+func (b *payPerInterval) checkBalance(nodeID store.NodeID, total *big.Int, start bool) error {
+	if b.MinBalance == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.MinBalance.Cmp(total) <= 0 {
+		delete(b.below, nodeID)
+		return nil
+	}
+	lowBalance := LowBalanceError{
+		CurrentBalance: total,
+		MinBalance:     b.MinBalance,
+	}
+	if !b.Grace.Enabled() {
+		return lowBalance
 	}
-	delta := big.NewInt(int64(b.now().Sub(lastSeen)))
+	now := b.clock()
+	since, ok := b.below[nodeID]
+	if !ok {
+		if !start {
+			return lowBalance
+		}
+		if b.below == nil {
+			b.below = map[store.NodeID]time.Time{}
+		}
+		b.below[nodeID] = now
+		since = now
+	}
+	deficit := new(big.Int).Sub(b.MinBalance, total)
+	if _, ok := b.Grace.Remaining(deficit, since, now); !ok {
+		// The start of the grace is kept, so that the client doesn't get a
+		// new one by reconnecting.
+		return lowBalance
+	}
+	return nil
+}
+
+// GraceRemaining returns the grace left for a client whose balance is below
+// MinBalance, or nil if it's not in its grace.
+func (b *payPerInterval) GraceRemaining(node store.Node, balance store.Balance) *GraceRemaining {
+	if b.MinBalance == nil || node.IsHost {
+		return nil
+	}
+	total := new(big.Int).Add(&balance.Credit, &balance.Deposit)
+	b.mu.Lock()
+	since, ok := b.below[node.ID]
+	b.mu.Unlock()
+	if !ok || b.MinBalance.Cmp(total) <= 0 {
+		return nil
+	}
+	remaining, ok := b.Grace.Remaining(new(big.Int).Sub(b.MinBalance, total), since, b.clock())
+	if !ok {
+		return nil
+	}
+	return &remaining
+}
+
+func (b *payPerInterval) intervalCredit(lastSeen time.Time) *big.Int {
+	delta := big.NewInt(int64(b.clock().Sub(lastSeen)))
 	interval := big.NewInt(int64(b.Interval))
 	credit := new(big.Int).Mul(delta, &b.CreditPerInterval)
 	return credit.Div(credit, interval)
 }
 
 // OnClient is called when a client connects to the pool. If an error is
-// returned, the client is disconnected with the error.
+// returned, the client is disconnected with the error. Clients with a balance
+// below MinBalance are only let in while they're in their grace, which starts
+// on an update rather than on connecting.
 func (b *payPerInterval) OnClient(node store.Node) error {
 	if b.MinBalance == nil {
 		return nil
@@ -52,15 +131,8 @@ func (b *payPerInterval) OnClient(node store.Node) error {
 	if err != nil {
 		return err
 	}
-	// TODO: Write a test for this
 	total := new(big.Int).Add(&balance.Credit, &balance.Deposit)
-	if b.MinBalance.Cmp(total) > 0 {
-		return LowBalanceError{
-			CurrentBalance: total,
-			MinBalance:     b.MinBalance,
-		}
-	}
-	return nil
+	return b.checkBalance(node.ID, total, false)
 }
 
 // OnUpdate takes a node instance (with a LastSeen timestamp of the previous
@@ -88,24 +160,50 @@ func (b *payPerInterval) OnUpdate(node store.Node, peers []store.Node) (store.Ba
 		total.Add(total, credit)
 	}
 
-	// If this comparison is in the wrong place, it could make the pool
-	// insolvent. On the other hand, if we compare too early, then the client
-	// could get into a loop where it disconnects due to low balance, connects
-	// successfully, repeat.
-	if b.MinBalance != nil && b.MinBalance.Cmp(total) > 0 {
-		return store.Balance{}, LowBalanceError{
-			CurrentBalance: total,
-			MinBalance:     b.MinBalance,
-		}
-	}
-
 	if err := b.Store.AddNodeBalance(node.ID, new(big.Int).Neg(total)); err != nil {
 		return store.Balance{}, err
 	}
+	if sessions, ok := b.Store.(store.SessionStore); ok {
+		end := b.clock()
+		for _, peer := range peers {
+			session := store.Session{
+				ClientID: node.ID,
+				HostID:   peer.ID,
+				Start:    node.LastSeen,
+				End:      end,
+			}
+			session.Amount.Set(credit)
+			if err := sessions.AddSession(session); err != nil {
+				return store.Balance{}, err
+			}
+		}
+	}
 	balance, err := b.Store.GetNodeBalance(node.ID)
 	if err != nil {
 		return balance, err
 	}
 
-	return b.Store.GetNodeBalance(node.ID)
+	// The client is billed for its peers up to now before its balance is
+	// compared, so that the hosts are paid for the time they served it,
+	// including its grace. Checking before billing would let a client
+	// disconnect due to low balance, connect successfully, and repeat.
+	remaining := new(big.Int).Add(&balance.Credit, &balance.Deposit)
+	if err := b.checkBalance(node.ID, remaining, true); err != nil {
+		return store.Balance{}, err
+	}
+	return balance, nil
+}
+
+// Rate returns the CreditPerInterval charged for each of the client's peers.
+// Hosts aren't charged.
+func (b *payPerInterval) Rate(node store.Node, peers []store.Node) Rate {
+	if node.IsHost {
+		return Rate{}
+	}
+	r := Rate{
+		Interval:   b.Interval,
+		MinBalance: b.MinBalance,
+	}
+	r.Amount.Mul(&b.CreditPerInterval, big.NewInt(int64(len(peers))))
+	return r
 }
@@ -82,3 +82,56 @@ func TestPerInterval(t *testing.T) {
 	check(nodes[1], nodes[0:1], -7000)
 	check(nodes[0], nodes[1:], 7000) // host
 }
+
+func TestPerIntervalSessions(t *testing.T) {
+	storeDriver := memory.New()
+
+	start := time.Now()
+	now := start
+	balanceManager := &payPerInterval{
+		Store:             storeDriver,
+		Interval:          time.Minute * 1,
+		CreditPerInterval: *big.NewInt(1000),
+		now:               func() time.Time { return now },
+	}
+
+	client := store.Node{ID: "client", LastSeen: now}
+	hosts := []store.Node{{ID: "a", IsHost: true}, {ID: "b", IsHost: true}}
+	for _, node := range append(hosts, client) {
+		if err := storeDriver.SetNode(node); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	now = now.Add(time.Minute * 3)
+	if _, err := balanceManager.OnUpdate(client, hosts); err != nil {
+		t.Fatal(err)
+	}
+	// Host updates are not billed
+	if _, err := balanceManager.OnUpdate(hosts[0], []store.Node{client}); err != nil {
+		t.Fatal(err)
+	}
+
+	sessions := []store.Session{}
+	err := storeDriver.Sessions(start, now.Add(time.Second), func(s store.Session) error {
+		sessions = append(sessions, s)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 2 {
+		t.Fatalf("expected 2 sessions, got %d", len(sessions))
+	}
+	for i, s := range sessions {
+		if s.ClientID != client.ID || s.HostID != hosts[i].ID {
+			t.Errorf("session %d: wrong nodes: %+v", i, s)
+		}
+		if s.Duration() != time.Minute*3 {
+			t.Errorf("session %d: wrong duration: %s", i, s.Duration())
+		}
+		if s.Amount.Int64() != 3000 {
+			t.Errorf("session %d: wrong amount: %d", i, &s.Amount)
+		}
+	}
+}
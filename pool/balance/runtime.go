@@ -0,0 +1,63 @@
+package balance
+
+import (
+	"math/big"
+	"time"
+
+	"github.com/vipnode/vipnode/pool/store"
+)
+
+// Rate is how much a node is charged over some interval.
+type Rate struct {
+	Amount   big.Int
+	Interval time.Duration
+	// MinBalance is the balance at which the node is disconnected, or nil to
+	// run the balance down to zero.
+	MinBalance *big.Int
+}
+
+// Free returns whether the rate doesn't charge anything.
+func (r Rate) Free() bool {
+	return r.Interval <= 0 || r.Amount.Sign() <= 0
+}
+
+// Rater is implemented by Managers which charge at a predictable rate, to
+// estimate how long a node's balance will last.
+type Rater interface {
+	// Rate returns the current charge rate of a node with the given active
+	// peers.
+	Rate(node store.Node, peers []store.Node) Rate
+}
+
+// Runtime returns how long the balance lasts at the rate. It's false if the
+// rate is free, so the balance never runs out.
+func Runtime(balance store.Balance, rate Rate) (time.Duration, bool) {
+	if rate.Free() {
+		return 0, false
+	}
+	remaining := new(big.Int).Add(&balance.Credit, &balance.Deposit)
+	if rate.MinBalance != nil {
+		remaining.Sub(remaining, rate.MinBalance)
+	}
+	if remaining.Sign() <= 0 {
+		return 0, true
+	}
+	// remaining * interval / amount, capped to avoid overflowing a Duration.
+	runtime := new(big.Int).Mul(remaining, big.NewInt(int64(rate.Interval)))
+	runtime.Div(runtime, &rate.Amount)
+	if !runtime.IsInt64() {
+		return time.Duration(1<<63 - 1), true
+	}
+	return time.Duration(runtime.Int64()), true
+}
+
+// Expiry returns the estimated time when the balance runs out at the rate,
+// starting from now. It's nil if the rate is free.
+func Expiry(balance store.Balance, rate Rate, now time.Time) *time.Time {
+	runtime, ok := Runtime(balance, rate)
+	if !ok {
+		return nil
+	}
+	expires := now.Add(runtime)
+	return &expires
+}
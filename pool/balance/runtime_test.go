@@ -0,0 +1,71 @@
+package balance
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/vipnode/vipnode/pool/store"
+)
+
+func TestRuntime(t *testing.T) {
+	balance := func(credit, deposit int64) store.Balance {
+		var b store.Balance
+		b.Credit.SetInt64(credit)
+		b.Deposit.SetInt64(deposit)
+		return b
+	}
+	rate := func(amount int64, interval time.Duration, min *big.Int) Rate {
+		r := Rate{Interval: interval, MinBalance: min}
+		r.Amount.SetInt64(amount)
+		return r
+	}
+
+	testcases := []struct {
+		name    string
+		balance store.Balance
+		rate    Rate
+		want    time.Duration
+		expires bool
+	}{
+		{"credit", balance(5000, 0), rate(1000, time.Minute, nil), 5 * time.Minute, true},
+		{"credit and deposit", balance(500, 1000), rate(1000, time.Minute, nil), 90 * time.Second, true},
+		{"several peers", balance(6000, 0), rate(3000, time.Minute, nil), 2 * time.Minute, true},
+		{"min balance", balance(5000, 0), rate(1000, time.Minute, big.NewInt(2000)), 3 * time.Minute, true},
+		{"below min balance", balance(1000, 0), rate(1000, time.Minute, big.NewInt(2000)), 0, true},
+		{"negative", balance(-1000, 0), rate(1000, time.Minute, nil), 0, true},
+		{"free", balance(5000, 0), rate(0, time.Minute, nil), 0, false},
+		{"no interval", balance(5000, 0), rate(1000, 0, nil), 0, false},
+		{"overflow", balance(0, 1<<62), rate(1, time.Hour, nil), time.Duration(1<<63 - 1), true},
+	}
+
+	now := time.Now()
+	for _, tc := range testcases {
+		got, ok := Runtime(tc.balance, tc.rate)
+		if got != tc.want || ok != tc.expires {
+			t.Errorf("%s: got %s, %t; want %s, %t", tc.name, got, ok, tc.want, tc.expires)
+		}
+		expires := Expiry(tc.balance, tc.rate, now)
+		if !tc.expires && expires != nil {
+			t.Errorf("%s: expected no expiry, got %s", tc.name, expires)
+		} else if tc.expires && (expires == nil || !expires.Equal(now.Add(tc.want))) {
+			t.Errorf("%s: got expiry %v; want %s", tc.name, expires, now.Add(tc.want))
+		}
+	}
+}
+
+func TestPerIntervalRate(t *testing.T) {
+	balanceManager := PayPerInterval(nil, time.Minute, big.NewInt(1000))
+	peers := []store.Node{{ID: "a"}, {ID: "b"}}
+
+	r := balanceManager.Rate(store.Node{ID: "client"}, peers)
+	if r.Amount.Int64() != 2000 || r.Interval != time.Minute {
+		t.Errorf("client rate: got %d per %s; want 2000 per 1m", &r.Amount, r.Interval)
+	}
+	if r := balanceManager.Rate(store.Node{ID: "host", IsHost: true}, peers); !r.Free() {
+		t.Errorf("expected hosts to be free, got %d per %s", &r.Amount, r.Interval)
+	}
+	if r := balanceManager.Rate(store.Node{ID: "client"}, nil); !r.Free() {
+		t.Errorf("expected clients without peers to be free, got %d per %s", &r.Amount, r.Interval)
+	}
+}
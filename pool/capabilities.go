@@ -0,0 +1,80 @@
+package pool
+
+import (
+	"sort"
+
+	"github.com/vipnode/vipnode/pool/store"
+)
+
+// shuffleHosts puts hosts in a random order drawn from p.Rand. They're sorted
+// by ID first, so that the order only depends on the random source and not on
+// the order the store returned them in.
+func (p *VipnodePool) shuffleHosts(hosts []store.Node) {
+	sort.Slice(hosts, func(i, j int) bool { return hosts[i].ID < hosts[j].ID })
+	p.randMu.Lock()
+	defer p.randMu.Unlock()
+	p.Rand.Shuffle(len(hosts), func(i, j int) { hosts[i], hosts[j] = hosts[j], hosts[i] })
+}
+
+// matchingHosts returns up to limit active hosts of the given kind which have
+// the capabilities required by the client request, picked at random. If none
+// match and the request allows it, any active hosts are returned instead.
+// Hosts which reported that they're full are skipped either way.
+func (p *VipnodePool) matchingHosts(kind string, limit int, req ClientRequest) ([]store.Node, error) {
+	// The hosts are picked here rather than by the store, so that the picks
+	// are reproducible with a seeded Rand. Stores don't index capabilities
+	// either, so all the active hosts are loaded and filtered here.
+	active, err := p.Store.ActiveHosts(kind, 0)
+	if err != nil {
+		return nil, err
+	}
+	hosts := make([]store.Node, 0, len(active))
+	for _, host := range active {
+		if !host.IsFull() {
+			hosts = append(hosts, host)
+		}
+	}
+	p.shuffleHosts(hosts)
+	preferHosts(hosts, req.PreferHosts)
+	if len(req.Capabilities) == 0 {
+		if len(hosts) > limit {
+			hosts = hosts[:limit]
+		}
+		return hosts, nil
+	}
+	r := make([]store.Node, 0, limit)
+	for _, host := range hosts {
+		if !host.HasCapabilities(req.Capabilities) {
+			continue
+		}
+		r = append(r, host)
+		if len(r) == limit {
+			break
+		}
+	}
+	if len(r) == 0 && req.CapabilitiesFallback {
+		logger.Printf("No active hosts with capabilities %v, falling back to any host", req.Capabilities)
+		if len(hosts) > limit {
+			hosts = hosts[:limit]
+		}
+		return hosts, nil
+	}
+	return r, nil
+}
+
+// preferHosts moves the hosts with the preferred node IDs to the front of
+// hosts, keeping the order otherwise.
+func preferHosts(hosts []store.Node, preferred []string) {
+	if len(preferred) == 0 {
+		return
+	}
+	ids := make(map[store.NodeID]struct{}, len(preferred))
+	for _, id := range preferred {
+		ids[store.NodeID(id)] = struct{}{}
+	}
+	sort.SliceStable(hosts, func(i, j int) bool {
+		_, a := ids[hosts[i].ID]
+		_, b := ids[hosts[j].ID]
+		return a && !b
+	})
+}
@@ -0,0 +1,249 @@
+package pool
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p/discv5"
+	"github.com/vipnode/vipnode/internal/keygen"
+	"github.com/vipnode/vipnode/jsonrpc2"
+	"github.com/vipnode/vipnode/pool/store"
+	"github.com/vipnode/vipnode/pool/store/memory"
+)
+
+func TestClientCapabilities(t *testing.T) {
+	pool := New(memory.New(), nil)
+	pool.skipWhitelist = true
+
+	hosts := []struct {
+		keyIdx       int
+		capabilities map[string]string
+	}{
+		{0, map[string]string{"archive": "true", "trace": "true"}},
+		{2, nil},
+	}
+	hostIDs := make([]store.NodeID, len(hosts))
+	for i, h := range hosts {
+		server, host := jsonrpc2.ServePipe()
+		server.Server.Register("vipnode_", pool)
+		hostKey := keygen.HardcodedKeyIdx(t, h.keyIdx)
+		hostID := discv5.PubkeyID(&hostKey.PublicKey).String()
+		hostIDs[i] = store.NodeID(hostID)
+		req := HostRequest{Kind: "geth", NodeURI: "enode://" + hostID + "@127.0.0.1:30303", Capabilities: h.capabilities}
+		if _, err := Remote(host, hostKey).Host(context.Background(), req); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if node, err := pool.Store.GetNode(hostIDs[0]); err != nil {
+		t.Fatal(err)
+	} else if node.Capabilities["archive"] != "true" {
+		t.Errorf("host capabilities were not stored: %v", node.Capabilities)
+	}
+
+	server, client := jsonrpc2.ServePipe()
+	server.Server.Register("vipnode_", pool)
+	remoteClient := Remote(client, keygen.HardcodedKeyIdx(t, 1))
+
+	testcases := []struct {
+		name     string
+		req      ClientRequest
+		want     []store.NodeID
+		wantNone bool
+	}{
+		{"no requirements", ClientRequest{Kind: "geth"}, hostIDs, false},
+		{"archive", ClientRequest{Kind: "geth", Capabilities: map[string]string{"archive": ""}}, hostIDs[:1], false},
+		{"exact value", ClientRequest{Kind: "geth", Capabilities: map[string]string{"archive": "true", "trace": "true"}}, hostIDs[:1], false},
+		{"wrong value", ClientRequest{Kind: "geth", Capabilities: map[string]string{"archive": "false"}}, nil, true},
+		{"no match", ClientRequest{Kind: "geth", Capabilities: map[string]string{"les": ""}}, nil, true},
+		{"no match fallback", ClientRequest{Kind: "geth", Capabilities: map[string]string{"les": ""}, CapabilitiesFallback: true}, hostIDs, false},
+	}
+	for _, tc := range testcases {
+		resp, err := remoteClient.Client(context.Background(), tc.req)
+		if tc.wantNone {
+			if err == nil || err.Error() != (NoHostNodesError{}).Error() {
+				t.Errorf("%s: expected NoHostNodesError, got: %v", tc.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", tc.name, err)
+			continue
+		}
+		got := map[store.NodeID]bool{}
+		for _, host := range resp.Hosts {
+			got[host.ID] = true
+		}
+		if len(got) != len(tc.want) {
+			t.Errorf("%s: got %d hosts; want %d", tc.name, len(got), len(tc.want))
+		}
+		for _, id := range tc.want {
+			if !got[id] {
+				t.Errorf("%s: missing host %q", tc.name, id)
+			}
+		}
+	}
+}
+
+func TestClientAssignmentSeed(t *testing.T) {
+	// assignments adds the same hosts to a pool seeded with seed, and returns
+	// the hosts assigned to a client which connects repeatedly.
+	assignments := func(seed int64) [][]store.NodeID {
+		pool := New(memory.New(), nil)
+		pool.skipWhitelist = true
+		pool.Rand = rand.New(rand.NewSource(seed))
+		now := time.Now()
+		for i := 0; i < 6; i++ {
+			host := store.Node{ID: store.NodeID(fmt.Sprintf("%0128x", i)), Kind: "geth", IsHost: true, LastSeen: now}
+			if err := pool.Store.SetNode(host); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		server, client := jsonrpc2.ServePipe()
+		server.Server.Register("vipnode_", pool)
+		remoteClient := Remote(client, keygen.HardcodedKeyIdx(t, 0))
+		var r [][]store.NodeID
+		for i := 0; i < 4; i++ {
+			resp, err := remoteClient.Client(context.Background(), ClientRequest{Kind: "geth"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids := make([]store.NodeID, 0, len(resp.Hosts))
+			for _, host := range resp.Hosts {
+				ids = append(ids, host.ID)
+			}
+			r = append(r, ids)
+		}
+		return r
+	}
+
+	first := assignments(42)
+	for i := 0; i < 3; i++ {
+		if got := assignments(42); !reflect.DeepEqual(got, first) {
+			t.Fatalf("run %d: got assignments %v; want %v", i, got, first)
+		}
+	}
+	for _, hosts := range first {
+		if len(hosts) != 3 {
+			t.Errorf("got %d hosts; want 3", len(hosts))
+		}
+	}
+	if got := assignments(43); reflect.DeepEqual(got, first) {
+		t.Errorf("expected a different seed to change the assignments, got %v for both", got)
+	}
+}
+
+func TestClientPreferHosts(t *testing.T) {
+	pool := New(memory.New(), nil)
+	pool.skipWhitelist = true
+	now := time.Now()
+	for i := 0; i < 6; i++ {
+		host := store.Node{ID: store.NodeID(fmt.Sprintf("%0128x", i)), Kind: "geth", IsHost: true, LastSeen: now}
+		if err := pool.Store.SetNode(host); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// An inactive host is not returned, even if preferred.
+	inactive := store.Node{ID: store.NodeID(fmt.Sprintf("%0128x", 9)), Kind: "geth", IsHost: true, LastSeen: now.Add(-time.Hour)}
+	if err := pool.Store.SetNode(inactive); err != nil {
+		t.Fatal(err)
+	}
+
+	server, client := jsonrpc2.ServePipe()
+	server.Server.Register("vipnode_", pool)
+	remoteClient := Remote(client, keygen.HardcodedKeyIdx(t, 0))
+	preferred := fmt.Sprintf("%0128x", 4)
+	for i := 0; i < 5; i++ {
+		resp, err := remoteClient.Client(context.Background(), ClientRequest{Kind: "geth", PreferHosts: []string{preferred}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(resp.Hosts) != 3 || string(resp.Hosts[0].ID) != preferred {
+			t.Errorf("expected the preferred host first, got: %v", resp.Hosts)
+		}
+	}
+
+	resp, err := remoteClient.Client(context.Background(), ClientRequest{Kind: "geth", PreferHosts: []string{string(inactive.ID)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, host := range resp.Hosts {
+		if host.ID == inactive.ID {
+			t.Errorf("inactive preferred host was returned: %v", resp.Hosts)
+		}
+	}
+}
+
+func TestClientSkipsFullHosts(t *testing.T) {
+	ctx := context.Background()
+	pool := New(memory.New(), nil)
+	pool.skipWhitelist = true
+
+	remoteHosts := make([]*RemotePool, 2)
+	hostIDs := make([]store.NodeID, 2)
+	for i := range remoteHosts {
+		server, host := jsonrpc2.ServePipe()
+		server.Server.Register("vipnode_", pool)
+		hostKey := keygen.HardcodedKeyIdx(t, i*2)
+		hostID := discv5.PubkeyID(&hostKey.PublicKey).String()
+		hostIDs[i] = store.NodeID(hostID)
+		remoteHosts[i] = Remote(host, hostKey)
+		if _, err := remoteHosts[i].Host(ctx, HostRequest{Kind: "geth", NodeURI: "enode://" + hostID + "@127.0.0.1:30303"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	server, client := jsonrpc2.ServePipe()
+	server.Server.Register("vipnode_", pool)
+	remoteClient := Remote(client, keygen.HardcodedKeyIdx(t, 1))
+	assigned := func() []store.NodeID {
+		t.Helper()
+		resp, err := remoteClient.Client(ctx, ClientRequest{Kind: "geth"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids := []store.NodeID{}
+		for _, host := range resp.Hosts {
+			ids = append(ids, host.ID)
+		}
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+		return ids
+	}
+	update := func(i int, slots *int) {
+		t.Helper()
+		if _, err := remoteHosts[i].Update(ctx, UpdateRequest{AvailableSlots: slots}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sorted := append([]store.NodeID{}, hostIDs...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	full, available := 0, 5
+	update(0, &full)
+	update(1, &available)
+	if got, want := assigned(), hostIDs[1:]; !reflect.DeepEqual(got, want) {
+		t.Errorf("got hosts %v; want only the host with slots %v", got, want)
+	}
+	if node, err := pool.Store.GetNode(hostIDs[0]); err != nil {
+		t.Fatal(err)
+	} else if !node.IsFull() {
+		t.Errorf("full host's slots were not saved: %v", node.Slots())
+	}
+
+	// Hosts which don't know their slots are assigned clients.
+	update(0, nil)
+	if got := assigned(); !reflect.DeepEqual(got, sorted) {
+		t.Errorf("got hosts %v; want %v", got, sorted)
+	}
+
+	update(0, &full)
+	update(1, &full)
+	if _, err := remoteClient.Client(ctx, ClientRequest{Kind: "geth"}); err == nil || err.Error() != (NoHostNodesError{}).Error() {
+		t.Errorf("expected NoHostNodesError with every host full, got: %v", err)
+	}
+}
@@ -0,0 +1,34 @@
+package pool
+
+import "time"
+
+// MaxClockSkew is how far an agent's clock can be off from the pool's before
+// the agent warns about it. Request nonces are timestamps, so a skewed clock
+// eventually gets requests rejected (see store.ExpireNonce).
+const MaxClockSkew = time.Minute
+
+// minTimestampNonce is the smallest nonce treated as a nanosecond timestamp,
+// at 2018-01-01. Smaller nonces are from agents which use a counter instead.
+const minTimestampNonce = 1514764800 * int64(time.Second)
+
+// ClockSkew returns how far ahead the local clock is of the pool's, given the
+// PoolTime of a response to a request that was sent and received at the
+// given local times. The pool handled the request about halfway between, so
+// the round trip doesn't count as skew. It returns 0 if the pool didn't report
+// its time.
+func ClockSkew(poolTime time.Time, sent time.Time, received time.Time) time.Duration {
+	if poolTime.IsZero() {
+		return 0
+	}
+	return sent.Add(received.Sub(sent) / 2).Sub(poolTime)
+}
+
+// nonceSkew estimates how far ahead a node's clock is of now from the nonce
+// of its request, which RemotePool sets to the node's time. It returns 0 if
+// the nonce is not a timestamp.
+func nonceSkew(nonce int64, now time.Time) time.Duration {
+	if nonce < minTimestampNonce {
+		return 0
+	}
+	return time.Unix(0, nonce).Sub(now)
+}
@@ -0,0 +1,69 @@
+package pool
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p/discv5"
+	"github.com/vipnode/vipnode/internal/keygen"
+	"github.com/vipnode/vipnode/jsonrpc2"
+	"github.com/vipnode/vipnode/pool/store"
+	"github.com/vipnode/vipnode/pool/store/memory"
+)
+
+func TestClockSkew(t *testing.T) {
+	poolTime := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	testcases := []struct {
+		name     string
+		poolTime time.Time
+		sent     time.Time
+		received time.Time
+		want     time.Duration
+	}{
+		{"in sync", poolTime, poolTime.Add(-time.Second), poolTime.Add(time.Second), 0},
+		{"ahead", poolTime, poolTime.Add(4 * time.Minute), poolTime.Add(4*time.Minute + 2*time.Second), 4*time.Minute + time.Second},
+		{"behind", poolTime, poolTime.Add(-time.Hour), poolTime.Add(-time.Hour), -time.Hour},
+		{"unreported", time.Time{}, poolTime, poolTime, 0},
+	}
+	for _, tc := range testcases {
+		if got := ClockSkew(tc.poolTime, tc.sent, tc.received); got != tc.want {
+			t.Errorf("%s: got %s; want %s", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestNonceSkew(t *testing.T) {
+	now := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	if got := nonceSkew(now.Add(-2*time.Minute).UnixNano(), now); got != -2*time.Minute {
+		t.Errorf("timestamp nonce: got %s", got)
+	}
+	if got := nonceSkew(42, now); got != 0 {
+		t.Errorf("counter nonce: got %s", got)
+	}
+}
+
+func TestRegisterClockSkew(t *testing.T) {
+	pool := New(memory.New(), nil)
+	pool.skipWhitelist = true
+
+	server, host := jsonrpc2.ServePipe()
+	server.Server.Register("vipnode_", pool)
+	hostKey := keygen.HardcodedKeyIdx(t, 0)
+	hostID := discv5.PubkeyID(&hostKey.PublicKey).String()
+	resp, err := Remote(host, hostKey).Host(context.Background(), HostRequest{Kind: "geth", NodeURI: "enode://" + hostID + "@127.0.0.1:30303"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if skew := ClockSkew(resp.PoolTime, time.Now(), time.Now()); skew < 0 || skew > time.Second {
+		t.Errorf("wrong pool time in response: %s", resp.PoolTime)
+	}
+
+	node, err := pool.Store.GetNode(store.NodeID(hostID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if node.ClockSkew == 0 || node.ClockSkew > 0 || node.ClockSkew < -time.Second {
+		t.Errorf("wrong clock skew for host: %s", node.ClockSkew)
+	}
+}
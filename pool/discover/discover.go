@@ -0,0 +1,174 @@
+// Package discover resolves a domain into a prioritized list of pool
+// endpoints using DNS, so that agents can fail over between pools.
+//
+// Endpoints are discovered from SRV records for _vipnode._tcp.<domain>, in
+// priority order, followed by any TXT records on <domain> of the form
+// "vipnode=<url>".
+package discover
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Scheme is the URL scheme for pool URLs that should be discovered with DNS,
+// such as "dns://vipnode.org".
+const Scheme = "dns"
+
+// DefaultTTL is how long discovered endpoints are cached by default.
+const DefaultTTL = 5 * time.Minute
+
+const txtPrefix = "vipnode="
+
+// ErrNoEndpoints is returned when a domain has no pool records.
+var ErrNoEndpoints = errors.New("no pool endpoints found")
+
+// Resolver is the subset of net.Resolver used for discovery.
+type Resolver interface {
+	LookupSRV(ctx context.Context, service, proto, name string) (cname string, addrs []*net.SRV, err error)
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+}
+
+// Discovery resolves and caches pool endpoints for a domain.
+type Discovery struct {
+	// Domain to look up records for.
+	Domain string
+
+	// Scheme is used for endpoints discovered through SRV records.
+	// Defaults to "wss".
+	Scheme string
+
+	// Resolver defaults to net.DefaultResolver.
+	Resolver Resolver
+
+	// TTL is how long results are cached. The standard library resolver
+	// does not expose record TTLs, so this should be set to match the
+	// records. Defaults to DefaultTTL.
+	TTL time.Duration
+
+	mu        sync.Mutex
+	endpoints []string
+	expires   time.Time
+	now       func() time.Time
+}
+
+func (d *Discovery) timeNow() time.Time {
+	if d.now != nil {
+		return d.now()
+	}
+	return time.Now()
+}
+
+// Endpoints returns the pool URLs for the domain in the order they should be
+// tried, from the cache if it hasn't expired.
+func (d *Discovery) Endpoints(ctx context.Context) ([]string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.timeNow()
+	if d.endpoints != nil && now.Before(d.expires) {
+		return d.endpoints, nil
+	}
+	endpoints, err := d.lookup(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ttl := d.TTL
+	if ttl == 0 {
+		ttl = DefaultTTL
+	}
+	d.endpoints = endpoints
+	d.expires = now.Add(ttl)
+	return endpoints, nil
+}
+
+func (d *Discovery) lookup(ctx context.Context) ([]string, error) {
+	resolver := d.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	scheme := d.Scheme
+	if scheme == "" {
+		scheme = "wss"
+	}
+
+	// Either record type is enough, so we only fail if both lookups do.
+	endpoints := []string{}
+	seen := map[string]struct{}{}
+	add := func(endpoint string) {
+		if _, ok := seen[endpoint]; ok {
+			return
+		}
+		seen[endpoint] = struct{}{}
+		endpoints = append(endpoints, endpoint)
+	}
+
+	// LookupSRV returns records sorted by priority and randomized by weight.
+	_, addrs, srvErr := resolver.LookupSRV(ctx, "vipnode", "tcp", d.Domain)
+	for _, addr := range addrs {
+		host := strings.TrimSuffix(addr.Target, ".")
+		add(fmt.Sprintf("%s://%s/", scheme, net.JoinHostPort(host, strconv.Itoa(int(addr.Port)))))
+	}
+	records, txtErr := resolver.LookupTXT(ctx, d.Domain)
+	for _, record := range records {
+		if strings.HasPrefix(record, txtPrefix) {
+			add(strings.TrimPrefix(record, txtPrefix))
+		}
+	}
+
+	if len(endpoints) > 0 {
+		return endpoints, nil
+	}
+	if srvErr != nil && txtErr != nil {
+		return nil, LookupError{Domain: d.Domain, SRV: srvErr, TXT: txtErr}
+	}
+	return nil, ErrNoEndpoints
+}
+
+// Try calls fn with each endpoint in order until one succeeds, and returns
+// the endpoint that succeeded. If all of them fail, the returned error
+// includes each failure.
+func (d *Discovery) Try(ctx context.Context, fn func(endpoint string) error) (string, error) {
+	endpoints, err := d.Endpoints(ctx)
+	if err != nil {
+		return "", err
+	}
+	errs := make([]error, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		err := fn(endpoint)
+		if err == nil {
+			return endpoint, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %s", endpoint, err))
+	}
+	return "", EndpointErrors(errs)
+}
+
+// LookupError is returned when neither SRV nor TXT records could be
+// resolved.
+type LookupError struct {
+	Domain string
+	SRV    error
+	TXT    error
+}
+
+func (err LookupError) Error() string {
+	return fmt.Sprintf("failed to discover pools for %q: SRV lookup: %s; TXT lookup: %s", err.Domain, err.SRV, err.TXT)
+}
+
+// EndpointErrors is returned by Try when every endpoint failed.
+type EndpointErrors []error
+
+func (errs EndpointErrors) Error() string {
+	msgs := make([]string, 0, len(errs))
+	for _, err := range errs {
+		msgs = append(msgs, err.Error())
+	}
+	return fmt.Sprintf("all %d pool endpoints failed: %s", len(errs), strings.Join(msgs, "; "))
+}
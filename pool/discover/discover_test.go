@@ -0,0 +1,151 @@
+package discover
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type fakeResolver struct {
+	srv     []*net.SRV
+	txt     []string
+	srvErr  error
+	txtErr  error
+	lookups int
+}
+
+func (r *fakeResolver) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	r.lookups++
+	if service != "vipnode" || proto != "tcp" || name != "vipnode.org" {
+		return "", nil, errors.New("unexpected lookup")
+	}
+	return "", r.srv, r.srvErr
+}
+
+func (r *fakeResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	return r.txt, r.txtErr
+}
+
+func TestEndpoints(t *testing.T) {
+	resolver := &fakeResolver{
+		srv: []*net.SRV{
+			{Target: "pool1.vipnode.org.", Port: 443, Priority: 1},
+			{Target: "pool2.vipnode.org.", Port: 8080, Priority: 2},
+		},
+		txt: []string{
+			"v=spf1 -all",
+			"vipnode=https://pool3.vipnode.org/",
+			"vipnode=wss://pool1.vipnode.org:443/",
+		},
+	}
+	d := Discovery{Domain: "vipnode.org", Resolver: resolver}
+	got, err := d.Endpoints(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"wss://pool1.vipnode.org:443/",
+		"wss://pool2.vipnode.org:8080/",
+		"https://pool3.vipnode.org/",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %q; want: %q", got, want)
+	}
+
+	// Either record type is sufficient
+	resolver.srv, resolver.srvErr = nil, errors.New("no such host")
+	d = Discovery{Domain: "vipnode.org", Resolver: resolver}
+	if got, err := d.Endpoints(context.Background()); err != nil {
+		t.Error(err)
+	} else if want := []string{"https://pool3.vipnode.org/", "wss://pool1.vipnode.org:443/"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %q; want: %q", got, want)
+	}
+
+	resolver.txt, resolver.txtErr = nil, errors.New("no such host")
+	d = Discovery{Domain: "vipnode.org", Resolver: resolver}
+	if _, err := d.Endpoints(context.Background()); err == nil {
+		t.Error("expected error")
+	} else if _, ok := err.(LookupError); !ok {
+		t.Errorf("expected LookupError, got: %v", err)
+	}
+
+	resolver.srvErr, resolver.txtErr = nil, nil
+	d = Discovery{Domain: "vipnode.org", Resolver: resolver}
+	if _, err := d.Endpoints(context.Background()); err != ErrNoEndpoints {
+		t.Errorf("expected ErrNoEndpoints, got: %v", err)
+	}
+}
+
+func TestEndpointsCache(t *testing.T) {
+	resolver := &fakeResolver{
+		srv: []*net.SRV{{Target: "pool1.vipnode.org.", Port: 443}},
+	}
+	now := time.Now()
+	d := Discovery{
+		Domain:   "vipnode.org",
+		Resolver: resolver,
+		TTL:      time.Minute,
+		now:      func() time.Time { return now },
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := d.Endpoints(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if resolver.lookups != 1 {
+		t.Errorf("expected cached lookup, got %d lookups", resolver.lookups)
+	}
+
+	resolver.srv = []*net.SRV{{Target: "pool2.vipnode.org.", Port: 443}}
+	now = now.Add(time.Minute)
+	got, err := d.Endpoints(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resolver.lookups != 2 {
+		t.Errorf("expected lookup after TTL, got %d lookups", resolver.lookups)
+	}
+	if want := []string{"wss://pool2.vipnode.org:443/"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %q; want: %q", got, want)
+	}
+}
+
+func TestTry(t *testing.T) {
+	resolver := &fakeResolver{
+		srv: []*net.SRV{
+			{Target: "pool1.vipnode.org.", Port: 443},
+			{Target: "pool2.vipnode.org.", Port: 443},
+			{Target: "pool3.vipnode.org.", Port: 443},
+		},
+	}
+	d := Discovery{Domain: "vipnode.org", Resolver: resolver}
+
+	tried := []string{}
+	endpoint, err := d.Try(context.Background(), func(endpoint string) error {
+		tried = append(tried, endpoint)
+		if endpoint == "wss://pool2.vipnode.org:443/" {
+			return nil
+		}
+		return errors.New("connection refused")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if endpoint != "wss://pool2.vipnode.org:443/" {
+		t.Errorf("wrong endpoint: %q", endpoint)
+	}
+	if want := []string{"wss://pool1.vipnode.org:443/", "wss://pool2.vipnode.org:443/"}; !reflect.DeepEqual(tried, want) {
+		t.Errorf("tried: %q; want: %q", tried, want)
+	}
+
+	_, err = d.Try(context.Background(), func(endpoint string) error {
+		return errors.New("connection refused")
+	})
+	if errs, ok := err.(EndpointErrors); !ok || len(errs) != 3 {
+		t.Errorf("expected 3 EndpointErrors, got: %v", err)
+	}
+}
@@ -0,0 +1,95 @@
+package pool
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/ethereum/go-ethereum/p2p/discv5"
+	"github.com/vipnode/vipnode/pool/store"
+)
+
+// InvalidEnodeError is an entry which was skipped by ImportHosts.
+type InvalidEnodeError struct {
+	// Index is the position of the entry in the list.
+	Index int
+	Entry string
+	Cause error
+}
+
+func (err InvalidEnodeError) Error() string {
+	return fmt.Sprintf("invalid enode at index %d: %s: %s", err.Index, err.Entry, err.Cause)
+}
+
+// ExportHosts writes the enode URIs of the hosts in the store to w, as a JSON
+// list in the same format as Geth's static-nodes.json. It returns the number
+// of hosts written.
+func ExportHosts(db store.PoolStore, w io.Writer) (int, error) {
+	hosts, _, err := db.ListHosts("", 0)
+	if err != nil {
+		return 0, err
+	}
+	uris := make([]string, 0, len(hosts))
+	for _, host := range hosts {
+		if host.URI == "" {
+			continue
+		}
+		uris = append(uris, host.URI)
+	}
+	data, err := json.MarshalIndent(uris, "", "  ")
+	if err != nil {
+		return 0, err
+	}
+	if _, err := w.Write(append(data, '\n')); err != nil {
+		return 0, err
+	}
+	return len(uris), nil
+}
+
+// parseHostEnode validates a host enode URI, which must include the node's
+// address for clients to connect to.
+func parseHostEnode(uri string) (store.NodeID, error) {
+	node, err := discv5.ParseNode(uri)
+	if err != nil {
+		return "", err
+	}
+	if node.Incomplete() {
+		return "", errors.New("missing host address")
+	}
+	return store.NodeID(node.ID.String()), nil
+}
+
+// ImportHosts reads a JSON list of enode URIs from r, such as one written by
+// ExportHosts, and adds them to the store as hosts. Hosts which are already
+// in the store are left unchanged. Imported hosts are inactive until they
+// connect to the pool. Invalid entries are skipped and returned, rather than
+// failing the import. It returns the number of hosts added.
+func ImportHosts(db store.PoolStore, r io.Reader) (imported int, invalid []InvalidEnodeError, err error) {
+	var entries []json.RawMessage
+	if err := json.NewDecoder(r).Decode(&entries); err != nil {
+		return 0, nil, err
+	}
+	for i, entry := range entries {
+		var uri string
+		if err := json.Unmarshal(entry, &uri); err != nil {
+			invalid = append(invalid, InvalidEnodeError{i, string(entry), errors.New("not a string")})
+			continue
+		}
+		nodeID, err := parseHostEnode(uri)
+		if err != nil {
+			invalid = append(invalid, InvalidEnodeError{i, uri, err})
+			continue
+		}
+		if _, err := db.GetNode(nodeID); err == nil {
+			continue
+		} else if err != store.ErrUnregisteredNode {
+			return imported, invalid, err
+		}
+		if err := db.SetNode(store.Node{ID: nodeID, URI: uri, IsHost: true}); err != nil {
+			return imported, invalid, err
+		}
+		imported++
+	}
+	return imported, invalid, nil
+}
@@ -0,0 +1,94 @@
+package pool
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/vipnode/vipnode/pool/store"
+	"github.com/vipnode/vipnode/pool/store/memory"
+)
+
+func TestExportImportHosts(t *testing.T) {
+	src := memory.New()
+	var uris []string
+	for i := 0; i < 3; i++ {
+		nodeID := store.NodeID(fmt.Sprintf("%0128x", i+1))
+		uri := fmt.Sprintf("enode://%s@10.0.0.%d:30303", nodeID, i+1)
+		uris = append(uris, uri)
+		if err := src.SetNode(store.Node{ID: nodeID, URI: uri, IsHost: true, Kind: "geth"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Clients aren't exported.
+	if err := src.SetNode(store.Node{ID: store.NodeID(fmt.Sprintf("%0128x", 100)), Kind: "geth"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	n, err := ExportHosts(src, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Errorf("exported %d hosts; want 3", n)
+	}
+
+	dst := memory.New()
+	// Existing hosts are kept as they are.
+	existing := store.Node{ID: store.NodeID(fmt.Sprintf("%0128x", 1)), URI: uris[0], IsHost: true, Kind: "parity"}
+	if err := dst.SetNode(existing); err != nil {
+		t.Fatal(err)
+	}
+	imported, invalid, err := ImportHosts(dst, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if imported != 2 || len(invalid) != 0 {
+		t.Errorf("got %d imported, %v invalid; want 2 imported", imported, invalid)
+	}
+	for i, uri := range uris {
+		node, err := dst.GetNode(store.NodeID(fmt.Sprintf("%0128x", i+1)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !node.IsHost || node.URI != uri {
+			t.Errorf("host %d was not imported: %+v", i, node)
+		}
+	}
+	if node, _ := dst.GetNode(existing.ID); node.Kind != "parity" {
+		t.Errorf("existing host was overwritten: %+v", node)
+	}
+}
+
+func TestImportHostsInvalid(t *testing.T) {
+	valid := fmt.Sprintf("enode://%0128x@10.0.0.1:30303", 1)
+	input := `[
+		"` + valid + `",
+		"enode://1234@10.0.0.2:30303",
+		"enode://` + fmt.Sprintf("%0128x", 2) + `",
+		"http://example.com/",
+		42,
+		"` + valid + `"
+	]`
+	db := memory.New()
+	imported, invalid, err := ImportHosts(db, strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if imported != 1 {
+		t.Errorf("got %d imported; want 1", imported)
+	}
+	var indices []int
+	for _, err := range invalid {
+		indices = append(indices, err.Index)
+	}
+	if fmt.Sprint(indices) != "[1 2 3 4]" {
+		t.Errorf("got invalid entries %v; want [1 2 3 4]: %v", indices, invalid)
+	}
+
+	if _, _, err := ImportHosts(db, strings.NewReader(`{"not": "a list"}`)); err == nil {
+		t.Error("expected error for a file which isn't a list")
+	}
+}
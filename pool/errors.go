@@ -1,10 +1,66 @@
 package pool
 
 import (
+	"errors"
 	"fmt"
 	"strings"
+	"time"
 )
 
+// ErrCodeDuplicateNode is the JSON-RPC error code of a DuplicateNodeError, so
+// that a rejected host can tell it apart from other errors.
+const ErrCodeDuplicateNode = -32010
+
+// ErrNotAllowed is returned by AllowList for nodes which are not on it.
+var ErrNotAllowed = errors.New("node is not on the allow list")
+
+// ErrNotAdmin is returned for admin method calls signed by a node which is
+// not one of the pool's Admins.
+var ErrNotAdmin = errors.New("node is not a pool admin")
+
+// ErrNotConnected is returned when disconnecting a client which isn't peered
+// with any hosts.
+var ErrNotConnected = errors.New("client is not connected to any hosts")
+
+// ErrNotPeered is returned for proxy calls from a client to a host which the
+// client isn't peered with.
+var ErrNotPeered = errors.New("client is not connected to the host")
+
+// ErrReportsDisabled is returned for error reports sent to a pool which
+// doesn't collect them.
+var ErrReportsDisabled = errors.New("pool does not collect error reports")
+
+// ReportTooSoonError is returned for error reports sent sooner after the
+// node's previous report than ErrorReports allows.
+type ReportTooSoonError struct {
+	Wait time.Duration
+}
+
+func (err ReportTooSoonError) Error() string {
+	return fmt.Sprintf("error report sent too soon, wait %s", err.Wait)
+}
+
+// DuplicateNodeError is returned when a host registers with the node ID of an
+// active host which is connected from a different address, which happens
+// when hosts share a node key, such as from cloned configs.
+type DuplicateNodeError struct {
+	NodeID string
+	// Source is the address of the rejected registration, and Existing is
+	// the address of the active host.
+	Source   string
+	Existing string
+}
+
+func (err DuplicateNodeError) Error() string {
+	return fmt.Sprintf("node ID %q is already registered by an active host from %s, rejecting it from %s: hosts can't share a node key", err.NodeID, err.Existing, err.Source)
+}
+
+// ErrorCode returns ErrCodeDuplicateNode, which DuplicateNodeError keeps
+// across RPC.
+func (err DuplicateNodeError) ErrorCode() int {
+	return ErrCodeDuplicateNode
+}
+
 // NoHostNodesError is returned when the pool does not have any hosts available.
 type NoHostNodesError struct {
 	NumTried int
@@ -28,6 +84,29 @@ func (err VerifyFailedError) Error() string {
 	return fmt.Sprintf("method %q failed to verify signature: %s", err.Method, err.Cause)
 }
 
+// UnauthorizedError is returned when the pool's Authorizer rejects a node. It
+// embeds the Cause returned by the Authorizer as the reason.
+type UnauthorizedError struct {
+	Cause  error
+	Method string
+}
+
+func (err UnauthorizedError) Error() string {
+	return fmt.Sprintf("method %q rejected by pool: %s", err.Method, err.Cause)
+}
+
+// GenesisMismatchError is returned when a node registers with a different
+// genesis block than the pool requires, such as a private network which
+// reuses a public network ID.
+type GenesisMismatchError struct {
+	Want string
+	Got  string
+}
+
+func (err GenesisMismatchError) Error() string {
+	return fmt.Sprintf("node genesis %s does not match the pool's chain genesis %s", err.Got, err.Want)
+}
+
 // RemoteHostErrors is used when a subset of RPC calls to hosts fail.
 type RemoteHostErrors struct {
 	Method string
@@ -0,0 +1,20 @@
+package pool
+
+import "github.com/vipnode/vipnode/pool/store"
+
+// Metrics receives instrumentation events from the pool, such as for
+// exporting to a monitoring system. It should be goroutine-safe.
+type Metrics interface {
+	// NodeRegistered is called when a host or client registers with the pool.
+	NodeRegistered(node store.Node)
+	// HostsAssigned is called when a client is given hosts to connect to.
+	HostsAssigned(client store.Node, hosts []store.Node)
+	// RPCError is called when a pool RPC method returns an error.
+	RPCError(method string, err error)
+}
+
+type noMetrics struct{}
+
+func (noMetrics) NodeRegistered(store.Node)              {}
+func (noMetrics) HostsAssigned(store.Node, []store.Node) {}
+func (noMetrics) RPCError(string, error)                 {}
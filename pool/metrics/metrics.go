@@ -0,0 +1,172 @@
+// Package metrics collects pool instrumentation and serves it in the
+// Prometheus text exposition format. It implements the format directly so
+// that the pool does not depend on the prometheus client libraries.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/vipnode/vipnode/pool"
+	"github.com/vipnode/vipnode/pool/store"
+)
+
+const namespace = "vipnode_pool"
+
+// contentType is the Prometheus text exposition format version 0.0.4.
+const contentType = "text/plain; version=0.0.4; charset=utf-8"
+
+var _ pool.Metrics = &Collector{}
+
+// Collector implements pool.Metrics by counting events, and http.Handler by
+// serving the counters along with gauges from the Store's Stats.
+type Collector struct {
+	// Store is queried for gauges whenever metrics are served. (Optional)
+	Store interface {
+		Stats() (*store.Stats, error)
+	}
+
+	mu          sync.Mutex
+	hosts       uint64
+	clients     uint64
+	assignments uint64
+	rpcErrors   map[string]uint64
+}
+
+// NodeRegistered counts host and client registrations.
+func (c *Collector) NodeRegistered(node store.Node) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if node.IsHost {
+		c.hosts += 1
+	} else {
+		c.clients += 1
+	}
+}
+
+// HostsAssigned counts each host that a client was given.
+func (c *Collector) HostsAssigned(client store.Node, hosts []store.Node) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.assignments += uint64(len(hosts))
+}
+
+// RPCError counts failed RPC calls by method.
+func (c *Collector) RPCError(method string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.rpcErrors == nil {
+		c.rpcErrors = map[string]uint64{}
+	}
+	c.rpcErrors[method] += 1
+}
+
+// ServeHTTP writes the current metrics, it's usually mounted on /metrics.
+func (c *Collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "unsupported method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var stats *store.Stats
+	if c.Store != nil {
+		var err error
+		if stats, err = c.Store.Stats(); err != nil {
+			http.Error(w, fmt.Sprintf("failed to load store stats: %s", err), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	c.write(w, stats)
+}
+
+// write writes the counters, and gauges from stats if it's not nil, to w.
+func (c *Collector) write(w io.Writer, stats *store.Stats) error {
+	c.mu.Lock()
+	counters := []struct {
+		name, help string
+		value      uint64
+	}{
+		{"hosts_total", "Number of host registrations.", c.hosts},
+		{"clients_total", "Number of client registrations.", c.clients},
+		{"assignments_total", "Number of hosts assigned to clients.", c.assignments},
+	}
+	methods := make([]string, 0, len(c.rpcErrors))
+	for method := range c.rpcErrors {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	rpcErrors := make([]uint64, len(methods))
+	for i, method := range methods {
+		rpcErrors[i] = c.rpcErrors[method]
+	}
+	c.mu.Unlock()
+
+	m := metricWriter{w: w}
+	for _, counter := range counters {
+		m.header(counter.name, "counter", counter.help)
+		m.sample(counter.name, "", fmt.Sprint(counter.value))
+	}
+	m.header("rpc_errors_total", "counter", "Number of failed RPC calls.")
+	for i, method := range methods {
+		m.sample("rpc_errors_total", fmt.Sprintf("method=%q", method), fmt.Sprint(rpcErrors[i]))
+	}
+
+	if stats == nil {
+		return m.err
+	}
+	gauges := []struct {
+		name, help string
+		value      string
+	}{
+		{"active_hosts", "Number of hosts seen recently.", fmt.Sprint(stats.NumActiveHosts)},
+		{"hosts", "Number of hosts in the store.", fmt.Sprint(stats.NumTotalHosts)},
+		{"active_clients", "Number of clients seen recently.", fmt.Sprint(stats.NumActiveClients)},
+		{"clients", "Number of clients in the store.", fmt.Sprint(stats.NumTotalClients)},
+		{"latest_block_number", "Highest block number reported by a node.", fmt.Sprint(stats.LatestBlockNumber)},
+		{"trial_balances", "Number of trial balances.", fmt.Sprint(stats.NumTrialBalances)},
+		{"credit_wei", "Sum of balance credit.", bigFloat(&stats.TotalCredit)},
+		{"deposit_wei", "Sum of balance deposits.", bigFloat(&stats.TotalDeposit)},
+	}
+	for _, gauge := range gauges {
+		m.header(gauge.name, "gauge", gauge.help)
+		m.sample(gauge.name, "", gauge.value)
+	}
+	return m.err
+}
+
+// bigFloat formats a big.Int as a sample value, which are all float64.
+func bigFloat(i *big.Int) string {
+	f, _ := new(big.Float).SetInt(i).Float64()
+	return fmt.Sprint(f)
+}
+
+// metricWriter writes the exposition format, retaining the first error.
+type metricWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (m *metricWriter) printf(format string, args ...interface{}) {
+	if m.err != nil {
+		return
+	}
+	_, m.err = fmt.Fprintf(m.w, format, args...)
+}
+
+func (m *metricWriter) header(name, kind, help string) {
+	m.printf("# HELP %s_%s %s\n", namespace, name, help)
+	m.printf("# TYPE %s_%s %s\n", namespace, name, kind)
+}
+
+func (m *metricWriter) sample(name, labels, value string) {
+	if labels != "" {
+		labels = "{" + labels + "}"
+	}
+	m.printf("%s_%s%s %s\n", namespace, name, labels, value)
+}
@@ -0,0 +1,96 @@
+package metrics
+
+import (
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vipnode/vipnode/pool/store"
+	"github.com/vipnode/vipnode/pool/store/memory"
+)
+
+func scrape(t *testing.T, c *Collector) string {
+	t.Helper()
+	w := httptest.NewRecorder()
+	c.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d", w.Code)
+	}
+	if got := w.Header().Get("Content-Type"); got != contentType {
+		t.Errorf("unexpected content type: %q", got)
+	}
+	return w.Body.String()
+}
+
+func TestCollector(t *testing.T) {
+	c := &Collector{}
+
+	body := scrape(t, c)
+	for _, line := range []string{
+		"vipnode_pool_hosts_total 0\n",
+		"vipnode_pool_clients_total 0\n",
+		"vipnode_pool_assignments_total 0\n",
+		"# TYPE vipnode_pool_rpc_errors_total counter\n",
+	} {
+		if !strings.Contains(body, line) {
+			t.Errorf("missing %q in:\n%s", line, body)
+		}
+	}
+
+	host := store.Node{ID: "a", IsHost: true}
+	client := store.Node{ID: "b"}
+	c.NodeRegistered(host)
+	c.NodeRegistered(host)
+	c.NodeRegistered(client)
+	c.HostsAssigned(client, []store.Node{host})
+	c.RPCError("vipnode_client", errors.New("no hosts"))
+	c.RPCError("vipnode_client", errors.New("no hosts"))
+	c.RPCError("vipnode_update", errors.New("unregistered"))
+
+	body = scrape(t, c)
+	for _, line := range []string{
+		"vipnode_pool_hosts_total 2\n",
+		"vipnode_pool_clients_total 1\n",
+		"vipnode_pool_assignments_total 1\n",
+		`vipnode_pool_rpc_errors_total{method="vipnode_client"} 2` + "\n",
+		`vipnode_pool_rpc_errors_total{method="vipnode_update"} 1` + "\n",
+	} {
+		if !strings.Contains(body, line) {
+			t.Errorf("missing %q in:\n%s", line, body)
+		}
+	}
+	if strings.Contains(body, "vipnode_pool_active_hosts") {
+		t.Errorf("unexpected gauges without a store:\n%s", body)
+	}
+}
+
+func TestCollectorStats(t *testing.T) {
+	s := memory.New()
+	defer s.Close()
+	if err := s.SetNode(store.Node{ID: "a", IsHost: true, LastSeen: time.Now(), BlockNumber: 42}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetNode(store.Node{ID: "b", LastSeen: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddAccountBalance("foo", big.NewInt(1000)); err != nil {
+		t.Fatal(err)
+	}
+
+	body := scrape(t, &Collector{Store: s})
+	for _, line := range []string{
+		"# TYPE vipnode_pool_active_hosts gauge\n",
+		"vipnode_pool_active_hosts 1\n",
+		"vipnode_pool_active_clients 1\n",
+		"vipnode_pool_latest_block_number 42\n",
+		"vipnode_pool_credit_wei 1000\n",
+	} {
+		if !strings.Contains(body, line) {
+			t.Errorf("missing %q in:\n%s", line, body)
+		}
+	}
+}
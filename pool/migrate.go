@@ -0,0 +1,88 @@
+package pool
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/vipnode/vipnode/internal/pretty"
+	"github.com/vipnode/vipnode/jsonrpc2"
+	"github.com/vipnode/vipnode/pool/store"
+)
+
+// poolMigrateTimeout is how long the client has to connect to the new host
+// and confirm it.
+var poolMigrateTimeout = 30 * time.Second
+
+// MigrateClient moves a client from one host to another without leaving it
+// disconnected in between, such as to take a host down for maintenance:
+//
+//  1. The new host whitelists the client.
+//  2. The client is instructed to connect to the new host, and responds once
+//     it's connected.
+//  3. The old host is released, dropping the client.
+//
+// If the client fails to connect to the new host, the new host's whitelist is
+// reverted and the client stays on the old host.
+//
+// MigrateClient is a function rather than a VipnodePool method so that it's
+// not exposed over the pool's RPC API.
+func MigrateClient(ctx context.Context, p *VipnodePool, clientID store.NodeID, fromHostID store.NodeID, toHostID store.NodeID) error {
+	toHost, err := p.Store.GetNode(toHostID)
+	if err != nil {
+		return err
+	}
+	if !toHost.IsHost {
+		return fmt.Errorf("migrate target is not a host: %q", toHostID)
+	}
+
+	p.mu.Lock()
+	client, clientOk := p.remoteClients[clientID]
+	fromRemote, fromOk := p.remoteHosts[fromHostID]
+	toRemote, toOk := p.remoteHosts[toHostID]
+	p.mu.Unlock()
+	switch {
+	case !clientOk:
+		return fmt.Errorf("missing remote service for client: %q", clientID)
+	case !fromOk:
+		return fmt.Errorf("missing remote service for host: %q", fromHostID)
+	case !toOk:
+		return fmt.Errorf("missing remote service for host: %q", toHostID)
+	}
+
+	callCtx, cancel := context.WithTimeout(ctx, poolWhitelistTimeout)
+	err = toRemote.Call(callCtx, nil, "vipnode_whitelist", string(clientID))
+	cancel()
+	if err != nil {
+		return RemoteHostErrors{"vipnode_whitelist", []error{err}}
+	}
+
+	callCtx, cancel = context.WithTimeout(ctx, poolMigrateTimeout)
+	err = client.Call(callCtx, nil, "vipnode_migrate", MigrateRequest{
+		Host:       advertiseHost(*toHost, remoteHostname(toRemote), remoteHostname(client)),
+		FromHostID: fromHostID,
+	})
+	cancel()
+	if err != nil {
+		// The client is still on the old host, so only undo the whitelist.
+		if revertErr := releaseClient(ctx, toRemote, clientID); revertErr != nil {
+			logger.Printf("Failed to revert whitelist of client %q on host %q: %s", pretty.Abbrev(string(clientID)), pretty.Abbrev(string(toHostID)), revertErr)
+		}
+		return err
+	}
+	p.audit(AuditMigrate, clientID, toHostID, "from "+string(fromHostID))
+
+	if err := releaseClient(ctx, fromRemote, clientID); err != nil {
+		return RemoteHostErrors{"vipnode_disconnect", []error{err}}
+	}
+	logger.Printf("Migrated client %q from host %q to %q", pretty.Abbrev(string(clientID)), pretty.Abbrev(string(fromHostID)), pretty.Abbrev(string(toHostID)))
+	return nil
+}
+
+// releaseClient asks a host to disconnect the client and remove it from its
+// whitelist.
+func releaseClient(ctx context.Context, host jsonrpc2.Service, clientID store.NodeID) error {
+	callCtx, cancel := context.WithTimeout(ctx, poolWhitelistTimeout)
+	defer cancel()
+	return host.Call(callCtx, nil, "vipnode_disconnect", string(clientID))
+}
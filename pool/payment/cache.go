@@ -78,3 +78,23 @@ func (b *balanceCache) Get(account store.Account) (*big.Int, error) {
 	b.Set(account, val)
 	return val, nil
 }
+
+// Lookup returns the cached value for account without falling back to the
+// Getter, or nil if it's missing or expired.
+func (b *balanceCache) Lookup(account store.Account) *big.Int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	r, ok := b.cache[account]
+	if !ok || (!r.expire.IsZero() && !b.now().Before(r.expire)) {
+		return nil
+	}
+	return r.value
+}
+
+// Delete clears the cached value for account, so that the next Get uses the
+// Getter.
+func (b *balanceCache) Delete(account store.Account) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.cache, account)
+}
@@ -0,0 +1,241 @@
+package payment
+
+import (
+	"context"
+	"math/big"
+	"sync"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/vipnode/vipnode-contract/go/vipnodepool"
+	"github.com/vipnode/vipnode/pool/store"
+)
+
+// DefaultConfirmDepth is how many blocks a balance event is re-checked for,
+// after which the transaction is considered final.
+const DefaultConfirmDepth = 12
+
+// DefaultConfirmations is how many confirmations a balance event needs before
+// it's credited on networks without an entry in NetworkConfirmations.
+const DefaultConfirmations = 12
+
+// NetworkConfirmations are the default confirmations for balance events by
+// network name. Proof of authority and proof of stake testnets rarely reorg,
+// while Classic has been reorged by attacks.
+var NetworkConfirmations = map[string]uint64{
+	"mainnet": 12,
+	"classic": 100,
+	"ropsten": 12,
+	"rinkeby": 3,
+	"goerli":  3,
+	"kovan":   3,
+	"sepolia": 3,
+	"holesky": 3,
+}
+
+// Confirmations returns the default confirmations for the network name.
+func Confirmations(network string) uint64 {
+	if n, ok := NetworkConfirmations[network]; ok {
+		return n
+	}
+	return DefaultConfirmations
+}
+
+// headReader is the part of ethclient.Client that's used to re-check the
+// blocks that balance events were included in.
+type headReader interface {
+	HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error)
+	SubscribeNewHead(ctx context.Context, ch chan<- *types.Header) (ethereum.Subscription, error)
+}
+
+// inclusion is a balance event which is not yet final.
+type inclusion struct {
+	account     store.Account
+	balance     *big.Int
+	txHash      common.Hash
+	blockNumber uint64
+	blockHash   common.Hash
+	// credited is set once the event is applied to the cache.
+	credited bool
+	// before is the cached balance before the event was credited, or nil if
+	// it wasn't cached.
+	before *big.Int
+}
+
+// confirmWatcher applies balance events to a balanceCache once they have
+// enough confirmations, and reverts them if a chain reorg drops the
+// transaction before it's final.
+type confirmWatcher struct {
+	// Depth is how many blocks an event is re-checked for. Defaults to
+	// DefaultConfirmDepth, or Confirmations if it's deeper.
+	Depth uint64
+	// Confirmations is how many blocks, including the one the event is in,
+	// must be on the chain before the event is credited. Events are credited
+	// right away if it's 0 or 1.
+	Confirmations uint64
+	// Headers returns the canonical header at a block number.
+	Headers func(ctx context.Context, number uint64) (*types.Header, error)
+	Cache   *balanceCache
+
+	mu      sync.Mutex
+	pending []inclusion
+}
+
+func (w *confirmWatcher) depth() uint64 {
+	depth := w.Depth
+	if depth == 0 {
+		depth = DefaultConfirmDepth
+	}
+	if w.Confirmations > depth {
+		return w.Confirmations
+	}
+	return depth
+}
+
+// confirmed returns whether the event has enough confirmations at head.
+func (w *confirmWatcher) confirmed(inc inclusion, head uint64) bool {
+	return head >= inc.blockNumber && head-inc.blockNumber+1 >= w.Confirmations
+}
+
+// credit applies the event to the cache, must hold the w.mu lock.
+func (w *confirmWatcher) credit(inc *inclusion) {
+	inc.before = w.Cache.Lookup(inc.account)
+	inc.credited = true
+	w.Cache.Set(inc.account, inc.balance)
+}
+
+// Apply tracks a balance event, updating the cache if it doesn't need more
+// than one confirmation. Events which were removed by a reorg revert the
+// corresponding pending event.
+func (w *confirmWatcher) Apply(event *vipnodepool.VipnodePoolBalance) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if event.Raw.Removed {
+		w.revert(func(inc inclusion) bool {
+			return inc.txHash == event.Raw.TxHash && inc.blockHash == event.Raw.BlockHash
+		})
+		return
+	}
+
+	inc := inclusion{
+		account:     store.Account(event.Account.Hex()),
+		balance:     event.Balance,
+		txHash:      event.Raw.TxHash,
+		blockNumber: event.Raw.BlockNumber,
+		blockHash:   event.Raw.BlockHash,
+	}
+	if w.Confirmations <= 1 {
+		w.credit(&inc)
+	}
+	w.pending = append(w.pending, inc)
+}
+
+// OnHead re-checks the pending events against the canonical chain up to the
+// new head, reverting any whose block was replaced, crediting any with enough
+// confirmations, and dropping any that are now final.
+func (w *confirmWatcher) OnHead(ctx context.Context, head *types.Header) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	headNumber := head.Number.Uint64()
+	canonical := map[uint64]common.Hash{}
+	for _, inc := range w.pending {
+		if inc.blockNumber > headNumber {
+			// Ahead of the head we were given, check it next time.
+			continue
+		}
+		if _, ok := canonical[inc.blockNumber]; ok {
+			continue
+		}
+		header, err := w.Headers(ctx, inc.blockNumber)
+		if err != nil {
+			return err
+		}
+		canonical[inc.blockNumber] = header.Hash()
+	}
+
+	w.revert(func(inc inclusion) bool {
+		hash, ok := canonical[inc.blockNumber]
+		return ok && hash != inc.blockHash
+	})
+
+	for i := range w.pending {
+		inc := &w.pending[i]
+		if !inc.credited && w.confirmed(*inc, headNumber) {
+			logger.Printf("Crediting balance event for account %q after %d confirmations: tx %s", inc.account, headNumber-inc.blockNumber+1, inc.txHash.Hex())
+			w.credit(inc)
+		}
+	}
+
+	pending := w.pending[:0]
+	for _, inc := range w.pending {
+		if !inc.credited || inc.blockNumber+w.depth() > headNumber {
+			pending = append(pending, inc)
+		}
+	}
+	w.pending = pending
+	return nil
+}
+
+// revert undoes the pending events matched by dropped, newest first, so that
+// each account is restored to its balance before the earliest dropped event.
+// An account keeps its balance if a later credited event still stands, and
+// events which weren't credited yet are only forgotten. Must hold the w.mu
+// lock.
+func (w *confirmWatcher) revert(dropped func(inc inclusion) bool) {
+	kept := map[store.Account]bool{}
+	var remaining []inclusion
+	for i := len(w.pending) - 1; i >= 0; i-- {
+		inc := w.pending[i]
+		if !dropped(inc) {
+			if inc.credited {
+				kept[inc.account] = true
+			}
+			remaining = append(remaining, inc)
+			continue
+		}
+		if !inc.credited {
+			logger.Printf("Dropping uncredited balance event for account %q: tx %s was removed from block %d by a chain reorg", inc.account, inc.txHash.Hex(), inc.blockNumber)
+			continue
+		}
+		logger.Printf("Reverting balance event for account %q: tx %s was dropped from block %d by a chain reorg", inc.account, inc.txHash.Hex(), inc.blockNumber)
+		if kept[inc.account] {
+			continue
+		}
+		if inc.before == nil {
+			w.Cache.Delete(inc.account)
+		} else {
+			w.Cache.Set(inc.account, inc.before)
+		}
+	}
+	// remaining was collected newest first
+	for i, j := 0, len(remaining)-1; i < j; i, j = i+1, j-1 {
+		remaining[i], remaining[j] = remaining[j], remaining[i]
+	}
+	w.pending = remaining
+}
+
+// WatchHeads calls OnHead with each new head from chain until ctx is done or
+// the subscription fails.
+func (w *confirmWatcher) WatchHeads(ctx context.Context, chain headReader) error {
+	heads := make(chan *types.Header, 1)
+	sub, err := chain.SubscribeNewHead(ctx, heads)
+	if err != nil {
+		return err
+	}
+	defer sub.Unsubscribe()
+	for {
+		select {
+		case head := <-heads:
+			if err := w.OnHead(ctx, head); err != nil {
+				logger.Printf("Failed to re-check balance events at block %d: %s", head.Number, err)
+			}
+		case err := <-sub.Err():
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,296 @@
+package payment
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/vipnode/vipnode-contract/go/vipnodepool"
+	"github.com/vipnode/vipnode/pool/store"
+)
+
+// fakeChain is a chain of headers, which can be forked to simulate a reorg.
+type fakeChain struct {
+	headers []*types.Header
+}
+
+func (c *fakeChain) extend(n int, fork string) {
+	for i := 0; i < n; i++ {
+		number := len(c.headers)
+		c.headers = append(c.headers, &types.Header{
+			Number: big.NewInt(int64(number)),
+			Extra:  []byte(fmt.Sprintf("%s-%d", fork, number)),
+		})
+	}
+}
+
+// fork replaces the chain from number onwards with n new headers.
+func (c *fakeChain) fork(number int, n int, fork string) {
+	c.headers = c.headers[:number]
+	c.extend(n, fork)
+}
+
+func (c *fakeChain) head() *types.Header {
+	return c.headers[len(c.headers)-1]
+}
+
+func (c *fakeChain) Headers(ctx context.Context, number uint64) (*types.Header, error) {
+	if number >= uint64(len(c.headers)) {
+		return nil, fmt.Errorf("unknown block: %d", number)
+	}
+	return c.headers[number], nil
+}
+
+func (c *fakeChain) balanceEvent(number int, account common.Address, balance int64, tx string) *vipnodepool.VipnodePoolBalance {
+	return &vipnodepool.VipnodePoolBalance{
+		Account: account,
+		Balance: big.NewInt(balance),
+		Raw: types.Log{
+			BlockNumber: uint64(number),
+			BlockHash:   c.headers[number].Hash(),
+			TxHash:      common.HexToHash(tx),
+		},
+	}
+}
+
+func TestConfirmWatcherReorg(t *testing.T) {
+	ctx := context.Background()
+	addr := common.HexToAddress("0x961Aa96FebeE5465149a0787B03bFa14D8e9033F")
+	account := store.Account(addr.Hex())
+	cache := &balanceCache{
+		Getter: func(account store.Account) (*big.Int, error) {
+			return big.NewInt(0), nil
+		},
+	}
+	chain := &fakeChain{}
+	chain.extend(10, "a")
+	w := &confirmWatcher{Depth: 5, Headers: chain.Headers, Cache: cache}
+
+	assertBalance := func(want int64) {
+		t.Helper()
+		got, err := cache.Get(account)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Cmp(big.NewInt(want)) != 0 {
+			t.Errorf("balance: got %d; want %d", got, want)
+		}
+	}
+
+	cache.Set(account, big.NewInt(100))
+	deposit := chain.balanceEvent(9, addr, 1100, "0x01")
+	w.Apply(deposit)
+	chain.extend(1, "a")
+	if err := w.OnHead(ctx, chain.head()); err != nil {
+		t.Fatal(err)
+	}
+	assertBalance(1100)
+
+	// A reorg replaces the deposit's block, the deposit is reverted.
+	chain.fork(8, 3, "b")
+	if err := w.OnHead(ctx, chain.head()); err != nil {
+		t.Fatal(err)
+	}
+	assertBalance(100)
+	if len(w.pending) != 0 {
+		t.Errorf("expected reverted event to stop being tracked, got: %v", w.pending)
+	}
+
+	// The deposit is included again on the new chain, and becomes final.
+	redeposit := chain.balanceEvent(10, addr, 1100, "0x01")
+	w.Apply(redeposit)
+	chain.extend(5, "b")
+	if err := w.OnHead(ctx, chain.head()); err != nil {
+		t.Fatal(err)
+	}
+	assertBalance(1100)
+	if len(w.pending) != 0 {
+		t.Errorf("expected final event to stop being tracked, got: %v", w.pending)
+	}
+}
+
+func TestConfirmWatcherRemoved(t *testing.T) {
+	ctx := context.Background()
+	addr := common.HexToAddress("0x961Aa96FebeE5465149a0787B03bFa14D8e9033F")
+	account := store.Account(addr.Hex())
+	fetched := big.NewInt(42)
+	cache := &balanceCache{
+		Getter: func(account store.Account) (*big.Int, error) {
+			return fetched, nil
+		},
+	}
+	chain := &fakeChain{}
+	chain.extend(10, "a")
+	w := &confirmWatcher{Headers: chain.Headers, Cache: cache}
+
+	// Not cached before the deposit, so reverting it falls back to the
+	// Getter.
+	deposit := chain.balanceEvent(8, addr, 1000, "0x01")
+	withdraw := chain.balanceEvent(9, addr, 500, "0x02")
+	w.Apply(deposit)
+	w.Apply(withdraw)
+	if got := cache.Lookup(account); got == nil || got.Int64() != 500 {
+		t.Fatalf("expected balance of last event, got: %v", got)
+	}
+
+	// Removing the later event restores the earlier one.
+	removed := *withdraw
+	removed.Raw.Removed = true
+	w.Apply(&removed)
+	if got := cache.Lookup(account); got == nil || got.Int64() != 1000 {
+		t.Errorf("expected balance before the removed event, got: %v", got)
+	}
+
+	removed = *deposit
+	removed.Raw.Removed = true
+	w.Apply(&removed)
+	if got := cache.Lookup(account); got != nil {
+		t.Errorf("expected uncached balance, got: %v", got)
+	}
+	if got, err := cache.Get(account); err != nil || got.Cmp(fetched) != 0 {
+		t.Errorf("expected fetched balance, got: %v %v", got, err)
+	}
+
+	if err := w.OnHead(ctx, chain.head()); err != nil {
+		t.Fatal(err)
+	}
+	if len(w.pending) != 0 {
+		t.Errorf("expected no pending events, got: %v", w.pending)
+	}
+}
+
+func TestConfirmWatcherConfirmations(t *testing.T) {
+	ctx := context.Background()
+	addr := common.HexToAddress("0x961Aa96FebeE5465149a0787B03bFa14D8e9033F")
+	account := store.Account(addr.Hex())
+	cache := &balanceCache{}
+	chain := &fakeChain{}
+	chain.extend(10, "a")
+	w := &confirmWatcher{Confirmations: 3, Headers: chain.Headers, Cache: cache}
+
+	cache.Set(account, big.NewInt(100))
+	w.Apply(chain.balanceEvent(9, addr, 1100, "0x01"))
+
+	for _, want := range []int64{100, 100, 1100} {
+		if err := w.OnHead(ctx, chain.head()); err != nil {
+			t.Fatal(err)
+		}
+		confirmations := chain.head().Number.Int64() - 8
+		if got := cache.Lookup(account); got == nil || got.Int64() != want {
+			t.Errorf("after %d confirmations: got balance %v; want %d", confirmations, got, want)
+		}
+		chain.extend(1, "a")
+	}
+
+	// A reorg before the threshold drops the deposit without crediting it.
+	w.Apply(chain.balanceEvent(12, addr, 2100, "0x02"))
+	chain.extend(1, "a")
+	if err := w.OnHead(ctx, chain.head()); err != nil {
+		t.Fatal(err)
+	}
+	chain.fork(12, 3, "b")
+	if err := w.OnHead(ctx, chain.head()); err != nil {
+		t.Fatal(err)
+	}
+	if got := cache.Lookup(account); got == nil || got.Int64() != 1100 {
+		t.Errorf("after reorg: got balance %v; want 1100", got)
+	}
+	for _, inc := range w.pending {
+		if inc.txHash == common.HexToHash("0x02") {
+			t.Errorf("expected dropped deposit to stop being tracked: %v", inc)
+		}
+	}
+}
+
+// depositBackend is a contract backend on a fakeChain, where the account has
+// a balance of before until the deposit block, and after from then on,
+// including the pending state.
+type depositBackend struct {
+	bind.ContractBackend
+	*fakeChain
+	deposit       uint64
+	before, after int64
+}
+
+func (b *depositBackend) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	if number == nil {
+		return b.head(), nil
+	}
+	return b.Headers(ctx, number.Uint64())
+}
+
+func (b *depositBackend) SubscribeNewHead(ctx context.Context, ch chan<- *types.Header) (ethereum.Subscription, error) {
+	return nil, fmt.Errorf("not implemented")
+}
+
+func (b *depositBackend) accounts(balance int64) ([]byte, error) {
+	parsed, err := abi.JSON(strings.NewReader(vipnodepool.VipnodePoolABI))
+	if err != nil {
+		return nil, err
+	}
+	return parsed.Methods["accounts"].Outputs.Pack(big.NewInt(balance), big.NewInt(0))
+}
+
+func (b *depositBackend) CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	if blockNumber != nil && blockNumber.Uint64() < b.deposit {
+		return b.accounts(b.before)
+	}
+	return b.accounts(b.after)
+}
+
+func (b *depositBackend) PendingCallContract(ctx context.Context, call ethereum.CallMsg) ([]byte, error) {
+	return b.accounts(b.after)
+}
+
+func TestContractBalanceConfirmations(t *testing.T) {
+	addr := common.HexToAddress("0x961Aa96FebeE5465149a0787B03bFa14D8e9033F")
+	account := store.Account(addr.Hex())
+	chain := &fakeChain{}
+	chain.extend(10, "a")
+	backend := &depositBackend{fakeChain: chain, deposit: 9, before: 100, after: 1100}
+	contract, err := vipnodepool.NewVipnodePool(common.Address{}, backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &contractPayment{contract: contract, backend: backend, confirmations: 3, chain: backend}
+	p.balanceCache.Getter = p.GetBalance
+
+	// The deposit has 1 of 3 confirmations, so a cache miss must not credit
+	// it.
+	if got, err := p.balanceCache.Get(account); err != nil || got.Int64() != 100 {
+		t.Errorf("before the threshold: got balance %v (%v); want 100", got, err)
+	}
+
+	chain.extend(2, "a")
+	p.balanceCache.Delete(account)
+	if got, err := p.balanceCache.Get(account); err != nil || got.Int64() != 1100 {
+		t.Errorf("at the threshold: got balance %v (%v); want 1100", got, err)
+	}
+
+	// Without confirmations, the pending state is read.
+	p.confirmations = 0
+	p.balanceCache.Delete(account)
+	backend.deposit = 100
+	if got, err := p.balanceCache.Get(account); err != nil || got.Int64() != 1100 {
+		t.Errorf("without confirmations: got balance %v (%v); want 1100", got, err)
+	}
+}
+
+func TestConfirmations(t *testing.T) {
+	if got := Confirmations("rinkeby"); got != NetworkConfirmations["rinkeby"] {
+		t.Errorf("rinkeby: got %d", got)
+	}
+	if got := Confirmations("classic"); got <= Confirmations("mainnet") {
+		t.Errorf("expected classic to require more confirmations than mainnet, got %d", got)
+	}
+	if got := Confirmations("unknown"); got != DefaultConfirmations {
+		t.Errorf("unknown network: got %d; want %d", got, DefaultConfirmations)
+	}
+}
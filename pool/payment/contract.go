@@ -9,6 +9,7 @@ import (
 
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/vipnode/vipnode-contract/go/vipnodepool"
 	"github.com/vipnode/vipnode/pool/store"
 )
@@ -30,19 +31,26 @@ var zeroInt = &big.Int{}
 // is timelocked.
 var ErrDepositTimelocked = errors.New("deposit is timelocked")
 
+// ErrConfirmationsUnsupported is returned when balance events require
+// confirmations but the contract backend can't subscribe to new heads.
+var ErrConfirmationsUnsupported = errors.New("contract backend does not support counting confirmations")
+
 // ContractPayment returns an abstraction around a vipnode pool payment
-// contract. Contract implements store.NodeBalanceStore.
-func ContractPayment(storeDriver store.AccountStore, address common.Address, backend bind.ContractBackend, transactOpts *bind.TransactOpts) (*contractPayment, error) {
+// contract. Contract implements store.NodeBalanceStore. Balance events are
+// credited once they have the given number of confirmations, which requires a
+// backend that can subscribe to new heads if it's more than 1.
+func ContractPayment(storeDriver store.AccountStore, address common.Address, backend bind.ContractBackend, transactOpts *bind.TransactOpts, confirmations uint64) (*contractPayment, error) {
 	contract, err := vipnodepool.NewVipnodePool(address, backend)
 	if err != nil {
 		return nil, err
 	}
 	p := &contractPayment{
-		store:        storeDriver,
-		address:      address,
-		contract:     contract,
-		backend:      backend,
-		transactOpts: transactOpts,
+		store:         storeDriver,
+		address:       address,
+		contract:      contract,
+		backend:       backend,
+		transactOpts:  transactOpts,
+		confirmations: confirmations,
 	}
 
 	if transactOpts != nil {
@@ -61,9 +69,32 @@ func ContractPayment(storeDriver store.AccountStore, address common.Address, bac
 	}
 	// Setup cache getter and subscribe to the event-based value fill
 	p.balanceCache.Getter = p.GetBalance
-	if err := p.SubscribeBalance(context.Background(), p.balanceCache.Set); err != nil {
+	chain, ok := backend.(headReader)
+	if !ok && confirmations > 1 {
+		return nil, ErrConfirmationsUnsupported
+	} else if !ok {
+		if err := p.SubscribeBalance(context.Background(), p.balanceCache.Set); err != nil {
+			return nil, err
+		}
+		return p, nil
+	}
+	p.chain = chain
+
+	// Re-check the events against new heads, in case a reorg drops them.
+	watcher := &confirmWatcher{
+		Headers: func(ctx context.Context, number uint64) (*types.Header, error) {
+			return chain.HeaderByNumber(ctx, new(big.Int).SetUint64(number))
+		},
+		Cache:         &p.balanceCache,
+		Confirmations: confirmations,
+	}
+	if err := p.watchBalance(context.Background(), watcher.Apply); err != nil {
 		return nil, err
 	}
+	go func() {
+		err := watcher.WatchHeads(context.Background(), chain)
+		logger.Printf("Stopped re-checking balance events for reorgs: %s", err)
+	}()
 	return p, nil
 }
 
@@ -77,6 +108,12 @@ type contractPayment struct {
 	backend      bind.ContractBackend
 	balanceCache balanceCache
 	transactOpts *bind.TransactOpts
+
+	// confirmations is how many confirmations balance events need before
+	// they're credited, and chain is used to find the latest block with
+	// that many. The pending state is read if it's 0 or 1.
+	confirmations uint64
+	chain         headReader
 }
 
 // GetNodeBalance proxies the normal store implementation
@@ -127,7 +164,20 @@ func (p *contractPayment) AddAccountBalance(account store.Account, credit *big.I
 	return p.store.AddAccountBalance(account, credit)
 }
 
+// SubscribeBalance calls handler with the new balance of an account whenever
+// it changes on the contract. Events removed by a chain reorg are skipped.
 func (p *contractPayment) SubscribeBalance(ctx context.Context, handler func(account store.Account, amount *big.Int)) error {
+	return p.watchBalance(ctx, func(balanceEvent *vipnodepool.VipnodePoolBalance) {
+		if balanceEvent.Raw.Removed {
+			return
+		}
+		go handler(store.Account(balanceEvent.Account.Hex()), balanceEvent.Balance)
+	})
+}
+
+// watchBalance calls handler with each balance event in order, including
+// events removed by a chain reorg.
+func (p *contractPayment) watchBalance(ctx context.Context, handler func(balanceEvent *vipnodepool.VipnodePoolBalance)) error {
 	sink := make(chan *vipnodepool.VipnodePoolBalance, 1)
 	sub, err := p.contract.WatchBalance(&bind.WatchOpts{
 		Context: ctx,
@@ -141,7 +191,7 @@ func (p *contractPayment) SubscribeBalance(ctx context.Context, handler func(acc
 			case balanceEvent := <-sink:
 				account := store.Account(balanceEvent.Account.Hex())
 				logger.Printf("SubscribeBalance: Processing event for account: %s", account)
-				go handler(account, balanceEvent.Balance)
+				handler(balanceEvent)
 			case err := <-sub.Err():
 				return err
 			case <-ctx.Done():
@@ -178,7 +228,11 @@ func (p *contractPayment) GetBalance(account store.Account) (*big.Int, error) {
 		return nil, errors.New("failed to get balance: empty account")
 	}
 	timer := time.Now()
-	r, err := p.contract.Accounts(&bind.CallOpts{Pending: true}, common.HexToAddress(string(account)))
+	opts, err := p.callOpts(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	r, err := p.contract.Accounts(opts, common.HexToAddress(string(account)))
 	if err != nil {
 		return nil, err
 	}
@@ -189,6 +243,25 @@ func (p *contractPayment) GetBalance(account store.Account) (*big.Int, error) {
 	return r.Balance, nil
 }
 
+// callOpts returns the options for reading balances from the contract. If
+// balance events need more than one confirmation, balances are read at the
+// latest block which has them, so that deposits which the confirmWatcher
+// hasn't credited yet aren't credited through a cache miss either.
+func (p *contractPayment) callOpts(ctx context.Context) (*bind.CallOpts, error) {
+	if p.confirmations <= 1 || p.chain == nil {
+		return &bind.CallOpts{Pending: true}, nil
+	}
+	head, err := p.chain.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	number := uint64(0)
+	if head.Number.Uint64()+1 > p.confirmations {
+		number = head.Number.Uint64() + 1 - p.confirmations
+	}
+	return &bind.CallOpts{BlockNumber: new(big.Int).SetUint64(number), Context: ctx}, nil
+}
+
 // OpSettle replaces the current on-chain balance for account with newBalance
 // and disburses withdrawAmount to the account wallet.
 func (p *contractPayment) OpSettle(account store.Account, paymentAmount *big.Int, newBalance *big.Int) (tx string, err error) {
@@ -2,12 +2,14 @@ package pool
 
 import (
 	"context"
+	"encoding/json"
+	"time"
 
+	"github.com/vipnode/vipnode/pool/balance"
 	"github.com/vipnode/vipnode/pool/store"
 )
 
-// TODO: Add HostRequest.Network and ClientRequest.Network?
-// TODO: Add HostRequest.HostVersion?
+// TODO: Add ClientRequest.Network?
 
 // HostRequest is the request type for Host RPC calls.
 type HostRequest struct {
@@ -19,16 +21,52 @@ type HostRequest struct {
 	// separate IP from the actual node host. Otherwise, the pool will
 	// automatically use the same IP and default port as the host connecting.
 	NodeURI string `json:"node_uri,omitempty"`
+	// InternalNodeURI is the host's enode:// URI on its private network, if
+	// it also serves clients there. The pool hands it out instead of NodeURI
+	// to clients connecting from the same public address as the host, or from
+	// the same private network range. It must include the address.
+	InternalNodeURI string `json:"internal_node_uri,omitempty"`
+	// Network is the network ID of the host node, so that clients can avoid
+	// connecting to hosts on a different network.
+	Network int `json:"network,omitempty"`
+	// VipnodeVersion is the version of the vipnode agent, to help operators
+	// identify outdated agents.
+	VipnodeVersion string `json:"vipnode_version,omitempty"`
+	// Genesis is the hex-encoded genesis block hash of the host node, if
+	// known, so that the pool can reject nodes on a different chain.
+	Genesis string `json:"genesis,omitempty"`
+	// Capabilities are free-form features that the host offers beyond
+	// serving peers, such as "archive" or "trace", for clients to filter on.
+	Capabilities map[string]string `json:"capabilities,omitempty"`
 }
 
 // HostResponse is the response type for Host RPC calls.
 type HostResponse struct {
 	PoolVersion string `json:"pool_version"`
+	// PoolTime is the pool's clock when it handled the request, so the host
+	// can detect clock skew (see ClockSkew).
+	PoolTime time.Time `json:"pool_time"`
 }
 
 // ClientRequest is the request type for Client RPC calls.
 type ClientRequest struct {
 	Kind string `json:"kind"`
+	// VipnodeVersion is the version of the vipnode agent.
+	VipnodeVersion string `json:"vipnode_version,omitempty"`
+	// Genesis is the hex-encoded genesis block hash of the client node, if
+	// known.
+	Genesis string `json:"genesis,omitempty"`
+	// Capabilities are required of the returned hosts, as matched by
+	// store.Node.HasCapabilities.
+	Capabilities map[string]string `json:"capabilities,omitempty"`
+	// CapabilitiesFallback returns hosts without the required Capabilities
+	// if none of the active hosts have them, rather than failing with
+	// NoHostNodesError.
+	CapabilitiesFallback bool `json:"capabilities_fallback,omitempty"`
+	// PreferHosts are node IDs of hosts to return first if they're active
+	// and match the request, such as the host that a restarted client was
+	// last connected to. They're whitelisted like any other host.
+	PreferHosts []string `json:"prefer_hosts,omitempty"`
 }
 
 // ClientResponse is the response type for Client RPC calls.
@@ -42,18 +80,69 @@ type ClientResponse struct {
 	// instructions for interfacing with this pool. For example, a link to the
 	// DApp for adding a balance deposit.
 	Message string `json:"message,omitempty"`
+	// PoolTime is the pool's clock when it handled the request, so the
+	// client can detect clock skew (see ClockSkew).
+	PoolTime time.Time `json:"pool_time"`
 }
 
 // UpdateRequest is the request type for Update RPC calls.
 type UpdateRequest struct {
 	Peers       []string `json:"peers"`
 	BlockNumber uint64   `json:"block_number"`
+	BlockTime   int64    `json:"block_time,omitempty"` // Unix timestamp of the block, if known.
+	// AvailableSlots is how many more pool clients the host has room for,
+	// or nil if the host doesn't know its peer limit.
+	AvailableSlots *int `json:"available_slots,omitempty"`
 }
 
 // UpdateResponse is the response type for Update RPC calls.
 type UpdateResponse struct {
 	Balance      *store.Balance `json:"balance,omitempty"`
 	InvalidPeers []string       `json:"invalid_peers"`
+	// ClientTiers is the tier of each client peer, by node ID, in responses
+	// to hosts.
+	ClientTiers map[string]Tier `json:"client_tiers,omitempty"`
+	// Expires is the estimated time when a client's balance runs out at its
+	// current rate, or nil if it's not being charged.
+	Expires *time.Time `json:"expires,omitempty"`
+	// Grace is what's left of a client's grace while its balance is below
+	// the pool's minimum, after which it's disconnected for nonpayment, or
+	// nil if it's not in its grace.
+	Grace *balance.GraceRemaining `json:"grace,omitempty"`
+}
+
+// MigrateRequest is the request type for vipnode_migrate calls from the pool
+// to a client, asking it to move from one host to another.
+type MigrateRequest struct {
+	// Host is the new host, which has already whitelisted the client.
+	Host store.Node `json:"host"`
+	// FromHostID is the host that the client is moving off of. It is released
+	// by the pool once the client confirms the new connection.
+	FromHostID store.NodeID `json:"from_host_id"`
+}
+
+// ErrorReport is a count of the node errors of one class from one method,
+// such as "timeout" errors from "Peers", since the agent's last report.
+type ErrorReport struct {
+	Class  string `json:"class"`
+	Method string `json:"method"`
+	Count  int    `json:"count"`
+}
+
+// ReportRequest is the request type for Report RPC calls.
+type ReportRequest struct {
+	// NodeVersion is the name and version of the agent's node client, such
+	// as "Geth/v1.8.21-stable", without its custom name or platform.
+	NodeVersion string        `json:"node_version,omitempty"`
+	Errors      []ErrorReport `json:"errors"`
+}
+
+// ProxyRequest is the request type for Proxy RPC calls, for a client to make a
+// read-only RPC call to the node of a host that it's connected to.
+type ProxyRequest struct {
+	HostID string            `json:"host_id"`
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params,omitempty"`
 }
 
 // Pool represents a vipnode pool for coordinating between clients and hosts.
@@ -75,4 +164,8 @@ type Pool interface {
 
 	// Withdraw prompts a request to settle the node's balance.
 	Withdraw(ctx context.Context) error
+
+	// Report sends aggregated counts of the node's errors, so that the pool
+	// can spot widespread issues across agents. Agents opt into it.
+	Report(ctx context.Context, req ReportRequest) error
 }
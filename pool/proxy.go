@@ -0,0 +1,54 @@
+package pool
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/vipnode/vipnode/pool/store"
+)
+
+// poolProxyTimeout is how long a host has to respond to a relayed proxy call.
+var poolProxyTimeout = 10 * time.Second
+
+// Proxy relays a read-only RPC call from a client to the node of a host that
+// the client is peered with, over the host's connection to the pool. The host
+// decides which methods it serves and how often. Hosts which don't proxy RPC
+// calls at all fail it with ErrCodeMethodNotFound.
+func (p *VipnodePool) Proxy(ctx context.Context, sig string, nodeID string, nonce int64, req ProxyRequest) (_ json.RawMessage, err error) {
+	defer p.countError("vipnode_proxy", &err)
+	if err := p.verify(sig, "vipnode_proxy", nodeID, nonce, req); err != nil {
+		return nil, err
+	}
+
+	peers, err := p.Store.NodePeers(store.NodeID(nodeID))
+	if err != nil {
+		return nil, err
+	}
+	peered := false
+	for _, peer := range peers {
+		if peer.IsHost && peer.ID == store.NodeID(req.HostID) {
+			peered = true
+			break
+		}
+	}
+	if !peered {
+		return nil, ErrNotPeered
+	}
+
+	p.mu.Lock()
+	remote, ok := p.remoteHosts[store.NodeID(req.HostID)]
+	p.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("missing remote service for host: %q", req.HostID)
+	}
+
+	callCtx, cancel := context.WithTimeout(ctx, poolProxyTimeout)
+	defer cancel()
+	var result json.RawMessage
+	if err := remote.Call(callCtx, &result, "vipnode_proxy", nodeID, req.Method, req.Params); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,76 @@
+package pool
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/p2p/discv5"
+	"github.com/vipnode/vipnode/internal/keygen"
+	"github.com/vipnode/vipnode/jsonrpc2"
+	"github.com/vipnode/vipnode/pool/store/memory"
+)
+
+// ProxyHost records the vipnode_proxy calls relayed to a host. It must be
+// exported to be registered as an RPC receiver.
+type ProxyHost struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (h *ProxyHost) Proxy(ctx context.Context, clientID string, method string, params []json.RawMessage) (json.RawMessage, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.calls = append(h.calls, clientID+" "+method)
+	return json.RawMessage(`"0x2a"`), nil
+}
+
+func TestProxy(t *testing.T) {
+	ctx := context.Background()
+	p := New(memory.New(), nil)
+	p.skipWhitelist = true
+
+	host := &ProxyHost{}
+	server, hostConn := jsonrpc2.ServePipe()
+	server.Server.Register("vipnode_", p)
+	if err := hostConn.Server.RegisterMethod("vipnode_proxy", host, "Proxy"); err != nil {
+		t.Fatal(err)
+	}
+	hostKey := keygen.HardcodedKeyIdx(t, 0)
+	hostID := discv5.PubkeyID(&hostKey.PublicKey).String()
+	if _, err := Remote(hostConn, hostKey).Host(ctx, HostRequest{Kind: "geth", NodeURI: "enode://" + hostID + "@127.0.0.1:30303"}); err != nil {
+		t.Fatal(err)
+	}
+
+	server2, clientConn := jsonrpc2.ServePipe()
+	server2.Server.Register("vipnode_", p)
+	clientKey := keygen.HardcodedKeyIdx(t, 1)
+	clientID := discv5.PubkeyID(&clientKey.PublicKey).String()
+	client := Remote(clientConn, clientKey)
+	if _, err := client.Client(ctx, ClientRequest{Kind: "geth"}); err != nil {
+		t.Fatal(err)
+	}
+
+	req := ProxyRequest{HostID: hostID, Method: "eth_blockNumber"}
+	if _, err := client.Proxy(ctx, req); err == nil || err.Error() != ErrNotPeered.Error() {
+		t.Errorf("expected ErrNotPeered before the client peered with the host, got: %v", err)
+	}
+
+	if _, err := client.Update(ctx, UpdateRequest{Peers: []string{hostID}}); err != nil {
+		t.Fatal(err)
+	}
+	result, err := client.Proxy(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(result) != `"0x2a"` {
+		t.Errorf("wrong result: %s", result)
+	}
+	host.mu.Lock()
+	calls := host.calls
+	host.mu.Unlock()
+	if len(calls) != 1 || calls[0] != clientID+" eth_blockNumber" {
+		t.Errorf("host got wrong proxy calls: %v", calls)
+	}
+}
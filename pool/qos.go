@@ -0,0 +1,55 @@
+package pool
+
+import (
+	"github.com/vipnode/vipnode/internal/pretty"
+	"github.com/vipnode/vipnode/pool/store"
+)
+
+// Tier is the quality of service class of a client. Hosts that are over
+// capacity can drop clients of lower tiers to make room for higher ones.
+type Tier string
+
+const (
+	// TierTrial is for clients running on a trial balance, without a funded
+	// account.
+	TierTrial Tier = "trial"
+	// TierPaying is for clients spending from a funded account.
+	TierPaying Tier = "paying"
+)
+
+// Rank orders tiers by priority, starting from 0 for the lowest. Unknown
+// tiers rank with TierTrial.
+func (t Tier) Rank() int {
+	if t == TierPaying {
+		return 1
+	}
+	return 0
+}
+
+// BalanceTier returns the tier of a client with the given balance.
+func BalanceTier(balance store.Balance) Tier {
+	if balance.Account == "" {
+		return TierTrial
+	}
+	if balance.Deposit.Sign() <= 0 && balance.Credit.Sign() <= 0 {
+		return TierTrial
+	}
+	return TierPaying
+}
+
+// clientTiers returns the tiers of the clients among a host's peers.
+func (p *VipnodePool) clientTiers(peers []store.Node) map[string]Tier {
+	tiers := make(map[string]Tier, len(peers))
+	for _, peer := range peers {
+		if peer.IsHost {
+			continue
+		}
+		balance, err := p.Store.GetNodeBalance(peer.ID)
+		if err != nil {
+			logger.Printf("Failed to get balance of client %q for its tier: %s", pretty.Abbrev(string(peer.ID)), err)
+			continue
+		}
+		tiers[string(peer.ID)] = BalanceTier(balance)
+	}
+	return tiers
+}
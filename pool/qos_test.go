@@ -0,0 +1,56 @@
+package pool
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/vipnode/vipnode/pool/store"
+	"github.com/vipnode/vipnode/pool/store/memory"
+)
+
+func TestBalanceTier(t *testing.T) {
+	funded := store.Balance{Account: "0xabc"}
+	funded.Deposit.SetInt64(100)
+	for _, tc := range []struct {
+		balance store.Balance
+		want    Tier
+	}{
+		{store.Balance{}, TierTrial},
+		{store.Balance{Credit: *big.NewInt(42)}, TierTrial},
+		{store.Balance{Account: "0xabc"}, TierTrial},
+		{funded, TierPaying},
+	} {
+		if got := BalanceTier(tc.balance); got != tc.want {
+			t.Errorf("%s: got tier %q; want %q", tc.balance.String(), got, tc.want)
+		}
+	}
+	if TierTrial.Rank() >= TierPaying.Rank() || Tier("").Rank() != TierTrial.Rank() {
+		t.Error("wrong tier ranks")
+	}
+}
+
+func TestClientTiers(t *testing.T) {
+	db := memory.New()
+	p := New(db, nil)
+	nodes := []store.Node{
+		{ID: "trial"},
+		{ID: "paying"},
+		{ID: "otherhost", IsHost: true},
+	}
+	for _, node := range nodes {
+		if err := db.SetNode(node); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.AddAccountNode("0xabc", "paying"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AddAccountBalance("0xabc", big.NewInt(1000)); err != nil {
+		t.Fatal(err)
+	}
+
+	tiers := p.clientTiers(nodes)
+	if len(tiers) != 2 || tiers["trial"] != TierTrial || tiers["paying"] != TierPaying {
+		t.Errorf("wrong tiers: %v", tiers)
+	}
+}
@@ -3,6 +3,7 @@ package pool
 import (
 	"context"
 	"crypto/ecdsa"
+	"encoding/json"
 	"time"
 
 	"github.com/ethereum/go-ethereum/p2p/discv5"
@@ -13,10 +14,16 @@ import (
 // Remote returns a RemotePool abstraction which proxies an RPC pool client but
 // takes care of all the request signing.
 func Remote(client jsonrpc2.Service, privkey *ecdsa.PrivateKey) *RemotePool {
+	return RemoteSigner(client, request.KeySigner(privkey), discv5.PubkeyID(&privkey.PublicKey).String())
+}
+
+// RemoteSigner is similar to Remote, except requests are signed by an external
+// signer for nodeID so that the private key is not needed in-process.
+func RemoteSigner(client jsonrpc2.Service, signer request.Signer, nodeID string) *RemotePool {
 	return &RemotePool{
-		client:  client,
-		privkey: privkey,
-		nodeID:  discv5.PubkeyID(&privkey.PublicKey).String(),
+		client: client,
+		signer: signer,
+		nodeID: nodeID,
 	}
 }
 
@@ -25,9 +32,9 @@ var _ Pool = &RemotePool{}
 
 // RemotePool wraps a Pool with an RPC service and handles all the signging.
 type RemotePool struct {
-	client  jsonrpc2.Service
-	privkey *ecdsa.PrivateKey
-	nodeID  string
+	client jsonrpc2.Service
+	signer request.Signer
+	nodeID string
 }
 
 func (p *RemotePool) getNonce() int64 {
@@ -42,7 +49,7 @@ func (p *RemotePool) Host(ctx context.Context, req HostRequest) (*HostResponse,
 		ExtraArgs: []interface{}{req},
 	}
 
-	args, err := signedReq.SignedArgs(p.privkey)
+	args, err := signedReq.SignedArgsWith(p.signer)
 	if err != nil {
 		return nil, err
 	}
@@ -61,7 +68,7 @@ func (p *RemotePool) Client(ctx context.Context, req ClientRequest) (*ClientResp
 		ExtraArgs: []interface{}{req},
 	}
 
-	args, err := signedReq.SignedArgs(p.privkey)
+	args, err := signedReq.SignedArgsWith(p.signer)
 	if err != nil {
 		return nil, err
 	}
@@ -80,7 +87,7 @@ func (p *RemotePool) Disconnect(ctx context.Context) error {
 		Nonce:  p.getNonce(),
 	}
 
-	args, err := signedReq.SignedArgs(p.privkey)
+	args, err := signedReq.SignedArgsWith(p.signer)
 	if err != nil {
 		return err
 	}
@@ -88,6 +95,46 @@ func (p *RemotePool) Disconnect(ctx context.Context) error {
 	return p.client.Call(ctx, &result, signedReq.Method, args...)
 }
 
+// DisconnectClient asks the pool to force-disconnect a client from its hosts.
+// The pool only accepts it from nodes which are pool admins.
+func (p *RemotePool) DisconnectClient(ctx context.Context, clientID string) error {
+	signedReq := request.NodeRequest{
+		Method:    "vipnode_disconnectClient",
+		NodeID:    p.nodeID,
+		Nonce:     p.getNonce(),
+		ExtraArgs: []interface{}{clientID},
+	}
+
+	args, err := signedReq.SignedArgsWith(p.signer)
+	if err != nil {
+		return err
+	}
+	var result interface{}
+	return p.client.Call(ctx, &result, signedReq.Method, args...)
+}
+
+// Proxy asks the pool to relay a read-only RPC call to the node of a host that
+// the client is connected to, and returns the raw result. Hosts only serve
+// the calls if they advertise the "rpc-proxy" capability.
+func (p *RemotePool) Proxy(ctx context.Context, req ProxyRequest) (json.RawMessage, error) {
+	signedReq := request.NodeRequest{
+		Method:    "vipnode_proxy",
+		NodeID:    p.nodeID,
+		Nonce:     p.getNonce(),
+		ExtraArgs: []interface{}{req},
+	}
+
+	args, err := signedReq.SignedArgsWith(p.signer)
+	if err != nil {
+		return nil, err
+	}
+	var result json.RawMessage
+	if err := p.client.Call(ctx, &result, signedReq.Method, args...); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
 func (p *RemotePool) Update(ctx context.Context, req UpdateRequest) (*UpdateResponse, error) {
 	signedReq := request.NodeRequest{
 		Method:    "vipnode_update",
@@ -96,7 +143,7 @@ func (p *RemotePool) Update(ctx context.Context, req UpdateRequest) (*UpdateResp
 		ExtraArgs: []interface{}{req},
 	}
 
-	args, err := signedReq.SignedArgs(p.privkey)
+	args, err := signedReq.SignedArgsWith(p.signer)
 	if err != nil {
 		return nil, err
 	}
@@ -116,7 +163,23 @@ func (p *RemotePool) Withdraw(ctx context.Context) error {
 		Nonce:  p.getNonce(),
 	}
 
-	args, err := signedReq.SignedArgs(p.privkey)
+	args, err := signedReq.SignedArgsWith(p.signer)
+	if err != nil {
+		return err
+	}
+	var result interface{}
+	return p.client.Call(ctx, &result, signedReq.Method, args...)
+}
+
+func (p *RemotePool) Report(ctx context.Context, req ReportRequest) error {
+	signedReq := request.NodeRequest{
+		Method:    "vipnode_report",
+		NodeID:    p.nodeID,
+		Nonce:     p.getNonce(),
+		ExtraArgs: []interface{}{req},
+	}
+
+	args, err := signedReq.SignedArgsWith(p.signer)
 	if err != nil {
 		return err
 	}
@@ -2,10 +2,12 @@ package pool
 
 import (
 	"context"
+	"crypto/ecdsa"
 	"fmt"
 	"testing"
 	"time"
 
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/p2p/discv5"
 	"github.com/vipnode/vipnode/internal/keygen"
 	"github.com/vipnode/vipnode/jsonrpc2"
@@ -112,3 +114,44 @@ func TestRemotePoolHost(t *testing.T) {
 		}
 	}
 }
+
+// hsmSigner pretends to be an external signer holding the key.
+type hsmSigner struct {
+	privkey *ecdsa.PrivateKey
+	signed  int
+}
+
+func (s *hsmSigner) SignHash(hash []byte) ([]byte, error) {
+	s.signed++
+	return crypto.Sign(hash, s.privkey)
+}
+
+func TestRemoteSigner(t *testing.T) {
+	pool := New(memory.New(), nil)
+	pool.skipWhitelist = true
+	if err := pool.Store.SetNode(store.Node{ID: "foo", URI: "enode://foo", IsHost: true, Kind: "geth", LastSeen: time.Now()}); err != nil {
+		t.Fatal("failed to add host node:", err)
+	}
+
+	server, client := jsonrpc2.ServePipe()
+	server.Server.Register("vipnode_", pool)
+
+	signer := &hsmSigner{privkey: keygen.HardcodedKey(t)}
+	remote := RemoteSigner(client, signer, discv5.PubkeyID(&signer.privkey.PublicKey).String())
+	resp, err := remote.Client(context.Background(), ClientRequest{Kind: "geth"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Hosts) != 1 {
+		t.Errorf("wrong number of hosts: %d", len(resp.Hosts))
+	}
+	if signer.signed != 1 {
+		t.Errorf("expected 1 signature, got %d", signer.signed)
+	}
+
+	// Signing for a different node ID fails verification
+	remote = RemoteSigner(client, signer, discv5.PubkeyID(&keygen.HardcodedKeyIdx(t, 1).PublicKey).String())
+	if _, err := remote.Client(context.Background(), ClientRequest{Kind: "geth"}); err == nil {
+		t.Error("expected verification error")
+	}
+}
@@ -0,0 +1,32 @@
+package pool
+
+import (
+	"github.com/vipnode/vipnode/jsonrpc2"
+	"github.com/vipnode/vipnode/pool/store"
+)
+
+// ServiceClosed forgets the clients that registered over service, once its
+// connection is closed, so that they're no longer migrated over it. Clients
+// that have since registered over a new connection are kept.
+//
+// ServiceClosed is a function rather than a VipnodePool method so that it's
+// not exposed over the pool's RPC API.
+func ServiceClosed(p *VipnodePool, service jsonrpc2.Service) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for id, s := range p.remoteClients {
+		if s == service {
+			delete(p.remoteClients, id)
+		}
+	}
+}
+
+// NodesEvicted forgets the connections of nodes that were evicted from the
+// store, such as by a store.Sweeper.
+func NodesEvicted(p *VipnodePool, evicted []store.NodeID) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, id := range evicted {
+		delete(p.remoteClients, id)
+	}
+}
@@ -0,0 +1,56 @@
+package pool
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/p2p/discv5"
+	"github.com/vipnode/vipnode/internal/keygen"
+	"github.com/vipnode/vipnode/jsonrpc2"
+	"github.com/vipnode/vipnode/pool/store"
+	"github.com/vipnode/vipnode/pool/store/memory"
+)
+
+func TestForgetRemoteClients(t *testing.T) {
+	pool := New(memory.New(), nil)
+	pool.skipWhitelist = true
+
+	connect := func(idx int) (store.NodeID, jsonrpc2.Service) {
+		server, client := jsonrpc2.ServePipe()
+		server.Server.Register("vipnode_", pool)
+		key := keygen.HardcodedKeyIdx(t, idx)
+		// No hosts are connected, but the client's connection is kept.
+		if _, err := Remote(client, key).Client(context.Background(), ClientRequest{Kind: "geth"}); err == nil {
+			t.Fatal("expected NoHostNodesError")
+		}
+		return store.NodeID(discv5.PubkeyID(&key.PublicKey).String()), server
+	}
+	remote := func(id store.NodeID) jsonrpc2.Service {
+		pool.mu.Lock()
+		defer pool.mu.Unlock()
+		return pool.remoteClients[id]
+	}
+
+	clientA, serviceA := connect(0)
+	clientB, _ := connect(1)
+	if remote(clientA) != serviceA {
+		t.Fatalf("client connection was not kept")
+	}
+
+	// The client reconnected, so closing the old connection keeps the new
+	// one.
+	_, reconnected := connect(0)
+	ServiceClosed(pool, serviceA)
+	if remote(clientA) != reconnected {
+		t.Errorf("closing a replaced connection dropped the new one")
+	}
+	ServiceClosed(pool, reconnected)
+	if remote(clientA) != nil {
+		t.Errorf("closed connection was kept")
+	}
+
+	NodesEvicted(pool, []store.NodeID{clientB})
+	if remote(clientB) != nil {
+		t.Errorf("evicted client's connection was kept")
+	}
+}
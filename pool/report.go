@@ -0,0 +1,299 @@
+package pool
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vipnode/vipnode/ethnode"
+	"github.com/vipnode/vipnode/jsonrpc2"
+	"github.com/vipnode/vipnode/pool/store"
+)
+
+// DefaultReportInterval is the least time between error reports from an
+// agent, and between the reports that the pool accepts from a node.
+const DefaultReportInterval = 10 * time.Minute
+
+// maxReportErrors is the most distinct errors in a single report; errors of
+// other kinds are dropped until the next report.
+const maxReportErrors = 32
+
+// maxErrorStats is the most distinct errors that ErrorReports keeps track
+// of, so that misbehaving agents can't grow it without bounds.
+const maxErrorStats = 1000
+
+// maxReportField is the longest class, method or version string accepted
+// in a report, longer ones are truncated.
+const maxReportField = 64
+
+// errorKey identifies a kind of error within a report.
+type errorKey struct {
+	Class  string
+	Method string
+}
+
+// ErrorReporter collects an agent's node errors, to report them to the pool
+// as counts by error class and method. Error messages and call arguments
+// are never sent, since they can include addresses or peer IDs. It
+// implements jsonrpc2.Tracer so that it can be attached to a node with
+// ethnode.Traced. A nil ErrorReporter reports nothing.
+type ErrorReporter struct {
+	// Interval is the least time between reports, errors in between are
+	// added up.
+	Interval time.Duration
+	// NodeVersion is the client version of the node, stripped down to its
+	// name and version number.
+	NodeVersion string
+
+	mu      sync.Mutex
+	pending map[errorKey]int
+	sent    time.Time
+}
+
+// NewErrorReporter returns an ErrorReporter for a node with the given
+// web3_clientVersion, which reports every DefaultReportInterval.
+func NewErrorReporter(clientVersion string) *ErrorReporter {
+	return &ErrorReporter{
+		Interval:    DefaultReportInterval,
+		NodeVersion: shortClientVersion(clientVersion),
+		pending:     map[errorKey]int{},
+	}
+}
+
+// Record counts err from calling the node's method, such as "Peers". Nil
+// errors and calls canceled by the agent are ignored.
+func (r *ErrorReporter) Record(method string, err error) {
+	class := ethnode.ErrorClass(err)
+	if r == nil || class == "" || class == "canceled" {
+		return
+	}
+	key := errorKey{Class: class, Method: method}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.pending[key]; !ok && len(r.pending) >= maxReportErrors {
+		return
+	}
+	r.pending[key]++
+}
+
+// Flush sends the errors recorded since the last report to p, unless there
+// are none or the last report was less than Interval ago. Errors are dropped
+// once they're sent, even if the report fails, rather than piling up while
+// the pool refuses them.
+func (r *ErrorReporter) Flush(ctx context.Context, p Pool) error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	now := time.Now()
+	if len(r.pending) == 0 || now.Sub(r.sent) < r.Interval {
+		r.mu.Unlock()
+		return nil
+	}
+	req := ReportRequest{
+		NodeVersion: r.NodeVersion,
+		Errors:      make([]ErrorReport, 0, len(r.pending)),
+	}
+	for key, count := range r.pending {
+		req.Errors = append(req.Errors, ErrorReport{Class: key.Class, Method: key.Method, Count: count})
+	}
+	r.pending = map[errorKey]int{}
+	r.sent = now
+	r.mu.Unlock()
+
+	sort.Slice(req.Errors, func(i, j int) bool {
+		if req.Errors[i].Count != req.Errors[j].Count {
+			return req.Errors[i].Count > req.Errors[j].Count
+		}
+		if req.Errors[i].Method != req.Errors[j].Method {
+			return req.Errors[i].Method < req.Errors[j].Method
+		}
+		return req.Errors[i].Class < req.Errors[j].Class
+	})
+	return p.Report(ctx, req)
+}
+
+// StartSpan returns a span which records its error under the name of the
+// node method, without the "ethnode." prefix.
+func (r *ErrorReporter) StartSpan(ctx context.Context, name string) (context.Context, jsonrpc2.Span) {
+	return ctx, reportSpan{r, strings.TrimPrefix(name, "ethnode.")}
+}
+
+// Inject returns nil, there is no trace context to propagate.
+func (r *ErrorReporter) Inject(ctx context.Context) map[string]string {
+	return nil
+}
+
+// Extract returns ctx as is.
+func (r *ErrorReporter) Extract(ctx context.Context, carrier map[string]string) context.Context {
+	return ctx
+}
+
+type reportSpan struct {
+	reporter *ErrorReporter
+	method   string
+}
+
+func (s reportSpan) End(err error) {
+	s.reporter.Record(s.method, err)
+}
+
+// shortClientVersion strips a web3_clientVersion down to the client name and
+// version, such as "Geth/v1.8.21-stable" from
+// "Geth/mynode/v1.8.21-stable/linux-amd64/go1.11.4", dropping the node's
+// custom name and platform.
+func shortClientVersion(clientVersion string) string {
+	parts := strings.Split(clientVersion, "/")
+	short := parts[0]
+	for _, part := range parts[1:] {
+		if len(part) > 1 && part[0] == 'v' && part[1] >= '0' && part[1] <= '9' {
+			short += "/" + part
+			break
+		}
+	}
+	return truncateField(short)
+}
+
+func truncateField(s string) string {
+	if len(s) > maxReportField {
+		return s[:maxReportField]
+	}
+	return s
+}
+
+// ErrorStats is the total of an error reported by agents, for a kind and
+// version of node.
+type ErrorStats struct {
+	Class       string `json:"class"`
+	Method      string `json:"method"`
+	NodeKind    string `json:"node_kind"`
+	NodeVersion string `json:"node_version,omitempty"`
+	// Count is the number of times the error happened.
+	Count int `json:"count"`
+	// Nodes is the number of distinct nodes which reported the error.
+	Nodes    int       `json:"nodes"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// errorStatsKey identifies an aggregated error.
+type errorStatsKey struct {
+	errorKey
+	NodeKind    string
+	NodeVersion string
+}
+
+// ErrorReports aggregates the node errors that agents report, by error
+// class and method and by node kind and version, to spot widespread issues
+// such as a node release which broke a method. It's goroutine-safe.
+type ErrorReports struct {
+	// Interval is the least time between reports from a node, sooner
+	// reports are rejected with a ReportTooSoonError.
+	Interval time.Duration
+
+	mu    sync.Mutex
+	stats map[errorStatsKey]*ErrorStats
+	nodes map[errorStatsKey]map[store.NodeID]struct{}
+	last  map[store.NodeID]time.Time
+}
+
+// NewErrorReports returns an empty ErrorReports which accepts a report from
+// each node every DefaultReportInterval.
+func NewErrorReports() *ErrorReports {
+	return &ErrorReports{
+		// Leave some slack for agents whose ticks drift.
+		Interval: DefaultReportInterval * 9 / 10,
+		stats:    map[errorStatsKey]*ErrorStats{},
+		nodes:    map[errorStatsKey]map[store.NodeID]struct{}{},
+		last:     map[store.NodeID]time.Time{},
+	}
+}
+
+// Add aggregates a report from nodeID, a node of the given kind, received at
+// now. Entries beyond maxReportErrors are ignored, and so are new kinds of
+// errors once maxErrorStats are tracked.
+func (r *ErrorReports) Add(nodeID store.NodeID, kind string, req ReportRequest, now time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if last, ok := r.last[nodeID]; ok && now.Sub(last) < r.Interval {
+		return ReportTooSoonError{Wait: r.Interval - now.Sub(last)}
+	}
+	r.last[nodeID] = now
+
+	errs := req.Errors
+	if len(errs) > maxReportErrors {
+		errs = errs[:maxReportErrors]
+	}
+	for _, report := range errs {
+		if report.Count <= 0 {
+			continue
+		}
+		key := errorStatsKey{
+			errorKey:    errorKey{Class: truncateField(report.Class), Method: truncateField(report.Method)},
+			NodeKind:    truncateField(kind),
+			NodeVersion: truncateField(req.NodeVersion),
+		}
+		stats, ok := r.stats[key]
+		if !ok {
+			if len(r.stats) >= maxErrorStats {
+				continue
+			}
+			stats = &ErrorStats{
+				Class:       key.Class,
+				Method:      key.Method,
+				NodeKind:    key.NodeKind,
+				NodeVersion: key.NodeVersion,
+			}
+			r.stats[key] = stats
+			r.nodes[key] = map[store.NodeID]struct{}{}
+		}
+		stats.Count += report.Count
+		stats.LastSeen = now
+		r.nodes[key][nodeID] = struct{}{}
+		stats.Nodes = len(r.nodes[key])
+	}
+	return nil
+}
+
+// Stats returns the aggregated errors, the ones reported by the most nodes
+// first.
+func (r *ErrorReports) Stats() []ErrorStats {
+	r.mu.Lock()
+	stats := make([]ErrorStats, 0, len(r.stats))
+	for _, s := range r.stats {
+		stats = append(stats, *s)
+	}
+	r.mu.Unlock()
+
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Nodes != stats[j].Nodes {
+			return stats[i].Nodes > stats[j].Nodes
+		}
+		if stats[i].Count != stats[j].Count {
+			return stats[i].Count > stats[j].Count
+		}
+		if stats[i].Method != stats[j].Method {
+			return stats[i].Method < stats[j].Method
+		}
+		return stats[i].Class < stats[j].Class
+	})
+	return stats
+}
+
+// Report receives the aggregated node errors of an agent, if the pool
+// collects them in ErrorReports.
+func (p *VipnodePool) Report(ctx context.Context, sig string, nodeID string, nonce int64, req ReportRequest) (err error) {
+	defer p.countError("vipnode_report", &err)
+	if err := p.verify(sig, "vipnode_report", nodeID, nonce, req); err != nil {
+		return err
+	}
+	if p.ErrorReports == nil {
+		return ErrReportsDisabled
+	}
+	node, err := p.Store.GetNode(store.NodeID(nodeID))
+	if err != nil {
+		return err
+	}
+	return p.ErrorReports.Add(node.ID, node.Kind, req, time.Now())
+}
@@ -0,0 +1,226 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p/discv5"
+	"github.com/vipnode/vipnode/ethnode"
+	"github.com/vipnode/vipnode/internal/keygen"
+	"github.com/vipnode/vipnode/jsonrpc2"
+	"github.com/vipnode/vipnode/pool/store"
+	"github.com/vipnode/vipnode/pool/store/memory"
+)
+
+// reportPool is a StaticPool which keeps the reports it receives.
+type reportPool struct {
+	StaticPool
+	reports []ReportRequest
+}
+
+func (p *reportPool) Report(ctx context.Context, req ReportRequest) error {
+	p.reports = append(p.reports, req)
+	return nil
+}
+
+func TestErrorReporter(t *testing.T) {
+	ctx := context.Background()
+	p := &reportPool{}
+	reporter := NewErrorReporter("Geth/mynode/v1.8.21-stable/linux-amd64/go1.11.4")
+
+	notFound := ethnode.RPCError{Method: "admin_peers", Code: -32601, Message: "the method admin_peers does not exist"}
+	timeout := ethnode.TransportError{Method: "admin_peers", Err: context.DeadlineExceeded}
+	for i := 0; i < 3; i++ {
+		reporter.Record("Peers", notFound)
+	}
+	reporter.Record("Peers", timeout)
+	reporter.Record("BlockNumber", timeout)
+	reporter.Record("BlockNumber", nil)
+	reporter.Record("BlockNumber", context.Canceled)
+
+	if err := reporter.Flush(ctx, p); err != nil {
+		t.Fatal(err)
+	}
+	want := []ReportRequest{{
+		NodeVersion: "Geth/v1.8.21-stable",
+		Errors: []ErrorReport{
+			{Class: "rpc_-32601", Method: "Peers", Count: 3},
+			{Class: "timeout", Method: "BlockNumber", Count: 1},
+			{Class: "timeout", Method: "Peers", Count: 1},
+		},
+	}}
+	if !reflect.DeepEqual(p.reports, want) {
+		t.Errorf("wrong reports:\n got: %+v\nwant: %+v", p.reports, want)
+	}
+
+	// Errors within the interval are held back for the next report.
+	reporter.Record("Peers", notFound)
+	if err := reporter.Flush(ctx, p); err != nil {
+		t.Fatal(err)
+	}
+	if len(p.reports) != 1 {
+		t.Fatalf("expected the report to be rate-limited, got %d reports", len(p.reports))
+	}
+	reporter.Record("Peers", notFound)
+	reporter.sent = reporter.sent.Add(-reporter.Interval)
+	if err := reporter.Flush(ctx, p); err != nil {
+		t.Fatal(err)
+	}
+	if len(p.reports) != 2 {
+		t.Fatalf("expected a second report after the interval, got %d reports", len(p.reports))
+	}
+	if got := p.reports[1].Errors; len(got) != 1 || got[0].Count != 2 {
+		t.Errorf("wrong second report: %+v", got)
+	}
+
+	// Nothing to report.
+	reporter.sent = time.Time{}
+	if err := reporter.Flush(ctx, p); err != nil {
+		t.Fatal(err)
+	}
+	if len(p.reports) != 2 {
+		t.Errorf("expected no empty reports, got %d reports", len(p.reports))
+	}
+
+	var disabled *ErrorReporter
+	disabled.Record("Peers", notFound)
+	if err := disabled.Flush(ctx, p); err != nil || len(p.reports) != 2 {
+		t.Errorf("expected a nil reporter to send nothing, got: %v", err)
+	}
+}
+
+func TestErrorReporterTraced(t *testing.T) {
+	reporter := NewErrorReporter("")
+	node := ethnode.Traced(&failingNode{}, reporter)
+	if _, err := node.BlockNumber(context.Background()); err == nil {
+		t.Fatal("expected an error")
+	}
+	p := &reportPool{}
+	if err := reporter.Flush(context.Background(), p); err != nil {
+		t.Fatal(err)
+	}
+	want := []ErrorReport{{Class: "transport", Method: "BlockNumber", Count: 1}}
+	if len(p.reports) != 1 || !reflect.DeepEqual(p.reports[0].Errors, want) {
+		t.Errorf("wrong reports: %+v", p.reports)
+	}
+}
+
+// failingNode is an EthNode whose BlockNumber fails to reach the node.
+type failingNode struct{ ethnode.EthNode }
+
+func (n *failingNode) BlockNumber(ctx context.Context) (uint64, error) {
+	return 0, ethnode.TransportError{Method: "eth_blockNumber", Err: errors.New("connection refused")}
+}
+
+func TestErrorReports(t *testing.T) {
+	reports := NewErrorReports()
+	now := time.Now()
+	req := func(errs ...ErrorReport) ReportRequest {
+		return ReportRequest{NodeVersion: "Geth/v1.8.21-stable", Errors: errs}
+	}
+	notFound := func(count int) ErrorReport {
+		return ErrorReport{Class: "rpc_-32601", Method: "Peers", Count: count}
+	}
+	timeout := ErrorReport{Class: "timeout", Method: "BlockNumber", Count: 1}
+
+	if err := reports.Add("a", "geth", req(notFound(3), timeout), now); err != nil {
+		t.Fatal(err)
+	}
+	if err := reports.Add("b", "geth", req(notFound(2)), now); err != nil {
+		t.Fatal(err)
+	}
+	if err := reports.Add("c", "parity", ReportRequest{Errors: []ErrorReport{notFound(1)}}, now); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reports from the same node are rate-limited.
+	if err := reports.Add("a", "geth", req(notFound(100)), now.Add(time.Minute)); err == nil {
+		t.Error("expected a report within the interval to be rejected")
+	} else if _, ok := err.(ReportTooSoonError); !ok {
+		t.Errorf("expected ReportTooSoonError, got: %v", err)
+	}
+	later := now.Add(reports.Interval)
+	if err := reports.Add("a", "geth", req(notFound(1), ErrorReport{Class: "timeout", Method: "Peers", Count: 0}), later); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []ErrorStats{
+		{Class: "rpc_-32601", Method: "Peers", NodeKind: "geth", NodeVersion: "Geth/v1.8.21-stable", Count: 6, Nodes: 2, LastSeen: later},
+		{Class: "timeout", Method: "BlockNumber", NodeKind: "geth", NodeVersion: "Geth/v1.8.21-stable", Count: 1, Nodes: 1, LastSeen: now},
+		{Class: "rpc_-32601", Method: "Peers", NodeKind: "parity", Count: 1, Nodes: 1, LastSeen: now},
+	}
+	if got := reports.Stats(); !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong stats:\n got: %+v\nwant: %+v", got, want)
+	}
+}
+
+func TestErrorReportsLimits(t *testing.T) {
+	reports := NewErrorReports()
+	var errs []ErrorReport
+	for i := 0; i < maxReportErrors*2; i++ {
+		errs = append(errs, ErrorReport{Class: "other", Method: string(rune('a'+i%26)) + string(rune('a'+i/26)), Count: 1})
+	}
+	if err := reports.Add("a", "geth", ReportRequest{NodeVersion: string(make([]byte, 1000)), Errors: errs}, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	stats := reports.Stats()
+	if len(stats) != maxReportErrors {
+		t.Errorf("got %d errors; want at most %d per report", len(stats), maxReportErrors)
+	}
+	if len(stats[0].NodeVersion) != maxReportField {
+		t.Errorf("got a %d byte node version; want it truncated to %d", len(stats[0].NodeVersion), maxReportField)
+	}
+}
+
+func TestPoolReport(t *testing.T) {
+	ctx := context.Background()
+	pool := New(memory.New(), nil)
+	pool.skipWhitelist = true
+
+	hostKey := keygen.HardcodedKeyIdx(t, 0)
+	hostID := discv5.PubkeyID(&hostKey.PublicKey).String()
+	server, client := jsonrpc2.ServePipe()
+	server.Server.Register("vipnode_", pool)
+	remote := Remote(client, hostKey)
+
+	req := ReportRequest{NodeVersion: "Geth/v1.8.21-stable", Errors: []ErrorReport{{Class: "timeout", Method: "Peers", Count: 2}}}
+	if err := remote.Report(ctx, req); err == nil || err.Error() != ErrReportsDisabled.Error() {
+		t.Errorf("expected reports to be disabled, got: %v", err)
+	}
+
+	pool.ErrorReports = NewErrorReports()
+	if err := remote.Report(ctx, req); err == nil || err.Error() != store.ErrUnregisteredNode.Error() {
+		t.Errorf("expected reports from unregistered nodes to be rejected, got: %v", err)
+	}
+	if _, err := remote.Host(ctx, HostRequest{Kind: "geth", NodeURI: "enode://" + hostID + "@127.0.0.1:30303"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Report(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Report(ctx, req); err == nil {
+		t.Error("expected a second report to be rate-limited")
+	}
+
+	stats := pool.ErrorReports.Stats()
+	if len(stats) != 1 || stats[0].NodeKind != "geth" || stats[0].Count != 2 || stats[0].Nodes != 1 {
+		t.Errorf("wrong stats: %+v", stats)
+	}
+}
+
+func TestShortClientVersion(t *testing.T) {
+	for version, want := range map[string]string{
+		"Geth/v1.8.21-stable/linux-amd64/go1.11.4":                    "Geth/v1.8.21-stable",
+		"Geth/mynode/v1.8.21-stable-9dc5d1a9/linux-amd64/go1.11.4":    "Geth/v1.8.21-stable-9dc5d1a9",
+		"Parity-Ethereum//v2.0.5-stable/x86_64-linux-gnu/rustc1.29.0": "Parity-Ethereum/v2.0.5-stable",
+		"fakenode": "fakenode",
+		"":         "",
+	} {
+		if got := shortClientVersion(version); got != want {
+			t.Errorf("%q: got %q; want %q", version, got, want)
+		}
+	}
+}
@@ -3,10 +3,12 @@ package pool
 import (
 	"context"
 	"fmt"
-	"net/url"
+	"math/rand"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/vipnode/ether"
 	"github.com/vipnode/vipnode/internal/pretty"
 	"github.com/vipnode/vipnode/jsonrpc2"
 	"github.com/vipnode/vipnode/pool/balance"
@@ -28,7 +30,12 @@ func New(storeDriver store.Store, manager balance.Manager) *VipnodePool {
 	return &VipnodePool{
 		Store:          storeDriver,
 		BalanceManager: manager,
+		Metrics:        noMetrics{},
+		Authorizer:     AllowAll{},
+		AuditLog:       noAuditLog{},
+		Rand:           rand.New(rand.NewSource(time.Now().UnixNano())),
 		remoteHosts:    map[store.NodeID]jsonrpc2.Service{},
+		remoteClients:  map[store.NodeID]jsonrpc2.Service{},
 	}
 }
 
@@ -43,26 +50,90 @@ type VipnodePool struct {
 	BalanceManager balance.Manager
 	ClientMessager func(nodeID string) string
 
+	// Metrics receives instrumentation events, it must not be nil.
+	Metrics Metrics
+
+	// Authorizer accepts or rejects nodes when they register, it must not be
+	// nil.
+	Authorizer Authorizer
+
+	// AuditLog records mutations of the pool's state, it must not be nil.
+	AuditLog AuditLog
+
+	// Admins are the node IDs allowed to call admin methods, such as
+	// DisconnectClient. Admin methods are rejected if it's empty.
+	Admins AllowList
+
+	// Genesis is the hex-encoded genesis block hash that registering nodes
+	// must be on. Nodes which don't report their genesis are allowed.
+	// Disabled if empty.
+	Genesis string
+
+	// MaxBlockAge is how old the latest block reported by a node can be
+	// before it's flagged as stale. Disabled if 0.
+	MaxBlockAge time.Duration
+
+	// ErrorReports aggregates the node errors reported by agents. Reports
+	// are rejected if nil.
+	ErrorReports *ErrorReports
+
+	// Rand picks the hosts assigned to clients among the matching active
+	// hosts. New seeds it from the current time, tests can set a fixed seed
+	// to make the assignments reproducible. It must not be nil.
+	Rand   *rand.Rand
+	randMu sync.Mutex
+
 	// skipWhitelist is used for testing.
 	skipWhitelist bool
 
-	mu          sync.Mutex
-	remoteHosts map[store.NodeID]jsonrpc2.Service
+	mu            sync.Mutex
+	remoteHosts   map[store.NodeID]jsonrpc2.Service
+	remoteClients map[store.NodeID]jsonrpc2.Service
 }
 
 func (p *VipnodePool) verify(sig string, method string, nodeID string, nonce int64, args ...interface{}) error {
 	// TODO: Switch nonce to strictly timestamp within X time
 	// TODO: Switch NodeID to pubkey?
-	if err := p.Store.CheckAndSaveNonce(nodeID, nonce); err != nil {
+
+	// The signature must be checked before the nonce is saved, otherwise a
+	// forged request with a far-future nonce would lock out the real node.
+	if err := request.Verify(sig, method, nodeID, nonce, args...); err != nil {
 		return VerifyFailedError{Cause: err, Method: method}
 	}
 
-	if err := request.Verify(sig, method, nodeID, nonce, args...); err != nil {
+	if err := p.Store.CheckAndSaveNonce(nodeID, nonce); err != nil {
 		return VerifyFailedError{Cause: err, Method: method}
 	}
 	return nil
 }
 
+// authorize checks the node with the Authorizer before it's registered.
+func (p *VipnodePool) authorize(method string, node store.Node) error {
+	if err := p.Authorizer.Authorize(node); err != nil {
+		logger.Printf("Rejected node for %s: %q: %s", method, pretty.Abbrev(string(node.ID)), err)
+		p.audit(AuditReject, node.ID, "", fmt.Sprintf("%s: %s", method, err))
+		return UnauthorizedError{Cause: err, Method: method}
+	}
+	return nil
+}
+
+// checkGenesis returns a GenesisMismatchError if the pool requires a genesis
+// and the node reported a different one.
+func (p *VipnodePool) checkGenesis(genesis string) error {
+	if p.Genesis == "" || genesis == "" || strings.EqualFold(p.Genesis, genesis) {
+		return nil
+	}
+	return GenesisMismatchError{Want: p.Genesis, Got: genesis}
+}
+
+// countError reports *err to Metrics if it's set. It's meant to be deferred
+// with a pointer to a named error result.
+func (p *VipnodePool) countError(method string, err *error) {
+	if *err != nil {
+		p.Metrics.RPCError(method, *err)
+	}
+}
+
 func (p *VipnodePool) disconnectPeers(ctx context.Context, nodeID string, peers []store.Node) error {
 	callCtx, cancel := context.WithTimeout(ctx, poolWhitelistTimeout)
 	defer cancel()
@@ -96,8 +167,24 @@ func (p *VipnodePool) disconnectPeers(ctx context.Context, nodeID string, peers
 	return nil
 }
 
+// saveSlots saves the client slots that a host reported on its update, so
+// that full hosts aren't assigned more clients. The node is reloaded since the
+// update changed it.
+func (p *VipnodePool) saveSlots(nodeID store.NodeID, slots *int) error {
+	node, err := p.Store.GetNode(nodeID)
+	if err != nil {
+		return err
+	}
+	if old := node.Slots(); (old == nil) == (slots == nil) && (old == nil || *old == *slots) {
+		return nil
+	}
+	node.SetSlots(slots)
+	return p.Store.SetNode(*node)
+}
+
 // Update submits a list of peers that the node is connected to, returning the current account balance.
-func (p *VipnodePool) Update(ctx context.Context, sig string, nodeID string, nonce int64, req UpdateRequest) (*UpdateResponse, error) {
+func (p *VipnodePool) Update(ctx context.Context, sig string, nodeID string, nonce int64, req UpdateRequest) (_ *UpdateResponse, err error) {
+	defer p.countError("vipnode_update", &err)
 	// TODO: Send sync status?
 	if err := p.verify(sig, "vipnode_update", nodeID, nonce, req); err != nil {
 		return nil, err
@@ -109,11 +196,22 @@ func (p *VipnodePool) Update(ctx context.Context, sig string, nodeID string, non
 	}
 	nodeBeforeUpdate := *node
 
+	if p.MaxBlockAge > 0 && req.BlockTime > 0 {
+		if age := time.Since(time.Unix(req.BlockTime, 0)); age > p.MaxBlockAge {
+			logger.Printf("Stale node %q: latest block %d is %s old", pretty.Abbrev(nodeID), req.BlockNumber, age.Truncate(time.Second))
+		}
+	}
+
 	peers := req.Peers
 	inactive, err := p.Store.UpdateNodePeers(store.NodeID(nodeID), peers, req.BlockNumber)
 	if err != nil {
 		return nil, err
 	}
+	if node.IsHost {
+		if err := p.saveSlots(node.ID, req.AvailableSlots); err != nil {
+			return nil, err
+		}
+	}
 
 	resp := UpdateResponse{
 		InvalidPeers: make([]string, 0, len(inactive)),
@@ -129,9 +227,18 @@ func (p *VipnodePool) Update(ctx context.Context, sig string, nodeID string, non
 	// FIXME: Is there a bug here when a host is connected to another host?
 	// TODO: Test InvalidPeers
 
+	// The previous balance is only needed for the audit entry.
+	auditBalance := p.auditing()
+	var prevBalance store.Balance
+	if auditBalance {
+		if prevBalance, err = p.Store.GetNodeBalance(node.ID); err != nil {
+			return nil, err
+		}
+	}
 	nodeBalance, err := p.BalanceManager.OnUpdate(nodeBeforeUpdate, validPeers)
 	if err != nil {
 		if _, ok := err.(balance.LowBalanceError); ok {
+			p.audit(AuditDisconnect, node.ID, "", fmt.Sprintf("low balance, %d peers", len(validPeers)))
 			disconnectErr := p.disconnectPeers(ctx, nodeID, validPeers)
 			if disconnectErr != nil {
 				logger.Printf("Client disconnect due to low balance: %q; disconnect RPC errors: %s", pretty.Abbrev(nodeID), disconnectErr)
@@ -142,8 +249,23 @@ func (p *VipnodePool) Update(ctx context.Context, sig string, nodeID string, non
 		return nil, err
 	}
 	resp.Balance = &nodeBalance
-
+	if change := balanceChange(prevBalance, nodeBalance); auditBalance && change.Sign() != 0 {
+		p.audit(AuditBalance, node.ID, "", fmt.Sprintf("%s, changed by %s", nodeBalance.String(), ether.Print(change)))
+	}
 	if node.IsHost {
+		resp.ClientTiers = p.clientTiers(validPeers)
+	} else {
+		if rater, ok := p.BalanceManager.(balance.Rater); ok {
+			resp.Expires = balance.Expiry(nodeBalance, rater.Rate(*node, validPeers), time.Now())
+		}
+		if reporter, ok := p.BalanceManager.(balance.GraceReporter); ok {
+			resp.Grace = reporter.GraceRemaining(*node, nodeBalance)
+		}
+	}
+
+	if node.IsHost && req.AvailableSlots != nil {
+		logger.Printf("Host update %q: %d peers, %d active, %d invalid, %d slots available. %s", pretty.Abbrev(nodeID), len(peers), len(validPeers), len(inactive), *req.AvailableSlots, nodeBalance.String())
+	} else if node.IsHost {
 		logger.Printf("Host update %q: %d peers, %d active, %d invalid. %s", pretty.Abbrev(nodeID), len(peers), len(validPeers), len(inactive), nodeBalance.String())
 	} else {
 		logger.Printf("Client update %q: %d peers, %d active, %d invalid. %s", pretty.Abbrev(nodeID), len(peers), len(validPeers), len(inactive), nodeBalance.String())
@@ -152,45 +274,132 @@ func (p *VipnodePool) Update(ctx context.Context, sig string, nodeID string, non
 	return &resp, nil
 }
 
+// register saves a node which is (re)registering with the pool. Registration
+// is idempotent: if the node is already registered as the same kind of node
+// and is still active, such as when an agent retries after a timeout, then
+// the existing entry is updated rather than reset. Its last seen time is
+// retained so that billing continues from the previous update, along with
+// any block number and network that the request didn't include. It returns
+// whether the node is newly registered.
+func (p *VipnodePool) register(node *store.Node) (isNew bool, err error) {
+	existing, err := p.Store.GetNode(node.ID)
+	if err == store.ErrUnregisteredNode {
+		return true, p.Store.SetNode(*node)
+	} else if err != nil {
+		return false, err
+	}
+
+	activeSince := node.LastSeen.Add(-store.ExpireInterval)
+	if existing.IsHost != node.IsHost || !existing.LastSeen.After(activeSince) {
+		// Stale or changed roles, start over.
+		return true, p.Store.SetNode(*node)
+	}
+	node.LastSeen = existing.LastSeen
+	if node.BlockNumber == 0 {
+		node.BlockNumber = existing.BlockNumber
+	}
+	if node.Network == 0 {
+		node.Network = existing.Network
+	}
+	return false, p.Store.SetNode(*node)
+}
+
+// checkDuplicateHost returns a DuplicateNodeError if node is registered by an
+// active host on another connection from a different address. Registrations
+// from the same address, such as after the agent restarted, replace the old
+// connection. A host which moved to a new address can register again once
+// its old registration expires.
+func (p *VipnodePool) checkDuplicateHost(node store.Node, service jsonrpc2.Service) error {
+	p.mu.Lock()
+	existing, ok := p.remoteHosts[node.ID]
+	p.mu.Unlock()
+	if !ok || existing == service {
+		return nil
+	}
+	source, existingSource := remoteHostname(service), remoteHostname(existing)
+	if source == "" || existingSource == "" || source == existingSource {
+		return nil
+	}
+	stored, err := p.Store.GetNode(node.ID)
+	if err == store.ErrUnregisteredNode {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if !stored.IsHost || !stored.LastSeen.After(node.LastSeen.Add(-store.ExpireInterval)) {
+		return nil
+	}
+	err = DuplicateNodeError{NodeID: string(node.ID), Source: source, Existing: existingSource}
+	logger.Printf("Rejected duplicate host: %s", err)
+	p.audit(AuditReject, node.ID, "", fmt.Sprintf("vipnode_host: duplicate node key from %s, active from %s", source, existingSource))
+	return err
+}
+
 // Host registers a full node to participate as a vipnode host in this pool.
-func (p *VipnodePool) Host(ctx context.Context, sig string, nodeID string, nonce int64, req HostRequest) (*HostResponse, error) {
-	// TODO: Send capabilities?
+func (p *VipnodePool) Host(ctx context.Context, sig string, nodeID string, nonce int64, req HostRequest) (_ *HostResponse, err error) {
+	defer p.countError("vipnode_host", &err)
 	if err := p.verify(sig, "vipnode_host", nodeID, nonce, req); err != nil {
 		return nil, err
 	}
+	if err := p.checkGenesis(req.Genesis); err != nil {
+		return nil, err
+	}
 
 	service, err := jsonrpc2.CtxService(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	remoteHost := ""
-	if withAddr, ok := service.(interface{ RemoteAddr() string }); ok {
-		remoteHost = (&url.URL{Host: withAddr.RemoteAddr()}).Hostname()
-	}
+	remoteHost := remoteHostname(service)
 	defaultPort := "30303"
 	nodeURI, err := normalizeNodeURI(req.NodeURI, nodeID, remoteHost, defaultPort)
 	if err != nil {
 		return nil, err
 	}
+	internalURI := ""
+	if req.InternalNodeURI != "" {
+		// The internal enode needs an explicit address, since the pool
+		// can't observe it.
+		if internalURI, err = normalizeNodeURI(req.InternalNodeURI, nodeID, "", defaultPort); err != nil {
+			return nil, err
+		}
+	}
 
 	// TODO: Confirm that it's a full node, not a light node? Doesn't super matter since if i
 	// TODO: Check versions?
 
-	logger.Printf("New %q host: %q", req.Kind, nodeURI)
-
+	now := time.Now()
 	node := store.Node{
-		ID:       store.NodeID(nodeID),
-		URI:      nodeURI,
-		Kind:     req.Kind,
-		LastSeen: time.Now(),
-		IsHost:   true,
-		Payout:   store.Account(req.Payout),
-	}
-	err = p.Store.SetNode(node)
+		ID:             store.NodeID(nodeID),
+		URI:            nodeURI,
+		InternalURI:    internalURI,
+		Kind:           req.Kind,
+		LastSeen:       now,
+		IsHost:         true,
+		Payout:         store.Account(req.Payout),
+		Network:        req.Network,
+		VipnodeVersion: req.VipnodeVersion,
+		ClockSkew:      nonceSkew(nonce, now),
+		Capabilities:   req.Capabilities,
+	}
+	if err := p.authorize("vipnode_host", node); err != nil {
+		return nil, err
+	}
+	if err := p.checkDuplicateHost(node, service); err != nil {
+		return nil, err
+	}
+	isNew, err := p.register(&node)
 	if err != nil {
 		return nil, err
 	}
+	p.Metrics.NodeRegistered(node)
+	p.audit(AuditRegister, node.ID, "", "host "+nodeURI)
+
+	if isNew {
+		logger.Printf("New %q host: %q", req.Kind, nodeURI)
+	} else {
+		logger.Printf("Re-registered %q host: %q", req.Kind, nodeURI)
+	}
 
 	// FIXME: Clean up disconnected hosts
 	p.mu.Lock()
@@ -199,22 +408,29 @@ func (p *VipnodePool) Host(ctx context.Context, sig string, nodeID string, nonce
 
 	resp := &HostResponse{
 		PoolVersion: p.Version,
+		PoolTime:    now,
 	}
 	return resp, nil
 }
 
 // Client returns a list of enodes who are ready for the client node to connect.
-func (p *VipnodePool) Client(ctx context.Context, sig string, nodeID string, nonce int64, req ClientRequest) (*ClientResponse, error) {
+func (p *VipnodePool) Client(ctx context.Context, sig string, nodeID string, nonce int64, req ClientRequest) (_ *ClientResponse, err error) {
+	defer p.countError("vipnode_client", &err)
 	if err := p.verify(sig, "vipnode_client", nodeID, nonce, req); err != nil {
 		return nil, err
 	}
+	if err := p.checkGenesis(req.Genesis); err != nil {
+		return nil, err
+	}
 
 	kind := req.Kind
 	// TODO: Unhardcode this, maybe add to ClientRequest (but limit to some number)
 	numRequestHosts := 3
 
+	now := time.Now()
 	response := &ClientResponse{
 		PoolVersion: p.Version,
+		PoolTime:    now,
 	}
 	if p.ClientMessager != nil {
 		response.Message = p.ClientMessager(nodeID)
@@ -224,20 +440,36 @@ func (p *VipnodePool) Client(ctx context.Context, sig string, nodeID string, non
 	// get successfully whitelisted, then switched to host status thus bypass
 	// billing?
 	node := store.Node{
-		ID:       store.NodeID(nodeID),
-		Kind:     kind,
-		LastSeen: time.Now(),
-		IsHost:   false,
+		ID:             store.NodeID(nodeID),
+		Kind:           kind,
+		LastSeen:       now,
+		IsHost:         false,
+		VipnodeVersion: req.VipnodeVersion,
+		ClockSkew:      nonceSkew(nonce, now),
+	}
+	if err := p.authorize("vipnode_client", node); err != nil {
+		return nil, err
 	}
-	if err := p.Store.SetNode(node); err != nil {
+	if _, err := p.register(&node); err != nil {
 		return nil, err
 	}
+	p.Metrics.NodeRegistered(node)
+	p.audit(AuditRegister, node.ID, "", "client")
 
 	if err := p.BalanceManager.OnClient(node); err != nil {
 		return nil, err
 	}
 
-	r, err := p.Store.ActiveHosts(kind, numRequestHosts)
+	// Clients on a bidirectional connection can be migrated between hosts.
+	clientIP := ""
+	if service, err := jsonrpc2.CtxService(ctx); err == nil {
+		clientIP = remoteHostname(service)
+		p.mu.Lock()
+		p.remoteClients[node.ID] = service
+		p.mu.Unlock()
+	}
+
+	r, err := p.matchingHosts(kind, numRequestHosts, req)
 	if err != nil {
 		return nil, err
 	}
@@ -248,7 +480,9 @@ func (p *VipnodePool) Client(ctx context.Context, sig string, nodeID string, non
 
 	if p.skipWhitelist {
 		logger.Printf("New %q client: %q (%d hosts found, skipping whitelist)", kind, pretty.Abbrev(nodeID), len(r))
-		response.Hosts = r
+		response.Hosts = p.advertiseHosts(r, clientIP)
+		p.Metrics.HostsAssigned(node, r)
+		p.auditAssigned(node, r)
 		return response, nil
 	}
 
@@ -267,32 +501,40 @@ func (p *VipnodePool) Client(ctx context.Context, sig string, nodeID string, non
 	}
 	p.mu.Unlock()
 
-	accepted := make([]store.Node, 0, len(remotes))
 	callCtx, cancel := context.WithTimeout(ctx, poolWhitelistTimeout)
 
 	// Parallelize whitelist, return any hosts that respond within the timeout.
 	errChan := make(chan error)
-	acceptChan := make(chan store.Node)
+	acceptChan := make(chan int)
 
-	for _, remote := range remotes {
-		go func(service jsonrpc2.Service, node store.Node) {
+	for i, remote := range remotes {
+		go func(i int, service jsonrpc2.Service) {
 			if err := service.Call(callCtx, nil, "vipnode_whitelist", nodeID); err != nil {
 				errChan <- err
 			} else {
-				acceptChan <- node
+				acceptChan <- i
 			}
-		}(remote.Service, remote.Node)
+		}(i, remote.Service)
 	}
 
+	ok := make([]bool, len(remotes))
 	for i := len(remotes); i > 0; i-- {
 		select {
-		case node := <-acceptChan:
-			accepted = append(accepted, node)
+		case i := <-acceptChan:
+			ok[i] = true
 		case err := <-errChan:
 			errors = append(errors, err)
 		}
 	}
 	cancel()
+	// Keep the hosts in the order they were picked, rather than the order
+	// they responded in.
+	accepted := make([]store.Node, 0, len(remotes))
+	for i, remote := range remotes {
+		if ok[i] {
+			accepted = append(accepted, remote.Node)
+		}
+	}
 	// TODO: Penalize hosts that failed to respond within the deadline?
 
 	if len(errors) > 0 {
@@ -302,7 +544,9 @@ func (p *VipnodePool) Client(ctx context.Context, sig string, nodeID string, non
 	}
 
 	if len(accepted) >= 1 {
-		response.Hosts = accepted
+		response.Hosts = p.advertiseHosts(accepted, clientIP)
+		p.Metrics.HostsAssigned(node, accepted)
+		p.auditAssigned(node, accepted)
 		return response, nil
 	}
 
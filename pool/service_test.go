@@ -2,12 +2,15 @@ package pool
 
 import (
 	"context"
+	"math/big"
 	"testing"
 	"time"
 
 	"github.com/ethereum/go-ethereum/p2p/discv5"
 	"github.com/vipnode/vipnode/internal/keygen"
 	"github.com/vipnode/vipnode/jsonrpc2"
+	"github.com/vipnode/vipnode/pool/balance"
+	"github.com/vipnode/vipnode/pool/store"
 	"github.com/vipnode/vipnode/pool/store/memory"
 	"github.com/vipnode/vipnode/request"
 )
@@ -76,3 +79,365 @@ func TestPoolService(t *testing.T) {
 		}
 	}
 }
+
+type fakeMetrics struct {
+	registered []store.Node
+	assigned   int
+	errors     []string
+}
+
+func (m *fakeMetrics) NodeRegistered(node store.Node) { m.registered = append(m.registered, node) }
+func (m *fakeMetrics) HostsAssigned(client store.Node, hosts []store.Node) {
+	m.assigned += len(hosts)
+}
+func (m *fakeMetrics) RPCError(method string, err error) { m.errors = append(m.errors, method) }
+
+func TestPoolMetrics(t *testing.T) {
+	metrics := &fakeMetrics{}
+	pool := New(memory.New(), nil)
+	pool.Metrics = metrics
+	pool.skipWhitelist = true
+
+	server, host := jsonrpc2.ServePipe()
+	server.Server.Register("vipnode_", pool)
+	hostKey := keygen.HardcodedKeyIdx(t, 0)
+	hostID := discv5.PubkeyID(&hostKey.PublicKey).String()
+	remoteHost := Remote(host, hostKey)
+	if _, err := remoteHost.Host(context.Background(), HostRequest{Kind: "geth", NodeURI: "enode://" + hostID + "@127.0.0.1:30303", Network: 4, VipnodeVersion: "v2.1.0"}); err != nil {
+		t.Fatal(err)
+	}
+
+	server2, client := jsonrpc2.ServePipe()
+	server2.Server.Register("vipnode_", pool)
+	remoteClient := Remote(client, keygen.HardcodedKeyIdx(t, 1))
+	if _, err := remoteClient.Client(context.Background(), ClientRequest{Kind: "geth", VipnodeVersion: "v2.0.0"}); err != nil {
+		t.Fatal(err)
+	}
+	// No parity hosts
+	if _, err := remoteClient.Client(context.Background(), ClientRequest{Kind: "parity"}); err == nil {
+		t.Fatal("expected error")
+	}
+
+	if len(metrics.registered) != 3 || !metrics.registered[0].IsHost || metrics.registered[1].IsHost {
+		t.Errorf("unexpected registrations: %v", metrics.registered)
+	}
+	if metrics.registered[0].Network != 4 {
+		t.Errorf("host network was not stored: %v", metrics.registered[0])
+	}
+	if metrics.registered[0].VipnodeVersion != "v2.1.0" || metrics.registered[1].VipnodeVersion != "v2.0.0" {
+		t.Errorf("agent versions were not stored: %v", metrics.registered)
+	}
+	if metrics.assigned != 1 {
+		t.Errorf("unexpected assignments: %d", metrics.assigned)
+	}
+	if len(metrics.errors) != 1 || metrics.errors[0] != "vipnode_client" {
+		t.Errorf("unexpected errors: %v", metrics.errors)
+	}
+}
+
+func TestUpdateSignature(t *testing.T) {
+	pool := New(memory.New(), nil)
+	server, host := jsonrpc2.ServePipe()
+	server.Server.Register("vipnode_", pool)
+	hostKey := keygen.HardcodedKeyIdx(t, 0)
+	hostID := discv5.PubkeyID(&hostKey.PublicKey).String()
+	if _, err := Remote(host, hostKey).Host(context.Background(), HostRequest{Kind: "geth", NodeURI: "enode://" + hostID + "@127.0.0.1:30303"}); err != nil {
+		t.Fatal(err)
+	}
+
+	update := UpdateRequest{Peers: []string{}, BlockNumber: 42}
+	nonce := time.Now().UnixNano()
+
+	// Heartbeat for the host's node ID, signed by a different key with a
+	// far-future nonce.
+	forged := request.NodeRequest{
+		Method:    "vipnode_update",
+		NodeID:    hostID,
+		Nonce:     nonce + int64(time.Hour),
+		ExtraArgs: []interface{}{update},
+	}
+	sig, err := forged.Sign(keygen.HardcodedKeyIdx(t, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pool.Update(context.Background(), sig, forged.NodeID, forged.Nonce, update); err == nil {
+		t.Fatal("forged update was accepted")
+	} else if _, ok := err.(VerifyFailedError); !ok {
+		t.Errorf("unexpected error: %s (%T)", err, err)
+	}
+
+	// The forged nonce must not lock out the real host.
+	valid := forged
+	valid.Nonce = nonce
+	sig, err = valid.Sign(hostKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp, err := pool.Update(context.Background(), sig, valid.NodeID, valid.Nonce, update); err != nil {
+		t.Fatalf("valid update was rejected: %s", err)
+	} else if resp.Balance == nil {
+		t.Errorf("missing balance in response: %+v", resp)
+	}
+
+	// Replaying the valid update is rejected.
+	if _, err := pool.Update(context.Background(), sig, valid.NodeID, valid.Nonce, update); err == nil {
+		t.Error("replayed update was accepted")
+	}
+}
+
+func TestRegisterIdempotent(t *testing.T) {
+	storeDriver := memory.New()
+	pool := New(storeDriver, nil)
+	pool.skipWhitelist = true
+	server, host := jsonrpc2.ServePipe()
+	server.Server.Register("vipnode_", pool)
+	hostKey := keygen.HardcodedKeyIdx(t, 0)
+	hostID := store.NodeID(discv5.PubkeyID(&hostKey.PublicKey).String())
+	remoteHost := Remote(host, hostKey)
+	req := HostRequest{Kind: "geth", NodeURI: "enode://" + string(hostID) + "@127.0.0.1:30303", Payout: "abcd"}
+
+	if _, err := remoteHost.Host(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+	node, err := storeDriver.GetNode(hostID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// State accumulated since the first registration
+	lastSeen := node.LastSeen.Add(-time.Minute)
+	node.LastSeen = lastSeen
+	node.BlockNumber = 42
+	if err := storeDriver.SetNode(*node); err != nil {
+		t.Fatal(err)
+	}
+	if err := storeDriver.AddNodeBalance(hostID, big.NewInt(1000)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Retry, as if the first response was lost
+	if _, err := remoteHost.Host(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+
+	hosts, _, err := storeDriver.ListHosts("", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hosts) != 1 {
+		t.Fatalf("expected a single host entry, got %d: %v", len(hosts), hosts)
+	}
+	if got := hosts[0]; !got.LastSeen.Equal(lastSeen) || got.BlockNumber != 42 || got.Payout != "abcd" || got.URI != req.NodeURI {
+		t.Errorf("inconsistent host entry after retry: %+v", got)
+	}
+	if balance, err := storeDriver.GetNodeBalance(hostID); err != nil {
+		t.Fatal(err)
+	} else if balance.Credit.Int64() != 1000 {
+		t.Errorf("balance was not preserved: %s", balance.String())
+	}
+
+	// Registering after the entry went stale starts over.
+	hosts[0].LastSeen = time.Now().Add(-2 * store.ExpireInterval)
+	if err := storeDriver.SetNode(hosts[0]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := remoteHost.Host(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+	if node, err := storeDriver.GetNode(hostID); err != nil {
+		t.Fatal(err)
+	} else if time.Since(node.LastSeen) > time.Minute || node.BlockNumber != 0 {
+		t.Errorf("stale host entry was not refreshed: %+v", node)
+	}
+}
+
+func TestRegisterDuplicateNodeKey(t *testing.T) {
+	storeDriver := memory.New()
+	pool := New(storeDriver, nil)
+	hostKey := keygen.HardcodedKeyIdx(t, 0)
+	hostID := store.NodeID(discv5.PubkeyID(&hostKey.PublicKey).String())
+	req := HostRequest{Kind: "geth", NodeURI: "enode://" + string(hostID) + "@203.0.113.5:30303"}
+	register := func(addr string) error {
+		server, host := servePipeFrom(addr)
+		server.Server.Register("vipnode_", pool)
+		_, err := Remote(host, hostKey).Host(context.Background(), req)
+		return err
+	}
+
+	if err := register("203.0.113.5:41000"); err != nil {
+		t.Fatal(err)
+	}
+	// A clone of the host on another machine, with the same node key.
+	want := DuplicateNodeError{NodeID: string(hostID), Source: "198.51.100.7", Existing: "203.0.113.5"}
+	err := register("198.51.100.7:41000")
+	if err == nil || err.Error() != want.Error() {
+		t.Errorf("expected %q, got: %v", want, err)
+	}
+	if !jsonrpc2.IsErrorCode(err, ErrCodeDuplicateNode) {
+		t.Errorf("expected error code %d, got: %v", ErrCodeDuplicateNode, err)
+	}
+	pool.mu.Lock()
+	remote := pool.remoteHosts[hostID]
+	pool.mu.Unlock()
+	if got := remoteHostname(remote); got != "203.0.113.5" {
+		t.Errorf("the active host's connection was replaced by one from %s", got)
+	}
+
+	// The same host reconnecting, such as after restarting the agent.
+	if err := register("203.0.113.5:42000"); err != nil {
+		t.Errorf("reconnecting from the same address failed: %s", err)
+	}
+
+	// Once the active host's registration expires, another address can
+	// take over, such as after the host moved.
+	node, err := storeDriver.GetNode(hostID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	node.LastSeen = time.Now().Add(-2 * store.ExpireInterval)
+	if err := storeDriver.SetNode(*node); err != nil {
+		t.Fatal(err)
+	}
+	if err := register("198.51.100.7:41000"); err != nil {
+		t.Errorf("registering after the old registration expired failed: %s", err)
+	}
+}
+
+func TestGenesisMismatch(t *testing.T) {
+	pool := New(memory.New(), nil)
+	pool.skipWhitelist = true
+	pool.Genesis = "0x6341fd3daf94b748c72ced5a5b26028f2474f5f00d824504e4fa37a75767e177"
+
+	server, host := jsonrpc2.ServePipe()
+	server.Server.Register("vipnode_", pool)
+	hostKey := keygen.HardcodedKeyIdx(t, 0)
+	hostID := discv5.PubkeyID(&hostKey.PublicKey).String()
+	remoteHost := Remote(host, hostKey)
+	req := HostRequest{Kind: "geth", NodeURI: "enode://" + hostID + "@127.0.0.1:30303", Genesis: "0x6341FD3DAF94B748C72CED5A5B26028F2474F5F00D824504E4FA37A75767E177"}
+	if _, err := remoteHost.Host(context.Background(), req); err != nil {
+		t.Fatalf("expected matching genesis to register: %s", err)
+	}
+
+	server2, client := jsonrpc2.ServePipe()
+	server2.Server.Register("vipnode_", pool)
+	remoteClient := Remote(client, keygen.HardcodedKeyIdx(t, 1))
+	_, err := remoteClient.Client(context.Background(), ClientRequest{Kind: "geth", Genesis: "0xd4e56740f876aef8c010b86a40d5f56745a118d0906a34e69aec8c0db1cb8fa3"})
+	if err == nil || err.Error() != (GenesisMismatchError{Want: pool.Genesis, Got: "0xd4e56740f876aef8c010b86a40d5f56745a118d0906a34e69aec8c0db1cb8fa3"}).Error() {
+		t.Errorf("expected GenesisMismatchError, got: %v", err)
+	}
+
+	// Agents which don't report their genesis are allowed.
+	if _, err := remoteClient.Client(context.Background(), ClientRequest{Kind: "geth"}); err != nil {
+		t.Errorf("expected client without a genesis to be allowed: %s", err)
+	}
+}
+
+func TestUpdateExpires(t *testing.T) {
+	ctx := context.Background()
+	db := memory.New()
+	pool := New(db, balance.PayPerInterval(db, time.Minute, big.NewInt(1000)))
+	pool.skipWhitelist = true
+
+	server, host := jsonrpc2.ServePipe()
+	server.Server.Register("vipnode_", pool)
+	hostKey := keygen.HardcodedKeyIdx(t, 0)
+	hostID := discv5.PubkeyID(&hostKey.PublicKey).String()
+	remoteHost := Remote(host, hostKey)
+	if _, err := remoteHost.Host(ctx, HostRequest{Kind: "geth", NodeURI: "enode://" + hostID + "@127.0.0.1:30303"}); err != nil {
+		t.Fatal(err)
+	}
+
+	server2, client := jsonrpc2.ServePipe()
+	server2.Server.Register("vipnode_", pool)
+	clientKey := keygen.HardcodedKeyIdx(t, 1)
+	clientID := store.NodeID(discv5.PubkeyID(&clientKey.PublicKey).String())
+	remoteClient := Remote(client, clientKey)
+	if _, err := remoteClient.Client(ctx, ClientRequest{Kind: "geth"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AddNodeBalance(clientID, big.NewInt(10000)); err != nil {
+		t.Fatal(err)
+	}
+
+	// No peers, not charged.
+	resp, err := remoteClient.Update(ctx, UpdateRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Expires != nil {
+		t.Errorf("expected no expiry without peers, got %s", resp.Expires)
+	}
+
+	// About 10 minutes left at 1000 per minute.
+	before := time.Now()
+	resp, err = remoteClient.Update(ctx, UpdateRequest{Peers: []string{hostID}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Expires == nil {
+		t.Fatal("expected expiry")
+	}
+	if got := resp.Expires.Sub(before); got > 10*time.Minute+time.Second || got < 9*time.Minute {
+		t.Errorf("expected expiry in about 10m, got %s", got)
+	}
+
+	// Host updates aren't charged.
+	hostResp, err := remoteHost.Update(ctx, UpdateRequest{Peers: []string{string(clientID)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hostResp.Expires != nil {
+		t.Errorf("expected no expiry for hosts, got %s", hostResp.Expires)
+	}
+}
+
+func TestUpdateGrace(t *testing.T) {
+	ctx := context.Background()
+	db := memory.New()
+	// Pricey enough that the time between calls is billed.
+	balanceManager := balance.PayPerInterval(db, time.Minute, big.NewInt(1e12))
+	balanceManager.Grace.Period = time.Hour
+	pool := New(db, balanceManager)
+	pool.skipWhitelist = true
+
+	server, host := jsonrpc2.ServePipe()
+	server.Server.Register("vipnode_", pool)
+	hostKey := keygen.HardcodedKeyIdx(t, 0)
+	hostID := discv5.PubkeyID(&hostKey.PublicKey).String()
+	remoteHost := Remote(host, hostKey)
+	if _, err := remoteHost.Host(ctx, HostRequest{Kind: "geth", NodeURI: "enode://" + hostID + "@127.0.0.1:30303"}); err != nil {
+		t.Fatal(err)
+	}
+
+	server2, client := jsonrpc2.ServePipe()
+	server2.Server.Register("vipnode_", pool)
+	clientKey := keygen.HardcodedKeyIdx(t, 1)
+	clientID := store.NodeID(discv5.PubkeyID(&clientKey.PublicKey).String())
+	remoteClient := Remote(client, clientKey)
+	if _, err := remoteClient.Client(ctx, ClientRequest{Kind: "geth"}); err != nil {
+		t.Fatal(err)
+	}
+	// Right at the minimum, so the balance falls below it on the first
+	// update.
+	if err := db.AddNodeBalance(clientID, big.NewInt(20000)); err != nil {
+		t.Fatal(err)
+	}
+	balanceManager.MinBalance = big.NewInt(20000)
+
+	before := time.Now()
+	resp, err := remoteClient.Update(ctx, UpdateRequest{Peers: []string{hostID}})
+	if err != nil {
+		t.Fatalf("expected the client to keep its peers during its grace: %s", err)
+	}
+	if resp.Grace == nil || resp.Grace.Until == nil {
+		t.Fatalf("expected a grace period in the response, got: %v", resp.Grace)
+	}
+	if got := resp.Grace.Until.Sub(before); got > time.Hour+time.Second || got < time.Hour-time.Second {
+		t.Errorf("expected the grace to end in about 1h, got %s", got)
+	}
+
+	// Once the grace is exhausted, the client is disconnected.
+	balanceManager.Grace.Period = time.Nanosecond
+	if _, err := remoteClient.Update(ctx, UpdateRequest{Peers: []string{hostID}}); err == nil {
+		t.Error("expected a low balance error after the grace")
+	}
+}
@@ -43,3 +43,7 @@ func (s *StaticPool) Update(ctx context.Context, req UpdateRequest) (*UpdateResp
 func (s *StaticPool) Withdraw(ctx context.Context) error {
 	return errors.New("not implemented")
 }
+
+func (s *StaticPool) Report(ctx context.Context, req ReportRequest) error {
+	return nil
+}
@@ -11,6 +11,9 @@ import (
 
 const statusTimeout = time.Second * 10
 
+// maxPageLimit is the maximum number of hosts returned by a Hosts call.
+const maxPageLimit = 100
+
 // TODO: Support event sub?
 
 // Host is a public view of a hosting node.
@@ -20,6 +23,18 @@ type Host struct {
 	Kind        string    `json:"kind"`
 	BlockNumber uint64    `json:"block_number"`
 
+	// VipnodeVersion is the version of the host's vipnode agent, if known.
+	VipnodeVersion string `json:"vipnode_version,omitempty"`
+
+	// ClockSkew is how many seconds the host's clock was ahead of the pool's
+	// when it registered, if known. Hosts with a skewed clock can have their
+	// requests rejected.
+	ClockSkew float64 `json:"clock_skew,omitempty"`
+
+	// Capabilities are the features that the host advertised, like
+	// "archive", for clients to filter on.
+	Capabilities map[string]string `json:"capabilities,omitempty"`
+
 	// TODO: Add peers
 }
 
@@ -29,10 +44,13 @@ func nodeHost(n store.Node) Host {
 		shortID = shortID[:12]
 	}
 	return Host{
-		ShortID:     shortID,
-		LastSeen:    n.LastSeen,
-		Kind:        n.Kind,
-		BlockNumber: n.BlockNumber,
+		ShortID:        shortID,
+		LastSeen:       n.LastSeen,
+		Kind:           n.Kind,
+		BlockNumber:    n.BlockNumber,
+		VipnodeVersion: n.VipnodeVersion,
+		ClockSkew:      n.ClockSkew.Seconds(),
+		Capabilities:   n.Capabilities,
 	}
 }
 
@@ -59,6 +77,16 @@ type StatusResponse struct {
 	Error error `json:"error,omitempty"`
 }
 
+// HostsResponse is the response type for Hosts RPC calls.
+type HostsResponse struct {
+	// Hosts is a page of hosts, ordered by ID.
+	Hosts []Host `json:"hosts"`
+
+	// Next is the cursor for the following page, or empty if this is the
+	// last page.
+	Next string `json:"next,omitempty"`
+}
+
 // PoolStatus is a service for providing data to a pool status dashboard over
 // RPC. Because status calls are unathenticated, the service only provides
 // cached public consumable data.
@@ -147,3 +175,26 @@ func (s *PoolStatus) Status(ctx context.Context) (*StatusResponse, error) {
 	s.cachedResp = r
 	return r, err
 }
+
+// Hosts returns a page of up to limit hosts, including inactive ones,
+// starting after the cursor from a previous response. An empty cursor starts
+// from the first page. Limit is capped to maxPageLimit, or defaults to it if
+// it's 0.
+func (s *PoolStatus) Hosts(ctx context.Context, cursor string, limit int) (*HostsResponse, error) {
+	if limit <= 0 || limit > maxPageLimit {
+		limit = maxPageLimit
+	}
+	nodes, next, err := s.Store.ListHosts(cursor, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &HostsResponse{
+		Hosts: make([]Host, 0, len(nodes)),
+		Next:  next,
+	}
+	for _, n := range nodes {
+		r.Hosts = append(r.Hosts, nodeHost(n))
+	}
+	return r, nil
+}
@@ -55,7 +55,7 @@ func TestPoolStatus(t *testing.T) {
 
 	compareJSON(t, r, expected)
 
-	hostNode := store.Node{ID: "12345678901234567890", IsHost: true, Kind: "geth", LastSeen: now}
+	hostNode := store.Node{ID: "12345678901234567890", IsHost: true, Kind: "geth", LastSeen: now, VipnodeVersion: "v2.1.0", ClockSkew: -90 * time.Second}
 	if err := s.Store.SetNode(hostNode); err != nil {
 		t.Fatal(err)
 	}
@@ -86,9 +86,11 @@ func TestPoolStatus(t *testing.T) {
 		},
 		ActiveHosts: []Host{
 			Host{
-				ShortID:  "123456789012",
-				LastSeen: now,
-				Kind:     "geth",
+				ShortID:        "123456789012",
+				LastSeen:       now,
+				Kind:           "geth",
+				VipnodeVersion: "v2.1.0",
+				ClockSkew:      -90,
 			},
 		},
 		Error: nil,
@@ -96,3 +98,35 @@ func TestPoolStatus(t *testing.T) {
 
 	compareJSON(t, r, expected)
 }
+
+func TestPoolStatusHosts(t *testing.T) {
+	s := PoolStatus{
+		Store: memory.New(),
+	}
+
+	for _, id := range []store.NodeID{"c", "a", "b"} {
+		if err := s.Store.SetNode(store.Node{ID: id, IsHost: true}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Store.SetNode(store.Node{ID: "client"}); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := s.Hosts(context.Background(), "", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareJSON(t, r, &HostsResponse{
+		Hosts: []Host{{ShortID: "a"}, {ShortID: "b"}},
+		Next:  "b",
+	})
+
+	r, err = s.Hosts(context.Background(), r.Next, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareJSON(t, r, &HostsResponse{
+		Hosts: []Host{{ShortID: "c"}},
+	})
+}
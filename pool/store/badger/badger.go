@@ -14,6 +14,10 @@ import (
 
 // TODO: Set reasonable expiration values?
 
+// maxConflictRetries is the number of times a transaction is retried when it
+// conflicts with a concurrent transaction.
+const maxConflictRetries = 10
+
 type peers map[store.NodeID]time.Time
 
 // Open returns a store.Store implementation using Badger as the storage
@@ -166,6 +170,52 @@ func (s *badgerStore) AddAccountBalance(account store.Account, credit *big.Int)
 	})
 }
 
+// Transfer atomically moves amount of credit from one account's balance to
+// another's.
+func (s *badgerStore) Transfer(from, to store.Account, amount *big.Int) error {
+	if amount.Sign() < 0 {
+		return store.ErrInvalidAmount
+	}
+	fromKey := []byte(fmt.Sprintf("vip:balance:%s", from))
+	toKey := []byte(fmt.Sprintf("vip:balance:%s", to))
+	transfer := func(txn *badger.Txn) error {
+		var fromBalance store.Balance
+		if err := getItem(txn, fromKey, &fromBalance); err == badger.ErrKeyNotFound {
+			// No balance = empty balance
+		} else if err != nil {
+			return err
+		}
+		if fromBalance.Credit.Cmp(amount) < 0 {
+			return store.ErrInsufficientBalance
+		}
+		fromBalance.Credit.Sub(&fromBalance.Credit, amount)
+		fromBalance.Account = from
+		if err := setItem(txn, fromKey, &fromBalance); err != nil {
+			return err
+		}
+
+		var toBalance store.Balance
+		if err := getItem(txn, toKey, &toBalance); err == badger.ErrKeyNotFound {
+			// No balance = empty balance
+		} else if err != nil {
+			return err
+		}
+		toBalance.Credit.Add(&toBalance.Credit, amount)
+		toBalance.Account = to
+		return setItem(txn, toKey, &toBalance)
+	}
+
+	// Concurrent transactions that touch the same balances will conflict,
+	// so we retry them.
+	var err error
+	for i := 0; i < maxConflictRetries; i++ {
+		if err = s.db.Update(transfer); err != badger.ErrConflict {
+			return err
+		}
+	}
+	return err
+}
+
 // AddAccountNode authorizes a nodeID to be a spender of an account's
 // balance. This should migrate any existing node's balance credit to the
 // account.
@@ -351,6 +401,82 @@ func (s *badgerStore) SetNode(n store.Node) error {
 	})
 }
 
+// EvictNodes removes nodes which were last seen before olderThan.
+func (s *badgerStore) EvictNodes(olderThan time.Time) ([]store.NodeID, error) {
+	evicted := []store.NodeID{}
+	err := s.db.Update(func(txn *badger.Txn) error {
+		prefix := []byte("vip:node:")
+		var n store.Node
+		if err := loopItem(txn, prefix, &n, func() error {
+			if n.LastSeen.Before(olderThan) {
+				evicted = append(evicted, n.ID)
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+		for _, nodeID := range evicted {
+			if err := txn.Delete([]byte(fmt.Sprintf("vip:node:%s", nodeID))); err != nil {
+				return err
+			}
+			if err := txn.Delete([]byte(fmt.Sprintf("vip:peers:%s", nodeID))); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return evicted, nil
+}
+
+// ListHosts returns a page of host nodes ordered by ID, starting after cursor.
+func (s *badgerStore) ListHosts(cursor string, limit int) ([]store.Node, string, error) {
+	return s.listNodes(true, cursor, limit)
+}
+
+// ListClients returns a page of client nodes ordered by ID, starting after cursor.
+func (s *badgerStore) ListClients(cursor string, limit int) ([]store.Node, string, error) {
+	return s.listNodes(false, cursor, limit)
+}
+
+func (s *badgerStore) listNodes(isHost bool, cursor string, limit int) ([]store.Node, string, error) {
+	r := []store.Node{}
+	err := s.db.View(func(txn *badger.Txn) error {
+		// Keys are iterated in order, so the node IDs are sorted.
+		prefix := []byte("vip:node:")
+		cursorKey := []byte(fmt.Sprintf("vip:node:%s", cursor))
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		for it.Seek(cursorKey); it.ValidForPrefix(prefix); it.Next() {
+			if cursor != "" && bytes.Equal(it.Item().Key(), cursorKey) {
+				continue
+			}
+			var n store.Node
+			if err := it.Item().Value(func(val []byte) error {
+				return gob.NewDecoder(bytes.NewReader(val)).Decode(&n)
+			}); err != nil {
+				return err
+			}
+			if n.IsHost != isHost {
+				continue
+			}
+			r = append(r, n)
+			if limit > 0 && len(r) > limit {
+				// One extra to know if there's a next page
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	page, next := store.Paginate(r, limit)
+	return page, next, nil
+}
+
 func (s *badgerStore) NodePeers(nodeID store.NodeID) ([]store.Node, error) {
 	peersKey := []byte(fmt.Sprintf("vip:peers:%s", nodeID))
 	var r []store.Node
@@ -433,6 +559,41 @@ func (s *badgerStore) UpdateNodePeers(nodeID store.NodeID, peers []string, block
 	return
 }
 
+// sessionKey orders sessions by their end time.
+func sessionKey(end time.Time) string {
+	return fmt.Sprintf("vip:session:%016x", uint64(end.UnixNano()))
+}
+
+// AddSession records a billed session.
+func (s *badgerStore) AddSession(session store.Session) error {
+	key := []byte(fmt.Sprintf("%s:%s:%s", sessionKey(session.End), session.ClientID, session.HostID))
+	return s.db.Update(func(txn *badger.Txn) error {
+		return setItem(txn, key, &session)
+	})
+}
+
+// Sessions calls fn for each session which ended within [since, until).
+func (s *badgerStore) Sessions(since, until time.Time, fn func(store.Session) error) error {
+	prefix := []byte("vip:session:")
+	end := []byte(sessionKey(until))
+	return s.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		for it.Seek([]byte(sessionKey(since))); it.ValidForPrefix(prefix) && bytes.Compare(it.Item().Key(), end) < 0; it.Next() {
+			var session store.Session
+			if err := it.Item().Value(func(val []byte) error {
+				return gob.NewDecoder(bytes.NewReader(val)).Decode(&session)
+			}); err != nil {
+				return err
+			}
+			if err := fn(session); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
 // Stats returns aggregate statistics about the store state.
 func (s *badgerStore) Stats() (*store.Stats, error) {
 	stats := store.Stats{}
@@ -0,0 +1,573 @@
+package bolt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/big"
+	"math/rand"
+	"time"
+
+	"github.com/vipnode/vipnode/pool/store"
+	"go.etcd.io/bbolt"
+)
+
+var (
+	bucketMeta     = []byte("meta")
+	bucketHosts    = []byte("hosts")
+	bucketClients  = []byte("clients")
+	bucketPeers    = []byte("peers")
+	bucketAccounts = []byte("accounts")
+	bucketBalances = []byte("balances")
+	bucketTrials   = []byte("trials")
+	bucketNonces   = []byte("nonces")
+	bucketSessions = []byte("sessions")
+)
+
+// allBuckets are created when the database is opened.
+var allBuckets = [][]byte{
+	bucketMeta,
+	bucketHosts,
+	bucketClients,
+	bucketPeers,
+	bucketAccounts,
+	bucketBalances,
+	bucketTrials,
+	bucketNonces,
+	bucketSessions,
+}
+
+// Open returns a store.Store implementation using BoltDB as the storage
+// driver, persisted in a single file at path. The store should be
+// (*boltStore).Close()'d after use.
+//
+// Only one process can have the database open at a time, so Open fails after
+// a timeout if the file is locked by another process.
+func Open(path string) (*boltStore, error) {
+	db, err := bbolt.Open(path, 0600, &bbolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := MigrateLatest(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	s := &boltStore{
+		db:          db,
+		nonceExpire: store.ExpireNonce,
+	}
+	return s, nil
+}
+
+var _ store.Store = &boltStore{}
+
+// boltStore keeps each kind of record in its own bucket, keyed by ID. Hosts
+// and clients are kept in separate buckets so that they can be listed
+// without scanning each other. Every Update transaction is fsync'd before
+// it returns.
+type boltStore struct {
+	db *bbolt.DB
+
+	nonceExpire time.Duration
+}
+
+func (s *boltStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *boltStore) CheckAndSaveNonce(ID string, nonce int64) error {
+	// If nonceExpire is set, nonce should be within nonceExpire of now.
+	if s.nonceExpire > 0 {
+		if nonce <= time.Now().Add(-s.nonceExpire).UnixNano() {
+			// Nonce is too old
+			return store.ErrInvalidNonce
+		}
+	}
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(bucketNonces)
+		var lastNonce int64
+		if err := getItem(b, []byte(ID), &lastNonce); err != nil && err != errNotFound {
+			return err
+		}
+		if lastNonce >= nonce {
+			return store.ErrInvalidNonce
+		}
+		return setItem(b, []byte(ID), &nonce)
+	})
+}
+
+// getNode loads a node from either the hosts or clients bucket.
+func getNode(tx *bbolt.Tx, nodeID store.NodeID, into *store.Node) error {
+	err := getItem(tx.Bucket(bucketHosts), []byte(nodeID), into)
+	if err == errNotFound {
+		err = getItem(tx.Bucket(bucketClients), []byte(nodeID), into)
+	}
+	if err == errNotFound {
+		return store.ErrUnregisteredNode
+	}
+	return err
+}
+
+func hasNode(tx *bbolt.Tx, nodeID store.NodeID) bool {
+	return tx.Bucket(bucketHosts).Get([]byte(nodeID)) != nil || tx.Bucket(bucketClients).Get([]byte(nodeID)) != nil
+}
+
+// putNode saves the node into the bucket matching its IsHost, and removes it
+// from the other.
+func putNode(tx *bbolt.Tx, n *store.Node) error {
+	bucket, other := bucketClients, bucketHosts
+	if n.IsHost {
+		bucket, other = bucketHosts, bucketClients
+	}
+	if err := tx.Bucket(other).Delete([]byte(n.ID)); err != nil {
+		return err
+	}
+	return setItem(tx.Bucket(bucket), []byte(n.ID), n)
+}
+
+// nodeBalanceKey returns the bucket and key where the node's balance is
+// kept, depending on whether it has an account.
+func nodeBalanceKey(tx *bbolt.Tx, nodeID store.NodeID) (bucket *bbolt.Bucket, key []byte, account store.Account, err error) {
+	if err := getItem(tx.Bucket(bucketAccounts), []byte(nodeID), &account); err == errNotFound {
+		return tx.Bucket(bucketTrials), []byte(nodeID), "", nil
+	} else if err != nil {
+		return nil, nil, "", err
+	}
+	return tx.Bucket(bucketBalances), []byte(account), account, nil
+}
+
+// GetNodeBalance returns the current account balance for a node.
+func (s *boltStore) GetNodeBalance(nodeID store.NodeID) (store.Balance, error) {
+	var r store.Balance
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		if !hasNode(tx, nodeID) {
+			return store.ErrUnregisteredNode
+		}
+		b, key, account, err := nodeBalanceKey(tx, nodeID)
+		if err != nil {
+			return err
+		}
+		if err := getItem(b, key, &r); err != nil && err != errNotFound {
+			return err
+		}
+		if account != "" {
+			r.Account = account
+		}
+		return nil
+	})
+	return r, err
+}
+
+// AddNodeBalance adds some credit amount to a node's account balance. (Can be negative)
+// If only a node is provided which doesn't have an account registered to
+// it, it should retain a balance, such as through temporary trial accounts
+// that get migrated later.
+func (s *boltStore) AddNodeBalance(nodeID store.NodeID, credit *big.Int) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		if !hasNode(tx, nodeID) {
+			return store.ErrUnregisteredNode
+		}
+		b, key, account, err := nodeBalanceKey(tx, nodeID)
+		if err != nil {
+			return err
+		}
+		var balance store.Balance
+		if err := getItem(b, key, &balance); err != nil && err != errNotFound {
+			return err
+		}
+		balance.Credit.Add(&balance.Credit, credit)
+		balance.Account = account
+		return setItem(b, key, &balance)
+	})
+}
+
+// GetAccountBalance returns an account's balance.
+func (s *boltStore) GetAccountBalance(account store.Account) (store.Balance, error) {
+	var r store.Balance
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		return getItem(tx.Bucket(bucketBalances), []byte(account), &r)
+	})
+	if err == errNotFound {
+		// Default to empty balance
+		return r, nil
+	}
+	return r, err
+}
+
+// addBalance adds credit to the account balance within a transaction.
+func addBalance(tx *bbolt.Tx, account store.Account, credit *big.Int) error {
+	b := tx.Bucket(bucketBalances)
+	var balance store.Balance
+	if err := getItem(b, []byte(account), &balance); err != nil && err != errNotFound {
+		return err
+	}
+	balance.Credit.Add(&balance.Credit, credit)
+	balance.Account = account
+	return setItem(b, []byte(account), &balance)
+}
+
+// AddAccountBalance adds credit to an account balance. (Can be negative)
+func (s *boltStore) AddAccountBalance(account store.Account, credit *big.Int) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		return addBalance(tx, account, credit)
+	})
+}
+
+// Transfer atomically moves amount of credit from one account's balance to
+// another's.
+func (s *boltStore) Transfer(from, to store.Account, amount *big.Int) error {
+	if amount.Sign() < 0 {
+		return store.ErrInvalidAmount
+	}
+	// Bolt only allows one writer at a time, so this can't race.
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		var fromBalance store.Balance
+		if err := getItem(tx.Bucket(bucketBalances), []byte(from), &fromBalance); err != nil && err != errNotFound {
+			return err
+		}
+		if fromBalance.Credit.Cmp(amount) < 0 {
+			return store.ErrInsufficientBalance
+		}
+		if err := addBalance(tx, from, new(big.Int).Neg(amount)); err != nil {
+			return err
+		}
+		return addBalance(tx, to, amount)
+	})
+}
+
+// AddAccountNode authorizes a nodeID to be a spender of an account's
+// balance. This should migrate any existing node's balance credit to the
+// account.
+func (s *boltStore) AddAccountNode(account store.Account, nodeID store.NodeID) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		if !hasNode(tx, nodeID) {
+			return store.ErrUnregisteredNode
+		}
+
+		// Migrate any trial balance
+		trials := tx.Bucket(bucketTrials)
+		var trialBalance store.Balance
+		if err := getItem(trials, []byte(nodeID), &trialBalance); err != nil && err != errNotFound {
+			return err
+		}
+		if err := trials.Delete([]byte(nodeID)); err != nil {
+			return err
+		}
+		if err := addBalance(tx, account, &trialBalance.Credit); err != nil {
+			return err
+		}
+
+		return setItem(tx.Bucket(bucketAccounts), []byte(nodeID), &account)
+	})
+}
+
+// IsAccountNode returns nil if node is a valid spender of the given
+// account.
+func (s *boltStore) IsAccountNode(account store.Account, nodeID store.NodeID) error {
+	return s.db.View(func(tx *bbolt.Tx) error {
+		var nodeAccount store.Account
+		if err := getItem(tx.Bucket(bucketAccounts), []byte(nodeID), &nodeAccount); err == errNotFound {
+			return store.ErrNotAuthorized
+		} else if err != nil {
+			return err
+		}
+		if nodeAccount != account {
+			return store.ErrNotAuthorized
+		}
+		return nil
+	})
+}
+
+// GetAccountNodes returns the authorized nodeIDs for this account, these are
+// nodes that were added to accounts through AddAccountNode.
+func (s *boltStore) GetAccountNodes(account store.Account) ([]store.NodeID, error) {
+	r := []store.NodeID{}
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		var nodeAccount store.Account
+		return forEachItem(tx.Bucket(bucketAccounts), &nodeAccount, func(key []byte) error {
+			if nodeAccount == account {
+				r = append(r, store.NodeID(key))
+			}
+			return nil
+		})
+	})
+	return r, err
+}
+
+// GetNode returns the node with the given ID.
+func (s *boltStore) GetNode(nodeID store.NodeID) (*store.Node, error) {
+	var r store.Node
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		return getNode(tx, nodeID, &r)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// SetNode saves a node.
+func (s *boltStore) SetNode(n store.Node) error {
+	if n.ID.IsZero() {
+		return store.ErrMalformedNode
+	}
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		return putNode(tx, &n)
+	})
+}
+
+// ActiveHosts returns `limit`-number of `kind` nodes. This could be an
+// empty list, if none are available.
+func (s *boltStore) ActiveHosts(kind string, limit int) ([]store.Node, error) {
+	seenSince := time.Now().Add(-store.ExpireInterval)
+	r := []store.Node{}
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		var n store.Node
+		return forEachItem(tx.Bucket(bucketHosts), &n, func(key []byte) error {
+			if kind != "" && n.Kind != kind {
+				return nil
+			}
+			if !n.LastSeen.After(seenSince) {
+				return nil
+			}
+			r = append(r, n)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// TODO: Do something other than random, such as by availability?
+	rand.Shuffle(len(r), func(i, j int) { r[i], r[j] = r[j], r[i] })
+	if limit > 0 && len(r) > limit {
+		r = r[:limit]
+	}
+	return r, nil
+}
+
+// EvictNodes removes nodes which were last seen before olderThan.
+func (s *boltStore) EvictNodes(olderThan time.Time) ([]store.NodeID, error) {
+	evicted := []store.NodeID{}
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		for _, bucket := range [][]byte{bucketHosts, bucketClients} {
+			b := tx.Bucket(bucket)
+			var stale []store.NodeID
+			var n store.Node
+			if err := forEachItem(b, &n, func(key []byte) error {
+				if n.LastSeen.Before(olderThan) {
+					stale = append(stale, n.ID)
+				}
+				return nil
+			}); err != nil {
+				return err
+			}
+			// Buckets can't be modified while iterating over them
+			for _, nodeID := range stale {
+				if err := b.Delete([]byte(nodeID)); err != nil {
+					return err
+				}
+				if err := tx.Bucket(bucketPeers).Delete([]byte(nodeID)); err != nil {
+					return err
+				}
+			}
+			evicted = append(evicted, stale...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return evicted, nil
+}
+
+// ListHosts returns a page of host nodes ordered by ID, starting after cursor.
+func (s *boltStore) ListHosts(cursor string, limit int) ([]store.Node, string, error) {
+	return s.listNodes(bucketHosts, cursor, limit)
+}
+
+// ListClients returns a page of client nodes ordered by ID, starting after cursor.
+func (s *boltStore) ListClients(cursor string, limit int) ([]store.Node, string, error) {
+	return s.listNodes(bucketClients, cursor, limit)
+}
+
+func (s *boltStore) listNodes(bucket []byte, cursor string, limit int) ([]store.Node, string, error) {
+	r := []store.Node{}
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		// Bucket keys are sorted, so we can seek to the cursor.
+		c := tx.Bucket(bucket).Cursor()
+		for k, v := c.Seek([]byte(cursor)); k != nil; k, v = c.Next() {
+			if cursor != "" && bytes.Equal(k, []byte(cursor)) {
+				continue
+			}
+			var n store.Node
+			if err := decode(v, &n); err != nil {
+				return err
+			}
+			r = append(r, n)
+			if limit > 0 && len(r) > limit {
+				// One extra to know if there's a next page
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	page, next := store.Paginate(r, limit)
+	return page, next, nil
+}
+
+// NodePeers returns a list of active connected peers that this pool knows
+// about for this NodeID.
+func (s *boltStore) NodePeers(nodeID store.NodeID) ([]store.Node, error) {
+	var r []store.Node
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		if !hasNode(tx, nodeID) {
+			return store.ErrUnregisteredNode
+		}
+		var nodePeers peers
+		if err := getItem(tx.Bucket(bucketPeers), []byte(nodeID), &nodePeers); err == errNotFound {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		r = make([]store.Node, 0, len(nodePeers))
+		for peerID := range nodePeers {
+			var peerNode store.Node
+			if err := getNode(tx, peerID, &peerNode); err == store.ErrUnregisteredNode {
+				// Skip peer nodes we no longer know about.
+				continue
+			} else if err != nil {
+				return err
+			}
+			r = append(r, peerNode)
+		}
+		return nil
+	})
+	return r, err
+}
+
+// UpdateNodePeers updates the Node.peers lookup with the current timestamp
+// of nodes we know about. This is used as a keepalive, and to keep track of
+// which client is connected to which host.
+func (s *boltStore) UpdateNodePeers(nodeID store.NodeID, peerIDs []string, blockNumber uint64) (inactive []store.NodeID, err error) {
+	now := time.Now()
+	err = s.db.Update(func(tx *bbolt.Tx) error {
+		inactive = nil
+
+		// Update this node's LastSeen
+		var node store.Node
+		if err := getNode(tx, nodeID, &node); err != nil {
+			return err
+		}
+		node.LastSeen = now
+		node.BlockNumber = blockNumber
+		if err := putNode(tx, &node); err != nil {
+			return err
+		}
+
+		// Update peers
+		b := tx.Bucket(bucketPeers)
+		nodePeers := peers{}
+		if err := getItem(b, []byte(nodeID), &nodePeers); err != nil && err != errNotFound {
+			return err
+		}
+
+		numUpdated := 0
+		for _, peerID := range peerIDs {
+			// Only update peers we already know about
+			if hasNode(tx, store.NodeID(peerID)) {
+				nodePeers[store.NodeID(peerID)] = now
+				numUpdated += 1
+			}
+		}
+
+		if numUpdated == len(nodePeers) {
+			return setItem(b, []byte(nodeID), &nodePeers)
+		}
+
+		inactiveDeadline := now.Add(-store.ExpireInterval)
+		for peerID, timestamp := range nodePeers {
+			if timestamp.Before(inactiveDeadline) {
+				continue
+			}
+			delete(nodePeers, peerID)
+			inactive = append(inactive, peerID)
+		}
+		return setItem(b, []byte(nodeID), &nodePeers)
+	})
+	return
+}
+
+// sessionKey orders sessions by their end time, followed by a sequence number
+// to keep sessions that ended at the same time distinct.
+func sessionKey(end time.Time, seq uint64) []byte {
+	key := make([]byte, 16)
+	binary.BigEndian.PutUint64(key, uint64(end.UnixNano()))
+	binary.BigEndian.PutUint64(key[8:], seq)
+	return key
+}
+
+// AddSession records a billed session.
+func (s *boltStore) AddSession(session store.Session) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(bucketSessions)
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		return setItem(b, sessionKey(session.End, seq), &session)
+	})
+}
+
+// Sessions calls fn for each session which ended within [since, until).
+func (s *boltStore) Sessions(since, until time.Time, fn func(store.Session) error) error {
+	end := sessionKey(until, 0)
+	return s.db.View(func(tx *bbolt.Tx) error {
+		c := tx.Bucket(bucketSessions).Cursor()
+		for k, v := c.Seek(sessionKey(since, 0)); k != nil && bytes.Compare(k, end) < 0; k, v = c.Next() {
+			var session store.Session
+			if err := decode(v, &session); err != nil {
+				return err
+			}
+			if err := fn(session); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Stats returns aggregate statistics about the store state.
+func (s *boltStore) Stats() (*store.Stats, error) {
+	stats := store.Stats{}
+
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		var n store.Node
+		countNode := func([]byte) error { stats.CountNode(n); return nil }
+		if err := forEachItem(tx.Bucket(bucketHosts), &n, countNode); err != nil {
+			return err
+		}
+		if err := forEachItem(tx.Bucket(bucketClients), &n, countNode); err != nil {
+			return err
+		}
+
+		var b store.Balance
+		countBalance := func([]byte) error { stats.CountBalance(b); return nil }
+		if err := forEachItem(tx.Bucket(bucketBalances), &b, countBalance); err != nil {
+			return err
+		}
+		if err := forEachItem(tx.Bucket(bucketTrials), &b, countBalance); err != nil {
+			return err
+		}
+		return nil
+	})
+
+	return &stats, err
+}
+
+// peers is the set of a node's peers and when they were last seen.
+type peers map[store.NodeID]time.Time
@@ -0,0 +1,135 @@
+package bolt
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/vipnode/vipnode/pool/store"
+	"go.etcd.io/bbolt"
+)
+
+type boltTemp struct {
+	*boltStore
+	Dir string
+}
+
+func (s boltTemp) Close() error {
+	defer os.RemoveAll(s.Dir)
+	return s.boltStore.Close()
+}
+
+// boltTesting is a wrapper that retains but clears the db on Close().
+type boltTesting struct {
+	*boltTemp
+}
+
+func (s boltTesting) Close() error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		for _, name := range allBuckets {
+			if err := tx.DeleteBucket(name); err != nil {
+				return err
+			}
+			if _, err := tx.CreateBucket(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func OpenTemp() (*boltTemp, error) {
+	dir, err := ioutil.TempDir("", "vipnodetest")
+	if err != nil {
+		return nil, err
+	}
+	s, err := Open(filepath.Join(dir, "vipnode.db"))
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	return &boltTemp{s, dir}, nil
+}
+
+func TestBoltStore(t *testing.T) {
+	s, err := OpenTemp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	store.TestSuite(t, func() store.Store {
+		return boltTesting{s}
+	})
+}
+
+func TestBoltReopen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vipnodetest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "vipnode.db")
+
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	node := store.Node{ID: "abc", IsHost: true, Kind: "geth", LastSeen: time.Now()}
+	if err := s.SetNode(node); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddAccountNode("foo", node.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddAccountBalance("foo", big.NewInt(42)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if got, err := s.GetNode(node.ID); err != nil {
+		t.Error(err)
+	} else if got.Kind != node.Kind || !got.IsHost || !got.LastSeen.Equal(node.LastSeen) {
+		t.Errorf("node was not persisted: %+v", got)
+	}
+	if err := s.IsAccountNode("foo", node.ID); err != nil {
+		t.Errorf("account node was not persisted: %s", err)
+	}
+	if b, err := s.GetNodeBalance(node.ID); err != nil {
+		t.Error(err)
+	} else if b.Credit.Cmp(big.NewInt(42)) != 0 {
+		t.Errorf("balance was not persisted: %v", b)
+	}
+}
+
+func TestBoltMigrateNewer(t *testing.T) {
+	s, err := OpenTemp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if err := s.db.Update(func(tx *bbolt.Tx) error {
+		buf := make([]byte, 8)
+		binary.BigEndian.PutUint64(buf, dbVersion+1)
+		return tx.Bucket(bucketMeta).Put(versionKey, buf)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := MigrateLatest(s.db).(MigrationError); !ok {
+		t.Errorf("expected MigrationError")
+	}
+}
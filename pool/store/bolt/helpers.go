@@ -0,0 +1,48 @@
+package bolt
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"reflect"
+
+	"go.etcd.io/bbolt"
+)
+
+// errNotFound is returned by getItem when a key is missing.
+var errNotFound = errors.New("bolt: key not found")
+
+func decode(val []byte, into interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(val)).Decode(into)
+}
+
+func getItem(b *bbolt.Bucket, key []byte, into interface{}) error {
+	val := b.Get(key)
+	if val == nil {
+		return errNotFound
+	}
+	return decode(val, into)
+}
+
+func setItem(b *bbolt.Bucket, key []byte, val interface{}) error {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(val); err != nil {
+		return err
+	}
+	return b.Put(key, buf.Bytes())
+}
+
+// forEachItem iterates over a bucket and decodes each value into `into`
+// before calling callback with the key.
+func forEachItem(b *bbolt.Bucket, into interface{}, callback func(key []byte) error) error {
+	return b.ForEach(func(k, v []byte) error {
+		// Reset `into` before decoding into it
+		p := reflect.ValueOf(into).Elem()
+		p.Set(reflect.Zero(p.Type()))
+
+		if err := decode(v, into); err != nil {
+			return err
+		}
+		return callback(k)
+	})
+}
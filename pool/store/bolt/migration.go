@@ -0,0 +1,58 @@
+package bolt
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"go.etcd.io/bbolt"
+)
+
+const dbVersion = 1
+
+var versionKey = []byte("version")
+
+// MigrateLatest creates any missing buckets and converts the database to the
+// latest version that we know of.
+func MigrateLatest(db *bbolt.DB) error {
+	return db.Update(func(tx *bbolt.Tx) error {
+		for _, name := range allBuckets {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+
+		meta := tx.Bucket(bucketMeta)
+		version := 0
+		if v := meta.Get(versionKey); v != nil {
+			version = int(binary.BigEndian.Uint64(v))
+		}
+		if version > dbVersion {
+			return MigrationError{
+				OldVersion: version,
+				NewVersion: dbVersion,
+				Path:       db.Path(),
+				Cause:      fmt.Errorf("database is newer than the supported version"),
+			}
+		}
+
+		// Version 0 -> 1 only needs the buckets above, future migrations go
+		// here.
+
+		buf := make([]byte, 8)
+		binary.BigEndian.PutUint64(buf, dbVersion)
+		return meta.Put(versionKey, buf)
+	})
+}
+
+// MigrationError is returned when the database is opened with an outdated
+// version and migation fails.
+type MigrationError struct {
+	OldVersion int
+	NewVersion int
+	Path       string
+	Cause      error
+}
+
+func (err MigrationError) Error() string {
+	return fmt.Sprintf("bolt database migration error: Failed to migrate from version %d to %d at path %q: %s", err.OldVersion, err.NewVersion, err.Path, err.Cause)
+}
@@ -13,3 +13,9 @@ var ErrMalformedNode = errors.New("malformed node")
 
 // ErrNotAuthorized is returned when a node is not an authorized spender of an account's balance.
 var ErrNotAuthorized = errors.New("node is not an authorized spender")
+
+// ErrInsufficientBalance is returned when a transfer exceeds the source account's credit.
+var ErrInsufficientBalance = errors.New("insufficient balance")
+
+// ErrInvalidAmount is returned when a transfer amount is negative.
+var ErrInvalidAmount = errors.New("invalid amount")
@@ -0,0 +1,49 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+// Flusher is implemented by stores which keep their state in memory and
+// save it on Flush, like the memory store opened with a snapshot path.
+type Flusher interface {
+	Flush() error
+}
+
+// PeriodicFlush periodically flushes a store, so that a crash only loses the
+// balance changes since the last flush.
+type PeriodicFlush struct {
+	Store Flusher
+
+	// Interval is the time between flushes. Defaults to KeepaliveInterval.
+	Interval time.Duration
+
+	// OnError is called when a flush fails. Failed flushes are retried on
+	// the next interval.
+	OnError func(err error)
+}
+
+// Run flushes on every interval until the context is cancelled, then flushes
+// once more so that nothing is lost on shutdown.
+func (f *PeriodicFlush) Run(ctx context.Context) error {
+	interval := f.Interval
+	if interval == 0 {
+		interval = KeepaliveInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			if err := f.Store.Flush(); err != nil {
+				return err
+			}
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		if err := f.Store.Flush(); err != nil && f.OnError != nil {
+			f.OnError(err)
+		}
+	}
+}
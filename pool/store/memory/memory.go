@@ -2,6 +2,7 @@ package memory
 
 import (
 	"math/big"
+	"sort"
 	"sync"
 	"time"
 
@@ -9,7 +10,8 @@ import (
 )
 
 // New implements an ephemeral in-memory store. It may not be a
-// complete implementation but it's useful for testing.
+// complete implementation but it's useful for testing. Use Open to keep its
+// state across restarts.
 func New() *memoryStore {
 	return &memoryStore{
 		balances: map[store.Account]store.Balance{},
@@ -28,6 +30,7 @@ type memNode struct {
 
 // Assert Store implementation
 var _ store.Store = &memoryStore{}
+var _ store.Flusher = &memoryStore{}
 
 type memoryStore struct {
 	mu sync.Mutex
@@ -45,6 +48,13 @@ type memoryStore struct {
 	trials map[store.NodeID]store.Balance
 
 	nonces map[string]int64
+
+	// Billed sessions, ordered by end time
+	sessions []store.Session
+
+	// snapshotPath is where the store is saved by Flush, if set by Open.
+	snapshotPath string
+	flushMu      sync.Mutex
 }
 
 // CheckAndSaveNonce asserts that this is the highest nonce seen for this NodeID.
@@ -126,6 +136,31 @@ func (s *memoryStore) AddAccountBalance(account store.Account, credit *big.Int)
 	return nil
 }
 
+// Transfer atomically moves amount of credit from one account's balance to
+// another's.
+func (s *memoryStore) Transfer(from, to store.Account, amount *big.Int) error {
+	if amount.Sign() < 0 {
+		return store.ErrInvalidAmount
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fromBalance := s.balances[from]
+	if fromBalance.Credit.Cmp(amount) < 0 {
+		return store.ErrInsufficientBalance
+	}
+	fromBalance.Credit.Sub(&fromBalance.Credit, amount)
+	fromBalance.Account = from
+	s.balances[from] = fromBalance
+
+	toBalance := s.balances[to]
+	toBalance.Credit.Add(&toBalance.Credit, amount)
+	toBalance.Account = to
+	s.balances[to] = toBalance
+	return nil
+}
+
 // AddAccountNode authorizes a nodeID to be a spender of an account's
 // balance. This should migrate any existing node's balance credit to the
 // account.
@@ -195,7 +230,9 @@ func (s *memoryStore) SetNode(n store.Node) error {
 	}
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	node := memNode{Node: n}
+	// Peers are retained if the node is already registered, like the other
+	// drivers which store them separately.
+	node := memNode{Node: n, peers: s.nodes[n.ID].peers}
 	if node.peers == nil {
 		node.peers = map[store.NodeID]time.Time{}
 	}
@@ -211,6 +248,22 @@ func (s *memoryStore) RemoveNode(nodeID store.NodeID) error {
 	return nil
 }
 
+// EvictNodes removes nodes which were last seen before olderThan.
+func (s *memoryStore) EvictNodes(olderThan time.Time) ([]store.NodeID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	evicted := []store.NodeID{}
+	for nodeID, n := range s.nodes {
+		if !n.LastSeen.Before(olderThan) {
+			continue
+		}
+		delete(s.nodes, nodeID)
+		evicted = append(evicted, nodeID)
+	}
+	return evicted, nil
+}
+
 // ActiveHosts returns `limit`-number of `kind` nodes. This could be an
 // empty list, if none are available.
 func (s *memoryStore) ActiveHosts(kind string, limit int) ([]store.Node, error) {
@@ -243,6 +296,32 @@ func (s *memoryStore) ActiveHosts(kind string, limit int) ([]store.Node, error)
 	return r, nil
 }
 
+// ListHosts returns a page of host nodes ordered by ID, starting after cursor.
+func (s *memoryStore) ListHosts(cursor string, limit int) ([]store.Node, string, error) {
+	return s.listNodes(true, cursor, limit)
+}
+
+// ListClients returns a page of client nodes ordered by ID, starting after cursor.
+func (s *memoryStore) ListClients(cursor string, limit int) ([]store.Node, string, error) {
+	return s.listNodes(false, cursor, limit)
+}
+
+func (s *memoryStore) listNodes(isHost bool, cursor string, limit int) ([]store.Node, string, error) {
+	s.mu.Lock()
+	r := []store.Node{}
+	for id, n := range s.nodes {
+		if n.IsHost != isHost || string(id) <= cursor {
+			continue
+		}
+		r = append(r, n.Node)
+	}
+	s.mu.Unlock()
+
+	sort.Slice(r, func(i, j int) bool { return r[i].ID < r[j].ID })
+	page, next := store.Paginate(r, limit)
+	return page, next, nil
+}
+
 // NodePeers returns a list of active connected peers that this pool knows
 // about for this NodeID.
 func (s *memoryStore) NodePeers(nodeID store.NodeID) ([]store.Node, error) {
@@ -307,6 +386,40 @@ func (s *memoryStore) UpdateNodePeers(nodeID store.NodeID, peers []string, block
 	return inactive, nil
 }
 
+// AddSession records a billed session.
+func (s *memoryStore) AddSession(session store.Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := sort.Search(len(s.sessions), func(i int) bool {
+		return s.sessions[i].End.After(session.End)
+	})
+	s.sessions = append(s.sessions, store.Session{})
+	copy(s.sessions[i+1:], s.sessions[i:])
+	s.sessions[i] = session
+	return nil
+}
+
+// Sessions calls fn for each session which ended within [since, until).
+func (s *memoryStore) Sessions(since, until time.Time, fn func(store.Session) error) error {
+	s.mu.Lock()
+	i := sort.Search(len(s.sessions), func(i int) bool {
+		return !s.sessions[i].End.Before(since)
+	})
+	matched := []store.Session{}
+	for ; i < len(s.sessions) && s.sessions[i].End.Before(until); i++ {
+		matched = append(matched, s.sessions[i])
+	}
+	s.mu.Unlock()
+
+	for _, session := range matched {
+		if err := fn(session); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // Stats returns aggregate statistics about the store state.
 func (s *memoryStore) Stats() (*store.Stats, error) {
 	stats := store.Stats{}
@@ -327,5 +440,5 @@ func (s *memoryStore) Stats() (*store.Stats, error) {
 }
 
 func (s *memoryStore) Close() error {
-	return nil
+	return s.Flush()
 }
@@ -1,7 +1,9 @@
 package memory
 
 import (
+	"context"
 	"testing"
+	"time"
 
 	"github.com/vipnode/vipnode/pool/store"
 )
@@ -13,3 +15,45 @@ func TestMemoryStore(t *testing.T) {
 		})
 	})
 }
+
+func TestSweeper(t *testing.T) {
+	s := New()
+	defer s.Close()
+
+	if err := s.SetNode(store.Node{ID: "a", LastSeen: time.Now().Add(-time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetNode(store.Node{ID: "b", LastSeen: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+
+	evictions := make(chan []store.NodeID, 1)
+	sweeper := store.Sweeper{
+		Store:    s,
+		TTL:      time.Minute,
+		Interval: time.Millisecond,
+		OnEvict: func(evicted []store.NodeID) {
+			evictions <- evicted
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- sweeper.Run(ctx) }()
+
+	select {
+	case evicted := <-evictions:
+		if len(evicted) != 1 || evicted[0] != "a" {
+			t.Errorf("unexpected eviction: %v", evicted)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for sweep")
+	}
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if _, err := s.GetNode("b"); err != nil {
+		t.Errorf("fresh node was evicted: %s", err)
+	}
+}
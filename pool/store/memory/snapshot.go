@@ -0,0 +1,155 @@
+package memory
+
+import (
+	"bytes"
+	"encoding/gob"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/vipnode/vipnode/pool/store"
+)
+
+// snapshot is the state of a memory store as it's saved to disk.
+// Balances are listed rather than mapped, since gob can only encode their
+// big.Int fields when they're addressable.
+type snapshot struct {
+	Balances []snapshotBalance
+	Nodes    []snapshotNode
+	Accounts map[store.NodeID]store.Account
+	Trials   []snapshotTrial
+	Nonces   map[string]int64
+	Sessions []store.Session
+}
+
+type snapshotBalance struct {
+	Account store.Account
+	Balance store.Balance
+}
+
+type snapshotTrial struct {
+	NodeID  store.NodeID
+	Balance store.Balance
+}
+
+type snapshotNode struct {
+	Node  store.Node
+	Peers map[store.NodeID]time.Time
+}
+
+// Open returns a memory store which is snapshotted to path when it's flushed
+// or closed, restoring the previous snapshot if there is one. Without a
+// snapshot, balances accumulated since the pool started are lost if it stops.
+func Open(path string) (*memoryStore, error) {
+	s := New()
+	s.snapshotPath = path
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if err := s.Restore(f); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Snapshot writes the state of the store to w, for loading with Restore.
+func (s *memoryStore) Snapshot(w io.Writer) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	snap := snapshot{
+		Balances: make([]snapshotBalance, 0, len(s.balances)),
+		Nodes:    make([]snapshotNode, 0, len(s.nodes)),
+		Accounts: s.accounts,
+		Trials:   make([]snapshotTrial, 0, len(s.trials)),
+		Nonces:   s.nonces,
+		Sessions: s.sessions,
+	}
+	for account, balance := range s.balances {
+		snap.Balances = append(snap.Balances, snapshotBalance{account, balance})
+	}
+	for nodeID, balance := range s.trials {
+		snap.Trials = append(snap.Trials, snapshotTrial{nodeID, balance})
+	}
+	for _, n := range s.nodes {
+		snap.Nodes = append(snap.Nodes, snapshotNode{n.Node, n.peers})
+	}
+	return gob.NewEncoder(w).Encode(&snap)
+}
+
+// Restore replaces the state of the store with a snapshot read from r.
+func (s *memoryStore) Restore(r io.Reader) error {
+	var snap snapshot
+	if err := gob.NewDecoder(r).Decode(&snap); err != nil {
+		return err
+	}
+	restored := New()
+	for _, b := range snap.Balances {
+		restored.balances[b.Account] = b.Balance
+	}
+	for _, n := range snap.Nodes {
+		// Gob decodes empty maps as nil.
+		if n.Peers == nil {
+			n.Peers = map[store.NodeID]time.Time{}
+		}
+		restored.nodes[n.Node.ID] = memNode{Node: n.Node, peers: n.Peers}
+	}
+	for nodeID, account := range snap.Accounts {
+		restored.accounts[nodeID] = account
+	}
+	for _, b := range snap.Trials {
+		restored.trials[b.NodeID] = b.Balance
+	}
+	for id, nonce := range snap.Nonces {
+		restored.nonces[id] = nonce
+	}
+	restored.sessions = snap.Sessions
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.balances = restored.balances
+	s.nodes = restored.nodes
+	s.accounts = restored.accounts
+	s.trials = restored.trials
+	s.nonces = restored.nonces
+	s.sessions = restored.sessions
+	return nil
+}
+
+// Flush saves a snapshot of the store to its path, if it was opened with
+// one. The previous snapshot is replaced atomically, so that a crash while
+// flushing leaves it intact.
+func (s *memoryStore) Flush() error {
+	if s.snapshotPath == "" {
+		return nil
+	}
+	s.flushMu.Lock()
+	defer s.flushMu.Unlock()
+
+	var buf bytes.Buffer
+	if err := s.Snapshot(&buf); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(s.snapshotPath), filepath.Base(s.snapshotPath)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), s.snapshotPath)
+}
@@ -0,0 +1,160 @@
+package memory
+
+import (
+	"context"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/vipnode/vipnode/pool/store"
+)
+
+const (
+	hostID   = store.NodeID("f21b0ecf18c2e0a8e8e8bf0ae5e5a7cf1ffb1b8adab3cb44b9df1b34dd1b1c1b6f1bce1d7ad36f28f4d0fb9a4fdd6a5cb6c2b1ad1b4b8c3e1a5cf9bdd2a7b8f9e")
+	clientID = store.NodeID("a1b0ecf18c2e0a8e8e8bf0ae5e5a7cf1ffb1b8adab3cb44b9df1b34dd1b1c1b6f1bce1d7ad36f28f4d0fb9a4fdd6a5cb6c2b1ad1b4b8c3e1a5cf9bdd2a7b8f9e")
+)
+
+func tempSnapshot(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "vipnode-memory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filepath.Join(dir, "snapshot"), func() { os.RemoveAll(dir) }
+}
+
+func TestSnapshotRestart(t *testing.T) {
+	path, cleanup := tempSnapshot(t)
+	defer cleanup()
+
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	if err := s.SetNode(store.Node{ID: hostID, IsHost: true, LastSeen: now, Capabilities: map[string]string{"archive": "true"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetNode(store.Node{ID: clientID, LastSeen: now}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.UpdateNodePeers(hostID, []string{string(clientID)}, 42); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddNodeBalance(clientID, big.NewInt(-500)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddAccountNode("0xabc", hostID); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddAccountBalance("0xabc", big.NewInt(1000)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CheckAndSaveNonce(string(clientID), now.UnixNano()); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddSession(store.Session{ClientID: clientID, HostID: hostID, Start: now.Add(-time.Minute), End: now}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Restart
+	s, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if node, err := s.GetNode(hostID); err != nil {
+		t.Fatal(err)
+	} else if !node.IsHost || node.Capabilities["archive"] != "true" {
+		t.Errorf("host was not restored: %v", node)
+	}
+	if peers, err := s.NodePeers(hostID); err != nil {
+		t.Fatal(err)
+	} else if len(peers) != 1 || peers[0].ID != clientID {
+		t.Errorf("peers were not restored: %v", peers)
+	}
+	if b, err := s.GetNodeBalance(clientID); err != nil {
+		t.Fatal(err)
+	} else if b.Credit.Int64() != -500 {
+		t.Errorf("trial balance was not restored: %s", &b.Credit)
+	}
+	if b, err := s.GetNodeBalance(hostID); err != nil {
+		t.Fatal(err)
+	} else if b.Credit.Int64() != 1000 || b.Account != "0xabc" {
+		t.Errorf("account balance was not restored: %v", b)
+	}
+	if err := s.CheckAndSaveNonce(string(clientID), now.UnixNano()); err != store.ErrInvalidNonce {
+		t.Errorf("nonce was not restored, got: %v", err)
+	}
+	var sessions []store.Session
+	s.Sessions(now.Add(-time.Hour), now.Add(time.Hour), func(session store.Session) error {
+		sessions = append(sessions, session)
+		return nil
+	})
+	if len(sessions) != 1 || sessions[0].ClientID != clientID {
+		t.Errorf("sessions were not restored: %v", sessions)
+	}
+
+	// Restored nodes can still be updated.
+	if _, err := s.UpdateNodePeers(clientID, []string{string(hostID)}, 42); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPeriodicFlush(t *testing.T) {
+	path, cleanup := tempSnapshot(t)
+	defer cleanup()
+
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetNode(store.Node{ID: clientID, LastSeen: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddNodeBalance(clientID, big.NewInt(-100)); err != nil {
+		t.Fatal(err)
+	}
+
+	flusher := store.PeriodicFlush{Store: s, Interval: time.Hour}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- flusher.Run(ctx) }()
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// Changes after the flush are lost without closing the store, like in a
+	// crash.
+	if err := s.AddNodeBalance(clientID, big.NewInt(-100)); err != nil {
+		t.Fatal(err)
+	}
+	restarted, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, err := restarted.GetNodeBalance(clientID); err != nil {
+		t.Fatal(err)
+	} else if b.Credit.Int64() != -100 {
+		t.Errorf("got credit %s after restart; want -100", &b.Credit)
+	}
+}
+
+func TestOpenCorrupt(t *testing.T) {
+	path, cleanup := tempSnapshot(t)
+	defer cleanup()
+
+	if err := ioutil.WriteFile(path, []byte("not a snapshot"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(path); err == nil {
+		t.Error("expected error opening a corrupt snapshot")
+	}
+}
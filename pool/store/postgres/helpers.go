@@ -0,0 +1,42 @@
+package postgres
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math/big"
+)
+
+// numeric adapts a big.Int for reading and writing NUMERIC columns, which the
+// driver passes around as decimal strings.
+type numeric big.Int
+
+// Value implements driver.Valuer.
+func (n *numeric) Value() (driver.Value, error) {
+	if n == nil {
+		return "0", nil
+	}
+	return (*big.Int)(n).String(), nil
+}
+
+// Scan implements sql.Scanner.
+func (n *numeric) Scan(src interface{}) error {
+	var s string
+	switch v := src.(type) {
+	case nil:
+		(*big.Int)(n).SetInt64(0)
+		return nil
+	case int64:
+		(*big.Int)(n).SetInt64(v)
+		return nil
+	case []byte:
+		s = string(v)
+	case string:
+		s = v
+	default:
+		return fmt.Errorf("postgres: cannot scan %T into numeric", src)
+	}
+	if _, ok := (*big.Int)(n).SetString(s, 10); !ok {
+		return fmt.Errorf("postgres: invalid integer numeric value: %q", s)
+	}
+	return nil
+}
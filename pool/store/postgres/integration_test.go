@@ -0,0 +1,89 @@
+//go:build postgres
+// +build postgres
+
+package postgres
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/vipnode/vipnode/pool/store"
+)
+
+// postgresTesting is a wrapper that retains but clears the db on Close().
+type postgresTesting struct {
+	*postgresStore
+}
+
+func (s postgresTesting) Close() error {
+	_, err := s.db.Exec(`TRUNCATE vip_nodes, vip_peers, vip_node_accounts, vip_balances, vip_trials, vip_nonces, vip_sessions`)
+	return err
+}
+
+// Run with: VIPNODE_TEST_POSTGRES="postgres://localhost/vipnode_test?sslmode=disable" go test -tags postgres
+func TestPostgresStore(t *testing.T) {
+	dsn := os.Getenv("VIPNODE_TEST_POSTGRES")
+	if dsn == "" {
+		t.Skip("VIPNODE_TEST_POSTGRES is not set")
+	}
+
+	s, err := Open(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	store.TestSuite(t, func() store.Store {
+		return postgresTesting{s}
+	})
+}
+
+func TestPostgresNodePeers(t *testing.T) {
+	dsn := os.Getenv("VIPNODE_TEST_POSTGRES")
+	if dsn == "" {
+		t.Skip("VIPNODE_TEST_POSTGRES is not set")
+	}
+
+	s, err := Open(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	defer postgresTesting{s}.Close()
+
+	host := store.Node{
+		ID:             "host",
+		URI:            "enode://host@10.0.0.1:30303",
+		LastSeen:       time.Now().Truncate(time.Second),
+		Kind:           "geth",
+		IsHost:         true,
+		Network:        1,
+		VipnodeVersion: "v2.3.0",
+		ClockSkew:      time.Second,
+		Capabilities:   map[string]string{"archive": "1"},
+		InternalURI:    "enode://host@192.168.1.2:30303",
+	}
+	client := store.Node{ID: "client", Kind: "geth", LastSeen: time.Now()}
+	for _, n := range []store.Node{host, client} {
+		if err := s.SetNode(n); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := s.UpdateNodePeers(client.ID, []string{string(host.ID)}, 0); err != nil {
+		t.Fatal(err)
+	}
+	peers, err := s.NodePeers(client.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(peers) != 1 {
+		t.Fatalf("expected 1 peer, got: %+v", peers)
+	}
+	got := peers[0]
+	got.LastSeen = host.LastSeen
+	if !reflect.DeepEqual(got, host) {
+		t.Errorf("got peer: %+v; want: %+v", got, host)
+	}
+}
@@ -0,0 +1,142 @@
+package postgres
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// migrationLockID is the advisory lock key held while migrating, so that
+// multiple pool instances starting at the same time don't race each other.
+const migrationLockID = 0x76697070 // "vipp"
+
+// MigrateLatest converts the database to the latest version that we know of.
+func MigrateLatest(db *sql.DB) error {
+	m := Migration{
+		Steps:         migrations[:],
+		LatestVersion: dbVersion,
+	}
+	return m.Migrate(db)
+}
+
+// MigrationStep is called within an update transaction with the current version.
+// It should update the database state to the next version. The migration step
+// should update the database version with each step.
+type MigrationStep func(tx *sql.Tx) error
+
+// Migration handles transforming the database state to the newest version.
+type Migration struct {
+	// StartVersion is the minimum version that is supported by the migration.
+	StartVersion int
+	// LatestVersion is the final version that we should expect after running migrations.
+	LatestVersion int
+	// Steps are the migration steps for transforming the database state across versions when run in sequence.
+	Steps []MigrationStep
+}
+
+func (m *Migration) error(cause error, version int) MigrationError {
+	return MigrationError{
+		OldVersion: version,
+		NewVersion: m.LatestVersion,
+		Cause:      cause,
+	}
+}
+
+// Migrate performs the migration sequence.
+func (m *Migration) Migrate(db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock($1)`, migrationLockID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`CREATE TABLE IF NOT EXISTS vip_version (version INTEGER NOT NULL)`); err != nil {
+		return err
+	}
+
+	oldVersion, err := getVersion(tx)
+	if err != nil {
+		return m.error(err, oldVersion)
+	}
+
+	if oldVersion == m.LatestVersion {
+		// No need to migrate
+		return nil
+	}
+
+	if m.LatestVersion < oldVersion {
+		return m.error(errors.New("database is newer than the supported version"), oldVersion)
+	}
+
+	if m.StartVersion > oldVersion {
+		return m.error(errors.New("database version too old, migration is not supported"), oldVersion)
+	}
+
+	// Migration from oldVersion to m.LatestVersion
+	for v := oldVersion; v < m.LatestVersion; {
+		err := m.Steps[v-m.StartVersion](tx)
+		if err != nil {
+			return m.error(err, v)
+		}
+		nextVersion, err := getVersion(tx)
+		if err != nil {
+			return m.error(err, v)
+		}
+		if nextVersion <= v {
+			err = errors.New("migration failed to increment version")
+			return m.error(err, v)
+		}
+		v = nextVersion
+	}
+
+	return tx.Commit()
+}
+
+func checkVersion(tx *sql.Tx, assertVersion int) error {
+	version, err := getVersion(tx)
+	if err != nil {
+		return err
+	}
+	if version != assertVersion {
+		return errors.New("wrong version for migration")
+	}
+	return nil
+}
+
+func getVersion(tx *sql.Tx) (int, error) {
+	var version int
+	err := tx.QueryRow(`SELECT version FROM vip_version`).Scan(&version)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return version, err
+}
+
+func setVersion(tx *sql.Tx, version int) error {
+	res, err := tx.Exec(`UPDATE vip_version SET version = $1`, version)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n > 0 {
+		return nil
+	}
+	_, err = tx.Exec(`INSERT INTO vip_version (version) VALUES ($1)`, version)
+	return err
+}
+
+// MigrationError is returned when the database is opened with an outdated
+// version and migation fails.
+type MigrationError struct {
+	OldVersion int
+	NewVersion int
+	Cause      error
+}
+
+func (err MigrationError) Error() string {
+	return fmt.Sprintf("postgres database migration error: Failed to migrate from version %d to %d: %s", err.OldVersion, err.NewVersion, err.Cause)
+}
@@ -0,0 +1,592 @@
+package postgres
+
+import (
+	"database/sql"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/vipnode/vipnode/pool/store"
+)
+
+// Open returns a store.Store implementation using PostgreSQL as the storage
+// driver. The dsn is passed to github.com/lib/pq, so it can be a
+// postgres://... URL or a key=value connection string. The store should be
+// (*postgresStore).Close()'d after use.
+//
+// Multiple pool instances can share the same database: all multi-step
+// mutations run within a transaction and lock the rows they depend on.
+func Open(dsn string) (*postgresStore, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return open(db)
+}
+
+func open(db *sql.DB) (*postgresStore, error) {
+	if err := MigrateLatest(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	s := &postgresStore{
+		db:          db,
+		nonceExpire: store.ExpireNonce,
+	}
+	return s, nil
+}
+
+var _ store.Store = &postgresStore{}
+
+type postgresStore struct {
+	db *sql.DB
+
+	nonceExpire time.Duration
+}
+
+func (s *postgresStore) Close() error {
+	return s.db.Close()
+}
+
+// withTx runs fn within a transaction, which is committed if fn succeeds and
+// rolled back otherwise.
+func (s *postgresStore) withTx(fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *postgresStore) CheckAndSaveNonce(ID string, nonce int64) error {
+	// If nonceExpire is set, nonce should be within nonceExpire of now.
+	if s.nonceExpire > 0 {
+		if nonce <= time.Now().Add(-s.nonceExpire).UnixNano() {
+			// Nonce is too old
+			return store.ErrInvalidNonce
+		}
+	}
+	// The conditional upsert is atomic, so concurrent pool instances can't
+	// both accept the same nonce.
+	res, err := s.db.Exec(`
+		INSERT INTO vip_nonces (id, nonce) VALUES ($1, $2)
+		ON CONFLICT (id) DO UPDATE SET nonce = EXCLUDED.nonce
+		WHERE vip_nonces.nonce < EXCLUDED.nonce`, ID, nonce)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return store.ErrInvalidNonce
+	}
+	return nil
+}
+
+// lockNodeAccount locks the node row for the remainder of the transaction and
+// returns the account it's associated with, if any.
+func lockNodeAccount(tx *sql.Tx, nodeID store.NodeID) (account sql.NullString, err error) {
+	err = tx.QueryRow(`
+		SELECT a.account FROM vip_nodes n
+		LEFT JOIN vip_node_accounts a ON a.node_id = n.id
+		WHERE n.id = $1
+		FOR UPDATE OF n`, nodeID).Scan(&account)
+	if err == sql.ErrNoRows {
+		return account, store.ErrUnregisteredNode
+	}
+	return account, err
+}
+
+// GetNodeBalance returns the current account balance for a node.
+func (s *postgresStore) GetNodeBalance(nodeID store.NodeID) (store.Balance, error) {
+	var r store.Balance
+	var account sql.NullString
+	err := s.db.QueryRow(`
+		SELECT a.account, COALESCE(b.credit, t.credit, 0), COALESCE(b.deposit, t.deposit, 0)
+		FROM vip_nodes n
+		LEFT JOIN vip_node_accounts a ON a.node_id = n.id
+		LEFT JOIN vip_balances b ON b.account = a.account
+		LEFT JOIN vip_trials t ON t.node_id = n.id AND a.account IS NULL
+		WHERE n.id = $1`, nodeID).Scan(&account, (*numeric)(&r.Credit), (*numeric)(&r.Deposit))
+	if err == sql.ErrNoRows {
+		return r, store.ErrUnregisteredNode
+	} else if err != nil {
+		return r, err
+	}
+	if account.Valid {
+		r.Account = store.Account(account.String)
+	}
+	return r, nil
+}
+
+// AddNodeBalance adds some credit amount to a node's account balance. (Can be negative)
+// If only a node is provided which doesn't have an account registered to
+// it, it should retain a balance, such as through temporary trial accounts
+// that get migrated later.
+func (s *postgresStore) AddNodeBalance(nodeID store.NodeID, credit *big.Int) error {
+	return s.withTx(func(tx *sql.Tx) error {
+		// Locking the node prevents a concurrent AddAccountNode from
+		// migrating the trial balance out from under us.
+		account, err := lockNodeAccount(tx, nodeID)
+		if err != nil {
+			return err
+		}
+		if account.Valid {
+			return addBalance(tx, store.Account(account.String), credit)
+		}
+		_, err = tx.Exec(`
+			INSERT INTO vip_trials (node_id, credit) VALUES ($1, $2)
+			ON CONFLICT (node_id) DO UPDATE SET credit = vip_trials.credit + EXCLUDED.credit`,
+			nodeID, (*numeric)(credit))
+		return err
+	})
+}
+
+// addBalance adds credit to an account balance, creating it if necessary.
+func addBalance(tx *sql.Tx, account store.Account, credit *big.Int) error {
+	_, err := tx.Exec(`
+		INSERT INTO vip_balances (account, credit) VALUES ($1, $2)
+		ON CONFLICT (account) DO UPDATE SET credit = vip_balances.credit + EXCLUDED.credit`,
+		account, (*numeric)(credit))
+	return err
+}
+
+// GetAccountBalance returns an account's balance.
+func (s *postgresStore) GetAccountBalance(account store.Account) (store.Balance, error) {
+	var r store.Balance
+	err := s.db.QueryRow(`SELECT credit, deposit FROM vip_balances WHERE account = $1`, account).Scan((*numeric)(&r.Credit), (*numeric)(&r.Deposit))
+	if err == sql.ErrNoRows {
+		// Default to empty balance
+		return r, nil
+	} else if err != nil {
+		return r, err
+	}
+	r.Account = account
+	return r, nil
+}
+
+// AddAccountBalance adds credit to an account balance. (Can be negative)
+func (s *postgresStore) AddAccountBalance(account store.Account, credit *big.Int) error {
+	return s.withTx(func(tx *sql.Tx) error {
+		return addBalance(tx, account, credit)
+	})
+}
+
+// Transfer atomically moves amount of credit from one account's balance to
+// another's.
+func (s *postgresStore) Transfer(from, to store.Account, amount *big.Int) error {
+	if amount.Sign() < 0 {
+		return store.ErrInvalidAmount
+	}
+	return s.withTx(func(tx *sql.Tx) error {
+		// Lock both balances in a consistent order, so that opposing
+		// concurrent transfers can't deadlock.
+		if _, err := tx.Exec(`SELECT account FROM vip_balances WHERE account IN ($1, $2) ORDER BY account FOR UPDATE`, from, to); err != nil {
+			return err
+		}
+		res, err := tx.Exec(`UPDATE vip_balances SET credit = credit - $2 WHERE account = $1 AND credit >= $2`, from, (*numeric)(amount))
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 && amount.Sign() > 0 {
+			return store.ErrInsufficientBalance
+		}
+		return addBalance(tx, to, amount)
+	})
+}
+
+// AddAccountNode authorizes a nodeID to be a spender of an account's
+// balance. This should migrate any existing node's balance credit to the
+// account.
+func (s *postgresStore) AddAccountNode(account store.Account, nodeID store.NodeID) error {
+	return s.withTx(func(tx *sql.Tx) error {
+		if _, err := lockNodeAccount(tx, nodeID); err != nil {
+			return err
+		}
+
+		// Load trial balance to migrate
+		var trialCredit big.Int
+		err := tx.QueryRow(`DELETE FROM vip_trials WHERE node_id = $1 RETURNING credit`, nodeID).Scan((*numeric)(&trialCredit))
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+
+		// Authorize node
+		if _, err := tx.Exec(`
+			INSERT INTO vip_node_accounts (node_id, account) VALUES ($1, $2)
+			ON CONFLICT (node_id) DO UPDATE SET account = EXCLUDED.account`,
+			nodeID, account); err != nil {
+			return err
+		}
+
+		// Merge trial
+		return addBalance(tx, account, &trialCredit)
+	})
+}
+
+// IsAccountNode returns nil if node is a valid spender of the given
+// account.
+func (s *postgresStore) IsAccountNode(account store.Account, nodeID store.NodeID) error {
+	var nodeAccount store.Account
+	err := s.db.QueryRow(`SELECT account FROM vip_node_accounts WHERE node_id = $1`, nodeID).Scan(&nodeAccount)
+	if err == sql.ErrNoRows {
+		return store.ErrNotAuthorized
+	} else if err != nil {
+		return err
+	}
+	if nodeAccount != account {
+		return store.ErrNotAuthorized
+	}
+	return nil
+}
+
+// GetAccountNodes returns the authorized nodeIDs for this account, these are
+// nodes that were added to accounts through AddAccountNode.
+func (s *postgresStore) GetAccountNodes(account store.Account) ([]store.NodeID, error) {
+	rows, err := s.db.Query(`SELECT node_id FROM vip_node_accounts WHERE account = $1 ORDER BY node_id`, account)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	r := []store.NodeID{}
+	for rows.Next() {
+		var nodeID store.NodeID
+		if err := rows.Scan(&nodeID); err != nil {
+			return nil, err
+		}
+		r = append(r, nodeID)
+	}
+	return r, rows.Err()
+}
+
+const nodeColumns = `id, uri, last_seen, kind, is_host, payout, block_number, network, vipnode_version, clock_skew, capabilities, internal_uri, available_slots`
+
+// peerNodeColumns is nodeColumns of the vip_nodes table aliased as n, for
+// queries which join it with other tables.
+var peerNodeColumns = prefixColumns("n.", nodeColumns)
+
+// prefixColumns returns the comma-separated columns with prefix on each.
+func prefixColumns(prefix string, columns string) string {
+	names := strings.Split(columns, ", ")
+	for i, name := range names {
+		names[i] = prefix + name
+	}
+	return strings.Join(names, ", ")
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanNode(row scanner) (store.Node, error) {
+	var n store.Node
+	var clockSkew int64
+	var capabilities string
+	var slots sql.NullInt64
+	err := row.Scan(&n.ID, &n.URI, &n.LastSeen, &n.Kind, &n.IsHost, &n.Payout, &n.BlockNumber, &n.Network, &n.VipnodeVersion, &clockSkew, &capabilities, &n.InternalURI, &slots)
+	if err != nil {
+		return n, err
+	}
+	n.ClockSkew = time.Duration(clockSkew)
+	n.AvailableSlots, n.SlotsKnown = int(slots.Int64), slots.Valid
+	if capabilities != "" {
+		err = json.Unmarshal([]byte(capabilities), &n.Capabilities)
+	}
+	return n, err
+}
+
+// encodeCapabilities returns the JSON object of capabilities, or an empty
+// string if there are none.
+func encodeCapabilities(capabilities map[string]string) (string, error) {
+	if len(capabilities) == 0 {
+		return "", nil
+	}
+	data, err := json.Marshal(capabilities)
+	return string(data), err
+}
+
+func scanNodes(rows *sql.Rows) ([]store.Node, error) {
+	defer rows.Close()
+	r := []store.Node{}
+	for rows.Next() {
+		n, err := scanNode(rows)
+		if err != nil {
+			return nil, err
+		}
+		r = append(r, n)
+	}
+	return r, rows.Err()
+}
+
+// GetNode returns the node with the given ID.
+func (s *postgresStore) GetNode(nodeID store.NodeID) (*store.Node, error) {
+	n, err := scanNode(s.db.QueryRow(`SELECT `+nodeColumns+` FROM vip_nodes WHERE id = $1`, nodeID))
+	if err == sql.ErrNoRows {
+		return nil, store.ErrUnregisteredNode
+	} else if err != nil {
+		return nil, err
+	}
+	return &n, nil
+}
+
+// SetNode saves a node.
+func (s *postgresStore) SetNode(n store.Node) error {
+	if n.ID.IsZero() {
+		return store.ErrMalformedNode
+	}
+	capabilities, err := encodeCapabilities(n.Capabilities)
+	if err != nil {
+		return err
+	}
+	slots := sql.NullInt64{Int64: int64(n.AvailableSlots), Valid: n.SlotsKnown}
+	_, err = s.db.Exec(`
+		INSERT INTO vip_nodes (`+nodeColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		ON CONFLICT (id) DO UPDATE SET
+			uri = EXCLUDED.uri,
+			last_seen = EXCLUDED.last_seen,
+			kind = EXCLUDED.kind,
+			is_host = EXCLUDED.is_host,
+			payout = EXCLUDED.payout,
+			block_number = EXCLUDED.block_number,
+			network = EXCLUDED.network,
+			vipnode_version = EXCLUDED.vipnode_version,
+			clock_skew = EXCLUDED.clock_skew,
+			capabilities = EXCLUDED.capabilities,
+			internal_uri = EXCLUDED.internal_uri,
+			available_slots = EXCLUDED.available_slots`,
+		n.ID, n.URI, n.LastSeen, n.Kind, n.IsHost, n.Payout, int64(n.BlockNumber), n.Network, n.VipnodeVersion, int64(n.ClockSkew), capabilities, n.InternalURI, slots)
+	return err
+}
+
+// ActiveHosts returns `limit`-number of `kind` nodes. This could be an
+// empty list, if none are available.
+func (s *postgresStore) ActiveHosts(kind string, limit int) ([]store.Node, error) {
+	seenSince := time.Now().Add(-store.ExpireInterval)
+	// LIMIT NULL is the same as no limit.
+	queryLimit := sql.NullInt64{Int64: int64(limit), Valid: limit > 0}
+	rows, err := s.db.Query(`
+		SELECT `+nodeColumns+` FROM vip_nodes
+		WHERE is_host AND last_seen > $1 AND ($2 = '' OR kind = $2)
+		ORDER BY random()
+		LIMIT $3`, seenSince, kind, queryLimit)
+	if err != nil {
+		return nil, err
+	}
+	return scanNodes(rows)
+}
+
+// EvictNodes removes nodes which were last seen before olderThan. Their peers
+// are removed by the vip_peers foreign key cascade.
+func (s *postgresStore) EvictNodes(olderThan time.Time) ([]store.NodeID, error) {
+	rows, err := s.db.Query(`DELETE FROM vip_nodes WHERE last_seen < $1 RETURNING id`, olderThan)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	evicted := []store.NodeID{}
+	for rows.Next() {
+		var nodeID store.NodeID
+		if err := rows.Scan(&nodeID); err != nil {
+			return nil, err
+		}
+		evicted = append(evicted, nodeID)
+	}
+	return evicted, rows.Err()
+}
+
+// ListHosts returns a page of host nodes ordered by ID, starting after cursor.
+func (s *postgresStore) ListHosts(cursor string, limit int) ([]store.Node, string, error) {
+	return s.listNodes(true, cursor, limit)
+}
+
+// ListClients returns a page of client nodes ordered by ID, starting after cursor.
+func (s *postgresStore) ListClients(cursor string, limit int) ([]store.Node, string, error) {
+	return s.listNodes(false, cursor, limit)
+}
+
+func (s *postgresStore) listNodes(isHost bool, cursor string, limit int) ([]store.Node, string, error) {
+	// One extra to know if there's a next page. The "C" collation sorts
+	// bytewise, same as the other drivers.
+	queryLimit := sql.NullInt64{Int64: int64(limit) + 1, Valid: limit > 0}
+	rows, err := s.db.Query(`
+		SELECT `+nodeColumns+` FROM vip_nodes
+		WHERE is_host = $1 AND id COLLATE "C" > $2
+		ORDER BY id COLLATE "C"
+		LIMIT $3`, isHost, cursor, queryLimit)
+	if err != nil {
+		return nil, "", err
+	}
+	nodes, err := scanNodes(rows)
+	if err != nil {
+		return nil, "", err
+	}
+	page, next := store.Paginate(nodes, limit)
+	return page, next, nil
+}
+
+// NodePeers returns a list of active connected peers that this pool knows
+// about for this NodeID.
+func (s *postgresStore) NodePeers(nodeID store.NodeID) ([]store.Node, error) {
+	var r []store.Node
+	err := s.withTx(func(tx *sql.Tx) error {
+		var id store.NodeID
+		if err := tx.QueryRow(`SELECT id FROM vip_nodes WHERE id = $1`, nodeID).Scan(&id); err == sql.ErrNoRows {
+			return store.ErrUnregisteredNode
+		} else if err != nil {
+			return err
+		}
+		rows, err := tx.Query(`
+			SELECT `+peerNodeColumns+`
+			FROM vip_peers p JOIN vip_nodes n ON n.id = p.peer_id
+			WHERE p.node_id = $1`, nodeID)
+		if err != nil {
+			return err
+		}
+		r, err = scanNodes(rows)
+		return err
+	})
+	return r, err
+}
+
+// UpdateNodePeers updates the Node.peers lookup with the current timestamp
+// of nodes we know about. This is used as a keepalive, and to keep track of
+// which client is connected to which host.
+func (s *postgresStore) UpdateNodePeers(nodeID store.NodeID, peers []string, blockNumber uint64) (inactive []store.NodeID, err error) {
+	now := time.Now()
+	err = s.withTx(func(tx *sql.Tx) error {
+		// Update this node's LastSeen
+		res, err := tx.Exec(`UPDATE vip_nodes SET last_seen = $2, block_number = $3 WHERE id = $1`, nodeID, now, int64(blockNumber))
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return store.ErrUnregisteredNode
+		}
+
+		// Only update peers we already know about
+		res, err = tx.Exec(`
+			INSERT INTO vip_peers (node_id, peer_id, last_seen)
+			SELECT $1, id, $3 FROM vip_nodes WHERE id = ANY($2)
+			ON CONFLICT (node_id, peer_id) DO UPDATE SET last_seen = EXCLUDED.last_seen`,
+			nodeID, pq.Array(peers), now)
+		if err != nil {
+			return err
+		}
+		numUpdated, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		var numPeers int64
+		if err := tx.QueryRow(`SELECT count(*) FROM vip_peers WHERE node_id = $1`, nodeID).Scan(&numPeers); err != nil {
+			return err
+		}
+		if numUpdated == numPeers {
+			return nil
+		}
+
+		inactiveDeadline := now.Add(-store.ExpireInterval)
+		rows, err := tx.Query(`DELETE FROM vip_peers WHERE node_id = $1 AND last_seen >= $2 RETURNING peer_id`, nodeID, inactiveDeadline)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var peerID store.NodeID
+			if err := rows.Scan(&peerID); err != nil {
+				return err
+			}
+			inactive = append(inactive, peerID)
+		}
+		return rows.Err()
+	})
+	return
+}
+
+// AddSession records a billed session.
+func (s *postgresStore) AddSession(session store.Session) error {
+	_, err := s.db.Exec(`
+		INSERT INTO vip_sessions (client_id, host_id, start_time, end_time, amount)
+		VALUES ($1, $2, $3, $4, $5)`,
+		session.ClientID, session.HostID, session.Start, session.End, (*numeric)(&session.Amount))
+	return err
+}
+
+// Sessions calls fn for each session which ended within [since, until). Rows
+// are read from the cursor as they are iterated.
+func (s *postgresStore) Sessions(since, until time.Time, fn func(store.Session) error) error {
+	rows, err := s.db.Query(`
+		SELECT client_id, host_id, start_time, end_time, amount FROM vip_sessions
+		WHERE end_time >= $1 AND end_time < $2
+		ORDER BY end_time`, since, until)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var session store.Session
+		if err := rows.Scan(&session.ClientID, &session.HostID, &session.Start, &session.End, (*numeric)(&session.Amount)); err != nil {
+			return err
+		}
+		if err := fn(session); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// Stats returns aggregate statistics about the store state.
+func (s *postgresStore) Stats() (*store.Stats, error) {
+	stats := store.Stats{}
+
+	err := s.withTx(func(tx *sql.Tx) error {
+		rows, err := tx.Query(`SELECT ` + nodeColumns + ` FROM vip_nodes`)
+		if err != nil {
+			return err
+		}
+		nodes, err := scanNodes(rows)
+		if err != nil {
+			return err
+		}
+		for _, n := range nodes {
+			stats.CountNode(n)
+		}
+
+		// Trial balances have no account, so they're counted as such.
+		rows, err = tx.Query(`
+			SELECT account, credit, deposit FROM vip_balances
+			UNION ALL
+			SELECT '', credit, deposit FROM vip_trials`)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var b store.Balance
+			if err := rows.Scan(&b.Account, (*numeric)(&b.Credit), (*numeric)(&b.Deposit)); err != nil {
+				return err
+			}
+			stats.CountBalance(b)
+		}
+		return rows.Err()
+	})
+
+	return &stats, err
+}
@@ -0,0 +1,417 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vipnode/vipnode/pool/store"
+)
+
+// fakeResult is what the fakeBackend handler returns for a query.
+type fakeResult struct {
+	Columns  []string
+	Rows     [][]driver.Value
+	Affected int64
+	Err      error
+}
+
+// fakeBackend is a minimal database/sql driver which records queries and
+// replies using handler, so we can test the query layer without a server.
+type fakeBackend struct {
+	handler func(query string, args []driver.Value) fakeResult
+	log     []string
+}
+
+func (b *fakeBackend) record(s string) {
+	b.log = append(b.log, strings.Join(strings.Fields(s), " "))
+}
+
+func (b *fakeBackend) Connect(context.Context) (driver.Conn, error) { return &fakeConn{b}, nil }
+func (b *fakeBackend) Driver() driver.Driver                        { return nil }
+
+type fakeConn struct{ b *fakeBackend }
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) { return &fakeStmt{c.b, query}, nil }
+func (c *fakeConn) Close() error                              { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	c.b.record("BEGIN")
+	return c, nil
+}
+func (c *fakeConn) Commit() error {
+	c.b.record("COMMIT")
+	return nil
+}
+func (c *fakeConn) Rollback() error {
+	c.b.record("ROLLBACK")
+	return nil
+}
+
+type fakeStmt struct {
+	b     *fakeBackend
+	query string
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.b.record(s.query)
+	r := s.b.handler(s.query, args)
+	return driver.RowsAffected(r.Affected), r.Err
+}
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.b.record(s.query)
+	r := s.b.handler(s.query, args)
+	if r.Err != nil {
+		return nil, r.Err
+	}
+	return &fakeRows{r: r}, nil
+}
+
+type fakeRows struct {
+	r   fakeResult
+	pos int
+}
+
+func (r *fakeRows) Columns() []string { return r.r.Columns }
+func (r *fakeRows) Close() error      { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.pos >= len(r.r.Rows) {
+		return io.EOF
+	}
+	copy(dest, r.r.Rows[r.pos])
+	r.pos++
+	return nil
+}
+
+func openFake(handler func(query string, args []driver.Value) fakeResult) (*postgresStore, *fakeBackend) {
+	b := &fakeBackend{handler: handler}
+	db := sql.OpenDB(b)
+	db.SetMaxOpenConns(1)
+	return &postgresStore{db: db, nonceExpire: store.ExpireNonce}, b
+}
+
+// indexPrefix returns the index of the first entry in log which starts with
+// prefix, or -1.
+func indexPrefix(log []string, prefix string) int {
+	for i, s := range log {
+		if strings.HasPrefix(s, prefix) {
+			return i
+		}
+	}
+	return -1
+}
+
+func TestMigrate(t *testing.T) {
+	version := 0
+	s, b := openFake(func(query string, args []driver.Value) fakeResult {
+		switch {
+		case strings.HasPrefix(query, "SELECT version FROM vip_version"):
+			if version == 0 {
+				return fakeResult{Columns: []string{"version"}}
+			}
+			return fakeResult{Columns: []string{"version"}, Rows: [][]driver.Value{{int64(version)}}}
+		case strings.HasPrefix(query, "UPDATE vip_version"):
+			if version == 0 {
+				return fakeResult{}
+			}
+			version = int(args[0].(int64))
+			return fakeResult{Affected: 1}
+		case strings.HasPrefix(query, "INSERT INTO vip_version"):
+			version = int(args[0].(int64))
+			return fakeResult{Affected: 1}
+		}
+		return fakeResult{}
+	})
+	defer s.Close()
+
+	if err := MigrateLatest(s.db); err != nil {
+		t.Fatal(err)
+	}
+	if version != dbVersion {
+		t.Errorf("wrong version after migration: %d", version)
+	}
+
+	log := b.log
+	if log[0] != "BEGIN" || log[len(log)-1] != "COMMIT" {
+		t.Errorf("migration did not run within a transaction: %q", log)
+	}
+	if i := indexPrefix(log, "SELECT pg_advisory_xact_lock"); i != 1 {
+		t.Errorf("migration lock was not acquired first: %q", log)
+	}
+	if i := indexPrefix(log, "CREATE TABLE vip_nodes"); i < 0 {
+		t.Errorf("schema was not created: %q", log)
+	}
+	if i := indexPrefix(log, "CREATE INDEX vip_nodes_last_seen"); i < 0 {
+		t.Errorf("version 2 schema was not applied: %q", log)
+	}
+	if i := indexPrefix(log, "ALTER TABLE vip_nodes ADD COLUMN network"); i < 0 {
+		t.Errorf("version 3 schema was not applied: %q", log)
+	}
+	if i := indexPrefix(log, "ALTER TABLE vip_nodes ADD COLUMN vipnode_version"); i < 0 {
+		t.Errorf("version 4 schema was not applied: %q", log)
+	}
+	if i := indexPrefix(log, "CREATE TABLE vip_sessions"); i < 0 {
+		t.Errorf("version 5 schema was not applied: %q", log)
+	}
+	if i := indexPrefix(log, "ALTER TABLE vip_nodes ADD COLUMN clock_skew"); i < 0 {
+		t.Errorf("version 6 schema was not applied: %q", log)
+	}
+	if i := indexPrefix(log, "ALTER TABLE vip_nodes ADD COLUMN capabilities"); i < 0 {
+		t.Errorf("version 7 schema was not applied: %q", log)
+	}
+	if i := indexPrefix(log, "ALTER TABLE vip_nodes ADD COLUMN internal_uri"); i < 0 {
+		t.Errorf("version 8 schema was not applied: %q", log)
+	}
+	if i := indexPrefix(log, "ALTER TABLE vip_nodes ADD COLUMN available_slots"); i < 0 {
+		t.Errorf("version 9 schema was not applied: %q", log)
+	}
+
+	// Already migrated, should be a noop.
+	b.log = nil
+	if err := MigrateLatest(s.db); err != nil {
+		t.Fatal(err)
+	}
+	if i := indexPrefix(b.log, "CREATE TABLE vip_nodes"); i >= 0 {
+		t.Errorf("schema was created twice: %q", b.log)
+	}
+
+	// Newer database than we support
+	version = dbVersion + 1
+	err := MigrateLatest(s.db)
+	if _, ok := err.(MigrationError); !ok {
+		t.Errorf("expected MigrationError, got: %v", err)
+	}
+}
+
+func TestNonce(t *testing.T) {
+	var affected int64
+	s, _ := openFake(func(query string, args []driver.Value) fakeResult {
+		return fakeResult{Affected: affected}
+	})
+	defer s.Close()
+
+	nonce := time.Now().UnixNano()
+
+	affected = 1
+	if err := s.CheckAndSaveNonce("foo", nonce); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	affected = 0
+	if err := s.CheckAndSaveNonce("foo", nonce); err != store.ErrInvalidNonce {
+		t.Errorf("expected ErrInvalidNonce, got: %v", err)
+	}
+	affected = 1
+	if err := s.CheckAndSaveNonce("foo", 42); err != store.ErrInvalidNonce {
+		t.Errorf("expected expired nonce to fail, got: %v", err)
+	}
+}
+
+func TestUnregisteredNode(t *testing.T) {
+	s, b := openFake(func(query string, args []driver.Value) fakeResult {
+		return fakeResult{Columns: []string{"id"}}
+	})
+	defer s.Close()
+
+	if _, err := s.GetNode("foo"); err != store.ErrUnregisteredNode {
+		t.Errorf("expected ErrUnregisteredNode, got: %v", err)
+	}
+	if _, err := s.GetNodeBalance("foo"); err != store.ErrUnregisteredNode {
+		t.Errorf("expected ErrUnregisteredNode, got: %v", err)
+	}
+	b.log = nil
+	if err := s.AddNodeBalance("foo", big.NewInt(1)); err != store.ErrUnregisteredNode {
+		t.Errorf("expected ErrUnregisteredNode, got: %v", err)
+	}
+	if got := b.log[len(b.log)-1]; got != "ROLLBACK" {
+		t.Errorf("expected failed transaction to be rolled back: %q", b.log)
+	}
+}
+
+func TestNodePeers(t *testing.T) {
+	columns := strings.Split(nodeColumns, ", ")
+	seen := time.Now().Truncate(time.Second)
+	var peersQuery string
+	s, _ := openFake(func(query string, args []driver.Value) fakeResult {
+		if strings.HasPrefix(strings.TrimSpace(query), "SELECT id FROM vip_nodes") {
+			return fakeResult{Columns: []string{"id"}, Rows: [][]driver.Value{{"a"}}}
+		}
+		peersQuery = query
+		return fakeResult{Columns: columns, Rows: [][]driver.Value{
+			{"b", "enode://b@10.0.0.1:30303", seen, "geth", true, "", int64(42), int64(1), "v2.3.0", int64(time.Second), `{"archive":"1"}`, "enode://b@192.168.1.2:30303", int64(5)},
+		}}
+	})
+	defer s.Close()
+
+	peers, err := s.NodePeers("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The SELECT must list every column that scanNode reads.
+	for _, column := range columns {
+		if !strings.Contains(peersQuery, "n."+column) {
+			t.Errorf("peers query is missing column %q: %s", column, peersQuery)
+		}
+	}
+	want := store.Node{
+		ID:             "b",
+		URI:            "enode://b@10.0.0.1:30303",
+		LastSeen:       seen,
+		Kind:           "geth",
+		IsHost:         true,
+		BlockNumber:    42,
+		Network:        1,
+		VipnodeVersion: "v2.3.0",
+		ClockSkew:      time.Second,
+		Capabilities:   map[string]string{"archive": "1"},
+		InternalURI:    "enode://b@192.168.1.2:30303",
+		AvailableSlots: 5,
+		SlotsKnown:     true,
+	}
+	if len(peers) != 1 || !reflect.DeepEqual(peers[0], want) {
+		t.Errorf("got peers: %+v; want: %+v", peers, want)
+	}
+}
+
+func TestEvictNodes(t *testing.T) {
+	var cutoff driver.Value
+	s, b := openFake(func(query string, args []driver.Value) fakeResult {
+		cutoff = args[0]
+		return fakeResult{Columns: []string{"id"}, Rows: [][]driver.Value{{"a"}, {"b"}}}
+	})
+	defer s.Close()
+
+	olderThan := time.Now().Add(-time.Hour)
+	evicted, err := s.EvictNodes(olderThan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []store.NodeID{"a", "b"}; !reflect.DeepEqual(evicted, want) {
+		t.Errorf("got: %v; want: %v", evicted, want)
+	}
+	if got, ok := cutoff.(time.Time); !ok || !got.Equal(olderThan) {
+		t.Errorf("wrong cutoff: %v", cutoff)
+	}
+	if i := indexPrefix(b.log, "DELETE FROM vip_nodes"); i < 0 {
+		t.Errorf("nodes were not deleted: %q", b.log)
+	}
+}
+
+func TestAddNodeBalance(t *testing.T) {
+	var account driver.Value
+	var upsertArgs []driver.Value
+	s, b := openFake(func(query string, args []driver.Value) fakeResult {
+		switch {
+		case strings.Contains(query, "FOR UPDATE"):
+			return fakeResult{Columns: []string{"account"}, Rows: [][]driver.Value{{account}}}
+		case strings.Contains(query, "INSERT INTO"):
+			upsertArgs = args
+			return fakeResult{Affected: 1}
+		}
+		return fakeResult{}
+	})
+	defer s.Close()
+
+	credit, _ := new(big.Int).SetString("1000000000000000000000", 10)
+
+	// Trial balance
+	if err := s.AddNodeBalance("foo", credit); err != nil {
+		t.Fatal(err)
+	}
+	if i := indexPrefix(b.log, "INSERT INTO vip_trials"); i < 0 {
+		t.Errorf("trial balance was not updated: %q", b.log)
+	}
+	if want := []driver.Value{"foo", "1000000000000000000000"}; !reflect.DeepEqual(upsertArgs, want) {
+		t.Errorf("got: %#v; want: %#v", upsertArgs, want)
+	}
+	if b.log[0] != "BEGIN" || b.log[len(b.log)-1] != "COMMIT" {
+		t.Errorf("balance update did not run within a transaction: %q", b.log)
+	}
+
+	// Account balance
+	b.log = nil
+	account = "bar"
+	if err := s.AddNodeBalance("foo", credit); err != nil {
+		t.Fatal(err)
+	}
+	if i := indexPrefix(b.log, "INSERT INTO vip_balances"); i < 0 {
+		t.Errorf("account balance was not updated: %q", b.log)
+	}
+	if want := []driver.Value{"bar", "1000000000000000000000"}; !reflect.DeepEqual(upsertArgs, want) {
+		t.Errorf("got: %#v; want: %#v", upsertArgs, want)
+	}
+}
+
+func TestNumeric(t *testing.T) {
+	want, _ := new(big.Int).SetString("-123456789012345678901234567890", 10)
+
+	v, err := (*numeric)(want).Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, src := range []interface{}{v, []byte(v.(string))} {
+		var got big.Int
+		if err := (*numeric)(&got).Scan(src); err != nil {
+			t.Fatal(err)
+		}
+		if got.Cmp(want) != 0 {
+			t.Errorf("got: %s; want: %s", &got, want)
+		}
+	}
+
+	var got big.Int
+	if err := (*numeric)(&got).Scan(nil); err != nil {
+		t.Fatal(err)
+	}
+	if got.Sign() != 0 {
+		t.Errorf("expected nil to scan as zero, got: %s", &got)
+	}
+	if err := (*numeric)(&got).Scan("1.5"); err == nil {
+		t.Errorf("expected fractional numeric to fail")
+	}
+}
+
+func TestTransfer(t *testing.T) {
+	var affected int64
+	s, b := openFake(func(query string, args []driver.Value) fakeResult {
+		if strings.HasPrefix(query, "UPDATE vip_balances") {
+			return fakeResult{Affected: affected}
+		}
+		return fakeResult{Affected: 1}
+	})
+	defer s.Close()
+
+	if err := s.Transfer("foo", "bar", big.NewInt(-1)); err != store.ErrInvalidAmount {
+		t.Errorf("expected ErrInvalidAmount, got: %v", err)
+	}
+
+	affected = 0
+	if err := s.Transfer("foo", "bar", big.NewInt(42)); err != store.ErrInsufficientBalance {
+		t.Errorf("expected ErrInsufficientBalance, got: %v", err)
+	}
+	if got := b.log[len(b.log)-1]; got != "ROLLBACK" {
+		t.Errorf("expected failed transfer to be rolled back: %q", b.log)
+	}
+
+	b.log = nil
+	affected = 1
+	if err := s.Transfer("foo", "bar", big.NewInt(42)); err != nil {
+		t.Fatal(err)
+	}
+	if i := indexPrefix(b.log, "SELECT account FROM vip_balances"); i != 1 {
+		t.Errorf("balances were not locked first: %q", b.log)
+	}
+	if i := indexPrefix(b.log, "INSERT INTO vip_balances"); i < 0 {
+		t.Errorf("destination balance was not credited: %q", b.log)
+	}
+	if got := b.log[len(b.log)-1]; got != "COMMIT" {
+		t.Errorf("expected transfer to be committed: %q", b.log)
+	}
+}
@@ -0,0 +1,191 @@
+package postgres
+
+import (
+	"database/sql"
+)
+
+const dbVersion = 9
+
+var migrations = [dbVersion]MigrationStep{
+	// Version 0 -> 1
+	func(tx *sql.Tx) error {
+		if err := checkVersion(tx, 0); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(schemaV1); err != nil {
+			return err
+		}
+		return setVersion(tx, 1)
+	},
+	// Version 1 -> 2
+	func(tx *sql.Tx) error {
+		if err := checkVersion(tx, 1); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(schemaV2); err != nil {
+			return err
+		}
+		return setVersion(tx, 2)
+	},
+	// Version 2 -> 3
+	func(tx *sql.Tx) error {
+		if err := checkVersion(tx, 2); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(schemaV3); err != nil {
+			return err
+		}
+		return setVersion(tx, 3)
+	},
+	// Version 3 -> 4
+	func(tx *sql.Tx) error {
+		if err := checkVersion(tx, 3); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(schemaV4); err != nil {
+			return err
+		}
+		return setVersion(tx, 4)
+	},
+	// Version 4 -> 5
+	func(tx *sql.Tx) error {
+		if err := checkVersion(tx, 4); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(schemaV5); err != nil {
+			return err
+		}
+		return setVersion(tx, 5)
+	},
+	// Version 5 -> 6
+	func(tx *sql.Tx) error {
+		if err := checkVersion(tx, 5); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(schemaV6); err != nil {
+			return err
+		}
+		return setVersion(tx, 6)
+	},
+	// Version 6 -> 7
+	func(tx *sql.Tx) error {
+		if err := checkVersion(tx, 6); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(schemaV7); err != nil {
+			return err
+		}
+		return setVersion(tx, 7)
+	},
+	// Version 7 -> 8
+	func(tx *sql.Tx) error {
+		if err := checkVersion(tx, 7); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(schemaV8); err != nil {
+			return err
+		}
+		return setVersion(tx, 8)
+	},
+	// Version 8 -> 9
+	func(tx *sql.Tx) error {
+		if err := checkVersion(tx, 8); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(schemaV9); err != nil {
+			return err
+		}
+		return setVersion(tx, 9)
+	},
+}
+
+const schemaV1 = `
+CREATE TABLE vip_nodes (
+	id TEXT PRIMARY KEY,
+	uri TEXT NOT NULL DEFAULT '',
+	last_seen TIMESTAMPTZ NOT NULL,
+	kind TEXT NOT NULL DEFAULT '',
+	is_host BOOLEAN NOT NULL DEFAULT FALSE,
+	payout TEXT NOT NULL DEFAULT '',
+	block_number BIGINT NOT NULL DEFAULT 0
+);
+CREATE INDEX vip_nodes_hosts_last_seen ON vip_nodes (last_seen) WHERE is_host;
+
+CREATE TABLE vip_peers (
+	node_id TEXT NOT NULL REFERENCES vip_nodes (id) ON DELETE CASCADE,
+	peer_id TEXT NOT NULL,
+	last_seen TIMESTAMPTZ NOT NULL,
+	PRIMARY KEY (node_id, peer_id)
+);
+
+CREATE TABLE vip_node_accounts (
+	node_id TEXT PRIMARY KEY,
+	account TEXT NOT NULL
+);
+CREATE INDEX vip_node_accounts_account ON vip_node_accounts (account);
+
+CREATE TABLE vip_balances (
+	account TEXT PRIMARY KEY,
+	credit NUMERIC NOT NULL DEFAULT 0,
+	deposit NUMERIC NOT NULL DEFAULT 0
+);
+
+CREATE TABLE vip_trials (
+	node_id TEXT PRIMARY KEY,
+	credit NUMERIC NOT NULL DEFAULT 0,
+	deposit NUMERIC NOT NULL DEFAULT 0
+);
+
+CREATE TABLE vip_nonces (
+	id TEXT PRIMARY KEY,
+	nonce BIGINT NOT NULL
+);
+`
+
+// schemaV2 indexes last_seen across all nodes, for evicting stale nodes.
+const schemaV2 = `
+CREATE INDEX vip_nodes_last_seen ON vip_nodes (last_seen);
+`
+
+// schemaV3 adds the network ID of nodes.
+const schemaV3 = `
+ALTER TABLE vip_nodes ADD COLUMN network INTEGER NOT NULL DEFAULT 0;
+`
+
+// schemaV4 adds the vipnode agent version of nodes.
+const schemaV4 = `
+ALTER TABLE vip_nodes ADD COLUMN vipnode_version TEXT NOT NULL DEFAULT '';
+`
+
+// schemaV5 adds billed sessions, for accounting exports.
+const schemaV5 = `
+CREATE TABLE vip_sessions (
+	client_id TEXT NOT NULL,
+	host_id TEXT NOT NULL,
+	start_time TIMESTAMPTZ NOT NULL,
+	end_time TIMESTAMPTZ NOT NULL,
+	amount NUMERIC NOT NULL DEFAULT 0
+);
+CREATE INDEX vip_sessions_end_time ON vip_sessions (end_time);
+`
+
+// schemaV6 adds the estimated clock skew of nodes, in nanoseconds.
+const schemaV6 = `
+ALTER TABLE vip_nodes ADD COLUMN clock_skew BIGINT NOT NULL DEFAULT 0;
+`
+
+// schemaV7 adds the capabilities of nodes, as a JSON object.
+const schemaV7 = `
+ALTER TABLE vip_nodes ADD COLUMN capabilities TEXT NOT NULL DEFAULT '';
+`
+
+// schemaV8 adds the internal enode URI of hosts.
+const schemaV8 = `
+ALTER TABLE vip_nodes ADD COLUMN internal_uri TEXT NOT NULL DEFAULT '';
+`
+
+// schemaV9 adds the client slots that hosts reported, which are NULL when a
+// host doesn't know its peer limit.
+const schemaV9 = `
+ALTER TABLE vip_nodes ADD COLUMN available_slots INTEGER;
+`
@@ -0,0 +1,31 @@
+//go:build redis
+// +build redis
+
+package redis
+
+import (
+	"os"
+	"testing"
+
+	"github.com/vipnode/vipnode/pool/store"
+)
+
+// Run with: VIPNODE_TEST_REDIS="redis://localhost:6379/15" go test -tags redis
+//
+// Warning: The database is flushed between tests.
+func TestRedisServer(t *testing.T) {
+	url := os.Getenv("VIPNODE_TEST_REDIS")
+	if url == "" {
+		t.Skip("VIPNODE_TEST_REDIS is not set")
+	}
+
+	s, err := Open(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	store.TestSuite(t, func() store.Store {
+		return redisTesting{s}
+	})
+}
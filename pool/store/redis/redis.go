@@ -0,0 +1,783 @@
+package redis
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"math/rand"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/vipnode/vipnode/pool/store"
+)
+
+// maxTxRetries is the number of times an optimistic transaction is retried
+// when one of its watched keys is modified concurrently.
+const maxTxRetries = 50
+
+// ErrTxConflict is returned when a transaction could not be committed after
+// maxTxRetries attempts, due to concurrent modification of its keys.
+var ErrTxConflict = errors.New("redis transaction failed due to too many conflicts")
+
+// Open returns a store.Store implementation using Redis as the storage
+// driver. The url is parsed with redis.ParseURL, such as
+// "redis://:password@localhost:6379/0". The store should be
+// (*redisStore).Close()'d after use.
+//
+// Balances are updated atomically with HINCRBY, so they are limited to the
+// range of a signed 64-bit integer. Peer sessions expire after
+// store.ExpireInterval without an update, and nonces after
+// store.ExpireNonce.
+func Open(url string) (*redisStore, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+	client := redis.NewClient(opts)
+	if err := client.Ping().Err(); err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	s := &redisStore{
+		client:      client,
+		nonceExpire: store.ExpireNonce,
+		peersExpire: store.ExpireInterval,
+	}
+	return s, nil
+}
+
+var _ store.Store = &redisStore{}
+
+type redisStore struct {
+	client *redis.Client
+
+	nonceExpire time.Duration
+	peersExpire time.Duration
+}
+
+func (s *redisStore) Close() error {
+	return s.client.Close()
+}
+
+// watch runs fn as an optimistic transaction, retrying it if any of the
+// watched keys are modified before it commits.
+func (s *redisStore) watch(fn func(tx *redis.Tx) error, keys ...string) error {
+	for i := 0; i < maxTxRetries; i++ {
+		err := s.client.Watch(fn, keys...)
+		if err != redis.TxFailedErr {
+			return err
+		}
+		// Back off with some jitter so that contending transactions don't
+		// keep colliding.
+		time.Sleep(time.Duration(rand.Intn(i+1)) * time.Millisecond)
+	}
+	return ErrTxConflict
+}
+
+// int64Credit converts a credit amount for use with HINCRBY.
+func int64Credit(credit *big.Int) (int64, error) {
+	if !credit.IsInt64() {
+		return 0, fmt.Errorf("redis store: credit amount out of range: %s", credit)
+	}
+	return credit.Int64(), nil
+}
+
+func (s *redisStore) CheckAndSaveNonce(ID string, nonce int64) error {
+	// If nonceExpire is set, nonce should be within nonceExpire of now.
+	if s.nonceExpire > 0 {
+		if nonce <= time.Now().Add(-s.nonceExpire).UnixNano() {
+			// Nonce is too old
+			return store.ErrInvalidNonce
+		}
+	}
+	key := fmt.Sprintf("vip:nonce:%s", ID)
+	return s.watch(func(tx *redis.Tx) error {
+		lastNonce, err := tx.Get(key).Int64()
+		if err != nil && err != redis.Nil {
+			return err
+		}
+		if lastNonce >= nonce {
+			return store.ErrInvalidNonce
+		}
+		_, err = tx.Pipelined(func(pipe redis.Pipeliner) error {
+			// Nonces older than nonceExpire are rejected above, so we
+			// don't need to keep them around.
+			pipe.Set(key, nonce, s.nonceExpire)
+			return nil
+		})
+		return err
+	}, key)
+}
+
+// getBalance loads the balance stored in a hash at key.
+func getBalance(c redis.Cmdable, key string) (store.Balance, error) {
+	var r store.Balance
+	fields, err := c.HGetAll(key).Result()
+	if err != nil {
+		return r, err
+	}
+	for name, dst := range map[string]*big.Int{"credit": &r.Credit, "deposit": &r.Deposit} {
+		v, ok := fields[name]
+		if !ok {
+			continue
+		}
+		if _, ok := dst.SetString(v, 10); !ok {
+			return r, fmt.Errorf("redis store: invalid %s value for %q: %q", name, key, v)
+		}
+	}
+	return r, nil
+}
+
+// GetNodeBalance returns the current account balance for a node.
+func (s *redisStore) GetNodeBalance(nodeID store.NodeID) (store.Balance, error) {
+	nodeKey := fmt.Sprintf("vip:node:%s", nodeID)
+	accountKey := fmt.Sprintf("vip:account:%s", nodeID)
+	if n, err := s.client.Exists(nodeKey).Result(); err != nil {
+		return store.Balance{}, err
+	} else if n == 0 {
+		return store.Balance{}, store.ErrUnregisteredNode
+	}
+
+	account, err := s.client.Get(accountKey).Result()
+	if err == redis.Nil {
+		return getBalance(s.client, fmt.Sprintf("vip:trial:%s", nodeID))
+	} else if err != nil {
+		return store.Balance{}, err
+	}
+	r, err := getBalance(s.client, fmt.Sprintf("vip:balance:%s", account))
+	r.Account = store.Account(account)
+	return r, err
+}
+
+// AddNodeBalance adds some credit amount to a node's account balance. (Can be negative)
+// If only a node is provided which doesn't have an account registered to
+// it, it should retain a balance, such as through temporary trial accounts
+// that get migrated later.
+func (s *redisStore) AddNodeBalance(nodeID store.NodeID, credit *big.Int) error {
+	amount, err := int64Credit(credit)
+	if err != nil {
+		return err
+	}
+	nodeKey := fmt.Sprintf("vip:node:%s", nodeID)
+	accountKey := fmt.Sprintf("vip:account:%s", nodeID)
+	// Watching the account key prevents a concurrent AddAccountNode from
+	// migrating the trial balance out from under us.
+	return s.watch(func(tx *redis.Tx) error {
+		if n, err := tx.Exists(nodeKey).Result(); err != nil {
+			return err
+		} else if n == 0 {
+			return store.ErrUnregisteredNode
+		}
+		account, err := tx.Get(accountKey).Result()
+		if err != nil && err != redis.Nil {
+			return err
+		}
+		_, err = tx.Pipelined(func(pipe redis.Pipeliner) error {
+			if account != "" {
+				pipe.SAdd("vip:balances", account)
+				pipe.HIncrBy(fmt.Sprintf("vip:balance:%s", account), "credit", amount)
+			} else {
+				pipe.SAdd("vip:trials", string(nodeID))
+				pipe.HIncrBy(fmt.Sprintf("vip:trial:%s", nodeID), "credit", amount)
+			}
+			return nil
+		})
+		return err
+	}, nodeKey, accountKey)
+}
+
+// GetAccountBalance returns an account's balance.
+func (s *redisStore) GetAccountBalance(account store.Account) (store.Balance, error) {
+	r, err := getBalance(s.client, fmt.Sprintf("vip:balance:%s", account))
+	if err != nil {
+		return r, err
+	}
+	if r.Credit.Sign() != 0 || r.Deposit.Sign() != 0 {
+		r.Account = account
+	}
+	return r, nil
+}
+
+// AddAccountBalance adds credit to an account balance. (Can be negative)
+func (s *redisStore) AddAccountBalance(account store.Account, credit *big.Int) error {
+	amount, err := int64Credit(credit)
+	if err != nil {
+		return err
+	}
+	_, err = s.client.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.SAdd("vip:balances", string(account))
+		pipe.HIncrBy(fmt.Sprintf("vip:balance:%s", account), "credit", amount)
+		return nil
+	})
+	return err
+}
+
+// Transfer atomically moves amount of credit from one account's balance to
+// another's.
+func (s *redisStore) Transfer(from, to store.Account, amount *big.Int) error {
+	if amount.Sign() < 0 {
+		return store.ErrInvalidAmount
+	}
+	credit, err := int64Credit(amount)
+	if err != nil {
+		return err
+	}
+	fromKey := fmt.Sprintf("vip:balance:%s", from)
+	toKey := fmt.Sprintf("vip:balance:%s", to)
+	return s.watch(func(tx *redis.Tx) error {
+		fromBalance, err := getBalance(tx, fromKey)
+		if err != nil {
+			return err
+		}
+		if fromBalance.Credit.Cmp(amount) < 0 {
+			return store.ErrInsufficientBalance
+		}
+		_, err = tx.Pipelined(func(pipe redis.Pipeliner) error {
+			pipe.SAdd("vip:balances", string(from), string(to))
+			pipe.HIncrBy(fromKey, "credit", -credit)
+			pipe.HIncrBy(toKey, "credit", credit)
+			return nil
+		})
+		return err
+	}, fromKey, toKey)
+}
+
+// AddAccountNode authorizes a nodeID to be a spender of an account's
+// balance. This should migrate any existing node's balance credit to the
+// account.
+func (s *redisStore) AddAccountNode(account store.Account, nodeID store.NodeID) error {
+	nodeKey := fmt.Sprintf("vip:node:%s", nodeID)
+	accountKey := fmt.Sprintf("vip:account:%s", nodeID)
+	trialKey := fmt.Sprintf("vip:trial:%s", nodeID)
+	return s.watch(func(tx *redis.Tx) error {
+		if n, err := tx.Exists(nodeKey).Result(); err != nil {
+			return err
+		} else if n == 0 {
+			return store.ErrUnregisteredNode
+		}
+		oldAccount, err := tx.Get(accountKey).Result()
+		if err != nil && err != redis.Nil {
+			return err
+		}
+		trial, err := getBalance(tx, trialKey)
+		if err != nil {
+			return err
+		}
+		trialCredit, err := int64Credit(&trial.Credit)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Pipelined(func(pipe redis.Pipeliner) error {
+			if oldAccount != "" {
+				pipe.SRem(fmt.Sprintf("vip:account_nodes:%s", oldAccount), string(nodeID))
+			}
+			pipe.Set(accountKey, string(account), 0)
+			pipe.SAdd(fmt.Sprintf("vip:account_nodes:%s", account), string(nodeID))
+
+			// Merge trial
+			pipe.SAdd("vip:balances", string(account))
+			pipe.HIncrBy(fmt.Sprintf("vip:balance:%s", account), "credit", trialCredit)
+			pipe.Del(trialKey)
+			pipe.SRem("vip:trials", string(nodeID))
+			return nil
+		})
+		return err
+	}, nodeKey, accountKey, trialKey)
+}
+
+// IsAccountNode returns nil if node is a valid spender of the given
+// account.
+func (s *redisStore) IsAccountNode(account store.Account, nodeID store.NodeID) error {
+	nodeAccount, err := s.client.Get(fmt.Sprintf("vip:account:%s", nodeID)).Result()
+	if err == redis.Nil {
+		return store.ErrNotAuthorized
+	} else if err != nil {
+		return err
+	}
+	if store.Account(nodeAccount) != account {
+		return store.ErrNotAuthorized
+	}
+	return nil
+}
+
+// GetAccountNodes returns the authorized nodeIDs for this account, these are
+// nodes that were added to accounts through AddAccountNode.
+func (s *redisStore) GetAccountNodes(account store.Account) ([]store.NodeID, error) {
+	members, err := s.client.SMembers(fmt.Sprintf("vip:account_nodes:%s", account)).Result()
+	if err != nil {
+		return nil, err
+	}
+	r := make([]store.NodeID, 0, len(members))
+	for _, m := range members {
+		r = append(r, store.NodeID(m))
+	}
+	return r, nil
+}
+
+// encodeNode returns the hash fields of n, and the optional fields which it
+// doesn't have, to delete since HMSET only adds and replaces fields.
+func encodeNode(n store.Node) (fields map[string]interface{}, cleared []string) {
+	fields = map[string]interface{}{
+		"uri":          n.URI,
+		"internal_uri": n.InternalURI,
+		"last_seen":    n.LastSeen.Format(time.RFC3339Nano),
+		"kind":         n.Kind,
+		"is_host":      strconv.FormatBool(n.IsHost),
+		"payout":       string(n.Payout),
+		"block_number": strconv.FormatUint(n.BlockNumber, 10),
+		"network":      strconv.Itoa(n.Network),
+		"version":      n.VipnodeVersion,
+		"clock_skew":   strconv.FormatInt(int64(n.ClockSkew), 10),
+	}
+	if len(n.Capabilities) > 0 {
+		// Marshalling a map of strings can't fail.
+		data, _ := json.Marshal(n.Capabilities)
+		fields["capabilities"] = string(data)
+	} else {
+		cleared = append(cleared, "capabilities")
+	}
+	if n.SlotsKnown {
+		fields["available_slots"] = strconv.Itoa(n.AvailableSlots)
+	} else {
+		cleared = append(cleared, "available_slots")
+	}
+	return fields, cleared
+}
+
+// setNode queues the commands to save n in the hash at key. It should run
+// within a MULTI, so that readers never see a mix of old and new fields.
+func setNode(pipe redis.Pipeliner, key string, n store.Node) {
+	fields, cleared := encodeNode(n)
+	pipe.HMSet(key, fields)
+	if len(cleared) > 0 {
+		pipe.HDel(key, cleared...)
+	}
+}
+
+func decodeNode(nodeID store.NodeID, fields map[string]string) (store.Node, error) {
+	n := store.Node{
+		ID:     nodeID,
+		URI:    fields["uri"],
+		Kind:   fields["kind"],
+		Payout: store.Account(fields["payout"]),
+	}
+	var err error
+	if n.LastSeen, err = time.Parse(time.RFC3339Nano, fields["last_seen"]); err != nil {
+		return n, err
+	}
+	if n.IsHost, err = strconv.ParseBool(fields["is_host"]); err != nil {
+		return n, err
+	}
+	if n.BlockNumber, err = strconv.ParseUint(fields["block_number"], 10, 64); err != nil {
+		return n, err
+	}
+	if network, ok := fields["network"]; ok {
+		// Nodes saved before the network was tracked don't have this field.
+		if n.Network, err = strconv.Atoi(network); err != nil {
+			return n, err
+		}
+	}
+	n.VipnodeVersion = fields["version"]
+	n.InternalURI = fields["internal_uri"]
+	if skew, ok := fields["clock_skew"]; ok {
+		nanos, err := strconv.ParseInt(skew, 10, 64)
+		if err != nil {
+			return n, err
+		}
+		n.ClockSkew = time.Duration(nanos)
+	}
+	if capabilities, ok := fields["capabilities"]; ok {
+		if err := json.Unmarshal([]byte(capabilities), &n.Capabilities); err != nil {
+			return n, err
+		}
+	}
+	if slots, ok := fields["available_slots"]; ok {
+		if n.AvailableSlots, err = strconv.Atoi(slots); err != nil {
+			return n, err
+		}
+		n.SlotsKnown = true
+	}
+	return n, nil
+}
+
+// getNodes loads the nodes for the given IDs in a single round trip,
+// skipping any that are not registered.
+func (s *redisStore) getNodes(nodeIDs []string) ([]store.Node, error) {
+	cmds := make([]*redis.StringStringMapCmd, 0, len(nodeIDs))
+	_, err := s.client.Pipelined(func(pipe redis.Pipeliner) error {
+		for _, id := range nodeIDs {
+			cmds = append(cmds, pipe.HGetAll(fmt.Sprintf("vip:node:%s", id)))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	r := make([]store.Node, 0, len(nodeIDs))
+	for i, cmd := range cmds {
+		fields := cmd.Val()
+		if len(fields) == 0 {
+			continue
+		}
+		n, err := decodeNode(store.NodeID(nodeIDs[i]), fields)
+		if err != nil {
+			return nil, err
+		}
+		r = append(r, n)
+	}
+	return r, nil
+}
+
+// GetNode returns the node with the given ID.
+func (s *redisStore) GetNode(nodeID store.NodeID) (*store.Node, error) {
+	fields, err := s.client.HGetAll(fmt.Sprintf("vip:node:%s", nodeID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, store.ErrUnregisteredNode
+	}
+	n, err := decodeNode(nodeID, fields)
+	if err != nil {
+		return nil, err
+	}
+	return &n, nil
+}
+
+// SetNode saves a node.
+func (s *redisStore) SetNode(n store.Node) error {
+	if n.ID.IsZero() {
+		return store.ErrMalformedNode
+	}
+	_, err := s.client.TxPipelined(func(pipe redis.Pipeliner) error {
+		setNode(pipe, fmt.Sprintf("vip:node:%s", n.ID), n)
+		pipe.SAdd("vip:nodes", string(n.ID))
+		pipe.ZAdd("vip:last_seen", redis.Z{Score: float64(n.LastSeen.Unix()), Member: string(n.ID)})
+		if n.IsHost {
+			pipe.ZAdd("vip:hosts", redis.Z{Score: float64(n.LastSeen.Unix()), Member: string(n.ID)})
+			pipe.ZAdd("vip:index:hosts", redis.Z{Member: string(n.ID)})
+			pipe.ZRem("vip:index:clients", string(n.ID))
+		} else {
+			pipe.ZRem("vip:hosts", string(n.ID))
+			pipe.ZRem("vip:index:hosts", string(n.ID))
+			pipe.ZAdd("vip:index:clients", redis.Z{Member: string(n.ID)})
+		}
+		return nil
+	})
+	return err
+}
+
+// ActiveHosts returns `limit`-number of `kind` nodes. This could be an
+// empty list, if none are available.
+func (s *redisStore) ActiveHosts(kind string, limit int) ([]store.Node, error) {
+	seenSince := time.Now().Add(-store.ExpireInterval)
+	// vip:hosts is scored by LastSeen, so we only load recently seen hosts.
+	hostIDs, err := s.client.ZRangeByScore("vip:hosts", redis.ZRangeBy{
+		Min: strconv.FormatInt(seenSince.Unix(), 10),
+		Max: "+inf",
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+	hosts, err := s.getNodes(hostIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	r := make([]store.Node, 0, limit)
+	// TODO: Do something other than random, such as by availability?
+	for _, i := range rand.Perm(len(hosts)) {
+		n := hosts[i]
+		if !n.IsHost {
+			continue
+		}
+		if kind != "" && n.Kind != kind {
+			continue
+		}
+		if !n.LastSeen.After(seenSince) {
+			continue
+		}
+		r = append(r, n)
+		if len(r) == limit {
+			break
+		}
+	}
+	return r, nil
+}
+
+// EvictNodes removes nodes which were last seen before olderThan. Nodes are
+// indexed by their last seen timestamp in the vip:last_seen sorted set, so
+// only the stale ones are visited.
+func (s *redisStore) EvictNodes(olderThan time.Time) ([]store.NodeID, error) {
+	cutoff := float64(olderThan.Unix())
+	stale, err := s.client.ZRangeByScore("vip:last_seen", redis.ZRangeBy{
+		Min: "-inf",
+		Max: fmt.Sprintf("(%d", olderThan.Unix()),
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	evicted := []store.NodeID{}
+	for _, nodeID := range stale {
+		nodeKey := fmt.Sprintf("vip:node:%s", nodeID)
+		removed := false
+		err := s.watch(func(tx *redis.Tx) error {
+			removed = false
+			// The node could have been updated since we looked it up.
+			score, err := tx.ZScore("vip:last_seen", nodeID).Result()
+			if err == redis.Nil {
+				return nil
+			} else if err != nil {
+				return err
+			}
+			if score >= cutoff {
+				return nil
+			}
+			_, err = tx.Pipelined(func(pipe redis.Pipeliner) error {
+				pipe.Del(nodeKey, fmt.Sprintf("vip:peers:%s", nodeID))
+				pipe.SRem("vip:nodes", nodeID)
+				pipe.ZRem("vip:last_seen", nodeID)
+				pipe.ZRem("vip:hosts", nodeID)
+				pipe.ZRem("vip:index:hosts", nodeID)
+				pipe.ZRem("vip:index:clients", nodeID)
+				return nil
+			})
+			removed = err == nil
+			return err
+		}, nodeKey)
+		if err != nil {
+			return evicted, err
+		}
+		if removed {
+			evicted = append(evicted, store.NodeID(nodeID))
+		}
+	}
+	return evicted, nil
+}
+
+// ListHosts returns a page of host nodes ordered by ID, starting after cursor.
+func (s *redisStore) ListHosts(cursor string, limit int) ([]store.Node, string, error) {
+	return s.listNodes("vip:index:hosts", cursor, limit)
+}
+
+// ListClients returns a page of client nodes ordered by ID, starting after cursor.
+func (s *redisStore) ListClients(cursor string, limit int) ([]store.Node, string, error) {
+	return s.listNodes("vip:index:clients", cursor, limit)
+}
+
+// listNodes pages through an index of node IDs, which is a sorted set with
+// equal scores so that it's ordered lexicographically.
+func (s *redisStore) listNodes(indexKey string, cursor string, limit int) ([]store.Node, string, error) {
+	opt := redis.ZRangeBy{Min: "-", Max: "+"}
+	if cursor != "" {
+		opt.Min = "(" + cursor
+	}
+	if limit > 0 {
+		// One extra to know if there's a next page
+		opt.Count = int64(limit) + 1
+	}
+	nodeIDs, err := s.client.ZRangeByLex(indexKey, opt).Result()
+	if err != nil {
+		return nil, "", err
+	}
+	nodes, err := s.getNodes(nodeIDs)
+	if err != nil {
+		return nil, "", err
+	}
+	page, next := store.Paginate(nodes, limit)
+	return page, next, nil
+}
+
+// NodePeers returns a list of active connected peers that this pool knows
+// about for this NodeID.
+func (s *redisStore) NodePeers(nodeID store.NodeID) ([]store.Node, error) {
+	if n, err := s.client.Exists(fmt.Sprintf("vip:node:%s", nodeID)).Result(); err != nil {
+		return nil, err
+	} else if n == 0 {
+		return nil, store.ErrUnregisteredNode
+	}
+	peerIDs, err := s.client.ZRange(fmt.Sprintf("vip:peers:%s", nodeID), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	return s.getNodes(peerIDs)
+}
+
+// UpdateNodePeers updates the Node.peers lookup with the current timestamp
+// of nodes we know about. This is used as a keepalive, and to keep track of
+// which client is connected to which host.
+func (s *redisStore) UpdateNodePeers(nodeID store.NodeID, peers []string, blockNumber uint64) (inactive []store.NodeID, err error) {
+	nodeKey := fmt.Sprintf("vip:node:%s", nodeID)
+	peersKey := fmt.Sprintf("vip:peers:%s", nodeID)
+
+	err = s.watch(func(tx *redis.Tx) error {
+		inactive = nil
+		fields, err := tx.HGetAll(nodeKey).Result()
+		if err != nil {
+			return err
+		}
+		if len(fields) == 0 {
+			return store.ErrUnregisteredNode
+		}
+		node, err := decodeNode(nodeID, fields)
+		if err != nil {
+			return err
+		}
+		knownPeers, err := tx.ZRangeWithScores(peersKey, 0, -1).Result()
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		lastSeen := map[string]float64{}
+		for _, z := range knownPeers {
+			lastSeen[z.Member.(string)] = z.Score
+		}
+		updated := []redis.Z{}
+		for _, peer := range peers {
+			// Only update peers we already know about. (These can't be
+			// batched into a MULTI, as EXEC would discard our WATCH.)
+			if n, err := tx.Exists(fmt.Sprintf("vip:node:%s", peer)).Result(); err != nil {
+				return err
+			} else if n == 0 {
+				continue
+			}
+			lastSeen[peer] = float64(now.Unix())
+			updated = append(updated, redis.Z{Score: float64(now.Unix()), Member: peer})
+		}
+
+		removed := []interface{}{}
+		if len(updated) != len(lastSeen) {
+			inactiveDeadline := float64(now.Add(-store.ExpireInterval).Unix())
+			for peerID, timestamp := range lastSeen {
+				if timestamp < inactiveDeadline {
+					continue
+				}
+				removed = append(removed, peerID)
+				inactive = append(inactive, store.NodeID(peerID))
+			}
+		}
+
+		node.LastSeen = now
+		node.BlockNumber = blockNumber
+		_, err = tx.Pipelined(func(pipe redis.Pipeliner) error {
+			setNode(pipe, nodeKey, node)
+			pipe.ZAdd("vip:last_seen", redis.Z{Score: float64(now.Unix()), Member: string(nodeID)})
+			if node.IsHost {
+				pipe.ZAdd("vip:hosts", redis.Z{Score: float64(now.Unix()), Member: string(nodeID)})
+			}
+			if len(updated) > 0 {
+				pipe.ZAdd(peersKey, updated...)
+			}
+			if len(removed) > 0 {
+				pipe.ZRem(peersKey, removed...)
+			}
+			// Peer sessions are only retained while the node keeps
+			// sending updates.
+			pipe.Expire(peersKey, s.peersExpire)
+			return nil
+		})
+		return err
+	}, nodeKey, peersKey)
+	return
+}
+
+// sessionsPageSize is the number of sessions loaded per round trip while
+// iterating over sessions.
+const sessionsPageSize = 1000
+
+// sessionScore scores sessions in vip:sessions by their end time in
+// milliseconds, which fits within the precision of a float64 score.
+func sessionScore(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+// AddSession records a billed session. Sessions are JSON-encoded in the
+// vip:sessions sorted set.
+func (s *redisStore) AddSession(session store.Session) error {
+	member, err := json.Marshal(&session)
+	if err != nil {
+		return err
+	}
+	return s.client.ZAdd("vip:sessions", redis.Z{
+		Score:  float64(sessionScore(session.End)),
+		Member: string(member),
+	}).Err()
+}
+
+// Sessions calls fn for each session which ended within [since, until),
+// loading them in pages of sessionsPageSize.
+func (s *redisStore) Sessions(since, until time.Time, fn func(store.Session) error) error {
+	for offset := int64(0); ; offset += sessionsPageSize {
+		members, err := s.client.ZRangeByScore("vip:sessions", redis.ZRangeBy{
+			Min:    strconv.FormatInt(sessionScore(since), 10),
+			Max:    "(" + strconv.FormatInt(sessionScore(until), 10),
+			Offset: offset,
+			Count:  sessionsPageSize,
+		}).Result()
+		if err != nil {
+			return err
+		}
+		for _, member := range members {
+			var session store.Session
+			if err := json.Unmarshal([]byte(member), &session); err != nil {
+				return err
+			}
+			if err := fn(session); err != nil {
+				return err
+			}
+		}
+		if len(members) < sessionsPageSize {
+			return nil
+		}
+	}
+}
+
+// Stats returns aggregate statistics about the store state.
+func (s *redisStore) Stats() (*store.Stats, error) {
+	stats := store.Stats{}
+
+	nodeIDs, err := s.client.SMembers("vip:nodes").Result()
+	if err != nil {
+		return nil, err
+	}
+	nodes, err := s.getNodes(nodeIDs)
+	if err != nil {
+		return nil, err
+	}
+	for _, n := range nodes {
+		stats.CountNode(n)
+	}
+
+	accounts, err := s.client.SMembers("vip:balances").Result()
+	if err != nil {
+		return nil, err
+	}
+	for _, account := range accounts {
+		b, err := getBalance(s.client, fmt.Sprintf("vip:balance:%s", account))
+		if err != nil {
+			return nil, err
+		}
+		b.Account = store.Account(account)
+		stats.CountBalance(b)
+	}
+
+	trials, err := s.client.SMembers("vip:trials").Result()
+	if err != nil {
+		return nil, err
+	}
+	for _, nodeID := range trials {
+		b, err := getBalance(s.client, fmt.Sprintf("vip:trial:%s", nodeID))
+		if err != nil {
+			return nil, err
+		}
+		stats.CountBalance(b)
+	}
+
+	return &stats, nil
+}
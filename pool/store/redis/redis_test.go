@@ -0,0 +1,101 @@
+package redis
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/vipnode/vipnode/pool/store"
+)
+
+// redisTesting is a wrapper that retains but clears the db on Close().
+type redisTesting struct {
+	*redisStore
+}
+
+func (s redisTesting) Close() error {
+	return s.client.FlushDB().Err()
+}
+
+func openMini(t *testing.T) (*miniredis.Miniredis, *redisStore) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := Open("redis://" + mr.Addr())
+	if err != nil {
+		mr.Close()
+		t.Fatal(err)
+	}
+	return mr, s
+}
+
+func TestRedisStore(t *testing.T) {
+	mr, s := openMini(t)
+	defer mr.Close()
+	defer s.Close()
+
+	store.TestSuite(t, func() store.Store {
+		return redisTesting{s}
+	})
+}
+
+func TestRedisExpire(t *testing.T) {
+	mr, s := openMini(t)
+	defer mr.Close()
+	defer s.Close()
+
+	if err := s.CheckAndSaveNonce("foo", time.Now().UnixNano()); err != nil {
+		t.Fatal(err)
+	}
+	if got := mr.TTL("vip:nonce:foo"); got != store.ExpireNonce {
+		t.Errorf("wrong nonce TTL: %s", got)
+	}
+
+	for _, id := range []store.NodeID{"a", "b"} {
+		if err := s.SetNode(store.Node{ID: id, LastSeen: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := s.UpdateNodePeers("a", []string{"b"}, 42); err != nil {
+		t.Fatal(err)
+	}
+	if peers, err := s.NodePeers("a"); err != nil {
+		t.Fatal(err)
+	} else if len(peers) != 1 {
+		t.Errorf("wrong number of peers: %d", len(peers))
+	}
+	if got := mr.TTL("vip:peers:a"); got != store.ExpireInterval {
+		t.Errorf("wrong peers TTL: %s", got)
+	}
+	if n, err := s.GetNode("a"); err != nil {
+		t.Fatal(err)
+	} else if n.BlockNumber != 42 {
+		t.Errorf("wrong block number: %d", n.BlockNumber)
+	}
+
+	// Session expires without a keepalive
+	mr.FastForward(store.ExpireInterval)
+	if peers, err := s.NodePeers("a"); err != nil {
+		t.Fatal(err)
+	} else if len(peers) != 0 {
+		t.Errorf("peers did not expire: %v", peers)
+	}
+}
+
+func TestRedisBalanceOverflow(t *testing.T) {
+	mr, s := openMini(t)
+	defer mr.Close()
+	defer s.Close()
+
+	credit := new(big.Int).Lsh(big.NewInt(1), 64)
+	if err := s.AddAccountBalance("foo", credit); err == nil {
+		t.Errorf("expected out of range credit to fail")
+	}
+	if b, err := s.GetAccountBalance("foo"); err != nil {
+		t.Fatal(err)
+	} else if b.Credit.Sign() != 0 {
+		t.Errorf("unexpected balance: %v", b)
+	}
+}
@@ -63,6 +63,81 @@ type Node struct {
 	IsHost      bool
 	Payout      Account
 	BlockNumber uint64 `json:"block_number"`
+	Network     int    `json:"network,omitempty"` // Network ID, or 0 if unknown
+
+	// VipnodeVersion is the version of the vipnode agent that registered the
+	// node, if it reported one.
+	VipnodeVersion string `json:"vipnode_version,omitempty"`
+
+	// ClockSkew is how far ahead the node's clock was of the pool's when it
+	// registered, estimated from its request nonce.
+	ClockSkew time.Duration `json:"clock_skew,omitempty"`
+
+	// Capabilities are free-form features that a host offers beyond serving
+	// peers, such as "archive" or "trace", which clients can require.
+	Capabilities map[string]string `json:"capabilities,omitempty"`
+
+	// InternalURI is the host's enode:// URI on its private network, which
+	// is handed out instead of URI to clients on the same network.
+	InternalURI string `json:"internal_uri,omitempty"`
+
+	// AvailableSlots is how many more pool clients the host reported room
+	// for on its last update, if SlotsKnown. It's not a pointer since gob,
+	// which some stores encode nodes with, drops pointers to zero.
+	AvailableSlots int `json:"available_slots,omitempty"`
+	// SlotsKnown is set if the host knew its peer limit on its last update.
+	SlotsKnown bool `json:"slots_known,omitempty"`
+}
+
+// Slots returns the AvailableSlots, or nil if they're unknown.
+func (n *Node) Slots() *int {
+	if !n.SlotsKnown {
+		return nil
+	}
+	slots := n.AvailableSlots
+	return &slots
+}
+
+// SetSlots sets the AvailableSlots, which are unknown if slots is nil.
+func (n *Node) SetSlots(slots *int) {
+	n.AvailableSlots, n.SlotsKnown = 0, slots != nil
+	if slots != nil {
+		n.AvailableSlots = *slots
+	}
+}
+
+// IsFull returns whether the host reported that it has no room for more
+// clients. Hosts which don't know their peer limit are never full.
+func (n *Node) IsFull() bool {
+	return n.SlotsKnown && n.AvailableSlots <= 0
+}
+
+// HasCapabilities returns whether the node offers each of the required
+// capabilities. A required value must match exactly, except for an empty
+// value, which matches any value of the capability.
+func (n Node) HasCapabilities(required map[string]string) bool {
+	for name, want := range required {
+		got, ok := n.Capabilities[name]
+		if !ok || (want != "" && got != want) {
+			return false
+		}
+	}
+	return true
+}
+
+// Session is an interval of a client peered with a host, and the amount of
+// credit the client was charged for it.
+type Session struct {
+	ClientID NodeID    `json:"client_id"`
+	HostID   NodeID    `json:"host_id"`
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	Amount   big.Int   `json:"amount"`
+}
+
+// Duration returns the length of the session.
+func (s Session) Duration() time.Duration {
+	return s.End.Sub(s.Start)
 }
 
 // Stats contains various aggregate stats of the store state, used for
@@ -118,6 +193,7 @@ type Store interface {
 	NonceStore
 	PoolStore
 	AccountStore
+	SessionStore
 
 	// Stats returns aggregate statistics about the store state.
 	Stats() (*Stats, error)
@@ -152,6 +228,30 @@ type PoolStore interface {
 	// from the known peers and returned. It also updates nodeID's
 	// LastSeen.
 	UpdateNodePeers(nodeID NodeID, peers []string, blockNumber uint64) (inactive []NodeID, err error)
+
+	// ListHosts returns a page of up to limit host nodes, ordered by ID and
+	// starting after cursor. An empty cursor returns the first page, and the
+	// returned next cursor is empty after the last page. A limit of 0
+	// returns all remaining hosts.
+	ListHosts(cursor string, limit int) (hosts []Node, next string, err error)
+	// ListClients is the same as ListHosts, but for client nodes.
+	ListClients(cursor string, limit int) (clients []Node, next string, err error)
+
+	// EvictNodes removes nodes which were last seen before olderThan, along
+	// with their peers, and returns their IDs. Balances and accounts are
+	// retained.
+	EvictNodes(olderThan time.Time) (evicted []NodeID, err error)
+}
+
+// Paginate trims nodes to a page of limit nodes and returns the cursor for
+// the next page, if there is one. Nodes should be sorted by ID, and contain
+// at least limit+1 nodes if there are more pages.
+func Paginate(nodes []Node, limit int) (page []Node, next string) {
+	if limit <= 0 || len(nodes) <= limit {
+		return nodes, ""
+	}
+	page = nodes[:limit]
+	return page, string(page[limit-1].ID)
 }
 
 // AccountStore manages the accounts associated with nodes and their balances.
@@ -168,6 +268,22 @@ type AccountStore interface {
 	// GetSpenders returns the authorized nodeIDs for this account, these are
 	// nodes that were added to accounts through AddAccountNode.
 	GetAccountNodes(account Account) ([]NodeID, error)
+
+	// Transfer atomically moves amount of credit from one account's balance
+	// to another's. It returns ErrInsufficientBalance if the source account
+	// has less than amount of credit, and ErrInvalidAmount if amount is
+	// negative.
+	Transfer(from, to Account, amount *big.Int) error
+}
+
+// SessionStore keeps a record of billed sessions, used for accounting.
+type SessionStore interface {
+	// AddSession records a billed session.
+	AddSession(Session) error
+	// Sessions calls fn for each session which ended within [since, until),
+	// ordered by the end time. Iteration stops if fn returns an error, which
+	// is returned.
+	Sessions(since, until time.Time, fn func(Session) error) error
 }
 
 // BalanceStore is a store subset required for the balance manager.
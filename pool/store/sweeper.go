@@ -0,0 +1,59 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+// Sweeper periodically evicts nodes that haven't been seen within TTL from
+// the store.
+type Sweeper struct {
+	Store PoolStore
+
+	// TTL is the duration since a node was last seen after which it's
+	// evicted.
+	TTL time.Duration
+
+	// Interval is the time between sweeps. Defaults to KeepaliveInterval.
+	Interval time.Duration
+
+	// OnEvict is called with the IDs of the nodes that were evicted during
+	// a sweep, if any.
+	OnEvict func(evicted []NodeID)
+
+	// OnError is called when a sweep fails. Failed sweeps are retried on
+	// the next interval.
+	OnError func(err error)
+}
+
+// Sweep evicts stale nodes once.
+func (s *Sweeper) Sweep() ([]NodeID, error) {
+	evicted, err := s.Store.EvictNodes(time.Now().Add(-s.TTL))
+	if err != nil {
+		return evicted, err
+	}
+	if len(evicted) > 0 && s.OnEvict != nil {
+		s.OnEvict(evicted)
+	}
+	return evicted, nil
+}
+
+// Run sweeps on every interval until the context is cancelled.
+func (s *Sweeper) Run(ctx context.Context) error {
+	interval := s.Interval
+	if interval == 0 {
+		interval = KeepaliveInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		if _, err := s.Sweep(); err != nil && s.OnError != nil {
+			s.OnError(err)
+		}
+	}
+}
@@ -1,9 +1,11 @@
 package store
 
 import (
+	"errors"
 	"math/big"
 	"reflect"
 	"sort"
+	"sync"
 	"testing"
 	"time"
 )
@@ -68,6 +70,10 @@ func TestSuite(t *testing.T, newStore func() Store) {
 		if err := s.SetNode(emptynode); err != ErrMalformedNode {
 			t.Errorf("expected malformed error, got: %s", err)
 		}
+		node.ClockSkew = -3 * time.Second
+		node.Capabilities = map[string]string{"archive": "true"}
+		node.InternalURI = "enode://" + string(node.ID) + "@192.168.1.10:30303"
+		node.AvailableSlots, node.SlotsKnown = 0, true
 		if err := s.SetNode(node); err != nil {
 			t.Errorf("unexpected error: %s", err)
 		}
@@ -75,6 +81,28 @@ func TestSuite(t *testing.T, newStore func() Store) {
 			t.Errorf("unexpected error: %s", err)
 		} else if r.ID != node.ID {
 			t.Errorf("returned wrong node: %v", r)
+		} else if r.ClockSkew != node.ClockSkew {
+			t.Errorf("wrong clock skew: %s", r.ClockSkew)
+		} else if r.Capabilities["archive"] != "true" || len(r.Capabilities) != 1 {
+			t.Errorf("wrong capabilities: %v", r.Capabilities)
+		} else if r.InternalURI != node.InternalURI {
+			t.Errorf("wrong internal URI: %q", r.InternalURI)
+		} else if !r.IsFull() {
+			t.Errorf("wrong available slots: %v", r.Slots())
+		}
+
+		// Clearing optional fields doesn't leave the old values behind.
+		node.Capabilities = nil
+		node.SetSlots(nil)
+		if err := s.SetNode(node); err != nil {
+			t.Errorf("unexpected error: %s", err)
+		}
+		if r, err := s.GetNode(node.ID); err != nil {
+			t.Errorf("unexpected error: %s", err)
+		} else if len(r.Capabilities) != 0 {
+			t.Errorf("capabilities were not cleared: %v", r.Capabilities)
+		} else if r.SlotsKnown {
+			t.Errorf("available slots were not cleared: %d", r.AvailableSlots)
 		}
 	})
 
@@ -195,6 +223,16 @@ func TestSuite(t *testing.T, newStore func() Store) {
 		} else if peerIDs := nodeIDs(peers); !reflect.DeepEqual(peerIDs, newPeers) {
 			t.Errorf("got: %+v; want: %+v", peerIDs, newPeers)
 		}
+
+		// Saving the node again retains its peers
+		if err := s.SetNode(node); err != nil {
+			t.Errorf("unexpected error: %s", err)
+		}
+		if peers, err := s.NodePeers(node.ID); err != nil {
+			t.Errorf("unexpected error: %s", err)
+		} else if peerIDs := nodeIDs(peers); !reflect.DeepEqual(peerIDs, newPeers) {
+			t.Errorf("peers were reset: got: %+v; want: %+v", peerIDs, newPeers)
+		}
 	})
 
 	t.Run("Node", func(t *testing.T) {
@@ -254,6 +292,71 @@ func TestSuite(t *testing.T, newStore func() Store) {
 		}
 	})
 
+	t.Run("ListNodes", func(t *testing.T) {
+		s := newStore()
+		defer s.Close()
+
+		if hosts, next, err := s.ListHosts("", 3); err != nil {
+			t.Errorf("unexpected error: %s", err)
+		} else if len(hosts) != 0 || next != "" {
+			t.Errorf("unexpected hosts: %v (next: %q)", hosts, next)
+		}
+
+		for i, node := range nodes {
+			node.IsHost = i%2 == 0 // Interlaced to check for insertion order bugs
+			if err := s.SetNode(node); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// Walk the pages while inserting new nodes before and after the
+		// cursor, which shouldn't cause overlaps or skip existing nodes.
+		walk := func(list func(cursor string, limit int) ([]Node, string, error), isHost bool) []string {
+			var got []string
+			cursor := ""
+			for i := 0; ; i++ {
+				page, next, err := list(cursor, 2)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(page) > 2 {
+					t.Errorf("page exceeds limit: %v", page)
+				}
+				for _, n := range page {
+					if n.IsHost != isHost {
+						t.Errorf("wrong kind of node in page: %+v", n)
+					}
+					got = append(got, string(n.ID))
+				}
+				if next == "" {
+					return got
+				}
+				if i == 0 {
+					for _, id := range []NodeID{"0" + NodeID(next), "z" + NodeID(next)} {
+						if err := s.SetNode(Node{ID: id, IsHost: isHost}); err != nil {
+							t.Fatal(err)
+						}
+					}
+				}
+				cursor = next
+			}
+		}
+
+		if got, want := walk(s.ListHosts, true), []string{"a", "c", "e", "g", "i", "zc"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("got: %v; want: %v", got, want)
+		}
+		if got, want := walk(s.ListClients, false), []string{"b", "d", "f", "h", "j", "zd"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("got: %v; want: %v", got, want)
+		}
+
+		// Unlimited
+		if hosts, next, err := s.ListHosts("", 0); err != nil {
+			t.Errorf("unexpected error: %s", err)
+		} else if got, want := nodeIDs(hosts), []string{"0c", "a", "c", "e", "g", "i", "zc"}; !reflect.DeepEqual(got, want) || next != "" {
+			t.Errorf("got: %v (next: %q); want: %v", got, next, want)
+		}
+	})
+
 	t.Run("Spender", func(t *testing.T) {
 		s := newStore()
 		defer s.Close()
@@ -353,6 +456,222 @@ func TestSuite(t *testing.T, newStore func() Store) {
 		}
 
 	})
+
+	t.Run("EvictNodes", func(t *testing.T) {
+		s := newStore()
+		defer s.Close()
+
+		now := time.Now()
+		stale := []Node{
+			{ID: nodes[0].ID, IsHost: true, LastSeen: now.Add(-2 * time.Hour)},
+			{ID: nodes[1].ID, LastSeen: now.Add(-2 * time.Hour)},
+		}
+		fresh := []Node{
+			{ID: nodes[2].ID, IsHost: true, LastSeen: now},
+			{ID: nodes[3].ID, LastSeen: now},
+		}
+		for _, n := range append(stale, fresh...) {
+			if err := s.SetNode(n); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := s.AddAccountNode(accounts[0], stale[1].ID); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.AddAccountBalance(accounts[0], big.NewInt(42)); err != nil {
+			t.Fatal(err)
+		}
+		// Fresh client is connected to both hosts
+		if _, err := s.UpdateNodePeers(fresh[1].ID, []string{stale[0].ID.String(), fresh[0].ID.String()}, 0); err != nil {
+			t.Fatal(err)
+		}
+
+		evicted, err := s.EvictNodes(now.Add(-time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := nodeIDs(nodeList(evicted)), nodeIDs(stale); !reflect.DeepEqual(got, want) {
+			t.Errorf("evicted: got %v; want %v", got, want)
+		}
+
+		for _, n := range stale {
+			if _, err := s.GetNode(n.ID); err != ErrUnregisteredNode {
+				t.Errorf("expected evicted node %q to be unregistered, got: %v", n.ID, err)
+			}
+		}
+		for _, n := range fresh {
+			if _, err := s.GetNode(n.ID); err != nil {
+				t.Errorf("fresh node %q was evicted: %v", n.ID, err)
+			}
+		}
+		if hosts, err := s.ActiveHosts("", 10); err != nil {
+			t.Error(err)
+		} else if got, want := nodeIDs(hosts), nodeIDs(fresh[:1]); !reflect.DeepEqual(got, want) {
+			t.Errorf("active hosts: got %v; want %v", got, want)
+		}
+		if hosts, _, err := s.ListHosts("", 10); err != nil {
+			t.Error(err)
+		} else if got, want := nodeIDs(hosts), nodeIDs(fresh[:1]); !reflect.DeepEqual(got, want) {
+			t.Errorf("listed hosts: got %v; want %v", got, want)
+		}
+		if peers, err := s.NodePeers(fresh[1].ID); err != nil {
+			t.Error(err)
+		} else if got, want := nodeIDs(peers), nodeIDs(fresh[:1]); !reflect.DeepEqual(got, want) {
+			t.Errorf("peers: got %v; want %v", got, want)
+		}
+
+		// Balances outlive their nodes
+		if b, err := s.GetAccountBalance(accounts[0]); err != nil {
+			t.Error(err)
+		} else if b.Credit.Cmp(big.NewInt(42)) != 0 {
+			t.Errorf("balance was not retained: %d", &b.Credit)
+		}
+
+		// Nothing left to evict
+		if evicted, err := s.EvictNodes(now.Add(-time.Hour)); err != nil {
+			t.Error(err)
+		} else if len(evicted) != 0 {
+			t.Errorf("unexpected eviction: %v", evicted)
+		}
+	})
+
+	t.Run("Transfer", func(t *testing.T) {
+		s := newStore()
+		defer s.Close()
+
+		from, to := accounts[0], accounts[1]
+		if err := s.AddAccountBalance(from, big.NewInt(100)); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := s.Transfer(from, to, big.NewInt(101)); err != ErrInsufficientBalance {
+			t.Errorf("expected ErrInsufficientBalance, got: %v", err)
+		}
+		if err := s.Transfer(to, from, big.NewInt(-1)); err != ErrInvalidAmount {
+			t.Errorf("expected ErrInvalidAmount, got: %v", err)
+		}
+		if err := s.Transfer(from, to, big.NewInt(60)); err != nil {
+			t.Errorf("unexpected error: %s", err)
+		}
+
+		for account, want := range map[Account]int64{from: 40, to: 60} {
+			if b, err := s.GetAccountBalance(account); err != nil {
+				t.Error(err)
+			} else if b.Credit.Cmp(big.NewInt(want)) != 0 {
+				t.Errorf("invalid balance credit for %q: %d", account, &b.Credit)
+			}
+		}
+	})
+
+	t.Run("TransferConcurrent", func(t *testing.T) {
+		s := newStore()
+		defer s.Close()
+
+		// Move credit around in a cycle concurrently, the total should be
+		// preserved and no balance should go negative.
+		cycle := []Account{"abcd", "efgh", "ijkl"}
+		const initial = 100
+		for _, account := range cycle {
+			if err := s.AddAccountBalance(account, big.NewInt(initial)); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				for j := 0; j < 20; j++ {
+					from, to := cycle[(i+j)%len(cycle)], cycle[(i+j+1)%len(cycle)]
+					amount := big.NewInt(int64(30 + (i*j)%50))
+					if err := s.Transfer(from, to, amount); err != nil && err != ErrInsufficientBalance {
+						t.Errorf("unexpected error: %s", err)
+					}
+				}
+			}(i)
+		}
+		wg.Wait()
+
+		total := new(big.Int)
+		for _, account := range cycle {
+			b, err := s.GetAccountBalance(account)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if b.Credit.Sign() < 0 {
+				t.Errorf("negative balance for %q: %d", account, &b.Credit)
+			}
+			total.Add(total, &b.Credit)
+		}
+		if want := big.NewInt(initial * int64(len(cycle))); total.Cmp(want) != 0 {
+			t.Errorf("total credit changed: got %d; want %d", total, want)
+		}
+	})
+
+	t.Run("Sessions", func(t *testing.T) {
+		s := newStore()
+		defer s.Close()
+
+		// Truncated to the precision of the coarsest driver.
+		now := time.Now().Truncate(time.Millisecond)
+		sessions := []Session{}
+		for i, client := range []NodeID{"a", "b", "a", "c"} {
+			end := now.Add(time.Duration(i) * time.Minute)
+			session := Session{
+				ClientID: client,
+				HostID:   "h",
+				Start:    end.Add(-30 * time.Second),
+				End:      end,
+			}
+			session.Amount.SetInt64(int64(100 * (i + 1)))
+			sessions = append(sessions, session)
+		}
+		// Insert out of order
+		for _, i := range []int{2, 0, 3, 1} {
+			if err := s.AddSession(sessions[i]); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		collect := func(since, until time.Time) []Session {
+			r := []Session{}
+			err := s.Sessions(since, until, func(session Session) error {
+				r = append(r, session)
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			return r
+		}
+		check := func(got []Session, want []Session) {
+			t.Helper()
+			if len(got) != len(want) {
+				t.Fatalf("got %d sessions; want %d", len(got), len(want))
+			}
+			for i := range want {
+				g, w := got[i], want[i]
+				if g.ClientID != w.ClientID || g.HostID != w.HostID || !g.Start.Equal(w.Start) || !g.End.Equal(w.End) || g.Amount.Cmp(&w.Amount) != 0 {
+					t.Errorf("session %d: got %+v; want %+v", i, g, w)
+				}
+			}
+		}
+
+		check(collect(now, now.Add(time.Hour)), sessions)
+		check(collect(now.Add(time.Minute), now.Add(3*time.Minute)), sessions[1:3])
+		check(collect(now.Add(time.Hour), now.Add(2*time.Hour)), nil)
+
+		stopErr := errors.New("stop")
+		n := 0
+		err := s.Sessions(now, now.Add(time.Hour), func(Session) error {
+			n += 1
+			return stopErr
+		})
+		if err != stopErr || n != 1 {
+			t.Errorf("iteration did not stop: %d sessions, %v", n, err)
+		}
+	})
 }
 
 func nodeIDs(nodes []Node) []string {
@@ -363,3 +682,11 @@ func nodeIDs(nodes []Node) []string {
 	sort.Strings(r)
 	return r
 }
+
+func nodeList(nodeIDs []NodeID) []Node {
+	r := make([]Node, 0, len(nodeIDs))
+	for _, id := range nodeIDs {
+		r = append(r, Node{ID: id})
+	}
+	return r
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"syscall"
+	"testing"
+)
+
+func TestServeUntilInterrupted(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = serveUntilInterrupted(&http.Server{Handler: http.NotFoundHandler()}, func(server *http.Server) error {
+		// The signal is caught by serveUntilInterrupted, which shuts down
+		// the server.
+		if err := syscall.Kill(syscall.Getpid(), syscall.SIGINT); err != nil {
+			t.Fatal(err)
+		}
+		return server.Serve(l)
+	})
+	if err != nil {
+		t.Errorf("expected nil error after shutdown, got: %s", err)
+	}
+	if err := explainTLSError(err); err != nil {
+		t.Errorf("expected nil error after shutdown, got: %s", err)
+	}
+
+	bindErr := errors.New("listen tcp :443: bind: permission denied")
+	if _, ok := explainTLSError(bindErr).(ErrExplain); !ok {
+		t.Errorf("expected ErrExplain for %q", bindErr)
+	}
+}
@@ -1,10 +1,13 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net"
+	"net/url"
 	"reflect"
+	"sync"
 	"testing"
 
 	"github.com/ethereum/go-ethereum/p2p/discv5"
@@ -14,6 +17,7 @@ import (
 	"github.com/vipnode/vipnode/internal/keygen"
 	"github.com/vipnode/vipnode/jsonrpc2"
 	"github.com/vipnode/vipnode/pool"
+	"github.com/vipnode/vipnode/pool/store"
 	"github.com/vipnode/vipnode/pool/store/memory"
 )
 
@@ -154,3 +158,161 @@ func TestCloseHost(t *testing.T) {
 	h.Stop()
 	h.Wait()
 }
+
+// hostConns tracks which hosts a client is connected to, and the fewest it
+// was connected to after the first connection.
+type hostConns struct {
+	mu        sync.Mutex
+	connected map[string]bool
+	min       int
+}
+
+func (c *hostConns) set(hostID string, connected bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.connected == nil {
+		c.connected = map[string]bool{}
+		c.min = 1
+	}
+	if connected {
+		c.connected[hostID] = true
+	} else {
+		delete(c.connected, hostID)
+	}
+	if len(c.connected) < c.min {
+		c.min = len(c.connected)
+	}
+}
+
+// connClientNode reports the client's connections to hostConns.
+type connClientNode struct {
+	*fakenode.FakeNode
+	conns *hostConns
+}
+
+func (n *connClientNode) ConnectPeer(ctx context.Context, nodeURI string) error {
+	if err := n.FakeNode.ConnectPeer(ctx, nodeURI); err != nil {
+		return err
+	}
+	uri, _ := url.Parse(nodeURI)
+	n.conns.set(uri.User.Username(), true)
+	return nil
+}
+
+func (n *connClientNode) DisconnectPeer(ctx context.Context, nodeURI string) error {
+	if err := n.FakeNode.DisconnectPeer(ctx, nodeURI); err != nil {
+		return err
+	}
+	uri, _ := url.Parse(nodeURI)
+	n.conns.set(uri.User.Username(), false)
+	return nil
+}
+
+// connHostNode reports the host dropping the client to hostConns.
+type connHostNode struct {
+	*fakenode.FakeNode
+	conns *hostConns
+}
+
+func (n *connHostNode) DisconnectPeer(ctx context.Context, nodeID string) error {
+	if err := n.FakeNode.DisconnectPeer(ctx, nodeID); err != nil {
+		return err
+	}
+	n.conns.set(n.NodeID, false)
+	return nil
+}
+
+func TestMigrateClient(t *testing.T) {
+	conns := &hostConns{}
+	p := pool.New(memory.New(), nil)
+
+	startHost := func(idx int) *connHostNode {
+		privkey := keygen.HardcodedKeyIdx(t, idx)
+		rpcPool2Host, rpcHost2Pool := jsonrpc2.ServePipe()
+		t.Cleanup(func() {
+			rpcPool2Host.Close()
+			rpcHost2Pool.Close()
+		})
+		if err := rpcPool2Host.Server.Register("vipnode_", p); err != nil {
+			t.Fatal(err)
+		}
+		nodeID := discv5.PubkeyID(&privkey.PublicKey).String()
+		node := &connHostNode{fakenode.Node(nodeID), conns}
+		h := host.New(node, "")
+		h.NodeURI = fmt.Sprintf("enode://%s@127.0.0.1:30303", nodeID)
+		if err := rpcHost2Pool.Server.RegisterMethod("vipnode_whitelist", h, "Whitelist"); err != nil {
+			t.Fatal(err)
+		}
+		if err := rpcHost2Pool.Server.RegisterMethod("vipnode_disconnect", h, "Disconnect"); err != nil {
+			t.Fatal(err)
+		}
+		if err := h.Start(pool.Remote(rpcHost2Pool, privkey)); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(h.Stop)
+		return node
+	}
+
+	oldHost := startHost(0)
+
+	rpcPool2Client, rpcClient2Pool := jsonrpc2.ServePipe()
+	defer rpcPool2Client.Close()
+	defer rpcClient2Pool.Close()
+	if err := rpcPool2Client.Server.Register("vipnode_", p); err != nil {
+		t.Fatal(err)
+	}
+	clientPrivkey := keygen.HardcodedKeyIdx(t, 2)
+	clientNodeID := discv5.PubkeyID(&clientPrivkey.PublicKey).String()
+	clientNode := &connClientNode{fakenode.Node(clientNodeID), conns}
+	c := client.New(clientNode)
+	if err := rpcClient2Pool.Server.RegisterMethod("vipnode_migrate", c, "Migrate"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Start(pool.Remote(rpcClient2Pool, clientPrivkey)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only register the new host once the client is on the old one.
+	newHost := startHost(1)
+
+	ctx := context.Background()
+	err := pool.MigrateClient(ctx, p, store.NodeID(clientNodeID), store.NodeID(oldHost.NodeID), store.NodeID(newHost.NodeID))
+	if err != nil {
+		t.Fatalf("failed to migrate: %s", err)
+	}
+
+	if conns.min == 0 {
+		t.Error("client was left without a host during migration")
+	}
+	if want := map[string]bool{newHost.NodeID: true}; !reflect.DeepEqual(conns.connected, want) {
+		t.Errorf("connected hosts: got %v; want %v", conns.connected, want)
+	}
+
+	want := fakenode.Calls{
+		fakenode.Call("AddTrustedPeer", clientNodeID),
+		fakenode.Call("RemoveTrustedPeer", clientNodeID),
+		fakenode.Call("DisconnectPeer", clientNodeID),
+	}
+	if got := oldHost.Calls; !reflect.DeepEqual(got, want) {
+		t.Errorf("oldHost.Calls:\n  got %q;\n want %q", got, want)
+	}
+	want = fakenode.Calls{fakenode.Call("AddTrustedPeer", clientNodeID)}
+	if got := newHost.Calls; !reflect.DeepEqual(got, want) {
+		t.Errorf("newHost.Calls:\n  got %q;\n want %q", got, want)
+	}
+
+	// The client keeps the new host when it stops.
+	c.Stop()
+	if err := c.Wait(); err != nil {
+		t.Error(err)
+	}
+	want = fakenode.Calls{
+		fakenode.Call("ConnectPeer", fmt.Sprintf("enode://%s@127.0.0.1:30303", oldHost.NodeID)),
+		fakenode.Call("ConnectPeer", fmt.Sprintf("enode://%s@127.0.0.1:30303", newHost.NodeID)),
+		fakenode.Call("DisconnectPeer", fmt.Sprintf("enode://%s@127.0.0.1:30303", oldHost.NodeID)),
+		fakenode.Call("DisconnectPeer", fmt.Sprintf("enode://%s@127.0.0.1:30303", newHost.NodeID)),
+	}
+	if got := clientNode.Calls; !reflect.DeepEqual(got, want) {
+		t.Errorf("clientNode.Calls:\n  got %q;\n want %q", got, want)
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/vipnode/vipnode/ethnode"
+)
+
+func runProbe(options Options, w io.Writer) error {
+	rpcPath, err := defaultRPCPath(options.Probe.RPC)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+	defer cancel()
+
+	client, err := rpc.DialContext(ctx, rpcPath)
+	if err != nil {
+		return ErrExplain{err, fmt.Sprintf(`Could not connect to the RPC path of the node. Tried "%s". You can specify the path with the --rpc="..." flag.`, rpcPath)}
+	}
+	defer client.Close()
+
+	info, err := ethnode.Probe(ctx, client)
+	if err != nil {
+		return ErrExplain{err, "Failed to detect the node. Make sure it's an Ethereum node (such as Geth or Parity) with RPC enabled."}
+	}
+	if options.Probe.DiskUsage && info.DataDir != "" {
+		if info.DiskUsage, err = ethnode.DiskUsage(info.DataDir); err != nil {
+			logger.Warningf("Failed to measure the disk usage of the node's data directory: %s", err)
+		}
+	}
+	if err := writeProbe(w, info); err != nil {
+		return err
+	}
+	return checkProbe(info)
+}
+
+// writeProbe prints the detected node info as a table.
+func writeProbe(w io.Writer, info *ethnode.NodeInfo) error {
+	yesno := func(b bool) string {
+		if b {
+			return "yes"
+		}
+		return "no"
+	}
+	syncStatus := fmt.Sprintf("synced at block %d", info.CurrentBlock)
+	if info.Syncing {
+		syncStatus = fmt.Sprintf("syncing, at block %d of %d", info.CurrentBlock, info.HighestBlock)
+	}
+	chainID := "unknown"
+	if info.ChainID != 0 {
+		chainID = fmt.Sprintf("%d", info.ChainID)
+	}
+	if info.ChainID != 0 && info.Network != info.NetVersion {
+		chainID = fmt.Sprintf("%d (network ID is %d)", info.ChainID, info.NetVersion)
+	}
+	adminAPI := "available"
+	if !info.AdminAPI() {
+		adminAPI = fmt.Sprintf("unavailable (%s)", info.AdminErr)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	rows := [][2]string{
+		{"Kind", info.Kind.String()},
+		{"Version", info.Version},
+		{"Network", fmt.Sprintf("%s (%d)", info.Network, info.Network)},
+		{"Chain ID", chainID},
+		{"Full node", yesno(info.IsFullNode)},
+		{"Sync status", syncStatus},
+		{"Peers", fmt.Sprintf("%d", info.NumPeers)},
+		{"Admin API", adminAPI},
+	}
+	if info.IsPoS {
+		rows = append(rows, [2]string{"Consensus", "proof of stake"})
+	}
+	if info.Namespaces != nil {
+		apis := strings.Join(ethnode.EnabledNamespaces(info.Namespaces), ", ")
+		if missing := ethnode.MissingNamespaces(info.Kind, info.Namespaces); len(missing) > 0 {
+			apis += fmt.Sprintf(" (missing: %s)", strings.Join(missing, ", "))
+		}
+		rows = append(rows, [2]string{"APIs", apis})
+	}
+	if info.Capabilities != nil && !info.Capabilities.Supported() {
+		rows = append(rows, [2]string{"Missing methods", strings.Join(info.Capabilities.Missing, ", ")})
+	}
+	if info.DataDir != "" {
+		dataDir := info.DataDir
+		if info.DiskUsage > 0 {
+			dataDir += fmt.Sprintf(" (%s used)", formatBytes(info.DiskUsage))
+		}
+		rows = append(rows, [2]string{"Data dir", dataDir})
+	}
+	if info.Enode != "" {
+		rows = append(rows, [2]string{"Enode", info.Enode})
+	}
+	for _, row := range rows {
+		if _, err := fmt.Fprintf(tw, "%s:\t%s\n", row[0], row[1]); err != nil {
+			return err
+		}
+	}
+	return tw.Flush()
+}
+
+// checkProbe returns an error if the node can't be used with vipnode.
+func checkProbe(info *ethnode.NodeInfo) error {
+	// Missing namespaces are checked first, since they are the likely cause
+	// of other failures and we can say exactly what to enable.
+	if missing := ethnode.MissingNamespaces(info.Kind, info.Namespaces); info.Namespaces != nil && len(missing) > 0 {
+		return ErrExplain{fmt.Errorf("node is missing required RPC APIs: %s", strings.Join(missing, ", ")), explainNamespaces(info)}
+	}
+	if !info.AdminAPI() {
+		return ErrExplain{errors.New("peer management API is unavailable"), `vipnode needs to manage the node's peers. For Geth, enable the admin API with --rpcapi="admin,eth,net,web3" or use the IPC path.`}
+	}
+	if info.Capabilities != nil && !info.Capabilities.Supported() {
+		return ErrExplain{fmt.Errorf("node is missing required RPC methods: %s", strings.Join(info.Capabilities.Missing, ", ")), "Make sure the node's version is supported by vipnode and that the required APIs are enabled."}
+	}
+	if info.Syncing {
+		return ErrExplain{errors.New("node is still syncing"), "Wait for the node to finish syncing before using it with vipnode."}
+	}
+	return nil
+}
+
+// explainNamespaces suggests how to enable the node's missing RPC APIs,
+// keeping the ones that are already enabled.
+func explainNamespaces(info *ethnode.NodeInfo) string {
+	apis := ethnode.EnabledNamespaces(info.Namespaces)
+	apis = append(apis, ethnode.MissingNamespaces(info.Kind, info.Namespaces)...)
+	sort.Strings(apis)
+	flag := ethnode.NamespaceFlag(info.Kind)
+	if info.Kind == ethnode.Parity {
+		return fmt.Sprintf(`Enable the missing APIs with %s="%s" or use the IPC path.`, flag, strings.Join(apis, ","))
+	}
+	return fmt.Sprintf(`Enable the missing APIs with %s="%s" (--rpcapi on older versions of Geth) or use the IPC path.`, flag, strings.Join(apis, ","))
+}
+
+// formatBytes formats a size in bytes with a binary unit, like "1.5 GiB".
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
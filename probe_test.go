@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/vipnode/vipnode/ethnode"
+)
+
+func TestWriteProbe(t *testing.T) {
+	testcases := []struct {
+		info     ethnode.NodeInfo
+		want     string
+		unusable bool
+	}{
+		{
+			info: ethnode.NodeInfo{
+				UserAgent: ethnode.UserAgent{
+					Version:    "Geth/v1.8.21-stable/linux-amd64/go1.11.4",
+					Kind:       ethnode.Geth,
+					NetVersion: ethnode.Mainnet,
+					ChainID:    1,
+					Network:    ethnode.Mainnet,
+					IsFullNode: true,
+				},
+				CurrentBlock: 7000000,
+				NumPeers:     25,
+				Enode:        "enode://foo@127.0.0.1:30303",
+			},
+			want: `Kind:         geth
+Version:      Geth/v1.8.21-stable/linux-amd64/go1.11.4
+Network:      mainnet (1)
+Chain ID:     1
+Full node:    yes
+Sync status:  synced at block 7000000
+Peers:        25
+Admin API:    available
+Enode:        enode://foo@127.0.0.1:30303
+`,
+		},
+		{
+			info: ethnode.NodeInfo{
+				UserAgent: ethnode.UserAgent{
+					Version: "Parity-Ethereum//v2.0.5-stable/x86_64-linux-gnu/rustc1.29.0",
+					Kind:    ethnode.Parity,
+					Network: ethnode.Kovan,
+				},
+				Syncing:      true,
+				CurrentBlock: 100,
+				HighestBlock: 200,
+				AdminErr:     errors.New("method not found"),
+			},
+			want: `Kind:         parity
+Version:      Parity-Ethereum//v2.0.5-stable/x86_64-linux-gnu/rustc1.29.0
+Network:      kovan (42)
+Chain ID:     unknown
+Full node:    no
+Sync status:  syncing, at block 100 of 200
+Peers:        0
+Admin API:    unavailable (method not found)
+`,
+			unusable: true,
+		},
+		{
+			info: ethnode.NodeInfo{
+				UserAgent: ethnode.UserAgent{
+					Version:    "Geth/v1.10.1-stable/linux-amd64/go1.16",
+					Kind:       ethnode.Geth,
+					NetVersion: ethnode.Mainnet,
+					ChainID:    1,
+					Network:    ethnode.Mainnet,
+					IsFullNode: true,
+				},
+				CurrentBlock: 12000000,
+				NumPeers:     50,
+				AdminErr:     errors.New("method not found"),
+				Namespaces:   map[string]bool{"eth": true, "net": true, "web3": true, "admin": false, "txpool": false},
+			},
+			want: `Kind:         geth
+Version:      Geth/v1.10.1-stable/linux-amd64/go1.16
+Network:      mainnet (1)
+Chain ID:     1
+Full node:    yes
+Sync status:  synced at block 12000000
+Peers:        50
+Admin API:    unavailable (method not found)
+APIs:         eth, net, web3 (missing: admin)
+`,
+			unusable: true,
+		},
+		{
+			info: ethnode.NodeInfo{
+				UserAgent: ethnode.UserAgent{
+					Version:    "Geth/v1.8.21-stable/linux-amd64/go1.11.4",
+					Kind:       ethnode.Geth,
+					NetVersion: ethnode.Mainnet,
+					ChainID:    1,
+					Network:    ethnode.Mainnet,
+					IsFullNode: true,
+				},
+				CurrentBlock: 7000000,
+				NumPeers:     25,
+				Enode:        "enode://foo@127.0.0.1:30303",
+				DataDir:      "/home/geth/.ethereum",
+				DiskUsage:    3 << 29,
+			},
+			want: `Kind:         geth
+Version:      Geth/v1.8.21-stable/linux-amd64/go1.11.4
+Network:      mainnet (1)
+Chain ID:     1
+Full node:    yes
+Sync status:  synced at block 7000000
+Peers:        25
+Admin API:    available
+Data dir:     /home/geth/.ethereum (1.5 GiB used)
+Enode:        enode://foo@127.0.0.1:30303
+`,
+		},
+	}
+
+	for i, tc := range testcases {
+		var buf bytes.Buffer
+		if err := writeProbe(&buf, &tc.info); err != nil {
+			t.Fatal(err)
+		}
+		if got := buf.String(); got != tc.want {
+			t.Errorf("[case %d] got:\n%s\nwant:\n%s", i, got, tc.want)
+		}
+		if err := checkProbe(&tc.info); (err != nil) != tc.unusable {
+			t.Errorf("[case %d] unexpected check result: %v", i, err)
+		}
+	}
+}
+
+func TestCheckProbeNamespaces(t *testing.T) {
+	info := &ethnode.NodeInfo{
+		UserAgent:  ethnode.UserAgent{Kind: ethnode.Geth},
+		Namespaces: map[string]bool{"eth": true, "web3": true},
+	}
+	err := checkProbe(info)
+	explain, ok := err.(ErrExplain)
+	if !ok {
+		t.Fatalf("expected ErrExplain, got: %v", err)
+	}
+	if got, want := explain.Cause.Error(), "node is missing required RPC APIs: net, admin"; got != want {
+		t.Errorf("got %q; want %q", got, want)
+	}
+	if got, want := explain.Explanation, `--http.api="admin,eth,net,web3"`; !strings.Contains(got, want) {
+		t.Errorf("got %q; want %q", got, want)
+	}
+}
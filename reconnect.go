@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/vipnode/vipnode/ethnode"
+	"github.com/vipnode/vipnode/pool"
+)
+
+// agentState is the state of a host or client agent's connection.
+type agentState int
+
+const (
+	agentStarting agentState = iota
+	agentConnected
+	agentRetrying
+	// agentFailed is terminal, the agent ran out of reconnect attempts.
+	agentFailed
+)
+
+func (s agentState) String() string {
+	switch s {
+	case agentConnected:
+		return "CONNECTED"
+	case agentRetrying:
+		return "RETRYING"
+	case agentFailed:
+		return "FAILED"
+	default:
+		return "STARTING"
+	}
+}
+
+// ErrReconnectFailed is returned when an agent gives up after running out of
+// reconnect attempts.
+type ErrReconnectFailed struct {
+	Attempts int
+	Cause    error
+}
+
+func (err ErrReconnectFailed) Error() string {
+	return fmt.Sprintf("gave up after %d failed reconnect attempts: %s", err.Attempts, err.Cause)
+}
+
+// retryWarning returns the warning to log before retrying after err, or
+// false if err can't be fixed by retrying.
+func retryWarning(err error, waitTime time.Duration) (string, bool) {
+	if err == io.EOF {
+		return fmt.Sprintf("Connection closed, retrying in %s...", waitTime), true
+	} else if errRetry, ok := err.(ErrExplainRetry); ok {
+		return fmt.Sprintf("Failed to connect, retrying in %s: %s", waitTime, errRetry.Cause), true
+	} else if _, ok := err.(net.Error); ok {
+		return fmt.Sprintf("Failed to connect, retrying in %s: %s", waitTime, err), true
+	} else if _, ok := err.(ethnode.TransportError); ok {
+		return fmt.Sprintf("Lost connection to the Ethereum node, retrying in %s: %s", waitTime, err), true
+	} else if err.Error() == (pool.NoHostNodesError{}).Error() {
+		return fmt.Sprintf("Pool does not have available hosts, retrying in %s...", waitTime), true
+	}
+	return "", false
+}
+
+// reconnector runs an agent until it stops cleanly or fails with an error
+// that retrying won't fix, and restarts it with a backoff otherwise.
+type reconnector struct {
+	// Backoff is the sequence of waits between consecutive attempts. The
+	// last one is repeated.
+	Backoff []time.Duration
+	// MaxAttempts is the number of consecutive failed reconnect attempts
+	// before the agent gives up in the agentFailed state. (Unlimited if 0)
+	MaxAttempts int
+
+	// wait blocks for d, and returns false if the agent was interrupted.
+	wait func(d time.Duration) bool
+
+	mu       sync.Mutex
+	state    agentState
+	attempts int
+}
+
+// State returns the current state of the agent.
+func (r *reconnector) State() agentState {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.state
+}
+
+// connected is called by the agent when it connects successfully, which
+// resets the failed attempts.
+func (r *reconnector) connected() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.state = agentConnected
+	r.attempts = 0
+}
+
+// Run calls run, and calls it again after recoverable errors until it
+// returns nil or MaxAttempts consecutive reconnects have failed. The run
+// function is passed a callback to signal that it connected.
+func (r *reconnector) Run(run func(connected func()) error) error {
+	for {
+		err := run(r.connected)
+		if err == nil {
+			return nil
+		}
+
+		r.mu.Lock()
+		attempts := r.attempts
+		b := attempts
+		if b >= len(r.Backoff) {
+			// Keep trying at the max interval
+			b = len(r.Backoff) - 1
+		}
+		waitTime := r.Backoff[b]
+		msg, ok := retryWarning(err, waitTime)
+		if ok && r.MaxAttempts > 0 && attempts >= r.MaxAttempts {
+			r.state = agentFailed
+			r.mu.Unlock()
+			return ErrReconnectFailed{Attempts: attempts, Cause: err}
+		}
+		if ok {
+			r.state = agentRetrying
+			r.attempts++
+		}
+		r.mu.Unlock()
+		if !ok {
+			return err
+		}
+
+		logger.Warning(msg)
+		if !r.wait(waitTime) {
+			return nil
+		}
+	}
+}
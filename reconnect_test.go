@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+func newTestReconnector(maxAttempts int, waits *[]time.Duration) *reconnector {
+	return &reconnector{
+		Backoff:     []time.Duration{time.Second, 2 * time.Second},
+		MaxAttempts: maxAttempts,
+		wait: func(d time.Duration) bool {
+			*waits = append(*waits, d)
+			return true
+		},
+	}
+}
+
+func TestReconnectFailed(t *testing.T) {
+	var waits []time.Duration
+	r := newTestReconnector(3, &waits)
+	calls := 0
+	err := r.Run(func(connected func()) error {
+		calls++
+		return io.EOF
+	})
+	if err, ok := err.(ErrReconnectFailed); !ok || err.Attempts != 3 || err.Cause != io.EOF {
+		t.Fatalf("expected ErrReconnectFailed after 3 attempts, got: %v", err)
+	}
+	if r.State() != agentFailed {
+		t.Errorf("wrong state: %s", r.State())
+	}
+	if calls != 4 {
+		t.Errorf("expected initial attempt and 3 reconnects, got %d calls", calls)
+	}
+	if want := []time.Duration{time.Second, 2 * time.Second, 2 * time.Second}; len(waits) != len(want) || waits[0] != want[0] || waits[2] != want[2] {
+		t.Errorf("wrong backoff: %v", waits)
+	}
+}
+
+func TestReconnectReset(t *testing.T) {
+	var waits []time.Duration
+	r := newTestReconnector(2, &waits)
+	calls := 0
+	err := r.Run(func(connected func()) error {
+		calls++
+		switch calls {
+		case 3:
+			// Connected after 2 failed attempts, then lost the connection.
+			connected()
+			if r.State() != agentConnected {
+				t.Errorf("wrong state after connecting: %s", r.State())
+			}
+			return io.EOF
+		case 5:
+			// Connected again on the last allowed attempt and stopped
+			// cleanly.
+			connected()
+			return nil
+		}
+		return io.EOF
+	})
+	if err != nil {
+		t.Fatalf("expected attempts to be reset after connecting, got: %v", err)
+	}
+	if calls != 5 {
+		t.Errorf("wrong number of calls: %d", calls)
+	}
+	// The backoff starts over after connecting.
+	if len(waits) != 4 || waits[2] != time.Second {
+		t.Errorf("wrong backoff: %v", waits)
+	}
+}
+
+func TestReconnectUnlimited(t *testing.T) {
+	var waits []time.Duration
+	r := newTestReconnector(0, &waits)
+	calls := 0
+	err := r.Run(func(connected func()) error {
+		calls++
+		if calls < 20 {
+			return io.EOF
+		}
+		return nil
+	})
+	if err != nil || calls != 20 {
+		t.Errorf("expected retries without a limit, got %d calls: %v", calls, err)
+	}
+}
+
+func TestReconnectFatal(t *testing.T) {
+	var waits []time.Duration
+	r := newTestReconnector(3, &waits)
+	fatal := errors.New("bad config")
+	if err := r.Run(func(connected func()) error { return fatal }); err != fatal {
+		t.Errorf("expected fatal error to be returned, got: %v", err)
+	}
+	if len(waits) != 0 || r.State() == agentFailed {
+		t.Errorf("fatal error should not be retried: %v, %s", waits, r.State())
+	}
+}
@@ -17,7 +17,9 @@ type AddressRequest struct {
 	ExtraArgs []interface{}
 }
 
-func (r AddressRequest) hash() ([]byte, error) {
+// Hash returns the hash of the unsigned request payload, which is what gets
+// signed.
+func (r AddressRequest) Hash() ([]byte, error) {
 	req, err := assemble(r.Method, r.Address, r.Nonce, r.ExtraArgs...)
 	if err != nil {
 		return nil, err
@@ -36,25 +38,41 @@ func (r AddressRequest) hash() ([]byte, error) {
 // the signature for the remaining arguments. This is a convenient form factor
 // for doing signed RPC calls.
 func (r AddressRequest) SignedArgs(privkey *ecdsa.PrivateKey) ([]interface{}, error) {
-	sig, err := r.Sign(privkey)
+	return r.SignedArgsWith(KeySigner(privkey))
+}
+
+// SignedArgsWith is SignedArgs using an external Signer.
+func (r AddressRequest) SignedArgsWith(signer Signer) ([]interface{}, error) {
+	sig, err := r.SignWith(signer)
 	if err != nil {
 		return nil, err
 	}
+	return r.Args(sig), nil
+}
 
+// Args returns a slice of arguments with the first element containing the
+// given signature, such as one produced offline for the result of Hash.
+func (r AddressRequest) Args(sig string) []interface{} {
 	args := make([]interface{}, 0, 3+len(r.ExtraArgs))
 	args = append(args, sig, r.Address, r.Nonce)
 	args = append(args, r.ExtraArgs...)
-	return args, nil
+	return args
 }
 
 // Sign produces a hex-encoded signature of the request.
 func (r AddressRequest) Sign(privkey *ecdsa.PrivateKey) (string, error) {
-	hashed, err := r.hash()
+	return r.SignWith(KeySigner(privkey))
+}
+
+// SignWith produces a hex-encoded signature of the request using an
+// external Signer.
+func (r AddressRequest) SignWith(signer Signer) (string, error) {
+	hashed, err := r.Hash()
 	if err != nil {
 		return "", err
 	}
 
-	sigbytes, err := crypto.Sign(hashed, privkey)
+	sigbytes, err := signer.SignHash(hashed)
 	if err != nil {
 		return "", err
 	}
@@ -82,7 +100,7 @@ func (r AddressRequest) Verify(sig string) error {
 		sigbytes[64] -= 27
 	}
 
-	hashed, err := r.hash()
+	hashed, err := r.Hash()
 	if err != nil {
 		return fmt.Errorf("failed to hash request: %s", err)
 	}
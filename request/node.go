@@ -16,7 +16,9 @@ type NodeRequest struct {
 	ExtraArgs []interface{}
 }
 
-func (r NodeRequest) hash() ([]byte, error) {
+// Hash returns the hash of the unsigned request payload, which is what gets
+// signed.
+func (r NodeRequest) Hash() ([]byte, error) {
 	req, err := assemble(r.Method, r.NodeID, r.Nonce, r.ExtraArgs...)
 	if err != nil {
 		return nil, err
@@ -31,25 +33,41 @@ func (r NodeRequest) hash() ([]byte, error) {
 // the signature for the remaining arguments. This is a convenient form factor
 // for doing signed RPC calls.
 func (r NodeRequest) SignedArgs(privkey *ecdsa.PrivateKey) ([]interface{}, error) {
-	sig, err := r.Sign(privkey)
+	return r.SignedArgsWith(KeySigner(privkey))
+}
+
+// SignedArgsWith is SignedArgs using an external Signer.
+func (r NodeRequest) SignedArgsWith(signer Signer) ([]interface{}, error) {
+	sig, err := r.SignWith(signer)
 	if err != nil {
 		return nil, err
 	}
+	return r.Args(sig), nil
+}
 
+// Args returns a slice of arguments with the first element containing the
+// given signature, such as one produced offline for the result of Hash.
+func (r NodeRequest) Args(sig string) []interface{} {
 	args := make([]interface{}, 0, 3+len(r.ExtraArgs))
 	args = append(args, sig, r.NodeID, r.Nonce)
 	args = append(args, r.ExtraArgs...)
-	return args, nil
+	return args
 }
 
 // Sign produces a base64-encoded signature of the request.
 func (r NodeRequest) Sign(privkey *ecdsa.PrivateKey) (string, error) {
-	hashed, err := r.hash()
+	return r.SignWith(KeySigner(privkey))
+}
+
+// SignWith produces a base64-encoded signature of the request using an
+// external Signer.
+func (r NodeRequest) SignWith(signer Signer) (string, error) {
+	hashed, err := r.Hash()
 	if err != nil {
 		return "", err
 	}
 
-	sigbytes, err := crypto.Sign(hashed, privkey)
+	sigbytes, err := signer.SignHash(hashed)
 	if err != nil {
 		return "", err
 	}
@@ -79,7 +97,7 @@ func (r NodeRequest) Verify(sig string) error {
 	// ¯\_(ツ)_/¯
 	sigbytes = sigbytes[:64]
 
-	hashed, err := r.hash()
+	hashed, err := r.Hash()
 	if err != nil {
 		return err
 	}
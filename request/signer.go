@@ -0,0 +1,30 @@
+package request
+
+import (
+	"crypto/ecdsa"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Signer signs request payload hashes, as returned by NodeRequest.Hash or
+// AddressRequest.Hash. Signatures must be in the 65-byte [R || S || V] form
+// produced by crypto.Sign.
+//
+// Implementing Signer allows the private key to be kept outside of the
+// process, such as in an HSM or an air-gapped signing service.
+type Signer interface {
+	SignHash(hash []byte) ([]byte, error)
+}
+
+// KeySigner returns a Signer for a private key held in memory.
+func KeySigner(privkey *ecdsa.PrivateKey) Signer {
+	return keySigner{privkey}
+}
+
+type keySigner struct {
+	privkey *ecdsa.PrivateKey
+}
+
+func (s keySigner) SignHash(hash []byte) ([]byte, error) {
+	return crypto.Sign(hash, s.privkey)
+}
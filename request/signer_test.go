@@ -0,0 +1,107 @@
+package request
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p/discv5"
+	"github.com/vipnode/vipnode/internal/keygen"
+)
+
+// externalSigner is a mock of an external signing device, which only ever
+// sees payload hashes.
+type externalSigner struct {
+	privkey *ecdsa.PrivateKey
+	hashes  [][]byte
+	err     error
+}
+
+func (s *externalSigner) SignHash(hash []byte) ([]byte, error) {
+	s.hashes = append(s.hashes, hash)
+	if s.err != nil {
+		return nil, s.err
+	}
+	return crypto.Sign(hash, s.privkey)
+}
+
+func TestExternalSigner(t *testing.T) {
+	signer := &externalSigner{privkey: keygen.HardcodedKey(t)}
+	req := NodeRequest{
+		Method:    "vipnode_host",
+		NodeID:    discv5.PubkeyID(&signer.privkey.PublicKey).String(),
+		Nonce:     42,
+		ExtraArgs: []interface{}{"foo"},
+	}
+
+	args, err := req.SignedArgsWith(signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, err := req.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(signer.hashes) != 1 || !bytes.Equal(signer.hashes[0], hash) {
+		t.Errorf("signer was not given the payload hash: %x", signer.hashes)
+	}
+	if len(args) != 4 || args[1] != req.NodeID || args[2] != req.Nonce || args[3] != "foo" {
+		t.Errorf("wrong args: %v", args)
+	}
+	sig := args[0].(string)
+	if err := Verify(sig, req.Method, req.NodeID, req.Nonce, req.ExtraArgs...); err != nil {
+		t.Errorf("failed to verify external signature: %s", err)
+	}
+
+	// Same as signing with the key in-process
+	if want, err := req.Sign(signer.privkey); err != nil {
+		t.Fatal(err)
+	} else if sig != want {
+		t.Errorf("signatures don't match: %q != %q", sig, want)
+	}
+
+	signer.err = errors.New("device locked")
+	if _, err := req.SignWith(signer); err != signer.err {
+		t.Errorf("expected signer error, got: %v", err)
+	}
+}
+
+func TestOfflineSignature(t *testing.T) {
+	privkey := keygen.HardcodedKey(t)
+	req := AddressRequest{
+		Method:  "vipnode_addNode",
+		Address: crypto.PubkeyToAddress(privkey.PublicKey).Hex(),
+		Nonce:   42,
+	}
+
+	// The hash is exported to be signed elsewhere, then the signature is
+	// brought back to assemble the args.
+	hash, err := req.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sigbytes, err := crypto.Sign(hash, privkey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	args := req.Args("0x" + hex.EncodeToString(sigbytes))
+	if err := req.Verify(args[0].(string)); err != nil {
+		t.Errorf("failed to verify offline signature: %s", err)
+	}
+
+	nodeReq := NodeRequest{Method: "vipnode_host", NodeID: discv5.PubkeyID(&privkey.PublicKey).String(), Nonce: 42}
+	hash, err = nodeReq.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sigbytes, err = crypto.Sign(hash, privkey); err != nil {
+		t.Fatal(err)
+	}
+	if err := nodeReq.Verify(base64.StdEncoding.EncodeToString(sigbytes)); err != nil {
+		t.Errorf("failed to verify offline signature: %s", err)
+	}
+}
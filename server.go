@@ -5,6 +5,8 @@ import (
 	"net/http"
 
 	"github.com/vipnode/vipnode/jsonrpc2"
+	"github.com/vipnode/vipnode/jsonrpc2/longpoll"
+	"github.com/vipnode/vipnode/jsonrpc2/tcp"
 	"github.com/vipnode/vipnode/jsonrpc2/ws"
 )
 
@@ -17,9 +19,27 @@ type server struct {
 	ws       ws.Upgrader
 	debugLog bool
 	header   http.Header
+	// limiter caps the persistent connections per source IP, if set.
+	limiter *jsonrpc2.IPLimiter
+	// poll serves long-polling sessions on pollPath, if set.
+	poll *longpoll.Handler
+	// onClose is called with the remote of each persistent connection once
+	// it's closed, if set.
+	onClose func(jsonrpc2.Service)
 }
 
+// pollPath is where the pool serves long-polling sessions.
+const pollPath = "/poll"
+
+// pollScheme prefixes the scheme of pool URLs to connect to over long-polling,
+// like "poll+https://pool.vipnode.org/poll".
+const pollScheme = "poll+"
+
 func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.poll != nil && r.URL.Path == pollPath {
+		s.poll.ServeHTTP(w, r)
+		return
+	}
 	switch r.Method {
 	case http.MethodPost:
 		// Assume RPC over HTTP
@@ -34,27 +54,55 @@ func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "incorrect vipnode api handshake", http.StatusBadRequest)
 			return
 		}
+		if s.limiter != nil {
+			if err := s.limiter.Allow(r.RemoteAddr); err != nil {
+				logger.Debugf("websocket connection rejected: %s", err)
+				http.Error(w, err.Error(), http.StatusTooManyRequests)
+				return
+			}
+		}
 		// Assume WebSocket upgrade request
 		codec, err := s.ws.Upgrade(r, w, nil)
 		if err != nil {
 			logger.Debugf("websocket upgrade error from %s: %s", r.RemoteAddr, err)
 			return
 		}
-		if s.debugLog {
-			codec = jsonrpc2.DebugCodec(r.RemoteAddr, codec)
-		}
-		remote := &jsonrpc2.Remote{
-			Codec:  codec,
-			Server: &s.HTTPServer.Server,
-			Client: &jsonrpc2.Client{},
-
-			PendingLimit:   50,
-			PendingDiscard: 10,
-		}
-		if err := remote.Serve(); err != nil && err != io.EOF {
-			logger.Warningf("jsonrpc2.Remote.Serve() error: %s", err)
-		}
+		s.serveCodec(codec)
 	default:
 		http.Error(w, "unsupported method", http.StatusUnsupportedMediaType)
 	}
 }
+
+// serveCodec serves RPC in both directions over a persistent connection
+// until it's closed.
+func (s *server) serveCodec(codec jsonrpc2.Codec) {
+	if s.debugLog {
+		codec = jsonrpc2.DebugCodec(codec.RemoteAddr(), codec)
+	}
+	remote := &jsonrpc2.Remote{
+		Codec:  codec,
+		Server: &s.HTTPServer.Server,
+		Client: &jsonrpc2.Client{},
+
+		PendingLimit:   50,
+		PendingDiscard: 10,
+	}
+	if err := remote.Serve(); err != nil && err != io.EOF {
+		logger.Warningf("jsonrpc2.Remote.Serve() error: %s", err)
+	}
+	if s.onClose != nil {
+		s.onClose(remote)
+	}
+}
+
+// serveTCP accepts connections over plain TCP, for agents which can't use
+// WebSocket, until the listener is closed.
+func (s *server) serveTCP(l *tcp.Listener) error {
+	for {
+		codec, err := l.AcceptCodec()
+		if err != nil {
+			return err
+		}
+		go s.serveCodec(codec)
+	}
+}